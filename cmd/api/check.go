@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/parvez-capri/ronnin/internal/handlers"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// reportDependencies probes every dependency and logs the results as a
+// single dependency report. Dependencies in initErrors are configured but
+// failed to initialize. It reports whether all configured dependencies are
+// reachable.
+func reportDependencies(ctx context.Context, health *handlers.HealthHandler, initErrors map[string]error, log *zap.Logger) bool {
+	results := health.Check(ctx)
+	for name, err := range initErrors {
+		results[name] = handlers.FailedDependency(err)
+	}
+
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reachable := true
+	fields := make([]zap.Field, 0, len(names))
+	for _, name := range names {
+		result := results[name]
+		if !result.OK() {
+			reachable = false
+		}
+
+		dependency := []zap.Field{zap.String("status", result.Status)}
+		if result.Latency > 0 {
+			dependency = append(dependency, zap.Duration("latency", result.Latency))
+		}
+		if result.Err != nil {
+			dependency = append(dependency, zap.Error(result.Err))
+		}
+		fields = append(fields, zap.Dict(name, dependency...))
+	}
+
+	level := zapcore.InfoLevel
+	if !reachable {
+		level = zapcore.ErrorLevel
+	}
+	log.Log(level, "Dependency report", append(fields, zap.Bool("ready", reachable))...)
+	return reachable
+}
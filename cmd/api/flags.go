@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/parvez-capri/ronnin/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// cliOptions are the flags that precede any command
+type cliOptions struct {
+	config config.Options
+
+	// check probes the dependencies and exits instead of serving
+	check bool
+
+	// args are the command and its arguments
+	args []string
+}
+
+// parseFlags reads the flags that precede any command
+func parseFlags(args []string) (cliOptions, error) {
+	flags := flag.NewFlagSet("ronnin", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv("RONNIN_CONFIG"), "YAML configuration file, with profiles per environment")
+	environment := flags.String("env", "", "environment to run as: development, staging or production")
+	port := flags.Int("port", 0, "port to listen on")
+	logLevel := flags.String("log-level", "", "log level: debug, info, warn or error")
+	check := flags.Bool("check", false, "check that every configured dependency is reachable, then exit non-zero if one is not")
+	embedded := flags.Bool("embedded", false, "run self-contained, keeping tickets and uploads under the data directory instead of Jira, MongoDB and object storage")
+	dataDir := flags.String("data-dir", "", "directory self-contained mode keeps its data in")
+	if err := flags.Parse(args); err != nil {
+		return cliOptions{}, err
+	}
+	// serve is the default command, and may be followed by flags of its own
+	if flags.NArg() > 0 && flags.Arg(0) == "serve" {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return cliOptions{}, err
+		}
+	}
+
+	// Only flags given on the command line override the configuration
+	opts := config.Options{File: *file, Flags: map[string]string{}}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			opts.Flags["ENV"] = *environment
+		case "port":
+			opts.Flags["PORT"] = strconv.Itoa(*port)
+		case "log-level":
+			opts.Flags["LOG_LEVEL"] = *logLevel
+		case "embedded":
+			opts.Flags["EMBEDDED"] = strconv.FormatBool(*embedded)
+		case "data-dir":
+			opts.Flags["DATA_DIR"] = *dataDir
+		}
+	})
+	return cliOptions{config: opts, check: *check, args: flags.Args()}, nil
+}
+
+// runConfig runs the config command, which prints the effective
+// configuration with credentials redacted once it has loaded and validated
+func runConfig(cfg *config.Config, args []string) int {
+	if len(args) != 1 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "usage: config validate")
+		return 2
+	}
+
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to print configuration:", err)
+		return 1
+	}
+	os.Stdout.Write(out)
+	return 0
+}
@@ -3,39 +3,33 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"syscall"
 	"time"
 
 	"github.com/parvez-capri/ronnin/internal/config"
 	"github.com/parvez-capri/ronnin/internal/handlers"
+	"github.com/parvez-capri/ronnin/internal/middleware"
 	"github.com/parvez-capri/ronnin/internal/services"
 	"github.com/parvez-capri/ronnin/pkg/logger"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
-	_ "github.com/parvez-capri/ronnin/docs"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/parvez-capri/ronnin/docs"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"go.uber.org/zap"
 )
 
-var (
-	httpRequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-)
-
 // @title           Ronnin API
 // @version         1.0
 // @description     API Server for issue reporting with Jira integration, MongoDB persistence, and S3 file uploads
@@ -49,7 +43,7 @@ var (
 // @license.url   http://www.apache.org/licenses/LICENSE-2.0.html
 
 // @host      localhost:8080
-// @BasePath  /
+// @BasePath  /api/v1
 
 // @tag.name        tickets
 // @tag.description Ticket viewing endpoints - for accessing stored reports
@@ -60,28 +54,49 @@ var (
 // @tag.name        health
 // @tag.description Health check and monitoring endpoints
 
+// @tag.name        admin
+// @tag.description Privileged operations, authenticated with the admin API token
+
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
+// @description API key or OIDC access token as "Bearer <token>", or the admin token. API keys may also be sent in the X-API-Key header.
 
 // @x-extension-openapi {"example": "value on a json format"}
 
 func main() {
 	// Initialize configuration
-	cfg, err := config.Load()
+	cli, err := parseFlags(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
+	cfg, err := config.Load(cli.config)
 	if err != nil {
 		fmt.Println("Failed to load configuration:", err)
 		os.Exit(1)
 	}
 
-	// Initialize logger
-	log, err := logger.NewLogger(cfg.LogLevel, cfg.Environment)
+	// Initialize logger; the level can be changed by reloading the configuration
+	logLevel := zap.NewAtomicLevelAt(logger.ParseLevel(cfg.LogLevel))
+	log, err := logger.NewLoggerWithLevel(logLevel, cfg.Environment)
 	if err != nil {
 		fmt.Println("Failed to initialize logger:", err)
 		os.Exit(1)
 	}
 	defer log.Sync()
 
+	// Sensitive data is redacted from log lines, tickets and upload metadata
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		log.Fatal("Invalid redaction configuration", zap.Error(err))
+	}
+	log = log.WithOptions(zap.WrapCore(redactor.WrapCore))
+
+	// Maintenance commands run instead of the server
+	if runCommand(cfg, log, cli.args) {
+		return
+	}
+
 	// Set Gin mode based on environment
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -89,27 +104,99 @@ func main() {
 
 	// Create router
 	r := gin.New()
+	r.MaxMultipartMemory = cfg.MaxMultipartMemory
+
+	// Client IPs are only taken from the headers of trusted proxies, so
+	// clients cannot pick their own IP to dodge rate limits; without
+	// TRUSTED_PROXIES no proxy is trusted and the peer address is used
+	r.RemoteIPHeaders = cfg.ClientIPHeaders
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES", zap.Error(err))
+	}
 
-	// Middleware
+	// Middleware; the request ID comes first so every response carries it
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Metrics())
+	// The access log wraps recovery so requests that panicked are logged
+	if cfg.AccessLog {
+		accessLog := log.Named("access")
+		if cfg.AccessLogSink != logger.SinkStdout {
+			sinkLog, closeSink, err := logger.NewSinkLogger(cfg.AccessLogSink, cfg.AccessLogTarget)
+			if err != nil {
+				log.Fatal("Invalid access log sink", zap.String("sink", cfg.AccessLogSink), zap.Error(err))
+			}
+			defer closeSink()
+			accessLog = sinkLog.WithOptions(zap.WrapCore(redactor.WrapCore)).Named("access")
+		}
+		r.Use(middleware.AccessLog(accessLog, redactor, middleware.AccessLogOptions{
+			SampleRate:   cfg.AccessLogSampleRate,
+			RequestBody:  cfg.AccessLogRequestBody,
+			ResponseBody: cfg.AccessLogResponseBody,
+			BodyLimit:    cfg.AccessLogBodyLimit,
+		}))
+	}
+	if cfg.SlowRequestThreshold > 0 {
+		r.Use(middleware.SlowRequests(cfg.SlowRequestThreshold, log.Named("slow")))
+	}
 	r.Use(gin.Recovery())
-	r.Use(gin.Logger())
+	// Panics and 5xx responses are reported to Sentry when a DSN is set
+	var errorReporter *services.ErrorReporter
+	if cfg.SentryDSN != "" {
+		errorReporter, err = services.NewErrorReporter(cfg.SentryDSN, cfg.Environment, cfg.SentryRelease, redactor, log)
+		if err != nil {
+			log.Fatal("Invalid SENTRY_DSN", zap.Error(err))
+		}
+		r.Use(middleware.ReportErrors(errorReporter))
+	}
+	if cfg.SecurityHeaders {
+		r.Use(middleware.SecurityHeaders(cfg.HSTSMaxAge))
+	}
+
+	// Browsers may only call the API from the configured origins
+	r.Use(middleware.CORS(r, middleware.CORSOptions{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAge:           cfg.CORSMaxAge,
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Content-Range", "Prefer", "X-API-Key", "X-Request-ID", "X-Captcha-Token", "X-CSRF-Token", "X-Proof-Of-Work", "X-Sentry-Auth", services.ClientScreenHeader, services.ClientViewportHeader, services.ClientLocaleHeader, services.ClientTimezoneHeader},
+		ExposedHeaders:   []string{"Deprecation", "Link", "Sunset", "Location", "Upload-Offset", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-Proof-Of-Work-Difficulty", "X-Request-ID"},
+	}))
 
-	// CORS middleware
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
+	// Shed low priority requests first once the server is saturated
+	if cfg.LoadShedMaxInFlight > 0 {
+		r.Use(middleware.LoadShed(middleware.LoadShedOptions{
+			MaxInFlight: cfg.LoadShedMaxInFlight,
+			LowShare:    cfg.LoadShedLowShare,
+			NormalShare: cfg.LoadShedNormalShare,
+			Priorities:  routePriorities,
+			Prefixes:    []string{apiVersionPrefix},
+		}))
+	}
+
+	// Cap request bodies; file-carrying routes raise the limit
+	r.Use(middleware.BodyLimit(cfg.MaxBodySize))
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	// Check requests against the documented API contract
+	if cfg.OpenAPIValidation != middleware.OpenAPIValidationOff {
+		specValidator, err := middleware.OpenAPIValidator(docs.OpenAPI3, []string{apiVersionPrefix, "/"}, cfg.OpenAPIValidation, log)
+		if err != nil {
+			log.Fatal("Failed to initialize OpenAPI validation", zap.Error(err))
 		}
+		r.Use(specValidator)
+	}
 
-		c.Next()
-	})
+	if cfg.ResponseCompression {
+		r.Use(middleware.Compress(cfg.ResponseCompressionMinSize))
+	}
 
-	// Initialize validator
+	// Initialize validator; validation errors name fields as clients send them
 	validate := validator.New()
+	handlers.RegisterJSONFieldNames(validate)
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		handlers.RegisterJSONFieldNames(engine)
+	}
+
+	// Dependencies that are configured but failed to initialize, by name
+	initErrors := map[string]error{}
 
 	// Initialize MongoDB service if configured
 	var mongoService *services.MongoDBService
@@ -119,89 +206,727 @@ func main() {
 			zap.String("database", cfg.MongoDB),
 			zap.String("collection", cfg.MongoCollection))
 
-		mongoService, err = services.NewMongoDBService(
+		// Only an invalid URI disables MongoDB; when the server cannot be
+		// reached, the API starts anyway and it is set up in the background
+		mongoService, err = services.ConnectMongoDB(
 			cfg.MongoURI,
 			cfg.MongoDB,
 			cfg.MongoCollection,
+			cfg.MongoTimeout,
 		)
 		if err != nil {
+			initErrors["mongodb"] = err
 			log.Warn("Failed to initialize MongoDB service, database persistence will be disabled", zap.Error(err))
 		} else {
-			log.Info("MongoDB service initialized successfully")
-
-			// Test connection
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			defer cancel()
-			tickets, err := mongoService.GetAllTickets(ctx)
-			if err != nil {
-				log.Warn("Failed to retrieve tickets from MongoDB", zap.Error(err))
+			if err := mongoService.Prepare(ctx); err != nil {
+				log.Warn("MongoDB is unreachable, retrying in the background", zap.Error(err))
 			} else {
-				log.Info("Successfully connected to MongoDB", zap.Int("ticket_count", len(tickets)))
+				log.Info("MongoDB service initialized successfully")
 			}
 		}
 	} else {
 		log.Warn("MongoDB configuration not provided, database persistence will be disabled")
 	}
 
-	// Initialize Jira service
-	jiraService, err := services.NewJiraService(
-		cfg.JiraURL,
-		cfg.JiraUsername,
-		cfg.JiraAPIToken,
-		cfg.JiraProjectKey,
-		cfg.SupportTeamMembers,
-		cfg.DefaultPriority,
-		mongoService,
-	)
+	// Tickets are assigned to support team members on shift
+	roster, err := newRoster(cfg, log)
 	if err != nil {
-		log.Fatal("Failed to initialize Jira service", zap.Error(err))
+		log.Fatal("Invalid support roster", zap.Error(err))
 	}
 
-	// Initialize S3 service if configured
-	var s3Service *services.S3Service
-	if cfg.AWSS3AccessKey != "" && cfg.AWSS3SecretKey != "" {
-		s3Service, err = services.NewS3Service(
-			cfg.AWSS3AccessKey,
-			cfg.AWSS3SecretKey,
-			cfg.AWSS3Region,
-			cfg.AWSS3BucketName,
-			cfg.AWSS3BaseURL,
+	// Initialize Jira service; without one, reports are collected in MongoDB
+	// and can be exported to a tracker configured later
+	var jiraService *services.JiraService
+	var collector *services.CollectorTracker
+	var mockTracker *services.MockTracker
+	if mongoService != nil && (cfg.JiraURL == "" && cfg.Tracker != services.TrackerMock || cfg.CollectorExportInterval > 0) {
+		collector = services.NewCollectorTracker(cfg.CollectorProjectKey, roster, mongoService)
+	}
+	var defaultTracker services.IssueTracker
+	if cfg.Embedded {
+		embeddedTracker, err := services.NewEmbeddedTracker(cfg.CollectorProjectKey, cfg.DataDir, roster)
+		if err != nil {
+			log.Fatal("Failed to initialize embedded tracker", zap.Error(err))
+		}
+		defaultTracker = embeddedTracker
+		log.Warn("Running self-contained, tickets and uploads are kept on disk",
+			zap.String("data_dir", cfg.DataDir),
+			zap.String("project_key", cfg.CollectorProjectKey))
+	} else if cfg.Tracker == services.TrackerMock {
+		if mongoService == nil {
+			log.Fatal("TRACKER=mock needs MongoDB, where its tickets are kept")
+		}
+		mockTracker = services.NewMockTracker(cfg.MockProjectKey, roster, mongoService)
+		defaultTracker = mockTracker
+		log.Warn("TRACKER=mock, reports are filed in a mock tracker instead of Jira",
+			zap.String("project_key", cfg.MockProjectKey))
+	} else if cfg.JiraURL != "" {
+		jiraService, err = services.NewJiraService(
+			cfg.JiraURL,
+			cfg.JiraUsername,
+			cfg.JiraAPIToken,
+			cfg.JiraProjectKey,
+			roster,
+			cfg.DefaultPriority,
+			mongoService,
 		)
 		if err != nil {
-			log.Warn("Failed to initialize S3 service, file uploads will be disabled", zap.Error(err))
-		} else {
-			log.Info("S3 service initialized successfully",
-				zap.String("region", cfg.AWSS3Region),
-				zap.String("bucket", cfg.AWSS3BucketName),
-			)
+			log.Fatal("Failed to initialize Jira service", zap.Error(err))
 		}
+		if cfg.JiraServiceDeskID != "" {
+			jiraService.SetServiceDesk(&services.ServiceDesk{
+				ID:            cfg.JiraServiceDeskID,
+				RequestTypeID: cfg.JiraRequestTypeID,
+				Participants:  cfg.JiraRequestParticipants,
+			})
+		}
+		jiraService.SetJSONAttachments(cfg.JiraJSONAttachments)
+		defaultTracker = jiraService
+	} else if collector == nil {
+		log.Fatal("JIRA_URL is not set and MongoDB is not configured, reports cannot be collected")
 	} else {
-		log.Warn("S3 configuration not provided, file uploads will be disabled")
+		defaultTracker = collector
+		log.Warn("JIRA_URL not set, reports are collected in MongoDB without an issue tracker",
+			zap.String("project_key", cfg.CollectorProjectKey))
+	}
+
+	// Additional Jira instances and trackers of other kinds get the products
+	// routed to them
+	jiraInstances, err := newIssueTrackers(cfg, defaultTracker, collector, roster, mongoService)
+	if err != nil {
+		log.Fatal("Failed to initialize issue trackers", zap.Error(err))
+	}
+	jiraRoutes, err := services.ParseJiraRouting(cfg.JiraProductRouting)
+	if err != nil {
+		log.Fatal("Invalid JIRA_PRODUCT_ROUTING", zap.Error(err))
+	}
+	jiraRegistry, err := services.NewJiraRegistry(jiraInstances, jiraRoutes, roster, mongoService)
+	if err != nil {
+		log.Fatal("Invalid Jira configuration", zap.Error(err))
+	}
+	jiraRegistry.SetRedactor(redactor)
+	jiraRegistry.SetLogger(log)
+	trackerPool := services.NewWorkerPool(services.WorkerPoolTracker, cfg.TrackerPoolSize, cfg.TrackerPoolQueue, cfg.WorkerPoolMaxWait)
+	jiraRegistry.SetWorkerPool(trackerPool)
+	jiraRegistry.SetTimeout(cfg.TrackerTimeout)
+
+	// Tenants have their own Jira projects, buckets and chats
+	tenants := newTenants(cfg, mongoService, roster, redactor, trackerPool, log)
+	if tenants != nil {
+		jiraRegistry.SetTenants(tenants)
+	}
+	// Products registered through the admin API bring their own routing
+	var products *services.Products
+	if mongoService != nil {
+		products = services.NewProducts(mongoService, jiraRegistry, roster, log)
+		jiraRegistry.SetProducts(products)
+	}
+	if runbooks := newRunbooks(cfg, mongoService, log); runbooks != nil {
+		jiraRegistry.SetRunbooks(runbooks)
+	}
+	if deploys := newDeploys(cfg, log); deploys != nil {
+		jiraRegistry.SetDeploys(deploys)
+	}
+	if cfg.StatuspageAPIKey != "" {
+		components, err := services.ParseJiraRouting(cfg.StatuspageComponents)
+		if err != nil {
+			log.Fatal("Invalid STATUSPAGE_COMPONENTS", zap.Error(err))
+		}
+		statuspage := services.NewStatuspageClient(cfg.StatuspageAPIKey, cfg.StatuspagePageID)
+		jiraRegistry.SetIncidents(services.NewIncidentSuggester(statuspage, components, cfg.StatuspageReportThreshold, cfg.StatuspageReportWindow, log))
+		log.Info("Statuspage incident suggestions enabled", zap.Int("threshold", cfg.StatuspageReportThreshold), zap.Duration("window", cfg.StatuspageReportWindow))
+	}
+	var coalescer *services.ReportCoalescer
+	if cfg.HighVolumeMode {
+		coalescer = services.NewReportCoalescer(jiraRegistry, mongoService, cfg.ReportCoalesceWindow, cfg.ReportFlushInterval, log)
+		jiraRegistry.SetCoalescer(coalescer)
+		log.Info("High-volume mode enabled", zap.Duration("window", cfg.ReportCoalesceWindow), zap.Duration("flush_interval", cfg.ReportFlushInterval))
+	}
+	if cfg.FloodControlThreshold > 0 {
+		jiraRegistry.SetFloodControl(services.NewFloodControl(jiraRegistry, mongoService, cfg.FloodControlThreshold, log))
+		log.Info("Flood control enabled", zap.Int("threshold", cfg.FloodControlThreshold))
+	}
+	var summarizer *services.Summarizer
+	if cfg.SummaryProvider != services.SummaryProviderNone {
+		summarizer, err = services.NewSummarizer(cfg.SummaryProvider, cfg.SummaryURL, cfg.SummaryAPIKey, cfg.SummaryModel,
+			cfg.SummaryAzureAPIVersion, cfg.SummaryMaxInputTokens, cfg.SummaryTimeout, redactor, log)
+		if err != nil {
+			log.Fatal("Failed to create report summarizer", zap.Error(err))
+		}
+		jiraRegistry.SetSummarizer(summarizer)
+		log.Info("Report summaries enabled", zap.String("provider", cfg.SummaryProvider), zap.String("model", cfg.SummaryModel))
+	}
+	if cfg.TicketTitleTemplate != "" {
+		titles, err := services.ParseTitleTemplate(cfg.TicketTitleTemplate)
+		if err != nil {
+			log.Fatal("Invalid TICKET_TITLE_TEMPLATE", zap.Error(err))
+		}
+		jiraRegistry.SetTitleTemplate(titles)
+	}
+	if cfg.ClassifierEnabled {
+		classifier, err := newClassifier(cfg, summarizer, redactor, log)
+		if err != nil {
+			log.Fatal("Failed to create report classifier", zap.Error(err))
+		}
+		categories, err := services.ParseJiraRouting(cfg.ClassifierRouting)
+		if err != nil {
+			log.Fatal("Invalid CLASSIFIER_ROUTING", zap.Error(err))
+		}
+		if err := jiraRegistry.SetClassifier(classifier, categories); err != nil {
+			log.Fatal("Invalid CLASSIFIER_ROUTING", zap.Error(err))
+		}
+		if products != nil {
+			classifier.SetProducts(products)
+		}
+		log.Info("Report classification enabled", zap.Int("rules", len(cfg.ClassifierRules)), zap.String("model", cfg.ClassifierModel))
+	}
+	if cfg.SimilarTicketsEnabled && mongoService != nil {
+		jiraRegistry.SetSimilarTickets(services.NewSimilarTickets(mongoService, cfg.SimilarTicketsWindow, cfg.SimilarTicketsThreshold, cfg.SimilarTicketsLimit, redactor, log))
+		log.Info("Similar ticket suggestions enabled", zap.Duration("window", cfg.SimilarTicketsWindow), zap.Float64("threshold", cfg.SimilarTicketsThreshold))
+	} else if cfg.SimilarTicketsEnabled {
+		log.Warn("MongoDB is not configured, similar ticket suggestions are disabled")
+	}
+
+	// Initialize object storage for file uploads
+	backend, err := newObjectStorage(cfg, log)
+	if err != nil {
+		initErrors["storage"] = err
+		log.Warn("Failed to initialize object storage, file uploads will be disabled",
+			zap.String("backend", cfg.StorageBackend),
+			zap.Error(err),
+		)
+	}
+
+	// Requests to the backend, or to the bucket of the tenant they are made
+	// for, are bounded by a worker pool and a timeout
+	storage := services.PoolStorage(services.TenantStorage(backend, tenants), services.NewWorkerPool(services.WorkerPoolStorage, cfg.StoragePoolSize, cfg.StoragePoolQueue, cfg.WorkerPoolMaxWait))
+	storage = services.TimeoutStorage(storage, cfg.StorageTimeout)
+
+	// Object keys are rendered from the configured prefix template
+	keyTemplate, err := services.NewKeyTemplate(cfg.StorageKeyPrefixTemplate)
+	if err != nil {
+		log.Fatal("Invalid storage key prefix template", zap.Error(err))
+	}
+
+	// Initialize malware scanning of uploads
+	uploadScanner, err := newUploadScanner(cfg, log)
+	if err != nil {
+		log.Fatal("Failed to initialize malware scanner", zap.Error(err))
+	}
+
+	// Suspicious uploads are kept under a quarantine prefix until reviewed
+	var quarantineService *services.QuarantineService
+	if storage != nil {
+		quarantineService, err = services.NewQuarantineService(storage, jiraRegistry, mongoService, cfg.QuarantineKeyPrefix, log)
+		if err != nil {
+			log.Fatal("Failed to initialize quarantine", zap.Error(err))
+		}
+	}
+
+	// Resumable uploads are staged on local disk until completed
+	var uploadSessions *services.UploadSessionStore
+	if cfg.UploadSessionDir != "" {
+		uploadSessions, err = services.NewUploadSessionStore(cfg.UploadSessionDir, cfg.UploadSessionTTL)
+		if err != nil {
+			log.Warn("Failed to initialize upload sessions, resumable uploads will be disabled", zap.Error(err))
+		}
+	}
+
+	// Reports submitted asynchronously are processed by background workers
+	var reportQueue *services.ReportQueue
+	if cfg.ReportQueueSize > 0 {
+		reportQueue = services.NewReportQueue(cfg.ReportQueueWorkers, cfg.ReportQueueSize, cfg.ReportStatusTTL, cfg.ReportCheckpointDir, log)
+		broker, err := newReportBroker(cfg)
+		if err != nil {
+			log.Fatal("Failed to initialize the report broker", zap.Error(err))
+		}
+		if broker != nil {
+			reportQueue.UseBroker(broker, cfg.ReportMaxAttempts, cfg.ReportRetryBackoff, mongoService)
+			log.Info("Asynchronous reports go through a broker", zap.String("broker", broker.Name()),
+				zap.Int("max_attempts", cfg.ReportMaxAttempts), zap.Bool("shared_status", mongoService != nil))
+		}
+		// Reports that failed for good are kept to be retried through the
+		// admin API
+		if mongoService != nil {
+			reportQueue.StoreFailures(mongoService, redactor)
+		}
+	}
+
+	// Screenshot URL re-signing and ticket retention need both object storage
+	// and MongoDB; the admin API uses them on demand even when the scheduled
+	// jobs are disabled
+	var resigner *services.URLResigner
+	var retention *services.RetentionJob
+	if storage != nil && mongoService != nil {
+		resigner = services.NewURLResigner(storage, jiraRegistry, mongoService, log, cfg.URLResignInterval, cfg.URLResignThreshold)
+		retention = services.NewRetentionJob(storage, mongoService, log, cfg.RetentionInterval, cfg.TicketRetentionPeriod, cfg.TicketRetentionAction, cfg.RetentionObjectAction)
+	}
+
+	// With several replicas, scheduled jobs run on the leader elected through
+	// MongoDB; without a coordinator every instance runs them
+	var coordinator *services.Coordinator
+	if cfg.LeaderElection && mongoService != nil {
+		coordinator = services.NewCoordinator(mongoService, cfg.InstanceID, cfg.LeaderLeaseTTL, log)
+		if resigner != nil {
+			resigner.SetCoordinator(coordinator)
+		}
+		if retention != nil {
+			retention.SetCoordinator(coordinator)
+		}
+	} else if cfg.LeaderElection {
+		log.Warn("MongoDB is not configured, leader election is disabled and scheduled jobs run on every instance")
 	}
 
 	// Initialize handlers
-	ticketHandler := handlers.NewTicketHandler(jiraService, log, validate)
-	reportHandler := handlers.NewReportHandler(jiraService, s3Service, log, validate)
+	ticketHandler := handlers.NewTicketHandler(jiraRegistry, storage, log, validate)
+	// Reporters get a signed link to the status of their submissions
+	var statusTokens *services.StatusTokens
+	if cfg.StatusTokenSecret != "" {
+		statusTokens = services.NewStatusTokens(cfg.StatusTokenSecret, cfg.StatusTokenTTL, cfg.StatusPageBaseURL)
+	} else {
+		log.Info("STATUS_TOKEN_SECRET not set, reporter status pages are disabled")
+	}
+
+	productForms, err := handlers.ParseProductForms(cfg.ProductRequiredFields)
+	if err != nil {
+		log.Fatal("Invalid PRODUCT_REQUIRED_FIELDS", zap.Error(err))
+	}
+
+	reportHandler := handlers.NewReportHandler(jiraRegistry, storage, keyTemplate, uploadScanner, quarantineService, uploadSessions, reportQueue, statusTokens, productForms, cfg.Environment, redactor, log, validate, cfg.VideoMaxUploadSize)
+	notifications := newNotifications(cfg, tenants, products, log)
+	if notifications != nil {
+		reportHandler.SetNotifications(notifications)
+	}
+	emails, err := newEmailNotifications(cfg, jiraRegistry, log)
+	if err != nil {
+		log.Fatal("Failed to initialize email notifications", zap.Error(err))
+	}
+	if emails != nil {
+		reportHandler.SetEmailNotifications(emails)
+	}
+	helpdesk := newHelpdeskSync(cfg, jiraRegistry, mongoService, log)
+	if helpdesk != nil {
+		reportHandler.SetHelpdesk(helpdesk)
+	}
+	webhooks := newWebhookDispatcher(cfg, mongoService, log)
+	if webhooks != nil {
+		reportHandler.SetWebhooks(webhooks)
+	}
+	kafkaEvents, err := newKafkaEvents(cfg, log)
+	if err != nil {
+		log.Fatal("Failed to initialize Kafka events", zap.Error(err))
+	}
+	if kafkaEvents != nil {
+		reportHandler.SetKafkaEvents(kafkaEvents)
+	}
+	// Report submission can be turned away or queued during Jira maintenance
+	maintenance := services.NewMaintenance(mongoService, reportQueue, log)
+	reportHandler.SetMaintenance(maintenance)
+	uploadHandler := handlers.NewUploadHandler(storage, mongoService, keyTemplate, uploadSessions, cfg.Environment, redactor, log, validate, cfg.PresignUploadExpiry, cfg.UploadAllowedContentTypes, cfg.VideoMaxUploadSize)
+
+	healthHandler := handlers.NewHealthHandler(jiraRegistry, mongoService, storage, cfg.ReadinessTimeout, log)
+
+	// Probe every dependency once, so misconfigurations show up at startup;
+	// with --check the process only reports them
+	reachable := reportDependencies(context.Background(), healthHandler, initErrors, log)
+	if cli.check {
+		log.Sync()
+		if !reachable {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Mutating requests to every route below, and attachment downloads, are
+	// recorded for the admin audit endpoint
+	if cfg.AuditLog && mongoService != nil {
+		r.Use(middleware.Audit(mongoService, log))
+	}
 
 	// Routes
-	r.GET("/health", handlers.HealthCheckGin)
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	r.POST("/report-issue", reportHandler.ReportIssue)
+	r.GET("/livez", healthHandler.Livez)
+	r.HEAD("/livez", healthHandler.Livez)
+	r.GET("/readyz", healthHandler.Readyz)
+	r.HEAD("/readyz", healthHandler.Readyz)
+	// Kept for existing monitors; same as /readyz
+	r.GET("/health", healthHandler.Readyz)
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", docs.OpenAPI3)
+	})
+	r.GET("/swagger/*any", middleware.ContentSecurityPolicy(middleware.SwaggerUIContentSecurityPolicy), ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/openapi.json")))
+
+	// The report widget files reports through /report-issue, so it is
+	// subject to the same verification
+	if cfg.Widget {
+		widgetOpts := handlers.WidgetOptions{FrameAncestors: cfg.CORSAllowedOrigins}
+		switch cfg.ReportVerification {
+		case services.VerificationNone:
+		case services.VerificationPoW:
+			widgetOpts.PowDifficulty = cfg.PowDifficulty
+		default:
+			log.Warn("The report widget cannot solve CAPTCHAs, embed it with an API key of the report scope")
+		}
+		widget, err := handlers.NewWidgetHandler(widgetOpts)
+		if err != nil {
+			log.Fatal("Failed to load the report widget", zap.Error(err))
+		}
+		r.GET("/widget.js", widget.File("widget.js"))
+		r.GET("/widget/report", widget.ReportForm)
+		r.GET("/widget/report.js", widget.File("report.js"))
+		r.GET("/widget/report.css", widget.File("report.css"))
+	}
+
+	// Sentry SDKs post to /api/{projectId}/envelope/ on the DSN host
+	if cfg.SentryIntakeKey != "" {
+		sentryHandler := handlers.NewSentryHandler(jiraRegistry, reportQueue, cfg.SentryIntakeKey, log)
+		r.POST("/api/:projectId/envelope/", sentryHandler.IngestEnvelope)
+		r.POST("/api/:projectId/store/", sentryHandler.IngestStore)
+	} else {
+		log.Info("SENTRY_INTAKE_KEY not set, Sentry intake is disabled")
+	}
+
+	// Uploads on disk are only served as is, bypassing the checks of the
+	// attachment download, when asked for during development
+	if localStorage, ok := backend.(*services.LocalStorageService); ok && cfg.LocalStorageServe {
+		if cfg.Environment == "production" {
+			log.Fatal("LOCAL_STORAGE_SERVE is for development and cannot be used in production")
+		}
+		log.Warn("Serving local storage without authentication", zap.String("path", "/local-storage"), zap.String("dir", localStorage.Dir()))
+		r.Static("/local-storage", localStorage.Dir())
+	}
+
+	// API keys are configured hashed in API_KEYS or created through the
+	// admin API
+	configuredKeys := make([]services.APIKey, 0, len(cfg.APIKeys))
+	for name, key := range cfg.APIKeys {
+		configuredKeys = append(configuredKeys, services.APIKey{Name: name, Hash: key.Hash, Scopes: key.Scopes, Products: key.Products})
+	}
+	apiKeys, err := services.NewAPIKeyStore(configuredKeys, mongoService)
+	if err != nil {
+		log.Fatal("Invalid API_KEYS", zap.Error(err))
+	}
+	creds := middleware.Credentials{AdminToken: cfg.AdminAPIToken, APIKeys: apiKeys}
+
+	// Bearer tokens of the SSO identity provider protect the ticket and
+	// admin endpoints
+	if cfg.OIDCIssuerURL != "" {
+		creds.OIDC, err = services.NewOIDCVerifier(cfg.OIDCIssuerURL, cfg.OIDCAudience, cfg.OIDCJWKSURL, cfg.OIDCRolesClaim, cfg.OIDCProductsClaim, cfg.OIDCRoleScopes)
+		if err != nil {
+			log.Fatal("Invalid OIDC_ROLE_SCOPES", zap.Error(err))
+		}
+		log.Info("OIDC authentication enabled", zap.String("issuer", cfg.OIDCIssuerURL))
+	}
+
+	// Report intake is rate limited per client
+	var rateLimit gin.HandlerFunc
+	var limiter services.RateLimiter
+	if cfg.RateLimitRequests > 0 {
+		limiter, err = newRateLimiter(cfg, log)
+		if err != nil {
+			log.Fatal("Failed to initialize rate limiting", zap.Error(err))
+		}
+		allowlist, err := middleware.ParseRateLimitAllowlist(cfg.RateLimitAllowlist)
+		if err != nil {
+			log.Fatal("Invalid RATE_LIMIT_ALLOWLIST", zap.Error(err))
+		}
+		rateLimit = middleware.RateLimit(limiter, allowlist, len(cfg.TrustedProxies) > 0, log)
+	}
+
+	// Public report intake can require proof that a person submits reports
+	var verifyHuman gin.HandlerFunc
+	switch cfg.ReportVerification {
+	case services.VerificationNone:
+	case services.VerificationPoW:
+		verifyHuman = middleware.VerifyHuman(services.NewProofOfWork(cfg.PowDifficulty), log)
+		log.Info("Reports require a proof of work", zap.Int("difficulty", cfg.PowDifficulty))
+	default:
+		captcha, err := services.NewCaptchaVerifier(cfg.ReportVerification, cfg.CaptchaSecret, cfg.CaptchaMinScore)
+		if err != nil {
+			log.Fatal("Failed to initialize CAPTCHA verification", zap.Error(err))
+		}
+		verifyHuman = middleware.VerifyHuman(captcha, log)
+		log.Info("Reports require a CAPTCHA", zap.String("provider", cfg.ReportVerification))
+	}
+
+	routes := &apiRoutes{
+		report:    reportHandler,
+		upload:    uploadHandler,
+		ticket:    ticketHandler,
+		analytics: handlers.NewAnalyticsHandler(mongoService, log),
+		issues:    handlers.NewIssueHandler(mongoService, log),
+
+		creds:          creds,
+		requireAPIKeys: cfg.APIKeyAuth,
+		log:            log,
+		rateLimit:      rateLimit,
+		verifyHuman:    verifyHuman,
+
+		pprof:           cfg.AdminPprof,
+		ticketToken:     cfg.TicketAPIToken,
+		uploadBodyLimit: cfg.MaxUploadBodySize,
+	}
+	if cfg.ClientInfo {
+		routes.clientInfo = middleware.ClientInfo()
+	}
+	routes.adminIPs = ipFilter("ADMIN", cfg.AdminIPAllowlist, cfg.AdminIPDenylist, cfg.TrustedProxies, log)
+	routes.ticketIPs = ipFilter("TICKETS", cfg.TicketsIPAllowlist, cfg.TicketsIPDenylist, cfg.TrustedProxies, log)
+	if statusTokens != nil {
+		routes.myReports = handlers.NewMyReportsHandler(mongoService, statusTokens, log)
+		routes.myReports.SetTenants(tenants)
+	}
+	if cfg.TicketAPIToken == "" {
+		log.Info("TICKET_API_TOKEN not set, /create-ticket is disabled")
+	}
+	if cfg.JiraWebhookSecret != "" {
+		routes.webhooks = handlers.NewWebhookHandler(mongoService, log)
+		routes.webhooks.SetTenants(tenants)
+		if helpdesk != nil {
+			routes.webhooks.OnTicketStateChange(helpdesk.TicketStateChanged)
+		}
+		if webhooks != nil {
+			routes.webhooks.OnTicketStateChange(webhooks.TicketStateChanged)
+		}
+		if kafkaEvents != nil {
+			routes.webhooks.OnTicketStateChange(kafkaEvents.TicketStateChanged)
+		}
+		routes.verifyWebhook = middleware.VerifyWebhook(services.NewWebhookVerifier(cfg.JiraWebhookSecret, cfg.WebhookTolerance), log)
+	} else {
+		log.Info("JIRA_WEBHOOK_SECRET not set, the Jira webhook receiver is disabled")
+	}
+	if helpdesk != nil && mongoService != nil {
+		routes.helpdesk = handlers.NewHelpdeskHandler(helpdesk, log, validate)
+	} else if helpdesk != nil {
+		log.Warn("MongoDB is not configured, helpdesk tickets are opened but not synced")
+	}
+	if cfg.AlertmanagerToken != "" && mongoService != nil {
+		routes.alertmanager = handlers.NewAlertmanagerHandler(services.NewAlertIntake(jiraRegistry, mongoService, log), log, validate)
+		routes.alertmanagerToken = cfg.AlertmanagerToken
+	} else if cfg.AlertmanagerToken != "" {
+		log.Warn("MongoDB is not configured, Alertmanager intake is disabled as alerts cannot be deduplicated")
+	}
+
+	// Admin routes are only exposed when an admin token, keys or OIDC are
+	// configured; keys created through them need one of those to start with
+	if cfg.AdminAPIToken != "" || len(cfg.APIKeys) > 0 || creds.OIDC != nil {
+		routes.admin = handlers.NewAdminHandler(jiraRegistry, mongoService, quarantineService, resigner, retention, reportQueue, apiKeys, log, validate)
+		routes.admin.SetCoordinator(coordinator)
+		routes.admin.SetMaintenance(maintenance)
+		routes.admin.SetMockTracker(mockTracker)
+		routes.admin.SetTenants(tenants)
+		routes.admin.SetProducts(products)
+		if helpdesk != nil {
+			routes.admin.OnTicketStateChange(helpdesk.TicketStateChanged)
+		}
+		if webhooks != nil {
+			routes.admin.OnTicketStateChange(webhooks.TicketStateChanged)
+			routes.admin.SetWebhooks(webhooks)
+		}
+		if kafkaEvents != nil {
+			routes.admin.OnTicketStateChange(kafkaEvents.TicketStateChanged)
+		}
+	} else {
+		log.Info("ADMIN_API_TOKEN, API_KEYS and OIDC_ISSUER_URL not set, admin endpoints are disabled")
+	}
+	if cfg.APIKeyAuth {
+		log.Info("API keys are required for report and ticket endpoints")
+	}
+
+	// The API is versioned under /api/v1; the unversioned paths remain as
+	// deprecated aliases for existing integrations
+	var legacySunset time.Time
+	if cfg.LegacyRoutesSunset != "" {
+		legacySunset, _ = time.Parse(time.DateOnly, cfg.LegacyRoutesSunset)
+	}
+	routes.registerVersioned(r.Group(apiVersionPrefix))
+	routes.register(r.Group("", middleware.Deprecated(apiVersionPrefix, legacySunset)))
+
+	// The dashboard signs in through the admin API, so it is only served
+	// with it
+	if routes.admin != nil && cfg.Dashboard {
+		dashboard := handlers.NewDashboardHandler()
+		ui := r.Group("/ui", restrict(routes.adminIPs, middleware.ContentSecurityPolicy(middleware.DashboardContentSecurityPolicy))...)
+		ui.GET("", dashboard.Redirect)
+		ui.GET("/*file", dashboard.ServeFile)
+	}
+
+	// Background jobs are stopped when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Remove abandoned upload sessions
+	if uploadSessions != nil {
+		uploadSessions.StartCleanup(jobsCtx, time.Hour, log)
+	}
+
+	// Rotate credentials as they change in the secrets manager
+	refreshSecrets(jobsCtx, cfg, log, jiraService, backend)
+
+	// Apply changes to reloadable settings on SIGHUP
+	reloads := &reloader{opts: cli.config, level: logLevel, jira: jiraRegistry, products: products, reports: reportHandler, limiter: limiter, log: log, started: cfg, current: cfg}
+	reloads.reloadOnHangup(jobsCtx)
+
+	// Background work is drained on shutdown; unfinished reports are saved
+	// and resumed on the next start
+	lifecycle := services.NewLifecycle(log)
+
+	// Set up MongoDB once it is reachable if it was not at startup
+	if mongoService != nil && !mongoService.Prepared() {
+		lifecycle.Go("mongodb-init", services.RetryInit("mongodb", mongoService.Prepare, log))
+	}
+
+	// Tickets stored before tickets were fingerprinted are grouped into
+	// issues once they are
+	if mongoService != nil {
+		lifecycle.Go("ticket-fingerprints", services.RetryInit("ticket fingerprints", mongoService.FingerprintTickets, log))
+	}
+
+	// Campaign before the scheduled jobs start, so that the leader runs
+	// them right away
+	if coordinator != nil {
+		coordinator.Campaign(jobsCtx)
+		lifecycle.Go("leader-election", coordinator.Run)
+		log.Info("Leader election enabled",
+			zap.String("instance", coordinator.InstanceID()),
+			zap.Duration("lease_ttl", cfg.LeaderLeaseTTL),
+		)
+	}
+
+	// Announce new tickets in chat in the background
+	if notifications != nil {
+		lifecycle.Go("notifications", notifications.Run)
+	}
+
+	// Email reporters and assignees in the background
+	if emails != nil {
+		lifecycle.Go("emails", emails.Run)
+	}
+
+	// Open and update helpdesk tickets in the background
+	if helpdesk != nil {
+		lifecycle.Go("helpdesk", helpdesk.Run)
+	}
+
+	// Deliver outbound webhooks in the background
+	if webhooks != nil {
+		lifecycle.Go("webhooks", webhooks.Run)
+	}
+
+	// Publish ticket events to Kafka in the background
+	if kafkaEvents != nil {
+		lifecycle.Go("kafka", kafkaEvents.Run)
+	}
+
+	// Send errors to Sentry in the background
+	if errorReporter != nil {
+		lifecycle.Go("error-reporter", errorReporter.Run)
+	}
+
+	// Reports that failed while a dependency was down are retried once it
+	// passes a health check again
+	if reportQueue != nil {
+		healthHandler.OnRecovery(func(dependency string) {
+			retried, err := reportQueue.RetryFailed()
+			if err != nil {
+				log.Warn("Failed to retry failed reports", zap.String("dependency", dependency), zap.Int("retried", retried), zap.Error(err))
+			} else if retried > 0 {
+				log.Info("Retrying failed reports", zap.String("dependency", dependency), zap.Int("retried", retried))
+			}
+		})
+	}
+
+	// Keep the dependency health metrics current
+	if cfg.HealthCheckInterval > 0 {
+		lifecycle.Go("health-monitor", healthHandler.Monitor(cfg.HealthCheckInterval))
+	}
+
+	// Follow the maintenance mode set on any instance, pausing the report
+	// queue in queue mode
+	lifecycle.Go("maintenance", maintenance.Run)
+
+	// Follow the tenants changed on any instance
+	if tenants != nil {
+		lifecycle.Go("tenants", tenants.Run)
+	}
+
+	// Follow the products registered on any instance
+	if products != nil {
+		lifecycle.Go("products", products.Run)
+	}
+
+	// Process asynchronously submitted reports
+	if reportQueue != nil {
+		if err := reportQueue.Resume(); err != nil {
+			log.Error("Failed to resume saved reports", zap.Error(err))
+		}
+		lifecycle.Go("report-queue", reportQueue.Run)
+		lifecycle.OnCheckpoint("report-queue", reportQueue.Checkpoint)
+	}
+
+	// Store and comment coalesced reports in bulk, and flush what is left
+	// once reports are no longer processed
+	if coalescer != nil {
+		lifecycle.Go("report-coalescer", coalescer.Run)
+		lifecycle.OnCheckpoint("report-coalescer", coalescer.Flush)
+	}
+
+	// Re-sign screenshot URLs for open tickets before they expire
+	if resigner != nil && cfg.URLResignInterval > 0 {
+		lifecycle.Go("url-resigner", resigner.Run)
+		log.Info("Screenshot URL re-signing enabled",
+			zap.Duration("interval", cfg.URLResignInterval),
+			zap.Duration("threshold", cfg.URLResignThreshold),
+		)
+	}
+
+	// Expire tickets and their stored objects past the retention period
+	if retention != nil && cfg.TicketRetentionPeriod > 0 && cfg.RetentionInterval > 0 {
+		lifecycle.Go("retention", retention.Run)
+		log.Info("Ticket retention enabled",
+			zap.Duration("period", cfg.TicketRetentionPeriod),
+			zap.String("ticket_action", cfg.TicketRetentionAction),
+			zap.String("object_action", cfg.RetentionObjectAction),
+		)
+	}
+
+	// File collected tickets in the trackers their products are routed to
+	if collector != nil && cfg.CollectorExportInterval > 0 {
+		exporter := services.NewCollectorExporter(cfg.CollectorProjectKey, jiraRegistry, mongoService, log, cfg.CollectorExportInterval)
+		exporter.SetCoordinator(coordinator)
+		lifecycle.Go("collector-export", exporter.Run)
+		log.Info("Export of collected tickets enabled", zap.Duration("interval", cfg.CollectorExportInterval))
+	}
 
-	// MongoDB routes
-	r.GET("/tickets", ticketHandler.GetAllTicketsGin)
-	r.GET("/tickets/:id", ticketHandler.GetTicketByIDGin)
+	// Sync ticket states from the trackers to catch up on missed webhooks
+	if mongoService != nil && cfg.TicketSyncInterval > 0 {
+		ticketSync := services.NewTicketSyncJob(jiraRegistry, mongoService, log, cfg.TicketSyncInterval)
+		ticketSync.SetCoordinator(coordinator)
+		if helpdesk != nil {
+			ticketSync.OnTicketStateChange(helpdesk.TicketStateChanged)
+		}
+		if webhooks != nil {
+			ticketSync.OnTicketStateChange(webhooks.TicketStateChanged)
+		}
+		if kafkaEvents != nil {
+			ticketSync.OnTicketStateChange(kafkaEvents.TicketStateChanged)
+		}
+		lifecycle.Go("ticket-sync", ticketSync.Run)
+		log.Info("Scheduled ticket sync enabled", zap.Duration("interval", cfg.TicketSyncInterval))
+	}
 
 	// Prometheus metrics endpoint
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	metricsIPs := ipFilter("METRICS", cfg.MetricsIPAllowlist, cfg.MetricsIPDenylist, cfg.TrustedProxies, log)
+	r.GET("/metrics", restrict(metricsIPs, gin.WrapH(promhttp.Handler()))...)
 
 	// HTTP Server configuration
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      r,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       15 * time.Second,
 	}
 
 	// Start server in a goroutine
@@ -217,15 +942,19 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	// Shutdown server with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	stopJobs()
+
+	// Stop accepting requests, then drain background work, within the
+	// shutdown timeout
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Error("Server shutdown failed", zap.Error(err))
 	}
+	lifecycle.Shutdown(ctx)
 
-	if err := jiraService.Cleanup(); err != nil {
+	if err := jiraRegistry.Cleanup(); err != nil {
 		log.Error("Failed to cleanup Jira service", zap.Error(err))
 	}
 
@@ -240,3 +969,411 @@ func main() {
 
 	log.Info("Server stopped gracefully")
 }
+
+// newUploadScanner creates the malware scanner selected by SCANNER_BACKEND.
+// It returns nil when scanning is disabled.
+func newUploadScanner(cfg *config.Config, log *zap.Logger) (*services.UploadScanner, error) {
+	var scanner services.FileScanner
+	switch cfg.ScannerBackend {
+	case services.ScannerBackendClamAV:
+		clamav, err := services.NewClamAVScanner(cfg.ClamAVAddress, cfg.ScannerTimeout)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("ClamAV upload scanning enabled", zap.String("address", cfg.ClamAVAddress))
+		scanner = clamav
+
+	case services.ScannerBackendHTTP:
+		httpScanner, err := services.NewHTTPScanner(cfg.ScannerAPIURL, cfg.ScannerAPIKey, cfg.ScannerTimeout)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("External API upload scanning enabled", zap.String("url", cfg.ScannerAPIURL))
+		scanner = httpScanner
+
+	default:
+		log.Info("Upload malware scanning disabled")
+		return nil, nil
+	}
+
+	return services.NewUploadScanner(scanner, cfg.ScannerFailOpen, log), nil
+}
+
+// newRedactor creates the redactor of REDACT_HEADERS, REDACT_DETECTORS and
+// REDACTION_RULES
+func newRedactor(cfg *config.Config) (*services.Redactor, error) {
+	rules := make([]services.RedactionRule, 0, len(cfg.RedactionRules))
+	for name, rule := range cfg.RedactionRules {
+		rules = append(rules, services.RedactionRule{Name: name, Pattern: rule.Pattern, Path: rule.Path, Replacement: rule.Replacement})
+	}
+	// Rules apply in a stable order, as patterns may overlap
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return services.NewRedactor(cfg.RedactHeaders, cfg.RedactDetectors, rules)
+}
+
+// newNotifications creates the dispatcher of NOTIFICATION_ROUTES and of the
+// chats of tenants and registered products, or nil when there are neither
+// routes nor tenants and products
+func newNotifications(cfg *config.Config, tenants *services.Tenants, products *services.Products, log *zap.Logger) *services.Notifications {
+	if len(cfg.NotificationRoutes) == 0 && tenants == nil && products == nil {
+		return nil
+	}
+	routes := make([]services.NotificationRoute, 0, len(cfg.NotificationRoutes))
+	for name, route := range cfg.NotificationRoutes {
+		var notifier services.Notifier
+		switch route.Provider {
+		case services.NotifierTeams:
+			notifier = services.NewTeamsNotifier(route.WebhookURL)
+		case services.NotifierGoogleChat:
+			notifier = services.NewGoogleChatNotifier(route.WebhookURL)
+		}
+		routes = append(routes, services.NotificationRoute{Name: name, Notifier: notifier, Products: route.Products, Severities: route.Severities})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Name < routes[j].Name })
+	if len(routes) > 0 {
+		log.Info("Ticket notifications enabled", zap.Int("routes", len(routes)))
+	}
+	notifications := services.NewNotifications(routes, log)
+	notifications.SetTenants(tenants)
+	notifications.SetProducts(products)
+	return notifications
+}
+
+// newEmailNotifications creates the dispatcher of emails sent through
+// EMAIL_PROVIDER, or nil when it is none
+func newEmailNotifications(cfg *config.Config, jiraRegistry *services.JiraRegistry, log *zap.Logger) (*services.EmailNotifications, error) {
+	var mailer services.Mailer
+	switch cfg.EmailProvider {
+	case services.EmailProviderSMTP:
+		mailer = services.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.EmailFrom)
+	case services.EmailProviderSES:
+		ses, err := services.NewSESMailer(cfg.SESRegion, cfg.EmailFrom)
+		if err != nil {
+			return nil, err
+		}
+		mailer = ses
+	default:
+		return nil, nil
+	}
+	log.Info("Email notifications enabled", zap.String("provider", cfg.EmailProvider), zap.String("from", cfg.EmailFrom))
+	return services.NewEmailNotifications(mailer, cfg.EmailTemplatesDir, jiraRegistry.SupportMemberEmail, log)
+}
+
+// newHelpdeskSync creates the sync of helpdesk tickets with the provider of
+// HELPDESK_PROVIDER, or returns nil when none is configured
+func newHelpdeskSync(cfg *config.Config, jiraRegistry *services.JiraRegistry, mongoService *services.MongoDBService, log *zap.Logger) *services.HelpdeskSync {
+	var helpdesk services.Helpdesk
+	switch cfg.HelpdeskProvider {
+	case services.HelpdeskProviderZendesk:
+		helpdesk = services.NewZendeskHelpdesk(cfg.HelpdeskURL, cfg.HelpdeskEmail, cfg.HelpdeskAPIKey)
+	case services.HelpdeskProviderFreshdesk:
+		helpdesk = services.NewFreshdeskHelpdesk(cfg.HelpdeskURL, cfg.HelpdeskAPIKey)
+	default:
+		return nil
+	}
+	log.Info("Helpdesk tickets enabled", zap.String("provider", cfg.HelpdeskProvider), zap.Strings("products", cfg.HelpdeskProducts))
+	return services.NewHelpdeskSync(helpdesk, jiraRegistry, mongoService, cfg.HelpdeskProducts, log)
+}
+
+// newWebhookDispatcher creates the dispatcher of outbound webhooks to the
+// subscriptions of WEBHOOK_SUBSCRIPTIONS, or nil when there are none
+func newWebhookDispatcher(cfg *config.Config, mongoService *services.MongoDBService, log *zap.Logger) *services.WebhookDispatcher {
+	if len(cfg.WebhookSubscriptions) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.WebhookSubscriptions))
+	for name := range cfg.WebhookSubscriptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	subscriptions := make([]services.WebhookSubscription, 0, len(names))
+	for _, name := range names {
+		sub := cfg.WebhookSubscriptions[name]
+		subscriptions = append(subscriptions, services.WebhookSubscription{
+			Name:     name,
+			URL:      sub.URL,
+			Secret:   sub.Secret,
+			Events:   sub.Events,
+			Products: sub.Products,
+		})
+	}
+	if mongoService == nil {
+		log.Warn("MongoDB is not configured, failed webhook deliveries are only logged")
+	}
+	log.Info("Outbound webhooks enabled", zap.Strings("subscriptions", names))
+	return services.NewWebhookDispatcher(subscriptions, cfg.WebhookMaxAttempts, cfg.WebhookRetryBackoff, mongoService, log)
+}
+
+// newDeploys creates the lookup of the recent deploys listed in new
+// tickets, or returns nil when DEPLOYS_SOURCE is none
+func newDeploys(cfg *config.Config, log *zap.Logger) *services.Deploys {
+	var source services.DeploySource
+	switch cfg.DeploysSource {
+	case services.DeploySourceAPI:
+		source = services.NewDeployAPI(cfg.DeploysAPIURL, cfg.DeploysAPIToken)
+	case services.DeploySourceGitHub:
+		source = services.NewGitHubDeployments(cfg.DeploysGitHubAPIURL, cfg.DeploysGitHubToken, cfg.DeploysGitHubRepositories, cfg.DeploysGitHubEnvironment)
+	default:
+		return nil
+	}
+	log.Info("Recent deploys enabled", zap.String("source", cfg.DeploysSource), zap.Duration("window", cfg.DeploysWindow))
+	return services.NewDeploys(source, cfg.DeploysWindow, log)
+}
+
+// newClassifier creates the classifier of new reports from CLASSIFIER_RULES
+// in name order and CLASSIFIER_MODEL
+func newClassifier(cfg *config.Config, summarizer *services.Summarizer, redactor *services.Redactor, log *zap.Logger) (*services.Classifier, error) {
+	names := make([]string, 0, len(cfg.ClassifierRules))
+	for name := range cfg.ClassifierRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := make([]services.ClassificationRule, 0, len(names))
+	for _, name := range names {
+		rule := cfg.ClassifierRules[name]
+		rules = append(rules, services.ClassificationRule{
+			Name:     name,
+			Category: rule.Category,
+			Severity: rule.Severity,
+			Keywords: rule.Keywords,
+			Statuses: rule.Statuses,
+		})
+	}
+
+	var model services.ClassificationModel
+	switch cfg.ClassifierModel {
+	case services.ClassifierModelLLM:
+		model = summarizer
+	case services.ClassifierModelAPI:
+		model = services.NewClassifierAPI(cfg.ClassifierAPIURL, cfg.ClassifierAPIToken, redactor)
+	}
+	return services.NewClassifier(rules, model, log)
+}
+
+// newRunbooks creates the lookup of the runbooks linked in new tickets, or
+// returns nil when there can be none
+func newRunbooks(cfg *config.Config, mongoService *services.MongoDBService, log *zap.Logger) *services.Runbooks {
+	if len(cfg.Runbooks) == 0 && mongoService == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Runbooks))
+	for name := range cfg.Runbooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	runbooks := make([]services.Runbook, 0, len(names))
+	for _, name := range names {
+		runbook := cfg.Runbooks[name]
+		runbooks = append(runbooks, services.Runbook{
+			Name:      name,
+			Title:     runbook.Title,
+			URL:       runbook.URL,
+			PageID:    runbook.PageID,
+			Products:  runbook.Products,
+			Endpoints: runbook.Endpoints,
+		})
+	}
+
+	var confluence *services.ConfluenceClient
+	if cfg.ConfluenceURL != "" {
+		username, token := cfg.ConfluenceUsername, cfg.ConfluenceAPIToken
+		if token == "" {
+			username, token = cfg.JiraUsername, cfg.JiraAPIToken
+		}
+		confluence = services.NewConfluenceClient(cfg.ConfluenceURL, username, token)
+	}
+	log.Info("Runbook links enabled", zap.Strings("runbooks", names), zap.Bool("stored", mongoService != nil),
+		zap.Bool("confluence", confluence != nil))
+	return services.NewRunbooks(runbooks, confluence, mongoService, log)
+}
+
+// newReportBroker creates the broker asynchronous reports are sent through,
+// or returns nil when they stay in memory
+func newReportBroker(cfg *config.Config) (services.ReportBroker, error) {
+	switch cfg.ReportQueueBackend {
+	case services.ReportQueueBackendSQS:
+		return services.NewSQSBroker(cfg.ReportSQSQueueURL, cfg.ReportSQSDeadLetterURL, cfg.ReportSQSRegion, cfg.ReportVisibilityTimeout)
+	case services.ReportQueueBackendRabbitMQ:
+		return services.NewRabbitMQBroker(cfg.RabbitMQURL, cfg.ReportRabbitMQQueue, cfg.ReportRabbitMQDLQ)
+	}
+	return nil, nil
+}
+
+// newKafkaEvents creates the publisher of ticket events to KAFKA_TOPIC, or
+// nil when no KAFKA_BROKERS are configured
+func newKafkaEvents(cfg *config.Config, log *zap.Logger) (*services.KafkaEvents, error) {
+	if len(cfg.KafkaBrokers) == 0 {
+		return nil, nil
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.KafkaTLS {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.KafkaTLSCAFile != "" {
+			pem, err := os.ReadFile(cfg.KafkaTLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read KAFKA_TLS_CA_FILE: %w", err)
+			}
+			roots, err := x509.SystemCertPool()
+			if err != nil {
+				roots = x509.NewCertPool()
+			}
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("KAFKA_TLS_CA_FILE contains no PEM certificates")
+			}
+			tlsConfig.RootCAs = roots
+		}
+	}
+
+	sasl := services.KafkaSASL{Mechanism: cfg.KafkaSASLMechanism, Username: cfg.KafkaUsername, Password: cfg.KafkaPassword}
+	producer := services.NewKafkaProducer(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaClientID, tlsConfig, sasl)
+	log.Info("Kafka events enabled", zap.Strings("brokers", cfg.KafkaBrokers), zap.String("topic", cfg.KafkaTopic),
+		zap.Bool("tls", cfg.KafkaTLS), zap.String("sasl", cfg.KafkaSASLMechanism))
+	return services.NewKafkaEvents(producer, log), nil
+}
+
+// newRateLimiter creates the rate limiter selected by RATE_LIMIT_BACKEND
+func newRateLimiter(cfg *config.Config, log *zap.Logger) (services.RateLimiter, error) {
+	if cfg.RateLimitBackend != services.RateLimitBackendRedis {
+		log.Info("Rate limiting enabled", zap.Int("requests", cfg.RateLimitRequests), zap.Duration("period", cfg.RateLimitPeriod))
+		return services.NewMemoryRateLimiter(cfg.RateLimitRequests, cfg.RateLimitPeriod, cfg.RateLimitBurst), nil
+	}
+
+	options, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	log.Info("Rate limiting enabled, shared through Redis", zap.Int("requests", cfg.RateLimitRequests), zap.Duration("period", cfg.RateLimitPeriod))
+	return services.NewRedisRateLimiter(redis.NewClient(options), "ronnin:ratelimit:", cfg.RateLimitRequests, cfg.RateLimitPeriod, cfg.RateLimitBurst), nil
+}
+
+// ipFilter returns the middleware restricting a route group to the clients
+// of its <group>_IP_ALLOWLIST and _IP_DENYLIST settings, or nil when both
+// are empty. Forwarding headers are only believed with TRUSTED_PROXIES.
+func ipFilter(group string, allow, deny, trustedProxies []string, log *zap.Logger) gin.HandlerFunc {
+	filter, err := middleware.ParseIPFilter(allow, deny)
+	if err != nil {
+		log.Fatal("Invalid "+group+"_IP_ALLOWLIST or "+group+"_IP_DENYLIST", zap.Error(err))
+	}
+	if filter == nil {
+		return nil
+	}
+	log.Info("Client IPs restricted", zap.String("routes", group),
+		zap.Strings("allow", allow), zap.Strings("deny", deny))
+	if len(trustedProxies) == 0 {
+		log.Info("TRUSTED_PROXIES is not set, so the IP restrictions check the peer address", zap.String("routes", group))
+	}
+	return middleware.RestrictIPs(filter, len(trustedProxies) > 0, log)
+}
+
+// newObjectStorage creates the object storage backend selected by
+// STORAGE_BACKEND. It returns a nil storage without error when the selected
+// backend is not configured, which disables file uploads.
+func newObjectStorage(cfg *config.Config, log *zap.Logger) (services.ObjectStorage, error) {
+	switch cfg.StorageBackend {
+	case services.StorageBackendGCS:
+		if cfg.GCSHMACAccessID == "" || cfg.GCSHMACSecret == "" || cfg.GCSBucketName == "" {
+			log.Warn("GCS configuration not provided, file uploads will be disabled")
+			return nil, nil
+		}
+		gcsService, err := services.NewGCSService(cfg.GCSHMACAccessID, cfg.GCSHMACSecret, cfg.GCSBucketName, cfg.PresignURLExpiry)
+		if err != nil {
+			return nil, err
+		}
+		gcsService.SetLogger(log)
+		log.Info("GCS storage initialized successfully", zap.String("bucket", cfg.GCSBucketName))
+		return gcsService, nil
+
+	case services.StorageBackendAzure:
+		if cfg.AzureStorageAccount == "" || cfg.AzureStorageKey == "" || cfg.AzureStorageContainer == "" {
+			log.Warn("Azure Blob configuration not provided, file uploads will be disabled")
+			return nil, nil
+		}
+		azureService, err := services.NewAzureBlobService(
+			cfg.AzureStorageAccount,
+			cfg.AzureStorageKey,
+			cfg.AzureStorageContainer,
+			cfg.AzureStorageEndpoint,
+			cfg.PresignURLExpiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Azure Blob storage initialized successfully",
+			zap.String("account", cfg.AzureStorageAccount),
+			zap.String("container", cfg.AzureStorageContainer),
+		)
+		return azureService, nil
+
+	case services.StorageBackendMinIO:
+		if cfg.MinIOEndpoint == "" || cfg.MinIOBucketName == "" {
+			log.Warn("MinIO configuration not provided, file uploads will be disabled")
+			return nil, nil
+		}
+		minioService, err := services.NewMinIOService(
+			cfg.MinIOEndpoint,
+			cfg.MinIOAccessKey,
+			cfg.MinIOSecretKey,
+			cfg.MinIORegion,
+			cfg.MinIOBucketName,
+			cfg.PresignURLExpiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		minioService.SetLogger(log)
+		log.Info("MinIO storage initialized successfully",
+			zap.String("endpoint", cfg.MinIOEndpoint),
+			zap.String("bucket", cfg.MinIOBucketName),
+		)
+		return minioService, nil
+
+	case services.StorageBackendLocal:
+		localService, err := services.NewLocalStorageService(cfg.LocalStorageDir, cfg.LocalStorageBaseURL, cfg.PresignURLExpiry)
+		if err != nil {
+			return nil, err
+		}
+		log.Warn("Using local filesystem storage, meant for development",
+			zap.String("dir", cfg.LocalStorageDir),
+		)
+		return localService, nil
+
+	default:
+		if cfg.AWSS3BucketName == "" {
+			log.Warn("S3 configuration not provided, file uploads will be disabled")
+			return nil, nil
+		}
+		s3Service, err := services.NewS3Service(
+			cfg.AWSS3AccessKey,
+			cfg.AWSS3SecretKey,
+			cfg.AWSS3Region,
+			cfg.AWSS3BucketName,
+			cfg.AWSS3BaseURL,
+			cfg.AWSS3Endpoint,
+			cfg.AWSS3UsePathStyle,
+			cfg.PresignURLExpiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := s3Service.SetServerSideEncryption(cfg.AWSS3SSE, cfg.AWSS3SSEKMSKeyID); err != nil {
+			return nil, err
+		}
+		s3Service.SetLogger(log)
+		credentialSource := "default credential chain"
+		if cfg.AWSS3AccessKey != "" {
+			credentialSource = "static keys"
+		}
+		log.Info("S3 service initialized successfully",
+			zap.String("region", cfg.AWSS3Region),
+			zap.String("bucket", cfg.AWSS3BucketName),
+			zap.String("endpoint", cfg.AWSS3Endpoint),
+			zap.String("credentials", credentialSource),
+			zap.String("sse", cfg.AWSS3SSE),
+		)
+		return s3Service, nil
+	}
+}
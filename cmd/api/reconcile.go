@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/config"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.uber.org/zap"
+)
+
+// runReconcileOrphans lists objects under the upload prefix that no ticket
+// references, optionally deleting them, and returns the process exit code
+func runReconcileOrphans(cfg *config.Config, log *zap.Logger, args []string) int {
+	defer log.Sync()
+
+	keyTemplate, err := services.NewKeyTemplate(cfg.StorageKeyPrefixTemplate)
+	if err != nil {
+		log.Error("Invalid storage key prefix template", zap.Error(err))
+		return 1
+	}
+
+	flags := flag.NewFlagSet("reconcile-orphans", flag.ContinueOnError)
+	prefix := flags.String("prefix", keyTemplate.Root(), "object key prefix to scan")
+	minAge := flags.Duration("min-age", 48*time.Hour, "skip objects modified more recently than this, as their report may not be submitted yet")
+	remove := flags.Bool("delete", false, "delete orphaned objects instead of only listing them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if cfg.MongoURI == "" {
+		log.Error("MongoDB is required to find referenced objects")
+		return 1
+	}
+	mongoService, err := services.NewMongoDBService(cfg.MongoURI, cfg.MongoDB, cfg.MongoCollection)
+	if err != nil {
+		log.Error("Failed to initialize MongoDB service", zap.Error(err))
+		return 1
+	}
+	defer mongoService.Disconnect(context.Background())
+
+	storage, err := newObjectStorage(cfg, log)
+	if err != nil || storage == nil {
+		log.Error("Object storage is not configured", zap.Error(err))
+		return 1
+	}
+
+	report, err := services.ReconcileOrphans(context.Background(), storage, mongoService, *prefix, *minAge, *remove, func(obj services.ObjectInfo) {
+		fmt.Printf("%s\t%d\t%s\n", obj.Key, obj.Size, obj.LastModified.Format(time.RFC3339))
+	})
+	if err != nil {
+		log.Error("Orphan reconciliation failed", zap.Error(err))
+		return 1
+	}
+
+	log.Info("Orphan reconciliation finished",
+		zap.String("prefix", *prefix),
+		zap.Int("scanned", report.Scanned),
+		zap.Int("orphans", report.Orphans),
+		zap.Int64("orphan_bytes", report.OrphanBytes),
+		zap.Int("deleted", report.Deleted),
+	)
+	return 0
+}
+
+// runCommand runs a maintenance command given on the command line instead of
+// the server. It reports false when no command was given.
+func runCommand(cfg *config.Config, log *zap.Logger, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "reconcile-orphans":
+		os.Exit(runReconcileOrphans(cfg, log, args[1:]))
+	case "config":
+		os.Exit(runConfig(cfg, args[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		os.Exit(2)
+	}
+	return true
+}
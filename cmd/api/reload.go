@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/parvez-capri/ronnin/internal/config"
+	"github.com/parvez-capri/ronnin/internal/handlers"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// reloader applies the settings that can change without a restart
+type reloader struct {
+	// opts are the command-line options the configuration was loaded with
+	opts config.Options
+
+	level   zap.AtomicLevel
+	jira    *services.JiraRegistry
+	reports *handlers.ReportHandler
+	log     *zap.Logger
+	// products add their teams to the roster; nil without MongoDB
+	products *services.Products
+	// limiter limits report intake; nil when rate limiting is disabled
+	limiter services.RateLimiter
+
+	// started is the configuration the process started with, and current
+	// the one last reloaded
+	started *config.Config
+	current *config.Config
+}
+
+// reloadOnHangup reloads the configuration whenever the process receives
+// SIGHUP, until ctx is done
+func (r *reloader) reloadOnHangup(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				r.reload()
+			}
+		}
+	}()
+}
+
+// reloadable are the settings reload swaps in; changes to any other setting
+// are logged as needing a restart
+var reloadable = map[string]bool{
+	"SUPPORT_TEAM_MEMBERS":    true,
+	"SUPPORT_ROSTER":          true,
+	"JIRA_PRODUCT_ROUTING":    true,
+	"PRODUCT_REQUIRED_FIELDS": true,
+	"RATE_LIMIT_REQUESTS":     true,
+	"RATE_LIMIT_PERIOD":       true,
+	"RATE_LIMIT_BURST":        true,
+	"LOG_LEVEL":               true,
+}
+
+// reload re-reads the configuration and swaps in the support roster, the
+// routing of products to trackers, the fields required per product, the rate
+// limits and the log level. An invalid configuration is logged and the
+// running settings are kept.
+func (r *reloader) reload() {
+	cfg, err := config.Load(r.opts)
+	if err != nil {
+		r.log.Error("Failed to reload configuration, keeping the current settings", zap.Error(err))
+		return
+	}
+	forms, err := handlers.ParseProductForms(cfg.ProductRequiredFields)
+	if err != nil {
+		r.log.Error("Failed to reload configuration, keeping the current settings", zap.Error(err))
+		return
+	}
+	roster, err := newRoster(cfg, r.log)
+	if err != nil {
+		r.log.Error("Failed to reload configuration, keeping the current settings", zap.Error(err))
+		return
+	}
+	routes, err := services.ParseJiraRouting(cfg.JiraProductRouting)
+	if err != nil {
+		r.log.Error("Failed to reload configuration, keeping the current settings", zap.Error(err))
+		return
+	}
+
+	// Routes to unknown trackers fail before anything else is swapped in
+	var changed []string
+	if cfg.JiraProductRouting != r.current.JiraProductRouting {
+		if err := r.jira.SetRoutes(routes); err != nil {
+			r.log.Error("Failed to reload configuration, keeping the current settings", zap.Error(err))
+			return
+		}
+		changed = append(changed, "JIRA_PRODUCT_ROUTING")
+	}
+	rosterChanged := false
+	if !slices.Equal(cfg.SupportTeamMembers, r.current.SupportTeamMembers) {
+		changed = append(changed, "SUPPORT_TEAM_MEMBERS")
+		rosterChanged = true
+	}
+	if !reflect.DeepEqual(cfg.SupportRoster, r.current.SupportRoster) {
+		changed = append(changed, "SUPPORT_ROSTER")
+		rosterChanged = true
+	}
+	if rosterChanged && r.products != nil {
+		r.products.SetRoster(roster)
+	} else if rosterChanged {
+		r.jira.SetRoster(roster)
+	}
+	if cfg.ProductRequiredFields != r.current.ProductRequiredFields {
+		r.reports.SetProductForms(forms)
+		changed = append(changed, "PRODUCT_REQUIRED_FIELDS")
+	}
+	if r.limiter != nil && cfg.RateLimitRequests > 0 {
+		limits := changedSettings(r.current, cfg, "RATE_LIMIT_REQUESTS", "RATE_LIMIT_PERIOD", "RATE_LIMIT_BURST")
+		if len(limits) > 0 {
+			r.limiter.SetLimits(cfg.RateLimitRequests, cfg.RateLimitPeriod, cfg.RateLimitBurst)
+			changed = append(changed, limits...)
+		}
+	}
+	if cfg.LogLevel != r.current.LogLevel {
+		r.level.SetLevel(logger.ParseLevel(cfg.LogLevel))
+		changed = append(changed, "LOG_LEVEL")
+	}
+
+	// Other settings keep the values the process started with, and rate
+	// limiting is only turned on or off by a restart
+	var restart []string
+	for _, name := range changedSettings(r.started, cfg) {
+		if !reloadable[name] {
+			restart = append(restart, name)
+		}
+	}
+	if (r.limiter != nil) != (cfg.RateLimitRequests > 0) {
+		restart = append(restart, "RATE_LIMIT_REQUESTS")
+	}
+
+	r.current = cfg
+	r.log.Info("Reloadable settings reloaded", zap.Strings("changed", changed), zap.Strings("restart_required", restart))
+}
+
+// changedSettings returns the settings that differ between two
+// configurations, out of names when any are given
+func changedSettings(current, next *config.Config, names ...string) []string {
+	var changed []string
+	a, b := reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		name := settingName(a.Type().Field(i))
+		if len(names) > 0 && !slices.Contains(names, name) {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// settingName returns the name of the setting of a configuration field
+func settingName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+	return name
+}
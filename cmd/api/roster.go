@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/parvez-capri/ronnin/internal/config"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.uber.org/zap"
+)
+
+// newRoster creates the support roster tickets are assigned from: the teams
+// of SUPPORT_ROSTER, or else the members of SUPPORT_TEAM_MEMBERS, who are
+// always on shift
+func newRoster(cfg *config.Config, log *zap.Logger) (*services.Roster, error) {
+	oncall := map[string]services.OnCallLookup{}
+	if cfg.PagerDutyAPIToken != "" {
+		oncall[services.OnCallPagerDuty] = services.NewPagerDutySchedules(cfg.PagerDutyAPIToken)
+	}
+	if cfg.OpsgenieAPIKey != "" {
+		oncall[services.OnCallOpsgenie] = services.NewOpsgenieSchedules(cfg.OpsgenieAPIKey)
+	}
+	if len(cfg.SupportRoster) == 0 {
+		return services.NewStaticRoster(cfg.SupportTeamMembers, oncall, log), nil
+	}
+
+	teams := make([]services.RosterTeam, 0, len(cfg.SupportRoster))
+	for name, team := range cfg.SupportRoster {
+		members := make([]services.RosterMember, len(team.Members))
+		for i, member := range team.Members {
+			members[i] = services.RosterMember{AccountID: member.AccountID, Email: member.Email, GitHub: member.GitHub, GitLab: member.GitLab}
+			if member.Hours == "" {
+				continue
+			}
+			shift, err := services.ParseShift(member.Timezone, member.Hours, member.Days)
+			if err != nil {
+				return nil, fmt.Errorf("invalid shift of %s in team %s: %w", member.AccountID, name, err)
+			}
+			members[i].Shift = shift
+		}
+		teams = append(teams, services.RosterTeam{
+			Name:     name,
+			Products: team.Products,
+			Members:  members,
+			Schedule: team.Schedule,
+		})
+	}
+	return services.NewRoster(teams, oncall, log.Named("roster"))
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/handlers"
+	"github.com/parvez-capri/ronnin/internal/middleware"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.uber.org/zap"
+)
+
+// apiVersionPrefix is the route group of the current API version
+const apiVersionPrefix = "/api/v1"
+
+// apiRoutes holds the handlers of the versioned API. The same routes are
+// registered under apiVersionPrefix and, deprecated, at their legacy
+// unversioned paths.
+type apiRoutes struct {
+	report *handlers.ReportHandler
+	upload *handlers.UploadHandler
+	ticket *handlers.TicketHandler
+	// analytics summarizes usage per product from the stored tickets
+	analytics *handlers.AnalyticsHandler
+	// issues groups the stored tickets by fingerprint; it is only served
+	// under the versioned prefix
+	issues *handlers.IssueHandler
+
+	// myReports serves reporter status pages when status tokens are enabled
+	myReports *handlers.MyReportsHandler
+
+	// admin routes are only registered when an admin token, API keys or
+	// OIDC are configured
+	admin *handlers.AdminHandler
+	// pprof serves the Go profiles to admins
+	pprof bool
+
+	// creds authenticate admin requests, ticket requests when OIDC is
+	// configured, and with requireAPIKeys report and ticket requests
+	creds          middleware.Credentials
+	requireAPIKeys bool
+	log            *zap.Logger
+
+	// ticketToken enables JSON ticket creation; it is only served under
+	// the versioned prefix
+	ticketToken string
+
+	// webhooks receives Jira webhooks verified by verifyWebhook when a
+	// webhook secret is configured; it is only served under the versioned
+	// prefix
+	webhooks      *handlers.WebhookHandler
+	verifyWebhook gin.HandlerFunc
+	// helpdesk receives helpdesk webhooks, authenticated with an API key of
+	// the write scope, when a helpdesk is configured; it is only served
+	// under the versioned prefix
+	helpdesk *handlers.HelpdeskHandler
+	// alertmanager receives Alertmanager webhooks authenticated with
+	// alertmanagerToken when it is set; it is only served under the
+	// versioned prefix
+	alertmanager      *handlers.AlertmanagerHandler
+	alertmanagerToken string
+
+	// adminIPs and ticketIPs restrict the clients that may reach the admin
+	// and ticket endpoints; nil allows every client
+	adminIPs  gin.HandlerFunc
+	ticketIPs gin.HandlerFunc
+
+	// rateLimit limits report intake per client; nil disables it
+	rateLimit gin.HandlerFunc
+	// verifyHuman requires a CAPTCHA or proof of work on new reports; nil
+	// disables it
+	verifyHuman gin.HandlerFunc
+	// clientInfo adds the reporter's browser and device to new reports; nil
+	// disables it
+	clientInfo gin.HandlerFunc
+
+	// uploadBodyLimit replaces the global body size limit on routes that
+	// carry files
+	uploadBodyLimit int64
+}
+
+// registerVersioned adds the API routes together with the routes that have
+// no legacy unversioned alias
+func (a *apiRoutes) registerVersioned(g *gin.RouterGroup) {
+	// List endpoints are paginated from v1 on
+	g.Use(handlers.PaginatedLists())
+	a.register(g)
+
+	// Batches of the browser SDK have no legacy alias
+	ingest := g.Group("", a.requireScope(services.ScopeReport, false)...)
+	if a.rateLimit != nil {
+		ingest.Use(a.rateLimit)
+	}
+	ingest.POST("/ingest", a.verifiedIntake(a.report.Ingest)...)
+
+	// Issues have no legacy alias either
+	issues := g.Group("", restrict(a.ticketIPs, a.requireScope(services.ScopeRead, a.creds.OIDC != nil)...)...)
+	issues.GET("/issues", a.issues.ListIssues)
+
+	if a.ticketToken != "" {
+		g.POST("/create-ticket", middleware.TokenAuth("tickets", a.ticketToken), a.ticket.CreateTicketGin)
+	}
+	if a.webhooks != nil {
+		g.POST("/webhooks/jira", a.verifyWebhook, a.webhooks.JiraWebhook)
+	}
+	if a.helpdesk != nil {
+		g.POST("/webhooks/helpdesk", middleware.RequireScope(a.creds, services.ScopeWrite, a.log), a.helpdesk.HelpdeskWebhook)
+	}
+	if a.alertmanager != nil {
+		g.POST("/webhooks/alertmanager", middleware.TokenAuth("alertmanager", a.alertmanagerToken), a.alertmanager.AlertmanagerWebhook)
+	}
+}
+
+// register adds the API routes to a router group
+func (a *apiRoutes) register(g *gin.RouterGroup) {
+	uploadLimit := middleware.BodyLimit(a.uploadBodyLimit)
+
+	reports := g.Group("", a.requireScope(services.ScopeReport, false)...)
+	if a.rateLimit != nil {
+		reports.Use(a.rateLimit)
+	}
+	reports.POST("/report-issue", a.reportIntake(uploadLimit)...)
+	reports.GET("/reports/:reportId/status", a.report.GetReportStatus)
+	reports.POST("/uploads/presign", a.upload.PresignUpload)
+	reports.POST("/uploads", a.upload.CreateUploadSession)
+	reports.GET("/uploads/:id", a.upload.GetUploadSession)
+	reports.PATCH("/uploads/:id", uploadLimit, a.upload.AppendUploadChunk)
+	reports.POST("/uploads/:id/complete", a.upload.CompleteUploadSession)
+
+	if a.myReports != nil {
+		g.GET("/my-reports/:token", a.myReports.GetMyReports)
+	}
+
+	// MongoDB routes
+	tickets := g.Group("", restrict(a.ticketIPs, a.requireScope(services.ScopeRead, a.creds.OIDC != nil)...)...)
+	tickets.GET("/tickets", a.ticket.GetAllTicketsGin)
+	tickets.GET("/tickets/:id", a.ticket.GetTicketByIDGin)
+	tickets.GET("/tickets/:id/image", a.ticket.GetTicketImageGin)
+	tickets.GET("/tickets/:id/attachments", a.ticket.GetTicketAttachmentsGin)
+	tickets.GET("/attachments/:id", a.ticket.GetAttachmentGin)
+	tickets.GET("/analytics/usage", a.analytics.GetUsage)
+
+	if a.admin != nil {
+		admin := g.Group("/admin", restrict(a.adminIPs, middleware.RequireScope(a.creds, services.ScopeAdmin, a.log))...)
+		admin.GET("/quarantine", a.admin.ListQuarantine)
+		admin.POST("/quarantine/:id/approve", a.admin.ApproveQuarantine)
+		admin.DELETE("/quarantine/:id", a.admin.PurgeQuarantine)
+		admin.GET("/status", a.admin.GetStatus)
+		admin.GET("/maintenance", a.admin.GetMaintenance)
+		admin.POST("/maintenance", a.admin.ChangeMaintenance)
+		admin.GET("/mock-tickets", a.admin.ListMockTickets)
+		admin.POST("/tickets/sync", a.admin.SyncTickets)
+		admin.POST("/tickets/:id/resync", a.admin.ResyncTicket)
+		admin.POST("/tickets/:id/rotate-url", a.admin.RotateTicketURL)
+		admin.DELETE("/tickets/:id", a.admin.PurgeTicket)
+		admin.POST("/urls/rotate", a.admin.RotateURLs)
+		admin.GET("/reports/failed", a.admin.ListFailedReports)
+		admin.POST("/reports/retry", a.admin.RetryFailedReports)
+		admin.POST("/reports/:id/retry", a.admin.RetryReport)
+		admin.GET("/failed-reports", a.admin.ListStoredReports)
+		admin.POST("/failed-reports/:id/retry", a.admin.RetryStoredReport)
+		admin.POST("/failed-reports/retry", a.admin.RetryStoredReports)
+		admin.GET("/webhooks/failed", a.admin.ListFailedWebhooks)
+		admin.POST("/webhooks/failed/:id/replay", a.admin.ReplayWebhook)
+		admin.POST("/webhooks/replay", a.admin.ReplayFailedWebhooks)
+		admin.GET("/api-keys", a.admin.ListAPIKeys)
+		admin.POST("/api-keys", a.admin.CreateAPIKey)
+		admin.DELETE("/api-keys/:id", a.admin.RevokeAPIKey)
+		admin.GET("/tenants", a.admin.ListTenants)
+		admin.GET("/tenants/:id", a.admin.GetTenant)
+		admin.POST("/tenants", a.admin.CreateTenant)
+		admin.PUT("/tenants/:id", a.admin.UpdateTenant)
+		admin.DELETE("/tenants/:id", a.admin.DeleteTenant)
+		admin.GET("/products", a.admin.ListProducts)
+		admin.GET("/products/:id", a.admin.GetProduct)
+		admin.POST("/products", a.admin.CreateProduct)
+		admin.PUT("/products/:id", a.admin.UpdateProduct)
+		admin.DELETE("/products/:id", a.admin.DeleteProduct)
+		admin.GET("/audit", a.admin.ListAuditLog)
+		if a.pprof {
+			registerPprof(admin.Group("/debug/pprof"))
+		}
+
+		agents := g.Group("", restrict(a.ticketIPs, middleware.RequireScope(a.creds, services.ScopeWrite, a.log))...)
+		agents.PUT("/tickets/:id/reassign", a.admin.ReassignTicket)
+		agents.POST("/tickets/:id/comments", a.admin.CommentOnTicket)
+	}
+}
+
+// reportIntake returns the handlers of /report-issue, verifying the
+// submitter once the body limit is in place
+func (a *apiRoutes) reportIntake(uploadLimit gin.HandlerFunc) []gin.HandlerFunc {
+	return append([]gin.HandlerFunc{uploadLimit}, a.verifiedIntake(a.report.ReportIssue)...)
+}
+
+// verifiedIntake returns a handler that files reports, preceded by the
+// verification of the submitter and the capture of their browser and device
+func (a *apiRoutes) verifiedIntake(handler gin.HandlerFunc) []gin.HandlerFunc {
+	var chain []gin.HandlerFunc
+	if a.verifyHuman != nil {
+		chain = append(chain, a.verifyHuman)
+	}
+	if a.clientInfo != nil {
+		chain = append(chain, a.clientInfo)
+	}
+	return append(chain, handler)
+}
+
+// routePriorities decide which requests are shed first when the server is
+// saturated: new reports and uploads are served longest, list reads and
+// reports on the service are shed first, and health checks never. Routes
+// are given without the API version prefix; the rest are normal.
+var routePriorities = map[string]middleware.Priority{
+	"POST /report-issue":             middleware.PriorityHigh,
+	"POST /ingest":                   middleware.PriorityHigh,
+	"POST /create-ticket":            middleware.PriorityHigh,
+	"POST /uploads":                  middleware.PriorityHigh,
+	"PATCH /uploads/:id":             middleware.PriorityHigh,
+	"POST /uploads/:id/complete":     middleware.PriorityHigh,
+	"POST /uploads/presign":          middleware.PriorityHigh,
+	"POST /api/:projectId/envelope/": middleware.PriorityHigh,
+	"POST /api/:projectId/store/":    middleware.PriorityHigh,
+
+	"GET /tickets":               middleware.PriorityLow,
+	"GET /issues":                middleware.PriorityLow,
+	"GET /analytics/usage":       middleware.PriorityLow,
+	"GET /admin/audit":           middleware.PriorityLow,
+	"GET /admin/reports/failed":  middleware.PriorityLow,
+	"GET /admin/failed-reports":  middleware.PriorityLow,
+	"GET /admin/mock-tickets":    middleware.PriorityLow,
+	"GET /admin/webhooks/failed": middleware.PriorityLow,
+
+	"GET /livez":   middleware.PriorityExempt,
+	"GET /readyz":  middleware.PriorityExempt,
+	"GET /health":  middleware.PriorityExempt,
+	"GET /metrics": middleware.PriorityExempt,
+}
+
+// registerPprof adds the Go profiling endpoints of net/http/pprof
+func registerPprof(g *gin.RouterGroup) {
+	g.GET("/", gin.WrapF(pprof.Index))
+	g.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	g.GET("/profile", gin.WrapF(pprof.Profile))
+	g.GET("/symbol", gin.WrapF(pprof.Symbol))
+	g.POST("/symbol", gin.WrapF(pprof.Symbol))
+	g.GET("/trace", gin.WrapF(pprof.Trace))
+	// Named profiles such as heap, goroutine and block
+	g.GET("/:profile", func(c *gin.Context) {
+		pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+	})
+}
+
+// restrict puts an IP filter, when there is one, ahead of the handlers of a
+// route group so unwanted clients are refused before authentication
+func restrict(filter gin.HandlerFunc, chain ...gin.HandlerFunc) []gin.HandlerFunc {
+	if filter == nil {
+		return chain
+	}
+	return append([]gin.HandlerFunc{filter}, chain...)
+}
+
+// requireScope returns the middleware requiring credentials with a scope,
+// or none when neither API keys are enforced nor always is set
+func (a *apiRoutes) requireScope(scope string, always bool) []gin.HandlerFunc {
+	if !a.requireAPIKeys && !always {
+		return nil
+	}
+	return []gin.HandlerFunc{middleware.RequireScope(a.creds, scope, a.log)}
+}
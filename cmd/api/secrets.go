@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/parvez-capri/ronnin/internal/config"
+	"github.com/parvez-capri/ronnin/internal/secrets"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.uber.org/zap"
+)
+
+// refreshSecrets re-reads credentials from the secrets manager every
+// SECRETS_REFRESH_INTERVAL and rotates the Jira token and S3 keys in place.
+// A changed MongoDB URI is only logged, since it takes a restart to apply.
+func refreshSecrets(ctx context.Context, cfg *config.Config, log *zap.Logger, jiraService *services.JiraService, storage services.ObjectStorage) {
+	if cfg.SecretsProvider == secrets.ProviderNone || cfg.SecretsRefreshInterval <= 0 {
+		return
+	}
+
+	provider, err := cfg.NewSecretsProvider(ctx)
+	if err != nil {
+		log.Error("Failed to initialize secrets provider, secrets will not be refreshed", zap.Error(err))
+		return
+	}
+	s3Service, _ := storage.(*services.S3Service)
+	current := *cfg
+
+	go secrets.Refresh(ctx, provider, cfg.SecretsRefreshInterval, func(values map[string]string, err error) {
+		if err != nil {
+			log.Warn("Failed to refresh secrets, keeping the current credentials", zap.Error(err))
+			return
+		}
+
+		changed := current.ApplySecrets(values)
+		if len(changed) == 0 {
+			return
+		}
+		if jiraService != nil && slices.Contains(changed, "JIRA_API_TOKEN") {
+			jiraService.SetAPIToken(current.JiraAPIToken)
+		}
+		if s3Service != nil && cfg.StorageBackend == "s3" &&
+			(slices.Contains(changed, "AWS_S3_ACCESS_KEY") || slices.Contains(changed, "AWS_S3_SECRET_KEY")) {
+			s3Service.SetStaticCredentials(current.AWSS3AccessKey, current.AWSS3SecretKey)
+		}
+		if slices.Contains(changed, "MONGO_URI") {
+			log.Warn("MONGO_URI changed in the secrets manager; restart to reconnect with it")
+		}
+		log.Info("Secrets refreshed", zap.Strings("changed", changed))
+	})
+
+	log.Info("Secrets refresh enabled",
+		zap.String("provider", cfg.SecretsProvider),
+		zap.Duration("interval", cfg.SecretsRefreshInterval),
+	)
+}
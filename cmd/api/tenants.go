@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/parvez-capri/ronnin/internal/config"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.uber.org/zap"
+)
+
+// newTenants creates the store of the tenants kept in MongoDB, whose Jira
+// projects and S3 buckets get the same redaction, worker pools and timeouts
+// as those of the deployment. Tenants need MongoDB, so it returns nil
+// without it.
+func newTenants(cfg *config.Config, mongoService *services.MongoDBService, roster *services.Roster, redactor *services.Redactor, trackerPool *services.WorkerPool, log *zap.Logger) *services.Tenants {
+	if mongoService == nil {
+		return nil
+	}
+
+	clients := services.TenantClients{
+		Tracker: func(tenant *models.Tenant, roster *services.Roster) (services.IssueTracker, error) {
+			jira, err := services.NewJiraService(
+				tenant.Jira.URL,
+				tenant.Jira.Username,
+				tenant.Jira.APIToken,
+				tenant.Jira.ProjectKey,
+				roster,
+				cfg.DefaultPriority,
+				mongoService,
+			)
+			if err != nil {
+				return nil, err
+			}
+			jira.SetRedactor(redactor)
+			jira.SetJSONAttachments(cfg.JiraJSONAttachments)
+			jira.SetLogger(log.With(zap.String("tenant", tenant.ID)))
+			return services.TimeoutTracker(services.PoolTracker(jira, trackerPool), cfg.TrackerTimeout), nil
+		},
+		Storage: func(tenant *models.Tenant) (services.ObjectStorage, error) {
+			s3Service, err := services.NewS3Service(
+				tenant.Storage.AccessKey,
+				tenant.Storage.SecretKey,
+				tenant.Storage.Region,
+				tenant.Storage.Bucket,
+				"",
+				tenant.Storage.Endpoint,
+				tenant.Storage.UsePathStyle,
+				cfg.PresignURLExpiry,
+			)
+			if err != nil {
+				return nil, err
+			}
+			s3Service.SetLogger(log.With(zap.String("tenant", tenant.ID)))
+			return s3Service, nil
+		},
+	}
+	return services.NewTenants(mongoService, clients, roster, log)
+}
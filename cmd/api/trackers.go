@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/parvez-capri/ronnin/internal/config"
+	"github.com/parvez-capri/ronnin/internal/services"
+)
+
+// newIssueTrackers creates the trackers products can be routed to by name:
+// the default tracker, JIRA_INSTANCES, GITHUB_TRACKERS, GITLAB_TRACKERS and
+// LINEAR_TRACKERS, and the collector when it is not the default, so that
+// its tickets can be exported. Names must be unique across them.
+func newIssueTrackers(cfg *config.Config, defaultTracker services.IssueTracker, collector *services.CollectorTracker, roster *services.Roster, mongoService *services.MongoDBService) (map[string]services.IssueTracker, error) {
+	trackers := map[string]services.IssueTracker{services.DefaultJiraInstance: defaultTracker}
+	add := func(setting, name string, tracker services.IssueTracker) error {
+		if trackers[name] != nil {
+			return fmt.Errorf("%s: the name %s is already used by another issue tracker", setting, name)
+		}
+		trackers[name] = tracker
+		return nil
+	}
+
+	for name, instance := range cfg.JiraInstances {
+		jira, err := services.NewJiraService(
+			instance.URL,
+			instance.Username,
+			instance.APIToken,
+			instance.ProjectKey,
+			roster,
+			cfg.DefaultPriority,
+			mongoService,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("Jira instance %s: %w", name, err)
+		}
+		if instance.ServiceDeskID != "" {
+			jira.SetServiceDesk(&services.ServiceDesk{
+				ID:            instance.ServiceDeskID,
+				RequestTypeID: instance.RequestTypeID,
+				Participants:  instance.RequestParticipants,
+			})
+		}
+		jira.SetJSONAttachments(cfg.JiraJSONAttachments)
+		if err := add("JIRA_INSTANCES", name, jira); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, tracker := range cfg.GitHubTrackers {
+		github, err := services.NewGitHubTracker(
+			tracker.APIURL,
+			tracker.Repository,
+			tracker.Token,
+			tracker.ProjectKey,
+			tracker.Labels,
+			tracker.AttachmentsBranch,
+			roster,
+			mongoService,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("GitHub tracker %s: %w", name, err)
+		}
+		if err := add("GITHUB_TRACKERS", name, github); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, tracker := range cfg.GitLabTrackers {
+		gitlab := services.NewGitLabTracker(
+			tracker.URL,
+			tracker.Project,
+			tracker.Token,
+			tracker.ProjectKey,
+			tracker.Labels,
+			tracker.Confidential,
+			roster,
+			mongoService,
+		)
+		if err := add("GITLAB_TRACKERS", name, gitlab); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, tracker := range cfg.LinearTrackers {
+		linear := services.NewLinearTracker(
+			tracker.APIURL,
+			tracker.APIKey,
+			tracker.TeamKey,
+			tracker.Labels,
+			cfg.DefaultPriority,
+			roster,
+			mongoService,
+		)
+		if err := add("LINEAR_TRACKERS", name, linear); err != nil {
+			return nil, err
+		}
+	}
+
+	if collector != nil && defaultTracker != services.IssueTracker(collector) {
+		if err := add("COLLECTOR_EXPORT_INTERVAL", services.CollectorInstance, collector); err != nil {
+			return nil, err
+		}
+	}
+	return trackers, nil
+}
@@ -0,0 +1,146 @@
+// cmd/openapi converts the Swagger 2.0 spec generated by swag into the
+// OpenAPI 3 spec that is served and validated against at runtime.
+//
+// Run it after `swag init`, see `make docs`.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func main() {
+	in := flag.String("in", "docs/swagger.json", "Swagger 2.0 spec generated by swag")
+	out := flag.String("out", "docs/openapi.json", "OpenAPI 3 spec to write")
+	flag.Parse()
+
+	v2, err := os.ReadFile(*in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read spec: %v\n", err)
+		os.Exit(1)
+	}
+
+	v3, err := convert(v2)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to convert spec: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(*out, v3, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write spec: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// convert returns the OpenAPI 3 form of a Swagger 2.0 spec. The host is
+// dropped from the server URL so that the spec applies to any deployment.
+func convert(v2 []byte) ([]byte, error) {
+	var doc2 openapi2.T
+	if err := json.Unmarshal(v2, &doc2); err != nil {
+		return nil, fmt.Errorf("failed to parse swagger spec: %w", err)
+	}
+
+	doc3, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, err
+	}
+
+	fixFormBodies(&doc2, doc3)
+	fixFileResponses(&doc2, doc3)
+
+	basePath := doc2.BasePath
+	if basePath == "" {
+		basePath = "/"
+	}
+	doc3.Servers = openapi3.Servers{{URL: basePath}}
+
+	if err := doc3.Validate(openapi3.NewLoader().Context); err != nil {
+		return nil, fmt.Errorf("converted spec is invalid: %w", err)
+	}
+
+	data, err := json.Marshal(doc3)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "    "); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// fixFormBodies corrects the request bodies converted from formData
+// parameters. swag lists every consumed content type for them, but the form
+// field schema does not describe JSON bodies, and the converter marks
+// required fields on the field schemas instead of the form schema.
+func fixFormBodies(doc2 *openapi2.T, doc3 *openapi3.T) {
+	for path, item2 := range doc2.Paths {
+		for method, op2 := range item2.Operations() {
+			hasForm := false
+			for _, param := range op2.Parameters {
+				if param.In == "formData" {
+					hasForm = true
+				}
+			}
+			op3 := doc3.Paths.Find(path).GetOperation(method)
+			if !hasForm || op3 == nil || op3.RequestBody == nil || op3.RequestBody.Value == nil {
+				continue
+			}
+
+			body := op3.RequestBody.Value
+			delete(body.Content, "application/json")
+			for _, media := range body.Content {
+				if media.Schema == nil || media.Schema.Value == nil {
+					continue
+				}
+				form := media.Schema.Value
+				var required []string
+				for name, field := range form.Properties {
+					if field.Value != nil && len(field.Value.Required) > 0 {
+						field.Value.Required = nil
+						required = append(required, name)
+					}
+				}
+				if len(required) > 0 {
+					sort.Strings(required)
+					form.Required = required
+				}
+			}
+		}
+	}
+}
+
+// fixFileResponses describes file downloads as binary strings of the types
+// the operation produces. The converter keeps the "file" type of Swagger 2.0
+// responses, which OpenAPI 3 does not have, and lists them as JSON.
+func fixFileResponses(doc2 *openapi2.T, doc3 *openapi3.T) {
+	for path, item2 := range doc2.Paths {
+		for method, op2 := range item2.Operations() {
+			op3 := doc3.Paths.Find(path).GetOperation(method)
+			if op3 == nil {
+				continue
+			}
+			produces := op2.Produces
+			if len(produces) == 0 {
+				produces = doc2.Produces
+			}
+			for status, response2 := range op2.Responses {
+				response3 := op3.Responses[status]
+				if response2.Schema == nil || response2.Schema.Value == nil || response2.Schema.Value.Type != "file" || response3 == nil || response3.Value == nil {
+					continue
+				}
+				binary := openapi3.NewStringSchema().WithFormat("binary")
+				response3.Value.Content = openapi3.NewContentWithSchema(binary, produces)
+			}
+		}
+	}
+}
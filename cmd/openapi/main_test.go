@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestOpenAPISpecUpToDate fails when docs/openapi.json was not regenerated
+// after the swagger spec changed
+func TestOpenAPISpecUpToDate(t *testing.T) {
+	v2, err := os.ReadFile("../../docs/swagger.json")
+	if err != nil {
+		t.Fatalf("failed to read swagger spec: %v", err)
+	}
+	want, err := convert(v2)
+	if err != nil {
+		t.Fatalf("failed to convert swagger spec: %v", err)
+	}
+
+	got, err := os.ReadFile("../../docs/openapi.json")
+	if err != nil {
+		t.Fatalf("failed to read OpenAPI spec: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("docs/openapi.json is out of date, run `make docs`")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes
+const diffContext = 3
+
+// maxDiffLines caps the lines compared line by line; longer texts are shown
+// whole, which the description's length limit keeps from happening
+const maxDiffLines = 4000
+
+// diff returns a unified diff of the lines of two versions of a field of a
+// ticket, or nothing when they are equal
+func diff(field, old, new string) string {
+	if old == new {
+		return ""
+	}
+	a, b := strings.Split(old, "\n"), strings.Split(new, "\n")
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s (recorded)\n+++ %s (current)\n", field, field)
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		writeLines(&out, "-", a)
+		writeLines(&out, "+", b)
+		return out.String()
+	}
+
+	ops := diffLines(a, b)
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk, which runs until
+		// more than twice the context of unchanged lines follow
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last, equal := first, 0
+		for i := first; i < len(ops) && equal <= 2*diffContext; i++ {
+			if ops[i].kind == ' ' {
+				equal++
+			} else {
+				last, equal = i, 0
+			}
+		}
+		from, to := max(first-diffContext, start), min(last+diffContext+1, len(ops))
+		fmt.Fprintf(&out, "@@ line %d @@\n", ops[from].line)
+		for _, op := range ops[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func writeLines(out *strings.Builder, prefix string, lines []string) {
+	for _, line := range lines {
+		out.WriteString(prefix + line + "\n")
+	}
+}
+
+// diffOp is a line kept (' '), removed ('-') or added ('+'), with its line
+// number in the recorded version
+type diffOp struct {
+	kind byte
+	text string
+	line int
+}
+
+// diffLines returns the operations turning a into b, from their longest
+// common subsequence of lines
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i + 1})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i + 1})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i + 1})
+			j++
+		}
+	}
+	return ops
+}
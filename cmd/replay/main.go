@@ -0,0 +1,168 @@
+// cmd/replay re-runs reports kept as fixtures through the current Jira
+// description builder, in dry run: nothing is filed or stored. It diffs the
+// titles, descriptions and overflow comments it renders against those the
+// fixtures were recorded with, so a refactor of the builder can be checked
+// against real traffic before it ships.
+//
+// Record fixtures from the tickets stored in MongoDB before the change,
+// replay them after it, and accept the differences once reviewed:
+//
+//	go run ./cmd/replay -record -mongo-uri mongodb://localhost:27017 -limit 200
+//	go run ./cmd/replay
+//	go run ./cmd/replay -update
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultFixturesDir holds the fixtures the description builder is
+// contract-tested against
+const defaultFixturesDir = "internal/services/testdata/replay"
+
+func main() {
+	dir := flag.String("dir", defaultFixturesDir, "Directory of the fixtures")
+	update := flag.Bool("update", false, "Rewrite the fixtures that differ with the current output")
+	record := flag.Bool("record", false, "Record fixtures from the tickets stored in MongoDB instead of replaying")
+	mongoURI := flag.String("mongo-uri", os.Getenv("MONGO_URI"), "MongoDB URI to record from (default $MONGO_URI)")
+	mongoDB := flag.String("mongo-db", envOr("MONGO_DB", "ronnin"), "MongoDB database to record from")
+	mongoCollection := flag.String("mongo-collection", envOr("MONGO_COLLECTION", "tickets"), "MongoDB collection to record from")
+	product := flag.String("product", "", "Only record tickets of this product")
+	limit := flag.Int64("limit", 100, "Number of most recent tickets to record")
+	titleTemplate := flag.String("title-template", os.Getenv("TICKET_TITLE_TEMPLATE"), "Template tickets are titled with (default $TICKET_TITLE_TEMPLATE)")
+	flag.Parse()
+
+	var titles *services.TitleTemplate
+	if *titleTemplate != "" {
+		var err error
+		if titles, err = services.ParseTitleTemplate(*titleTemplate); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid title template: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *record {
+		if err := recordFixtures(*dir, *mongoURI, *mongoDB, *mongoCollection, *product, *limit, titles); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to record fixtures: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	changed, err := replay(*dir, *update, titles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to replay fixtures: %v\n", err)
+		os.Exit(1)
+	}
+	if changed > 0 && !*update {
+		os.Exit(1)
+	}
+}
+
+// replay renders the fixtures in dir, titled with titles when not nil,
+// prints how the output differs from theirs and returns the number of
+// fixtures that differ. With update, those fixtures are rewritten with the
+// current output.
+func replay(dir string, update bool, titles *services.TitleTemplate) (int, error) {
+	fixtures, err := services.LoadReplayFixtures(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(fixtures) == 0 {
+		return 0, fmt.Errorf("no fixtures in %s", dir)
+	}
+
+	changed := 0
+	for _, fixture := range fixtures {
+		rendered := fixture.Replay(titles)
+		if rendered == fixture.Rendered {
+			continue
+		}
+		changed++
+		fmt.Printf("=== %s\n", fixture.Name)
+		fmt.Print(diff("title", fixture.Rendered.Title, rendered.Title))
+		fmt.Print(diff("description", fixture.Rendered.Description, rendered.Description))
+		fmt.Print(diff("overflow", fixture.Rendered.Overflow, rendered.Overflow))
+		if update {
+			fixture.Rendered = rendered
+			if err := services.SaveReplayFixture(dir, fixture); err != nil {
+				return changed, err
+			}
+		}
+	}
+
+	switch {
+	case changed == 0:
+		fmt.Printf("%d fixtures replayed, no differences\n", len(fixtures))
+	case update:
+		fmt.Printf("%d of %d fixtures differed and were updated\n", changed, len(fixtures))
+	default:
+		fmt.Printf("%d of %d fixtures differ; run with -update to accept the changes\n", changed, len(fixtures))
+	}
+	return changed, nil
+}
+
+// recordFixtures writes a fixture for each of the most recent tickets
+// stored, rendered by the current description builder. Tickets that
+// already have a fixture are skipped, so their recorded output is kept.
+func recordFixtures(dir, uri, db, collection, product string, limit int64, titles *services.TitleTemplate) error {
+	if uri == "" {
+		return fmt.Errorf("-mongo-uri or MONGO_URI is required to record fixtures")
+	}
+	ms, err := services.ConnectMongoDB(uri, db, collection, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	defer ms.Disconnect(ctx)
+
+	var scope services.TicketScope
+	if product != "" {
+		scope.Products = []string{product}
+	}
+	tickets, err := ms.GetTicketsNewestFirst(ctx, services.TicketFilter{Scope: scope}, primitive.ObjectID{}, 0, limit)
+	if err != nil {
+		return err
+	}
+
+	existing, err := services.LoadReplayFixtures(dir)
+	if err != nil {
+		return err
+	}
+	recorded := make(map[string]bool, len(existing))
+	for _, fixture := range existing {
+		recorded[fixture.Name] = true
+	}
+
+	written := 0
+	for i := range tickets {
+		if tickets[i].TicketID == "" || recorded[tickets[i].TicketID] {
+			continue
+		}
+		fixture, err := services.StoredTicketFixture(&tickets[i], titles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipped %s: %v\n", tickets[i].TicketID, err)
+			continue
+		}
+		if err := services.SaveReplayFixture(dir, fixture); err != nil {
+			return err
+		}
+		written++
+	}
+	fmt.Printf("%d fixtures recorded in %s from %d tickets\n", written, dir, len(tickets))
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
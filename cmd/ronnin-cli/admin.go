@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/parvez-capri/ronnin/internal/services"
+)
+
+// runAdminSyncJira refreshes the status, assignee and resolution of every
+// stored ticket from its tracker, which needs an admin key. The sync may
+// take long, so it is not bounded by requestTimeout.
+func runAdminSyncJira(c *apiClient, args []string) int {
+	flags := flag.NewFlagSet("admin sync-jira", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	batchSize := flags.Int("batch-size", 0, "tickets per tracker search, 1 to 100; the server default when 0")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var query url.Values
+	if *batchSize > 0 {
+		query = url.Values{"batchSize": {strconv.Itoa(*batchSize)}}
+	}
+	var report services.TicketSyncReport
+	if err := c.call(context.Background(), http.MethodPost, apiPrefix+"/admin/tickets/sync", query, nil, nil, &report); err != nil {
+		return c.fail("sync tickets", err)
+	}
+
+	if c.output == outputJSON {
+		c.printJSON(report)
+		return 0
+	}
+	fmt.Fprintf(c.stdout, "Scanned %d tickets: %d updated, %d missing, %d failed\n", report.Scanned, report.Updated, report.Missing, report.Failed)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
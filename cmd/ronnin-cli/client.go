@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/client"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// requestTimeout bounds API calls, except exports that stream every ticket
+const requestTimeout = 2 * time.Minute
+
+// apiClient calls the versioned API of a ronnin server
+type apiClient struct {
+	server string
+	apiKey string
+	output string
+	http   *http.Client
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func newAPIClient(server, apiKey, output string, stdout, stderr io.Writer) *apiClient {
+	return &apiClient{
+		server: strings.TrimRight(server, "/"),
+		apiKey: apiKey,
+		output: output,
+		http:   &http.Client{},
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// apiError is an error response of the API
+type apiError struct {
+	status int
+	models.ErrorResponse
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.status, http.StatusText(e.status), e.ErrorResponse.Error)
+	if e.Details != "" {
+		msg += " (" + e.Details + ")"
+	}
+	for _, field := range e.Fields {
+		msg += fmt.Sprintf("\n  %s: %s", field.Field, field.Message)
+	}
+	if e.RequestID != "" {
+		msg += "\n  request ID: " + e.RequestID
+	}
+	return msg
+}
+
+// apiPrefix is the route group of the API version the client speaks
+const apiPrefix = "/api/v1"
+
+// do sends a request to a path of the server and returns the response once
+// it is successful; error responses are returned as *apiError
+func (c *apiClient) do(ctx context.Context, method, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	target := c.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		apiErr := &apiError{status: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if json.Unmarshal(data, &apiErr.ErrorResponse) != nil || apiErr.ErrorResponse.Error == "" {
+			apiErr.ErrorResponse.Error = strings.TrimSpace(string(data))
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// call sends a request and decodes its JSON response into v, unless v is
+// nil
+func (c *apiClient) call(ctx context.Context, method, path string, query url.Values, body io.Reader, header http.Header, v interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// printJSON writes v as indented JSON
+func (c *apiClient) printJSON(v interface{}) {
+	out, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Fprintln(c.stdout, string(out))
+}
+
+// fail prints an error and returns the exit code of failed commands
+func (c *apiClient) fail(action string, err error) int {
+	// Errors of the Go client are printed like the CLI's own
+	var sdkErr *client.Error
+	if errors.As(err, &sdkErr) {
+		apiErr := &apiError{status: sdkErr.StatusCode}
+		apiErr.ErrorResponse = models.ErrorResponse{Error: sdkErr.Message, Code: sdkErr.Code, Details: sdkErr.Details, RequestID: sdkErr.RequestID}
+		for _, field := range sdkErr.Fields {
+			apiErr.Fields = append(apiErr.Fields, models.FieldError(field))
+		}
+		err = apiErr
+	}
+	fmt.Fprintf(c.stderr, "Failed to %s: %v\n", action, err)
+	return 1
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"text/tabwriter"
+)
+
+// check is the outcome of a step of config check
+type check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// runConfigCheck checks that the server is reachable and ready, and which
+// scopes the API key is granted, failing when the server cannot be used
+func runConfigCheck(c *apiClient, args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(c.stderr, "usage: config check")
+		return 2
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	var checks []check
+	ready, err := c.readiness(ctx)
+	if err != nil {
+		checks = append(checks, check{Name: "server", Detail: err.Error()})
+	} else {
+		checks = append(checks, check{Name: "server", OK: true, Detail: c.server})
+		names := make([]string, 0, len(ready.Services))
+		for name := range ready.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			status := ready.Services[name]
+			checks = append(checks, check{Name: name, OK: status == "ok" || status == "disabled", Detail: status})
+		}
+
+		// Reading a ticket needs the read scope, the status the admin scope
+		checks = append(checks,
+			c.scopeCheck(ctx, "read scope", apiPrefix+"/tickets", url.Values{"pageSize": {"1"}}),
+			c.scopeCheck(ctx, "admin scope", apiPrefix+"/admin/status", nil),
+		)
+	}
+
+	failed := false
+	for _, check := range checks {
+		// The admin scope is optional
+		if !check.OK && check.Name != "admin scope" {
+			failed = true
+		}
+	}
+	if c.output == outputJSON {
+		c.printJSON(checks)
+	} else {
+		w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		for _, check := range checks {
+			mark := "ok"
+			if !check.OK {
+				mark = "FAIL"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, mark, check.Detail)
+		}
+		w.Flush()
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// readinessResponse is the response of /readyz
+type readinessResponse struct {
+	Status   string            `json:"status"`
+	Services map[string]string `json:"services"`
+}
+
+// readiness returns the readiness of the server and its dependencies, which
+// is answered with 503 when one is down
+func (c *apiClient) readiness(ctx context.Context) (*readinessResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+"/readyz", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var ready readinessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ready); err != nil {
+		return nil, fmt.Errorf("%s is not a ronnin server: %w", c.server, err)
+	}
+	return &ready, nil
+}
+
+// scopeCheck checks that the API key may call path
+func (c *apiClient) scopeCheck(ctx context.Context, name, path string, query url.Values) check {
+	err := c.call(ctx, http.MethodGet, path, query, nil, nil, nil)
+	var apiErr *apiError
+	switch {
+	case err == nil:
+		return check{Name: name, OK: true, Detail: "granted"}
+	case errors.As(err, &apiErr) && apiErr.status == http.StatusUnauthorized:
+		return check{Name: name, Detail: "API key missing or invalid"}
+	case errors.As(err, &apiErr) && apiErr.status == http.StatusForbidden:
+		return check{Name: name, Detail: "not granted to the API key"}
+	case errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound:
+		return check{Name: name, Detail: "not enabled on the server"}
+	case errors.As(err, &apiErr):
+		return check{Name: name, Detail: fmt.Sprintf("%d %s", apiErr.status, apiErr.ErrorResponse.Error)}
+	default:
+		return check{Name: name, Detail: err.Error()}
+	}
+}
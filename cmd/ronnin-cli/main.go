@@ -0,0 +1,90 @@
+// cmd/ronnin-cli is the command line client of the ronnin API, for scripting
+// operations without curl and jq. It is built as `ronnin`, see `make build`.
+//
+// The server and API key are taken from --server and --api-key, or from
+// RONNIN_URL and RONNIN_API_KEY.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: ronnin [flags] <command> [arguments]
+
+Commands:
+  tickets list [--page-size n] [--all]       list tickets, most recent first
+  tickets get <id>                           print a ticket
+  tickets export [--out file]                export all tickets as NDJSON
+  report create --issue text [--file path]   file a report, with a screenshot
+  admin sync-jira [--batch-size n]           sync ticket states from the trackers
+  config check                               check the server and API key
+
+Flags:
+`
+
+// command runs a command with its arguments and returns the exit code
+type command func(c *apiClient, args []string) int
+
+var commands = map[string]map[string]command{
+	"tickets": {
+		"list":   runTicketsList,
+		"get":    runTicketsGet,
+		"export": runTicketsExport,
+	},
+	"report": {
+		"create": runReportCreate,
+	},
+	"admin": {
+		"sync-jira": runAdminSyncJira,
+	},
+	"config": {
+		"check": runConfigCheck,
+	},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ronnin", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	server := flags.String("server", envOr("RONNIN_URL", "http://localhost:8080"), "URL of the ronnin server")
+	apiKey := flags.String("api-key", os.Getenv("RONNIN_API_KEY"), "API key, or the admin token for admin commands")
+	output := flags.String("output", "table", "output format: table or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != outputTable && *output != outputJSON {
+		fmt.Fprintf(stderr, "unknown output format %q\n", *output)
+		return 2
+	}
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return 2
+	}
+	cmd, ok := commands[flags.Arg(0)][flags.Arg(1)]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", flags.Arg(0)+" "+flags.Arg(1))
+		flags.Usage()
+		return 2
+	}
+
+	client := newAPIClient(*server, *apiKey, *output, stdout, stderr)
+	return cmd(client, flags.Args()[2:])
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
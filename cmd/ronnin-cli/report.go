@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/parvez-capri/ronnin/pkg/client"
+)
+
+// runReportCreate files a report through /report-issue, as the browser SDK
+// does, with an optional screenshot or screen recording
+func runReportCreate(c *apiClient, args []string) int {
+	flags := flag.NewFlagSet("report create", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	fields := []struct{ name, flag, help string }{
+		{"issue", "issue", "issue title (required)"},
+		{"description", "description", "issue description; defaults to the title"},
+		{"userEmail", "email", "email of the reporter"},
+		{"leadId", "lead-id", "lead ID"},
+		{"product", "product", "product name"},
+		{"severity", "severity", "critical, high, medium or low"},
+		{"pageUrl", "page-url", "URL of the page where the issue occurred"},
+	}
+	values := make(map[string]*string, len(fields))
+	for _, field := range fields {
+		values[field.name] = flags.String(field.flag, "", field.help)
+	}
+	file := flags.String("file", "", "screenshot or screen recording to attach")
+	async := flags.Bool("async", false, "queue the report instead of waiting for its ticket")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *values["issue"] == "" {
+		fmt.Fprintln(c.stderr, "usage: report create --issue text [--description text] [--file path] [flags]")
+		return 2
+	}
+	if *values["description"] == "" {
+		*values["description"] = *values["issue"]
+	}
+
+	report := &client.Report{
+		Issue:       *values["issue"],
+		Description: *values["description"],
+		UserEmail:   *values["userEmail"],
+		LeadID:      *values["leadId"],
+		Product:     *values["product"],
+		Severity:    *values["severity"],
+		PageURL:     *values["pageUrl"],
+	}
+	if *file != "" {
+		upload, err := os.Open(*file)
+		if err != nil {
+			return c.fail("file report", err)
+		}
+		defer upload.Close()
+		report.Attachment = upload
+		report.AttachmentName = filepath.Base(*file)
+		report.AttachmentContentType = mime.TypeByExtension(filepath.Ext(*file))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	sdk := client.New(c.server, c.apiKey)
+	sdk.SetHTTPClient(c.http)
+	sdk.SetUserAgent("ronnin-cli")
+	if *async {
+		status, err := sdk.CreateReportAsync(ctx, report)
+		if err != nil {
+			return c.fail("file report", err)
+		}
+		if c.output == outputJSON {
+			c.printJSON(status)
+		} else {
+			fmt.Fprintf(c.stdout, "Report %s %s\n", status.ID, status.Status)
+		}
+		return 0
+	}
+
+	ticket, err := sdk.CreateReport(ctx, report)
+	if err != nil {
+		return c.fail("file report", err)
+	}
+	if c.output == outputJSON {
+		c.printJSON(ticket)
+		return 0
+	}
+	fmt.Fprintf(c.stdout, "%s %s, assigned to %s\n", ticket.TicketID, ticket.Status, ticket.AssignedTo)
+	for _, link := range []string{ticket.JiraLink, ticket.StatusURL} {
+		if link != "" {
+			fmt.Fprintln(c.stdout, link)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/services"
+)
+
+// ticketsPage is a page of GET /tickets; tickets are kept as sent so that
+// JSON output has every field
+type ticketsPage struct {
+	Data       []json.RawMessage `json:"data"`
+	Total      int64             `json:"total"`
+	NextCursor string            `json:"nextCursor"`
+}
+
+// runTicketsList lists a page of tickets, or every page with --all
+func runTicketsList(c *apiClient, args []string) int {
+	flags := flag.NewFlagSet("tickets list", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	page := flags.Int("page", 1, "page number, starting at 1")
+	pageSize := flags.Int("page-size", 50, "tickets per page, at most 200")
+	all := flags.Bool("all", false, "follow the pages to list every ticket")
+	filters := map[string]*string{
+		"browser":        flags.String("browser", "", "only tickets reported from this browser, e.g. Chrome"),
+		"browserVersion": flags.String("browser-version", "", "only tickets reported from this browser version, e.g. 124"),
+		"os":             flags.String("os", "", "only tickets reported from this operating system, e.g. Android"),
+		"osVersion":      flags.String("os-version", "", "only tickets reported from this operating system version, e.g. 14"),
+		"device":         flags.String("device", "", "only tickets reported from this device class: mobile, tablet, desktop or bot"),
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	query := url.Values{"pageSize": {strconv.Itoa(*pageSize)}}
+	if *page > 1 {
+		query.Set("page", strconv.Itoa(*page))
+	}
+	for key, value := range filters {
+		if *value != "" {
+			query.Set(key, *value)
+		}
+	}
+	var tickets []json.RawMessage
+	var total int64
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		var p ticketsPage
+		err := c.call(ctx, http.MethodGet, apiPrefix+"/tickets", query, nil, nil, &p)
+		cancel()
+		if err != nil {
+			return c.fail("list tickets", err)
+		}
+		tickets = append(tickets, p.Data...)
+		total = p.Total
+		if !*all || p.NextCursor == "" {
+			break
+		}
+		query.Del("page")
+		query.Set("cursor", p.NextCursor)
+	}
+
+	if c.output == outputJSON {
+		c.printJSON(tickets)
+		return 0
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TICKET\tSTATUS\tASSIGNEE\tPRODUCT\tCREATED\tISSUE")
+	for _, raw := range tickets {
+		var ticket services.FlattenedTicket
+		if err := json.Unmarshal(raw, &ticket); err != nil {
+			return c.fail("read tickets", err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", ticket.TicketID, ticket.Status, ticket.AssignedTo, ticket.Product,
+			ticket.CreatedAt.Local().Format(time.DateTime), truncate(ticket.Issue, 60))
+	}
+	w.Flush()
+	fmt.Fprintf(c.stderr, "%d of %d tickets\n", len(tickets), total)
+	return 0
+}
+
+// runTicketsGet prints a ticket
+func runTicketsGet(c *apiClient, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(c.stderr, "usage: tickets get <id>")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	var raw json.RawMessage
+	if err := c.call(ctx, http.MethodGet, apiPrefix+"/tickets/"+url.PathEscape(args[0]), nil, nil, nil, &raw); err != nil {
+		return c.fail("get ticket", err)
+	}
+
+	if c.output == outputJSON {
+		c.printJSON(raw)
+		return 0
+	}
+	var ticket services.FlattenedTicket
+	if err := json.Unmarshal(raw, &ticket); err != nil {
+		return c.fail("read ticket", err)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	for _, row := range [][2]string{
+		{"Ticket", ticket.TicketID},
+		{"Link", ticket.JiraLink},
+		{"Status", ticket.Status},
+		{"Resolution", ticket.Resolution},
+		{"Assignee", ticket.AssignedTo},
+		{"Product", ticket.Product},
+		{"Severity", ticket.Severity},
+		{"Reporter", ticket.UserEmail},
+		{"Browser", strings.TrimSpace(ticket.Browser + " " + ticket.BrowserVersion)},
+		{"OS", strings.TrimSpace(ticket.OS + " " + ticket.OSVersion)},
+		{"Device", ticket.Device},
+		{"Page", ticket.PageURL},
+		{"Created", ticket.CreatedAt.Local().Format(time.DateTime)},
+		{"Request ID", ticket.RequestID},
+		{"Issue", ticket.Issue},
+	} {
+		if row[1] != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", row[0], row[1])
+		}
+	}
+	w.Flush()
+	if ticket.Description != "" {
+		fmt.Fprintf(c.stdout, "\n%s\n", ticket.Description)
+	}
+	return 0
+}
+
+// runTicketsExport streams every ticket as NDJSON, one per line, which needs
+// an admin key
+func runTicketsExport(c *apiClient, args []string) int {
+	flags := flag.NewFlagSet("tickets export", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	out := flags.String("out", "", "file to write, instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	resp, err := c.do(context.Background(), http.MethodGet, apiPrefix+"/tickets", nil, nil, http.Header{"Accept": {"application/x-ndjson"}})
+	if err != nil {
+		return c.fail("export tickets", err)
+	}
+	defer resp.Body.Close()
+
+	dst := c.stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return c.fail("export tickets", err)
+		}
+		defer f.Close()
+		dst = f
+	}
+
+	// The stream ends with an error response when the export broke off
+	var last []byte
+	lines := 0
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		if last != nil {
+			if _, err := fmt.Fprintf(dst, "%s\n", last); err != nil {
+				return c.fail("export tickets", err)
+			}
+			lines++
+		}
+		last = append(last[:0], scanner.Bytes()...)
+	}
+	if err := scanner.Err(); err != nil {
+		return c.fail("export tickets", err)
+	}
+	if last != nil {
+		var apiErr apiError
+		if bytes.Contains(last, []byte(`"error"`)) && json.Unmarshal(last, &apiErr.ErrorResponse) == nil && apiErr.ErrorResponse.Error != "" {
+			apiErr.status = resp.StatusCode
+			return c.fail(fmt.Sprintf("export tickets after %d", lines), &apiErr)
+		}
+		if _, err := fmt.Fprintf(dst, "%s\n", last); err != nil {
+			return c.fail("export tickets", err)
+		}
+		lines++
+	}
+	if *out != "" {
+		fmt.Fprintf(c.stderr, "Exported %d tickets to %s\n", lines, *out)
+	}
+	return 0
+}
+
+// truncate shortens s to n runes for table cells
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,9 @@
+package docs
+
+import _ "embed"
+
+// OpenAPI3 is the OpenAPI 3 version of the generated swagger spec, written
+// by cmd/openapi
+//
+//go:embed openapi.json
+var OpenAPI3 []byte
@@ -1,10 +1,20 @@
 package config
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/mitchellh/mapstructure"
+	"github.com/parvez-capri/ronnin/internal/secrets"
 	"github.com/spf13/viper"
 )
 
@@ -13,21 +23,530 @@ type Config struct {
 	Port               int      `mapstructure:"PORT" validate:"required,min=1024,max=65535"`
 	Environment        string   `mapstructure:"ENV" validate:"required,oneof=development staging production"`
 	LogLevel           string   `mapstructure:"LOG_LEVEL" validate:"required,oneof=debug info warn error"`
-	CORSAllowedOrigins []string `mapstructure:"CORS_ALLOWED_ORIGINS" validate:"required,dive,url"`
+	CORSAllowedOrigins []string `mapstructure:"CORS_ALLOWED_ORIGINS" validate:"required,dive,url|eq=*"`
 	DatabaseURL        string   `mapstructure:"DATABASE_URL"`
-	JiraURL            string   `mapstructure:"JIRA_URL" validate:"required,url"`
-	JiraUsername       string   `mapstructure:"JIRA_USERNAME" validate:"required,email"`
-	JiraAPIToken       string   `mapstructure:"JIRA_API_TOKEN" validate:"required"`
-	JiraProjectKey     string   `mapstructure:"JIRA_PROJECT_KEY" validate:"required"`
-	SupportTeamMembers []string `mapstructure:"SUPPORT_TEAM_MEMBERS" validate:"required,dive,min=1"`
+	// Without JIRA_URL, reports are only collected in MongoDB
+	JiraURL            string   `mapstructure:"JIRA_URL" validate:"omitempty,url"`
+	JiraUsername       string   `mapstructure:"JIRA_USERNAME" validate:"required_with=JiraURL,omitempty,email"`
+	JiraAPIToken       string   `mapstructure:"JIRA_API_TOKEN" validate:"required_with=JiraURL"`
+	JiraProjectKey     string   `mapstructure:"JIRA_PROJECT_KEY" validate:"required_with=JiraURL"`
+	SupportTeamMembers []string `mapstructure:"SUPPORT_TEAM_MEMBERS" validate:"dive,min=1"`
 	DefaultPriority    string   `mapstructure:"DEFAULT_PRIORITY" validate:"oneof=Highest High Medium Low Lowest"`
 
+	// Jira Service Management desk and request type the default instance
+	// raises tickets as customer requests of, instead of issues of
+	// JIRA_PROJECT_KEY, which must be the desk's project. Reporters and the
+	// JIRA_REQUEST_PARTICIPANTS account IDs become request participants.
+	JiraServiceDeskID       string   `mapstructure:"JIRA_SERVICE_DESK_ID" validate:"required_with=JiraRequestTypeID"`
+	JiraRequestTypeID       string   `mapstructure:"JIRA_REQUEST_TYPE_ID" validate:"required_with=JiraServiceDeskID"`
+	JiraRequestParticipants []string `mapstructure:"JIRA_REQUEST_PARTICIPANTS"`
+
+	// The failed network calls, request headers, response and payload of
+	// reports are attached to Jira issues as JSON files instead of being
+	// written, cut short, in their description
+	JiraJSONAttachments bool `mapstructure:"JIRA_JSON_ATTACHMENTS"`
+
+	// Browsers may send cookies and HTTP authentication cross-origin, and
+	// cache preflight responses for CORS_MAX_AGE
+	CORSAllowCredentials bool          `mapstructure:"CORS_ALLOW_CREDENTIALS"`
+	CORSMaxAge           time.Duration `mapstructure:"CORS_MAX_AGE" validate:"min=0"`
+
+	// A line is logged per request, for ACCESS_LOG_SAMPLE_RATE of the
+	// successful ones and every failed one, to ACCESS_LOG_SINK: the standard
+	// output, or the file, syslog address or HTTP endpoint of
+	// ACCESS_LOG_TARGET. Request and response bodies, up to
+	// ACCESS_LOG_BODY_LIMIT bytes, are added for debugging when enabled.
+	AccessLog             bool    `mapstructure:"ACCESS_LOG"`
+	AccessLogSampleRate   float64 `mapstructure:"ACCESS_LOG_SAMPLE_RATE" validate:"min=0,max=1"`
+	AccessLogSink         string  `mapstructure:"ACCESS_LOG_SINK" validate:"oneof=stdout file syslog http"`
+	AccessLogTarget       string  `mapstructure:"ACCESS_LOG_TARGET" validate:"required_if=AccessLogSink file,required_if=AccessLogSink http"`
+	AccessLogRequestBody  bool    `mapstructure:"ACCESS_LOG_REQUEST_BODY"`
+	AccessLogResponseBody bool    `mapstructure:"ACCESS_LOG_RESPONSE_BODY"`
+	AccessLogBodyLimit    int     `mapstructure:"ACCESS_LOG_BODY_LIMIT" validate:"min=0"`
+
+	// Support teams by name with their members' shifts, replacing
+	// SUPPORT_TEAM_MEMBERS when set. In the environment they are given as a
+	// JSON object.
+	SupportRoster map[string]RosterTeam `mapstructure:"SUPPORT_ROSTER" validate:"dive"`
+	// API credentials for the on-call schedules of roster teams
+	PagerDutyAPIToken string `mapstructure:"PAGERDUTY_API_TOKEN"`
+	OpsgenieAPIKey    string `mapstructure:"OPSGENIE_API_KEY"`
+
+	// Jira instances besides the default one configured above, by name. In
+	// the environment they are given as a JSON object.
+	JiraInstances map[string]JiraInstance `mapstructure:"JIRA_INSTANCES" validate:"dive"`
+	// GitHub repositories tickets can be created in instead, by name. In the
+	// environment they are given as a JSON object.
+	GitHubTrackers map[string]GitHubTracker `mapstructure:"GITHUB_TRACKERS" validate:"dive"`
+	// GitLab projects tickets can be created in instead, by name. In the
+	// environment they are given as a JSON object.
+	GitLabTrackers map[string]GitLabTracker `mapstructure:"GITLAB_TRACKERS" validate:"dive"`
+	// Linear teams tickets can be created in instead, by name. In the
+	// environment they are given as a JSON object.
+	LinearTrackers map[string]LinearTracker `mapstructure:"LINEAR_TRACKERS" validate:"dive"`
+	// Routing of products to Jira instances and other trackers by name, e.g.
+	// "lending=lending;insurance=insurance"; other products go to the default
+	JiraProductRouting string `mapstructure:"JIRA_PRODUCT_ROUTING"`
+
+	// Chats new tickets are announced in, by name. In the environment they
+	// are given as a JSON object.
+	NotificationRoutes map[string]NotificationRoute `mapstructure:"NOTIFICATION_ROUTES" validate:"dive"`
+
+	// Reporters are emailed a confirmation of their report and assignees the
+	// tickets assigned to them, through an SMTP server or Amazon SES, from
+	// EMAIL_FROM. Templates in EMAIL_TEMPLATES_DIR replace the built-in ones.
+	EmailProvider     string `mapstructure:"EMAIL_PROVIDER" validate:"oneof=none smtp ses"`
+	EmailFrom         string `mapstructure:"EMAIL_FROM" validate:"required_unless=EmailProvider none,omitempty,email"`
+	EmailTemplatesDir string `mapstructure:"EMAIL_TEMPLATES_DIR"`
+	SMTPHost          string `mapstructure:"SMTP_HOST" validate:"required_if=EmailProvider smtp"`
+	SMTPPort          int    `mapstructure:"SMTP_PORT" validate:"min=1,max=65535"`
+	SMTPUsername      string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword      string `mapstructure:"SMTP_PASSWORD" validate:"required_with=SMTPUsername"`
+	// SES region; the default AWS region when empty
+	SESRegion string `mapstructure:"SES_REGION"`
+
+	// Reports with a reporter email also open a customer-visible ticket in
+	// Zendesk or Freshdesk at HELPDESK_URL, linked to the internal ticket;
+	// HELPDESK_PRODUCTS limits them to some products. Zendesk authenticates
+	// the agent HELPDESK_EMAIL with the API token HELPDESK_API_KEY.
+	HelpdeskProvider string   `mapstructure:"HELPDESK_PROVIDER" validate:"oneof=none zendesk freshdesk"`
+	HelpdeskURL      string   `mapstructure:"HELPDESK_URL" validate:"required_unless=HelpdeskProvider none,omitempty,url"`
+	HelpdeskEmail    string   `mapstructure:"HELPDESK_EMAIL" validate:"required_if=HelpdeskProvider zendesk,omitempty,email"`
+	HelpdeskAPIKey   string   `mapstructure:"HELPDESK_API_KEY" validate:"required_unless=HelpdeskProvider none"`
+	HelpdeskProducts []string `mapstructure:"HELPDESK_PRODUCTS"`
+
+	// Subscribers of signed outbound webhooks, by name. Deliveries are
+	// attempted WEBHOOK_MAX_ATTEMPTS times, waiting WEBHOOK_RETRY_BACKOFF
+	// before the first retry and twice as long before each further one.
+	WebhookSubscriptions map[string]WebhookSubscription `mapstructure:"WEBHOOK_SUBSCRIPTIONS" validate:"dive"`
+	WebhookMaxAttempts   int                            `mapstructure:"WEBHOOK_MAX_ATTEMPTS" validate:"min=1"`
+	WebhookRetryBackoff  time.Duration                  `mapstructure:"WEBHOOK_RETRY_BACKOFF" validate:"min=0"`
+
+	// Runbooks linked in new tickets by name, matched by product and failed
+	// endpoint. In the environment they are given as a JSON object. Pages
+	// given by Confluence page ID are looked up at CONFLUENCE_URL, with the
+	// Jira credentials unless CONFLUENCE_USERNAME and CONFLUENCE_API_TOKEN
+	// are set.
+	Runbooks           map[string]Runbook `mapstructure:"RUNBOOKS" validate:"dive"`
+	ConfluenceURL      string             `mapstructure:"CONFLUENCE_URL" validate:"omitempty,url"`
+	ConfluenceUsername string             `mapstructure:"CONFLUENCE_USERNAME"`
+	ConfluenceAPIToken string             `mapstructure:"CONFLUENCE_API_TOKEN"`
+
+	// The deploys of the last DEPLOYS_WINDOW of a product are listed in its
+	// new tickets, from DEPLOYS_SOURCE: none, the deploy metadata API at
+	// DEPLOYS_API_URL, or the GitHub deployments to
+	// DEPLOYS_GITHUB_ENVIRONMENT of the repositories of products, given as a
+	// JSON object in the environment
+	DeploysSource             string            `mapstructure:"DEPLOYS_SOURCE" validate:"oneof=none api github"`
+	DeploysWindow             time.Duration     `mapstructure:"DEPLOYS_WINDOW" validate:"min=1m"`
+	DeploysAPIURL             string            `mapstructure:"DEPLOYS_API_URL" validate:"required_if=DeploysSource api,omitempty,url"`
+	DeploysAPIToken           string            `mapstructure:"DEPLOYS_API_TOKEN"`
+	DeploysGitHubAPIURL       string            `mapstructure:"DEPLOYS_GITHUB_API_URL" validate:"omitempty,url"`
+	DeploysGitHubToken        string            `mapstructure:"DEPLOYS_GITHUB_TOKEN"`
+	DeploysGitHubRepositories map[string]string `mapstructure:"DEPLOYS_GITHUB_REPOSITORIES" validate:"dive,contains=/"`
+	DeploysGitHubEnvironment  string            `mapstructure:"DEPLOYS_GITHUB_ENVIRONMENT"`
+
+	// A Statuspage incident is opened on STATUSPAGE_PAGE_ID, without
+	// notifying subscribers, when a product gets STATUSPAGE_REPORT_THRESHOLD
+	// reports of failed requests to the same endpoint within
+	// STATUSPAGE_REPORT_WINDOW; disabled when STATUSPAGE_API_KEY is empty.
+	// Products are mapped to components like JIRA_PRODUCT_ROUTING, e.g.
+	// "checkout=8kbf7d35c070;lending=0x2y3nz7r1kd".
+	StatuspageAPIKey          string        `mapstructure:"STATUSPAGE_API_KEY"`
+	StatuspagePageID          string        `mapstructure:"STATUSPAGE_PAGE_ID" validate:"required_with=StatuspageAPIKey"`
+	StatuspageComponents      string        `mapstructure:"STATUSPAGE_COMPONENTS"`
+	StatuspageReportThreshold int           `mapstructure:"STATUSPAGE_REPORT_THRESHOLD" validate:"min=1"`
+	StatuspageReportWindow    time.Duration `mapstructure:"STATUSPAGE_REPORT_WINDOW" validate:"min=1m"`
+
+	// New reports are titled and summarized by SUMMARY_MODEL of
+	// SUMMARY_PROVIDER: the OpenAI API, an Azure OpenAI resource at
+	// SUMMARY_URL, where the model is the deployment name, or a self-hosted
+	// OpenAI-compatible API at SUMMARY_URL, e.g. http://llm.internal:8000/v1.
+	// At most SUMMARY_MAX_INPUT_TOKENS of the report are sent.
+	SummaryProvider        string        `mapstructure:"SUMMARY_PROVIDER" validate:"oneof=none openai azure custom"`
+	SummaryURL             string        `mapstructure:"SUMMARY_URL" validate:"required_if=SummaryProvider azure,required_if=SummaryProvider custom,omitempty,url"`
+	SummaryAPIKey          string        `mapstructure:"SUMMARY_API_KEY" validate:"required_if=SummaryProvider openai,required_if=SummaryProvider azure"`
+	SummaryModel           string        `mapstructure:"SUMMARY_MODEL" validate:"required_unless=SummaryProvider none"`
+	SummaryAzureAPIVersion string        `mapstructure:"SUMMARY_AZURE_API_VERSION"`
+	SummaryMaxInputTokens  int           `mapstructure:"SUMMARY_MAX_INPUT_TOKENS" validate:"min=100"`
+	SummaryTimeout         time.Duration `mapstructure:"SUMMARY_TIMEOUT" validate:"min=1s"`
+
+	// New tickets are titled with TICKET_TITLE_TEMPLATE when it is set, e.g.
+	// "[{{product}}] {{issue}} — {{topFailedEndpoint}}", instead of
+	// "Issue Report: {{title}}"
+	TicketTitleTemplate string `mapstructure:"TICKET_TITLE_TEMPLATE"`
+
+	// New reports are given a category and a severity when
+	// CLASSIFIER_ENABLED is set, by CLASSIFIER_RULES by name, checked before
+	// the built-in rules, then by CLASSIFIER_MODEL: llm is the summary model,
+	// api the classification API at CLASSIFIER_API_URL. Categories are routed
+	// to trackers like JIRA_PRODUCT_ROUTING by CLASSIFIER_ROUTING, e.g.
+	// "auth=identity-jira", for products without a route.
+	ClassifierEnabled  bool                      `mapstructure:"CLASSIFIER_ENABLED"`
+	ClassifierRules    map[string]ClassifierRule `mapstructure:"CLASSIFIER_RULES" validate:"dive"`
+	ClassifierModel    string                    `mapstructure:"CLASSIFIER_MODEL" validate:"oneof=none llm api"`
+	ClassifierAPIURL   string                    `mapstructure:"CLASSIFIER_API_URL" validate:"required_if=ClassifierModel api,omitempty,url"`
+	ClassifierAPIToken string                    `mapstructure:"CLASSIFIER_API_TOKEN"`
+	ClassifierRouting  string                    `mapstructure:"CLASSIFIER_ROUTING"`
+
+	// When SIMILAR_TICKETS_ENABLED is set, ticket responses list up to
+	// SIMILAR_TICKETS_LIMIT open tickets of the product from the last
+	// SIMILAR_TICKETS_WINDOW with a text similarity of at least
+	// SIMILAR_TICKETS_THRESHOLD. Needs MongoDB.
+	SimilarTicketsEnabled   bool          `mapstructure:"SIMILAR_TICKETS_ENABLED"`
+	SimilarTicketsWindow    time.Duration `mapstructure:"SIMILAR_TICKETS_WINDOW" validate:"min=1h"`
+	SimilarTicketsThreshold float64       `mapstructure:"SIMILAR_TICKETS_THRESHOLD" validate:"gt=0,lte=1"`
+	SimilarTicketsLimit     int           `mapstructure:"SIMILAR_TICKETS_LIMIT" validate:"min=1,max=10"`
+
+	// Ticket events are published to KAFKA_TOPIC when KAFKA_BROKERS are
+	// given as host:port. KAFKA_TLS_CA_FILE is a PEM bundle trusted besides
+	// the system roots.
+	KafkaBrokers       []string `mapstructure:"KAFKA_BROKERS" validate:"dive,hostname_port"`
+	KafkaTopic         string   `mapstructure:"KAFKA_TOPIC" validate:"required_with=KafkaBrokers"`
+	KafkaClientID      string   `mapstructure:"KAFKA_CLIENT_ID"`
+	KafkaTLS           bool     `mapstructure:"KAFKA_TLS"`
+	KafkaTLSCAFile     string   `mapstructure:"KAFKA_TLS_CA_FILE" validate:"omitempty,file"`
+	KafkaSASLMechanism string   `mapstructure:"KAFKA_SASL_MECHANISM" validate:"oneof=none plain scram-sha-256 scram-sha-512"`
+	KafkaUsername      string   `mapstructure:"KAFKA_USERNAME" validate:"required_unless=KafkaSASLMechanism none"`
+	KafkaPassword      string   `mapstructure:"KAFKA_PASSWORD" validate:"required_unless=KafkaSASLMechanism none"`
+
+	// Object storage backend: s3, gcs, azure, minio or local
+	StorageBackend string `mapstructure:"STORAGE_BACKEND" validate:"oneof=s3 gcs azure minio local"`
+
 	// S3 Configuration
-	AWSS3AccessKey  string `mapstructure:"AWS_S3_ACCESS_KEY"`
-	AWSS3SecretKey  string `mapstructure:"AWS_S3_SECRET_KEY"`
-	AWSS3Region     string `mapstructure:"AWS_S3_REGION" validate:"required_with=AWSS3AccessKey"`
-	AWSS3BucketName string `mapstructure:"AWS_S3_BUCKET_NAME" validate:"required_with=AWSS3AccessKey"`
-	AWSS3BaseURL    string `mapstructure:"AWS_S3_BASE_URL"`
+	// Static keys are optional; without them the default AWS credential chain
+	// (env, shared config, IRSA, IMDS) is used
+	AWSS3AccessKey    string `mapstructure:"AWS_S3_ACCESS_KEY" validate:"required_with=AWSS3SecretKey"`
+	AWSS3SecretKey    string `mapstructure:"AWS_S3_SECRET_KEY" validate:"required_with=AWSS3AccessKey"`
+	AWSS3Region       string `mapstructure:"AWS_S3_REGION" validate:"required_with=AWSS3AccessKey"`
+	AWSS3BucketName   string `mapstructure:"AWS_S3_BUCKET_NAME" validate:"required_with=AWSS3AccessKey"`
+	AWSS3BaseURL      string `mapstructure:"AWS_S3_BASE_URL"`
+	AWSS3Endpoint     string `mapstructure:"AWS_S3_ENDPOINT" validate:"omitempty,url"`
+	AWSS3UsePathStyle bool   `mapstructure:"AWS_S3_USE_PATH_STYLE"`
+
+	// Server-side encryption for S3 uploads: empty, AES256 (SSE-S3) or aws:kms (SSE-KMS)
+	AWSS3SSE         string `mapstructure:"AWS_S3_SSE" validate:"omitempty,oneof=AES256 aws:kms"`
+	AWSS3SSEKMSKeyID string `mapstructure:"AWS_S3_SSE_KMS_KEY_ID"`
+
+	// Template for upload object key prefixes, e.g. uploads/ronnin/{{.Environment}}/{{.Product}}/{{.Date}}/
+	StorageKeyPrefixTemplate string `mapstructure:"STORAGE_KEY_PREFIX_TEMPLATE"`
+
+	// Google Cloud Storage Configuration (HMAC keys for the XML API)
+	GCSHMACAccessID string `mapstructure:"GCS_HMAC_ACCESS_ID"`
+	GCSHMACSecret   string `mapstructure:"GCS_HMAC_SECRET"`
+	GCSBucketName   string `mapstructure:"GCS_BUCKET_NAME"`
+
+	// Azure Blob Storage Configuration
+	AzureStorageAccount   string `mapstructure:"AZURE_STORAGE_ACCOUNT"`
+	AzureStorageKey       string `mapstructure:"AZURE_STORAGE_KEY"`
+	AzureStorageContainer string `mapstructure:"AZURE_STORAGE_CONTAINER"`
+	AzureStorageEndpoint  string `mapstructure:"AZURE_STORAGE_ENDPOINT"`
+
+	// MinIO Configuration
+	MinIOEndpoint   string `mapstructure:"MINIO_ENDPOINT"`
+	MinIOAccessKey  string `mapstructure:"MINIO_ACCESS_KEY"`
+	MinIOSecretKey  string `mapstructure:"MINIO_SECRET_KEY"`
+	MinIORegion     string `mapstructure:"MINIO_REGION"`
+	MinIOBucketName string `mapstructure:"MINIO_BUCKET_NAME"`
+
+	// Local filesystem storage Configuration (development only)
+	LocalStorageDir     string `mapstructure:"LOCAL_STORAGE_DIR"`
+	LocalStorageBaseURL string `mapstructure:"LOCAL_STORAGE_BASE_URL"`
+	// LocalStorageServe serves the stored files at /local-storage without
+	// authentication, tenant or quarantine checks; refused in production
+	LocalStorageServe bool `mapstructure:"LOCAL_STORAGE_SERVE"`
+
+	// Direct client uploads via presigned PUT URLs
+	PresignUploadExpiry       time.Duration `mapstructure:"PRESIGN_UPLOAD_EXPIRY" validate:"min=0"`
+	UploadAllowedContentTypes []string      `mapstructure:"UPLOAD_ALLOWED_CONTENT_TYPES"`
+
+	// Resumable upload sessions are staged on local disk until completed;
+	// an empty directory disables them
+	UploadSessionDir string        `mapstructure:"UPLOAD_SESSION_DIR"`
+	UploadSessionTTL time.Duration `mapstructure:"UPLOAD_SESSION_TTL" validate:"min=0"`
+
+	// Asynchronous report submission; a zero queue size disables it
+	ReportQueueWorkers int           `mapstructure:"REPORT_QUEUE_WORKERS" validate:"min=1"`
+	ReportQueueSize    int           `mapstructure:"REPORT_QUEUE_SIZE" validate:"min=0"`
+	ReportStatusTTL    time.Duration `mapstructure:"REPORT_STATUS_TTL" validate:"min=0"`
+
+	// Reports unfinished on shutdown are saved here and resumed on startup;
+	// they are dropped when empty
+	ReportCheckpointDir string `mapstructure:"REPORT_CHECKPOINT_DIR"`
+
+	// Asynchronous reports go through SQS or RabbitMQ instead of the memory
+	// queue when REPORT_QUEUE_BACKEND says so, to be processed by any
+	// instance. Failed reports are retried after REPORT_RETRY_BACKOFF,
+	// doubling every attempt, and dead-lettered after REPORT_MAX_ATTEMPTS.
+	ReportQueueBackend      string        `mapstructure:"REPORT_QUEUE_BACKEND" validate:"oneof=memory sqs rabbitmq"`
+	ReportMaxAttempts       int           `mapstructure:"REPORT_MAX_ATTEMPTS" validate:"min=1"`
+	ReportRetryBackoff      time.Duration `mapstructure:"REPORT_RETRY_BACKOFF" validate:"min=0"`
+	ReportSQSQueueURL       string        `mapstructure:"REPORT_SQS_QUEUE_URL" validate:"required_if=ReportQueueBackend sqs,omitempty,url"`
+	ReportSQSDeadLetterURL  string        `mapstructure:"REPORT_SQS_DLQ_URL" validate:"required_if=ReportQueueBackend sqs,omitempty,url"`
+	ReportSQSRegion         string        `mapstructure:"REPORT_SQS_REGION"`
+	ReportVisibilityTimeout time.Duration `mapstructure:"REPORT_SQS_VISIBILITY_TIMEOUT" validate:"min=0"`
+	RabbitMQURL             string        `mapstructure:"RABBITMQ_URL" validate:"required_if=ReportQueueBackend rabbitmq,omitempty,url"`
+	ReportRabbitMQQueue     string        `mapstructure:"REPORT_RABBITMQ_QUEUE" validate:"required_if=ReportQueueBackend rabbitmq"`
+	ReportRabbitMQDLQ       string        `mapstructure:"REPORT_RABBITMQ_DLQ" validate:"required_if=ReportQueueBackend rabbitmq"`
+
+	// Calls to issue trackers and object storage run in worker pools of
+	// *_POOL_SIZE workers (0 disables a pool); calls beyond them wait in a
+	// queue of *_POOL_QUEUE for up to WORKER_POOL_MAX_WAIT and are shed with
+	// 503 once it is full
+	TrackerPoolSize   int           `mapstructure:"TRACKER_POOL_SIZE" validate:"min=0"`
+	TrackerPoolQueue  int           `mapstructure:"TRACKER_POOL_QUEUE" validate:"min=0"`
+	StoragePoolSize   int           `mapstructure:"STORAGE_POOL_SIZE" validate:"min=0"`
+	StoragePoolQueue  int           `mapstructure:"STORAGE_POOL_QUEUE" validate:"min=0"`
+	WorkerPoolMaxWait time.Duration `mapstructure:"WORKER_POOL_MAX_WAIT" validate:"min=0"`
+
+	// Once LOAD_SHED_MAX_IN_FLIGHT requests are served at once (0 disables
+	// load shedding), further requests get 429. Low and normal priority
+	// requests are shed earlier, beyond their share of the maximum.
+	LoadShedMaxInFlight int     `mapstructure:"LOAD_SHED_MAX_IN_FLIGHT" validate:"min=0"`
+	LoadShedLowShare    float64 `mapstructure:"LOAD_SHED_LOW_SHARE" validate:"gt=0,lte=1"`
+	LoadShedNormalShare float64 `mapstructure:"LOAD_SHED_NORMAL_SHARE" validate:"gt=0,lte=1"`
+
+	// High-volume mode adds reports of a failure that got a ticket within
+	// REPORT_COALESCE_WINDOW to that ticket. They are stored in MongoDB in
+	// bulk and counted in one comment per ticket every REPORT_FLUSH_INTERVAL.
+	HighVolumeMode       bool          `mapstructure:"HIGH_VOLUME_MODE"`
+	ReportFlushInterval  time.Duration `mapstructure:"REPORT_FLUSH_INTERVAL" validate:"min=1s"`
+	ReportCoalesceWindow time.Duration `mapstructure:"REPORT_COALESCE_WINDOW" validate:"min=1s"`
+
+	// Once a failure is reported more than FLOOD_CONTROL_THRESHOLD times
+	// within an hour (0 disables flood control), further reports are counted
+	// on its latest ticket, which gets a single storm comment.
+	FloodControlThreshold int `mapstructure:"FLOOD_CONTROL_THRESHOLD" validate:"min=0"`
+
+	// Request body limits in bytes (0 disables a limit). Report submissions and
+	// upload chunks carry files and get the larger upload limit; multipart
+	// files beyond MaxMultipartMemory are spooled to temporary files.
+	MaxBodySize        int64 `mapstructure:"MAX_BODY_SIZE" validate:"min=0"`
+	MaxUploadBodySize  int64 `mapstructure:"MAX_UPLOAD_BODY_SIZE" validate:"min=0"`
+	MaxMultipartMemory int64 `mapstructure:"MAX_MULTIPART_MEMORY" validate:"min=0"`
+
+	// Maximum size of mp4/webm screen recordings in bytes (0 disables the limit)
+	VideoMaxUploadSize int64 `mapstructure:"VIDEO_MAX_UPLOAD_SIZE" validate:"min=0"`
+
+	// Report fields required per product in addition to issue and
+	// description, e.g. "lending=leadId,userEmail;insurance=userEmail"
+	ProductRequiredFields string `mapstructure:"PRODUCT_REQUIRED_FIELDS"`
+
+	// Validation of requests against the OpenAPI spec: off, log or enforce
+	OpenAPIValidation string `mapstructure:"OPENAPI_VALIDATION" validate:"oneof=off log enforce"`
+
+	// Compression of responses of at least the minimum size in bytes
+	ResponseCompression        bool `mapstructure:"RESPONSE_COMPRESSION"`
+	ResponseCompressionMinSize int  `mapstructure:"RESPONSE_COMPRESSION_MIN_SIZE" validate:"min=0"`
+
+	// Time each dependency gets to answer a readiness check
+	ReadinessTimeout time.Duration `mapstructure:"READINESS_TIMEOUT" validate:"min=0"`
+	// Dependencies are also checked in the background each interval to keep
+	// their health metrics current; 0 disables it
+	HealthCheckInterval time.Duration `mapstructure:"HEALTH_CHECK_INTERVAL" validate:"min=0"`
+
+	// HTTP server timeouts; uploads of large recordings need generous read/write timeouts
+	HTTPReadTimeout  time.Duration `mapstructure:"HTTP_READ_TIMEOUT" validate:"min=0"`
+	HTTPWriteTimeout time.Duration `mapstructure:"HTTP_WRITE_TIMEOUT" validate:"min=0"`
+
+	// Time each call to a dependency gets, including the wait for its worker
+	// pool (0 leaves it unbounded), so a slow dependency cannot hold a
+	// request past HTTP_WRITE_TIMEOUT
+	TrackerTimeout time.Duration `mapstructure:"TRACKER_TIMEOUT" validate:"min=0"`
+	StorageTimeout time.Duration `mapstructure:"STORAGE_TIMEOUT" validate:"min=0"`
+	MongoTimeout   time.Duration `mapstructure:"MONGO_TIMEOUT" validate:"min=0"`
+
+	// Time shutdown gets to finish requests and drain background work
+	ShutdownTimeout time.Duration `mapstructure:"SHUTDOWN_TIMEOUT" validate:"min=0"`
+
+	// Malware scanning of uploads before they are stored
+	ScannerBackend  string        `mapstructure:"SCANNER_BACKEND" validate:"oneof=none clamav http"`
+	ClamAVAddress   string        `mapstructure:"CLAMAV_ADDRESS"`
+	ScannerAPIURL   string        `mapstructure:"SCANNER_API_URL" validate:"omitempty,url"`
+	ScannerAPIKey   string        `mapstructure:"SCANNER_API_KEY"`
+	ScannerTimeout  time.Duration `mapstructure:"SCANNER_TIMEOUT" validate:"min=0"`
+	ScannerFailOpen bool          `mapstructure:"SCANNER_FAIL_OPEN"`
+
+	// Suspicious uploads are stored under this prefix until reviewed
+	QuarantineKeyPrefix string `mapstructure:"QUARANTINE_KEY_PREFIX"`
+
+	// Date (YYYY-MM-DD) after which the deprecated unversioned routes are
+	// removed, advertised in the Sunset header of their responses
+	LegacyRoutesSunset string `mapstructure:"LEGACY_ROUTES_SUNSET" validate:"omitempty,datetime=2006-01-02"`
+
+	// Bearer token for the /admin endpoints; admin routes are disabled when
+	// empty unless API_KEYS has keys
+	AdminAPIToken string `mapstructure:"ADMIN_API_TOKEN"`
+
+	// Go profiling endpoints under /admin/debug/pprof, for admins only
+	AdminPprof bool `mapstructure:"ADMIN_PPROF"`
+
+	// Web dashboard of tickets under /ui, served when the admin API is
+	Dashboard bool `mapstructure:"DASHBOARD"`
+
+	// Embeddable report widget under /widget.js and /widget/report
+	Widget bool `mapstructure:"WIDGET"`
+
+	// Requests taking at least this long are logged with the time spent per
+	// stage; 0 disables the slow request log
+	SlowRequestThreshold time.Duration `mapstructure:"SLOW_REQUEST_THRESHOLD" validate:"min=0"`
+
+	// API keys by name with their scopes, in addition to those created
+	// through the admin API. In the environment they are given as a JSON
+	// object. With API_KEY_AUTH the report and ticket endpoints require a key.
+	APIKeys    map[string]APIKey `mapstructure:"API_KEYS" validate:"dive"`
+	APIKeyAuth bool              `mapstructure:"API_KEY_AUTH"`
+
+	// Mutating API requests and attachment downloads are recorded in the
+	// audit_log collection when MongoDB is configured, unless AUDIT_LOG is
+	// false
+	AuditLog bool `mapstructure:"AUDIT_LOG"`
+
+	// Report intake is limited per client to RATE_LIMIT_REQUESTS per
+	// RATE_LIMIT_PERIOD in bursts of up to RATE_LIMIT_BURST; 0 requests
+	// disables it. The redis backend shares limits across instances.
+	RateLimitRequests  int           `mapstructure:"RATE_LIMIT_REQUESTS" validate:"min=0"`
+	RateLimitPeriod    time.Duration `mapstructure:"RATE_LIMIT_PERIOD" validate:"min=1s"`
+	RateLimitBurst     int           `mapstructure:"RATE_LIMIT_BURST" validate:"min=1"`
+	RateLimitBackend   string        `mapstructure:"RATE_LIMIT_BACKEND" validate:"oneof=memory redis"`
+	RateLimitAllowlist []string      `mapstructure:"RATE_LIMIT_ALLOWLIST"`
+	RedisURL           string        `mapstructure:"REDIS_URL" validate:"required_if=RateLimitBackend redis,omitempty,url"`
+
+	// Reports without an API key must carry a CAPTCHA token of the provider
+	// or a proof of work of POW_DIFFICULTY bits; none disables it
+	ReportVerification string  `mapstructure:"REPORT_VERIFICATION" validate:"oneof=none recaptcha hcaptcha turnstile pow"`
+	CaptchaSecret      string  `mapstructure:"CAPTCHA_SECRET"`
+	CaptchaMinScore    float64 `mapstructure:"CAPTCHA_MIN_SCORE" validate:"min=0,max=1"`
+	PowDifficulty      int     `mapstructure:"POW_DIFFICULTY" validate:"min=1,max=32"`
+
+	// Reports are described with the reporter's browser, device and locale
+	// from the User-Agent, client hints and the SDK's X-Client-* headers
+	ClientInfo bool `mapstructure:"CLIENT_INFO"`
+
+	// Sensitive data is removed from reports before they are written to
+	// Jira, MongoDB, object storage or logs: values of REDACT_HEADERS, matches
+	// of the REDACT_DETECTORS (none disables them) and of REDACTION_RULES,
+	// given by name as a JSON object in the environment
+	RedactHeaders   []string                 `mapstructure:"REDACT_HEADERS"`
+	RedactDetectors []string                 `mapstructure:"REDACT_DETECTORS" validate:"dive,oneof=card aadhaar pan bearer jwt none"`
+	RedactionRules  map[string]RedactionRule `mapstructure:"REDACTION_RULES" validate:"dive"`
+
+	// Proxies whose X-Forwarded-For header is trusted for the client IP;
+	// none is trusted when empty, and the peer address is the client IP
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
+
+	// Headers the client IP is taken from, in order, on requests from a
+	// trusted proxy; AWS load balancers set X-Forwarded-For
+	ClientIPHeaders []string `mapstructure:"CLIENT_IP_HEADERS"`
+
+	// The admin, metrics and ticket endpoints refuse clients on their
+	// deny-list and, when their allow-list has entries, clients not on it.
+	// Entries are IPs or CIDR ranges.
+	AdminIPAllowlist   []string `mapstructure:"ADMIN_IP_ALLOWLIST"`
+	AdminIPDenylist    []string `mapstructure:"ADMIN_IP_DENYLIST"`
+	MetricsIPAllowlist []string `mapstructure:"METRICS_IP_ALLOWLIST"`
+	MetricsIPDenylist  []string `mapstructure:"METRICS_IP_DENYLIST"`
+	TicketsIPAllowlist []string `mapstructure:"TICKETS_IP_ALLOWLIST"`
+	TicketsIPDenylist  []string `mapstructure:"TICKETS_IP_DENYLIST"`
+
+	// Security headers on every response; HSTS is sent on HTTPS requests
+	// for HSTS_MAX_AGE, and 0 disables it
+	SecurityHeaders bool          `mapstructure:"SECURITY_HEADERS"`
+	HSTSMaxAge      time.Duration `mapstructure:"HSTS_MAX_AGE" validate:"min=0"`
+
+	// OpenID Connect provider whose bearer tokens are accepted on the ticket
+	// and admin endpoints, which then require authentication. Signing keys
+	// come from OIDC_JWKS_URL or the issuer's discovery document. Roles in
+	// OIDC_ROLES_CLAIM grant the scopes they map to in OIDC_ROLE_SCOPES,
+	// given as a JSON object in the environment. Products listed in
+	// OIDC_PRODUCTS_CLAIM limit non-admin callers to their tickets.
+	OIDCIssuerURL     string              `mapstructure:"OIDC_ISSUER_URL" validate:"omitempty,url"`
+	OIDCAudience      string              `mapstructure:"OIDC_AUDIENCE" validate:"required_with=OIDCIssuerURL"`
+	OIDCJWKSURL       string              `mapstructure:"OIDC_JWKS_URL" validate:"omitempty,url"`
+	OIDCRolesClaim    string              `mapstructure:"OIDC_ROLES_CLAIM"`
+	OIDCRoleScopes    map[string][]string `mapstructure:"OIDC_ROLE_SCOPES" validate:"dive,dive,oneof=report read write admin"`
+	OIDCProductsClaim string              `mapstructure:"OIDC_PRODUCTS_CLAIM"`
+
+	// Bearer token for JSON ticket creation via /create-ticket, which is
+	// disabled when empty
+	TicketAPIToken string `mapstructure:"TICKET_API_TOKEN"`
+
+	// Public key of the DSN Sentry SDKs send events with; Sentry intake is
+	// disabled when empty
+	SentryIntakeKey string `mapstructure:"SENTRY_INTAKE_KEY"`
+
+	// Bearer token Alertmanager webhooks are sent with; Alertmanager intake
+	// is disabled when empty, and needs MongoDB to deduplicate alerts
+	AlertmanagerToken string `mapstructure:"ALERTMANAGER_TOKEN"`
+
+	// DSN of the Sentry project ronnin's own panics and 5xx responses are
+	// reported to, tagged with SENTRY_RELEASE; disabled when empty
+	SentryDSN     string `mapstructure:"SENTRY_DSN" validate:"omitempty,url"`
+	SentryRelease string `mapstructure:"SENTRY_RELEASE"`
+
+	// Shared secret Jira webhooks are signed with; the webhook receiver is
+	// disabled when empty. Webhooks sent more than WebhookTolerance before or
+	// after they arrive are rejected.
+	JiraWebhookSecret string        `mapstructure:"JIRA_WEBHOOK_SECRET"`
+	WebhookTolerance  time.Duration `mapstructure:"WEBHOOK_TOLERANCE" validate:"min=1s"`
+
+	// Signing key of the reporter status page links returned with new
+	// reports; the status page is disabled when empty
+	StatusTokenSecret string        `mapstructure:"STATUS_TOKEN_SECRET"`
+	StatusTokenTTL    time.Duration `mapstructure:"STATUS_TOKEN_TTL" validate:"min=0"`
+	StatusPageBaseURL string        `mapstructure:"STATUS_PAGE_BASE_URL"`
+
+	// Presigned URL configuration
+	PresignURLExpiry   time.Duration `mapstructure:"PRESIGN_URL_EXPIRY" validate:"min=0,max=168h"`
+	URLResignInterval  time.Duration `mapstructure:"URL_RESIGN_INTERVAL" validate:"min=0"`
+	URLResignThreshold time.Duration `mapstructure:"URL_RESIGN_THRESHOLD" validate:"min=0"`
+
+	// Ticket retention; tickets older than the period are deleted or archived
+	// together with their stored objects. A zero period disables retention.
+	TicketRetentionPeriod time.Duration `mapstructure:"TICKET_RETENTION_PERIOD" validate:"min=0"`
+	TicketRetentionAction string        `mapstructure:"TICKET_RETENTION_ACTION" validate:"oneof=delete archive"`
+	RetentionObjectAction string        `mapstructure:"RETENTION_OBJECT_ACTION" validate:"oneof=delete archive"`
+	RetentionInterval     time.Duration `mapstructure:"RETENTION_INTERVAL" validate:"min=0"`
+
+	// Tickets collected without an issue tracker are numbered under
+	// COLLECTOR_PROJECT_KEY and, every COLLECTOR_EXPORT_INTERVAL (0 disables
+	// it), filed in the trackers their products are routed to once there are
+	CollectorProjectKey     string        `mapstructure:"COLLECTOR_PROJECT_KEY" validate:"required,alphanum"`
+	CollectorExportInterval time.Duration `mapstructure:"COLLECTOR_EXPORT_INTERVAL" validate:"min=0"`
+
+	// Self-contained mode for local development: tickets are filed in a mock
+	// tracker kept in a file under DATA_DIR, uploads are stored there too, and
+	// MongoDB, object storage and Jira are not used
+	Embedded bool   `mapstructure:"EMBEDDED"`
+	DataDir  string `mapstructure:"DATA_DIR" validate:"required_if=Embedded true"`
+
+	// TRACKER=mock files tickets in a sandbox tracker kept in MongoDB instead
+	// of Jira, numbered under MOCK_PROJECT_KEY, for integration tests
+	Tracker        string `mapstructure:"TRACKER" validate:"oneof=jira mock"`
+	MockProjectKey string `mapstructure:"MOCK_PROJECT_KEY" validate:"required,alphanum"`
+
+	// Ticket states are synced from the trackers every TICKET_SYNC_INTERVAL,
+	// to catch up on missed webhooks (0 disables it)
+	TicketSyncInterval time.Duration `mapstructure:"TICKET_SYNC_INTERVAL" validate:"min=0"`
+
+	// Leader election through leases in MongoDB, so that scheduled jobs run
+	// on one of several replicas. The leader renews its lease every third of
+	// LEADER_LEASE_TTL; INSTANCE_ID names the replica in leases and defaults
+	// to the host name with a random suffix.
+	LeaderElection bool          `mapstructure:"LEADER_ELECTION"`
+	LeaderLeaseTTL time.Duration `mapstructure:"LEADER_LEASE_TTL" validate:"min=3s"`
+	InstanceID     string        `mapstructure:"INSTANCE_ID"`
+
+	// Secrets manager holding credentials: none, aws, vault or gcp. The
+	// secret is a JSON object keyed by the names of SecretKeys and takes
+	// precedence over the environment.
+	SecretsProvider        string        `mapstructure:"SECRETS_PROVIDER" validate:"oneof=none aws vault gcp"`
+	SecretsName            string        `mapstructure:"SECRETS_NAME"`
+	SecretsRefreshInterval time.Duration `mapstructure:"SECRETS_REFRESH_INTERVAL" validate:"min=0"`
+	VaultAddress           string        `mapstructure:"VAULT_ADDR"`
+	VaultToken             string        `mapstructure:"VAULT_TOKEN"`
+	VaultKVMount           string        `mapstructure:"VAULT_KV_MOUNT"`
+	GCPProject             string        `mapstructure:"GCP_PROJECT"`
 
 	// MongoDB Configuration
 	MongoURI        string `mapstructure:"MONGO_URI"`
@@ -35,14 +554,332 @@ type Config struct {
 	MongoCollection string `mapstructure:"MONGO_COLLECTION"`
 }
 
-func Load() (*Config, error) {
+// Options select where the configuration is loaded from besides the
+// environment and .env
+type Options struct {
+	// File is a YAML file of settings keyed like the environment variables.
+	// Its profiles section holds settings per environment that override the
+	// top-level ones, e.g. profiles.production.LOG_LEVEL.
+	File string
+
+	// Flags are settings given on the command line, which override every
+	// other source
+	Flags map[string]string
+}
+
+// JiraInstance is the connection to an additional Jira site
+type JiraInstance struct {
+	URL        string `mapstructure:"url" yaml:"url" validate:"required,url"`
+	Username   string `mapstructure:"username" yaml:"username" validate:"required,email"`
+	APIToken   string `mapstructure:"api_token" yaml:"api_token" validate:"required"`
+	ProjectKey string `mapstructure:"project_key" yaml:"project_key" validate:"required"`
+	// Jira Service Management desk and request type, as for the default
+	// instance
+	ServiceDeskID       string   `mapstructure:"service_desk_id" yaml:"service_desk_id,omitempty" validate:"required_with=RequestTypeID"`
+	RequestTypeID       string   `mapstructure:"request_type_id" yaml:"request_type_id,omitempty" validate:"required_with=ServiceDeskID"`
+	RequestParticipants []string `mapstructure:"request_participants" yaml:"request_participants,omitempty"`
+}
+
+// GitHubTracker is a repository of GITHUB_TRACKERS. Its tickets are named
+// by its project key and issue number, e.g. WEB-42.
+type GitHubTracker struct {
+	Repository string   `mapstructure:"repository" yaml:"repository" validate:"required,contains=/"`
+	Token      string   `mapstructure:"token" yaml:"token" validate:"required"`
+	ProjectKey string   `mapstructure:"project_key" yaml:"project_key" validate:"required,alphanum"`
+	APIURL     string   `mapstructure:"api_url" yaml:"api_url,omitempty" validate:"omitempty,url"`
+	Labels     []string `mapstructure:"labels" yaml:"labels,omitempty"`
+	// Branch screenshots are committed to so issues can show them
+	AttachmentsBranch string `mapstructure:"attachments_branch" yaml:"attachments_branch,omitempty"`
+}
+
+// GitLabTracker is a project of GITLAB_TRACKERS. Its tickets are named by
+// its project key and issue IID, e.g. WEB-42. The project is given by ID or
+// full path, e.g. group/project.
+type GitLabTracker struct {
+	URL        string   `mapstructure:"url" yaml:"url" validate:"required,url"`
+	Project    string   `mapstructure:"project" yaml:"project" validate:"required"`
+	Token      string   `mapstructure:"token" yaml:"token" validate:"required"`
+	ProjectKey string   `mapstructure:"project_key" yaml:"project_key" validate:"required,alphanum"`
+	Labels     []string `mapstructure:"labels" yaml:"labels,omitempty"`
+	// Confidential issues are only visible to project members
+	Confidential bool `mapstructure:"confidential" yaml:"confidential,omitempty"`
+}
+
+// LinearTracker is a team of LINEAR_TRACKERS. Its tickets are Linear's issue
+// identifiers, which start with the team key, e.g. ENG-42.
+type LinearTracker struct {
+	APIKey  string   `mapstructure:"api_key" yaml:"api_key" validate:"required"`
+	TeamKey string   `mapstructure:"team_key" yaml:"team_key" validate:"required,alphanum"`
+	APIURL  string   `mapstructure:"api_url" yaml:"api_url,omitempty" validate:"omitempty,url"`
+	Labels  []string `mapstructure:"labels" yaml:"labels,omitempty"`
+}
+
+// APIKey is a key of API_KEYS, given as the hex-encoded SHA-256 hash of the
+// key so the configuration holds no usable credential
+type APIKey struct {
+	Hash   string   `mapstructure:"hash" yaml:"hash" validate:"required,len=64,hexadecimal"`
+	Scopes []string `mapstructure:"scopes" yaml:"scopes" validate:"required,dive,oneof=report read write admin"`
+	// Products limits the key to the tickets of these products
+	Products []string `mapstructure:"products" yaml:"products,omitempty"`
+}
+
+// RedactionRule is a rule of REDACTION_RULES, replacing either the matches
+// of a regular expression or the values selected by a JSONPath
+type RedactionRule struct {
+	Pattern     string `mapstructure:"pattern" yaml:"pattern,omitempty" validate:"required_without=Path"`
+	Path        string `mapstructure:"path" yaml:"path,omitempty" validate:"excluded_with=Pattern,omitempty,startswith=$"`
+	Replacement string `mapstructure:"replacement" yaml:"replacement,omitempty"`
+}
+
+// NotificationRoute is a route of NOTIFICATION_ROUTES, announcing the new
+// tickets of some products and severities; empty lists match every ticket
+type NotificationRoute struct {
+	Provider   string   `mapstructure:"provider" yaml:"provider" validate:"required,oneof=teams googlechat"`
+	WebhookURL string   `mapstructure:"webhook_url" yaml:"webhook_url" validate:"required,url"`
+	Products   []string `mapstructure:"products" yaml:"products,omitempty"`
+	Severities []string `mapstructure:"severities" yaml:"severities,omitempty" validate:"dive,oneof=critical high medium low"`
+}
+
+// WebhookSubscription is a subscriber of WEBHOOK_SUBSCRIPTIONS, sent the
+// events it lists for the products it lists; empty lists match every event
+type WebhookSubscription struct {
+	URL      string   `mapstructure:"url" yaml:"url" validate:"required,url"`
+	Secret   string   `mapstructure:"secret" yaml:"secret" validate:"required"`
+	Events   []string `mapstructure:"events" yaml:"events,omitempty" validate:"dive,oneof=ticket.created ticket.updated report.failed"`
+	Products []string `mapstructure:"products" yaml:"products,omitempty"`
+}
+
+// Runbook is a triage page of RUNBOOKS, linked in tickets of its products
+// that failed on one of its endpoints; empty lists match everything. The page
+// is a URL or a Confluence page ID.
+type Runbook struct {
+	Title     string   `mapstructure:"title" yaml:"title,omitempty"`
+	URL       string   `mapstructure:"url" yaml:"url,omitempty" validate:"required_without=PageID,omitempty,url"`
+	PageID    string   `mapstructure:"pageId" yaml:"pageId,omitempty"`
+	Products  []string `mapstructure:"products" yaml:"products,omitempty" validate:"required_without=Endpoints"`
+	Endpoints []string `mapstructure:"endpoints" yaml:"endpoints,omitempty"`
+}
+
+// ClassifierRule is a rule of CLASSIFIER_RULES, giving its category and
+// severity to reports containing one of its keywords or with a failed call
+// answered with one of its statuses, codes like 401 or classes like 5xx
+type ClassifierRule struct {
+	Category string   `mapstructure:"category" yaml:"category,omitempty" validate:"required_without=Severity,omitempty,oneof=ui-bug api-failure auth performance"`
+	Severity string   `mapstructure:"severity" yaml:"severity,omitempty" validate:"omitempty,oneof=critical high medium low"`
+	Keywords []string `mapstructure:"keywords" yaml:"keywords,omitempty" validate:"required_without=Statuses"`
+	Statuses []string `mapstructure:"statuses" yaml:"statuses,omitempty"`
+}
+
+// RosterTeam is a support team of SUPPORT_ROSTER
+type RosterTeam struct {
+	// Products handled by the team; a team without products handles the rest
+	Products []string `mapstructure:"products" yaml:"products,omitempty"`
+	// On-call schedule as pagerduty:<id> or opsgenie:<id>
+	Schedule string         `mapstructure:"schedule" yaml:"schedule,omitempty"`
+	Members  []RosterMember `mapstructure:"members" yaml:"members" validate:"required,dive"`
+}
+
+// RosterMember is a member of a support team. Members without hours are
+// always on shift.
+type RosterMember struct {
+	AccountID string   `mapstructure:"account_id" yaml:"account_id" validate:"required"`
+	Email     string   `mapstructure:"email" yaml:"email,omitempty" validate:"omitempty,email"`
+	GitHub    string   `mapstructure:"github" yaml:"github,omitempty"`
+	GitLab    string   `mapstructure:"gitlab" yaml:"gitlab,omitempty"`
+	Timezone  string   `mapstructure:"timezone" yaml:"timezone,omitempty"`
+	Hours     string   `mapstructure:"hours" yaml:"hours,omitempty"`
+	Days      []string `mapstructure:"days" yaml:"days,omitempty"`
+}
+
+// Load reads the configuration. Each source overrides the previous one:
+// defaults, the configuration file, its profile for the environment, .env,
+// environment variables and command-line flags.
+func Load(opts Options) (*Config, error) {
+	// Start from scratch, so settings removed since the last load are dropped
+	viper.Reset()
+
 	// Set default values
 	viper.SetDefault("PORT", 8080)
 	viper.SetDefault("ENV", "development")
 	viper.SetDefault("LOG_LEVEL", "info")
 	viper.SetDefault("CORS_ALLOWED_ORIGINS", []string{"http://localhost:8080"})
+	viper.SetDefault("CORS_MAX_AGE", "10m")
 	viper.SetDefault("ENVIRONMENT", "development")
 
+	// Every request, without bodies
+	viper.SetDefault("ACCESS_LOG", true)
+	viper.SetDefault("ACCESS_LOG_SAMPLE_RATE", 1)
+	viper.SetDefault("ACCESS_LOG_SINK", "stdout")
+	viper.SetDefault("ACCESS_LOG_REQUEST_BODY", false)
+	viper.SetDefault("ACCESS_LOG_RESPONSE_BODY", false)
+	viper.SetDefault("ACCESS_LOG_BODY_LIMIT", 4096)
+
+	viper.SetDefault("JIRA_JSON_ATTACHMENTS", false)
+
+	// Only the default Jira instance unless more are configured
+	viper.SetDefault("JIRA_INSTANCES", "")
+	viper.SetDefault("GITHUB_TRACKERS", "")
+	viper.SetDefault("GITLAB_TRACKERS", "")
+	viper.SetDefault("LINEAR_TRACKERS", "")
+	viper.SetDefault("NOTIFICATION_ROUTES", "")
+	viper.SetDefault("EMAIL_PROVIDER", "none")
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("HELPDESK_PROVIDER", "none")
+	viper.SetDefault("WEBHOOK_SUBSCRIPTIONS", "")
+	viper.SetDefault("RUNBOOKS", "")
+	viper.SetDefault("DEPLOYS_SOURCE", "none")
+	viper.SetDefault("DEPLOYS_WINDOW", "2h")
+	viper.SetDefault("DEPLOYS_GITHUB_REPOSITORIES", "")
+	viper.SetDefault("DEPLOYS_GITHUB_ENVIRONMENT", "production")
+	viper.SetDefault("STATUSPAGE_REPORT_THRESHOLD", 5)
+	viper.SetDefault("STATUSPAGE_REPORT_WINDOW", "10m")
+	viper.SetDefault("SUMMARY_PROVIDER", "none")
+	viper.SetDefault("SUMMARY_MODEL", "gpt-4o-mini")
+	viper.SetDefault("SUMMARY_AZURE_API_VERSION", "2024-06-01")
+	viper.SetDefault("SUMMARY_MAX_INPUT_TOKENS", 2000)
+	viper.SetDefault("SUMMARY_TIMEOUT", "15s")
+	viper.SetDefault("TICKET_TITLE_TEMPLATE", "")
+	viper.SetDefault("CLASSIFIER_RULES", "")
+	viper.SetDefault("CLASSIFIER_MODEL", "none")
+	viper.SetDefault("SIMILAR_TICKETS_WINDOW", "168h")
+	viper.SetDefault("SIMILAR_TICKETS_THRESHOLD", 0.5)
+	viper.SetDefault("SIMILAR_TICKETS_LIMIT", 3)
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 5)
+	viper.SetDefault("WEBHOOK_RETRY_BACKOFF", "30s")
+	viper.SetDefault("KAFKA_CLIENT_ID", "ronnin")
+	viper.SetDefault("KAFKA_TLS", false)
+	viper.SetDefault("KAFKA_SASL_MECHANISM", "none")
+	viper.SetDefault("SUPPORT_ROSTER", "")
+	viper.SetDefault("API_KEYS", "")
+	viper.SetDefault("AUDIT_LOG", true)
+	viper.SetDefault("CLIENT_INFO", false)
+	viper.SetDefault("ADMIN_PPROF", false)
+	viper.SetDefault("DASHBOARD", true)
+	viper.SetDefault("WIDGET", true)
+	viper.SetDefault("SLOW_REQUEST_THRESHOLD", "0s")
+	viper.SetDefault("OIDC_ROLES_CLAIM", "roles")
+	viper.SetDefault("OIDC_PRODUCTS_CLAIM", "products")
+
+	// Generous enough for people reporting by hand
+	viper.SetDefault("RATE_LIMIT_REQUESTS", 60)
+	viper.SetDefault("RATE_LIMIT_PERIOD", "1m")
+	viper.SetDefault("RATE_LIMIT_BURST", 20)
+	viper.SetDefault("RATE_LIMIT_BACKEND", "memory")
+
+	// Reports need no CAPTCHA unless a provider is configured
+	viper.SetDefault("REPORT_VERIFICATION", "none")
+	viper.SetDefault("CAPTCHA_MIN_SCORE", 0.5)
+	viper.SetDefault("POW_DIFFICULTY", 20)
+	viper.SetDefault("OIDC_ROLE_SCOPES", "")
+
+	// Where load balancers and reverse proxies put the client IP
+	viper.SetDefault("CLIENT_IP_HEADERS", []string{"X-Forwarded-For", "X-Real-IP"})
+
+	// Browsers are told to stay on HTTPS for a year
+	viper.SetDefault("SECURITY_HEADERS", true)
+	viper.SetDefault("HSTS_MAX_AGE", "8760h")
+
+	// Allows for clock skew and delivery retries without widening the window
+	// for replays much
+	viper.SetDefault("WEBHOOK_TOLERANCE", "5m")
+
+	// Credentials and identity numbers never leave the service
+	viper.SetDefault("REDACT_HEADERS", []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-API-Key", "X-Auth-Token", "X-CSRF-Token"})
+	viper.SetDefault("REDACT_DETECTORS", []string{"card", "aadhaar", "pan", "bearer", "jwt"})
+	viper.SetDefault("REDACTION_RULES", "")
+
+	// Object storage defaults
+	viper.SetDefault("STORAGE_BACKEND", "s3")
+	viper.SetDefault("STORAGE_KEY_PREFIX_TEMPLATE", "uploads/ronnin/")
+	viper.SetDefault("LOCAL_STORAGE_DIR", "./data/uploads")
+	viper.SetDefault("LOCAL_STORAGE_BASE_URL", "http://localhost:8080/local-storage")
+
+	// Presigned upload URLs are short-lived
+	viper.SetDefault("PRESIGN_UPLOAD_EXPIRY", "15m")
+	viper.SetDefault("UPLOAD_ALLOWED_CONTENT_TYPES", []string{"image/png", "image/jpeg", "image/gif", "image/webp", "video/mp4", "video/webm"})
+	viper.SetDefault("VIDEO_MAX_UPLOAD_SIZE", 200<<20)
+	viper.SetDefault("MAX_BODY_SIZE", 1<<20)
+	viper.SetDefault("MAX_UPLOAD_BODY_SIZE", 210<<20)
+	viper.SetDefault("MAX_MULTIPART_MEMORY", 8<<20)
+	viper.SetDefault("UPLOAD_SESSION_DIR", "./data/upload-sessions")
+	viper.SetDefault("UPLOAD_SESSION_TTL", "24h")
+	viper.SetDefault("REPORT_QUEUE_WORKERS", 4)
+	viper.SetDefault("REPORT_QUEUE_SIZE", 100)
+	viper.SetDefault("REPORT_STATUS_TTL", "1h")
+	viper.SetDefault("REPORT_CHECKPOINT_DIR", "./data/report-checkpoints")
+	viper.SetDefault("REPORT_QUEUE_BACKEND", "memory")
+	viper.SetDefault("REPORT_MAX_ATTEMPTS", 5)
+	viper.SetDefault("REPORT_RETRY_BACKOFF", "1m")
+	viper.SetDefault("REPORT_SQS_VISIBILITY_TIMEOUT", "5m")
+	viper.SetDefault("REPORT_RABBITMQ_QUEUE", "ronnin.reports")
+	viper.SetDefault("REPORT_RABBITMQ_DLQ", "ronnin.reports.dead")
+	viper.SetDefault("TRACKER_POOL_SIZE", 10)
+	viper.SetDefault("TRACKER_POOL_QUEUE", 100)
+	viper.SetDefault("STORAGE_POOL_SIZE", 20)
+	viper.SetDefault("STORAGE_POOL_QUEUE", 200)
+	viper.SetDefault("WORKER_POOL_MAX_WAIT", "10s")
+	viper.SetDefault("LOAD_SHED_MAX_IN_FLIGHT", 500)
+	viper.SetDefault("LOAD_SHED_LOW_SHARE", 0.5)
+	viper.SetDefault("LOAD_SHED_NORMAL_SHARE", 0.8)
+	viper.SetDefault("HIGH_VOLUME_MODE", false)
+	viper.SetDefault("REPORT_FLUSH_INTERVAL", "5m")
+	viper.SetDefault("REPORT_COALESCE_WINDOW", "1h")
+	viper.SetDefault("FLOOD_CONTROL_THRESHOLD", 0)
+	viper.SetDefault("OPENAPI_VALIDATION", "log")
+	viper.SetDefault("RESPONSE_COMPRESSION", true)
+	viper.SetDefault("RESPONSE_COMPRESSION_MIN_SIZE", 1024)
+	viper.SetDefault("READINESS_TIMEOUT", "2s")
+	viper.SetDefault("HEALTH_CHECK_INTERVAL", "30s")
+	viper.SetDefault("HTTP_READ_TIMEOUT", "5m")
+	viper.SetDefault("HTTP_WRITE_TIMEOUT", "5m")
+	viper.SetDefault("TRACKER_TIMEOUT", "30s")
+	viper.SetDefault("STORAGE_TIMEOUT", "2m")
+	viper.SetDefault("MONGO_TIMEOUT", "10s")
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "30s")
+
+	// Uploads are not scanned unless a scanner is configured; scan errors reject the upload
+	viper.SetDefault("SCANNER_BACKEND", "none")
+	viper.SetDefault("CLAMAV_ADDRESS", "tcp://localhost:3310")
+	viper.SetDefault("SCANNER_TIMEOUT", "30s")
+	viper.SetDefault("SCANNER_FAIL_OPEN", false)
+	viper.SetDefault("QUARANTINE_KEY_PREFIX", "quarantine/")
+
+	// Reporter status page links are valid for 30 days
+	viper.SetDefault("STATUS_TOKEN_TTL", "720h")
+	viper.SetDefault("STATUS_PAGE_BASE_URL", "http://localhost:8080/api/v1/my-reports")
+
+	// Presigned URLs are valid for at most 7 days and are re-signed a day before expiry
+	viper.SetDefault("PRESIGN_URL_EXPIRY", "168h")
+	viper.SetDefault("URL_RESIGN_INTERVAL", "6h")
+	viper.SetDefault("URL_RESIGN_THRESHOLD", "24h")
+
+	// Tickets are kept forever unless a retention period is set
+	viper.SetDefault("TICKET_RETENTION_PERIOD", "0")
+	viper.SetDefault("TICKET_RETENTION_ACTION", "archive")
+	viper.SetDefault("RETENTION_OBJECT_ACTION", "delete")
+	viper.SetDefault("RETENTION_INTERVAL", "24h")
+
+	// Collected tickets are only exported when an interval is set
+	viper.SetDefault("COLLECTOR_PROJECT_KEY", "RPT")
+	viper.SetDefault("COLLECTOR_EXPORT_INTERVAL", "0")
+	viper.SetDefault("TRACKER", "jira")
+	viper.SetDefault("MOCK_PROJECT_KEY", "MOCK")
+
+	// Ticket states are only synced on demand, and every replica runs the
+	// scheduled jobs unless leader election is enabled
+	viper.SetDefault("TICKET_SYNC_INTERVAL", "0")
+	viper.SetDefault("LEADER_ELECTION", false)
+	viper.SetDefault("LEADER_LEASE_TTL", "30s")
+
+	// Credentials come from the environment unless a secrets manager is set
+	viper.SetDefault("SECRETS_PROVIDER", secrets.ProviderNone)
+	viper.SetDefault("SECRETS_REFRESH_INTERVAL", "1h")
+	viper.SetDefault("VAULT_KV_MOUNT", "secret")
+
+	// Self-contained mode keeps everything under ./data
+	viper.SetDefault("EMBEDDED", false)
+	viper.SetDefault("DATA_DIR", "./data")
+
 	// Default MongoDB values for local development
 	viper.SetDefault("MONGO_URI", "mongodb://localhost:27017")
 	viper.SetDefault("MONGO_DB", "ronnin")
@@ -56,13 +893,27 @@ func Load() (*Config, error) {
 
 	// Read config file
 	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok && !os.IsNotExist(err) {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
 	}
 
+	for key, value := range opts.Flags {
+		viper.Set(key, value)
+	}
+
+	if opts.File != "" {
+		if err := loadFile(opts.File); err != nil {
+			return nil, err
+		}
+	}
+
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := viper.Unmarshal(&cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		jsonObjectHook,
+	))); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
@@ -76,11 +927,319 @@ func Load() (*Config, error) {
 		cfg.SupportTeamMembers = strings.Split(teamMembers, ",")
 	}
 
+	// Handle UPLOAD_ALLOWED_CONTENT_TYPES as comma-separated string
+	if contentTypes := viper.GetString("UPLOAD_ALLOWED_CONTENT_TYPES"); contentTypes != "" {
+		cfg.UploadAllowedContentTypes = strings.Split(contentTypes, ",")
+	}
+
+	// Credentials from a secrets manager override the environment
+	if cfg.SecretsProvider != secrets.ProviderNone && cfg.SecretsProvider != "" {
+		if err := cfg.loadSecrets(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Self-contained mode replaces every external dependency with files
+	if cfg.Embedded {
+		cfg.applyEmbedded()
+	}
+
+	// The mock tracker replaces the default Jira site
+	if cfg.Tracker == "mock" {
+		cfg.JiraURL = ""
+	}
+
 	// Validate config
 	validate := validator.New()
 	if err := validate.Struct(&cfg); err != nil {
 		return nil, fmt.Errorf("validation failed: %w", err)
 	}
+	if cfg.Tracker == "mock" && (cfg.MongoURI == "" || cfg.Embedded) {
+		return nil, fmt.Errorf("validation failed: MONGO_URI is required for TRACKER=mock, which cannot be used in self-contained mode")
+	}
+	if cfg.JiraURL == "" && cfg.MongoURI == "" && !cfg.Embedded {
+		return nil, fmt.Errorf("validation failed: MONGO_URI is required to collect reports without JIRA_URL")
+	}
+	if len(cfg.SupportTeamMembers) == 0 && len(cfg.SupportRoster) == 0 {
+		return nil, fmt.Errorf("validation failed: SUPPORT_TEAM_MEMBERS or SUPPORT_ROSTER is required")
+	}
+	for name, runbook := range cfg.Runbooks {
+		if runbook.URL == "" && cfg.ConfluenceURL == "" {
+			return nil, fmt.Errorf("validation failed: CONFLUENCE_URL is required for the Confluence page of runbook %s", name)
+		}
+	}
+	if cfg.DeploysSource == "github" && len(cfg.DeploysGitHubRepositories) == 0 {
+		return nil, fmt.Errorf("validation failed: DEPLOYS_GITHUB_REPOSITORIES is required for DEPLOYS_SOURCE=github")
+	}
+	if cfg.ClassifierModel == "llm" && cfg.SummaryProvider == "none" {
+		return nil, fmt.Errorf("validation failed: SUMMARY_PROVIDER is required for CLASSIFIER_MODEL=llm")
+	}
+	if cfg.CORSAllowCredentials && slices.Contains(cfg.CORSAllowedOrigins, "*") {
+		return nil, fmt.Errorf("validation failed: CORS_ALLOW_CREDENTIALS cannot be used with CORS_ALLOWED_ORIGINS=*")
+	}
+	if cfg.ReportVerification != "none" && cfg.ReportVerification != "pow" && cfg.CaptchaSecret == "" {
+		return nil, fmt.Errorf("validation failed: CAPTCHA_SECRET is required for REPORT_VERIFICATION=%s", cfg.ReportVerification)
+	}
+	if cfg.LoadShedLowShare > cfg.LoadShedNormalShare {
+		return nil, fmt.Errorf("validation failed: LOAD_SHED_LOW_SHARE cannot exceed LOAD_SHED_NORMAL_SHARE")
+	}
+	for _, dependency := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"TRACKER_TIMEOUT", cfg.TrackerTimeout},
+		{"STORAGE_TIMEOUT", cfg.StorageTimeout},
+		{"MONGO_TIMEOUT", cfg.MongoTimeout},
+	} {
+		if cfg.HTTPWriteTimeout > 0 && dependency.timeout >= cfg.HTTPWriteTimeout {
+			return nil, fmt.Errorf("validation failed: %s must be shorter than HTTP_WRITE_TIMEOUT", dependency.name)
+		}
+	}
 
 	return &cfg, nil
 }
+
+// jsonObjectHook decodes maps given as JSON objects in strings, as they are
+// in environment variables
+func jsonObjectHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || to.Kind() != reflect.Map {
+		return data, nil
+	}
+	value := strings.TrimSpace(data.(string))
+	if value == "" {
+		return map[string]interface{}{}, nil
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return nil, fmt.Errorf("expected a JSON object: %w", err)
+	}
+	return object, nil
+}
+
+// loadFile reads a YAML configuration file. Its settings replace the
+// defaults, so .env, the environment and flags still override them.
+func loadFile(path string) error {
+	file := viper.New()
+	file.SetConfigFile(path)
+	file.SetConfigType("yaml")
+	if err := file.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	settings := file.AllSettings()
+	profiles, _ := settings["profiles"].(map[string]interface{})
+	delete(settings, "profiles")
+	for key, value := range settings {
+		viper.SetDefault(key, value)
+	}
+
+	// The environment may itself come from any source, the file included
+	environment := viper.GetString("ENV")
+	if profile, ok := profiles[strings.ToLower(environment)]; ok {
+		settings, ok := profile.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("failed to read config file %s: profile %s is not a map of settings", path, environment)
+		}
+		for key, value := range settings {
+			viper.SetDefault(key, value)
+		}
+	}
+	return nil
+}
+
+// SecretKeys are the settings that can be loaded from a secrets manager
+var SecretKeys = []string{"JIRA_API_TOKEN", "AWS_S3_ACCESS_KEY", "AWS_S3_SECRET_KEY", "MONGO_URI"}
+
+// NewSecretsProvider creates the client of the configured secrets manager
+func (c *Config) NewSecretsProvider(ctx context.Context) (secrets.Provider, error) {
+	return secrets.New(ctx, c.SecretsProvider, secrets.Options{
+		Name:         c.SecretsName,
+		AWSRegion:    c.AWSS3Region,
+		VaultAddress: c.VaultAddress,
+		VaultToken:   c.VaultToken,
+		VaultMount:   c.VaultKVMount,
+		GCPProject:   c.GCPProject,
+	})
+}
+
+// ApplySecrets sets the settings named by SecretKeys from a fetched secret
+// and returns the names of those that changed
+func (c *Config) ApplySecrets(values map[string]string) []string {
+	fields := map[string]*string{
+		"JIRA_API_TOKEN":    &c.JiraAPIToken,
+		"AWS_S3_ACCESS_KEY": &c.AWSS3AccessKey,
+		"AWS_S3_SECRET_KEY": &c.AWSS3SecretKey,
+		"MONGO_URI":         &c.MongoURI,
+	}
+
+	var changed []string
+	for _, key := range SecretKeys {
+		value, ok := values[key]
+		if !ok || value == *fields[key] {
+			continue
+		}
+		*fields[key] = value
+		changed = append(changed, key)
+	}
+	return changed
+}
+
+func (c *Config) loadSecrets() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	provider, err := c.NewSecretsProvider(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize secrets provider: %w", err)
+	}
+	values, err := provider.Fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
+	}
+	c.ApplySecrets(values)
+	return nil
+}
+
+// applyEmbedded turns off MongoDB and Jira and keeps uploads, upload
+// sessions and report checkpoints under the data directory, so that the
+// server runs without any external dependency
+func (c *Config) applyEmbedded() {
+	c.JiraURL = ""
+	c.MongoURI = ""
+	c.StorageBackend = "local"
+	c.LocalStorageDir = filepath.Join(c.DataDir, "uploads")
+	c.UploadSessionDir = filepath.Join(c.DataDir, "upload-sessions")
+	c.ReportCheckpointDir = filepath.Join(c.DataDir, "report-checkpoints")
+	if c.DefaultPriority == "" {
+		c.DefaultPriority = "Medium"
+	}
+	// Tickets need someone to be assigned to
+	if len(c.SupportTeamMembers) == 0 && len(c.SupportRoster) == 0 {
+		c.SupportTeamMembers = []string{"developer"}
+	}
+}
+
+// sensitiveSettings are masked when the configuration is printed. Connection
+// URLs only have their password masked.
+var sensitiveSettings = map[string]bool{
+	"DATABASE_URL":         true,
+	"JIRA_API_TOKEN":       true,
+	"AWS_S3_ACCESS_KEY":    true,
+	"AWS_S3_SECRET_KEY":    true,
+	"GCS_HMAC_SECRET":      true,
+	"AZURE_STORAGE_KEY":    true,
+	"MINIO_SECRET_KEY":     true,
+	"SCANNER_API_KEY":      true,
+	"ADMIN_API_TOKEN":      true,
+	"TICKET_API_TOKEN":     true,
+	"SENTRY_INTAKE_KEY":    true,
+	"ALERTMANAGER_TOKEN":   true,
+	"SENTRY_DSN":           true,
+	"JIRA_WEBHOOK_SECRET":  true,
+	"STATUS_TOKEN_SECRET":  true,
+	"VAULT_TOKEN":          true,
+	"PAGERDUTY_API_TOKEN":  true,
+	"SMTP_PASSWORD":        true,
+	"HELPDESK_API_KEY":     true,
+	"KAFKA_PASSWORD":       true,
+	"RABBITMQ_URL":         true,
+	"CONFLUENCE_API_TOKEN": true,
+	"DEPLOYS_API_TOKEN":    true,
+	"DEPLOYS_GITHUB_TOKEN": true,
+	"STATUSPAGE_API_KEY":   true,
+	"SUMMARY_API_KEY":      true,
+	"CLASSIFIER_API_TOKEN": true,
+	"OPSGENIE_API_KEY":     true,
+	"REDIS_URL":            true,
+	"CAPTCHA_SECRET":       true,
+	"MONGO_URI":            true,
+}
+
+// redactedValue replaces sensitive settings in printed configurations
+const redactedValue = "REDACTED"
+
+// Redacted returns the settings by name with credentials masked, for
+// printing the effective configuration
+func (c *Config) Redacted() map[string]interface{} {
+	settings := make(map[string]interface{})
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key := value.Type().Field(i).Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+
+		switch field := value.Field(i).Interface().(type) {
+		case time.Duration:
+			settings[key] = field.String()
+		case map[string]JiraInstance:
+			instances := make(map[string]JiraInstance, len(field))
+			for name, instance := range field {
+				instance.APIToken = redact(instance.APIToken)
+				instances[name] = instance
+			}
+			settings[key] = instances
+		case map[string]GitHubTracker:
+			trackers := make(map[string]GitHubTracker, len(field))
+			for name, tracker := range field {
+				tracker.Token = redact(tracker.Token)
+				trackers[name] = tracker
+			}
+			settings[key] = trackers
+		case map[string]GitLabTracker:
+			trackers := make(map[string]GitLabTracker, len(field))
+			for name, tracker := range field {
+				tracker.Token = redact(tracker.Token)
+				trackers[name] = tracker
+			}
+			settings[key] = trackers
+		case map[string]LinearTracker:
+			trackers := make(map[string]LinearTracker, len(field))
+			for name, tracker := range field {
+				tracker.APIKey = redact(tracker.APIKey)
+				trackers[name] = tracker
+			}
+			settings[key] = trackers
+		case map[string]NotificationRoute:
+			// Webhook URLs carry their credential in the path or query
+			routes := make(map[string]NotificationRoute, len(field))
+			for name, route := range field {
+				route.WebhookURL = redactedValue
+				routes[name] = route
+			}
+			settings[key] = routes
+		case map[string]WebhookSubscription:
+			subscriptions := make(map[string]WebhookSubscription, len(field))
+			for name, subscription := range field {
+				subscription.Secret = redact(subscription.Secret)
+				subscriptions[name] = subscription
+			}
+			settings[key] = subscriptions
+		case string:
+			if sensitiveSettings[key] {
+				field = redact(field)
+			}
+			settings[key] = field
+		default:
+			settings[key] = field
+		}
+	}
+	return settings
+}
+
+// redact masks a credential, or only the password of a connection URL
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+		if u.User == nil {
+			return value
+		}
+	}
+	return redactedValue
+}
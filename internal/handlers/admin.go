@@ -0,0 +1,1904 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/parvez-capri/ronnin/internal/middleware"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// defaultRotateWindow is how far ahead URL rotation and the backlog status
+// look for expiring screenshot URLs unless a window is given
+const defaultRotateWindow = 24 * time.Hour
+
+// Number of tickets looked up per Jira search when syncing ticket states
+const (
+	defaultSyncBatchSize = 50
+	maxSyncBatchSize     = 100
+)
+
+type AdminHandler struct {
+	jiraService  *services.JiraRegistry
+	mongoService *services.MongoDBService
+	quarantine   *services.QuarantineService
+	resigner     *services.URLResigner
+	retention    *services.RetentionJob
+	queue        *services.ReportQueue
+	apiKeys      *services.APIKeyStore
+	logger       *zap.Logger
+	audit        *zap.Logger
+	validate     *validator.Validate
+
+	// syncing allows only one bulk ticket sync at a time
+	syncing sync.Mutex
+
+	// listeners are told of changes to the state of tickets made by syncs
+	// and reassignments
+	listeners []services.TicketStateListener
+	// webhooks replays failed outbound webhook deliveries; nil when no
+	// subscriptions are configured
+	webhooks *services.WebhookDispatcher
+	// coordinator locks ticket syncs across instances; nil when leader
+	// election is disabled
+	coordinator *services.Coordinator
+	// maintenance turns report submission away or queues it
+	maintenance *services.Maintenance
+	// mockTracker is the tracker of TRACKER=mock; nil otherwise
+	mockTracker *services.MockTracker
+	// tenants are the business units served; nil without MongoDB
+	tenants *services.Tenants
+	// products are the products registered with their routing; nil
+	// without MongoDB
+	products *services.Products
+}
+
+func NewAdminHandler(js *services.JiraRegistry, ms *services.MongoDBService, quarantine *services.QuarantineService, resigner *services.URLResigner, retention *services.RetentionJob, queue *services.ReportQueue, apiKeys *services.APIKeyStore, log *zap.Logger, validate *validator.Validate) *AdminHandler {
+	return &AdminHandler{
+		jiraService:  js,
+		mongoService: ms,
+		quarantine:   quarantine,
+		resigner:     resigner,
+		retention:    retention,
+		queue:        queue,
+		apiKeys:      apiKeys,
+		logger:       log,
+		audit:        log.Named("audit"),
+		validate:     validate,
+	}
+}
+
+// OnTicketStateChange adds a listener told of the ticket state changes made
+// by syncs and reassignments
+func (h *AdminHandler) OnTicketStateChange(listener services.TicketStateListener) {
+	h.listeners = append(h.listeners, listener)
+}
+
+// SetWebhooks sets the dispatcher whose failed deliveries are listed and
+// replayed
+func (h *AdminHandler) SetWebhooks(webhooks *services.WebhookDispatcher) {
+	h.webhooks = webhooks
+}
+
+// SetMaintenance sets the maintenance mode of report submission
+func (h *AdminHandler) SetMaintenance(maintenance *services.Maintenance) {
+	h.maintenance = maintenance
+}
+
+// SetMockTracker sets the mock tracker whose tickets are listed
+func (h *AdminHandler) SetMockTracker(tracker *services.MockTracker) {
+	h.mockTracker = tracker
+}
+
+// SetTenants sets the tenants managed through the admin API
+func (h *AdminHandler) SetTenants(tenants *services.Tenants) {
+	h.tenants = tenants
+}
+
+// SetProducts sets the products registered through the admin API
+func (h *AdminHandler) SetProducts(products *services.Products) {
+	h.products = products
+}
+
+// SetCoordinator sets the coordinator that keeps ticket syncs from running
+// on several instances at once
+func (h *AdminHandler) SetCoordinator(coordinator *services.Coordinator) {
+	h.coordinator = coordinator
+}
+
+// stateChanged tells the listeners of a change to the state of a ticket
+func (h *AdminHandler) stateChanged(ticket *services.FlattenedTicket, state *services.TicketState) {
+	for _, listener := range h.listeners {
+		listener(ticket, state)
+	}
+}
+
+// ListQuarantine godoc
+// @Summary      List quarantined attachments
+// @Description  Returns the tickets whose attachment was flagged by the malware scanner and is pending review, one page at a time
+// @Tags         admin
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]services.FlattenedTicket}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Quarantine is not available"
+// @Router       /admin/quarantine [get]
+func (h *AdminHandler) ListQuarantine(c *gin.Context) {
+	if h.quarantine == nil {
+		h.quarantineUnavailable(c)
+		return
+	}
+
+	tickets, err := h.quarantine.ListQuarantined(c.Request.Context())
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to list quarantined attachments", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to list quarantined attachments",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	writeList(c, tickets)
+}
+
+// ApproveQuarantine godoc
+// @Summary      Release a quarantined attachment
+// @Description  Moves a quarantined attachment back to the upload prefix and embeds it in the Jira ticket
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Ticket ID"
+// @Success      200  {object}  services.FlattenedTicket
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Ticket not found"
+// @Failure      409  {object}  models.ErrorResponse "Ticket has no quarantined attachment"
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/quarantine/{id}/approve [post]
+func (h *AdminHandler) ApproveQuarantine(c *gin.Context) {
+	if h.quarantine == nil {
+		h.quarantineUnavailable(c)
+		return
+	}
+
+	ticketID := c.Param("id")
+	ticket, err := h.quarantine.Approve(h.jiraService.TicketContext(c.Request.Context(), ticketID), ticketID, c.ClientIP())
+	if err != nil {
+		h.quarantineError(c, ticketID, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// PurgeQuarantine godoc
+// @Summary      Purge a quarantined attachment
+// @Description  Deletes a quarantined attachment and notes its removal on the Jira ticket
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Ticket ID"
+// @Success      204
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Ticket not found"
+// @Failure      409  {object}  models.ErrorResponse "Ticket has no quarantined attachment"
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/quarantine/{id} [delete]
+func (h *AdminHandler) PurgeQuarantine(c *gin.Context) {
+	if h.quarantine == nil {
+		h.quarantineUnavailable(c)
+		return
+	}
+
+	ticketID := c.Param("id")
+	if err := h.quarantine.Purge(h.jiraService.TicketContext(c.Request.Context(), ticketID), ticketID, c.ClientIP()); err != nil {
+		h.quarantineError(c, ticketID, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// quarantineError maps quarantine review errors to responses
+func (h *AdminHandler) quarantineError(c *gin.Context, ticketID string, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotQuarantined):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Ticket has no quarantined attachment",
+			Details: err.Error(),
+		})
+	case strings.Contains(err.Error(), "not found"):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Ticket not found",
+			Details: err.Error(),
+		})
+	default:
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to review quarantined attachment", zap.Error(err), zap.String("ticket_id", ticketID))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to review quarantined attachment",
+			Details: err.Error(),
+		})
+	}
+}
+
+func (h *AdminHandler) quarantineUnavailable(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+		Error:   "Quarantine not available",
+		Details: "Object storage is not configured",
+	})
+}
+
+// GetStatus godoc
+// @Summary      Get background work backlog
+// @Description  Returns the state of the asynchronous report queue, the number of attachments awaiting quarantine review and the number of screenshot URLs expiring within 24 hours. With leader election enabled, it also names this instance and the leader running scheduled jobs.
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  models.AdminStatusResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/status [get]
+func (h *AdminHandler) GetStatus(c *gin.Context) {
+	var status models.AdminStatusResponse
+	if h.queue != nil {
+		stats := h.queue.Stats()
+		status.ReportQueue = &stats
+	}
+	if h.coordinator != nil {
+		status.Instance = h.coordinator.InstanceID()
+	}
+	if h.maintenance != nil {
+		if state := h.maintenance.State(); state.Enabled {
+			status.Maintenance = &state
+		}
+	}
+
+	if h.mongoService != nil {
+		ctx := c.Request.Context()
+		var err error
+		if status.QuarantinedAttachments, err = h.mongoService.CountTicketsByAttachmentStatus(ctx, services.AttachmentStatusQuarantined); err == nil {
+			status.ExpiringURLs, err = h.mongoService.CountTicketsWithExpiringImages(ctx, time.Now().Add(defaultRotateWindow))
+		}
+		if err != nil {
+			logger.FromContext(c.Request.Context(), h.logger).Error("Failed to count backlog", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to count backlog",
+				Details: err.Error(),
+			})
+			return
+		}
+		if status.Leader, err = h.coordinator.Leader(ctx); err != nil {
+			logger.FromContext(ctx, h.logger).Warn("Failed to look up leader", zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetMaintenance godoc
+// @Summary      Get the maintenance mode
+// @Description  Returns whether report submission is in maintenance mode, and in which mode
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  models.MaintenanceState
+// @Failure      401  {object}  models.ErrorResponse
+// @Router       /admin/maintenance [get]
+func (h *AdminHandler) GetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, h.maintenance.State())
+}
+
+// ChangeMaintenance godoc
+// @Summary      Turn maintenance mode on or off
+// @Description  Turns maintenance mode of report submission on or off, e.g. while Jira is migrated, without a redeploy. In reject mode, /report-issue and /ingest answer 503 with code maintenance, the message and a Retry-After header. In queue mode they accept reports as if async=true was sent, and reports are held in the report queue until maintenance ends; reports beyond REPORT_QUEUE_SIZE are answered with 503. Maintenance ends by itself at until, when set. With MongoDB, the mode applies to all instances within 10 seconds.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body      models.MaintenanceRequest  true  "Maintenance mode"
+// @Success      200  {object}  models.MaintenanceState
+// @Failure      400  {object}  models.ErrorResponse "Invalid request body"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse "Queue mode needs asynchronous report submission"
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/maintenance [post]
+func (h *AdminHandler) ChangeMaintenance(c *gin.Context) {
+	var req models.MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	state, err := h.maintenance.Set(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, services.ErrMaintenanceQueueUnavailable) {
+			c.JSON(http.StatusConflict, models.ErrorResponse{
+				Error:   "Queue mode not available",
+				Details: err.Error(),
+			})
+			return
+		}
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to change maintenance mode", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to change maintenance mode",
+			Details: err.Error(),
+		})
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Changed maintenance mode",
+		zap.Bool("enabled", state.Enabled),
+		zap.String("mode", state.Mode),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.JSON(http.StatusOK, state)
+}
+
+// ListMockTickets godoc
+// @Summary      List the tickets of the mock tracker
+// @Description  Returns the tickets filed in the mock tracker of TRACKER=mock, newest first, as Jira would have received them, so integration tests can check the tickets their reports were filed as
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        product    query     string  false  "Only tickets of this product"
+// @Param        reporter   query     string  false  "Only tickets reported by this email"
+// @Param        requestId  query     string  false  "Only the ticket filed by the request with this ID"
+// @Param        page       query     int     false  "Page number, starting at 1"
+// @Param        pageSize   query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor     query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]services.MockTicket}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "TRACKER is not mock"
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/mock-tickets [get]
+func (h *AdminHandler) ListMockTickets(c *gin.Context) {
+	if h.mockTracker == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Mock tracker not enabled",
+			Details: "Set TRACKER=mock to file tickets in the mock tracker",
+		})
+		return
+	}
+
+	p, ok := parsePageRequest(c)
+	if !ok {
+		return
+	}
+	offset := int64(p.Page-1) * int64(p.PageSize)
+	if p.Cursor != "" {
+		var err error
+		if offset, err = strconv.ParseInt(p.Cursor, 10, 64); err != nil || offset < 0 {
+			writeFieldErrors(c, []models.FieldError{invalidCursor})
+			return
+		}
+	}
+
+	filter := services.MockTicketFilter{
+		Product:   c.Query("product"),
+		Reporter:  c.Query("reporter"),
+		RequestID: c.Query("requestId"),
+	}
+	tickets, total, err := h.mockTracker.Tickets(c.Request.Context(), filter, offset, int64(p.PageSize))
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to list mock tickets", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to list mock tickets",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	var next string
+	if end := offset + int64(len(tickets)); end < total {
+		next = strconv.FormatInt(end, 10)
+	}
+	writePage(c, tickets, p, total, next)
+}
+
+// ResyncTicket godoc
+// @Summary      Re-sync a ticket from Jira
+// @Description  Fetches the current status, assignee and resolution of a ticket from Jira and stores them in MongoDB
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Ticket ID"
+// @Success      200  {object}  services.FlattenedTicket
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Ticket not found"
+// @Failure      502  {object}  models.ErrorResponse "Jira request failed"
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/tickets/{id}/resync [post]
+func (h *AdminHandler) ResyncTicket(c *gin.Context) {
+	if h.mongoService == nil {
+		h.unavailable(c, "Ticket storage not available", "MongoDB is not configured")
+		return
+	}
+
+	ticketID := c.Param("id")
+	ctx := h.jiraService.TicketContext(c.Request.Context(), ticketID)
+	previous, err := h.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		h.ticketError(c, ticketID, "Failed to load ticket", err)
+		return
+	}
+
+	state, err := h.jiraService.GetTicketState(ctx, ticketID)
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Warn("Failed to fetch ticket from Jira", zap.Error(err), zap.String("ticket_id", ticketID))
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error:   "Failed to fetch ticket from Jira",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if err := h.mongoService.UpdateTicketState(ctx, ticketID, state, time.Now()); err != nil {
+		h.ticketError(c, ticketID, "Failed to update ticket", err)
+		return
+	}
+	h.stateChanged(previous, state)
+
+	ticket, err := h.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		h.ticketError(c, ticketID, "Failed to load ticket", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// SyncTickets godoc
+// @Summary      Sync all tickets from Jira
+// @Description  Pages through stored tickets and refreshes their status, assignee and resolution from Jira in batches, to catch up on missed webhooks. Only one sync runs at a time, across instances when leader election is enabled.
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        batchSize query int false "Tickets per Jira search (1-100)" default(50)
+// @Success      200  {object}  services.TicketSyncReport
+// @Failure      400  {object}  models.ErrorResponse "Invalid batch size"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse "A sync is already running"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/tickets/sync [post]
+func (h *AdminHandler) SyncTickets(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context(), h.logger)
+	if h.mongoService == nil {
+		h.unavailable(c, "Ticket storage not available", "MongoDB is not configured")
+		return
+	}
+
+	batchSize := defaultSyncBatchSize
+	if value := c.Query("batchSize"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSyncBatchSize {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Invalid batch size",
+				Details: fmt.Sprintf("batchSize must be between 1 and %d, got %q", maxSyncBatchSize, value),
+			})
+			return
+		}
+		batchSize = n
+	}
+
+	if !h.syncing.TryLock() {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Sync already running",
+			Details: "Another ticket sync is in progress on this instance",
+		})
+		return
+	}
+	defer h.syncing.Unlock()
+
+	unlock, ok, err := h.coordinator.TryLock(c.Request.Context(), services.TicketSyncLock)
+	if err != nil {
+		log.Error("Failed to lock ticket sync", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to lock ticket sync",
+			Details: err.Error(),
+		})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Sync already running",
+			Details: "Another ticket sync is in progress on another instance",
+		})
+		return
+	}
+	defer unlock()
+
+	report, err := services.SyncTicketStates(c.Request.Context(), h.jiraService, h.mongoService, batchSize, h.stateChanged, h.logger)
+	if err != nil {
+		log.Error("Failed to sync tickets from Jira", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to sync tickets from Jira",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	log.Info("Synced tickets from Jira",
+		zap.Int("scanned", report.Scanned),
+		zap.Int("updated", report.Updated),
+		zap.Int("missing", report.Missing),
+		zap.Int("failed", report.Failed),
+	)
+	c.JSON(http.StatusOK, report)
+}
+
+// PurgeTicket godoc
+// @Summary      Purge a ticket
+// @Description  Deletes a ticket, its attachment records and the stored objects no other ticket uses. The Jira issue is not changed.
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Ticket ID"
+// @Success      204
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Ticket not found"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Object storage or MongoDB is not configured"
+// @Router       /admin/tickets/{id} [delete]
+func (h *AdminHandler) PurgeTicket(c *gin.Context) {
+	if h.retention == nil {
+		h.unavailable(c, "Ticket purge not available", "Object storage and MongoDB must be configured")
+		return
+	}
+
+	if !authorize(c, services.ActionDelete) {
+		return
+	}
+
+	ticketID := c.Param("id")
+	if err := h.retention.Purge(h.jiraService.TicketContext(c.Request.Context(), ticketID), ticketID); err != nil {
+		h.ticketError(c, ticketID, "Failed to purge ticket", err)
+		return
+	}
+
+	logger.FromContext(c.Request.Context(), h.logger).Info("Purged ticket", zap.String("ticket_id", ticketID), zap.String("client_ip", c.ClientIP()))
+	c.Status(http.StatusNoContent)
+}
+
+// RotateTicketURL godoc
+// @Summary      Rotate a ticket's screenshot URL
+// @Description  Generates a fresh presigned screenshot URL for a ticket and updates MongoDB and the Jira description
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Ticket ID"
+// @Success      200  {object}  services.FlattenedTicket
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Ticket not found"
+// @Failure      409  {object}  models.ErrorResponse "Ticket has no screenshot"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Object storage or MongoDB is not configured"
+// @Router       /admin/tickets/{id}/rotate-url [post]
+func (h *AdminHandler) RotateTicketURL(c *gin.Context) {
+	if h.resigner == nil {
+		h.unavailable(c, "URL rotation not available", "Object storage and MongoDB must be configured")
+		return
+	}
+
+	ticketID := c.Param("id")
+	ctx := h.jiraService.TicketContext(c.Request.Context(), ticketID)
+	ticket, err := h.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		h.ticketError(c, ticketID, "Failed to load ticket", err)
+		return
+	}
+	if ticket.ImageKey == "" && ticket.ImageURL == "" {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Ticket has no screenshot",
+			Details: fmt.Sprintf("Ticket %s has no stored screenshot to re-sign", ticketID),
+		})
+		return
+	}
+
+	if _, err := h.resigner.Resign(ctx, ticket); err != nil {
+		h.ticketError(c, ticketID, "Failed to rotate screenshot URL", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
+
+// RotateURLs godoc
+// @Summary      Rotate expiring screenshot URLs
+// @Description  Re-signs the screenshot URLs of all open tickets that expire within the given window
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        within query string false "Duration window, e.g. 48h" default(24h)
+// @Success      200  {object}  services.ResignReport
+// @Failure      400  {object}  models.ErrorResponse "Invalid window"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Object storage or MongoDB is not configured"
+// @Router       /admin/urls/rotate [post]
+func (h *AdminHandler) RotateURLs(c *gin.Context) {
+	if h.resigner == nil {
+		h.unavailable(c, "URL rotation not available", "Object storage and MongoDB must be configured")
+		return
+	}
+
+	within := defaultRotateWindow
+	if value := c.Query("within"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Invalid window",
+				Details: fmt.Sprintf("within must be a non-negative duration such as 48h, got %q", value),
+			})
+			return
+		}
+		within = d
+	}
+
+	report, err := h.resigner.Rotate(c.Request.Context(), within)
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to rotate screenshot URLs", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to rotate screenshot URLs",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ListFailedReports godoc
+// @Summary      List failed reports
+// @Description  Returns asynchronously submitted reports whose processing failed and that can still be retried, one page at a time
+// @Tags         admin
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]models.ReportStatus}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Asynchronous reports are not enabled"
+// @Router       /admin/reports/failed [get]
+func (h *AdminHandler) ListFailedReports(c *gin.Context) {
+	if h.queue == nil {
+		h.queueUnavailable(c)
+		return
+	}
+
+	writeList(c, h.queue.Failed())
+}
+
+// RetryReport godoc
+// @Summary      Reprocess a failed report
+// @Description  Queues a failed asynchronously submitted report for processing again
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Report ID"
+// @Success      202  {object}  models.ReportStatus
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Report not found"
+// @Failure      409  {object}  models.ErrorResponse "Report has not failed"
+// @Failure      503  {object}  models.ErrorResponse "Report queue is full or not enabled"
+// @Router       /admin/reports/{id}/retry [post]
+func (h *AdminHandler) RetryReport(c *gin.Context) {
+	if h.queue == nil {
+		h.queueUnavailable(c)
+		return
+	}
+
+	status, err := h.queue.Retry(c.Param("id"))
+	if err != nil {
+		h.retryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, status)
+}
+
+// RetryFailedReports godoc
+// @Summary      Reprocess all failed reports
+// @Description  Queues every failed asynchronously submitted report for processing again, stopping when the queue is full
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      202  {object}  models.RetryResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Report queue is full or not enabled"
+// @Router       /admin/reports/retry [post]
+func (h *AdminHandler) RetryFailedReports(c *gin.Context) {
+	if h.queue == nil {
+		h.queueUnavailable(c)
+		return
+	}
+
+	retried, err := h.queue.RetryFailed()
+	if err != nil && retried == 0 {
+		h.retryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.RetryResponse{Retried: retried})
+}
+
+// retryError maps report retry errors to responses
+func (h *AdminHandler) retryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrReportNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Report not found",
+			Code:    "report_not_found",
+			Details: err.Error(),
+		})
+	case errors.Is(err, services.ErrReportNotFailed):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Report has not failed",
+			Details: err.Error(),
+		})
+	case errors.Is(err, services.ErrReportQueueFull):
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Report queue is full",
+			Code:    "queue_full",
+			Details: err.Error(),
+		})
+	case errors.Is(err, services.ErrReportBrokerUnavailable):
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Report queue unavailable",
+			Code:    "queue_unavailable",
+			Details: err.Error(),
+		})
+	default:
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to retry report", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to retry report",
+			Details: err.Error(),
+		})
+	}
+}
+
+// ListStoredReports godoc
+// @Summary      List reports that failed for good
+// @Description  Returns the asynchronous reports kept in MongoDB after failing for good, most recent failure first, one page at a time: reports queued in memory whose failure expired after REPORT_STATUS_TTL without a successful retry, and brokered reports sent to the dead-letter queue
+// @Tags         admin
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]services.FailedReport}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Asynchronous reports or MongoDB are not configured"
+// @Router       /admin/failed-reports [get]
+func (h *AdminHandler) ListStoredReports(c *gin.Context) {
+	if h.queue == nil || !h.queue.StoresFailures() {
+		h.storedReportsUnavailable(c)
+		return
+	}
+
+	failures, err := h.queue.StoredFailures(c.Request.Context())
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to list failed reports", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to list failed reports",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	writeList(c, failures)
+}
+
+// RetryStoredReport godoc
+// @Summary      Retry a report that failed for good
+// @Description  Queues a report kept in MongoDB after failing for good for processing again, with its original report ID, and removes it from the failed reports. Brokered reports are sent to the broker with all their attempts.
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Report ID"
+// @Success      202  {object}  models.ReportStatus
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Failed report not found"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Report queue is full or unavailable, or asynchronous reports or MongoDB are not configured"
+// @Router       /admin/failed-reports/{id}/retry [post]
+func (h *AdminHandler) RetryStoredReport(c *gin.Context) {
+	if h.queue == nil || !h.queue.StoresFailures() {
+		h.storedReportsUnavailable(c)
+		return
+	}
+
+	status, err := h.queue.RetryStored(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.retryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, status)
+}
+
+// RetryStoredReports godoc
+// @Summary      Retry all reports that failed for good
+// @Description  Queues every report kept in MongoDB after failing for good again, oldest first, stopping when the queue is full or the broker is unavailable
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      202  {object}  models.RetryResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Report queue is full or unavailable, or asynchronous reports or MongoDB are not configured"
+// @Router       /admin/failed-reports/retry [post]
+func (h *AdminHandler) RetryStoredReports(c *gin.Context) {
+	if h.queue == nil || !h.queue.StoresFailures() {
+		h.storedReportsUnavailable(c)
+		return
+	}
+
+	retried, err := h.queue.RetryAllStored(c.Request.Context())
+	if err != nil && retried == 0 {
+		h.retryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.RetryResponse{Retried: retried})
+}
+
+// ListFailedWebhooks godoc
+// @Summary      List failed webhook deliveries
+// @Description  Returns the outbound webhook deliveries that exhausted their attempts, most recent first, one page at a time
+// @Tags         admin
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]services.WebhookFailure}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Outbound webhooks or MongoDB are not configured"
+// @Router       /admin/webhooks/failed [get]
+func (h *AdminHandler) ListFailedWebhooks(c *gin.Context) {
+	if h.webhooks == nil || h.mongoService == nil {
+		h.webhooksUnavailable(c)
+		return
+	}
+
+	failures, err := h.webhooks.Failures(c.Request.Context())
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to list failed webhook deliveries", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to list failed webhook deliveries",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	writeList(c, failures)
+}
+
+// ReplayWebhook godoc
+// @Summary      Replay a failed webhook delivery
+// @Description  Queues a failed outbound webhook delivery to its subscription again, with its original event ID, and removes it from the failed deliveries
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Failed delivery ID"
+// @Success      202  {object}  services.WebhookFailure
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Failed delivery not found"
+// @Failure      409  {object}  models.ErrorResponse "Subscription is no longer configured"
+// @Failure      503  {object}  models.ErrorResponse "Webhook queue is full, or outbound webhooks or MongoDB are not configured"
+// @Router       /admin/webhooks/failed/{id}/replay [post]
+func (h *AdminHandler) ReplayWebhook(c *gin.Context) {
+	if h.webhooks == nil || h.mongoService == nil {
+		h.webhooksUnavailable(c)
+		return
+	}
+
+	failure, err := h.webhooks.Replay(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.replayError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, failure)
+}
+
+// ReplayFailedWebhooks godoc
+// @Summary      Replay all failed webhook deliveries
+// @Description  Queues every failed outbound webhook delivery again, oldest first, stopping when the queue is full. Deliveries to subscriptions no longer configured are kept.
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      202  {object}  models.RetryResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "Webhook queue is full, or outbound webhooks or MongoDB are not configured"
+// @Router       /admin/webhooks/replay [post]
+func (h *AdminHandler) ReplayFailedWebhooks(c *gin.Context) {
+	if h.webhooks == nil || h.mongoService == nil {
+		h.webhooksUnavailable(c)
+		return
+	}
+
+	replayed, err := h.webhooks.ReplayAll(c.Request.Context())
+	if err != nil && replayed == 0 {
+		h.replayError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.RetryResponse{Retried: replayed})
+}
+
+// replayError maps webhook replay errors to responses
+func (h *AdminHandler) replayError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrWebhookFailureNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Failed delivery not found",
+			Details: err.Error(),
+		})
+	case errors.Is(err, services.ErrWebhookSubscriptionRemoved):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Subscription is no longer configured",
+			Details: err.Error(),
+		})
+	case errors.Is(err, services.ErrWebhookQueueFull):
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Webhook queue is full",
+			Code:    "queue_full",
+			Details: err.Error(),
+		})
+	default:
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to replay webhook delivery", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to replay webhook delivery",
+			Details: err.Error(),
+		})
+	}
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Description  Returns the API keys configured in API_KEYS followed by those created through the admin API, revoked ones included, one page at a time. Keys themselves are never returned.
+// @Tags         admin
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]services.APIKey}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/api-keys [get]
+func (h *AdminHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeys.List(c.Request.Context())
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to list API keys", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to list API keys",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	writeList(c, keys)
+}
+
+// CreateAPIKey godoc
+// @Summary      Create an API key
+// @Description  Generates an API key with the given scopes: report to submit reports and uploads, read to view tickets, write to also comment on and reassign them, admin for everything. Keys with products only see the tickets of those products, unless they have the admin scope. Keys of a tenant file their reports for the tenant and only see its tickets, whatever their scopes, and cannot use the admin API. The key is only returned in this response; only its hash is stored.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body      models.CreateAPIKeyRequest  true  "Name and scopes of the key"
+// @Success      201  {object}  services.IssuedAPIKey
+// @Failure      400  {object}  models.ErrorResponse "Invalid request or unknown tenant"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/api-keys [post]
+func (h *AdminHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	if req.Tenant != "" {
+		if _, ok := h.tenantByID(req.Tenant); !ok {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Unknown tenant",
+				Details: fmt.Sprintf("No tenant exists with ID %s", req.Tenant),
+			})
+			return
+		}
+	}
+
+	issued, err := h.apiKeys.Create(c.Request.Context(), req.Name, req.Scopes, req.Products, req.Tenant)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeysNotStored) {
+			h.unavailable(c, "API key storage not available", "MongoDB is not configured")
+			return
+		}
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to create API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to create API key",
+			Details: err.Error(),
+		})
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Created API key",
+		zap.String("key_id", issued.ID),
+		zap.String("name", issued.Name),
+		zap.Strings("scopes", issued.Scopes),
+		zap.Strings("products", issued.Products),
+		zap.String("tenant", issued.Tenant),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.JSON(http.StatusCreated, issued)
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  Revokes an API key created through the admin API; requests with it are rejected from then on. Keys configured in API_KEYS are removed from the configuration instead.
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "API key ID"
+// @Success      204
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "API key not found"
+// @Failure      409  {object}  models.ErrorResponse "API key is configured in API_KEYS"
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /admin/api-keys/{id} [delete]
+func (h *AdminHandler) RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	err := h.apiKeys.Revoke(c.Request.Context(), id)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrAPIKeyConfigured):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "API key cannot be revoked",
+			Details: err.Error(),
+		})
+		return
+	case strings.Contains(err.Error(), "not found"):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "API key not found",
+			Details: err.Error(),
+		})
+		return
+	default:
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to revoke API key", zap.Error(err), zap.String("key_id", id))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to revoke API key",
+			Details: err.Error(),
+		})
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Revoked API key",
+		zap.String("key_id", id),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListTenants godoc
+// @Summary      List tenants
+// @Description  Returns the business units served by the deployment with their Jira, storage and notification settings, without their secrets
+// @Tags         admin
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]models.Tenant}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/tenants [get]
+func (h *AdminHandler) ListTenants(c *gin.Context) {
+	if h.tenants == nil {
+		h.tenantsUnavailable(c)
+		return
+	}
+
+	tenants := h.tenants.List()
+	for i := range tenants {
+		tenants[i] = tenants[i].WithoutSecrets()
+	}
+	writeList(c, tenants)
+}
+
+// GetTenant godoc
+// @Summary      Get a tenant
+// @Description  Returns a tenant with its Jira, storage and notification settings, without their secrets
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Tenant ID"
+// @Success      200  {object}  models.Tenant
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Tenant not found"
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/tenants/{id} [get]
+func (h *AdminHandler) GetTenant(c *gin.Context) {
+	if h.tenants == nil {
+		h.tenantsUnavailable(c)
+		return
+	}
+
+	tenant, ok := h.tenants.Get(c.Param("id"))
+	if !ok {
+		h.tenantNotFound(c, c.Param("id"))
+		return
+	}
+	c.JSON(http.StatusOK, tenant.WithoutSecrets())
+}
+
+// CreateTenant godoc
+// @Summary      Create a tenant
+// @Description  Adds a business unit served by the deployment. Reports of its API keys are filed in its Jira project, their uploads stored in its S3 bucket and new tickets announced in its chats instead of NOTIFICATION_ROUTES; without Jira or storage settings those of the deployment are used. Its keys only see its tickets and attachments. Other instances pick the tenant up within 30 seconds.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body      models.CreateTenantRequest  true  "Tenant and its settings"
+// @Success      201  {object}  models.Tenant
+// @Failure      400  {object}  models.ErrorResponse "Invalid request body"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse "Tenant exists, or its Jira project is used by another tenant or issue tracker"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/tenants [post]
+func (h *AdminHandler) CreateTenant(c *gin.Context) {
+	if h.tenants == nil {
+		h.tenantsUnavailable(c)
+		return
+	}
+
+	var req models.CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	tenant := tenantFromRequest(req.ID, req.TenantRequest)
+	if !h.checkTenantProject(c, tenant) {
+		return
+	}
+	if err := h.tenants.Create(c.Request.Context(), tenant); err != nil {
+		h.tenantError(c, "Failed to create tenant", tenant.ID, err)
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Created tenant",
+		zap.String("tenant", tenant.ID),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.JSON(http.StatusCreated, tenant.WithoutSecrets())
+}
+
+// UpdateTenant godoc
+// @Summary      Update a tenant
+// @Description  Replaces the name and settings of a tenant. The Jira API token and S3 secret key are kept when left out. Other instances pick the change up within 30 seconds.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path      string                true  "Tenant ID"
+// @Param        request  body      models.TenantRequest  true  "Settings of the tenant"
+// @Success      200  {object}  models.Tenant
+// @Failure      400  {object}  models.ErrorResponse "Invalid request body"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Tenant not found"
+// @Failure      409  {object}  models.ErrorResponse "Jira project is used by another tenant or issue tracker"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/tenants/{id} [put]
+func (h *AdminHandler) UpdateTenant(c *gin.Context) {
+	if h.tenants == nil {
+		h.tenantsUnavailable(c)
+		return
+	}
+
+	var req models.TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	tenant := tenantFromRequest(c.Param("id"), req)
+	if !h.checkTenantProject(c, tenant) {
+		return
+	}
+	if err := h.tenants.Update(c.Request.Context(), tenant); err != nil {
+		h.tenantError(c, "Failed to update tenant", tenant.ID, err)
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Updated tenant",
+		zap.String("tenant", tenant.ID),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.JSON(http.StatusOK, tenant.WithoutSecrets())
+}
+
+// DeleteTenant godoc
+// @Summary      Delete a tenant
+// @Description  Removes a tenant and revokes its API keys. Its tickets and attachments are kept, and stay visible to keys without a tenant.
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Tenant ID"
+// @Success      204
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Tenant not found"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/tenants/{id} [delete]
+func (h *AdminHandler) DeleteTenant(c *gin.Context) {
+	if h.tenants == nil {
+		h.tenantsUnavailable(c)
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.tenants.Delete(c.Request.Context(), id); err != nil {
+		h.tenantError(c, "Failed to delete tenant", id, err)
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Deleted tenant",
+		zap.String("tenant", id),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.Status(http.StatusNoContent)
+}
+
+// tenantFromRequest returns the tenant with the settings of a request
+func tenantFromRequest(id string, req models.TenantRequest) *models.Tenant {
+	return &models.Tenant{
+		ID:            id,
+		Name:          req.Name,
+		Jira:          req.Jira,
+		Storage:       req.Storage,
+		Notifications: req.Notifications,
+	}
+}
+
+// tenantByID returns a tenant, or false when there is none or tenants are
+// not available
+func (h *AdminHandler) tenantByID(id string) (*models.Tenant, bool) {
+	if h.tenants == nil {
+		return nil, false
+	}
+	return h.tenants.Get(id)
+}
+
+// checkTenantProject responds with 409 when the Jira project of a tenant is
+// used by an issue tracker of the deployment
+func (h *AdminHandler) checkTenantProject(c *gin.Context, tenant *models.Tenant) bool {
+	if tenant.Jira == nil || !h.jiraService.HasProject(tenant.Jira.ProjectKey) {
+		return true
+	}
+	c.JSON(http.StatusConflict, models.ErrorResponse{
+		Error:   "Jira project already used",
+		Details: fmt.Sprintf("Project %s is used by an issue tracker of the deployment", tenant.Jira.ProjectKey),
+	})
+	return false
+}
+
+func (h *AdminHandler) tenantError(c *gin.Context, message, id string, err error) {
+	switch {
+	case errors.Is(err, services.ErrTenantNotFound):
+		h.tenantNotFound(c, id)
+	case errors.Is(err, services.ErrTenantExists), errors.Is(err, services.ErrTenantProjectTaken):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   message,
+			Details: err.Error(),
+		})
+	default:
+		logger.FromContext(c.Request.Context(), h.logger).Error(message, zap.Error(err), zap.String("tenant", id))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   message,
+			Details: err.Error(),
+		})
+	}
+}
+
+func (h *AdminHandler) tenantNotFound(c *gin.Context, id string) {
+	c.JSON(http.StatusNotFound, models.ErrorResponse{
+		Error:   "Tenant not found",
+		Details: fmt.Sprintf("No tenant exists with ID %s", id),
+	})
+}
+
+func (h *AdminHandler) tenantsUnavailable(c *gin.Context) {
+	h.unavailable(c, "Tenants not available", services.ErrTenantsNotAvailable.Error())
+}
+
+// ListProducts godoc
+// @Summary      List registered products
+// @Description  Returns the products registered through the admin API with their Jira project, support team, severity rules and notification channels
+// @Tags         admin
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]models.Product}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/products [get]
+func (h *AdminHandler) ListProducts(c *gin.Context) {
+	if h.products == nil {
+		h.productsUnavailable(c)
+		return
+	}
+	writeList(c, h.products.List())
+}
+
+// GetProduct godoc
+// @Summary      Get a registered product
+// @Description  Returns a registered product with its Jira project, support team, severity rules and notification channels
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Product"
+// @Success      200  {object}  models.Product
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Product not registered"
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/products/{id} [get]
+func (h *AdminHandler) GetProduct(c *gin.Context) {
+	if h.products == nil {
+		h.productsUnavailable(c)
+		return
+	}
+
+	product, ok := h.products.Get(c.Param("id"))
+	if !ok {
+		h.productNotFound(c, c.Param("id"))
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// CreateProduct godoc
+// @Summary      Register a product
+// @Description  Registers a product with its routing, which takes precedence over the configuration: new tickets are filed in its Jira project instead of the tracker of JIRA_PRODUCT_ROUTING, assigned to its support team instead of the SUPPORT_ROSTER team of the product, and classified by its severity rules before CLASSIFIER_RULES; they are also announced in its chats. Other instances pick the product up within 30 seconds.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body      models.CreateProductRequest  true  "Product and its routing"
+// @Success      201  {object}  models.Product
+// @Failure      400  {object}  models.ErrorResponse "Invalid request body, unknown Jira project, invalid shift or unconfigured on-call provider"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse "Product already registered"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/products [post]
+func (h *AdminHandler) CreateProduct(c *gin.Context) {
+	if h.products == nil {
+		h.productsUnavailable(c)
+		return
+	}
+
+	var req models.CreateProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	product := productFromRequest(req.ID, req.ProductRequest)
+	if !h.checkProductProject(c, product) {
+		return
+	}
+	if err := h.products.Create(c.Request.Context(), product); err != nil {
+		h.productError(c, "Failed to register product", product.ID, err)
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Registered product",
+		zap.String("product", product.ID),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.JSON(http.StatusCreated, product)
+}
+
+// UpdateProduct godoc
+// @Summary      Update a registered product
+// @Description  Replaces the routing of a registered product. Other instances pick the change up within 30 seconds.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path      string                 true  "Product"
+// @Param        request  body      models.ProductRequest  true  "Routing of the product"
+// @Success      200  {object}  models.Product
+// @Failure      400  {object}  models.ErrorResponse "Invalid request body, unknown Jira project, invalid shift or unconfigured on-call provider"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Product not registered"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/products/{id} [put]
+func (h *AdminHandler) UpdateProduct(c *gin.Context) {
+	if h.products == nil {
+		h.productsUnavailable(c)
+		return
+	}
+
+	var req models.ProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	product := productFromRequest(c.Param("id"), req)
+	if !h.checkProductProject(c, product) {
+		return
+	}
+	if err := h.products.Update(c.Request.Context(), product); err != nil {
+		h.productError(c, "Failed to update product", product.ID, err)
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Updated product",
+		zap.String("product", product.ID),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.JSON(http.StatusOK, product)
+}
+
+// DeleteProduct godoc
+// @Summary      Unregister a product
+// @Description  Removes a registered product, whose reports are routed by the configuration again. Its tickets are kept.
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Product"
+// @Success      204
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse "Product not registered"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/products/{id} [delete]
+func (h *AdminHandler) DeleteProduct(c *gin.Context) {
+	if h.products == nil {
+		h.productsUnavailable(c)
+		return
+	}
+
+	id := strings.ToLower(c.Param("id"))
+	if err := h.products.Delete(c.Request.Context(), id); err != nil {
+		h.productError(c, "Failed to unregister product", id, err)
+		return
+	}
+	logger.FromContext(c.Request.Context(), h.audit).Info("Unregistered product",
+		zap.String("product", id),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.Status(http.StatusNoContent)
+}
+
+// productFromRequest returns the product with the routing of a request.
+// Products are stored in lowercase, as they are matched case-insensitively.
+func productFromRequest(id string, req models.ProductRequest) *models.Product {
+	return &models.Product{
+		ID:            strings.ToLower(id),
+		ProjectKey:    req.ProjectKey,
+		Team:          req.Team,
+		SeverityRules: req.SeverityRules,
+		Notifications: req.Notifications,
+	}
+}
+
+// checkProductProject responds with 400 when no issue tracker of the
+// deployment uses the Jira project of a product
+func (h *AdminHandler) checkProductProject(c *gin.Context, product *models.Product) bool {
+	if product.ProjectKey == "" || h.jiraService.HasProject(product.ProjectKey) {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   "Unknown Jira project",
+		Details: fmt.Sprintf("No issue tracker of the deployment uses project %s", product.ProjectKey),
+	})
+	return false
+}
+
+func (h *AdminHandler) productError(c *gin.Context, message, id string, err error) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		h.productNotFound(c, id)
+	case errors.Is(err, services.ErrInvalidProduct):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   message,
+			Details: err.Error(),
+		})
+	case errors.Is(err, services.ErrProductExists):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   message,
+			Details: err.Error(),
+		})
+	default:
+		logger.FromContext(c.Request.Context(), h.logger).Error(message, zap.Error(err), zap.String("product", id))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   message,
+			Details: err.Error(),
+		})
+	}
+}
+
+func (h *AdminHandler) productNotFound(c *gin.Context, id string) {
+	c.JSON(http.StatusNotFound, models.ErrorResponse{
+		Error:   "Product not registered",
+		Details: fmt.Sprintf("No product is registered as %s", id),
+	})
+}
+
+func (h *AdminHandler) productsUnavailable(c *gin.Context) {
+	h.unavailable(c, "Products not available", services.ErrProductsNotAvailable.Error())
+}
+
+// ListAuditLog godoc
+// @Summary      Query the audit log
+// @Description  Returns recorded POST, PUT, PATCH and DELETE requests and attachment downloads, newest first, one page at a time: who made them (API key, SSO subject or token), what they did to which resource, the response status, when and from which IP
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        actor       query     string  false  "Name of the API key, SSO subject or token"
+// @Param        action      query     string  false  "create, patch, delete, transition or download"
+// @Param        resourceId  query     string  false  "Ticket, report or resource ID"
+// @Param        since       query     string  false  "Earliest time, RFC 3339"
+// @Param        until       query     string  false  "Time before which entries were recorded, RFC 3339"
+// @Param        page        query     int     false  "Page number, starting at 1"
+// @Param        pageSize    query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor      query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]services.AuditEntry}
+// @Failure      400  {object}  models.ErrorResponse "Invalid filter, page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /admin/audit [get]
+func (h *AdminHandler) ListAuditLog(c *gin.Context) {
+	if h.mongoService == nil {
+		h.unavailable(c, "Audit log not available", "MongoDB is not configured")
+		return
+	}
+
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	p, ok := parsePageRequest(c)
+	if !ok {
+		return
+	}
+	var before primitive.ObjectID
+	if p.Cursor != "" {
+		var err error
+		if before, err = primitive.ObjectIDFromHex(p.Cursor); err != nil {
+			writeFieldErrors(c, []models.FieldError{invalidCursor})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	skip := int64(p.Page-1) * int64(p.PageSize)
+	entries, err := h.mongoService.GetAuditEntries(ctx, filter, before, skip, int64(p.PageSize)+1)
+	if err != nil {
+		h.auditLogError(c, err)
+		return
+	}
+	total, err := h.mongoService.CountAuditEntries(ctx, filter)
+	if err != nil {
+		h.auditLogError(c, err)
+		return
+	}
+
+	var next string
+	if len(entries) > p.PageSize {
+		entries = entries[:p.PageSize]
+		next = entries[len(entries)-1].ID.Hex()
+	}
+	writePage(c, entries, p, total, next)
+}
+
+func (h *AdminHandler) auditLogError(c *gin.Context, err error) {
+	logger.FromContext(c.Request.Context(), h.logger).Error("Failed to query audit log", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   "Failed to query audit log",
+		Details: err.Error(),
+	})
+}
+
+// parseAuditFilter reads the filters of the audit log query. It writes an
+// error response and returns false if they are invalid.
+func parseAuditFilter(c *gin.Context) (services.AuditFilter, bool) {
+	filter := services.AuditFilter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		ResourceID: c.Query("resourceId"),
+	}
+	var fields []models.FieldError
+
+	switch filter.Action {
+	case "", services.AuditActionCreate, services.AuditActionPatch, services.AuditActionDelete, services.AuditActionTransition, services.AuditActionDownload:
+	default:
+		fields = append(fields, models.FieldError{
+			Field: "action", Rule: "oneof", Code: "invalid_choice",
+			Message: "action must be one of create, patch, delete, transition, download",
+		})
+	}
+	for _, bound := range []struct {
+		name string
+		at   *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			fields = append(fields, models.FieldError{
+				Field: bound.name, Rule: "datetime", Code: "invalid_format",
+				Message: bound.name + " must be an RFC 3339 time such as 2024-05-01T00:00:00Z",
+			})
+		}
+		*bound.at = at
+	}
+
+	if len(fields) > 0 {
+		writeFieldErrors(c, fields)
+		return services.AuditFilter{}, false
+	}
+	return filter, true
+}
+
+// ReassignTicket godoc
+// @Summary      Reassign a ticket
+// @Description  Assigns a ticket to a member of the configured support team in Jira and MongoDB, and records the change in the ticket's reassignment history. Requires the write scope (agent role); agents limited to products can only reassign their tickets.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path      string                        true  "Ticket ID"
+// @Param        request  body      models.ReassignTicketRequest  true  "New assignee"
+// @Success      200  {object}  services.FlattenedTicket
+// @Failure      400  {object}  models.ErrorResponse "Invalid request or assignee is not a support team member"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse "Credentials lack the write scope"
+// @Failure      404  {object}  models.ErrorResponse "Ticket not found"
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      502  {object}  models.ErrorResponse "Jira request failed"
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /tickets/{id}/reassign [put]
+func (h *AdminHandler) ReassignTicket(c *gin.Context) {
+	if h.mongoService == nil {
+		h.unavailable(c, "Ticket storage not available", "MongoDB is not configured")
+		return
+	}
+
+	var req models.ReassignTicketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+	if !h.jiraService.IsSupportTeamMember(req.Assignee) {
+		writeFieldErrors(c, []models.FieldError{{
+			Field:   "assignee",
+			Rule:    "oneof",
+			Code:    "invalid_choice",
+			Message: "assignee must be a member of the support team",
+		}})
+		return
+	}
+
+	ticketID := c.Param("id")
+	ctx := h.jiraService.TicketContext(c.Request.Context(), ticketID)
+	ticket, err := h.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		h.ticketError(c, ticketID, "Failed to load ticket", err)
+		return
+	}
+	if !authorizeTicket(c, services.ActionReassign, ticket) {
+		return
+	}
+	if ticket.AssignedTo == req.Assignee {
+		c.JSON(http.StatusOK, ticket)
+		return
+	}
+
+	if err := h.jiraService.AssignTicket(ctx, ticketID, req.Assignee); err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Warn("Failed to reassign ticket in Jira", zap.Error(err), zap.String("ticket_id", ticketID))
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error:   "Failed to reassign ticket in Jira",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	change := services.Reassignment{
+		From:     ticket.AssignedTo,
+		To:       req.Assignee,
+		Reason:   req.Reason,
+		ClientIP: c.ClientIP(),
+		At:       time.Now(),
+	}
+	if err := h.mongoService.ReassignTicket(ctx, ticketID, change); err != nil {
+		h.ticketError(c, ticketID, "Failed to update ticket", err)
+		return
+	}
+	h.stateChanged(ticket, &services.TicketState{Status: ticket.Status, AssignedTo: change.To, Resolution: ticket.Resolution})
+	logger.FromContext(c.Request.Context(), h.audit).Info("Reassigned ticket",
+		zap.String("ticket_id", ticketID),
+		zap.String("from", change.From),
+		zap.String("to", change.To),
+		zap.String("reason", change.Reason),
+		zap.String("client_ip", change.ClientIP),
+	)
+
+	ticket.AssignedTo = change.To
+	ticket.UpdatedAt = change.At
+	ticket.Reassignments = append(ticket.Reassignments, change)
+	c.JSON(http.StatusOK, ticket)
+}
+
+// CommentOnTicket godoc
+// @Summary      Comment on a ticket
+// @Description  Adds a comment to a ticket in Jira, attributed to the caller. Requires the write scope (agent role); agents limited to products can only comment on their tickets.
+// @Tags         admin
+// @Accept       json
+// @Security     ApiKeyAuth
+// @Param        id       path      string                  true  "Ticket ID"
+// @Param        request  body      models.CommentRequest  true  "Comment"
+// @Success      204
+// @Failure      400  {object}  models.ErrorResponse "Invalid request"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse "Credentials lack the write scope"
+// @Failure      404  {object}  models.ErrorResponse "Ticket not found"
+// @Failure      502  {object}  models.ErrorResponse "Jira request failed"
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /tickets/{id}/comments [post]
+func (h *AdminHandler) CommentOnTicket(c *gin.Context) {
+	if h.mongoService == nil {
+		h.unavailable(c, "Ticket storage not available", "MongoDB is not configured")
+		return
+	}
+
+	var req models.CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	ticketID := c.Param("id")
+	ctx := h.jiraService.TicketContext(c.Request.Context(), ticketID)
+	ticket, err := h.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		h.ticketError(c, ticketID, "Failed to load ticket", err)
+		return
+	}
+	if !authorizeTicket(c, services.ActionComment, ticket) {
+		return
+	}
+
+	author := "ronnin"
+	if principal := middleware.CurrentPrincipal(c); principal != nil {
+		author = principal.Name
+	}
+	if err := h.jiraService.AddComment(ctx, ticketID, author, req.Body); err != nil {
+		logger.FromContext(ctx, h.logger).Warn("Failed to comment on ticket in Jira", zap.Error(err), zap.String("ticket_id", ticketID))
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error:   "Failed to comment on ticket in Jira",
+			Details: err.Error(),
+		})
+		return
+	}
+	logger.FromContext(ctx, h.audit).Info("Commented on ticket",
+		zap.String("ticket_id", ticketID),
+		zap.String("author", author),
+		zap.String("client_ip", c.ClientIP()),
+	)
+
+	c.Status(http.StatusNoContent)
+}
+
+// ticketError maps ticket lookup and update errors to responses
+func (h *AdminHandler) ticketError(c *gin.Context, ticketID, message string, err error) {
+	if strings.Contains(err.Error(), "not found") {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Ticket not found",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	logger.FromContext(c.Request.Context(), h.logger).Error(message, zap.Error(err), zap.String("ticket_id", ticketID))
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   message,
+		Details: err.Error(),
+	})
+}
+
+func (h *AdminHandler) queueUnavailable(c *gin.Context) {
+	h.unavailable(c, "Asynchronous reports not available", "Asynchronous report submission is not enabled on this server")
+}
+
+func (h *AdminHandler) storedReportsUnavailable(c *gin.Context) {
+	h.unavailable(c, "Failed reports not available", "Keeping failed reports needs asynchronous report submission and MongoDB to be configured")
+}
+
+func (h *AdminHandler) webhooksUnavailable(c *gin.Context) {
+	h.unavailable(c, "Failed webhook deliveries not available", "Outbound webhooks need WEBHOOK_SUBSCRIPTIONS and MongoDB to be configured")
+}
+
+func (h *AdminHandler) unavailable(c *gin.Context, message, details string) {
+	c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+		Error:   message,
+		Details: details,
+	})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+type AlertmanagerHandler struct {
+	alerts   *services.AlertIntake
+	logger   *zap.Logger
+	validate *validator.Validate
+}
+
+// NewAlertmanagerHandler creates a handler for Alertmanager webhook
+// notifications
+func NewAlertmanagerHandler(alerts *services.AlertIntake, log *zap.Logger, validate *validator.Validate) *AlertmanagerHandler {
+	return &AlertmanagerHandler{
+		alerts:   alerts,
+		logger:   log,
+		validate: validate,
+	}
+}
+
+// AlertmanagerWebhook godoc
+// @Summary      Receive Alertmanager webhook
+// @Description  Files each firing alert of an Alertmanager (or Grafana Alerting) notification as a ticket. An alert whose fingerprint already has an open ticket is not filed again; its ticket gets a comment when the alert resolves and when it fires again. Requires ALERTMANAGER_TOKEN as Bearer token, set in the receiver's http_config. Failures answer 500 so that Alertmanager retries; alerts handled before are recognized.
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body      models.AlertmanagerWebhook  true  "Alertmanager notification"
+// @Success      200  {object}  models.AlertmanagerResponse "What was done with each alert"
+// @Failure      400  {object}  models.ErrorResponse "Invalid notification"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse "Tracker or MongoDB request failed"
+// @Router       /webhooks/alertmanager [post]
+func (h *AlertmanagerHandler) AlertmanagerWebhook(c *gin.Context) {
+	var req models.AlertmanagerWebhook
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx, h.logger).With(zap.String("group_key", req.GroupKey))
+	results, err := h.alerts.Notify(ctx, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to handle alerts",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	log.Info("Handled Alertmanager notification", zap.String("status", req.Status), zap.Int("alerts", len(results)))
+	c.JSON(http.StatusOK, models.AlertmanagerResponse{Alerts: results})
+}
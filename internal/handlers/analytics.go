@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/middleware"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// defaultUsageWindow is the window usage is summarized over when the
+// request gives no start
+const defaultUsageWindow = 30 * 24 * time.Hour
+
+type AnalyticsHandler struct {
+	mongoService *services.MongoDBService
+	logger       *zap.Logger
+}
+
+// NewAnalyticsHandler creates a handler summarizing usage from the tickets
+// and report failures stored in MongoDB, which may be nil
+func NewAnalyticsHandler(ms *services.MongoDBService, log *zap.Logger) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		mongoService: ms,
+		logger:       log,
+	}
+}
+
+// GetUsage godoc
+// @Summary      Usage per product
+// @Description  Summarizes, per product, the reports turned into tickets, the reports that failed and their failure rate, the median time Jira took to create a ticket, and the number and sizes of attachments, over a time window for capacity planning. Callers limited to products only see those products.
+// @Tags         analytics
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        since  query     string  false  "Start of the window, RFC 3339 (default 30 days before until)"
+// @Param        until  query     string  false  "End of the window, RFC 3339 (default now)"
+// @Success      200  {object}  models.UsageResponse
+// @Failure      400  {object}  models.ErrorResponse "Invalid since or until"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /analytics/usage [get]
+func (h *AnalyticsHandler) GetUsage(c *gin.Context) {
+	if h.mongoService == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Usage analytics not available",
+			Details: "MongoDB is not configured",
+		})
+		return
+	}
+	if !authorize(c, services.ActionReadTicket) {
+		return
+	}
+
+	since, until, ok := parseUsageWindow(c)
+	if !ok {
+		return
+	}
+
+	scope := middleware.CurrentPrincipal(c).Scope()
+	usage, err := h.mongoService.UsageByProduct(c.Request.Context(), since, until, scope)
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to summarize usage", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to summarize usage",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UsageResponse{
+		Since:    since,
+		Until:    until,
+		Products: usage,
+	})
+}
+
+// parseUsageWindow reads the window of a usage request. It writes an error
+// response and returns false if it is invalid.
+func parseUsageWindow(c *gin.Context) (time.Time, time.Time, bool) {
+	var fields []models.FieldError
+	parse := func(name string, fallback time.Time) time.Time {
+		value := c.Query(name)
+		if value == "" {
+			return fallback
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			fields = append(fields, models.FieldError{
+				Field: name, Rule: "datetime", Code: "invalid_format",
+				Message: name + " must be an RFC 3339 time such as 2024-05-01T00:00:00Z",
+			})
+		}
+		return at.UTC()
+	}
+
+	until := parse("until", time.Now().UTC())
+	since := parse("since", until.Add(-defaultUsageWindow))
+	if len(fields) == 0 && !since.Before(until) {
+		fields = append(fields, models.FieldError{
+			Field: "since", Rule: "ltfield", Code: "invalid_range",
+			Message: "since must be before until",
+		})
+	}
+
+	if len(fields) > 0 {
+		writeFieldErrors(c, fields)
+		return time.Time{}, time.Time{}, false
+	}
+	return since, until, true
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/middleware"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// GetAttachmentGin godoc
+// @Summary      Download an attachment
+// @Description  Streams a file uploaded with a ticket from object storage, so viewers need no presigned URL and lose access as soon as their credentials are revoked. Files are always sent as downloads. Downloads are recorded in the audit log when AUDIT_LOG is enabled.
+// @Tags         tickets
+// @Produce      octet-stream
+// @Security     ApiKeyAuth
+// @Param        id  path      string  true  "Attachment ID, as listed by /tickets/{id}/attachments"
+// @Success      200  {file}    file  "Content of the attachment"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid credentials when API_KEY_AUTH or OIDC is enabled"
+// @Failure      403  {object}  models.ErrorResponse "Credentials lack the read scope"
+// @Failure      404  {object}  models.ErrorResponse "Attachment not found, pending review, purged, of another tenant, or of a product the caller is not limited to"
+// @Failure      500  {object}  models.ErrorResponse "Database or storage unavailable, or error reading the attachment"
+// @Router       /attachments/{id} [get]
+func (h *TicketHandler) GetAttachmentGin(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx, h.logger)
+	id := c.Param("id")
+
+	mongoService := h.jiraService.GetMongoService()
+	if mongoService == nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Database not available",
+			Details: "MongoDB service is not configured",
+		})
+		return
+	}
+
+	if h.storage == nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Storage not available",
+			Details: "Object storage is not configured",
+		})
+		return
+	}
+
+	if !authorize(c, services.ActionReadTicket) {
+		return
+	}
+
+	attachment, err := mongoService.GetAttachment(ctx, id)
+	if errors.Is(err, services.ErrAttachmentNotFound) {
+		attachmentNotFound(c, id)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to retrieve attachment", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to retrieve attachment",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// Only callers limited to a tenant or products need the ticket to be
+	// checked, in the tenant of the attachment; attachments of tickets they
+	// may not see, or whose ticket is gone, are not revealed
+	principal := middleware.CurrentPrincipal(c)
+	if !principal.Scope().All() {
+		ticket, err := mongoService.GetTicketByJiraID(services.WithTenant(ctx, attachment.Tenant), attachment.TicketID)
+		if errors.Is(err, services.ErrTicketNotFound) {
+			attachmentNotFound(c, id)
+			return
+		}
+		if err != nil {
+			log.Error("Failed to retrieve ticket", zap.Error(err), zap.String("id", attachment.TicketID))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to retrieve ticket",
+				Details: err.Error(),
+			})
+			return
+		}
+		if !principal.CanAccess(services.ActionReadTicket, ticket) {
+			attachmentNotFound(c, id)
+			return
+		}
+	}
+
+	if attachment.Status == services.AttachmentStatusQuarantined || attachment.Status == services.AttachmentStatusPurged {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Attachment not available",
+			Details: fmt.Sprintf("Attachment %s is %s", id, attachment.Status),
+		})
+		return
+	}
+
+	// The file is in the bucket of the tenant of the attachment
+	body, err := h.storage.OpenObject(services.WithTenant(ctx, attachment.Tenant), attachment.ObjectKey)
+	if errors.Is(err, services.ErrObjectNotFound) {
+		log.Warn("Attachment object is missing", zap.String("id", id), zap.String("key", attachment.ObjectKey))
+		attachmentNotFound(c, id)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to open attachment", zap.Error(err), zap.String("id", id), zap.String("key", attachment.ObjectKey))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to read attachment",
+			Details: err.Error(),
+		})
+		return
+	}
+	defer body.Close()
+
+	log.Info("Attachment downloaded",
+		zap.String("id", id),
+		zap.String("ticket_id", attachment.TicketID),
+		zap.String("key", attachment.ObjectKey),
+	)
+
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	size := attachment.Size
+	if size <= 0 {
+		size = -1
+	}
+	filename := attachment.Filename
+	if filename == "" {
+		filename = id
+	}
+	// Uploads are never rendered by the browser on the API's origin, and
+	// not kept in caches once access is revoked
+	c.DataFromReader(http.StatusOK, size, contentType, body, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": filename}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, no-store",
+	})
+}
+
+// attachmentNotFound responds with 404 for an attachment
+func attachmentNotFound(c *gin.Context, id string) {
+	c.JSON(http.StatusNotFound, models.ErrorResponse{
+		Error:   "Attachment not found",
+		Details: fmt.Sprintf("Attachment with ID %s not found", id),
+	})
+}
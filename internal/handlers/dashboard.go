@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"embed"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// dashboardFiles is the single-page dashboard. It holds no data: the page
+// asks for the admin token or an admin API key and reads tickets through
+// the API with it.
+//
+//go:embed dashboard/*
+var dashboardFiles embed.FS
+
+// DashboardHandler serves the web dashboard of tickets
+type DashboardHandler struct {
+	files fs.FS
+}
+
+func NewDashboardHandler() *DashboardHandler {
+	files, _ := fs.Sub(dashboardFiles, "dashboard")
+	return &DashboardHandler{files: files}
+}
+
+// Redirect sends /ui to /ui/, so the page's relative links resolve
+func (h *DashboardHandler) Redirect(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, c.Request.URL.Path+"/")
+}
+
+// ServeFile serves a file of the dashboard, its page by default
+func (h *DashboardHandler) ServeFile(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("file"), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	data, err := fs.ReadFile(h.files, name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Not found"})
+		return
+	}
+	// The files change with the binary, so browsers revalidate them
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, mime.TypeByExtension(path.Ext(name)), data)
+}
@@ -0,0 +1,251 @@
+'use strict';
+
+// The dashboard reads everything through the API with the token entered at
+// sign in, kept in sessionStorage for the tab.
+const API = new URL('../api/v1/', location.href);
+const TOKEN_KEY = 'ronnin.token';
+const PAGE_SIZE = 200;
+
+const $ = (id) => document.getElementById(id);
+
+let tickets = [];
+let nextCursor = '';
+
+class APIError extends Error {
+  constructor(status, body) {
+    super(body && body.error ? body.error + (body.details ? ': ' + body.details : '') : 'Request failed with status ' + status);
+    this.status = status;
+  }
+}
+
+async function api(path, params) {
+  const url = new URL(path, API);
+  for (const [key, value] of Object.entries(params || {})) {
+    if (value) url.searchParams.set(key, value);
+  }
+  const resp = await fetch(url, {
+    headers: { Authorization: 'Bearer ' + sessionStorage.getItem(TOKEN_KEY), Accept: 'application/json' },
+  });
+  const body = await resp.json().catch(() => null);
+  if (!resp.ok) {
+    if (resp.status === 401) signOut('Your session is no longer valid, please sign in again.');
+    throw new APIError(resp.status, body);
+  }
+  return body;
+}
+
+function show(el, visible) {
+  el.hidden = !visible;
+}
+
+function signOut(message) {
+  sessionStorage.removeItem(TOKEN_KEY);
+  show($('dashboard'), false);
+  show($('sign-out'), false);
+  show($('sign-in'), true);
+  $('sign-in-error').textContent = message || '';
+  show($('sign-in-error'), Boolean(message));
+}
+
+async function signIn(token) {
+  sessionStorage.setItem(TOKEN_KEY, token);
+  try {
+    // Only admins may use the dashboard
+    await api('admin/status');
+  } catch (err) {
+    signOut(err.status === 403 ? 'These credentials lack the admin scope.' : err.message);
+    return;
+  }
+  show($('sign-in'), false);
+  show($('sign-out'), true);
+  show($('dashboard'), true);
+  loadStats();
+  loadTickets(true);
+}
+
+function formatDate(value) {
+  const date = new Date(value);
+  return !value || date.getFullYear() <= 1 ? '' : date.toLocaleString();
+}
+
+function stat(label, value) {
+  const card = document.createElement('div');
+  card.className = 'stat';
+  const number = document.createElement('strong');
+  number.textContent = value;
+  const name = document.createElement('span');
+  name.textContent = label;
+  card.append(number, name);
+  return card;
+}
+
+async function loadStats() {
+  const stats = $('usage');
+  try {
+    const usage = await api('analytics/usage');
+    let reports = 0;
+    let failures = 0;
+    for (const product of usage.products || []) {
+      reports += product.reports;
+      failures += product.failures;
+    }
+    const rate = reports + failures > 0 ? (100 * failures / (reports + failures)).toFixed(1) + '%' : '-';
+    stats.replaceChildren(
+      stat('Reports, last 30 days', reports),
+      stat('Failed reports', failures),
+      stat('Failure rate', rate),
+      stat('Products', (usage.products || []).length),
+    );
+  } catch (err) {
+    stats.replaceChildren(stat('Stats unavailable', '-'));
+  }
+}
+
+async function loadTickets(reset) {
+  if (reset) {
+    tickets = [];
+    nextCursor = '';
+  }
+  show($('list-error'), false);
+  try {
+    const page = await api('tickets', { pageSize: PAGE_SIZE, cursor: nextCursor });
+    tickets = tickets.concat(page.data || []);
+    nextCursor = page.nextCursor || '';
+    $('count').textContent = tickets.length + ' of ' + page.total + ' tickets';
+    $('total').textContent = page.total;
+  } catch (err) {
+    $('list-error').textContent = err.message;
+    show($('list-error'), true);
+  }
+  show($('load-more'), nextCursor !== '');
+  fillFilter($('filter-status'), 'Status');
+  fillFilter($('filter-product'), 'Product');
+  fillFilter($('filter-severity'), 'Severity');
+  render();
+}
+
+// fillFilter offers the values of a field among the loaded tickets
+function fillFilter(select, field) {
+  const selected = select.value;
+  const values = [...new Set(tickets.map((t) => t[field]).filter(Boolean))].sort();
+  select.replaceChildren(select.options[0]);
+  for (const value of values) {
+    select.add(new Option(value, value, false, value === selected));
+  }
+}
+
+function matches(ticket) {
+  const text = $('filter-text').value.trim().toLowerCase();
+  if (text && ![ticket.TicketID, ticket.Issue, ticket.UserEmail, ticket.AssignedTo].some((v) => (v || '').toLowerCase().includes(text))) {
+    return false;
+  }
+  return (!$('filter-status').value || ticket.Status === $('filter-status').value)
+    && (!$('filter-product').value || ticket.Product === $('filter-product').value)
+    && (!$('filter-severity').value || ticket.Severity === $('filter-severity').value);
+}
+
+function render() {
+  const rows = tickets.filter(matches).map((ticket) => {
+    const row = document.createElement('tr');
+    for (const value of [ticket.TicketID, ticket.Issue, ticket.Product, ticket.Severity, ticket.Status, ticket.AssignedTo, formatDate(ticket.CreatedAt)]) {
+      const cell = document.createElement('td');
+      cell.textContent = value || '';
+      row.append(cell);
+    }
+    row.tabIndex = 0;
+    row.addEventListener('click', () => openTicket(ticket.TicketID));
+    row.addEventListener('keydown', (e) => e.key === 'Enter' && openTicket(ticket.TicketID));
+    return row;
+  });
+  $('tickets').replaceChildren(...rows);
+}
+
+async function openTicket(id) {
+  const detail = $('detail');
+  show(detail, true);
+  $('detail-title').textContent = id;
+  $('detail-fields').replaceChildren();
+  $('detail-description').textContent = '';
+  $('detail-preview').replaceChildren();
+  show($('detail-link'), false);
+
+  let ticket;
+  try {
+    ticket = await api('tickets/' + encodeURIComponent(id));
+  } catch (err) {
+    $('detail-description').textContent = err.message;
+    return;
+  }
+  $('detail-title').textContent = ticket.TicketID + ' ' + (ticket.Issue || '');
+  if (/^https?:\/\//.test(ticket.JiraLink || '')) {
+    $('detail-link').href = ticket.JiraLink;
+    show($('detail-link'), true);
+  }
+  const fields = [
+    ['Status', ticket.Status],
+    ['Resolution', ticket.Resolution],
+    ['Assignee', ticket.AssignedTo],
+    ['Product', ticket.Product],
+    ['Category', ticket.Category],
+    ['Severity', ticket.Severity],
+    ['Reporter', ticket.UserEmail],
+    ['Lead', ticket.LeadID],
+    ['Page', ticket.PageURL],
+    ['Created', formatDate(ticket.CreatedAt)],
+    ['Updated', formatDate(ticket.UpdatedAt)],
+    ['Request ID', ticket.RequestID],
+  ];
+  $('detail-fields').replaceChildren(...fields.filter(([, value]) => value).flatMap(([name, value]) => {
+    const term = document.createElement('dt');
+    term.textContent = name;
+    const desc = document.createElement('dd');
+    desc.textContent = value;
+    return [term, desc];
+  }));
+  $('detail-description').textContent = ticket.Description || '';
+
+  if (ticket.ImageURL) {
+    preview(ticket);
+  }
+}
+
+// preview shows the ticket's screenshot or recording with a freshly signed
+// URL, as the stored one may have expired
+async function preview(ticket) {
+  const container = $('detail-preview');
+  try {
+    const image = await api('tickets/' + encodeURIComponent(ticket.TicketID) + '/image');
+    const media = (ticket.ImageContentType || '').startsWith('video/')
+      ? Object.assign(document.createElement('video'), { controls: true })
+      : Object.assign(document.createElement('img'), { alt: 'Screenshot of ' + ticket.TicketID });
+    media.src = image.imageUrl;
+    const link = document.createElement('a');
+    link.href = image.imageUrl;
+    link.target = '_blank';
+    link.rel = 'noopener noreferrer';
+    link.append(media);
+    container.replaceChildren(link);
+  } catch (err) {
+    container.textContent = 'Screenshot unavailable: ' + err.message;
+  }
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+  $('sign-in').addEventListener('submit', (e) => {
+    e.preventDefault();
+    signIn($('token').value.trim());
+    $('token').value = '';
+  });
+  $('sign-out').addEventListener('click', () => signOut());
+  $('filters').addEventListener('input', render);
+  $('filters').addEventListener('submit', (e) => e.preventDefault());
+  $('load-more').addEventListener('click', () => loadTickets(false));
+  $('close-detail').addEventListener('click', () => show($('detail'), false));
+
+  const token = sessionStorage.getItem(TOKEN_KEY);
+  if (token) {
+    signIn(token);
+  } else {
+    signOut();
+  }
+});
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+)
+
+// ticketETag tags a ticket by its version, the time of its last update
+func ticketETag(ticket *services.FlattenedTicket) string {
+	version := ticket.UpdatedAt
+	if version.IsZero() {
+		// Stored before update times were kept
+		version = ticket.CreatedAt
+	}
+	return weakETag([]byte(fmt.Sprintf("%s@%d", ticket.TicketID, version.UnixNano())))
+}
+
+// weakETag tags content by its SHA-256 hash. Tags are weak since responses
+// may be compressed on the way out.
+func weakETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified sets the ETag of the response and responds with 304 if the
+// client already has that version, as listed in If-None-Match
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	// Clients must revalidate, so changes show up on the next poll
+	c.Header("Cache-Control", "no-cache")
+
+	if !etagMatches(c.GetHeader("If-None-Match"), etag) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compares an If-None-Match header with an ETag, ignoring
+// weakness as required for If-None-Match
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONTagged responds with v as JSON tagged by its content, or with 304
+// when the client already has the same content
+func writeJSONTagged(c *gin.Context, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to encode response",
+			Details: err.Error(),
+		})
+		return
+	}
+	if notModified(c, weakETag(body)) {
+		return
+	}
+	c.Data(http.StatusOK, gin.MIMEJSON+"; charset=utf-8", body)
+}
@@ -1,67 +1,220 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
 )
 
-type HealthResponse struct {
-	Status    string            `json:"status"`
-	Services  map[string]string `json:"services"`
-	Timestamp int64             `json:"timestamp"`
+// Status of a dependency in readiness responses
+const (
+	dependencyOK       = "ok"
+	dependencyError    = "error"
+	dependencyDisabled = "disabled"
+)
+
+// pinger is a dependency that can be checked for readiness
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type HealthHandler struct {
+	// dependencies are checked by name; nil ones are not configured
+	dependencies map[string]pinger
+	timeout      time.Duration
+	logger       *zap.Logger
+
+	// down holds the dependencies whose last check failed; recovery
+	// listeners are told when one of them passes again
+	mu         sync.Mutex
+	down       map[string]bool
+	onRecovery []func(name string)
+}
+
+// NewHealthHandler creates a health handler checking each configured
+// dependency within timeout. MongoDB and object storage may be nil.
+func NewHealthHandler(js *services.JiraRegistry, ms *services.MongoDBService, storage services.ObjectStorage, timeout time.Duration, log *zap.Logger) *HealthHandler {
+	dependencies := map[string]pinger{"mongodb": nil, "storage": nil}
+	// Issue trackers besides the default Jira instance are checked as
+	// <kind>:<name>, e.g. jira:lending or github:web
+	for _, name := range js.Names() {
+		key := js.Instance(name).Kind()
+		if name != services.DefaultJiraInstance {
+			key += ":" + name
+		}
+		dependencies[key] = js.Instance(name)
+	}
+	if ms != nil {
+		dependencies["mongodb"] = ms
+	}
+	if storage != nil {
+		dependencies["storage"] = storage
+	}
+
+	return &HealthHandler{
+		dependencies: dependencies,
+		timeout:      timeout,
+		logger:       log,
+		down:         make(map[string]bool),
+	}
+}
+
+// OnRecovery adds a listener told of each dependency passing a check after
+// failing the previous one, so that work that failed meanwhile can catch up
+func (h *HealthHandler) OnRecovery(listener func(name string)) {
+	h.onRecovery = append(h.onRecovery, listener)
+}
+
+// Livez godoc
+// @Summary      Liveness probe
+// @Description  Reports that the process is up, without checking any dependencies
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  models.HealthResponse
+// @Router       /livez [get]
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{
+		Status:    "ok",
+		Services:  map[string]string{"api": dependencyOK},
+		Timestamp: time.Now().Unix(),
+	})
 }
 
-// HealthCheckGin godoc
-// @Summary      Health check endpoint
-// @Description  Get the status of the server and all its dependencies including Jira, MongoDB, and S3 connections
+// Readyz godoc
+// @Summary      Readiness probe
+// @Description  Checks every Jira instance, MongoDB and object storage, each with its own timeout. Responds 503 with the status of every dependency when a configured one is unreachable; dependencies that are not configured are reported as disabled.
 // @Tags         health
-// @Accept       json
 // @Produce      json
-// @Success      200  {object}  models.HealthResponse "System healthy with status of all services"
-// @Failure      503  {object}  models.ErrorResponse "System unhealthy with details about failed services"
+// @Success      200  {object}  models.HealthResponse "All configured dependencies are reachable"
+// @Failure      503  {object}  models.HealthResponse "A configured dependency is unreachable"
+// @Router       /readyz [get]
 // @Router       /health [get]
-func HealthCheckGin(c *gin.Context) {
-	// Initialize with system status
+func (h *HealthHandler) Readyz(c *gin.Context) {
 	health := models.HealthResponse{
-		Status: "ok",
-		Services: map[string]string{
-			"api":     "ok",
-			"jira":    "unknown", // Will be updated based on actual service status
-			"mongodb": "unknown",
-			"s3":      "unknown",
-		},
+		Status:    "ok",
+		Services:  map[string]string{"api": dependencyOK},
 		Timestamp: time.Now().Unix(),
 	}
 
-	// Add status for services if they can be checked
-	// These would typically come from dependency injection, but for simplicity
-	// we're just listing them in the response
+	for name, result := range h.Check(c.Request.Context()) {
+		health.Services[name] = result.Status
+		if result.Status == dependencyError {
+			health.Status = "degraded"
+		}
+	}
+
+	code := http.StatusOK
+	if health.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, health)
+}
+
+// DependencyStatus is the outcome of checking one dependency
+type DependencyStatus struct {
+	Status  string
+	Latency time.Duration
+	Err     error
+}
+
+// FailedDependency is the status of a dependency that is configured but
+// could not be set up
+func FailedDependency(err error) DependencyStatus {
+	return DependencyStatus{Status: dependencyError, Err: err}
+}
+
+// OK reports whether the dependency is reachable or not configured
+func (s DependencyStatus) OK() bool {
+	return s.Status != dependencyError
+}
+
+// Check pings every configured dependency concurrently, each within the
+// readiness timeout
+func (h *HealthHandler) Check(ctx context.Context) map[string]DependencyStatus {
+	results := make(map[string]DependencyStatus, len(h.dependencies))
 
-	// In a real implementation, we'd have access to these services
-	// and perform actual health checks
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, dep := range h.dependencies {
+		if dep == nil {
+			mu.Lock()
+			results[name] = DependencyStatus{Status: dependencyDisabled}
+			mu.Unlock()
+			continue
+		}
 
-	// Example status updates:
-	// if jiraService != nil && jiraService.IsHealthy() {
-	//    health.Services["jira"] = "ok"
-	// } else {
-	//    health.Services["jira"] = "error"
-	//    health.Status = "degraded"
-	// }
+		wg.Add(1)
+		go func(name string, dep pinger) {
+			defer wg.Done()
+			result := h.check(ctx, name, dep)
 
-	c.JSON(http.StatusOK, health)
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+		}(name, dep)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Monitor returns a worker checking every dependency each interval, so the
+// dependency health gauges stay current when nothing polls /readyz
+func (h *HealthHandler) Monitor(interval time.Duration) services.Worker {
+	return func(ctx context.Context, stopping <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopping:
+				return
+			case <-ticker.C:
+				h.Check(ctx)
+			}
+		}
+	}
 }
 
-func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(payload)
+// check pings a dependency within the readiness timeout
+func (h *HealthHandler) check(ctx context.Context, name string, dep pinger) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := dep.Ping(ctx)
+	result := DependencyStatus{Status: dependencyOK, Latency: time.Since(start), Err: err}
+	services.RecordDependencyCheck(name, err == nil, result.Latency)
+	if err != nil {
+		logger.FromContext(ctx, h.logger).Warn("Readiness check failed", zap.String("dependency", name), zap.Error(err))
+		result.Status = dependencyError
+	}
+	h.record(name, err == nil)
+	return result
 }
 
-func checkJiraHealth() string {
-	// Implementation of checkJiraHealth function
-	return "ok"
+// record keeps whether a dependency is down and tells the recovery listeners
+// when it is back up
+func (h *HealthHandler) record(name string, up bool) {
+	h.mu.Lock()
+	recovered := up && h.down[name]
+	if up {
+		delete(h.down, name)
+	} else {
+		h.down[name] = true
+	}
+	h.mu.Unlock()
+
+	if recovered {
+		h.logger.Info("Dependency recovered", zap.String("dependency", name))
+		for _, listener := range h.onRecovery {
+			listener(name)
+		}
+	}
 }
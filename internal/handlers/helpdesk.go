@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+type HelpdeskHandler struct {
+	helpdesk *services.HelpdeskSync
+	logger   *zap.Logger
+	validate *validator.Validate
+}
+
+// NewHelpdeskHandler creates a handler for webhooks of the helpdesk
+func NewHelpdeskHandler(helpdesk *services.HelpdeskSync, log *zap.Logger, validate *validator.Validate) *HelpdeskHandler {
+	return &HelpdeskHandler{
+		helpdesk: helpdesk,
+		logger:   log,
+		validate: validate,
+	}
+}
+
+// HelpdeskWebhook godoc
+// @Summary      Receive helpdesk webhook
+// @Description  Adds the reporter's reply on a Zendesk or Freshdesk ticket, or else its change of status, to the internal ticket it was opened for as a comment, and stores the helpdesk status. Requires the write scope; configure the helpdesk webhook to send an API key. Changes to helpdesk tickets not opened by ronnin are acknowledged with status "ignored".
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body      models.HelpdeskWebhookRequest  true  "Change to a helpdesk ticket"
+// @Success      200  {object}  map[string]string "Status of the delivery"
+// @Failure      400  {object}  models.ErrorResponse "Invalid request"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse "Credentials lack the write scope"
+// @Failure      502  {object}  models.ErrorResponse "Tracker or MongoDB request failed"
+// @Router       /webhooks/helpdesk [post]
+func (h *HelpdeskHandler) HelpdeskWebhook(c *gin.Context) {
+	var req models.HelpdeskWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx, h.logger).With(zap.String("helpdesk_ticket_id", req.TicketID))
+	ticket, err := h.helpdesk.HelpdeskUpdated(ctx, services.HelpdeskEvent{
+		HelpdeskTicketID: req.TicketID,
+		Status:           req.Status,
+		Comment:          strings.TrimSpace(req.Comment),
+		Author:           req.Author,
+	})
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		// Tickets not opened by ronnin trigger the webhook too
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		return
+	}
+	if err != nil {
+		log.Warn("Failed to apply helpdesk webhook", zap.Error(err))
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error:   "Failed to update ticket",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	log.Info("Updated ticket from helpdesk webhook", zap.String("ticket_id", ticket.TicketID), zap.String("helpdesk_status", ticket.HelpdeskStatus))
+	c.JSON(http.StatusOK, gin.H{"status": "updated"})
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/middleware"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// maxIngestBodySize caps the decompressed size of an SDK batch
+const maxIngestBodySize = 5 << 20
+
+// capturedContext is what the browser SDK captured with a report
+type capturedContext struct {
+	SDK         string                `json:"sdk,omitempty"`
+	Console     []models.ConsoleEntry `json:"console,omitempty"`
+	Breadcrumbs []models.Breadcrumb   `json:"breadcrumbs,omitempty"`
+}
+
+// Ingest godoc
+// @Summary      Ingest browser SDK reports
+// @Description  Accepts a batch of up to 20 reports captured by the browser SDK, with console logs, breadcrumbs, device info and failed network calls, and files each like /report-issue. The body may be sent with Content-Encoding gzip or deflate, up to 5 MiB decompressed. Each report gets a result in order, with the status it would have got on its own; reports are queued with async=true or a "Prefer: respond-async" header. Screenshots are referenced by imageS3Key or uploadId after uploading them through /uploads.
+// @Tags         reports
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body      models.IngestBatch  true  "Reports captured by the SDK"
+// @Param        async    query     bool                false "Queue the reports and return their status instead of waiting for the tickets"
+// @Param        Content-Encoding header string false "gzip or deflate"
+// @Success      200  {object}  models.IngestResponse "Result of each report"
+// @Failure      400  {object}  models.ErrorResponse "Malformed or invalid batch"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid API key when API_KEY_AUTH is enabled"
+// @Failure      403  {object}  models.ErrorResponse "API key lacks the required scope, or the CAPTCHA or proof of work was rejected"
+// @Failure      413  {object}  models.ErrorResponse "Batch exceeds 5 MiB decompressed"
+// @Failure      429  {object}  models.ErrorResponse "Rate limit exceeded; retry after the Retry-After header"
+// @Failure      503  {object}  models.ErrorResponse "Reporting is under maintenance; retry after the Retry-After header"
+// @Router       /ingest [post]
+func (h *ReportHandler) Ingest(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx, h.logger)
+
+	queue, ok := h.admitReport(c)
+	if !ok {
+		return
+	}
+
+	body, err := decodedBody(c, maxIngestBodySize)
+	if err != nil {
+		writeBindError(c, err)
+		return
+	}
+	defer body.Close()
+
+	var batch models.IngestBatch
+	if err := json.NewDecoder(body).Decode(&batch); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := h.validate.Struct(batch); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	sdk := strings.TrimSpace(batch.SDK.Name + "/" + batch.SDK.Version)
+	if sdk == "/" {
+		sdk = ""
+	}
+	async := h.queue != nil && (queue || wantsAsync(c))
+	results := make([]models.IngestResult, len(batch.Reports))
+	for i := range batch.Reports {
+		results[i] = h.ingestReport(c, &batch.Reports[i], sdk, async)
+	}
+
+	log.Info("Ingested SDK batch", zap.String("sdk", sdk), zap.Int("reports", len(results)))
+	c.JSON(http.StatusOK, models.IngestResponse{Results: results})
+}
+
+// ingestReport files a report of an SDK batch through the report pipeline
+func (h *ReportHandler) ingestReport(c *gin.Context, report *models.IngestReport, sdk string, async bool) models.IngestResult {
+	ctx := c.Request.Context()
+	result := models.IngestResult{ID: report.ID}
+	fail := func(err error) models.IngestResult {
+		var rerr *reportError
+		if !errors.As(err, &rerr) {
+			logger.FromContext(ctx, h.logger).Error("Failed to process SDK report", zap.Error(err))
+			rerr = &reportError{status: http.StatusInternalServerError, resp: models.ErrorResponse{
+				Error:   "Failed to process report",
+				Details: err.Error(),
+			}}
+		}
+		result.Status = rerr.status
+		result.Error = &rerr.resp
+		return result
+	}
+
+	req, err := ingestRequest(report)
+	if err != nil {
+		return fail(err)
+	}
+	h.redactReport(&req)
+
+	if req.UploadID != "" && req.ImageS3Key == "" {
+		if rerr := h.resolveUploadSession(ctx, &req); rerr != nil {
+			return fail(rerr)
+		}
+	}
+	if missing := h.forms.Load().missingFields(&req, false); len(missing) > 0 {
+		messages := make([]string, 0, len(missing))
+		for _, field := range missing {
+			messages = append(messages, field.Message)
+		}
+		return fail(&reportError{status: http.StatusBadRequest, resp: models.ErrorResponse{
+			Error:   "Validation failed",
+			Code:    "validation_failed",
+			Details: strings.Join(messages, "; "),
+			Fields:  missing,
+		}})
+	}
+
+	src := reportSource{
+		ClientIP:    c.ClientIP(),
+		ContentType: "application/json",
+		Client:      mergeClient(middleware.CurrentClient(c), report.Device),
+		Captured:    h.redactCaptured(sdk, report),
+	}
+
+	if async {
+		status, err := h.queueIngested(ctx, req, src)
+		if err != nil {
+			logger.FromContext(ctx, h.logger).Warn("Failed to queue SDK report", zap.Error(err))
+			return fail(&reportError{status: http.StatusServiceUnavailable, resp: models.ErrorResponse{
+				Error:   "Report queue unavailable",
+				Code:    "queue_unavailable",
+				Details: "The report could not be queued, please try again later",
+			}})
+		}
+		result.Status = http.StatusAccepted
+		result.Report = status
+		return result
+	}
+
+	response, err := h.processReport(ctx, req, nil, src)
+	if err != nil {
+		return fail(err)
+	}
+	result.Status = http.StatusCreated
+	result.Ticket = response
+	return result
+}
+
+// queueIngested queues a report of an SDK batch, which has no file to keep
+func (h *ReportHandler) queueIngested(ctx context.Context, req models.ReportIssueRequest, src reportSource) (*models.ReportStatus, error) {
+	saved := savedReport{Request: req, Source: src, RequestID: logger.RequestID(ctx), Tenant: services.TenantID(ctx)}
+	if h.queue.Brokered() {
+		return h.queue.SubmitJob(ctx, reportJobKind, saved)
+	}
+	return h.queue.Submit(func(ctx context.Context) (*models.TicketResponse, error) {
+		return h.processReport(saved.context(ctx), req, nil, src)
+	}, nil, func(string) (string, interface{}, error) {
+		return reportJobKind, saved, nil
+	})
+}
+
+// ingestRequest maps an SDK report to a report request, with its failed
+// calls in the shape of /report-issue
+func ingestRequest(report *models.IngestReport) (models.ReportIssueRequest, error) {
+	calls := make([]models.NetworkCall, 0, len(report.FailedCalls))
+	for _, failed := range report.FailedCalls {
+		var call models.NetworkCall
+		call.RequestData.Method = strings.ToUpper(failed.Method)
+		call.RequestData.URL = failed.URL
+		if failed.RequestBody != "" {
+			call.RequestData.Body = failed.RequestBody
+		}
+		call.ResponseStatus = failed.Status
+		call.ResponseBody = failed.ResponseBody
+		call.PageURL = report.PageURL
+		if failed.Timestamp > 0 {
+			call.Timestamp = time.UnixMilli(failed.Timestamp).UTC().Format(time.RFC3339Nano)
+		}
+		calls = append(calls, call)
+	}
+	encoded, err := json.Marshal(calls)
+	if err != nil {
+		return models.ReportIssueRequest{}, fmt.Errorf("failed to encode failed calls: %w", err)
+	}
+
+	return models.ReportIssueRequest{
+		Issue:              report.Issue,
+		Description:        report.Description,
+		UserEmail:          report.UserEmail,
+		LeadID:             report.LeadID,
+		Product:            report.Product,
+		Severity:           report.Severity,
+		FailedNetworkCalls: string(encoded),
+		PageURL:            report.PageURL,
+		ImageS3Key:         report.ImageS3Key,
+		UploadID:           report.UploadID,
+	}, nil
+}
+
+// redactCaptured returns the console logs and breadcrumbs of a report,
+// redacted, or nil when the SDK captured nothing
+func (h *ReportHandler) redactCaptured(sdk string, report *models.IngestReport) *capturedContext {
+	if sdk == "" && len(report.Console) == 0 && len(report.Breadcrumbs) == 0 {
+		return nil
+	}
+	captured := &capturedContext{SDK: sdk}
+	for _, entry := range report.Console {
+		entry.Message = h.redactor.String(entry.Message)
+		captured.Console = append(captured.Console, entry)
+	}
+	for _, crumb := range report.Breadcrumbs {
+		crumb.Message = h.redactor.String(crumb.Message)
+		crumb.Data = h.redactor.StringMap(crumb.Data)
+		captured.Breadcrumbs = append(captured.Breadcrumbs, crumb)
+	}
+	return captured
+}
+
+// mergeClient combines the client parsed from request headers with the
+// device info sent by the SDK, which takes precedence
+func mergeClient(headers, device *models.ClientEnvironment) *models.ClientEnvironment {
+	if device == nil {
+		return headers
+	}
+	merged := models.ClientEnvironment{}
+	if headers != nil {
+		merged = *headers
+	}
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&merged.Browser, device.Browser},
+		{&merged.BrowserVersion, device.BrowserVersion},
+		{&merged.OS, device.OS},
+		{&merged.OSVersion, device.OSVersion},
+		{&merged.Device, device.Device},
+		{&merged.Screen, device.Screen},
+		{&merged.Viewport, device.Viewport},
+		{&merged.Locale, device.Locale},
+		{&merged.Timezone, device.Timezone},
+		{&merged.UserAgent, device.UserAgent},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if merged.IsZero() {
+		return nil
+	}
+	return &merged
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/middleware"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+type IssueHandler struct {
+	mongoService *services.MongoDBService
+	logger       *zap.Logger
+}
+
+// NewIssueHandler creates a handler grouping the tickets stored in MongoDB,
+// which may be nil, into issues
+func NewIssueHandler(ms *services.MongoDBService, log *zap.Logger) *IssueHandler {
+	return &IssueHandler{
+		mongoService: ms,
+		logger:       log,
+	}
+}
+
+// ListIssues godoc
+// @Summary      List issues
+// @Description  Groups tickets by the fingerprint of the failure reported, its product and failed endpoints or, without failed calls, its issue text, into issues listed most recently seen first. Each issue counts its reports, including those added to its tickets in high-volume mode, and its affected users, and links all its tickets. Callers limited to products only get the issues of those products.
+// @Tags         tickets
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        product   query     string  false  "Only issues of this product"
+// @Param        since     query     string  false  "Only reports since this time, RFC 3339"
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]models.IssueGroup}
+// @Failure      400  {object}  models.ErrorResponse "Invalid since, page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /issues [get]
+func (h *IssueHandler) ListIssues(c *gin.Context) {
+	if h.mongoService == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Issues not available",
+			Details: "MongoDB is not configured",
+		})
+		return
+	}
+	if !authorize(c, services.ActionReadTicket) {
+		return
+	}
+
+	p, ok := parsePageRequest(c)
+	if !ok {
+		return
+	}
+	offset := int64(p.Page-1) * int64(p.PageSize)
+	if p.Cursor != "" {
+		var err error
+		if offset, err = strconv.ParseInt(p.Cursor, 10, 64); err != nil || offset < 0 {
+			writeFieldErrors(c, []models.FieldError{invalidCursor})
+			return
+		}
+	}
+
+	filter := services.IssueFilter{
+		Scope:   middleware.CurrentPrincipal(c).Scope(),
+		Product: c.Query("product"),
+	}
+	if since := c.Query("since"); since != "" {
+		at, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeFieldErrors(c, []models.FieldError{{
+				Field: "since", Rule: "datetime", Code: "invalid_format",
+				Message: "since must be an RFC 3339 time such as 2024-05-01T00:00:00Z",
+			}})
+			return
+		}
+		filter.Since = at.UTC()
+	}
+
+	issues, total, err := h.mongoService.IssueGroups(c.Request.Context(), filter, offset, int64(p.PageSize))
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to group tickets into issues", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to retrieve issues",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	var next string
+	if end := offset + int64(len(issues)); end < total {
+		next = strconv.FormatInt(end, 10)
+	}
+	writePage(c, issues, p, total, next)
+}
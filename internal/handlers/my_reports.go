@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// maxReporterTickets caps the submissions listed on a status page
+const maxReporterTickets = 50
+
+type MyReportsHandler struct {
+	mongoService *services.MongoDBService
+	tokens       *services.StatusTokens
+	logger       *zap.Logger
+
+	// tenants own the tickets of their Jira projects; nil without tenants
+	tenants *services.Tenants
+}
+
+func NewMyReportsHandler(ms *services.MongoDBService, tokens *services.StatusTokens, log *zap.Logger) *MyReportsHandler {
+	return &MyReportsHandler{
+		mongoService: ms,
+		tokens:       tokens,
+		logger:       log,
+	}
+}
+
+// SetTenants sets the tenants whose tickets status pages may show
+func (h *MyReportsHandler) SetTenants(tenants *services.Tenants) {
+	h.tenants = tenants
+}
+
+// GetMyReports godoc
+// @Summary      Reporter status page
+// @Description  Lists the status of a reporter's submissions, authorized by the signed token of the statusUrl returned when a report is created. Tokens of reports with a userEmail list that reporter's recent submissions; tokens of anonymous reports show only their own ticket.
+// @Tags         reports
+// @Produce      json
+// @Param        token  path      string  true  "Status page token"
+// @Success      200  {object}  models.MyReportsResponse
+// @Failure      404  {object}  models.ErrorResponse "Invalid token or ticket not found"
+// @Failure      410  {object}  models.ErrorResponse "Token expired"
+// @Failure      500  {object}  models.ErrorResponse "Error retrieving tickets"
+// @Failure      503  {object}  models.ErrorResponse "Database not configured"
+// @Router       /my-reports/{token} [get]
+func (h *MyReportsHandler) GetMyReports(c *gin.Context) {
+	// The token grants access, so it must not leak through caches or referrers
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+
+	claims, err := h.tokens.Verify(c.Param("token"))
+	if errors.Is(err, services.ErrStatusTokenExpired) {
+		c.JSON(http.StatusGone, models.ErrorResponse{
+			Error:   "Status link expired",
+			Code:    "token_expired",
+			Details: "This status link has expired, please use the link of a more recent report",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Status page not found",
+			Code:  "invalid_token",
+		})
+		return
+	}
+
+	if h.mongoService == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Database not available",
+			Details: "MongoDB service is not configured",
+		})
+		return
+	}
+
+	var tickets []services.FlattenedTicket
+	if claims.Email != "" {
+		tickets, err = h.mongoService.GetTicketsByReporter(c.Request.Context(), claims.Email, maxReporterTickets)
+	} else {
+		var ticket *services.FlattenedTicket
+		ticket, err = h.mongoService.GetTicketByJiraID(h.tenants.TicketContext(c.Request.Context(), claims.TicketID), claims.TicketID)
+		if ticket != nil {
+			tickets = append(tickets, *ticket)
+		}
+	}
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to retrieve reporter tickets", zap.Error(err), zap.String("ticket_id", claims.TicketID))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to retrieve reports",
+		})
+		return
+	}
+	if len(tickets) == 0 {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Status page not found",
+			Code:  "report_not_found",
+		})
+		return
+	}
+
+	response := models.MyReportsResponse{Reports: make([]models.ReporterTicket, 0, len(tickets))}
+	for _, t := range tickets {
+		item := models.ReporterTicket{
+			TicketID:   t.TicketID,
+			Issue:      t.Issue,
+			Product:    t.Product,
+			Status:     t.Status,
+			Resolution: t.Resolution,
+			CreatedAt:  t.CreatedAt,
+		}
+		if !t.SyncedAt.IsZero() {
+			syncedAt := t.SyncedAt
+			item.UpdatedAt = &syncedAt
+		}
+		response.Reports = append(response.Reports, item)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
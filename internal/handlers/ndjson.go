@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MIMENDJSON is the content type of newline-delimited JSON list responses
+const MIMENDJSON = "application/x-ndjson"
+
+// ndjsonFlushEvery is the number of streamed items sent per flush
+const ndjsonFlushEvery = 100
+
+// wantsNDJSON reports whether the client prefers newline-delimited JSON over
+// a JSON array, as negotiated from the Accept header
+func wantsNDJSON(c *gin.Context) bool {
+	return c.NegotiateFormat(gin.MIMEJSON, MIMENDJSON) == MIMENDJSON
+}
+
+// writeList responds with items as a JSON array, a page of them on paginated
+// routes, or one JSON object per line when the client accepts
+// application/x-ndjson
+func writeList[T any](c *gin.Context, items []T) {
+	if !wantsNDJSON(c) {
+		if paginated(c) {
+			writeSlicePage(c, items)
+			return
+		}
+		if items == nil {
+			items = []T{}
+		}
+		writeJSONTagged(c, items)
+		return
+	}
+
+	stream := newNDJSONStream(c)
+	for i := range items {
+		if err := stream.Write(&items[i]); err != nil {
+			return
+		}
+	}
+	stream.Flush()
+}
+
+// ndjsonStream writes newline-delimited JSON, flushing periodically so that
+// clients can process large lists as they arrive
+type ndjsonStream struct {
+	c       *gin.Context
+	enc     *json.Encoder
+	pending int
+}
+
+func newNDJSONStream(c *gin.Context) *ndjsonStream {
+	c.Header("Content-Type", MIMENDJSON)
+	c.Status(http.StatusOK)
+	return &ndjsonStream{c: c, enc: json.NewEncoder(c.Writer)}
+}
+
+// Write encodes v as a single line
+func (s *ndjsonStream) Write(v interface{}) error {
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	s.pending++
+	if s.pending >= ndjsonFlushEvery {
+		s.Flush()
+	}
+	return nil
+}
+
+// Flush sends the lines written so far
+func (s *ndjsonStream) Flush() {
+	s.pending = 0
+	s.c.Writer.Flush()
+}
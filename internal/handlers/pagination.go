@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// Number of items per page of list endpoints
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// invalidCursor describes a cursor that was not issued by this server
+var invalidCursor = models.FieldError{
+	Field:   "cursor",
+	Rule:    "cursor",
+	Code:    "invalid_format",
+	Message: "cursor must be the nextCursor of a previous page",
+}
+
+// paginatedKey marks requests whose list responses are paginated
+const paginatedKey = "handlers.paginated"
+
+// PaginatedLists makes list endpoints respond with a page of items in a
+// models.ListResponse envelope instead of a JSON array of all items
+func PaginatedLists() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(paginatedKey, true)
+		c.Next()
+	}
+}
+
+// paginated reports whether list responses of the request are paginated
+func paginated(c *gin.Context) bool {
+	return c.GetBool(paginatedKey)
+}
+
+// pageRequest selects a page of a list, either by the page number or by the
+// cursor returned with the previous page
+type pageRequest struct {
+	Page     int
+	PageSize int
+	// Cursor is the decoded cursor; empty when selecting by page number
+	Cursor string
+}
+
+// parsePageRequest reads the page, pageSize and cursor query parameters. It
+// writes an error response and returns false if they are invalid.
+func parsePageRequest(c *gin.Context) (pageRequest, bool) {
+	p := pageRequest{Page: 1, PageSize: defaultPageSize}
+	var fields []models.FieldError
+
+	if value := c.Query("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			fields = append(fields, models.FieldError{
+				Field: "page", Rule: "min", Param: "1", Code: "out_of_range",
+				Message: "page must be a number of at least 1",
+			})
+		}
+		p.Page = page
+	}
+
+	if value := c.Query("pageSize"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 || size > maxPageSize {
+			fields = append(fields, models.FieldError{
+				Field: "pageSize", Rule: "max", Param: strconv.Itoa(maxPageSize), Code: "out_of_range",
+				Message: fmt.Sprintf("pageSize must be a number between 1 and %d", maxPageSize),
+			})
+		}
+		p.PageSize = size
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(cursor) == 0 {
+			fields = append(fields, invalidCursor)
+		}
+		p.Cursor = string(cursor)
+	}
+
+	if len(fields) > 0 {
+		writeFieldErrors(c, fields)
+		return pageRequest{}, false
+	}
+	return p, true
+}
+
+// writePage responds with a page of items, linking the next and first pages.
+// next is the raw cursor of the following page, empty on the last page.
+func writePage[T any](c *gin.Context, items []T, p pageRequest, total int64, next string) {
+	if items == nil {
+		items = []T{}
+	}
+	response := models.ListResponse{
+		Data:     items,
+		PageSize: p.PageSize,
+		Total:    total,
+	}
+	if p.Cursor == "" {
+		response.Page = p.Page
+	}
+
+	if next != "" {
+		response.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(next))
+		c.Writer.Header().Add("Link", pageLink(c, response.NextCursor, "next"))
+	}
+	c.Writer.Header().Add("Link", pageLink(c, "", "first"))
+
+	writeJSONTagged(c, response)
+}
+
+// pageLink links the page at cursor, or the first page when cursor is empty,
+// keeping the other query parameters of the request
+func pageLink(c *gin.Context, cursor, rel string) string {
+	query := c.Request.URL.Query()
+	query.Del("page")
+	query.Del("cursor")
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	u := *c.Request.URL
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf("<%s>; rel=%q", u.RequestURI(), rel)
+}
+
+// writeSlicePage responds with a page of a list held in memory; its cursors
+// are offsets into the list
+func writeSlicePage[T any](c *gin.Context, items []T) {
+	p, ok := parsePageRequest(c)
+	if !ok {
+		return
+	}
+
+	offset := (p.Page - 1) * p.PageSize
+	if p.Cursor != "" {
+		var err error
+		if offset, err = strconv.Atoi(p.Cursor); err != nil || offset < 0 {
+			writeFieldErrors(c, []models.FieldError{invalidCursor})
+			return
+		}
+	}
+
+	start := min(offset, len(items))
+	end := min(start+p.PageSize, len(items))
+	var next string
+	if end < len(items) {
+		next = strconv.Itoa(end)
+	}
+	writePage(c, items[start:end], p, int64(len(items)), next)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/middleware"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+)
+
+// authorize responds with 403 unless the caller's role allows an action
+func authorize(c *gin.Context, action string) bool {
+	principal := middleware.CurrentPrincipal(c)
+	if principal.Can(action) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, models.ErrorResponse{
+		Error:   "Forbidden",
+		Details: fmt.Sprintf("Role %q of %s does not allow %s", principal.Role, principal.Name, action),
+	})
+	return false
+}
+
+// authorizeTicket responds with 403 unless the caller's role allows an
+// action, and with 404 when the ticket belongs to a product the caller may
+// not see, so its existence is not revealed
+func authorizeTicket(c *gin.Context, action string, ticket *services.FlattenedTicket) bool {
+	if !authorize(c, action) {
+		return false
+	}
+	if middleware.CurrentPrincipal(c).CanAccess(action, ticket) {
+		return true
+	}
+	c.JSON(http.StatusNotFound, models.ErrorResponse{
+		Error:   "Ticket not found",
+		Details: fmt.Sprintf("Ticket with ID %s not found", ticket.TicketID),
+	})
+	return false
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// screenshotField names the attachment of a report, which may be sent as a
+// file or as an uploaded object key, upload session or URL
+const screenshotField = "screenshot"
+
+// reportFields returns the value of each optional report field that a
+// product can require, by the name clients send it under
+var reportFields = map[string]func(req *models.ReportIssueRequest) string{
+	"userEmail":          func(req *models.ReportIssueRequest) string { return req.UserEmail },
+	"leadId":             func(req *models.ReportIssueRequest) string { return req.LeadID },
+	"pageUrl":            func(req *models.ReportIssueRequest) string { return req.PageURL },
+	"failedNetworkCalls": func(req *models.ReportIssueRequest) string { return req.FailedNetworkCalls },
+}
+
+// ProductForms lists the report fields each product requires in addition to
+// issue and description, keyed by lower-case product name
+type ProductForms map[string][]string
+
+// ParseProductForms parses required fields per product, written as
+// "lending=leadId,userEmail;insurance=userEmail". Field names are those of
+// the report request, plus "screenshot" for the attachment.
+func ParseProductForms(spec string) (ProductForms, error) {
+	forms := ProductForms{}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		product, fields, ok := strings.Cut(entry, "=")
+		product = strings.ToLower(strings.TrimSpace(product))
+		if !ok || product == "" {
+			return nil, fmt.Errorf("invalid product form %q: want product=field,field", entry)
+		}
+
+		for _, field := range strings.Split(fields, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if _, known := reportFields[field]; !known && field != screenshotField {
+				return nil, fmt.Errorf("unknown field %q for product %q; must be one of: %s", field, product, strings.Join(requirableFields(), ", "))
+			}
+			forms[product] = append(forms[product], field)
+		}
+	}
+	return forms, nil
+}
+
+func requirableFields() []string {
+	names := []string{screenshotField}
+	for name := range reportFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// missingFields lists the fields the report's product requires but that were
+// not sent. hasFile reports whether a screenshot file was uploaded.
+func (f ProductForms) missingFields(req *models.ReportIssueRequest, hasFile bool) []models.FieldError {
+	var missing []models.FieldError
+	for _, field := range f[strings.ToLower(strings.TrimSpace(req.Product))] {
+		var present bool
+		if field == screenshotField {
+			present = hasFile || req.ImageS3Key != "" || req.UploadID != "" || req.ImageS3URL != ""
+		} else {
+			present = strings.TrimSpace(reportFields[field](req)) != ""
+		}
+		if present {
+			continue
+		}
+		missing = append(missing, models.FieldError{
+			Field:   field,
+			Rule:    "required",
+			Param:   req.Product,
+			Code:    "required",
+			Message: fmt.Sprintf("%s is required for %s reports", field, req.Product),
+		})
+	}
+	return missing
+}
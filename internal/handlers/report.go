@@ -1,58 +1,182 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/parvez-capri/ronnin/internal/middleware"
 	"github.com/parvez-capri/ronnin/internal/models"
 	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
 	"go.uber.org/zap"
 )
 
 type ReportHandler struct {
-	jiraService *services.JiraService
-	s3Service   *services.S3Service
+	jiraService *services.JiraRegistry
+	storage     services.ObjectStorage
+	keys        *services.KeyTemplate
+	scanner     *services.UploadScanner
+	quarantine  *services.QuarantineService
+	sessions    *services.UploadSessionStore
+	queue       *services.ReportQueue
+	statusPages *services.StatusTokens
+	forms       atomic.Pointer[ProductForms] // replaced when the configuration is reloaded
+	environment string
+	redactor    *services.Redactor
 	logger      *zap.Logger
 	validate    *validator.Validate
+
+	// videoMaxSize caps the size of screen recordings in bytes; 0 disables the limit
+	videoMaxSize int64
+
+	// notifications announce new tickets in chat; nil disables them
+	notifications *services.Notifications
+	// emails confirm reports to reporters and tell assignees of their
+	// tickets; nil disables them
+	emails *services.EmailNotifications
+	// helpdesk opens customer-facing tickets for reporters; nil disables it
+	helpdesk *services.HelpdeskSync
+	// webhooks send ticket and failure events to subscribers; nil disables them
+	webhooks *services.WebhookDispatcher
+	// kafka publishes new tickets to a Kafka topic; nil disables it
+	kafka *services.KafkaEvents
+	// maintenance turns reports away or queues them while Jira is under
+	// maintenance; nil disables it
+	maintenance *services.Maintenance
 }
 
-func NewReportHandler(js *services.JiraService, s3s *services.S3Service, log *zap.Logger, validate *validator.Validate) *ReportHandler {
-	return &ReportHandler{
+func NewReportHandler(js *services.JiraRegistry, storage services.ObjectStorage, keys *services.KeyTemplate, scanner *services.UploadScanner, quarantine *services.QuarantineService, sessions *services.UploadSessionStore, queue *services.ReportQueue, statusPages *services.StatusTokens, forms ProductForms, environment string, redactor *services.Redactor, log *zap.Logger, validate *validator.Validate, videoMaxSize int64) *ReportHandler {
+	h := &ReportHandler{
 		jiraService: js,
-		s3Service:   s3s,
+		storage:     storage,
+		keys:        keys,
+		scanner:     scanner,
+		quarantine:  quarantine,
+		sessions:    sessions,
+		queue:       queue,
+		statusPages: statusPages,
+		environment: environment,
+		redactor:    redactor,
 		logger:      log,
 		validate:    validate,
+
+		videoMaxSize: videoMaxSize,
 	}
+	h.SetProductForms(forms)
+	if queue != nil {
+		queue.RegisterResumer(reportJobKind, h.resumeReport)
+	}
+	return h
+}
+
+// SetNotifications sets where new tickets are announced
+func (h *ReportHandler) SetNotifications(notifications *services.Notifications) {
+	h.notifications = notifications
+}
+
+// SetEmailNotifications sets how reporters and assignees are emailed about
+// new tickets
+func (h *ReportHandler) SetEmailNotifications(emails *services.EmailNotifications) {
+	h.emails = emails
+}
+
+// SetHelpdesk sets where reporters get a customer-facing ticket
+func (h *ReportHandler) SetHelpdesk(helpdesk *services.HelpdeskSync) {
+	h.helpdesk = helpdesk
+}
+
+// SetWebhooks sets where outbound webhooks of new tickets and failed
+// reports are sent
+func (h *ReportHandler) SetWebhooks(webhooks *services.WebhookDispatcher) {
+	h.webhooks = webhooks
+}
+
+// SetKafkaEvents sets where new tickets are published to Kafka
+func (h *ReportHandler) SetKafkaEvents(kafka *services.KafkaEvents) {
+	h.kafka = kafka
+}
+
+// SetMaintenance sets the maintenance mode reports are turned away or
+// queued in
+func (h *ReportHandler) SetMaintenance(maintenance *services.Maintenance) {
+	h.maintenance = maintenance
+}
+
+// SetProductForms replaces the fields required per product
+func (h *ReportHandler) SetProductForms(forms ProductForms) {
+	h.forms.Store(&forms)
 }
 
 // ReportIssue godoc
 // @Summary      Report an issue with screenshot upload
-// @Description  Creates a JIRA ticket for a reported issue with screenshots (uploaded to S3 with 7-day presigned URL) and network calls data. All data is persisted to MongoDB.
+// @Description  Creates a JIRA ticket for a reported issue with screenshots (uploaded to S3 with 7-day presigned URL) and network calls data. All data is persisted to MongoDB. Clients that host the screenshot elsewhere may instead POST the same fields as application/json with imageS3URL, and failedNetworkCalls as a JSON array or string. With async=true or a "Prefer: respond-async" header the report is queued and 202 is returned with a reportId to poll at /reports/{reportId}/status.
 // @Tags         reports
 // @Accept       multipart/form-data
+// @Accept       json
 // @Produce      json
+// @Security     ApiKeyAuth
 // @Param        issue formData string true "Issue title"
 // @Param        description formData string true "Issue description"
 // @Param        userEmail formData string false "User email"
 // @Param        leadId formData string false "Lead ID"
 // @Param        product formData string false "Product name"
+// @Param        severity formData string false "Severity given by the reporter: critical, high, medium or low; chooses where the ticket is announced"
 // @Param        pageUrl formData string false "Page URL where the issue occurred"
 // @Param        failedNetworkCalls formData string false "Failed network calls JSON string"
-// @Param        image0 formData file false "Screenshot image (will be uploaded to S3 with 7-day presigned URL)"
+// @Param        image0 formData file false "Screenshot image or mp4/webm screen recording (will be uploaded to S3 with 7-day presigned URL)"
+// @Param        imageS3Key formData string false "Object key of a file uploaded directly via /uploads/presign, used when image0 is not sent"
+// @Param        uploadId formData string false "ID of a completed resumable upload session, used when image0 and imageS3Key are not sent"
+// @Param        imageS3URL formData string false "URL of a screenshot hosted elsewhere, linked as given when no file or object key is sent"
+// @Param        async query bool false "Queue the report and return 202 instead of waiting for the ticket"
+// @Param        captchaToken formData string false "CAPTCHA token when REPORT_VERIFICATION is a CAPTCHA provider; may be sent in X-Captcha-Token instead"
+// @Param        X-Captcha-Token header string false "CAPTCHA token when REPORT_VERIFICATION is a CAPTCHA provider"
+// @Param        X-Proof-Of-Work header string false "Stamp <unix time>:<random>:<nonce> whose SHA-256 hash has POW_DIFFICULTY leading zero bits, when REPORT_VERIFICATION is pow"
+// @Param        X-Client-Screen header string false "Screen size of the reporter, e.g. 1080x2400@2.625, listed in the ticket when CLIENT_INFO is enabled"
+// @Param        X-Client-Viewport header string false "Browser window size of the reporter, e.g. 412x915"
+// @Param        X-Client-Locale header string false "Locale of the reporter's app, e.g. en-IN"
+// @Param        X-Client-Timezone header string false "IANA time zone of the reporter, e.g. Asia/Kolkata"
 // @Success      201  {object}  models.TicketResponse "Ticket created successfully with ticket ID, status, assigned user, and Jira link"
-// @Failure      400  {object}  models.ErrorResponse "Invalid request body or validation error"
+// @Success      202  {object}  models.ReportStatus "Report queued for processing; poll the Location header for its status"
+// @Failure      400  {object}  models.ErrorResponse "Invalid request body, validation error, or a field required for the product is missing"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid API key when API_KEY_AUTH is enabled"
+// @Failure      403  {object}  models.ErrorResponse "API key lacks the required scope, or the CAPTCHA or proof of work was rejected"
+// @Failure      413  {object}  models.ErrorResponse "Request body or screen recording exceeds the configured size limit"
+// @Failure      415  {object}  models.ErrorResponse "Unsupported video format"
+// @Failure      422  {object}  models.ErrorResponse "Uploaded file was rejected by the malware scanner"
+// @Failure      429  {object}  models.ErrorResponse "Rate limit exceeded; retry after the Retry-After header"
 // @Failure      500  {object}  models.ErrorResponse "Failed to create ticket or internal server error"
+// @Failure      503  {object}  models.ErrorResponse "Reporting is under maintenance, uploaded file could not be scanned for malware, the report queue is full or unavailable, the CAPTCHA provider is unreachable, or the issue tracker or object storage is saturated; retry after the Retry-After header"
+// @Failure      504  {object}  models.ErrorResponse "Issue tracker did not answer within TRACKER_TIMEOUT"
 // @Router       /report-issue [post]
 func (h *ReportHandler) ReportIssue(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context(), h.logger)
 	var req models.ReportIssueRequest
 
-	// Parse form data with detailed error logging
-	if err := c.ShouldBind(&req); err != nil {
-		h.logger.Error("Failed to bind request",
+	queue, ok := h.admitReport(c)
+	if !ok {
+		return
+	}
+
+	// Parse the JSON body or form data with detailed error logging
+	if err := bindReportRequest(c, &req); err != nil {
+		log.Error("Failed to bind request",
 			zap.Error(err),
+			zap.String("content_type", c.ContentType()),
 			zap.String("issue", c.PostForm("issue")),
 			zap.String("description", c.PostForm("description")),
 			zap.String("userEmail", c.PostForm("userEmail")),
@@ -60,75 +184,332 @@ func (h *ReportHandler) ReportIssue(c *gin.Context) {
 			zap.String("product", c.PostForm("product")),
 			zap.String("failedNetworkCalls", c.PostForm("failedNetworkCalls")),
 		)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "Invalid request body",
-			Details: err.Error(),
-		})
+		writeBindError(c, err)
 		return
 	}
 
 	// Validate request
 	if err := h.validate.Struct(req); err != nil {
-		h.logger.Error("Validation failed", zap.Error(err))
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "Validation failed",
-			Details: err.Error(),
-		})
+		log.Error("Validation failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
 		return
 	}
 
+	// Sensitive data is removed before the report is logged, queued or stored
+	h.redactReport(&req)
+
+	// A completed upload session stands in for a directly uploaded object key
+	if req.UploadID != "" && req.ImageS3Key == "" {
+		if err := h.resolveUploadSession(c.Request.Context(), &req); err != nil {
+			h.writeReportError(c, err)
+			return
+		}
+	}
+
 	// Handle file upload
 	file, err := c.FormFile("image0")
-	var imageURL string = "" // Initialize with empty string
+	if file != nil {
+		file.Filename = h.redactor.String(file.Filename)
+	}
 
-	// Log raw form data for debugging
-	fmt.Printf("\n=== RAW FORM DATA ===\n")
-	fmt.Printf("Raw image0 form value: %v\n", c.Request.FormValue("image0"))
-	fmt.Printf("Has file? %v\n", file != nil)
-	if err != nil {
-		fmt.Printf("FormFile error: %s\n", err)
-	}
-	formFile := c.Request.MultipartForm
-	if formFile != nil && formFile.File != nil {
-		fmt.Printf("Multipart form files: %v\n", formFile.File)
-		if files, exists := formFile.File["image0"]; exists {
-			fmt.Printf("Number of image0 files: %d\n", len(files))
-			for i, f := range files {
-				fmt.Printf("File %d: %s, size: %d\n", i, f.Filename, f.Size)
+	// Log the multipart files for debugging
+	if ce := log.Check(zap.DebugLevel, "Report form files"); ce != nil {
+		var files []string
+		if form := c.Request.MultipartForm; form != nil {
+			for field, headers := range form.File {
+				for _, f := range headers {
+					files = append(files, fmt.Sprintf("%s=%s (%d bytes)", field, h.redactor.String(f.Filename), f.Size))
+				}
 			}
-		} else {
-			fmt.Printf("No 'image0' found in multipart form\n")
 		}
-	} else {
-		fmt.Printf("No multipart form or empty form.File\n")
+		ce.Write(zap.Bool("has_image0", file != nil), zap.Strings("files", files))
+	}
+	if err != nil {
+		log.Info("No file uploaded or error getting file", zap.Error(err))
+		file = nil
+	}
+
+	// Products may require more fields than every report has
+	if missing := h.forms.Load().missingFields(&req, file != nil); len(missing) > 0 {
+		writeFieldErrors(c, missing)
+		return
+	}
+
+	src := reportSource{ClientIP: c.ClientIP(), ContentType: c.ContentType(), Client: middleware.CurrentClient(c)}
+
+	// In async mode, or in maintenance queue mode, the report is processed
+	// by a background worker
+	if h.queue != nil && (queue || wantsAsync(c)) {
+		h.enqueueReport(c, req, file, src)
+		return
+	}
+
+	response, err := h.processReport(c.Request.Context(), req, file, src)
+	if err != nil {
+		h.writeReportError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// redactReport redacts the free-text fields of a report
+func (h *ReportHandler) redactReport(req *models.ReportIssueRequest) {
+	req.Issue = h.redactor.String(req.Issue)
+	req.Description = h.redactor.String(req.Description)
+	req.Product = h.redactor.String(req.Product)
+	req.PageURL = h.redactor.String(req.PageURL)
+	req.FailedNetworkCalls = h.redactor.String(req.FailedNetworkCalls)
+}
+
+// reportSource describes the request a report was submitted with
+type reportSource struct {
+	ClientIP    string
+	ContentType string
+	// Client is the reporter's browser and device when client info is
+	// captured
+	Client *models.ClientEnvironment `json:",omitempty"`
+	// Captured is what the browser SDK captured with reports sent to
+	// /v1/ingest
+	Captured *capturedContext `json:",omitempty"`
+}
+
+// addClient adds the reporter's browser and device to the payload of a
+// ticket, where Jira descriptions show them as the environment, along with
+// the console logs and breadcrumbs captured by the browser SDK
+func (src reportSource) addClient(ticketReq *models.TicketRequest) {
+	if src.Client != nil {
+		ticketReq.Payload["client"] = src.Client
+	}
+	if captured := src.Captured; captured != nil {
+		if captured.SDK != "" {
+			ticketReq.Payload["sdk"] = captured.SDK
+		}
+		if len(captured.Console) > 0 {
+			ticketReq.Payload["console"] = captured.Console
+		}
+		if len(captured.Breadcrumbs) > 0 {
+			ticketReq.Payload["breadcrumbs"] = captured.Breadcrumbs
+		}
+	}
+}
+
+// processReport stores the attachment of a report and creates its ticket,
+// recording failures for usage analytics. Errors the client must see are
+// returned as *reportError.
+func (h *ReportHandler) processReport(ctx context.Context, req models.ReportIssueRequest, file *multipart.FileHeader, src reportSource) (*models.TicketResponse, error) {
+	response, err := h.createReportTicket(ctx, req, file, src)
+	if err != nil {
+		h.recordFailure(ctx, req.Product, err)
+	}
+	return response, err
+}
+
+// failureWriteTimeout bounds recording a failed report
+const failureWriteTimeout = 5 * time.Second
+
+// recordFailure stores a failed report in MongoDB, when it is configured,
+// and sends it to webhook subscribers. Failures to store it are logged only.
+func (h *ReportHandler) recordFailure(ctx context.Context, product string, err error) {
+	failure := &services.ReportFailure{
+		Product:   product,
+		Tenant:    services.TenantID(ctx),
+		Status:    http.StatusInternalServerError,
+		RequestID: logger.RequestID(ctx),
+		At:        time.Now().UTC(),
+	}
+	var rerr *reportError
+	if errors.As(err, &rerr) {
+		failure.Status = rerr.status
+		failure.Code = rerr.resp.Code
 	}
-	fmt.Printf("=== END RAW FORM DATA ===\n\n")
+	if h.webhooks != nil {
+		h.webhooks.ReportFailed(services.ReportFailedEventData{
+			Product:   failure.Product,
+			Status:    failure.Status,
+			Code:      failure.Code,
+			RequestID: failure.RequestID,
+		})
+	}
+
+	mongoService := h.jiraService.GetMongoService()
+	if mongoService == nil {
+		return
+	}
+	// The report may have failed because its context ended
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), failureWriteTimeout)
+	defer cancel()
+	if err := mongoService.SaveReportFailure(ctx, failure); err != nil {
+		logger.FromContext(ctx, h.logger).Warn("Failed to record report failure", zap.Error(err))
+	}
+}
+
+// createReportTicket does the work of processReport
+func (h *ReportHandler) createReportTicket(ctx context.Context, req models.ReportIssueRequest, file *multipart.FileHeader, src reportSource) (*models.TicketResponse, error) {
+	log := logger.FromContext(ctx, h.logger)
+	var err error
+	var imageURL string = "" // Initialize with empty string
+	var imageKey string
+	var imageExpiresAt time.Time
+	var quarantineKey string
+	var attachment *services.Attachment
+	var imageContentType string
+	var video *models.VideoMetadata
 
-	if err == nil && file != nil {
-		if h.s3Service != nil {
-			// Upload to S3
-			imageURL, err = h.s3Service.UploadFile(c.Request.Context(), file)
+	if file != nil {
+		imageContentType = services.UploadContentType(file)
+		if err := h.checkRecording(imageContentType, file.Size); err != nil {
+			return nil, err
+		}
+
+		// Scan before anything is written to storage
+		subject := services.ScanSubject{
+			Filename:  file.Filename,
+			Product:   req.Product,
+			UserEmail: req.UserEmail,
+			ClientIP:  src.ClientIP,
+		}
+		scanErr := h.scanner.CheckUpload(ctx, file, subject)
+		suspicious := errors.Is(scanErr, services.ErrSuspiciousFile) && h.quarantine != nil
+		if scanErr != nil && !suspicious {
+			return nil, h.scanRejection(ctx, scanErr)
+		}
+
+		if h.storage != nil {
+			checksum, err := services.ChecksumUpload(file)
+			if err != nil {
+				log.Warn("Failed to checksum upload", zap.Error(err))
+			}
+
+			// Identical content that is already stored is not uploaded again
+			var duplicate *services.Attachment
+			if checksum != "" && !suspicious {
+				duplicate, err = services.FindDuplicateUpload(ctx, h.storage, h.jiraService.GetMongoService(), checksum)
+				if err != nil {
+					log.Warn("Failed to look up duplicate upload", zap.Error(err))
+				}
+			}
+
+			// Upload to the configured object storage
+			meta := services.UploadMetadata{Product: req.Product, Environment: h.environment}
+			if duplicate != nil {
+				imageKey = duplicate.ObjectKey
+				imageURL, err = h.storage.PresignGetURL(ctx, imageKey)
+			} else {
+				imageKey, err = h.keys.NewKey(file.Filename, meta)
+				if err == nil {
+					if suspicious {
+						quarantineKey, err = h.quarantine.QuarantineUpload(ctx, file, imageKey, meta.Tags())
+					} else {
+						imageURL, err = h.storage.UploadFile(ctx, file, imageKey, meta.Tags())
+					}
+				}
+			}
+			if errors.Is(err, services.ErrPoolSaturated) {
+				return nil, overloadedError()
+			}
 			if err != nil {
-				h.logger.Error("Failed to upload file to S3", zap.Error(err))
+				imageKey = ""
+				quarantineKey = ""
+				log.Error("Failed to upload file to storage", zap.Error(err))
 				// Continue with the request, just without the image
 				imageURL = "" // Set to empty string if upload fails
 			} else {
-				h.logger.Info("File uploaded to S3 successfully", zap.String("url", imageURL))
+				switch {
+				case suspicious:
+					log.Warn("Suspicious upload quarantined pending review", zap.String("key", quarantineKey))
+				case duplicate != nil:
+					imageExpiresAt = time.Now().Add(h.storage.PresignExpiry())
+					log.Info("Upload matches stored content, reusing object", zap.String("key", imageKey))
+				default:
+					imageExpiresAt = time.Now().Add(h.storage.PresignExpiry())
+					log.Info("File uploaded to storage successfully", zap.String("url", imageURL))
+				}
+
+				if services.IsVideoContentType(imageContentType) {
+					if video, err = services.ProbeVideo(file, imageContentType); err != nil {
+						log.Warn("Failed to read screen recording metadata", zap.Error(err))
+					}
+				}
+
+				attachment = &services.Attachment{
+					ObjectKey:      storedKey(imageKey, quarantineKey),
+					Filename:       file.Filename,
+					Size:           file.Size,
+					ContentType:    imageContentType,
+					ChecksumSHA256: checksum,
+					Uploader:       req.UserEmail,
+				}
+				if suspicious {
+					attachment.Status = services.AttachmentStatusQuarantined
+				}
 			}
 		} else {
-			// S3 service not available
-			h.logger.Warn("S3 service not available, using placeholder URL")
+			// Object storage not available
+			log.Warn("Object storage not available, using placeholder URL")
 			imageURL = "https://example.com/placeholder.png"
 		}
-	} else {
-		h.logger.Info("No file uploaded or error getting file", zap.Error(err))
+	} else if req.ImageS3Key != "" {
+		// The client uploaded the file directly to storage via /uploads/presign
+		if !h.keys.Owns(req.ImageS3Key) {
+			return nil, &reportError{status: http.StatusBadRequest, resp: models.ErrorResponse{
+				Error:   "Invalid object key",
+				Details: "imageS3Key must reference an object returned by /uploads/presign",
+			}}
+		}
+
+		if h.storage == nil {
+			log.Warn("Object storage not available, ignoring uploaded object key", zap.String("key", req.ImageS3Key))
+		} else {
+			info, err := h.storage.StatObject(ctx, req.ImageS3Key)
+			if err != nil {
+				if errors.Is(err, services.ErrObjectNotFound) {
+					return nil, &reportError{status: http.StatusBadRequest, resp: models.ErrorResponse{
+						Error:   "Uploaded object not found",
+						Details: fmt.Sprintf("No object exists with key %s; upload the file before submitting the report", req.ImageS3Key),
+					}}
+				}
+				log.Error("Failed to verify uploaded object", zap.Error(err), zap.String("key", req.ImageS3Key))
+			} else if rejected := h.checkRecording(info.ContentType, info.Size); rejected != nil {
+				if err := h.storage.DeleteObject(ctx, req.ImageS3Key); err != nil {
+					log.Warn("Failed to delete oversized upload", zap.Error(err), zap.String("key", req.ImageS3Key))
+				}
+				return nil, rejected
+			} else if err := h.scanStoredObject(ctx, req, src.ClientIP); err != nil && !(errors.Is(err, services.ErrSuspiciousFile) && h.quarantine != nil) {
+				return nil, h.scanRejection(ctx, err)
+			} else if err != nil {
+				// Suspicious direct uploads are moved out of the upload prefix
+				if quarantineKey, err = h.quarantine.QuarantineObject(ctx, req.ImageS3Key); err != nil {
+					log.Error("Failed to quarantine uploaded object", zap.Error(err), zap.String("key", req.ImageS3Key))
+					quarantineKey = ""
+				} else {
+					imageKey = req.ImageS3Key
+					attachment = directAttachment(info, quarantineKey, req.UserEmail)
+					attachment.Status = services.AttachmentStatusQuarantined
+					log.Warn("Suspicious upload quarantined pending review", zap.String("key", quarantineKey))
+				}
+			} else if imageURL, err = h.storage.PresignGetURL(ctx, req.ImageS3Key); err != nil {
+				log.Error("Failed to presign uploaded object", zap.Error(err), zap.String("key", req.ImageS3Key))
+				imageURL = ""
+			} else {
+				imageKey = req.ImageS3Key
+				imageExpiresAt = time.Now().Add(h.storage.PresignExpiry())
+				imageContentType = info.ContentType
+				attachment = directAttachment(info, imageKey, req.UserEmail)
+				log.Info("Using directly uploaded object", zap.String("key", imageKey))
+			}
+		}
+	} else if req.ImageS3URL != "" {
+		// The screenshot is hosted elsewhere and linked as given
+		imageURL = req.ImageS3URL
+		log.Info("Using externally hosted screenshot", zap.String("url", imageURL))
 	}
 
 	// Parse network calls
 	networkCalls, err := req.GetNetworkCalls()
 	if err != nil {
 		// Log the error but continue with the request
-		h.logger.Warn("Processing network calls with fallback approach",
+		log.Warn("Processing network calls with fallback approach",
 			zap.Error(err),
 			zap.String("failedNetworkCalls", req.FailedNetworkCalls[:min(len(req.FailedNetworkCalls), 100)]),
 		)
@@ -137,7 +518,7 @@ func (h *ReportHandler) ReportIssue(c *gin.Context) {
 		var rawNetworkData interface{}
 		if jsonErr := json.Unmarshal([]byte(req.FailedNetworkCalls), &rawNetworkData); jsonErr == nil {
 			// Successfully parsed as generic JSON
-			h.logger.Info("Successfully parsed network calls as generic JSON")
+			log.Info("Successfully parsed network calls as generic JSON")
 
 			// Create ticket request with parsed JSON
 			ticketReq := &models.TicketRequest{
@@ -154,24 +535,29 @@ func (h *ReportHandler) ReportIssue(c *gin.Context) {
 					"status": "reported",
 				},
 				RequestHeaders: map[string]string{
-					"Content-Type": "multipart/form-data",
+					"Content-Type": src.ContentType,
 				},
-				ImageS3URL: imageURL,
+				ImageS3URL:        imageURL,
+				ImageS3Key:        imageKey,
+				ImageURLExpiresAt: imageExpiresAt,
+				QuarantineKey:     quarantineKey,
+				ImageContentType:  imageContentType,
+				Video:             video,
 			}
 
+			src.addClient(ticketReq)
+
 			// Create ticket with the parsed generic JSON
-			response, err := h.jiraService.CreateTicket(c.Request.Context(), ticketReq)
+			response, err := h.jiraService.CreateTicket(ctx, ticketReq)
 			if err != nil {
-				h.logger.Error("Failed to create ticket", zap.Error(err))
-				c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-					Error:   "Failed to create ticket",
-					Details: err.Error(),
-				})
-				return
+				log.Error("Failed to create ticket", zap.Error(err))
+				return nil, ticketCreationError(err)
 			}
 
-			c.JSON(http.StatusCreated, response)
-			return
+			h.recordAttachment(ctx, attachment, response.TicketID)
+			h.addStatusURL(ctx, response, req.UserEmail)
+			h.announce(ctx, req, ticketReq, response)
+			return response, nil
 		}
 
 		// Use empty array for structured network calls
@@ -187,6 +573,7 @@ func (h *ReportHandler) ReportIssue(c *gin.Context) {
 			"userEmail":           req.UserEmail,
 			"leadId":              req.LeadID,
 			"product":             req.Product,
+			"severity":            req.Severity,
 			"failedNetworkCalls":  networkCalls,
 			"rawNetworkCallsJSON": req.FailedNetworkCalls, // Always include the raw JSON
 		},
@@ -194,32 +581,695 @@ func (h *ReportHandler) ReportIssue(c *gin.Context) {
 			"status": "reported",
 		},
 		RequestHeaders: map[string]string{
-			"Content-Type": "multipart/form-data",
+			"Content-Type": src.ContentType,
 		},
-		ImageS3URL: imageURL,
+		ImageS3URL:        imageURL,
+		ImageS3Key:        imageKey,
+		ImageURLExpiresAt: imageExpiresAt,
+		QuarantineKey:     quarantineKey,
+		ImageContentType:  imageContentType,
+		Video:             video,
+	}
+	src.addClient(ticketReq)
+
+	// The image URL is presigned, so only whether there is one is logged
+	log.Debug("Creating ticket for report",
+		zap.Bool("has_image", imageURL != "" && imageURL != "None"),
+		zap.String("image_key", imageKey),
+	)
+
+	response, err := h.jiraService.CreateTicket(ctx, ticketReq)
+	if err != nil {
+		log.Error("Failed to create ticket", zap.Error(err))
+		return nil, ticketCreationError(err)
+	}
+
+	h.recordAttachment(ctx, attachment, response.TicketID)
+	h.addStatusURL(ctx, response, req.UserEmail)
+	h.announce(ctx, req, ticketReq, response)
+	return response, nil
+}
+
+// announce queues the chat notifications and emails of a new ticket, with
+// the severity given by the reporter or classified. Reports coalesced into
+// an existing ticket are not announced again.
+func (h *ReportHandler) announce(ctx context.Context, req models.ReportIssueRequest, ticketReq *models.TicketRequest, response *models.TicketResponse) {
+	if response.Status == services.TicketStatusCoalesced {
+		return
+	}
+	req.Severity = services.TicketSeverity(ticketReq)
+	tenant := services.TenantID(ctx)
+	if h.notifications != nil {
+		h.notifications.TicketCreated(services.Notification{
+			Tenant:   tenant,
+			TicketID: response.TicketID,
+			JiraLink: response.JiraLink,
+			Summary:  req.Issue,
+			Product:  req.Product,
+			Severity: req.Severity,
+			Assignee: response.AssignedTo,
+			Reporter: req.UserEmail,
+		})
+	}
+	if h.emails != nil {
+		h.emails.TicketCreated(services.TicketEmail{
+			TicketID:  response.TicketID,
+			JiraLink:  response.JiraLink,
+			StatusURL: response.StatusURL,
+			Summary:   req.Issue,
+			Product:   req.Product,
+			Severity:  req.Severity,
+			Reporter:  req.UserEmail,
+			Assignee:  response.AssignedTo,
+		})
+	}
+	if h.helpdesk != nil {
+		h.helpdesk.TicketCreated(services.HelpdeskTicket{
+			Requester:   req.UserEmail,
+			Subject:     req.Issue,
+			Description: req.Description,
+			Product:     req.Product,
+			Severity:    req.Severity,
+			TicketID:    response.TicketID,
+			TrackerLink: response.JiraLink,
+		})
 	}
+	event := services.TicketEventData{
+		TicketID:   response.TicketID,
+		JiraLink:   response.JiraLink,
+		Summary:    req.Issue,
+		Product:    req.Product,
+		Severity:   req.Severity,
+		Reporter:   req.UserEmail,
+		Status:     response.Status,
+		AssignedTo: response.AssignedTo,
+		Tenant:     tenant,
+	}
+	if ticketReq.Classification != nil {
+		event.Category = ticketReq.Classification.Category
+	}
+	if h.webhooks != nil {
+		h.webhooks.TicketCreated(event)
+	}
+	if h.kafka != nil {
+		h.kafka.TicketCreated(event)
+	}
+}
 
-	// Log the image URL that will be used
-	fmt.Printf("\n=== REPORT HANDLER: TICKET CREATION ===\n")
-	fmt.Printf("Image URL being used: %s\n", imageURL)
-	if imageURL == "" {
-		fmt.Printf("WARNING: Empty image URL will be passed to Jira service\n")
-	} else if imageURL == "None" {
-		fmt.Printf("WARNING: 'None' literal string will be passed to Jira service\n")
+// addStatusURL links the reporter status page of a newly created ticket
+func (h *ReportHandler) addStatusURL(ctx context.Context, response *models.TicketResponse, userEmail string) {
+	if h.statusPages == nil {
+		return
 	}
-	fmt.Printf("=== END REPORT HANDLER TICKET CREATION ===\n\n")
 
-	response, err := h.jiraService.CreateTicket(c.Request.Context(), ticketReq)
+	url, err := h.statusPages.URL(response.TicketID, userEmail)
 	if err != nil {
-		h.logger.Error("Failed to create ticket", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to create ticket",
-			Details: err.Error(),
+		logger.FromContext(ctx, h.logger).Warn("Failed to issue status page token", zap.Error(err), zap.String("ticket_id", response.TicketID))
+		return
+	}
+	response.StatusURL = url
+}
+
+// defaultMaintenanceRetryAfter is the Retry-After in seconds of reports
+// turned away by maintenance without an end
+const defaultMaintenanceRetryAfter = 300
+
+// admitReport checks the maintenance mode before a report is read. In reject
+// mode it answers with 503 and the maintenance message and returns false;
+// in queue mode it returns true for queue, as the report must be queued.
+func (h *ReportHandler) admitReport(c *gin.Context) (queue, ok bool) {
+	if h.maintenance == nil {
+		return false, true
+	}
+	state := h.maintenance.State()
+	if !state.Enabled {
+		return false, true
+	}
+	if state.Mode == services.MaintenanceQueue && h.queue != nil {
+		return true, true
+	}
+
+	retryAfter := defaultMaintenanceRetryAfter
+	if state.Until != nil {
+		retryAfter = max(int(math.Ceil(time.Until(*state.Until).Seconds())), 1)
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+		Error:   "Reporting is under maintenance",
+		Code:    "maintenance",
+		Details: state.Message,
+	})
+	return false, false
+}
+
+// wantsAsync reports whether the client asked for asynchronous processing
+func wantsAsync(c *gin.Context) bool {
+	if async, err := strconv.ParseBool(c.Query("async")); err == nil {
+		return async
+	}
+	for _, pref := range strings.Split(c.GetHeader("Prefer"), ",") {
+		if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueReport queues a report for background processing and responds with
+// its status. The uploaded multipart form is detached from the request so its
+// temporary files outlive the request, and are kept until the report no
+// longer can be retried.
+func (h *ReportHandler) enqueueReport(c *gin.Context, req models.ReportIssueRequest, file *multipart.FileHeader, src reportSource) {
+	if h.queue.Brokered() {
+		h.sendReport(c, req, file, src)
+		return
+	}
+
+	form := c.Request.MultipartForm
+	c.Request.MultipartForm = nil
+	ctx := c.Request.Context()
+	job := savedReport{RequestID: logger.RequestID(ctx), Tenant: services.TenantID(ctx)}
+
+	var release func()
+	if form != nil {
+		release = func() { form.RemoveAll() }
+	}
+
+	// Unfinished on shutdown, the report is saved with a copy of its file and
+	// its temporary files are removed
+	checkpoint := func(dir string) (string, interface{}, error) {
+		saved := savedReport{Request: req, Source: src, RequestID: job.RequestID, Tenant: job.Tenant}
+		if file != nil {
+			spooled, err := services.SpoolUpload(file, dir)
+			if err != nil {
+				return "", nil, err
+			}
+			saved.File = spooled
+		}
+		if release != nil {
+			release()
+		}
+		return reportJobKind, saved, nil
+	}
+
+	status, err := h.queue.Submit(func(ctx context.Context) (*models.TicketResponse, error) {
+		return h.processReport(job.context(ctx), req, file, src)
+	}, release, checkpoint)
+	if err != nil {
+		c.Request.MultipartForm = form
+		logger.FromContext(c.Request.Context(), h.logger).Warn("Failed to queue report", zap.Error(err))
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Report queue is full",
+			Code:    "queue_full",
+			Details: "Too many reports are waiting to be processed, please try again later",
 		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, response)
+	c.Header("Location", path.Join(path.Dir(c.Request.URL.Path), "reports", status.ID, "status"))
+	c.JSON(http.StatusAccepted, status)
+}
+
+// sendReport sends a report to the broker and responds with its status. Its
+// file is staged in object storage, so whichever instance processes the
+// report can read it.
+func (h *ReportHandler) sendReport(c *gin.Context, req models.ReportIssueRequest, file *multipart.FileHeader, src reportSource) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx, h.logger)
+
+	saved := savedReport{Request: req, Source: src, RequestID: logger.RequestID(ctx), Tenant: services.TenantID(ctx)}
+	if file != nil {
+		staged, err := h.stageUpload(ctx, file)
+		if err != nil {
+			log.Error("Failed to stage report file", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to queue report",
+				Details: err.Error(),
+			})
+			return
+		}
+		saved.Staged = staged
+	}
+
+	status, err := h.queue.SubmitJob(ctx, reportJobKind, saved)
+	if err != nil {
+		log.Warn("Failed to queue report", zap.Error(err))
+		if saved.Staged != nil {
+			if err := h.storage.DeleteObject(context.WithoutCancel(ctx), saved.Staged.Key); err != nil {
+				log.Warn("Failed to delete staged report file", zap.String("key", saved.Staged.Key), zap.Error(err))
+			}
+		}
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Report queue unavailable",
+			Code:    "queue_unavailable",
+			Details: "The report could not be queued, please try again later",
+		})
+		return
+	}
+
+	c.Header("Location", path.Join(path.Dir(c.Request.URL.Path), "reports", status.ID, "status"))
+	c.JSON(http.StatusAccepted, status)
+}
+
+// reportStagingPrefix is the object key prefix the files of brokered reports
+// are staged under until they are processed
+const reportStagingPrefix = "staging/reports/"
+
+// stageUpload stores the file of a brokered report in object storage
+func (h *ReportHandler) stageUpload(ctx context.Context, file *multipart.FileHeader) (*stagedUpload, error) {
+	if h.storage == nil {
+		return nil, errors.New("object storage is not configured")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer src.Close()
+
+	staged := &stagedUpload{
+		Key:         reportStagingPrefix + uuid.NewString() + path.Ext(file.Filename),
+		Filename:    file.Filename,
+		ContentType: file.Header.Get("Content-Type"),
+	}
+	if err := h.storage.UploadStream(ctx, staged.Key, src, file.Size, staged.ContentType, nil); err != nil {
+		return nil, err
+	}
+	return staged, nil
+}
+
+// reportJobKind is the kind of asynchronous reports saved on shutdown or sent
+// through a broker
+const reportJobKind = "report-issue"
+
+// savedReport is an asynchronous report saved on shutdown or sent through a
+// broker
+type savedReport struct {
+	Request models.ReportIssueRequest `json:"request"`
+	Source  reportSource              `json:"source"`
+	File    *services.SpooledUpload   `json:"file,omitempty"`
+	// Staged is the file of a brokered report
+	Staged *stagedUpload `json:"staged,omitempty"`
+	// RequestID is the ID of the request that submitted the report
+	RequestID string `json:"requestId,omitempty"`
+	// Tenant is the tenant the report was submitted for
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// context returns ctx carrying the request ID and tenant the report was
+// submitted with
+func (s savedReport) context(ctx context.Context) context.Context {
+	return services.WithTenant(logger.WithRequestID(ctx, s.RequestID), s.Tenant)
+}
+
+// stagedUpload is the file of a brokered report in object storage
+type stagedUpload struct {
+	Key         string `json:"key"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+}
+
+// resumeReport turns a report saved on shutdown back into a task
+func (h *ReportHandler) resumeReport(payload json.RawMessage) (services.ReportTask, func(), error) {
+	var saved savedReport
+	if err := json.Unmarshal(payload, &saved); err != nil {
+		return nil, nil, err
+	}
+
+	// Staged files are fetched by every attempt, and deleted once the
+	// report was processed
+	if saved.Staged != nil {
+		return func(ctx context.Context) (*models.TicketResponse, error) {
+			return h.processStagedReport(saved.context(ctx), saved)
+		}, nil, nil
+	}
+
+	var file *multipart.FileHeader
+	var release func()
+	if saved.File != nil {
+		var err error
+		if file, release, err = saved.File.Open(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return func(ctx context.Context) (*models.TicketResponse, error) {
+		return h.processReport(saved.context(ctx), saved.Request, file, saved.Source)
+	}, release, nil
+}
+
+// processStagedReport processes a brokered report with a local copy of its
+// staged file
+func (h *ReportHandler) processStagedReport(ctx context.Context, saved savedReport) (*models.TicketResponse, error) {
+	if h.storage == nil {
+		return nil, errors.New("object storage is not configured")
+	}
+	spooled, err := services.SpoolObject(ctx, h.storage, saved.Staged.Key, saved.Staged.Filename, saved.Staged.ContentType, os.TempDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch staged report file: %w", err)
+	}
+	file, release, err := spooled.Open()
+	if err != nil {
+		os.Remove(spooled.Path)
+		return nil, err
+	}
+	defer release()
+
+	response, err := h.processReport(ctx, saved.Request, file, saved.Source)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.storage.DeleteObject(ctx, saved.Staged.Key); err != nil {
+		logger.FromContext(ctx, h.logger).Warn("Failed to delete staged report file", zap.String("key", saved.Staged.Key), zap.Error(err))
+	}
+	return response, nil
+}
+
+// GetReportStatus godoc
+// @Summary      Get the status of an asynchronously submitted report
+// @Description  Returns the processing state of a report submitted with async=true, including the Jira ticket once it has been created. Statuses are kept in memory by the instance that accepted the report, or shared through MongoDB when reports go through a broker, and expire after REPORT_STATUS_TTL.
+// @Tags         reports
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        reportId path string true "Report ID returned by /report-issue"
+// @Success      200  {object}  models.ReportStatus
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid API key when API_KEY_AUTH is enabled"
+// @Failure      403  {object}  models.ErrorResponse "API key lacks the required scope"
+// @Failure      404  {object}  models.ErrorResponse "Unknown or expired report ID"
+// @Failure      429  {object}  models.ErrorResponse "Rate limit exceeded; retry after the Retry-After header"
+// @Failure      503  {object}  models.ErrorResponse "Asynchronous reports are not enabled"
+// @Router       /reports/{reportId}/status [get]
+func (h *ReportHandler) GetReportStatus(c *gin.Context) {
+	if h.queue == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Asynchronous reports not available",
+			Details: "Asynchronous report submission is not enabled on this server",
+		})
+		return
+	}
+
+	status, err := h.queue.Status(c.Request.Context(), c.Param("reportId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Report not found",
+			Code:    "report_not_found",
+			Details: fmt.Sprintf("No report exists with ID %s; its status may have expired", c.Param("reportId")),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// bindReportRequest binds a JSON body or multipart/urlencoded form into req
+// depending on the request content type. Multipart forms are parsed first so
+// that files beyond the router's MaxMultipartMemory are spooled to disk.
+func bindReportRequest(c *gin.Context, req *models.ReportIssueRequest) error {
+	defer logger.StartStage(c.Request.Context(), "bind")()
+	switch c.ContentType() {
+	case binding.MIMEJSON:
+		return c.ShouldBindJSON(req)
+	case binding.MIMEMultipartPOSTForm:
+		if _, err := c.MultipartForm(); err != nil {
+			return err
+		}
+	}
+	return c.ShouldBindWith(req, binding.Form)
+}
+
+// reportError is a failure of report processing that is reported to the
+// client with the given status
+type reportError struct {
+	status int
+	resp   models.ErrorResponse
+}
+
+func (e *reportError) ErrorCode() string {
+	return e.resp.Code
+}
+
+// Retryable reports whether processing the report again may succeed
+func (e *reportError) Retryable() bool {
+	return e.status >= http.StatusInternalServerError
+}
+
+func (e *reportError) Error() string {
+	if e.resp.Details != "" {
+		return e.resp.Error + ": " + e.resp.Details
+	}
+	return e.resp.Error
+}
+
+// ticketCreationError wraps a failure of the ticket tracker
+func ticketCreationError(err error) *reportError {
+	if errors.Is(err, services.ErrPoolSaturated) {
+		return overloadedError()
+	}
+	if errors.Is(err, services.ErrDependencyTimeout) {
+		return &reportError{status: http.StatusGatewayTimeout, resp: timeoutErrorResponse()}
+	}
+	return &reportError{status: http.StatusInternalServerError, resp: models.ErrorResponse{
+		Error:   "Failed to create ticket",
+		Details: err.Error(),
+	}}
+}
+
+// Requests shed because a dependency is saturated get the overloaded code
+// and a Retry-After in seconds
+const (
+	overloadedCode       = "overloaded"
+	overloadedRetryAfter = "10"
+)
+
+// overloadedError is a report shed because the worker pool of a dependency
+// is saturated
+func overloadedError() *reportError {
+	return &reportError{status: http.StatusServiceUnavailable, resp: models.ErrorResponse{
+		Error:   "Service overloaded",
+		Code:    overloadedCode,
+		Details: "Too many requests are being processed, please try again later",
+	}}
+}
+
+// dependencyTimeoutCode is the code of requests that failed because a
+// dependency did not answer within its timeout
+const dependencyTimeoutCode = "dependency_timeout"
+
+func timeoutErrorResponse() models.ErrorResponse {
+	return models.ErrorResponse{
+		Error:   "Issue tracker timed out",
+		Code:    dependencyTimeoutCode,
+		Details: "The issue tracker did not answer in time, please try again later",
+	}
+}
+
+// writeOverloaded responds with 503 and a Retry-After header when err comes
+// from a dependency whose worker pool is saturated, reporting whether it did
+func writeOverloaded(c *gin.Context, err error) bool {
+	if !errors.Is(err, services.ErrPoolSaturated) {
+		return false
+	}
+	c.Header("Retry-After", overloadedRetryAfter)
+	c.JSON(http.StatusServiceUnavailable, overloadedError().resp)
+	return true
+}
+
+// writeDependencyTimeout responds with 504 when err comes from a dependency
+// that did not answer within its timeout, reporting whether it did
+func writeDependencyTimeout(c *gin.Context, err error) bool {
+	if !errors.Is(err, services.ErrDependencyTimeout) {
+		return false
+	}
+	c.JSON(http.StatusGatewayTimeout, timeoutErrorResponse())
+	return true
+}
+
+// writeReportError responds with a report processing error
+func (h *ReportHandler) writeReportError(c *gin.Context, err error) {
+	var rerr *reportError
+	if errors.As(err, &rerr) {
+		if rerr.resp.Code == overloadedCode {
+			c.Header("Retry-After", overloadedRetryAfter)
+		}
+		c.JSON(rerr.status, rerr.resp)
+		return
+	}
+
+	logger.FromContext(c.Request.Context(), h.logger).Error("Failed to process report", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   "Failed to process report",
+		Details: err.Error(),
+	})
+}
+
+// resolveUploadSession sets the object key of the request to the content of
+// its upload session. It returns an error if the session cannot be used.
+func (h *ReportHandler) resolveUploadSession(ctx context.Context, req *models.ReportIssueRequest) *reportError {
+	if h.sessions == nil {
+		return &reportError{status: http.StatusBadRequest, resp: models.ErrorResponse{
+			Error:   "Upload sessions not available",
+			Details: "Resumable uploads are not enabled on this server",
+		}}
+	}
+
+	session, err := h.sessions.Get(req.UploadID)
+	if err != nil {
+		if errors.Is(err, services.ErrUploadSessionNotFound) {
+			return &reportError{status: http.StatusBadRequest, resp: models.ErrorResponse{
+				Error:   "Upload session not found",
+				Code:    "upload_not_found",
+				Details: fmt.Sprintf("No upload session exists with ID %s; it may have expired", req.UploadID),
+			}}
+		}
+		logger.FromContext(ctx, h.logger).Error("Failed to load upload session", zap.Error(err), zap.String("upload_id", req.UploadID))
+		return &reportError{status: http.StatusInternalServerError, resp: models.ErrorResponse{
+			Error:   "Failed to load upload session",
+			Details: err.Error(),
+		}}
+	}
+
+	if session.Status != services.UploadSessionCompleted {
+		return &reportError{status: http.StatusBadRequest, resp: models.ErrorResponse{
+			Error:   "Upload not completed",
+			Code:    "upload_incomplete",
+			Details: fmt.Sprintf("Upload session %s has received %d of %d bytes; complete it before submitting the report", session.ID, session.Offset, session.Size),
+		}}
+	}
+
+	req.ImageS3Key = session.ObjectKey
+	return nil
+}
+
+// scanStoredObject scans a directly uploaded object. Infected objects are
+// deleted so they cannot be linked from a ticket later.
+func (h *ReportHandler) scanStoredObject(ctx context.Context, req models.ReportIssueRequest, clientIP string) error {
+	if h.scanner == nil {
+		return nil
+	}
+
+	obj, err := h.storage.OpenObject(ctx, req.ImageS3Key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", services.ErrScanFailed, err)
+	}
+	defer obj.Close()
+
+	err = h.scanner.Check(ctx, obj, services.ScanSubject{
+		ObjectKey: req.ImageS3Key,
+		Product:   req.Product,
+		UserEmail: req.UserEmail,
+		ClientIP:  clientIP,
+	})
+	if errors.Is(err, services.ErrMalwareDetected) {
+		if delErr := h.storage.DeleteObject(ctx, req.ImageS3Key); delErr != nil {
+			logger.FromContext(ctx, h.logger).Error("Failed to delete infected object", zap.Error(delErr), zap.String("key", req.ImageS3Key))
+		}
+	}
+
+	return err
+}
+
+// checkRecording enforces the supported formats and size limit of screen
+// recordings. It returns an error if the upload is not acceptable.
+func (h *ReportHandler) checkRecording(contentType string, size int64) *reportError {
+	if !services.IsVideoContentType(contentType) {
+		return nil
+	}
+
+	if contentType != services.ContentTypeMP4 && contentType != services.ContentTypeWebM {
+		return &reportError{status: http.StatusUnsupportedMediaType, resp: models.ErrorResponse{
+			Error:   "Unsupported video format",
+			Code:    "unsupported_media_type",
+			Details: services.ErrUnsupportedVideo.Error(),
+		}}
+	}
+
+	if h.videoMaxSize > 0 && size > h.videoMaxSize {
+		return &reportError{status: http.StatusRequestEntityTooLarge, resp: models.ErrorResponse{
+			Error:   "Screen recording too large",
+			Code:    "file_too_large",
+			Details: fmt.Sprintf("Screen recordings may be at most %d bytes, got %d", h.videoMaxSize, size),
+		}}
+	}
+
+	return nil
+}
+
+// scanRejection describes an upload that failed malware scanning
+func (h *ReportHandler) scanRejection(ctx context.Context, err error) *reportError {
+	if errors.Is(err, services.ErrSuspiciousFile) {
+		return &reportError{status: http.StatusUnprocessableEntity, resp: models.ErrorResponse{
+			Error:   "Uploaded file rejected",
+			Code:    "suspicious_file",
+			Details: err.Error(),
+		}}
+	}
+
+	if errors.Is(err, services.ErrMalwareDetected) {
+		return &reportError{status: http.StatusUnprocessableEntity, resp: models.ErrorResponse{
+			Error:   "Uploaded file rejected",
+			Code:    "malware_detected",
+			Details: err.Error(),
+		}}
+	}
+
+	logger.FromContext(ctx, h.logger).Error("Failed to scan uploaded file", zap.Error(err))
+	return &reportError{status: http.StatusServiceUnavailable, resp: models.ErrorResponse{
+		Error:   "Uploaded file could not be scanned",
+		Code:    "scan_unavailable",
+		Details: "The malware scanner is unavailable, please try again later",
+	}}
+}
+
+// recordAttachment links an upload to the ticket it belongs to: the object is
+// tagged with the ticket ID, so bucket lifecycle rules can act on it, and its
+// metadata is stored in the attachments collection. Failures are logged only.
+func (h *ReportHandler) recordAttachment(ctx context.Context, attachment *services.Attachment, ticketID string) {
+	log := logger.FromContext(ctx, h.logger)
+	if h.storage == nil || attachment == nil || ticketID == "" {
+		return
+	}
+
+	if err := h.storage.TagObject(ctx, attachment.ObjectKey, map[string]string{services.TagTicketID: ticketID}); err != nil {
+		log.Warn("Failed to tag upload with ticket ID",
+			zap.Error(err),
+			zap.String("key", attachment.ObjectKey),
+			zap.String("ticket_id", ticketID),
+		)
+	}
+
+	mongoService := h.jiraService.GetMongoService()
+	if mongoService == nil {
+		return
+	}
+
+	attachment.TicketID = ticketID
+	if _, err := mongoService.SaveAttachment(ctx, attachment); err != nil {
+		log.Warn("Failed to save attachment metadata",
+			zap.Error(err),
+			zap.String("key", attachment.ObjectKey),
+			zap.String("ticket_id", ticketID),
+		)
+	}
+}
+
+// directAttachment describes an object uploaded directly to storage
+func directAttachment(info *services.ObjectInfo, objectKey, uploader string) *services.Attachment {
+	return &services.Attachment{
+		ObjectKey:      objectKey,
+		Filename:       path.Base(info.Key),
+		Size:           info.Size,
+		ContentType:    info.ContentType,
+		ChecksumSHA256: info.ChecksumSHA256,
+		Uploader:       uploader,
+	}
+}
+
+// storedKey returns the key an upload is currently stored under
+func storedKey(imageKey, quarantineKey string) string {
+	if quarantineKey != "" {
+		return quarantineKey
+	}
+	return imageKey
 }
 
 // Helper function to get the minimum of two integers
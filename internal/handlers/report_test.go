@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.uber.org/zap"
+)
+
+// pngHeader is enough of a PNG file for content sniffing
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func newReportRouter(t *testing.T, jira *fakeJira, storage services.ObjectStorage, forms ProductForms) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	keys, err := services.NewKeyTemplate("")
+	if err != nil {
+		t.Fatalf("NewKeyTemplate: %v", err)
+	}
+
+	h := NewReportHandler(newTestJiraService(t, jira), storage, keys, nil, nil, nil, nil, nil, forms, "test", nil, zap.NewNop(), newTestValidator(), 0)
+	r := gin.New()
+	r.POST("/api/v1/report-issue", h.ReportIssue)
+	r.POST("/api/v1/ingest", h.Ingest)
+	return r
+}
+
+func TestReportIssueMultipart(t *testing.T) {
+	jira := newFakeJira(t)
+	dir := t.TempDir()
+	storage, err := services.NewLocalStorageService(dir, "http://localhost:8080/local-storage", time.Hour)
+	if err != nil {
+		t.Fatalf("NewLocalStorageService: %v", err)
+	}
+	r := newReportRouter(t, jira, storage, nil)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("issue", "Checkout broken")
+	form.WriteField("description", "Pay button does nothing")
+	form.WriteField("userEmail", "user@example.com")
+	form.WriteField("product", "shop")
+	form.WriteField("failedNetworkCalls", `[{"url":"https://api.example.com/pay","method":"POST","status":500}]`)
+	part, err := form.CreateFormFile("image0", "screenshot.png")
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(pngHeader)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/report-issue", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	var resp models.TicketResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.TicketID != "PROJ-1" {
+		t.Errorf("ticket ID = %q, want PROJ-1", resp.TicketID)
+	}
+
+	// The screenshot is stored under the upload prefix and embedded in the ticket
+	var stored []string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			stored = append(stored, path)
+		}
+		return nil
+	})
+	if len(stored) != 1 || !strings.Contains(filepath.ToSlash(stored[0]), "uploads/ronnin/") {
+		t.Fatalf("stored files = %v, want one file under uploads/ronnin/", stored)
+	}
+
+	descriptions := jira.descriptions()
+	if len(descriptions) != 1 {
+		t.Fatalf("created %d issues, want 1", len(descriptions))
+	}
+	description := descriptions[0]
+	for _, want := range []string{"Checkout broken", "h3. Screenshot", "http://localhost:8080/local-storage/uploads/ronnin/", "https://api.example.com/pay"} {
+		if !strings.Contains(description, want) {
+			t.Errorf("description does not contain %q:\n%s", want, description)
+		}
+	}
+}
+
+func TestReportIssueJSON(t *testing.T) {
+	jira := newFakeJira(t)
+	r := newReportRouter(t, jira, nil, nil)
+
+	body := `{
+		"issue": "Checkout broken",
+		"description": "Pay button does nothing",
+		"failedNetworkCalls": [{"url":"https://api.example.com/pay","method":"POST","status":500}],
+		"imageS3URL": "https://cdn.example.com/screenshot.png"
+	}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/report-issue", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	descriptions := jira.descriptions()
+	if len(descriptions) != 1 {
+		t.Fatalf("created %d issues, want 1", len(descriptions))
+	}
+	for _, want := range []string{"Checkout broken", "!https://cdn.example.com/screenshot.png|width=800!", "https://api.example.com/pay"} {
+		if !strings.Contains(descriptions[0], want) {
+			t.Errorf("description does not contain %q:\n%s", want, descriptions[0])
+		}
+	}
+}
+
+func TestIngestGzipBatch(t *testing.T) {
+	jira := newFakeJira(t)
+	r := newReportRouter(t, jira, nil, nil)
+
+	batch := `{
+		"sdk": {"name": "ronnin-browser", "version": "1.2.0"},
+		"reports": [
+			{
+				"id": "r-1",
+				"issue": "Checkout broken",
+				"description": "Pay button does nothing",
+				"device": {"browser": "Firefox", "os": "Linux"},
+				"console": [{"level": "error", "message": "TypeError: total is undefined", "ts": 1736348645123}],
+				"breadcrumbs": [{"type": "click", "message": "button#pay", "ts": 1736348644012}],
+				"failedCalls": [{"method": "post", "url": "https://api.example.com/pay", "status": 500, "ts": 1736348645001}]
+			},
+			{"id": "r-2", "issue": "No description"},
+			{"id": "r-3", "issue": "Search is slow", "description": "Results take a minute"}
+		]
+	}`
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write([]byte(batch))
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ingest", &body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d for a batch with an invalid report; body: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+
+	batch = strings.Replace(batch, `{"id": "r-2", "issue": "No description"},`, "", 1)
+	body.Reset()
+	gz = gzip.NewWriter(&body)
+	gz.Write([]byte(batch))
+	gz.Close()
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/ingest", &body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp models.IngestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("got %d results, want 2", len(resp.Results))
+	}
+	for i, id := range []string{"r-1", "r-3"} {
+		result := resp.Results[i]
+		if result.ID != id || result.Status != http.StatusCreated || result.Ticket == nil {
+			t.Errorf("result %d = %+v, want ticket of %s", i, result, id)
+		}
+	}
+
+	descriptions := jira.descriptions()
+	if len(descriptions) != 2 {
+		t.Fatalf("created %d issues, want 2", len(descriptions))
+	}
+	for _, want := range []string{
+		"ronnin-browser/1.2.0",
+		"Firefox",
+		"15:04:05.123 ERROR TypeError: total is undefined",
+		"click: button#pay",
+		"https://api.example.com/pay",
+	} {
+		if !strings.Contains(descriptions[0], want) {
+			t.Errorf("description does not contain %q:\n%s", want, descriptions[0])
+		}
+	}
+}
+
+func TestReportIssueRequiresIssueAndDescription(t *testing.T) {
+	for _, contentType := range []string{"application/json", "multipart/form-data"} {
+		t.Run(contentType, func(t *testing.T) {
+			jira := newFakeJira(t)
+			r := newReportRouter(t, jira, nil, nil)
+
+			var req *http.Request
+			if contentType == "application/json" {
+				req = httptest.NewRequest(http.MethodPost, "/api/v1/report-issue", strings.NewReader(`{"issue":"Only a title"}`))
+				req.Header.Set("Content-Type", contentType)
+			} else {
+				var body bytes.Buffer
+				form := multipart.NewWriter(&body)
+				form.WriteField("issue", "Only a title")
+				form.Close()
+				req = httptest.NewRequest(http.MethodPost, "/api/v1/report-issue", &body)
+				req.Header.Set("Content-Type", form.FormDataContentType())
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+			if n := len(jira.descriptions()); n != 0 {
+				t.Errorf("created %d issues, want none", n)
+			}
+		})
+	}
+}
+
+func TestReportIssueProductRequiredFields(t *testing.T) {
+	forms, err := ParseProductForms("lending=leadId,screenshot; insurance=userEmail")
+	if err != nil {
+		t.Fatalf("ParseProductForms: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFields []string
+	}{
+		{
+			name:       "missing fields of the product",
+			body:       `{"issue":"Loan stuck","description":"Disbursal pending","product":"Lending"}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []string{"leadId", "screenshot"},
+		},
+		{
+			name:       "all fields of the product",
+			body:       `{"issue":"Loan stuck","description":"Disbursal pending","product":"lending","leadId":"L-42","imageS3URL":"https://cdn.example.com/screenshot.png"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "product without requirements",
+			body:       `{"issue":"Checkout broken","description":"Pay button does nothing","product":"shop"}`,
+			wantStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReportRouter(t, newFakeJira(t), nil, forms)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/report-issue", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantFields == nil {
+				return
+			}
+
+			var resp models.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			var fields []string
+			for _, f := range resp.Fields {
+				fields = append(fields, f.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestParseProductFormsRejectsUnknownFields(t *testing.T) {
+	if _, err := ParseProductForms("lending=loanId"); err == nil {
+		t.Error("ParseProductForms accepted an unknown field")
+	}
+}
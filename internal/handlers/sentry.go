@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// maxSentryBodySize caps the decompressed size of a Sentry request
+const maxSentryBodySize = 5 << 20
+
+type SentryHandler struct {
+	jiraService *services.JiraRegistry
+	queue       *services.ReportQueue
+	key         string
+	logger      *zap.Logger
+}
+
+// NewSentryHandler creates a handler for Sentry SDK events authenticated with
+// the public key of the DSN the SDK is configured with
+func NewSentryHandler(js *services.JiraRegistry, queue *services.ReportQueue, key string, log *zap.Logger) *SentryHandler {
+	h := &SentryHandler{
+		jiraService: js,
+		queue:       queue,
+		key:         key,
+		logger:      log,
+	}
+	if queue != nil {
+		queue.RegisterResumer(sentryJobKind, h.resumeEvent)
+	}
+	return h
+}
+
+// sentryJobKind is the kind of queued Sentry tickets saved on shutdown or
+// sent through a broker
+const sentryJobKind = "sentry-event"
+
+// resumeEvent turns a ticket request for a Sentry event saved on shutdown
+// back into a task
+func (h *SentryHandler) resumeEvent(payload json.RawMessage) (services.ReportTask, func(), error) {
+	var ticketReq models.TicketRequest
+	if err := json.Unmarshal(payload, &ticketReq); err != nil {
+		return nil, nil, err
+	}
+	return func(ctx context.Context) (*models.TicketResponse, error) {
+		return h.jiraService.CreateTicket(ctx, &ticketReq)
+	}, nil, nil
+}
+
+// IngestEnvelope godoc
+// @Summary      Ingest Sentry envelope
+// @Description  Accepts events from Sentry SDKs whose DSN points at this server and files each error event as a Jira ticket. The DSN public key must match SENTRY_INTAKE_KEY and is read from the X-Sentry-Auth header or the sentry_key query parameter. Non-error items are acknowledged and ignored.
+// @Tags         sentry
+// @Accept       plain
+// @Produce      json
+// @Param        projectId path string true "Sentry project ID from the DSN"
+// @Success      200  {object}  map[string]string "ID of the last event"
+// @Failure      400  {object}  models.ErrorResponse "Malformed envelope"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid sentry_key"
+// @Failure      413  {object}  models.ErrorResponse "Envelope too large"
+// @Router       /api/{projectId}/envelope/ [post]
+func (h *SentryHandler) IngestEnvelope(c *gin.Context) {
+	body, ok := h.openBody(c)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	events, err := services.ParseSentryEnvelope(body)
+	if err != nil {
+		h.bodyError(c, err)
+		return
+	}
+
+	h.fileEvents(c, events)
+}
+
+// IngestStore godoc
+// @Summary      Ingest Sentry event
+// @Description  Accepts a single event from Sentry SDKs that use the legacy store endpoint and files it as a Jira ticket when it is an error
+// @Tags         sentry
+// @Accept       json
+// @Produce      json
+// @Param        projectId path string true "Sentry project ID from the DSN"
+// @Success      200  {object}  map[string]string "ID of the event"
+// @Failure      400  {object}  models.ErrorResponse "Malformed event"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid sentry_key"
+// @Failure      413  {object}  models.ErrorResponse "Event too large"
+// @Router       /api/{projectId}/store/ [post]
+func (h *SentryHandler) IngestStore(c *gin.Context) {
+	body, ok := h.openBody(c)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	var event models.SentryEvent
+	if err := json.NewDecoder(body).Decode(&event); err != nil {
+		h.bodyError(c, fmt.Errorf("%w: %w", services.ErrInvalidEnvelope, err))
+		return
+	}
+
+	h.fileEvents(c, []models.SentryEvent{event})
+}
+
+// fileEvents creates a ticket for every error event, in the background when
+// the report queue is enabled
+func (h *SentryHandler) fileEvents(c *gin.Context, events []models.SentryEvent) {
+	log := logger.FromContext(c.Request.Context(), h.logger)
+	requestID := logger.RequestID(c.Request.Context())
+	var lastID string
+	for i := range events {
+		event := &events[i]
+		lastID = event.EventID
+		if !services.IsSentryErrorEvent(event) {
+			continue
+		}
+
+		ticketReq := services.SentryTicketRequest(event, "")
+		if h.queue != nil {
+			var err error
+			if h.queue.Brokered() {
+				_, err = h.queue.SubmitJob(c.Request.Context(), sentryJobKind, ticketReq)
+			} else {
+				_, err = h.queue.Submit(func(ctx context.Context) (*models.TicketResponse, error) {
+					return h.jiraService.CreateTicket(logger.WithRequestID(ctx, requestID), ticketReq)
+				}, nil, func(string) (string, interface{}, error) {
+					return sentryJobKind, ticketReq, nil
+				})
+			}
+			if err == nil {
+				continue
+			}
+			log.Warn("Failed to queue Sentry event, filing it synchronously", zap.String("event_id", event.EventID), zap.Error(err))
+		}
+
+		response, err := h.jiraService.CreateTicket(c.Request.Context(), ticketReq)
+		if err != nil {
+			log.Error("Failed to create ticket for Sentry event", zap.Error(err), zap.String("event_id", event.EventID))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to create ticket",
+				Details: err.Error(),
+			})
+			return
+		}
+		log.Info("Created ticket for Sentry event",
+			zap.String("event_id", event.EventID),
+			zap.String("ticket_id", response.TicketID),
+			zap.String("project_id", c.Param("projectId")),
+		)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": lastID})
+}
+
+// openBody authenticates the request and returns its decompressed body. It
+// writes an error response and returns false if the request is rejected.
+func (h *SentryHandler) openBody(c *gin.Context) (io.ReadCloser, bool) {
+	provided := sentryKey(c)
+	if h.key == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(h.key)) != 1 {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error:   "Unauthorized",
+			Details: "Missing or invalid sentry_key",
+		})
+		return nil, false
+	}
+
+	body, err := decodedBody(c, maxSentryBodySize)
+	if err != nil {
+		h.bodyError(c, fmt.Errorf("%w: %w", services.ErrInvalidEnvelope, err))
+		return nil, false
+	}
+	return body, true
+}
+
+// decodedBody returns the request body, decompressed when it was sent with
+// Content-Encoding gzip or deflate, failing with *http.MaxBytesError once
+// more than maxSize bytes were read from it
+func decodedBody(c *gin.Context, maxSize int64) (io.ReadCloser, error) {
+	var body io.ReadCloser = c.Request.Body
+	switch strings.ToLower(c.GetHeader("Content-Encoding")) {
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		body = gz
+	case "deflate":
+		body = flate.NewReader(body)
+	}
+	return http.MaxBytesReader(c.Writer, body, maxSize), nil
+}
+
+func (h *SentryHandler) bodyError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, models.BodyTooLargeError(tooLarge.Limit))
+		return
+	}
+
+	logger.FromContext(c.Request.Context(), h.logger).Warn("Rejected Sentry request", zap.Error(err))
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   "Invalid Sentry payload",
+		Details: err.Error(),
+	})
+}
+
+// sentryKey returns the DSN public key from the X-Sentry-Auth header or the
+// sentry_key query parameter used by browser SDKs
+func sentryKey(c *gin.Context) string {
+	auth := strings.TrimPrefix(c.GetHeader("X-Sentry-Auth"), "Sentry ")
+	for _, part := range strings.Split(auth, ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(part), "="); ok && key == "sentry_key" {
+			return value
+		}
+	}
+	return c.Query("sentry_key")
+}
@@ -4,25 +4,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/parvez-capri/ronnin/internal/errors"
+	"github.com/parvez-capri/ronnin/internal/middleware"
 	"github.com/parvez-capri/ronnin/internal/models"
 	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
 )
 
 type TicketHandler struct {
-	jiraService *services.JiraService
+	jiraService *services.JiraRegistry
+	storage     services.ObjectStorage
 	logger      *zap.Logger
 	validate    *validator.Validate
 }
 
-func NewTicketHandler(js *services.JiraService, log *zap.Logger, validate *validator.Validate) *TicketHandler {
+func NewTicketHandler(js *services.JiraRegistry, storage services.ObjectStorage, log *zap.Logger, validate *validator.Validate) *TicketHandler {
 	return &TicketHandler{
 		jiraService: js,
+		storage:     storage,
 		logger:      log,
 		validate:    validate,
 	}
@@ -34,38 +41,42 @@ func NewTicketHandler(js *services.JiraService, log *zap.Logger, validate *valid
 // @Tags         tickets
 // @Accept       json
 // @Produce      json
+// @Security     ApiKeyAuth
 // @Param        request body     models.TicketRequest true "Ticket creation request with URL, payload, response, and request headers"
 // @Success      201  {object}  models.TicketResponse "Ticket created successfully with ticket ID, status, assigned user, and Jira link"
 // @Failure      400  {object}  models.ErrorResponse "Invalid request body or validation failed"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid ticket API token"
 // @Failure      500  {object}  models.ErrorResponse "Internal server error or failed to create ticket"
+// @Failure      503  {object}  models.ErrorResponse "Issue tracker is saturated; retry after the Retry-After header"
+// @Failure      504  {object}  models.ErrorResponse "Issue tracker did not answer within TRACKER_TIMEOUT"
 // @Router       /create-ticket [post]
 func (h *TicketHandler) CreateTicketGin(c *gin.Context) {
 	var req models.TicketRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "Invalid request body",
-			Details: err.Error(),
-		})
+		writeBindError(c, err)
 		return
 	}
 
 	if err := h.validate.Struct(req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Validation failed",
-			"details": err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
 		return
 	}
 
 	response, err := h.jiraService.CreateTicket(c.Request.Context(), &req)
+	if writeOverloaded(c, err) {
+		return
+	}
+	if writeDependencyTimeout(c, err) {
+		return
+	}
 	if err != nil {
-		h.logger.Error("Failed to create ticket",
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to create ticket",
 			zap.Error(err),
 			zap.String("url", req.URL),
 		)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to create ticket",
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create ticket",
 		})
 		return
 	}
@@ -75,11 +86,25 @@ func (h *TicketHandler) CreateTicketGin(c *gin.Context) {
 
 // GetAllTicketsGin handles GET requests to retrieve all tickets
 // @Summary      Get All Tickets
-// @Description  Retrieves all tickets from the MongoDB database with full ticket data
+// @Description  Retrieves tickets from the MongoDB database with full ticket data, most recent first, one page at a time. Follow nextCursor (or the Link header) for the next page. Callers limited to products only get the tickets of those products. Tickets can be filtered by the browser, operating system and device of their reporter; names match regardless of case and versions match their prefix up to a dot. Send Accept: application/x-ndjson to export all tickets, one per line, which requires the admin role. The deprecated unversioned route returns all tickets as a JSON array.
 // @Tags         tickets
 // @Accept       json
-// @Produce      json
-// @Success      200  {array}   services.FlattenedTicket
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        browser         query     string  false  "Only tickets reported from this browser, e.g. Chrome"
+// @Param        browserVersion  query     string  false  "Only tickets reported from this browser version or its minor versions, e.g. 124"
+// @Param        os              query     string  false  "Only tickets reported from this operating system, e.g. Android"
+// @Param        osVersion       query     string  false  "Only tickets reported from this operating system version or its minor versions, e.g. 14"
+// @Param        device          query     string  false  "Only tickets reported from this device class"  Enums(mobile, tablet, desktop, bot)
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Param        If-None-Match  header  string  false  "ETag of a previously fetched page"
+// @Success      200  {object}  models.ListResponse{data=[]services.FlattenedTicket}
+// @Success      304  "Page unchanged since the given ETag"
+// @Failure      400  {object}  models.ErrorResponse "Invalid filter, page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid credentials when API_KEY_AUTH or OIDC is enabled"
+// @Failure      403  {object}  models.ErrorResponse "Credentials lack the read scope, or the admin role for an export"
 // @Failure      500  {object}  models.ErrorResponse "Database unavailable or error retrieving tickets"
 // @Router       /tickets [get]
 func (h *TicketHandler) GetAllTicketsGin(c *gin.Context) {
@@ -91,17 +116,134 @@ func (h *TicketHandler) GetAllTicketsGin(c *gin.Context) {
 		return
 	}
 
-	tickets, err := h.jiraService.GetMongoService().GetAllTickets(c.Request.Context())
+	action := services.ActionReadTicket
+	if wantsNDJSON(c) {
+		action = services.ActionExport
+	}
+	if !authorize(c, action) {
+		return
+	}
+	filter, ok := ticketFilter(c)
+	if !ok {
+		return
+	}
+	if wantsNDJSON(c) {
+		h.streamTickets(c, filter)
+		return
+	}
+	if paginated(c) {
+		h.ticketsPage(c, filter)
+		return
+	}
+
+	tickets, err := h.jiraService.GetMongoService().GetAllTickets(c.Request.Context(), filter)
 	if err != nil {
-		h.logger.Error("Failed to retrieve tickets", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "Failed to retrieve tickets",
-			Details: err.Error(),
-		})
+		h.ticketsError(c, err)
+		return
+	}
+
+	writeJSONTagged(c, tickets)
+}
+
+// ticketDevices are the device classes tickets can be filtered by
+var ticketDevices = []string{"mobile", "tablet", "desktop", "bot"}
+
+// ticketFilter returns the tickets of the caller's scope selected by the
+// query, or responds with 400 when a filter is invalid
+func ticketFilter(c *gin.Context) (services.TicketFilter, bool) {
+	filter := services.TicketFilter{
+		Scope:          middleware.CurrentPrincipal(c).Scope(),
+		Browser:        strings.TrimSpace(c.Query("browser")),
+		BrowserVersion: strings.TrimSpace(c.Query("browserVersion")),
+		OS:             strings.TrimSpace(c.Query("os")),
+		OSVersion:      strings.TrimSpace(c.Query("osVersion")),
+		Device:         strings.ToLower(strings.TrimSpace(c.Query("device"))),
+	}
+	if filter.Device != "" && !slices.Contains(ticketDevices, filter.Device) {
+		writeFieldErrors(c, []models.FieldError{{
+			Field: "device", Rule: "oneof", Param: strings.Join(ticketDevices, " "), Code: "invalid_choice",
+			Message: "device must be one of " + strings.Join(ticketDevices, ", "),
+		}})
+		return filter, false
+	}
+	return filter, true
+}
+
+// ticketsPage responds with a page of the selected tickets, most recent
+// first. Cursors are document IDs, so pages stay stable while new tickets
+// are created.
+func (h *TicketHandler) ticketsPage(c *gin.Context, filter services.TicketFilter) {
+	p, ok := parsePageRequest(c)
+	if !ok {
+		return
+	}
+
+	var before primitive.ObjectID
+	if p.Cursor != "" {
+		var err error
+		if before, err = primitive.ObjectIDFromHex(p.Cursor); err != nil {
+			writeFieldErrors(c, []models.FieldError{invalidCursor})
+			return
+		}
+	}
+
+	ms := h.jiraService.GetMongoService()
+	skip := int64(p.Page-1) * int64(p.PageSize)
+	tickets, err := ms.GetTicketsNewestFirst(c.Request.Context(), filter, before, skip, int64(p.PageSize)+1)
+	if err != nil {
+		h.ticketsError(c, err)
+		return
+	}
+	total, err := ms.CountTickets(c.Request.Context(), filter)
+	if err != nil {
+		h.ticketsError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, tickets)
+	var next string
+	if len(tickets) > p.PageSize {
+		tickets = tickets[:p.PageSize]
+		next = tickets[len(tickets)-1].ID.Hex()
+	}
+	writePage(c, tickets, p, total, next)
+}
+
+func (h *TicketHandler) ticketsError(c *gin.Context, err error) {
+	logger.FromContext(c.Request.Context(), h.logger).Error("Failed to retrieve tickets", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   "Failed to retrieve tickets",
+		Details: err.Error(),
+	})
+}
+
+// streamTickets writes the selected tickets as newline-delimited JSON while
+// reading them from MongoDB. Once streaming has started the status can no
+// longer change, so a failure part way ends the stream with an error line.
+func (h *TicketHandler) streamTickets(c *gin.Context, filter services.TicketFilter) {
+	var stream *ndjsonStream
+	err := h.jiraService.GetMongoService().StreamTickets(c.Request.Context(), filter, func(ticket *services.FlattenedTicket) error {
+		if stream == nil {
+			stream = newNDJSONStream(c)
+		}
+		return stream.Write(ticket)
+	})
+
+	if err != nil {
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to retrieve tickets", zap.Error(err))
+		if stream == nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to retrieve tickets",
+				Details: err.Error(),
+			})
+			return
+		}
+		stream.Write(models.ErrorResponse{Error: "Failed to retrieve tickets", Details: err.Error()})
+	}
+
+	if stream == nil {
+		stream = newNDJSONStream(c)
+	}
+	stream.Flush()
 }
 
 // GetTicketByIDGin handles GET requests to retrieve a ticket by ID
@@ -110,8 +252,13 @@ func (h *TicketHandler) GetAllTicketsGin(c *gin.Context) {
 // @Tags         tickets
 // @Accept       json
 // @Produce      json
+// @Security     ApiKeyAuth
 // @Param        id  path      string  true  "Jira Ticket ID (e.g. PROJ-123)"
+// @Param        If-None-Match  header  string  false  "ETag of a previously fetched version of the ticket"
 // @Success      200  {object}  services.FlattenedTicket
+// @Success      304  "Ticket unchanged since the given ETag"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid credentials when API_KEY_AUTH or OIDC is enabled"
+// @Failure      403  {object}  models.ErrorResponse "Credentials lack the read scope"
 // @Failure      404  {object}  models.ErrorResponse "Ticket not found"
 // @Failure      500  {object}  models.ErrorResponse "Database unavailable or error retrieving ticket"
 // @Router       /tickets/{id} [get]
@@ -133,9 +280,9 @@ func (h *TicketHandler) GetTicketByIDGin(c *gin.Context) {
 		return
 	}
 
-	ticket, err := h.jiraService.GetMongoService().GetTicketByJiraID(c.Request.Context(), id)
+	ticket, err := h.jiraService.GetMongoService().GetTicketByJiraID(h.jiraService.TicketContext(c.Request.Context(), id), id)
 	if err != nil {
-		h.logger.Error("Failed to retrieve ticket", zap.Error(err), zap.String("id", id))
+		logger.FromContext(c.Request.Context(), h.logger).Error("Failed to retrieve ticket", zap.Error(err), zap.String("id", id))
 
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -151,10 +298,206 @@ func (h *TicketHandler) GetTicketByIDGin(c *gin.Context) {
 		})
 		return
 	}
+	if !authorizeTicket(c, services.ActionReadTicket, ticket) {
+		return
+	}
 
+	if notModified(c, ticketETag(ticket)) {
+		return
+	}
 	c.JSON(http.StatusOK, ticket)
 }
 
+// GetTicketImageGin handles GET requests for a fresh screenshot URL
+// @Summary      Get fresh screenshot URL
+// @Description  Generates a new presigned URL for a ticket's screenshot, since stored URLs expire after at most 7 days
+// @Tags         tickets
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id  path      string  true  "Jira Ticket ID (e.g. PROJ-123)"
+// @Success      200  {object}  models.ImageURLResponse
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid credentials when API_KEY_AUTH or OIDC is enabled"
+// @Failure      403  {object}  models.ErrorResponse "Credentials lack the read scope"
+// @Failure      404  {object}  models.ErrorResponse "Ticket not found or ticket has no screenshot"
+// @Failure      500  {object}  models.ErrorResponse "Database or storage unavailable, or presigning failed"
+// @Router       /tickets/{id}/image [get]
+func (h *TicketHandler) GetTicketImageGin(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context(), h.logger)
+	id := c.Param("id")
+
+	if h.jiraService.GetMongoService() == nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Database not available",
+			Details: "MongoDB service is not configured",
+		})
+		return
+	}
+
+	if h.storage == nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Storage not available",
+			Details: "Object storage is not configured",
+		})
+		return
+	}
+
+	ticket, err := h.jiraService.GetMongoService().GetTicketByJiraID(h.jiraService.TicketContext(c.Request.Context(), id), id)
+	if err != nil {
+		log.Error("Failed to retrieve ticket", zap.Error(err), zap.String("id", id))
+
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error:   "Ticket not found",
+				Details: fmt.Sprintf("Ticket with ID %s not found", id),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to retrieve ticket",
+			Details: err.Error(),
+		})
+		return
+	}
+	if !authorizeTicket(c, services.ActionReadTicket, ticket) {
+		return
+	}
+
+	if ticket.AttachmentStatus == services.AttachmentStatusQuarantined || ticket.AttachmentStatus == services.AttachmentStatusPurged {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Screenshot not available",
+			Details: fmt.Sprintf("The screenshot of ticket %s is %s", id, ticket.AttachmentStatus),
+		})
+		return
+	}
+
+	objectKey := ticket.ImageKey
+	if objectKey == "" && ticket.ImageURL != "" {
+		objectKey, err = h.storage.ObjectKeyFromURL(ticket.ImageURL)
+		if err != nil {
+			log.Warn("Failed to derive object key from image URL", zap.Error(err), zap.String("id", id))
+		}
+	}
+	if objectKey == "" {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Screenshot not found",
+			Details: fmt.Sprintf("Ticket with ID %s has no uploaded screenshot", id),
+		})
+		return
+	}
+
+	// The screenshot is in the bucket of the tenant of the ticket
+	imageURL, err := h.storage.PresignGetURL(services.WithTenant(c.Request.Context(), ticket.Tenant), objectKey)
+	if err != nil {
+		log.Error("Failed to presign screenshot URL", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to generate screenshot URL",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ImageURLResponse{
+		TicketID:  ticket.TicketID,
+		ImageURL:  imageURL,
+		ExpiresAt: time.Now().Add(h.storage.PresignExpiry()),
+	})
+}
+
+// GetTicketAttachmentsGin handles GET requests to list a ticket's attachments
+// @Summary      List ticket attachments
+// @Description  Lists the files uploaded with a ticket, with freshly signed download URLs, one page at a time. Send Accept: application/x-ndjson for all attachments, one per line.
+// @Tags         tickets
+// @Accept       json
+// @Produce      json,application/x-ndjson
+// @Security     ApiKeyAuth
+// @Param        id  path      string  true  "Jira Ticket ID (e.g. PROJ-123)"
+// @Param        page      query     int     false  "Page number, starting at 1"
+// @Param        pageSize  query     int     false  "Items per page (default 50, max 200)"
+// @Param        cursor    query     string  false  "nextCursor of the previous page; takes precedence over page"
+// @Success      200  {object}  models.ListResponse{data=[]models.AttachmentResponse}
+// @Failure      400  {object}  models.ErrorResponse "Invalid page, pageSize or cursor"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid credentials when API_KEY_AUTH or OIDC is enabled"
+// @Failure      403  {object}  models.ErrorResponse "Credentials lack the read scope"
+// @Failure      404  {object}  models.ErrorResponse "Ticket of a product the caller is not limited to"
+// @Failure      500  {object}  models.ErrorResponse "Database unavailable or error retrieving attachments"
+// @Router       /tickets/{id}/attachments [get]
+func (h *TicketHandler) GetTicketAttachmentsGin(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context(), h.logger)
+	id := c.Param("id")
+	ctx := h.jiraService.TicketContext(c.Request.Context(), id)
+
+	if h.jiraService.GetMongoService() == nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Database not available",
+			Details: "MongoDB service is not configured",
+		})
+		return
+	}
+
+	// Only callers limited to a tenant or products need the ticket to be
+	// checked
+	if !middleware.CurrentPrincipal(c).Scope().All() {
+		ticket, err := h.jiraService.GetMongoService().GetTicketByJiraID(ctx, id)
+		if err != nil && !strings.Contains(err.Error(), "not found") {
+			log.Error("Failed to retrieve ticket", zap.Error(err), zap.String("id", id))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to retrieve ticket",
+				Details: err.Error(),
+			})
+			return
+		}
+		if ticket == nil {
+			ticket = &services.FlattenedTicket{TicketID: id}
+		}
+		if !authorizeTicket(c, services.ActionReadTicket, ticket) {
+			return
+		}
+	}
+
+	attachments, err := h.jiraService.GetMongoService().GetAttachmentsByTicketID(ctx, id)
+	if err != nil {
+		log.Error("Failed to retrieve attachments", zap.Error(err), zap.String("id", id))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to retrieve attachments",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	response := make([]models.AttachmentResponse, 0, len(attachments))
+	for _, a := range attachments {
+		item := models.AttachmentResponse{
+			ID:             a.ID.Hex(),
+			ObjectKey:      a.ObjectKey,
+			Filename:       a.Filename,
+			Size:           a.Size,
+			ContentType:    a.ContentType,
+			ChecksumSHA256: a.ChecksumSHA256,
+			Uploader:       a.Uploader,
+			Status:         a.Status,
+			CreatedAt:      a.CreatedAt,
+		}
+
+		// Files pending review or purged are listed without a download URL
+		if h.storage != nil && a.Status != services.AttachmentStatusQuarantined && a.Status != services.AttachmentStatusPurged {
+			url, err := h.storage.PresignGetURL(services.WithTenant(c.Request.Context(), a.Tenant), a.ObjectKey)
+			if err != nil {
+				log.Warn("Failed to presign attachment URL", zap.Error(err), zap.String("key", a.ObjectKey))
+			} else {
+				expiresAt := time.Now().Add(h.storage.PresignExpiry())
+				item.URL = url
+				item.URLExpiresAt = &expiresAt
+			}
+		}
+
+		response = append(response, item)
+	}
+
+	writeList(c, response)
+}
+
 func (h *TicketHandler) respondWithError(w http.ResponseWriter, code int, message string) {
 	h.respondWithJSON(w, code, errors.NewAPIError(code, message))
 }
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/parvez-capri/ronnin/internal/middleware"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.uber.org/zap"
+)
+
+// fakeJira records issues created through the Jira REST API
+type fakeJira struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	issues []map[string]interface{}
+}
+
+// newFakeJira starts a Jira server that accepts issue creation
+func newFakeJira(t *testing.T) *fakeJira {
+	t.Helper()
+
+	f := &fakeJira{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/rest/api/2/issue" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var issue map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&issue); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		f.issues = append(f.issues, issue)
+		key := "PROJ-" + strconv.Itoa(len(f.issues))
+		f.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"id": "10000", "key": key})
+	}))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// descriptions returns the descriptions of all created issues
+func (f *fakeJira) descriptions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var out []string
+	for _, issue := range f.issues {
+		fields, _ := issue["fields"].(map[string]interface{})
+		description, _ := fields["description"].(string)
+		out = append(out, description)
+	}
+	return out
+}
+
+// newTestJiraService creates a registry of a single Jira instance backed by
+// a fake Jira server
+func newTestJiraService(t *testing.T, jira *fakeJira) *services.JiraRegistry {
+	t.Helper()
+
+	roster := services.NewStaticRoster([]string{"support@example.com"}, nil, zap.NewNop())
+	js, err := services.NewJiraService(jira.URL, "user", "token", "PROJ", roster, "", nil)
+	if err != nil {
+		t.Fatalf("NewJiraService: %v", err)
+	}
+	registry, err := services.NewJiraRegistry(map[string]services.IssueTracker{services.DefaultJiraInstance: js}, nil, roster, nil)
+	if err != nil {
+		t.Fatalf("NewJiraRegistry: %v", err)
+	}
+	return registry
+}
+
+// newTestValidator returns a validator configured like the server's
+func newTestValidator() *validator.Validate {
+	validate := validator.New()
+	RegisterJSONFieldNames(validate)
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		RegisterJSONFieldNames(engine)
+	}
+	return validate
+}
+
+func newTicketRouter(t *testing.T, jira *fakeJira, token string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	h := NewTicketHandler(newTestJiraService(t, jira), nil, zap.NewNop(), newTestValidator())
+	r := gin.New()
+	r.POST("/api/v1/create-ticket", middleware.TokenAuth("tickets", token), h.CreateTicketGin)
+	return r
+}
+
+func TestCreateTicketJSON(t *testing.T) {
+	jira := newFakeJira(t)
+	r := newTicketRouter(t, jira, "secret")
+
+	body := `{
+		"url": "https://api.example.com/login",
+		"payload": {"issue": "Login fails", "description": "401 on valid credentials"},
+		"response": {"status": 401},
+		"requestHeaders": {"Content-Type": "application/json"}
+	}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/create-ticket", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	var resp models.TicketResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.TicketID != "PROJ-1" || resp.Status != "created" {
+		t.Errorf("response = %+v, want ticket PROJ-1 with status created", resp)
+	}
+
+	descriptions := jira.descriptions()
+	if len(descriptions) != 1 {
+		t.Fatalf("created %d issues, want 1", len(descriptions))
+	}
+	if !strings.Contains(descriptions[0], "Login fails") {
+		t.Errorf("description does not contain the issue summary:\n%s", descriptions[0])
+	}
+}
+
+func TestCreateTicketJSONRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   string
+		body   string
+		status int
+	}{
+		{
+			name:   "missing token",
+			body:   `{"url":"x","payload":{},"response":{},"requestHeaders":{}}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong token",
+			auth:   "Bearer nope",
+			body:   `{"url":"x","payload":{},"response":{},"requestHeaders":{}}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "missing required fields",
+			auth:   "Bearer secret",
+			body:   `{"url":"https://api.example.com"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "malformed JSON",
+			auth:   "Bearer secret",
+			body:   `{"url":`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jira := newFakeJira(t)
+			r := newTicketRouter(t, jira, "secret")
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/create-ticket", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.status, w.Body.String())
+			}
+			if n := len(jira.descriptions()); n != 0 {
+				t.Errorf("created %d issues, want none", n)
+			}
+		})
+	}
+}
+
+func TestCreateTicketJSONReportsInvalidFields(t *testing.T) {
+	jira := newFakeJira(t)
+	r := newTicketRouter(t, jira, "secret")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/create-ticket", strings.NewReader(`{"url":"https://api.example.com","payload":{}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusBadRequest, w.Body.String())
+	}
+
+	var resp models.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Code != "validation_failed" {
+		t.Errorf("code = %q, want validation_failed", resp.Code)
+	}
+
+	got := map[string]string{}
+	for _, field := range resp.Fields {
+		got[field.Field] = field.Code
+	}
+	want := map[string]string{"response": "required", "requestHeaders": "required"}
+	if len(got) != len(want) {
+		t.Fatalf("fields = %+v, want %v", resp.Fields, want)
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("field %s code = %q, want %q", field, got[field], code)
+		}
+	}
+}
+
+func TestCreateTicketJSONReportsWrongFieldTypes(t *testing.T) {
+	jira := newFakeJira(t)
+	r := newTicketRouter(t, jira, "secret")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/create-ticket", strings.NewReader(`{"url":42,"payload":{},"response":{},"requestHeaders":{}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp models.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if w.Code != http.StatusBadRequest || len(resp.Fields) != 1 || resp.Fields[0].Field != "url" || resp.Fields[0].Code != "invalid_type" {
+		t.Errorf("status %d, response %+v; want 400 with an invalid_type error for url", w.Code, resp)
+	}
+}
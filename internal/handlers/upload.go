@@ -0,0 +1,597 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+type UploadHandler struct {
+	storage             services.ObjectStorage
+	mongoService        *services.MongoDBService
+	keys                *services.KeyTemplate
+	sessions            *services.UploadSessionStore
+	environment         string
+	redactor            *services.Redactor
+	logger              *zap.Logger
+	validate            *validator.Validate
+	uploadExpiry        time.Duration
+	allowedContentTypes []string
+	videoMaxSize        int64
+}
+
+func NewUploadHandler(storage services.ObjectStorage, ms *services.MongoDBService, keys *services.KeyTemplate, sessions *services.UploadSessionStore, environment string, redactor *services.Redactor, log *zap.Logger, validate *validator.Validate, uploadExpiry time.Duration, allowedContentTypes []string, videoMaxSize int64) *UploadHandler {
+	return &UploadHandler{
+		storage:             storage,
+		mongoService:        ms,
+		keys:                keys,
+		sessions:            sessions,
+		environment:         environment,
+		redactor:            redactor,
+		logger:              log,
+		validate:            validate,
+		uploadExpiry:        uploadExpiry,
+		allowedContentTypes: allowedContentTypes,
+		videoMaxSize:        videoMaxSize,
+	}
+}
+
+// PresignUpload godoc
+// @Summary      Get a presigned upload URL
+// @Description  Returns a presigned PUT URL and object key so the client can upload large files (e.g. screen recordings) directly to storage, then submit /report-issue with the imageS3Key form field instead of the file
+// @Tags         reports
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request body     models.PresignUploadRequest true "File name and content type of the upload"
+// @Success      200  {object}  models.PresignUploadResponse "Content with the given checksum is already stored; reuse the returned object key"
+// @Success      201  {object}  models.PresignUploadResponse "Upload URL, required headers and object key"
+// @Failure      400  {object}  models.ErrorResponse "Invalid request body or unsupported content type"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid API key when API_KEY_AUTH is enabled"
+// @Failure      403  {object}  models.ErrorResponse "API key lacks the required scope"
+// @Failure      413  {object}  models.ErrorResponse "Screen recording exceeds the configured size limit"
+// @Failure      429  {object}  models.ErrorResponse "Rate limit exceeded; retry after the Retry-After header"
+// @Failure      501  {object}  models.ErrorResponse "Storage backend does not support direct uploads"
+// @Failure      503  {object}  models.ErrorResponse "Object storage not configured"
+// @Router       /uploads/presign [post]
+func (h *UploadHandler) PresignUpload(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context(), h.logger)
+	var req models.PresignUploadRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	if !h.isAllowedContentType(req.ContentType) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Unsupported content type",
+			Details: "Allowed content types: " + strings.Join(h.allowedContentTypes, ", "),
+		})
+		return
+	}
+
+	if services.IsVideoContentType(req.ContentType) && h.videoMaxSize > 0 && req.Size > h.videoMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error:   "Screen recording too large",
+			Code:    "file_too_large",
+			Details: fmt.Sprintf("Screen recordings may be at most %d bytes, got %d", h.videoMaxSize, req.Size),
+		})
+		return
+	}
+
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Storage not available",
+			Details: "Object storage is not configured",
+		})
+		return
+	}
+
+	duplicate, err := services.FindDuplicateUpload(c.Request.Context(), h.storage, h.mongoService, strings.ToLower(req.ChecksumSHA256))
+	if err != nil {
+		log.Warn("Failed to look up duplicate upload", zap.Error(err))
+	}
+	if duplicate != nil {
+		log.Info("Upload matches stored content, skipping upload", zap.String("key", duplicate.ObjectKey))
+		c.JSON(http.StatusOK, models.PresignUploadResponse{
+			ObjectKey: duplicate.ObjectKey,
+			Duplicate: true,
+		})
+		return
+	}
+
+	meta := services.UploadMetadata{Product: h.redactor.String(req.Product), Environment: h.environment}
+	objectKey, err := h.keys.NewKey(req.Filename, meta)
+	if err != nil {
+		log.Error("Failed to build object key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to generate upload URL",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	uploadURL, headers, err := h.storage.PresignPutURL(c.Request.Context(), objectKey, req.ContentType, strings.ToLower(req.ChecksumSHA256), meta.Tags(), h.uploadExpiry)
+	if err != nil {
+		if errors.Is(err, services.ErrPresignedUploadNotSupported) {
+			c.JSON(http.StatusNotImplemented, models.ErrorResponse{
+				Error:   "Direct uploads not supported",
+				Details: err.Error(),
+			})
+			return
+		}
+
+		log.Error("Failed to presign upload", zap.Error(err), zap.String("key", objectKey))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to generate upload URL",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	log.Info("Presigned upload URL generated",
+		zap.String("key", objectKey),
+		zap.String("content_type", req.ContentType),
+	)
+
+	c.JSON(http.StatusCreated, models.PresignUploadResponse{
+		UploadURL: uploadURL,
+		Method:    http.MethodPut,
+		Headers:   headers,
+		ObjectKey: objectKey,
+		ExpiresAt: time.Now().Add(h.uploadExpiry),
+	})
+}
+
+// isAllowedContentType checks a content type against the configured allow-list
+func (h *UploadHandler) isAllowedContentType(contentType string) bool {
+	for _, allowed := range h.allowedContentTypes {
+		if strings.EqualFold(strings.TrimSpace(allowed), contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateUploadSession godoc
+// @Summary      Start a resumable upload
+// @Description  Starts an upload session for a large attachment. Send the file in chunks with PATCH /uploads/{id}, resuming from the returned offset after a dropped connection, then call POST /uploads/{id}/complete and submit /report-issue with the uploadId form field.
+// @Tags         reports
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request body     models.CreateUploadSessionRequest true "File name, content type and size of the upload"
+// @Success      201  {object}  models.UploadSessionResponse "Upload session created"
+// @Failure      400  {object}  models.ErrorResponse "Invalid request body or unsupported content type"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid API key when API_KEY_AUTH is enabled"
+// @Failure      403  {object}  models.ErrorResponse "API key lacks the required scope"
+// @Failure      413  {object}  models.ErrorResponse "Screen recording exceeds the configured size limit"
+// @Failure      429  {object}  models.ErrorResponse "Rate limit exceeded; retry after the Retry-After header"
+// @Failure      503  {object}  models.ErrorResponse "Resumable uploads or object storage not configured"
+// @Router       /uploads [post]
+func (h *UploadHandler) CreateUploadSession(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context(), h.logger)
+	var req models.CreateUploadSessionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, validationErrorResponse(err))
+		return
+	}
+
+	if !h.isAllowedContentType(req.ContentType) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Unsupported content type",
+			Details: "Allowed content types: " + strings.Join(h.allowedContentTypes, ", "),
+		})
+		return
+	}
+
+	if services.IsVideoContentType(req.ContentType) && h.videoMaxSize > 0 && req.Size > h.videoMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error:   "Screen recording too large",
+			Code:    "file_too_large",
+			Details: fmt.Sprintf("Screen recordings may be at most %d bytes, got %d", h.videoMaxSize, req.Size),
+		})
+		return
+	}
+
+	if !h.sessionsAvailable(c) {
+		return
+	}
+
+	session, err := h.sessions.Create(h.redactor.String(req.Filename), req.ContentType, h.redactor.String(req.Product), req.Size, strings.ToLower(req.ChecksumSHA256))
+	if err != nil {
+		log.Error("Failed to create upload session", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to create upload session",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	log.Info("Upload session created",
+		zap.String("upload_id", session.ID),
+		zap.String("content_type", session.ContentType),
+		zap.Int64("size", session.Size),
+	)
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.ID)
+	c.JSON(http.StatusCreated, uploadSessionResponse(session))
+}
+
+// GetUploadSession godoc
+// @Summary      Get the state of a resumable upload
+// @Description  Returns the number of bytes received so far, so a client can resume an interrupted upload from the returned offset
+// @Tags         reports
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Upload session ID"
+// @Success      200  {object}  models.UploadSessionResponse "Upload session state"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid API key when API_KEY_AUTH is enabled"
+// @Failure      403  {object}  models.ErrorResponse "API key lacks the required scope"
+// @Failure      404  {object}  models.ErrorResponse "Upload session not found or expired"
+// @Failure      429  {object}  models.ErrorResponse "Rate limit exceeded; retry after the Retry-After header"
+// @Failure      503  {object}  models.ErrorResponse "Resumable uploads not configured"
+// @Router       /uploads/{id} [get]
+func (h *UploadHandler) GetUploadSession(c *gin.Context) {
+	if !h.sessionsAvailable(c) {
+		return
+	}
+
+	session, err := h.sessions.Get(c.Param("id"))
+	if err != nil {
+		h.sessionError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.JSON(http.StatusOK, uploadSessionResponse(session))
+}
+
+// AppendUploadChunk godoc
+// @Summary      Upload a chunk of a resumable upload
+// @Description  Appends the request body to the upload session. The Content-Range header (bytes start-end/total) must start at the current offset; on a mismatch the current offset is returned with 409 so the client can resume from it.
+// @Tags         reports
+// @Accept       application/octet-stream
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id             path      string  true  "Upload session ID"
+// @Param        Content-Range  header    string  true  "Byte range of the chunk, e.g. bytes 0-8388607/52428800"
+// @Success      200  {object}  models.UploadSessionResponse "Chunk stored; offset is the number of bytes received"
+// @Failure      400  {object}  models.ErrorResponse "Missing or invalid Content-Range header"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid API key when API_KEY_AUTH is enabled"
+// @Failure      403  {object}  models.ErrorResponse "API key lacks the required scope"
+// @Failure      404  {object}  models.ErrorResponse "Upload session not found or expired"
+// @Failure      409  {object}  models.UploadSessionResponse "Chunk does not start at the current offset or the session is completed"
+// @Failure      413  {object}  models.ErrorResponse "Chunk exceeds the upload body size limit"
+// @Failure      429  {object}  models.ErrorResponse "Rate limit exceeded; retry after the Retry-After header"
+// @Failure      503  {object}  models.ErrorResponse "Resumable uploads not configured"
+// @Router       /uploads/{id} [patch]
+func (h *UploadHandler) AppendUploadChunk(c *gin.Context) {
+	if !h.sessionsAvailable(c) {
+		return
+	}
+
+	start, end, total, err := parseContentRange(c.GetHeader("Content-Range"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid Content-Range header",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	id := c.Param("id")
+	session, err := h.sessions.Get(id)
+	if err != nil {
+		h.sessionError(c, err)
+		return
+	}
+	if total >= 0 && total != session.Size {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid Content-Range header",
+			Details: fmt.Sprintf("Total size %d does not match the declared upload size of %d", total, session.Size),
+		})
+		return
+	}
+
+	length := end - start + 1
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength != length {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid Content-Range header",
+			Details: fmt.Sprintf("Content-Range covers %d bytes but the body is %d bytes", length, c.Request.ContentLength),
+		})
+		return
+	}
+
+	var tooLarge *http.MaxBytesError
+	session, err = h.sessions.WriteChunk(id, start, c.Request.Body, length)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrUploadOffsetMismatch), errors.Is(err, services.ErrUploadSessionCompleted):
+		c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		c.JSON(http.StatusConflict, uploadSessionResponse(session))
+		return
+	case errors.As(err, &tooLarge) && session != nil:
+		c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		c.JSON(http.StatusRequestEntityTooLarge, models.BodyTooLargeError(tooLarge.Limit))
+		return
+	case session != nil:
+		// The chunk was cut short; the client resumes from the new offset
+		logger.FromContext(c.Request.Context(), h.logger).Warn("Upload chunk interrupted", zap.Error(err), zap.String("upload_id", id), zap.Int64("offset", session.Offset))
+		c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Upload chunk incomplete",
+			Code:    "chunk_incomplete",
+			Details: err.Error(),
+		})
+		return
+	default:
+		h.sessionError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.JSON(http.StatusOK, uploadSessionResponse(session))
+}
+
+// CompleteUploadSession godoc
+// @Summary      Complete a resumable upload
+// @Description  Verifies the assembled upload against its checksum and moves it to object storage. Reference the session ID as uploadId when submitting /report-issue.
+// @Tags         reports
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      string  true  "Upload session ID"
+// @Success      200  {object}  models.UploadSessionResponse "Upload stored; objectKey is set"
+// @Failure      401  {object}  models.ErrorResponse "Missing or invalid API key when API_KEY_AUTH is enabled"
+// @Failure      403  {object}  models.ErrorResponse "API key lacks the required scope"
+// @Failure      404  {object}  models.ErrorResponse "Upload session not found or expired"
+// @Failure      409  {object}  models.ErrorResponse "Not all bytes of the upload have been received"
+// @Failure      422  {object}  models.ErrorResponse "Upload does not match its checksum"
+// @Failure      429  {object}  models.ErrorResponse "Rate limit exceeded; retry after the Retry-After header"
+// @Failure      500  {object}  models.ErrorResponse "Failed to store the upload"
+// @Failure      503  {object}  models.ErrorResponse "Resumable uploads or object storage not configured, or object storage is saturated"
+// @Router       /uploads/{id}/complete [post]
+func (h *UploadHandler) CompleteUploadSession(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context(), h.logger)
+	if !h.sessionsAvailable(c) {
+		return
+	}
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Storage not available",
+			Details: "Object storage is not configured",
+		})
+		return
+	}
+
+	id := c.Param("id")
+	unlock := h.sessions.Lock(id)
+	defer unlock()
+
+	session, err := h.sessions.Get(id)
+	if err != nil {
+		h.sessionError(c, err)
+		return
+	}
+	if session.Status == services.UploadSessionCompleted {
+		c.JSON(http.StatusOK, uploadSessionResponse(session))
+		return
+	}
+	if session.Offset != session.Size {
+		c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Upload incomplete",
+			Code:    "upload_incomplete",
+			Details: fmt.Sprintf("Received %d of %d bytes", session.Offset, session.Size),
+		})
+		return
+	}
+
+	checksum, err := h.checksumSession(session.ID)
+	if err != nil {
+		log.Error("Failed to checksum upload session", zap.Error(err), zap.String("upload_id", id))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to store upload",
+			Details: err.Error(),
+		})
+		return
+	}
+	if session.ChecksumSHA256 != "" && session.ChecksumSHA256 != checksum {
+		log.Warn("Upload session checksum mismatch",
+			zap.String("upload_id", id),
+			zap.String("expected", session.ChecksumSHA256),
+			zap.String("actual", checksum),
+		)
+		if err := h.sessions.Remove(id); err != nil {
+			log.Warn("Failed to remove upload session", zap.Error(err), zap.String("upload_id", id))
+		}
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error:   "Checksum mismatch",
+			Code:    "checksum_mismatch",
+			Details: "The uploaded content does not match the declared SHA-256; start a new upload",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	duplicate, err := services.FindDuplicateUpload(ctx, h.storage, h.mongoService, checksum)
+	if err != nil {
+		log.Warn("Failed to look up duplicate upload", zap.Error(err))
+	}
+
+	var objectKey string
+	if duplicate != nil {
+		log.Info("Upload matches stored content, skipping upload", zap.String("key", duplicate.ObjectKey))
+		objectKey = duplicate.ObjectKey
+	} else {
+		meta := services.UploadMetadata{Product: session.Product, Environment: h.environment}
+		objectKey, err = h.keys.NewKey(session.Filename, meta)
+		if err != nil {
+			log.Error("Failed to build object key", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to store upload",
+				Details: err.Error(),
+			})
+			return
+		}
+
+		if err := h.storeSession(ctx, session, objectKey, meta.Tags()); err != nil {
+			if writeOverloaded(c, err) {
+				return
+			}
+			log.Error("Failed to store upload session", zap.Error(err), zap.String("upload_id", id), zap.String("key", objectKey))
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Failed to store upload",
+				Details: err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := h.sessions.MarkCompleted(session, objectKey); err != nil {
+		log.Error("Failed to complete upload session", zap.Error(err), zap.String("upload_id", id))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to store upload",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	log.Info("Upload session completed",
+		zap.String("upload_id", id),
+		zap.String("key", objectKey),
+		zap.Int64("size", session.Size),
+	)
+
+	resp := uploadSessionResponse(session)
+	resp.Duplicate = duplicate != nil
+	c.JSON(http.StatusOK, resp)
+}
+
+// checksumSession computes the hex-encoded SHA-256 of the staged data
+func (h *UploadHandler) checksumSession(id string) (string, error) {
+	f, err := h.sessions.Open(id)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read upload session data: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// storeSession moves the staged data of a session to object storage
+func (h *UploadHandler) storeSession(ctx context.Context, session *services.UploadSession, objectKey string, tags map[string]string) error {
+	f, err := h.sessions.Open(session.ID)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return h.storage.UploadStream(ctx, objectKey, f, session.Size, session.ContentType, tags)
+}
+
+// sessionsAvailable writes a 503 response when resumable uploads are disabled
+func (h *UploadHandler) sessionsAvailable(c *gin.Context) bool {
+	if h.sessions == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Resumable uploads not available",
+			Details: "Upload sessions are not configured",
+		})
+		return false
+	}
+	return true
+}
+
+// sessionError maps upload session errors to responses
+func (h *UploadHandler) sessionError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrUploadSessionNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Upload session not found",
+			Code:    "upload_not_found",
+			Details: "The upload session does not exist or has expired",
+		})
+		return
+	}
+
+	logger.FromContext(c.Request.Context(), h.logger).Error("Upload session error", zap.Error(err), zap.String("upload_id", c.Param("id")))
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error:   "Upload session error",
+		Details: err.Error(),
+	})
+}
+
+// uploadSessionResponse converts an upload session to its API representation
+func uploadSessionResponse(session *services.UploadSession) models.UploadSessionResponse {
+	return models.UploadSessionResponse{
+		ID:        session.ID,
+		Status:    session.Status,
+		Size:      session.Size,
+		Offset:    session.Offset,
+		ObjectKey: session.ObjectKey,
+		ExpiresAt: session.ExpiresAt,
+	}
+}
+
+// parseContentRange parses a "bytes start-end/total" header. Total is -1 when
+// given as "*".
+func parseContentRange(header string) (start, end, total int64, err error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes ")
+	if !ok {
+		return 0, 0, 0, errors.New(`expected "bytes start-end/total"`)
+	}
+
+	byteRange, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, errors.New(`expected "bytes start-end/total"`)
+	}
+	first, last, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, 0, errors.New(`expected "bytes start-end/total"`)
+	}
+
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid range start %q", first)
+	}
+	if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+		return 0, 0, 0, fmt.Errorf("invalid range end %q", last)
+	}
+
+	total = -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil || total <= end {
+			return 0, 0, 0, fmt.Errorf("invalid total size %q", size)
+		}
+	}
+
+	return start, end, total, nil
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// RegisterJSONFieldNames makes validation errors name fields after their JSON
+// (or form) keys, as sent by clients, instead of the Go struct fields
+func RegisterJSONFieldNames(v *validator.Validate) {
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return f.Name
+	})
+}
+
+// writeBindError responds to a request body that could not be bound, with
+// 413 when it was cut off by the body size limit and 400 otherwise
+func writeBindError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, models.BodyTooLargeError(tooLarge.Limit))
+		return
+	}
+	c.JSON(http.StatusBadRequest, bindErrorResponse(err))
+}
+
+// bindErrorResponse describes a request body that could not be bound. Bodies
+// that decode but fail binding rules are reported like validation errors.
+func bindErrorResponse(err error) models.ErrorResponse {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		return validationErrorResponse(err)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		field := models.FieldError{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("%s must be of type %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value),
+		}
+		return models.ErrorResponse{
+			Error:   "Validation failed",
+			Code:    "validation_failed",
+			Details: field.Message,
+			Fields:  []models.FieldError{field},
+		}
+	}
+
+	return models.ErrorResponse{
+		Error:   "Invalid request body",
+		Code:    "invalid_body",
+		Details: err.Error(),
+	}
+}
+
+// validationErrorResponse lists each invalid field of a failed validation
+func validationErrorResponse(err error) models.ErrorResponse {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return models.ErrorResponse{
+			Error:   "Validation failed",
+			Code:    "validation_failed",
+			Details: err.Error(),
+		}
+	}
+
+	fields := make([]models.FieldError, 0, len(verrs))
+	messages := make([]string, 0, len(verrs))
+	for _, fe := range verrs {
+		field := models.FieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Code:    fieldErrorCode(fe.Tag()),
+			Message: fieldErrorMessage(fe),
+		}
+		fields = append(fields, field)
+		messages = append(messages, field.Message)
+	}
+
+	return models.ErrorResponse{
+		Error:   "Validation failed",
+		Code:    "validation_failed",
+		Details: strings.Join(messages, "; "),
+		Fields:  fields,
+	}
+}
+
+// writeFieldErrors responds with 400 listing each invalid field
+func writeFieldErrors(c *gin.Context, fields []models.FieldError) {
+	messages := make([]string, 0, len(fields))
+	for _, f := range fields {
+		messages = append(messages, f.Message)
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		Error:   "Validation failed",
+		Code:    "validation_failed",
+		Details: strings.Join(messages, "; "),
+		Fields:  fields,
+	})
+}
+
+// fieldPath returns the path of the field without the top-level struct name
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return fe.Field()
+}
+
+// fieldErrorCode maps a validation rule to a machine-readable error code
+func fieldErrorCode(tag string) string {
+	switch {
+	case tag == "required" || strings.HasPrefix(tag, "required_"):
+		return "required"
+	case tag == "min" || tag == "max" || tag == "len" || tag == "gt" || tag == "gte" || tag == "lt" || tag == "lte":
+		return "out_of_range"
+	case tag == "oneof":
+		return "invalid_choice"
+	case tag == "email" || tag == "url" || tag == "uri" || tag == "uuid" || tag == "uuid4" || tag == "hexadecimal" || tag == "datetime":
+		return "invalid_format"
+	default:
+		return "invalid_value"
+	}
+}
+
+// fieldErrorMessage returns a short human-readable message for a field error
+func fieldErrorMessage(fe validator.FieldError) string {
+	name := fieldPath(fe)
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", name)
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters long", name, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", name, fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters long", name, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", name, fe.Param())
+	case "len":
+		return fmt.Sprintf("%s must be exactly %s characters long", name, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", name, fe.Param())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", name)
+	case "url", "uri":
+		return fmt.Sprintf("%s must be a valid URL", name)
+	case "hexadecimal":
+		return fmt.Sprintf("%s must be a hexadecimal string", name)
+	default:
+		if fe.Param() != "" {
+			return fmt.Sprintf("%s failed the %s=%s rule", name, fe.Tag(), fe.Param())
+		}
+		return fmt.Sprintf("%s failed the %s rule", name, fe.Tag())
+	}
+}
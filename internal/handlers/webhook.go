@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+type WebhookHandler struct {
+	mongoService *services.MongoDBService
+	logger       *zap.Logger
+
+	// listeners are told of changes to the state of tickets
+	listeners []services.TicketStateListener
+
+	// tenants own the tickets of their Jira projects; nil without tenants
+	tenants *services.Tenants
+}
+
+// NewWebhookHandler creates a handler for webhooks of the ticket tracker.
+// Verifying them is left to middleware.VerifyWebhook.
+func NewWebhookHandler(ms *services.MongoDBService, log *zap.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		mongoService: ms,
+		logger:       log,
+	}
+}
+
+// OnTicketStateChange adds a listener told of the ticket state changes
+// webhooks deliver
+func (h *WebhookHandler) OnTicketStateChange(listener services.TicketStateListener) {
+	h.listeners = append(h.listeners, listener)
+}
+
+// SetTenants sets the tenants whose tickets webhooks may update
+func (h *WebhookHandler) SetTenants(tenants *services.Tenants) {
+	h.tenants = tenants
+}
+
+// JiraWebhook godoc
+// @Summary      Receive Jira webhook
+// @Description  Stores the status, assignee and resolution of tickets created or updated in Jira. The webhook must be signed with JIRA_WEBHOOK_SECRET as an HMAC-SHA256 of the body in the X-Hub-Signature header, and its timestamp must be within WEBHOOK_TOLERANCE. Replayed deliveries are acknowledged with status "duplicate"; events for other issues are acknowledged with status "ignored".
+// @Tags         webhooks
+// @Accept       json
+// @Produce      json
+// @Param        X-Hub-Signature header string false "sha256=<hex HMAC-SHA256 of the body>; also read from X-Webhook-Signature or X-Hub-Signature-256"
+// @Success      200  {object}  map[string]string "Status of the delivery"
+// @Failure      400  {object}  models.ErrorResponse "Malformed webhook"
+// @Failure      401  {object}  models.ErrorResponse "Invalid signature or stale timestamp"
+// @Failure      503  {object}  models.ErrorResponse "MongoDB is not configured"
+// @Router       /webhooks/jira [post]
+func (h *WebhookHandler) JiraWebhook(c *gin.Context) {
+	if h.mongoService == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Ticket storage not available",
+			Details: "MongoDB is not configured",
+		})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Failed to read webhook",
+			Details: err.Error(),
+		})
+		return
+	}
+	event, err := services.ParseJiraWebhook(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Invalid webhook",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if (event.Event != services.JiraEventIssueCreated && event.Event != services.JiraEventIssueUpdated) ||
+		event.Issue == nil || event.Issue.Key == "" {
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx, h.logger)
+	ticketID := event.Issue.Key
+	state := event.State()
+
+	// Listeners compare the new state with the stored one
+	var previous *services.FlattenedTicket
+	if len(h.listeners) > 0 {
+		previous, _ = h.mongoService.GetTicketByJiraID(h.tenants.TicketContext(ctx, ticketID), ticketID)
+	}
+
+	err = h.mongoService.UpdateTicketState(ctx, ticketID, state, time.Now())
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		// Issues not filed through ronnin share the Jira project
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		return
+	}
+	if err != nil {
+		log.Error("Failed to store ticket state from webhook", zap.Error(err), zap.String("ticket_id", ticketID))
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Failed to update ticket",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if previous != nil {
+		for _, listener := range h.listeners {
+			listener(previous, state)
+		}
+	}
+
+	log.Info("Updated ticket state from webhook", zap.String("ticket_id", ticketID), zap.String("event", event.Event))
+	c.JSON(http.StatusOK, gin.H{"status": "updated"})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// widgetFiles are the embeddable report widget: widget.js runs in the
+// host page and opens the report form in an iframe
+//
+//go:embed widget/*
+var widgetFiles embed.FS
+
+// WidgetOptions configure the report widget
+type WidgetOptions struct {
+	// FrameAncestors are the origins that may embed the report form; "*"
+	// allows any
+	FrameAncestors []string
+	// PowDifficulty is the proof of work reports need, 0 when they need
+	// none
+	PowDifficulty int
+}
+
+// WidgetHandler serves the embeddable report widget
+type WidgetHandler struct {
+	form []byte
+	csp  string
+}
+
+func NewWidgetHandler(opts WidgetOptions) (*WidgetHandler, error) {
+	page, err := template.ParseFS(widgetFiles, "widget/report.html")
+	if err != nil {
+		return nil, err
+	}
+	var form bytes.Buffer
+	if err := page.Execute(&form, opts); err != nil {
+		return nil, err
+	}
+
+	ancestors := "'none'"
+	if len(opts.FrameAncestors) > 0 {
+		ancestors = strings.Join(opts.FrameAncestors, " ")
+	}
+	return &WidgetHandler{
+		form: form.Bytes(),
+		csp:  "default-src 'self'; img-src 'self' blob:; frame-ancestors " + ancestors,
+	}, nil
+}
+
+// ReportForm serves the report form the widget opens in an iframe. Unlike
+// other pages it may be framed, by the origins allowed to call the API.
+func (h *WidgetHandler) ReportForm(c *gin.Context) {
+	c.Writer.Header().Del("X-Frame-Options")
+	c.Header("Content-Security-Policy", h.csp)
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", h.form)
+}
+
+// File returns a handler serving a script or style of the widget
+func (h *WidgetHandler) File(name string) gin.HandlerFunc {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	return func(c *gin.Context) {
+		data, err := widgetFiles.ReadFile("widget/" + name)
+		if err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Not found"})
+			return
+		}
+		// Host pages load widget.js from ronnin, so it must not be blocked
+		// as a cross-origin resource
+		c.Header("Cross-Origin-Resource-Policy", "cross-origin")
+		c.Header("Cache-Control", "public, max-age=300")
+		c.Data(http.StatusOK, contentType, data)
+	}
+}
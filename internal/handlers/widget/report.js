@@ -0,0 +1,123 @@
+'use strict';
+
+// The report form runs in an iframe opened by widget.js, which sends it what
+// it captured from the host page. Reports are posted to the API of the same
+// origin, so no CORS setup is needed for them.
+const REPORT_URL = new URL('../api/v1/report-issue', location.href);
+
+const $ = (id) => document.getElementById(id);
+
+let parentOrigin = null;
+let context = {};
+
+function notify(message) {
+  if (parentOrigin) {
+    window.parent.postMessage(message, parentOrigin);
+  }
+}
+
+function receive(event) {
+  if (event.source !== window.parent || !event.data || event.data.type !== 'ronnin:init') {
+    return;
+  }
+  parentOrigin = event.origin;
+  context = event.data;
+  if (context.userEmail) {
+    $('email').value = context.userEmail;
+    $('email-field').hidden = true;
+  }
+  if (context.screenshot instanceof Blob) {
+    $('preview').src = URL.createObjectURL(context.screenshot);
+    $('screenshot').hidden = false;
+  }
+  const calls = context.failedNetworkCalls || [];
+  if (calls.length > 0) {
+    $('calls').textContent = calls.length === 1
+      ? '1 failed request of the page will be included.'
+      : calls.length + ' failed requests of the page will be included.';
+    $('calls').hidden = false;
+  }
+  $('issue').focus();
+}
+
+// stamp computes a proof of work: a stamp whose SHA-256 hash starts with
+// bits zero bits
+async function stamp(bits) {
+  const prefix = Math.floor(Date.now() / 1000) + ':' + crypto.randomUUID() + ':';
+  for (let nonce = 0; ; nonce++) {
+    const hash = new Uint8Array(await crypto.subtle.digest('SHA-256', new TextEncoder().encode(prefix + nonce)));
+    let zeros = 0;
+    for (const b of hash) {
+      if (b) {
+        zeros += Math.clz32(b) - 24;
+        break;
+      }
+      zeros += 8;
+    }
+    if (zeros >= bits) return prefix + nonce;
+  }
+}
+
+function errorMessage(status, body) {
+  if (status === 429) return 'Too many reports were sent, please try again in a moment.';
+  if (body && body.code === 'maintenance') return body.details;
+  if (!body || !body.error) return 'The report could not be sent (status ' + status + ').';
+  const fields = (body.fields || []).map((f) => f.message).join(', ');
+  return body.error + (fields ? ': ' + fields : body.details ? ': ' + body.details : '');
+}
+
+async function submit(event) {
+  event.preventDefault();
+  const form = new FormData($('report'));
+  if (!form.get('description')) {
+    form.set('description', form.get('issue'));
+  }
+  for (const [key, value] of [['product', context.product], ['leadId', context.leadId], ['pageUrl', context.pageUrl]]) {
+    if (value) form.set(key, value);
+  }
+  const calls = context.failedNetworkCalls || [];
+  if (calls.length > 0) {
+    form.set('failedNetworkCalls', JSON.stringify(calls));
+  }
+  if (context.screenshot instanceof Blob && $('attach').checked) {
+    form.set('image0', context.screenshot, 'screenshot.png');
+  }
+
+  $('submit').disabled = true;
+  $('error').hidden = true;
+  try {
+    const headers = {};
+    if (context.apiKey) {
+      headers.Authorization = 'Bearer ' + context.apiKey;
+    }
+    const difficulty = Number(document.body.dataset.powDifficulty);
+    if (difficulty > 0 && !context.apiKey) {
+      headers['X-Proof-Of-Work'] = await stamp(difficulty);
+    }
+    const resp = await fetch(REPORT_URL, { method: 'POST', body: form, headers });
+    const body = await resp.json().catch(() => null);
+    if (!resp.ok) {
+      throw new Error(errorMessage(resp.status, body));
+    }
+    $('done-message').textContent = body.ticketId
+      ? 'Your report was filed as ' + body.ticketId + '.'
+      : 'Your report was received.';
+    $('report').hidden = true;
+    $('done').hidden = false;
+    notify({ type: 'ronnin:submitted', ticketId: body.ticketId || '', reportId: body.reportId || '' });
+  } catch (err) {
+    $('error').textContent = err.message;
+    $('error').hidden = false;
+  } finally {
+    $('submit').disabled = false;
+  }
+}
+
+window.addEventListener('message', receive);
+document.addEventListener('DOMContentLoaded', () => {
+  $('report').addEventListener('submit', submit);
+  $('cancel').addEventListener('click', () => notify({ type: 'ronnin:close' }));
+  $('close').addEventListener('click', () => notify({ type: 'ronnin:close' }));
+  document.addEventListener('keydown', (e) => e.key === 'Escape' && notify({ type: 'ronnin:close' }));
+  window.parent.postMessage({ type: 'ronnin:ready' }, '*');
+});
@@ -0,0 +1,198 @@
+/*
+ * ronnin report widget. Add it to a page with
+ *
+ *   <script src="https://ronnin.example.com/widget.js" data-product="checkout" async></script>
+ *
+ * Attributes: data-product, data-user-email, data-lead-id, data-api-key (a
+ * key of the report scope, when API_KEY_AUTH is on), data-label (the
+ * button's text), data-button="false" to open the form with
+ * ronnin.open() from the page's own button instead, and
+ * data-screenshot="false" to not offer a screenshot.
+ *
+ * Failed fetch and XMLHttpRequest calls of the page are kept to be sent
+ * with the report. A filed report is announced with a "ronnin:report"
+ * event on window.
+ */
+(function () {
+  'use strict';
+
+  var script = document.currentScript;
+  if (!script || window.ronnin) {
+    return;
+  }
+  var base = new URL('.', script.src);
+  var origin = base.origin;
+  var options = script.dataset;
+  var MAX_CALLS = 20;
+  var MAX_BODY = 2000;
+
+  var failedCalls = [];
+
+  function record(method, url, status, body) {
+    // Reports themselves are not failed calls of the page
+    if (String(url).indexOf(origin) === 0) {
+      return;
+    }
+    failedCalls.push({
+      requestData: { method: (method || 'GET').toUpperCase(), url: String(url) },
+      responseStatus: status,
+      responseBody: String(body || '').slice(0, MAX_BODY),
+      pageUrl: location.href,
+      timestamp: new Date().toISOString(),
+    });
+    if (failedCalls.length > MAX_CALLS) {
+      failedCalls.shift();
+    }
+  }
+
+  if (window.fetch) {
+    var fetch = window.fetch;
+    window.fetch = function (input, init) {
+      var method = (init && init.method) || (input && input.method) || 'GET';
+      var url = input && input.url ? input.url : input;
+      return fetch.apply(this, arguments).then(function (resp) {
+        if (!resp.ok) {
+          resp.clone().text().then(function (body) {
+            record(method, url, resp.status, body);
+          }, function () {
+            record(method, url, resp.status, '');
+          });
+        }
+        return resp;
+      }, function (err) {
+        record(method, url, 0, err && err.message);
+        throw err;
+      });
+    };
+  }
+
+  var open = XMLHttpRequest.prototype.open;
+  var send = XMLHttpRequest.prototype.send;
+  XMLHttpRequest.prototype.open = function (method, url) {
+    this._ronnin = { method: method, url: url };
+    return open.apply(this, arguments);
+  };
+  XMLHttpRequest.prototype.send = function () {
+    var xhr = this;
+    xhr.addEventListener('loadend', function () {
+      if (xhr._ronnin && (xhr.status === 0 || xhr.status >= 400)) {
+        var body = xhr.responseType === '' || xhr.responseType === 'text' ? xhr.responseText : '';
+        record(xhr._ronnin.method, xhr._ronnin.url, xhr.status, body);
+      }
+    });
+    return send.apply(this, arguments);
+  };
+
+  // capture draws a frame of the tab onto a canvas, with the permission of
+  // the user; without it the report is sent without a screenshot
+  function capture() {
+    if (options.screenshot === 'false' || !navigator.mediaDevices || !navigator.mediaDevices.getDisplayMedia) {
+      return Promise.resolve(null);
+    }
+    return navigator.mediaDevices.getDisplayMedia({ video: { displaySurface: 'browser' }, audio: false, preferCurrentTab: true })
+      .then(function (stream) {
+        var video = document.createElement('video');
+        video.muted = true;
+        video.srcObject = stream;
+        return video.play().then(function () {
+          return new Promise(function (resolve) { requestAnimationFrame(resolve); });
+        }).then(function () {
+          var canvas = document.createElement('canvas');
+          canvas.width = video.videoWidth;
+          canvas.height = video.videoHeight;
+          canvas.getContext('2d').drawImage(video, 0, 0);
+          return new Promise(function (resolve) { canvas.toBlob(resolve, 'image/png'); });
+        }).finally(function () {
+          stream.getTracks().forEach(function (track) { track.stop(); });
+        });
+      })
+      .catch(function () {
+        return null;
+      });
+  }
+
+  var overlay = null;
+  var button = null;
+
+  function close() {
+    if (overlay) {
+      overlay.remove();
+      overlay = null;
+    }
+    if (button) {
+      button.style.display = '';
+    }
+  }
+
+  function show(screenshot) {
+    overlay = document.createElement('div');
+    overlay.style.cssText = 'position:fixed;inset:0;z-index:2147483647;background:rgba(0,0,0,.4);display:flex;align-items:center;justify-content:center';
+    var frame = document.createElement('iframe');
+    frame.src = new URL('widget/report', base).href;
+    frame.title = 'Report an issue';
+    frame.style.cssText = 'width:min(480px,100vw);height:min(640px,100vh);border:0;border-radius:8px;background:#fff;box-shadow:0 8px 24px rgba(0,0,0,.2)';
+    overlay.appendChild(frame);
+    overlay.addEventListener('click', function (e) {
+      if (e.target === overlay) close();
+    });
+    document.body.appendChild(overlay);
+
+    function receive(event) {
+      if (event.origin !== origin || event.source !== frame.contentWindow || !event.data) {
+        return;
+      }
+      switch (event.data.type) {
+        case 'ronnin:ready':
+          frame.contentWindow.postMessage({
+            type: 'ronnin:init',
+            product: options.product || '',
+            userEmail: options.userEmail || '',
+            leadId: options.leadId || '',
+            apiKey: options.apiKey || '',
+            pageUrl: location.href,
+            failedNetworkCalls: failedCalls.slice(),
+            screenshot: screenshot,
+          }, origin);
+          break;
+        case 'ronnin:submitted':
+          failedCalls = [];
+          window.dispatchEvent(new CustomEvent('ronnin:report', { detail: { ticketId: event.data.ticketId, reportId: event.data.reportId } }));
+          break;
+        case 'ronnin:close':
+          window.removeEventListener('message', receive);
+          close();
+          break;
+      }
+    }
+    window.addEventListener('message', receive);
+  }
+
+  function openForm() {
+    if (overlay) {
+      return;
+    }
+    // The button is hidden so it is not in the screenshot
+    if (button) {
+      button.style.display = 'none';
+    }
+    capture().then(show);
+  }
+
+  window.ronnin = { open: openForm };
+
+  if (options.button !== 'false') {
+    var addButton = function () {
+      button = document.createElement('button');
+      button.type = 'button';
+      button.textContent = options.label || 'Report an issue';
+      button.style.cssText = 'position:fixed;right:20px;bottom:20px;z-index:2147483646;padding:10px 16px;border:0;border-radius:20px;background:#1f883d;color:#fff;font:14px -apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif;cursor:pointer;box-shadow:0 2px 8px rgba(0,0,0,.2)';
+      button.addEventListener('click', openForm);
+      document.body.appendChild(button);
+    };
+    if (document.body) {
+      addButton();
+    } else {
+      document.addEventListener('DOMContentLoaded', addButton);
+    }
+  }
+})();
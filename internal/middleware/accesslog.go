@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AccessLogOptions control what the access log records
+type AccessLogOptions struct {
+	// SampleRate is the share of successful requests logged, from 0 to 1.
+	// Client and server errors are always logged.
+	SampleRate float64
+	// RequestBody and ResponseBody add up to BodyLimit bytes of the bodies
+	// to each line, for debugging
+	RequestBody  bool
+	ResponseBody bool
+	BodyLimit    int
+}
+
+// AccessLog writes a line per request with its method, route, status,
+// latency, sizes, client IP and request ID. Successful requests are sampled
+// at SampleRate; 4xx responses are logged as warnings and 5xx as errors.
+// Bodies are redacted with redactor before they are logged.
+func AccessLog(log *zap.Logger, redactor *services.Redactor, opts AccessLogOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		var reqBody *capturedBody
+		if opts.RequestBody && c.Request.Body != nil && c.Request.Body != http.NoBody {
+			reqBody = &capturedBody{ReadCloser: c.Request.Body, limit: opts.BodyLimit}
+			c.Request.Body = reqBody
+		}
+		var respBody *capturedResponse
+		if opts.ResponseBody {
+			respBody = &capturedResponse{ResponseWriter: c.Writer, limit: opts.BodyLimit}
+			c.Writer = respBody
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := zapcore.InfoLevel
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = zapcore.ErrorLevel
+		case status >= http.StatusBadRequest:
+			level = zapcore.WarnLevel
+		case opts.SampleRate < 1 && rand.Float64() >= opts.SampleRate:
+			return
+		}
+
+		ce := log.Check(level, "HTTP request")
+		if ce == nil {
+			return
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedEndpoint
+		}
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int64("request_size", max(c.Request.ContentLength, 0)),
+			zap.Int("response_size", max(c.Writer.Size(), 0)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+		}
+		if id := logger.RequestID(c.Request.Context()); id != "" {
+			fields = append(fields, zap.String("request_id", id))
+		}
+		if c.Request.URL.RawQuery != "" {
+			fields = append(fields, zap.String("query", redactor.String(c.Request.URL.RawQuery)))
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+		if reqBody != nil && reqBody.buf.Len() > 0 {
+			fields = append(fields, zap.String("request_body", loggableBody(redactor, c.ContentType(), reqBody.buf.Bytes(), reqBody.truncated)))
+		}
+		if respBody != nil && respBody.buf.Len() > 0 {
+			body := "[" + respBody.Header().Get("Content-Encoding") + " encoded]"
+			if respBody.Header().Get("Content-Encoding") == "" {
+				body = loggableBody(redactor, respBody.Header().Get("Content-Type"), respBody.buf.Bytes(), respBody.truncated)
+			}
+			fields = append(fields, zap.String("response_body", body))
+		}
+		ce.Write(fields...)
+	}
+}
+
+// loggableBody returns a redacted body, or a placeholder for binary content
+func loggableBody(redactor *services.Redactor, contentType string, body []byte, truncated bool) string {
+	if contentType != "" && !strings.HasPrefix(contentType, "text/") && !strings.Contains(contentType, "json") &&
+		!strings.Contains(contentType, "x-www-form-urlencoded") && !strings.Contains(contentType, "xml") {
+		return "[" + contentType + "]"
+	}
+	text := redactor.String(string(body))
+	if truncated {
+		text += "..."
+	}
+	return text
+}
+
+// capturedBody keeps the first limit bytes of a request body as the
+// handler reads it
+type capturedBody struct {
+	io.ReadCloser
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.keep(p[:n])
+	return n, err
+}
+
+func (b *capturedBody) keep(p []byte) {
+	room := b.limit - b.buf.Len()
+	if len(p) > room {
+		b.truncated = true
+	}
+	if room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+}
+
+// capturedResponse keeps the first limit bytes of a response body
+type capturedResponse struct {
+	gin.ResponseWriter
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (w *capturedResponse) Write(p []byte) (int, error) {
+	w.keep(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *capturedResponse) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *capturedResponse) keep(p []byte) {
+	room := w.limit - w.buf.Len()
+	if len(p) > room {
+		w.truncated = true
+	}
+	if room > 0 {
+		w.buf.Write(p[:min(len(p), room)])
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// AdminAuth requires the admin API token as a Bearer token on every request
+func AdminAuth(token string) gin.HandlerFunc {
+	return TokenAuth("admin", token)
+}
+
+// TokenAuth requires token as a Bearer token on every request. An empty
+// token rejects all requests.
+func TokenAuth(realm, token string) gin.HandlerFunc {
+	challenge := fmt.Sprintf("Bearer realm=%q", realm)
+
+	return func(c *gin.Context) {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				Error: "Unauthorized",
+			})
+			return
+		}
+
+		c.Set(TokenContextKey, realm)
+		c.Next()
+	}
+}
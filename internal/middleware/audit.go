@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// auditWriteTimeout bounds writing an audit entry after the response
+const auditWriteTimeout = 5 * time.Second
+
+// auditTransitions are the last route segments of requests that move a
+// resource to another state rather than creating or changing it
+var auditTransitions = map[string]bool{
+	"approve":    true,
+	"complete":   true,
+	"reassign":   true,
+	"resync":     true,
+	"retry":      true,
+	"rotate-url": true,
+	"sync":       true,
+}
+
+// auditDownloads are the routes whose GET requests are recorded as well, as
+// they hand out the files reporters uploaded
+var auditDownloads = []string{"/attachments/:id"}
+
+// Audit appends every POST, PUT, PATCH and DELETE request, and every
+// download of an attachment, to the audit log once it has been handled,
+// including rejected ones. The caller is the API
+// key, SSO subject or token the request was authenticated with, and the
+// resource is the request's id or reportId path parameter. A failure to
+// write the entry is logged and does not fail the request.
+func Audit(ms *services.MongoDBService, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		action := auditAction(c.Request.Method, c.FullPath())
+		if action == "" {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		entry := &services.AuditEntry{
+			At:         time.Now(),
+			Action:     action,
+			Method:     c.Request.Method,
+			Route:      c.FullPath(),
+			ResourceID: c.Param("id"),
+			Status:     c.Writer.Status(),
+			ClientIP:   c.ClientIP(),
+			RequestID:  logger.RequestID(c.Request.Context()),
+		}
+		if entry.ResourceID == "" {
+			entry.ResourceID = c.Param("reportId")
+		}
+		entry.Actor, entry.ActorType = auditActor(c)
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), auditWriteTimeout)
+		defer cancel()
+		if err := ms.SaveAuditEntry(ctx, entry); err != nil {
+			logger.FromContext(ctx, log).Error("Failed to write audit entry", zap.Error(err),
+				zap.String("route", entry.Route), zap.String("actor", entry.Actor))
+		}
+	}
+}
+
+// auditAction returns the audit action of a request, or "" when it neither
+// mutates anything nor downloads a file, or matched no route
+func auditAction(method, route string) string {
+	if route == "" {
+		return ""
+	}
+	switch method {
+	case http.MethodGet:
+		for _, download := range auditDownloads {
+			if strings.HasSuffix(route, download) {
+				return services.AuditActionDownload
+			}
+		}
+	case http.MethodPost, http.MethodPut:
+		if auditTransitions[route[strings.LastIndex(route, "/")+1:]] {
+			return services.AuditActionTransition
+		}
+		if method == http.MethodPut {
+			return services.AuditActionPatch
+		}
+		return services.AuditActionCreate
+	case http.MethodPatch:
+		return services.AuditActionPatch
+	case http.MethodDelete:
+		return services.AuditActionDelete
+	}
+	return ""
+}
+
+// auditActor returns the name and kind of the caller of a request
+func auditActor(c *gin.Context) (string, string) {
+	if key := c.GetString(APIKeyContextKey); key != "" {
+		return key, services.AuditActorAPIKey
+	}
+	if subject := c.GetString(SubjectContextKey); subject != "" {
+		return subject, services.AuditActorUser
+	}
+	if principal := CurrentPrincipal(c); principal != nil {
+		return principal.Name, services.AuditActorToken
+	}
+	if realm := c.GetString(TokenContextKey); realm != "" {
+		return realm + "-token", services.AuditActorToken
+	}
+	return "", services.AuditActorAnonymous
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// Context keys of the caller a request was authenticated as
+const (
+	APIKeyContextKey    = "middleware.apiKey"
+	SubjectContextKey   = "middleware.subject"
+	PrincipalContextKey = "middleware.principal"
+	// TokenContextKey holds the realm of the token TokenAuth accepted
+	TokenContextKey = "middleware.token"
+)
+
+// adminTokenPrincipal is the caller authenticated with the admin token
+var adminTokenPrincipal = services.NewPrincipal("admin-token", []string{services.ScopeAdmin}, nil)
+
+var apiKeyRequestsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_key_requests_total",
+		Help: "Total number of requests authenticated with an API key",
+	},
+	[]string{"key", "scope", "status"},
+)
+
+// Credentials are the ways clients can authenticate: the admin token, API
+// keys and, when OIDC is not nil, bearer tokens of the identity provider
+type Credentials struct {
+	AdminToken string
+	APIKeys    *services.APIKeyStore
+	OIDC       *services.OIDCVerifier
+}
+
+// RequireScope requires credentials granting scope. API keys are given in
+// the X-API-Key header or as a Bearer token, OIDC tokens as a Bearer token.
+// The admin token, when set, is accepted in place of a key with every scope.
+// The caller's role and products are stored for handlers to apply the
+// ticket policy with, see CurrentPrincipal. Keys of a tenant are never
+// granted the admin scope, which covers every tenant, and their tenant is
+// carried by the request context.
+func RequireScope(creds Credentials, scope string, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := c.GetHeader("X-API-Key")
+		if provided == "" {
+			provided = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if creds.AdminToken != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(creds.AdminToken)) == 1 {
+			c.Set(PrincipalContextKey, adminTokenPrincipal)
+			c.Next()
+			return
+		}
+
+		if creds.OIDC != nil && services.LooksLikeJWT(provided) {
+			identity, err := creds.OIDC.Verify(c.Request.Context(), provided)
+			if err != nil {
+				authError(c, err, log)
+				return
+			}
+			if !identity.Allows(scope) {
+				forbidden(c, "Roles of "+identity.Subject+" do not grant the "+scope+" scope")
+				return
+			}
+			c.Set(SubjectContextKey, identity.Subject)
+			c.Set(PrincipalContextKey, services.NewPrincipal(identity.Subject, identity.Scopes, identity.Products))
+			c.Next()
+			return
+		}
+
+		key, err := creds.APIKeys.Authenticate(c.Request.Context(), provided)
+		if err != nil {
+			authError(c, err, log)
+			return
+		}
+		if !key.Allows(scope) || (key.Tenant != "" && scope == services.ScopeAdmin) {
+			apiKeyRequestsTotal.WithLabelValues(key.Name, scope, strconv.Itoa(http.StatusForbidden)).Inc()
+			forbidden(c, "API key "+key.Name+" is not allowed the "+scope+" scope")
+			return
+		}
+
+		principal := services.NewPrincipal(key.Name, key.Scopes, key.Products)
+		principal.Tenant = key.Tenant
+		c.Set(APIKeyContextKey, key.Name)
+		c.Set(PrincipalContextKey, principal)
+		c.Request = c.Request.WithContext(services.WithTenant(c.Request.Context(), key.Tenant))
+		c.Next()
+		apiKeyRequestsTotal.WithLabelValues(key.Name, scope, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
+
+// CurrentPrincipal returns the caller RequireScope authenticated, or nil on
+// routes that require no credentials
+func CurrentPrincipal(c *gin.Context) *services.Principal {
+	p, _ := c.Get(PrincipalContextKey)
+	principal, _ := p.(*services.Principal)
+	return principal
+}
+
+// authError rejects a request whose credentials could not be verified
+func authError(c *gin.Context, err error, log *zap.Logger) {
+	if !errors.Is(err, services.ErrInvalidAPIKey) && !errors.Is(err, services.ErrInvalidIDToken) {
+		logger.FromContext(c.Request.Context(), log).Error("Failed to verify credentials", zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Authentication unavailable",
+			Details: "Credentials could not be verified",
+		})
+		return
+	}
+
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+		Error:   "Unauthorized",
+		Details: err.Error(),
+	})
+}
+
+func forbidden(c *gin.Context, details string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+		Error:   "Forbidden",
+		Details: details,
+	})
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// unlimitedBodyKey holds the request body as received, before any limit
+const unlimitedBodyKey = "middleware.unlimitedBody"
+
+// BodyLimit caps the size of request bodies at limit bytes; 0 disables the
+// limit. Requests declaring a larger Content-Length are rejected with 413
+// up front, others fail once the handler reads past the limit. When applied
+// more than once, as globally and then on an upload route, the last limit
+// applies.
+func BodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := c.Get(unlimitedBodyKey)
+		if !ok {
+			body = c.Request.Body
+			c.Set(unlimitedBodyKey, body)
+		}
+
+		if limit <= 0 {
+			c.Request.Body = body.(io.ReadCloser)
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			// The unread body is not worth draining to keep the connection
+			c.Header("Connection", "close")
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, models.BodyTooLargeError(limit))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, body.(io.ReadCloser), limit)
+		c.Next()
+	}
+}
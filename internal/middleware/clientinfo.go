@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+)
+
+// ClientContextKey is the gin context key holding the environment of the
+// client a report was sent from
+const ClientContextKey = "middleware.client"
+
+// ClientInfo describes the browser, OS, device, screen and locale of the
+// client from its User-Agent, client hints and the X-Client-* headers of the
+// SDK, for handlers to add to reports. Chromium browsers are asked to send
+// their platform version with the next request, which tells Windows 11 from
+// Windows 10.
+func ClientInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Accept-CH", "Sec-CH-UA-Platform-Version")
+		if env := services.DescribeClient(c.Request.Header); env != nil {
+			c.Set(ClientContextKey, env)
+		}
+		c.Next()
+	}
+}
+
+// CurrentClient returns the client environment ClientInfo described, or nil
+// when it is not enabled
+func CurrentClient(c *gin.Context) *models.ClientEnvironment {
+	v, _ := c.Get(ClientContextKey)
+	env, _ := v.(*models.ClientEnvironment)
+	return env
+}
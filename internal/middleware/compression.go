@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Supported response content codings, in order of preference
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	brotliWriters = sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, 4)
+	}}
+)
+
+// Compress compresses responses with brotli or gzip, as negotiated from the
+// Accept-Encoding header. Responses are only compressed once they reach
+// minSize bytes, and only for textual content types; images, video and
+// already encoded responses are passed through.
+func Compress(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		c.Header("Vary", "Accept-Encoding")
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: minSize}
+		c.Writer = w
+		// Gin writes the 404 and 405 of unmatched routes once the chain has
+		// returned, which must not go to the finished writer
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks the preferred supported coding from an
+// Accept-Encoding header, or "" when the response should not be compressed
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encodingBrotli && name != encodingGzip && name != "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if name == "*" {
+			name = encodingBrotli
+		}
+
+		// brotli wins ties as it compresses JSON better
+		if q > bestQ || (q == bestQ && name == encodingBrotli) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of a response until it is known whether
+// it is worth compressing
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     bytes.Buffer
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		return w.write(p)
+	}
+
+	w.buf.Write(p)
+	if w.buf.Len() >= w.minSize {
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends buffered data. Flushed responses are streamed, such as NDJSON,
+// and are compressed regardless of the size of their first chunk.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) write(p []byte) (int, error) {
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide starts compressing if the response qualifies and writes out the
+// buffered data
+func (w *compressWriter) decide(streamed bool) error {
+	w.decided = true
+
+	if (streamed || w.buf.Len() >= w.minSize) && w.compressible() {
+		header := w.Header()
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+
+		switch w.encoding {
+		case encodingBrotli:
+			bw := brotliWriters.Get().(*brotli.Writer)
+			bw.Reset(w.ResponseWriter)
+			w.enc = bw
+		default:
+			gw := gzipWriters.Get().(*gzip.Writer)
+			gw.Reset(w.ResponseWriter)
+			w.enc = gw
+		}
+	}
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// compressible reports whether the response can be compressed
+func (w *compressWriter) compressible() bool {
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	case mediaType == "application/javascript", mediaType == "application/xml", mediaType == "image/svg+xml":
+		return true
+	default:
+		return false
+	}
+}
+
+// finish writes out a response that stayed below the size threshold and
+// completes the compressed stream
+func (w *compressWriter) finish() {
+	if !w.decided {
+		if w.buf.Len() == 0 {
+			return
+		}
+		w.decided = true
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+		return
+	}
+
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	switch enc := w.enc.(type) {
+	case *brotli.Writer:
+		enc.Reset(io.Discard)
+		brotliWriters.Put(enc)
+	case *gzip.Writer:
+		enc.Reset(io.Discard)
+		gzipWriters.Put(enc)
+	}
+}
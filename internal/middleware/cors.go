@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// CORSOptions configures cross-origin access to the API
+type CORSOptions struct {
+	// AllowedOrigins are the origins browsers may call the API from; "*"
+	// allows any origin
+	AllowedOrigins []string
+	// AllowCredentials lets browsers send cookies and HTTP authentication
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses
+	MaxAge time.Duration
+	// AllowedHeaders and ExposedHeaders are the request headers clients may
+	// send and the response headers they may read
+	AllowedHeaders []string
+	ExposedHeaders []string
+}
+
+// CORS validates the Origin of cross-origin requests and answers preflight
+// requests with the methods registered on the requested path. Requests from
+// origins that are not allowed are rejected.
+func CORS(engine *gin.Engine, opts CORSOptions) gin.HandlerFunc {
+	anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
+	allowedHeaders := strings.Join(opts.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(opts.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	// Routes are registered after the middleware, so they are indexed on
+	// the first request
+	var routes routeMethods
+	var indexRoutes sync.Once
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || sameOrigin(c.Request, origin) {
+			c.Next()
+			return
+		}
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !anyOrigin && !slices.Contains(opts.AllowedOrigins, origin) {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+				Error:   "Forbidden",
+				Details: "Origin " + origin + " is not allowed",
+			})
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		if anyOrigin && !opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposedHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		indexRoutes.Do(func() { routes = indexRouteMethods(engine.Routes()) })
+		methods := routes.match(c.Request.URL.Path)
+		if len(methods) == 0 {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", strings.Join(append(methods, http.MethodOptions), ", "))
+		header.Set("Access-Control-Allow-Headers", allowedHeaders)
+		header.Set("Access-Control-Max-Age", maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// routeMethods are the registered route patterns split into segments, with
+// the methods of each
+type routeMethods []routePattern
+
+type routePattern struct {
+	segments []string
+	methods  []string
+}
+
+func indexRouteMethods(routes gin.RoutesInfo) routeMethods {
+	var index routeMethods
+	byPath := make(map[string]int)
+	for _, route := range routes {
+		i, ok := byPath[route.Path]
+		if !ok {
+			i = len(index)
+			byPath[route.Path] = i
+			index = append(index, routePattern{segments: strings.Split(strings.Trim(route.Path, "/"), "/")})
+		}
+		if route.Method != http.MethodOptions && !slices.Contains(index[i].methods, route.Method) {
+			index[i].methods = append(index[i].methods, route.Method)
+		}
+	}
+	return index
+}
+
+// match returns the methods of the routes matching a request path
+func (r routeMethods) match(path string) []string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var methods []string
+	for _, route := range r {
+		if route.matches(segments) {
+			for _, method := range route.methods {
+				if !slices.Contains(methods, method) {
+					methods = append(methods, method)
+				}
+			}
+		}
+	}
+	slices.Sort(methods)
+	return methods
+}
+
+func (p routePattern) matches(segments []string) bool {
+	for i, pattern := range p.segments {
+		if strings.HasPrefix(pattern, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !strings.HasPrefix(pattern, ":") && pattern != segments[i] {
+			return false
+		}
+	}
+	return len(segments) == len(p.segments)
+}
+
+// sameOrigin reports whether a request comes from a page of the server
+// itself, such as the report widget's form, which browsers send an Origin
+// with on POST requests too
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		return u.Host == forwarded
+	}
+	return u.Host == r.Host
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecated marks responses of legacy unversioned routes as deprecated and
+// links the equivalent route under successorPrefix. A non-zero sunset is
+// advertised as the date the legacy route will be removed.
+func Deprecated(successorPrefix string, sunset time.Time) gin.HandlerFunc {
+	successorPrefix = strings.TrimRight(successorPrefix, "/")
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successorPrefix, c.Request.URL.Path))
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+
+		c.Next()
+	}
+}
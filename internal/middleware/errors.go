@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+)
+
+// maxErrorBody bounds the part of a 5xx response kept to describe the error
+const maxErrorBody = 4 << 10
+
+// ReportErrors sends panics and 5xx responses to the error tracker, with the
+// method, route, headers and request ID of the failed request. A panic is
+// re-raised after it was captured, so it must run inside gin.Recovery.
+// Error responses are described by their error and details fields.
+func ReportErrors(reporter *services.ErrorReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := &errorBodyWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				stack := make([]uintptr, 64)
+				// Skip runtime.Callers, this function and the runtime's panic frames
+				stack = stack[:runtime.Callers(3, stack)]
+				event := requestErrorEvent(c, http.StatusInternalServerError)
+				event.Type = "panic"
+				event.Message = fmt.Sprint(recovered)
+				event.Fatal = true
+				event.Stack = stack
+				reporter.Capture(event)
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			event := requestErrorEvent(c, status)
+			event.Type = fmt.Sprintf("http_%d", status)
+			event.Message = w.errorMessage()
+			if len(c.Errors) > 0 {
+				event.Message = c.Errors.String()
+			}
+			if event.Message == "" {
+				event.Message = http.StatusText(status)
+			}
+			reporter.Capture(event)
+		}
+	}
+}
+
+// requestErrorEvent describes the request an error occurred in
+func requestErrorEvent(c *gin.Context, status int) services.ErrorEvent {
+	headers := make(map[string]string, len(c.Request.Header))
+	for name := range c.Request.Header {
+		headers[name] = c.Request.Header.Get(name)
+	}
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	return services.ErrorEvent{
+		Method:    c.Request.Method,
+		URL:       c.Request.URL.String(),
+		Route:     route,
+		Status:    status,
+		Headers:   headers,
+		RequestID: logger.RequestID(c.Request.Context()),
+		ClientIP:  c.ClientIP(),
+	}
+}
+
+// errorBodyWriter keeps the start of 5xx response bodies
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *errorBodyWriter) Write(p []byte) (int, error) {
+	w.keep(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *errorBodyWriter) keep(p []byte) {
+	if w.Status() < http.StatusInternalServerError {
+		return
+	}
+	if room := maxErrorBody - w.body.Len(); room > 0 {
+		w.body.Write(p[:min(len(p), room)])
+	}
+}
+
+// errorMessage returns the error and details of a JSON error response
+func (w *errorBodyWriter) errorMessage() string {
+	var resp models.ErrorResponse
+	if err := json.Unmarshal(w.body.Bytes(), &resp); err != nil || resp.Error == "" {
+		return ""
+	}
+	if resp.Details != "" {
+		return resp.Error + ": " + resp.Details
+	}
+	return resp.Error
+}
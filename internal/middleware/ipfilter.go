@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// IPFilter holds the client networks a route group is restricted to
+type IPFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// ParseIPFilter parses allow- and deny-lists of IP addresses and CIDR
+// ranges. It returns nil when both are empty.
+func ParseIPFilter(allow, deny []string) (*IPFilter, error) {
+	filter := &IPFilter{}
+	var err error
+	if filter.allow, err = parseNetworks(allow); err != nil {
+		return nil, err
+	}
+	if filter.deny, err = parseNetworks(deny); err != nil {
+		return nil, err
+	}
+	if len(filter.allow) == 0 && len(filter.deny) == 0 {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		network, err := parseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %q, expected an IP or a CIDR range", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Allows reports whether a client IP may reach the route group: it must not
+// be on the deny-list and, when there is an allow-list, must be on it
+func (f *IPFilter) Allows(ip net.IP) bool {
+	if ip == nil {
+		// Clients of unknown address are refused by any list
+		return false
+	}
+	for _, network := range f.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, network := range f.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RestrictIPs refuses requests from clients the filter does not allow with
+// 403, before they are authenticated. The client IP is the one Gin derives
+// from the trusted proxies' headers when trustProxies is set; otherwise
+// forwarding headers are ignored and the peer address is checked.
+func RestrictIPs(filter *IPFilter, trustProxies bool, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.RemoteIP()
+		if trustProxies {
+			ip = c.ClientIP()
+		}
+		if filter.Allows(net.ParseIP(ip)) {
+			c.Next()
+			return
+		}
+
+		logger.FromContext(c.Request.Context(), log).Warn("Request refused by IP filter",
+			zap.String("client_ip", ip), zap.String("path", c.FullPath()))
+		c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Forbidden",
+			Code:    "ip_forbidden",
+			Details: "Requests from " + ip + " are not allowed",
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestRestrictIPsIgnoresSpoofedForwardingHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	filter, err := ParseIPFilter([]string{"10.0.0.0/8"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		want           int
+	}{
+		{"spoofed header without trusted proxies", nil, "203.0.113.7:4711", "10.1.2.3", http.StatusForbidden},
+		{"peer on the allow-list", nil, "10.1.2.3:4711", "203.0.113.7", http.StatusOK},
+		{"spoofed header from an untrusted peer", []string{"192.168.0.1"}, "203.0.113.7:4711", "10.1.2.3", http.StatusForbidden},
+		{"header from a trusted proxy", []string{"192.168.0.1"}, "192.168.0.1:4711", "10.1.2.3", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			if tt.trustedProxies != nil {
+				if err := r.SetTrustedProxies(tt.trustedProxies); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.Use(RestrictIPs(filter, len(tt.trustedProxies) > 0, zap.NewNop()))
+			r.GET("/admin/stats", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Requests being served that count towards load shedding",
+		},
+	)
+
+	requestsShedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_shed_total",
+			Help: "Total number of requests shed because the server was saturated",
+		},
+		[]string{"priority", "endpoint"},
+	)
+)
+
+// Priority decides which requests are shed first when the server is
+// saturated
+type Priority int
+
+// Request priorities, from the first shed to the last
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	// PriorityExempt requests are never shed nor counted, such as health
+	// checks, which must answer however busy the server is
+	PriorityExempt
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	case PriorityExempt:
+		return "exempt"
+	default:
+		return "normal"
+	}
+}
+
+// loadShedRetryAfter is the Retry-After in seconds of shed requests
+const loadShedRetryAfter = "5"
+
+// LoadShedOptions configure load shedding
+type LoadShedOptions struct {
+	// MaxInFlight is the number of requests served at once beyond which
+	// even high priority requests are shed
+	MaxInFlight int
+	// LowShare and NormalShare are the shares of MaxInFlight beyond which
+	// low and normal priority requests are shed
+	LowShare    float64
+	NormalShare float64
+	// Priorities maps "METHOD /route" to the priority of the route; routes
+	// are given without prefix and default to normal
+	Priorities map[string]Priority
+	// Prefixes are stripped from route patterns before they are looked up
+	// in Priorities, e.g. the API version
+	Prefixes []string
+}
+
+// LoadShed counts the requests in flight and, once the server is saturated,
+// turns away requests with 429 and Retry-After, low priority ones first, so
+// that user-facing writes such as reports keep being served while list
+// reads wait
+func LoadShed(opts LoadShedOptions) gin.HandlerFunc {
+	limits := map[Priority]int64{
+		PriorityLow:    int64(float64(opts.MaxInFlight) * opts.LowShare),
+		PriorityNormal: int64(float64(opts.MaxInFlight) * opts.NormalShare),
+		PriorityHigh:   int64(opts.MaxInFlight),
+	}
+	var inFlight atomic.Int64
+
+	return func(c *gin.Context) {
+		priority := routePriority(c, opts)
+		if priority == PriorityExempt {
+			c.Next()
+			return
+		}
+
+		n := inFlight.Add(1)
+		requestsInFlight.Set(float64(n))
+		defer func() {
+			requestsInFlight.Set(float64(inFlight.Add(-1)))
+		}()
+
+		if n > limits[priority] {
+			route := c.FullPath()
+			if route == "" {
+				route = unmatchedEndpoint
+			}
+			requestsShedTotal.WithLabelValues(priority.String(), route).Inc()
+			c.Header("Retry-After", loadShedRetryAfter)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error:   "Server busy",
+				Code:    "load_shed",
+				Details: "The server is saturated and serves more important requests first, please try again later",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func routePriority(c *gin.Context, opts LoadShedOptions) Priority {
+	route := c.FullPath()
+	if route == "" {
+		return PriorityNormal
+	}
+	for _, prefix := range opts.Prefixes {
+		if trimmed, ok := strings.CutPrefix(route, prefix); ok && strings.HasPrefix(trimmed, "/") {
+			route = trimmed
+			break
+		}
+	}
+	if priority, ok := opts.Priorities[c.Request.Method+" "+route]; ok {
+		return priority
+	}
+	return PriorityNormal
+}
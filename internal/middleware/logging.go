@@ -1,30 +0,0 @@
-package middleware
-
-import (
-	"net/http"
-	"time"
-
-	"github.com/go-chi/chi/middleware"
-	"go.uber.org/zap"
-)
-
-func RequestLogger(log *zap.Logger) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-
-			defer func() {
-				log.Info("request completed",
-					zap.String("method", r.Method),
-					zap.String("path", r.URL.Path),
-					zap.Int("status", ww.Status()),
-					zap.Duration("duration", time.Since(start)),
-					zap.Int64("bytes", ww.BytesWritten()),
-				)
-			}()
-
-			next.ServeHTTP(ww, r)
-		})
-	}
-}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// sizeBuckets span bodies from 100 bytes to 100MB
+var sizeBuckets = prometheus.ExponentialBuckets(100, 10, 7)
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests",
+		},
+		[]string{"method", "endpoint", "status"},
+	)
+
+	httpRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"method", "endpoint", "status"},
+	)
+
+	httpRequestSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_size_bytes",
+			Help:    "Size of HTTP request bodies",
+			Buckets: sizeBuckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	httpResponseSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "Size of HTTP response bodies",
+			Buckets: sizeBuckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+)
+
+// unmatchedEndpoint labels requests that matched no route, so probing
+// arbitrary paths cannot grow the number of series
+const unmatchedEndpoint = "unmatched"
+
+// Metrics records the count, duration and body sizes of requests per route
+// and status. Requests are labeled with their route pattern, such as
+// /api/v1/tickets/:id, never the raw path.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = unmatchedEndpoint
+		}
+		method := c.Request.Method
+		status := strconv.Itoa(c.Writer.Status())
+
+		httpRequestsTotal.WithLabelValues(method, endpoint, status).Inc()
+		httpRequestDuration.WithLabelValues(method, endpoint, status).Observe(time.Since(start).Seconds())
+		if c.Request.ContentLength > 0 {
+			httpRequestSize.WithLabelValues(method, endpoint).Observe(float64(c.Request.ContentLength))
+		}
+		if size := c.Writer.Size(); size > 0 && method != http.MethodHead {
+			httpResponseSize.WithLabelValues(method, endpoint).Observe(float64(size))
+		}
+	}
+}
@@ -8,44 +8,6 @@ import (
 	"go.uber.org/zap"
 )
 
-// Logger creates a middleware for logging HTTP requests
-func Logger(logger *zap.Logger) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-
-			// Create a response writer that captures status
-			rwCapture := &responseWriterCapture{
-				ResponseWriter: w,
-				status:         http.StatusOK,
-			}
-
-			// Call the next handler
-			next.ServeHTTP(rwCapture, r)
-
-			// Log the request details
-			logger.Info("HTTP Request",
-				zap.String("method", r.Method),
-				zap.String("path", r.URL.Path),
-				zap.Int("status", rwCapture.status),
-				zap.Duration("latency", time.Since(start)),
-				zap.String("remote_addr", r.RemoteAddr),
-			)
-		})
-	}
-}
-
-// ResponseWriterCapture is a custom response writer to capture status code
-type responseWriterCapture struct {
-	http.ResponseWriter
-	status int
-}
-
-func (r *responseWriterCapture) WriteHeader(status int) {
-	r.status = status
-	r.ResponseWriter.WriteHeader(status)
-}
-
 // Authentication middleware for basic auth
 func Authentication(username, password string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -63,42 +25,6 @@ func Authentication(username, password string) func(http.Handler) http.Handler {
 	}
 }
 
-// CORS middleware for handling Cross-Origin Resource Sharing
-func CORS(allowedOrigins []string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			origin := r.Header.Get("Origin")
-
-			// Check if origin is allowed
-			allowed := false
-			for _, allowedOrigin := range allowedOrigins {
-				if allowedOrigin == "*" || allowedOrigin == origin {
-					allowed = true
-					break
-				}
-			}
-
-			// Set CORS headers
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-			// Handle preflight requests
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
-			if !allowed {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
 // Timeout middleware to limit request processing time
 func Timeout(duration time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// OpenAPI request validation modes
+const (
+	OpenAPIValidationOff     = "off"
+	OpenAPIValidationLog     = "log"
+	OpenAPIValidationEnforce = "enforce"
+)
+
+// OpenAPIValidator checks requests against an OpenAPI 3 spec. The spec's
+// paths are matched under each of the given path prefixes; requests to
+// undocumented routes pass through. Path, query and header parameters are
+// always checked, request bodies only when they are JSON. In enforce mode
+// invalid requests are rejected with 400, otherwise they are only logged.
+func OpenAPIValidator(spec []byte, prefixes []string, mode string, log *zap.Logger) (gin.HandlerFunc, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI spec: %w", err)
+	}
+
+	doc.Servers = make(openapi3.Servers, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		doc.Servers = append(doc.Servers, &openapi3.Server{URL: prefix})
+	}
+	if err := doc.Validate(openapi3.NewLoader().Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+	enforce := mode == OpenAPIValidationEnforce
+
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if err != nil {
+			if !errors.Is(err, routers.ErrPathNotFound) && !errors.Is(err, routers.ErrMethodNotAllowed) {
+				logger.FromContext(c.Request.Context(), log).Warn("Failed to match request against OpenAPI spec", zap.Error(err), zap.String("path", c.Request.URL.Path))
+			}
+			c.Next()
+			return
+		}
+
+		err = openapi3filter.ValidateRequest(c.Request.Context(), &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody: !validatesBody(c, route),
+				MultiError:         true,
+				// Authentication is enforced by the route middleware
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		})
+		if err == nil {
+			c.Next()
+			return
+		}
+
+		// The body could not be read, so the handler cannot run either
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, models.BodyTooLargeError(tooLarge.Limit))
+			return
+		}
+
+		details := specViolations(err)
+		logger.FromContext(c.Request.Context(), log).Warn("Request does not match the OpenAPI spec",
+			zap.String("method", c.Request.Method),
+			zap.String("route", route.Path),
+			zap.String("violations", details),
+			zap.Bool("rejected", enforce),
+		)
+		if !enforce {
+			c.Next()
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Request does not match the API specification",
+			Code:    "spec_violation",
+			Details: details,
+		})
+	}, nil
+}
+
+// validatesBody reports whether the request body is JSON described by the
+// spec. Other bodies, such as multipart uploads, are left to the handlers so
+// they are not buffered in memory.
+func validatesBody(c *gin.Context, route *routers.Route) bool {
+	body := route.Operation.RequestBody
+	if body == nil || body.Value == nil || body.Value.Content.Get("application/json") == nil {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// specViolations describes each reason a request failed validation, without
+// the schema dumps of the validator's error messages
+func specViolations(err error) string {
+	var reasons []string
+	collectViolations(err, &reasons)
+	return strings.Join(reasons, "; ")
+}
+
+func collectViolations(err error, reasons *[]string) {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, inner := range e {
+			collectViolations(inner, reasons)
+		}
+	case *openapi3filter.RequestError:
+		subject := "request body"
+		if e.Parameter != nil {
+			subject = fmt.Sprintf("%s parameter %s", e.Parameter.In, e.Parameter.Name)
+		}
+		if e.Err == nil {
+			*reasons = append(*reasons, subject+": "+e.Reason)
+			return
+		}
+		var inner []string
+		collectViolations(e.Err, &inner)
+		for _, reason := range inner {
+			*reasons = append(*reasons, subject+": "+reason)
+		}
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			*reasons = append(*reasons, strings.Join(pointer, ".")+": "+e.Reason)
+			return
+		}
+		*reasons = append(*reasons, e.Reason)
+	default:
+		*reasons = append(*reasons, err.Error())
+	}
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var rateLimitedRequestsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rate_limited_requests_total",
+		Help: "Total number of requests rejected by rate limiting",
+	},
+	[]string{"endpoint"},
+)
+
+// RateLimitAllowlist holds the clients rate limits do not apply to
+type RateLimitAllowlist struct {
+	networks []*net.IPNet
+	apiKeys  map[string]bool
+}
+
+// ParseRateLimitAllowlist parses entries that are IP addresses, CIDR ranges
+// or, prefixed with key:, names of API keys
+func ParseRateLimitAllowlist(entries []string) (*RateLimitAllowlist, error) {
+	allow := &RateLimitAllowlist{apiKeys: make(map[string]bool)}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if name, ok := strings.CutPrefix(entry, "key:"); ok {
+			allow.apiKeys[name] = true
+			continue
+		}
+		network, err := parseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow-list entry %q, expected an IP, a CIDR range or key:<name>", entry)
+		}
+		allow.networks = append(allow.networks, network)
+	}
+	return allow, nil
+}
+
+// parseNetwork parses a CIDR range, or an IP address as a range of one
+func parseNetwork(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+			entry += "/32"
+		} else {
+			entry += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(entry)
+	return network, err
+}
+
+// allows reports whether a client is on the allow-list
+func (a *RateLimitAllowlist) allows(ip net.IP, apiKey string) bool {
+	if apiKey != "" && a.apiKeys[apiKey] {
+		return true
+	}
+	for _, network := range a.networks {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimit limits requests per client, identified by the API key the
+// request was authenticated with or else its IP address. The IP is taken
+// from the trusted proxies' headers when trustProxies is set and is the
+// peer address otherwise, so clients cannot pick one to get a fresh bucket
+// or to be allow-listed. Requests over the limit get 429 with Retry-After.
+// When the limiter fails, requests are let through rather than taking the
+// endpoint down with it.
+func RateLimit(limiter services.RateLimiter, allow *RateLimitAllowlist, trustProxies bool, log *zap.Logger) gin.HandlerFunc {
+	limit := strconv.Itoa(limiter.Limit())
+
+	return func(c *gin.Context) {
+		apiKey := c.GetString(APIKeyContextKey)
+		ip := c.RemoteIP()
+		if trustProxies {
+			ip = c.ClientIP()
+		}
+		if allow.allows(net.ParseIP(ip), apiKey) {
+			c.Next()
+			return
+		}
+
+		client := "ip:" + ip
+		if apiKey != "" {
+			client = "key:" + apiKey
+		}
+		result, err := limiter.Allow(c.Request.Context(), client)
+		if err != nil {
+			logger.FromContext(c.Request.Context(), log).Warn("Rate limiter unavailable, allowing request", zap.Error(err))
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", limit)
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		if !result.Allowed {
+			retryAfter := max(int(math.Ceil(result.RetryAfter.Seconds())), 1)
+			rateLimitedRequestsTotal.WithLabelValues(c.FullPath()).Inc()
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error:   "Too many requests",
+				Code:    "rate_limited",
+				Details: fmt.Sprintf("Retry in %d seconds", retryAfter),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
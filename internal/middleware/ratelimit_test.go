@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"go.uber.org/zap"
+)
+
+func TestRateLimitIgnoresSpoofedForwardingHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	allow, err := ParseRateLimitAllowlist([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(RateLimit(services.NewMemoryRateLimiter(1, time.Minute, 1), allow, false, zap.NewNop()))
+	r.POST("/report-issue", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// A client claiming an allow-listed IP, or a new IP on every request,
+	// still shares the bucket of its address
+	for i, forwardedFor := range []string{"10.1.2.3", "198.51.100.1", "198.51.100.2"} {
+		req := httptest.NewRequest(http.MethodPost, "/report-issue", nil)
+		req.RemoteAddr = "203.0.113.7:4711"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-IP", "198.51.100."+strconv.Itoa(10+i))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		want := http.StatusTooManyRequests
+		if i == 0 {
+			want = http.StatusOK
+		}
+		if w.Code != want {
+			t.Errorf("request %d with X-Forwarded-For %s: status = %d, want %d", i+1, forwardedFor, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+)
+
+// RequestIDHeader carries the ID correlating a request with its log lines,
+// ticket and error response
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDContextKey is the gin context key holding the request ID
+const RequestIDContextKey = "middleware.requestID"
+
+// maxRequestIDLength bounds IDs accepted from clients and proxies
+const maxRequestIDLength = 128
+
+// RequestID takes the request ID from the X-Request-ID header, or generates
+// one when it is missing or malformed, and echoes it in the response. The ID
+// is stored in the request context for logging and added to JSON error
+// responses as requestId, so a failure reported by a user can be traced
+// through the logs to the ticket it created.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Set(RequestIDContextKey, id)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+
+		w := &requestIDWriter{ResponseWriter: c.Writer, id: id}
+		c.Writer = w
+		defer w.finish()
+
+		c.Next()
+	}
+}
+
+// validRequestID reports whether a client supplied ID is safe to log and
+// echo: short, and made of letters, digits and -._:
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '.', r == '_', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDWriter holds back uncompressed JSON error bodies to add the
+// request ID to them; other responses are written through
+type requestIDWriter struct {
+	gin.ResponseWriter
+	id string
+
+	decided bool
+	buf     *bytes.Buffer
+}
+
+func (w *requestIDWriter) Write(data []byte) (int, error) {
+	if w.holdBack() {
+		return w.buf.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *requestIDWriter) WriteString(s string) (int, error) {
+	if w.holdBack() {
+		return w.buf.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Size counts a held back body as written, for access logs
+func (w *requestIDWriter) Size() int {
+	if w.buf != nil {
+		return w.buf.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// Written reports a held back body as written
+func (w *requestIDWriter) Written() bool {
+	return w.buf != nil || w.ResponseWriter.Written()
+}
+
+// holdBack decides on the first write whether the body is buffered
+func (w *requestIDWriter) holdBack() bool {
+	if !w.decided {
+		w.decided = true
+		header := w.Header()
+		if w.Status() >= http.StatusBadRequest && header.Get("Content-Encoding") == "" &&
+			strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+			w.buf = new(bytes.Buffer)
+		}
+	}
+	return w.buf != nil
+}
+
+// finish writes a held back body with the request ID as its first field
+func (w *requestIDWriter) finish() {
+	if w.buf == nil {
+		return
+	}
+	body := w.buf.Bytes()
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) < 2 || trimmed[0] != '{' || bytes.Contains(body, []byte(`"requestId"`)) {
+		w.ResponseWriter.Write(body)
+		return
+	}
+
+	field := `"requestId":"` + w.id + `"`
+	rest := bytes.TrimLeft(trimmed[1:], " \t\r\n")
+	if len(rest) > 0 && rest[0] != '}' {
+		field += ","
+	}
+	w.ResponseWriter.Write([]byte("{" + field))
+	w.ResponseWriter.Write(trimmed[1:])
+}
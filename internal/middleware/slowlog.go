@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// SlowRequests logs requests that take longer than threshold, with the time
+// they spent binding the body and in object storage, Jira and MongoDB, and
+// the sizes of their payloads
+func SlowRequests(threshold time.Duration, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx, timings := logger.WithTimings(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		latency := time.Since(start)
+		if latency < threshold {
+			return
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedEndpoint
+		}
+		logger.FromContext(ctx, log).Warn("Slow request",
+			zap.String("method", c.Request.Method),
+			zap.String("route", route),
+			zap.Int("status", c.Writer.Status()),
+			zap.Duration("latency", latency),
+			zap.Duration("threshold", threshold),
+			zap.Int64("request_size", max(c.Request.ContentLength, 0)),
+			zap.Int("response_size", max(c.Writer.Size(), 0)),
+			timings.Field(),
+		)
+	}
+}
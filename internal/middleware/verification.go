@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// VerifyHuman rejects reports without a valid CAPTCHA token or proof of
+// work before the handler does any work. The proof is read from the
+// X-Proof-Of-Work or X-Captcha-Token header, or the captchaToken form field.
+// Requests authenticated with an API key come from integrations and skip it.
+func VerifyHuman(verifier services.HumanVerifier, log *zap.Logger) gin.HandlerFunc {
+	var difficulty string
+	if pow, ok := verifier.(*services.ProofOfWork); ok {
+		difficulty = strconv.Itoa(pow.Difficulty())
+	}
+
+	return func(c *gin.Context) {
+		if c.GetString(APIKeyContextKey) != "" {
+			c.Next()
+			return
+		}
+
+		proof := c.GetHeader("X-Proof-Of-Work")
+		if proof == "" {
+			proof = c.GetHeader("X-Captcha-Token")
+		}
+		if proof == "" {
+			proof = c.PostForm("captchaToken")
+		}
+
+		err := verifier.Verify(c.Request.Context(), proof, c.ClientIP())
+		if err == nil {
+			c.Next()
+			return
+		}
+		if !errors.Is(err, services.ErrVerificationFailed) {
+			logger.FromContext(c.Request.Context(), log).Error("Failed to verify report submitter", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, models.ErrorResponse{
+				Error:   "Verification unavailable",
+				Details: err.Error(),
+			})
+			return
+		}
+
+		if difficulty != "" {
+			c.Header("X-Proof-Of-Work-Difficulty", difficulty)
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{
+			Error:   "Verification failed",
+			Code:    "verification_failed",
+			Details: err.Error(),
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// WebhookTimestampHeader carries the send time of a signed webhook
+const WebhookTimestampHeader = "X-Webhook-Timestamp"
+
+// The signature of a webhook is read from the first of
+// webhookSignatureHeaders present
+var webhookSignatureHeaders = []string{"X-Webhook-Signature", "X-Hub-Signature-256", "X-Hub-Signature"}
+
+// VerifyWebhook rejects webhooks not signed with the verifier's secret, sent
+// outside its tolerance or already handled. The send time is read from the
+// X-Webhook-Timestamp header, in seconds, which is then part of the signed
+// content, or else from the top-level timestamp field of the body, in
+// milliseconds as sent by Jira. Deliveries are recognized by their signed
+// content; replays of a delivery being or already handled are acknowledged
+// without reaching the handler, so senders stop retrying.
+func VerifyWebhook(verifier *services.WebhookVerifier, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Failed to read webhook",
+				Details: err.Error(),
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		signature := firstHeader(c, webhookSignatureHeaders)
+		timestamp := c.GetHeader(WebhookTimestampHeader)
+		if err := verifier.VerifySignature(signature, timestamp, body); err != nil {
+			rejectWebhook(c, log, err)
+			return
+		}
+
+		delivery := verifier.DeliveryKey(timestamp, body)
+		err = verifier.ClaimDelivery(delivery, webhookSentAt(timestamp, body))
+		if errors.Is(err, services.ErrReplayedWebhook) {
+			logger.FromContext(c.Request.Context(), log).Info("Ignoring replayed webhook", zap.String("delivery", delivery))
+			c.AbortWithStatusJSON(http.StatusOK, gin.H{"status": "duplicate"})
+			return
+		}
+		if err != nil {
+			rejectWebhook(c, log, err)
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusMultipleChoices {
+			verifier.ReleaseDelivery(delivery)
+		}
+	}
+}
+
+func rejectWebhook(c *gin.Context, log *zap.Logger, err error) {
+	logger.FromContext(c.Request.Context(), log).Warn("Rejected webhook", zap.Error(err), zap.String("client_ip", c.ClientIP()))
+	c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+		Error:   "Webhook verification failed",
+		Code:    "invalid_signature",
+		Details: err.Error(),
+	})
+}
+
+func firstHeader(c *gin.Context, names []string) string {
+	for _, name := range names {
+		if value := c.GetHeader(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// webhookSentAt returns the send time of a webhook from its timestamp header
+// or body, or the zero time when it has none
+func webhookSentAt(header string, body []byte) time.Time {
+	if header != "" {
+		seconds, err := strconv.ParseInt(header, 10, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		return time.Unix(seconds, 0)
+	}
+
+	var payload struct {
+		Timestamp int64 `json:"timestamp"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Timestamp == 0 {
+		return time.Time{}
+	}
+	if payload.Timestamp > 1e12 {
+		return time.UnixMilli(payload.Timestamp)
+	}
+	return time.Unix(payload.Timestamp, 0)
+}
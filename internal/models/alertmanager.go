@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Statuses of Alertmanager alerts and notifications
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertmanagerWebhook is the body of an Alertmanager webhook notification,
+// version 4, sent for a group of alerts
+type AlertmanagerWebhook struct {
+	Version           string            `json:"version" example:"4"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status" validate:"required,oneof=firing resolved" example:"firing"`
+	Receiver          string            `json:"receiver" example:"ronnin"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL" example:"https://alertmanager.example.com"`
+	Alerts            []Alert           `json:"alerts" validate:"required,dive"`
+}
+
+// Alert is one alert of an Alertmanager notification. The fingerprint
+// identifies the alert across notifications.
+type Alert struct {
+	Status       string            `json:"status" validate:"required,oneof=firing resolved" example:"firing"`
+	Labels       map[string]string `json:"labels" example:"alertname:CheckoutErrors,product:checkout,severity:critical"`
+	Annotations  map[string]string `json:"annotations" example:"summary:Checkout error rate above 5%"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL" example:"https://grafana.example.com/alerting/grafana/abc/view"`
+	Fingerprint  string            `json:"fingerprint" validate:"required" example:"c4a6b2f1d0e9a8b7"`
+}
+
+// AlertResult is what was done with an alert of a notification: "created"
+// a ticket, skipped a "duplicate" of an alert with an open ticket, commented
+// that it is firing "again" or "resolved", or "ignored" it
+type AlertResult struct {
+	Fingerprint string `json:"fingerprint" example:"c4a6b2f1d0e9a8b7"`
+	Result      string `json:"result" example:"created"`
+	TicketID    string `json:"ticketId,omitempty" example:"PROJ-123"`
+}
+
+// AlertmanagerResponse lists what was done with each alert of a
+// notification
+type AlertmanagerResponse struct {
+	Alerts []AlertResult `json:"alerts"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// UsageResponse summarizes report intake per product over a time window
+type UsageResponse struct {
+	Since    time.Time      `json:"since" example:"2024-05-01T00:00:00Z"`
+	Until    time.Time      `json:"until" example:"2024-05-31T00:00:00Z"`
+	Products []ProductUsage `json:"products"`
+}
+
+// ProductUsage is the report volume of a product and what handling it took
+type ProductUsage struct {
+	// Product as reported; reports without one are grouped under ""
+	Product string `json:"product" example:"checkout"`
+	// Reports turned into tickets
+	Reports int64 `json:"reports" example:"412"`
+	// Reports that failed, e.g. because Jira or object storage was down
+	Failures int64 `json:"failures" example:"3"`
+	// Failures out of all reports processed
+	FailureRate float64 `json:"failureRate" example:"0.0072"`
+	// Median time Jira took to create a ticket; omitted when no ticket
+	// recorded it
+	MedianJiraLatencyMs int64 `json:"medianJiraLatencyMs,omitempty" example:"840"`
+	// Attachments stored with the tickets and their sizes
+	Attachments        int64 `json:"attachments" example:"380"`
+	AttachmentBytes    int64 `json:"attachmentBytes" example:"512000000"`
+	AvgAttachmentBytes int64 `json:"avgAttachmentBytes" example:"1347368"`
+	MaxAttachmentBytes int64 `json:"maxAttachmentBytes" example:"48000000"`
+}
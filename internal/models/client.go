@@ -0,0 +1,23 @@
+package models
+
+// ClientEnvironment describes the browser and device a report was sent
+// from, as parsed from the User-Agent, client hints and the X-Client-*
+// headers sent by the SDK
+type ClientEnvironment struct {
+	Browser        string `json:"browser,omitempty" example:"Chrome"`
+	BrowserVersion string `json:"browserVersion,omitempty" example:"124.0.0.0"`
+	OS             string `json:"os,omitempty" example:"Android"`
+	OSVersion      string `json:"osVersion,omitempty" example:"14"`
+	// Device is mobile, tablet, desktop or bot
+	Device    string `json:"device,omitempty" example:"mobile"`
+	Screen    string `json:"screen,omitempty" example:"1080x2400@2.625"`
+	Viewport  string `json:"viewport,omitempty" example:"412x915"`
+	Locale    string `json:"locale,omitempty" example:"en-IN"`
+	Timezone  string `json:"timezone,omitempty" example:"Asia/Kolkata"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// IsZero reports whether nothing is known about the client
+func (e ClientEnvironment) IsZero() bool {
+	return e == ClientEnvironment{}
+}
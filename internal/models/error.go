@@ -1,7 +1,32 @@
 package models
 
+import "fmt"
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string `json:"error" example:"Invalid request body"`
-	Details string `json:"details,omitempty" example:"Field 'url' is required"`
+	Error   string       `json:"error" example:"Invalid request body"`
+	Code    string       `json:"code,omitempty" example:"malware_detected"`
+	Details string       `json:"details,omitempty" example:"Field 'url' is required"`
+	Fields  []FieldError `json:"fields,omitempty"`
+	// ID of the failed request, also found in the X-Request-ID header and
+	// the server logs
+	RequestID string `json:"requestId,omitempty" example:"5f0c6a7e-2b1d-4c8e-9a57-3f6de1b2c4a9"`
+}
+
+// FieldError describes a request field that failed validation
+type FieldError struct {
+	Field   string `json:"field" example:"url"`
+	Rule    string `json:"rule" example:"required"`
+	Param   string `json:"param,omitempty" example:""`
+	Code    string `json:"code" example:"required" enums:"required,out_of_range,invalid_choice,invalid_format,invalid_type,invalid_value"`
+	Message string `json:"message" example:"url is required"`
+}
+
+// BodyTooLargeError is the response to a request body over the size limit
+func BodyTooLargeError(limit int64) ErrorResponse {
+	return ErrorResponse{
+		Error:   "Request too large",
+		Code:    "body_too_large",
+		Details: fmt.Sprintf("Request bodies may be at most %d bytes", limit),
+	}
 }
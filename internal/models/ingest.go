@@ -0,0 +1,80 @@
+package models
+
+// IngestBatch is a batch of reports sent by the browser SDK to /v1/ingest
+type IngestBatch struct {
+	SDK     IngestSDK      `json:"sdk"`
+	Reports []IngestReport `json:"reports" validate:"required,min=1,max=20,dive"`
+}
+
+// IngestSDK names the SDK and its version, shown in tickets
+type IngestSDK struct {
+	Name    string `json:"name" validate:"max=50" example:"ronnin-browser"`
+	Version string `json:"version" validate:"max=50" example:"1.2.0"`
+}
+
+// IngestReport is a report captured by the browser SDK. Timestamps are
+// milliseconds since the Unix epoch.
+type IngestReport struct {
+	// ID is chosen by the SDK to match results to reports
+	ID          string `json:"id" validate:"max=100" example:"r-1"`
+	Issue       string `json:"issue" validate:"required,max=500" example:"Checkout button does nothing"`
+	Description string `json:"description" validate:"required,max=10000" example:"Tapping Pay shows a spinner forever"`
+	UserEmail   string `json:"userEmail" validate:"omitempty,max=200" example:"user@example.com"`
+	LeadID      string `json:"leadId" validate:"max=100"`
+	Product     string `json:"product" validate:"max=100" example:"checkout"`
+	Severity    string `json:"severity" validate:"omitempty,oneof=critical high medium low"`
+	PageURL     string `json:"pageUrl" validate:"max=2000" example:"https://shop.example.com/checkout"`
+	// ImageS3Key and UploadID reference a screenshot uploaded through
+	// /uploads/presign or an upload session beforehand
+	ImageS3Key string `json:"imageS3Key" validate:"max=500"`
+	UploadID   string `json:"uploadId" validate:"max=100"`
+
+	Device      *ClientEnvironment `json:"device"`
+	Console     []ConsoleEntry     `json:"console" validate:"max=100,dive"`
+	Breadcrumbs []Breadcrumb       `json:"breadcrumbs" validate:"max=100,dive"`
+	FailedCalls []IngestCall       `json:"failedCalls" validate:"max=50,dive"`
+}
+
+// ConsoleEntry is a browser console message
+type ConsoleEntry struct {
+	Level     string `json:"level" validate:"oneof=debug log info warn error" example:"error"`
+	Message   string `json:"message" validate:"max=2000" example:"TypeError: Cannot read properties of undefined (reading 'total')"`
+	Timestamp int64  `json:"ts" example:"1736348645123"`
+}
+
+// Breadcrumb is a user action or browser event recorded before the report,
+// e.g. a click, a navigation or a request
+type Breadcrumb struct {
+	Type      string            `json:"type" validate:"max=50" example:"click"`
+	Message   string            `json:"message" validate:"max=1000" example:"button#pay"`
+	Data      map[string]string `json:"data,omitempty" validate:"max=20"`
+	Timestamp int64             `json:"ts" example:"1736348644012"`
+}
+
+// IngestCall is a failed network request
+type IngestCall struct {
+	Method       string `json:"method" validate:"max=10" example:"POST"`
+	URL          string `json:"url" validate:"required,max=2000" example:"https://api.example.com/pay"`
+	Status       int    `json:"status" example:"500"`
+	DurationMS   int64  `json:"durationMs" example:"412"`
+	RequestBody  string `json:"requestBody,omitempty" validate:"max=10000"`
+	ResponseBody string `json:"responseBody,omitempty" validate:"max=10000"`
+	Timestamp    int64  `json:"ts" example:"1736348645001"`
+}
+
+// IngestResponse holds the result of each report of a batch, in order
+type IngestResponse struct {
+	Results []IngestResult `json:"results"`
+}
+
+// IngestResult is what became of a report of a batch. Status is the HTTP
+// status the report would have got on its own: 201 with its ticket, 202 with
+// its queued status, or an error; reports that failed with 5xx may be sent
+// again.
+type IngestResult struct {
+	ID     string          `json:"id,omitempty" example:"r-1"`
+	Status int             `json:"status" example:"201"`
+	Ticket *TicketResponse `json:"ticket,omitempty"`
+	Report *ReportStatus   `json:"report,omitempty"`
+	Error  *ErrorResponse  `json:"error,omitempty"`
+}
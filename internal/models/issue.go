@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// IssueGroup is an issue: the tickets of reports of the same failure,
+// grouped by fingerprint
+type IssueGroup struct {
+	// Fingerprint of the failure: its product and failed endpoints, or its
+	// issue text when it had no failed calls
+	Fingerprint string `json:"fingerprint" example:"3f1c2d9e8a7b6c5d"`
+	// Title is the issue of the latest report
+	Title   string `json:"title" example:"Checkout button does nothing"`
+	Product string `json:"product,omitempty" example:"checkout"`
+	// Endpoints are the failed calls of the latest report, with IDs in
+	// their paths replaced
+	Endpoints []string `json:"endpoints,omitempty" example:"POST /api/orders/{id}/pay"`
+	// Reports counts the tickets and the reports added to them in
+	// high-volume mode
+	Reports int64 `json:"reports" example:"57"`
+	// AffectedUsers counts the distinct emails of the reporters
+	AffectedUsers int64     `json:"affectedUsers" example:"23"`
+	FirstSeen     time.Time `json:"firstSeen" example:"2024-05-01T08:12:00Z"`
+	LastSeen      time.Time `json:"lastSeen" example:"2024-05-03T17:40:00Z"`
+	// Tickets of the issue, most recent first, up to 100
+	Tickets     []IssueTicket `json:"tickets"`
+	TicketCount int64         `json:"ticketCount" example:"4"`
+}
+
+// IssueTicket is a ticket of an issue
+type IssueTicket struct {
+	TicketID  string    `json:"ticketId" bson:"ticket_id" example:"PROJ-123"`
+	JiraLink  string    `json:"jiraLink" bson:"jira_link" example:"https://your-domain.atlassian.net/browse/PROJ-123"`
+	Status    string    `json:"status" bson:"status" example:"In Progress"`
+	CreatedAt time.Time `json:"createdAt" bson:"created_at" example:"2024-05-03T17:40:00Z"`
+}
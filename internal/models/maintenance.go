@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// MaintenanceState is whether report submission is in maintenance mode, e.g.
+// while Jira is migrated
+type MaintenanceState struct {
+	Enabled bool `json:"enabled" bson:"enabled" example:"true"`
+	// Mode is reject, to answer reports with 503 and Message, or queue, to
+	// accept them and hold them in the report queue until maintenance ends
+	Mode    string `json:"mode,omitempty" bson:"mode,omitempty" example:"reject"`
+	Message string `json:"message,omitempty" bson:"message,omitempty" example:"Reporting is paused while we upgrade Jira, please try again after 18:00 UTC."`
+	// Until is when maintenance ends by itself, when set
+	Until     *time.Time `json:"until,omitempty" bson:"until,omitempty" example:"2024-05-03T18:00:00Z"`
+	UpdatedAt time.Time  `json:"updatedAt" bson:"updated_at" example:"2024-05-03T16:00:00Z"`
+}
+
+// MaintenanceRequest represents the request body for turning maintenance
+// mode on or off
+type MaintenanceRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required" example:"true"`
+	Mode    string `json:"mode" validate:"omitempty,oneof=reject queue" example:"reject"`
+	// Message is shown to reporters in reject mode; a default one is used
+	// when it is empty
+	Message string `json:"message" validate:"max=500" example:"Reporting is paused while we upgrade Jira, please try again after 18:00 UTC."`
+	// Until ends maintenance by itself at this time
+	Until *time.Time `json:"until,omitempty" example:"2024-05-03T18:00:00Z"`
+}
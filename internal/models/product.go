@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Product is a product registered through the admin API with its routing:
+// the Jira project its tickets are filed in, the support team they are
+// assigned to, the rules giving its reports a severity and the chats they
+// are announced in. Its settings take precedence over JIRA_PRODUCT_ROUTING,
+// SUPPORT_ROSTER and CLASSIFIER_RULES; its chats are announced in besides
+// the routes of NOTIFICATION_ROUTES.
+type Product struct {
+	// ID is the product as reports name it, in lowercase
+	ID            string                `json:"id" bson:"_id" example:"lending"`
+	ProjectKey    string                `json:"projectKey,omitempty" bson:"project_key,omitempty" example:"LEND"`
+	Team          *ProductTeam          `json:"team,omitempty" bson:"team,omitempty"`
+	SeverityRules []SeverityRule        `json:"severityRules,omitempty" bson:"severity_rules,omitempty"`
+	Notifications []NotificationChannel `json:"notifications,omitempty" bson:"notifications,omitempty"`
+	CreatedAt     time.Time             `json:"createdAt" bson:"created_at"`
+	UpdatedAt     time.Time             `json:"updatedAt" bson:"updated_at"`
+}
+
+// ProductTeam is the support team new tickets of a product are assigned to
+type ProductTeam struct {
+	// Schedule is an on-call schedule as pagerduty:<id> or opsgenie:<id>
+	Schedule string       `json:"schedule,omitempty" bson:"schedule,omitempty" validate:"max=100" example:"pagerduty:PABC123"`
+	Members  []TeamMember `json:"members" bson:"members" validate:"required,min=1,max=50,dive"`
+}
+
+// TeamMember is a member of the support team of a product. Without hours
+// the member is always on shift.
+type TeamMember struct {
+	AccountID string   `json:"accountId" bson:"account_id" validate:"required,max=100" example:"5b10ac8d82e05b22cc7d4ef5"`
+	Email     string   `json:"email,omitempty" bson:"email,omitempty" validate:"omitempty,email" example:"asha@example.com"`
+	GitHub    string   `json:"github,omitempty" bson:"github,omitempty" validate:"max=100" example:"asha"`
+	GitLab    string   `json:"gitlab,omitempty" bson:"gitlab,omitempty" validate:"max=100" example:"asha.k"`
+	Timezone  string   `json:"timezone,omitempty" bson:"timezone,omitempty" validate:"max=100" example:"Asia/Kolkata"`
+	Hours     string   `json:"hours,omitempty" bson:"hours,omitempty" validate:"max=20" example:"09:00-18:00"`
+	Days      []string `json:"days,omitempty" bson:"days,omitempty" validate:"max=7" example:"mon-fri"`
+}
+
+// SeverityRule gives its severity, and its category when it has one, to
+// reports of a product whose issue or description contains one of its
+// keywords as words, or with a failed network call answered with one of its
+// statuses (codes like 401, classes like 5xx, or 0 for calls without answer)
+type SeverityRule struct {
+	Severity string   `json:"severity" bson:"severity" validate:"required,oneof=critical high medium low" example:"critical"`
+	Category string   `json:"category,omitempty" bson:"category,omitempty" validate:"omitempty,oneof=ui-bug api-failure auth performance" example:"api-failure"`
+	Keywords []string `json:"keywords,omitempty" bson:"keywords,omitempty" validate:"required_without=Statuses,max=50,dive,min=1,max=100" example:"emi"`
+	Statuses []string `json:"statuses,omitempty" bson:"statuses,omitempty" validate:"max=20" example:"5xx"`
+}
+
+// ProductRequest represents the request body for changing a product
+type ProductRequest struct {
+	// ProjectKey is the project of one of the configured issue trackers
+	ProjectKey    string                `json:"projectKey,omitempty" validate:"max=20" example:"LEND"`
+	Team          *ProductTeam          `json:"team,omitempty"`
+	SeverityRules []SeverityRule        `json:"severityRules,omitempty" validate:"max=50,dive"`
+	Notifications []NotificationChannel `json:"notifications,omitempty" validate:"max=10,dive"`
+}
+
+// CreateProductRequest represents the request body for registering a
+// product
+type CreateProductRequest struct {
+	// ID is the product as reports name it; it is matched
+	// case-insensitively
+	ID string `json:"id" binding:"required" validate:"max=100" example:"lending"`
+	ProductRequest
+}
@@ -1,21 +1,50 @@
 package models
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"strings"
 )
 
-// ReportIssueRequest represents the form data for reporting an issue
+// ReportIssueRequest represents the form data or JSON body for reporting an issue
 type ReportIssueRequest struct {
-	Issue              string `form:"issue" binding:"required"`
-	Description        string `form:"description" binding:"required"`
-	UserEmail          string `form:"userEmail"`
-	LeadID             string `form:"leadId"`
-	Product            string `form:"product"`
-	FailedNetworkCalls string `form:"failedNetworkCalls"`
-	PageURL            string `form:"pageUrl"`
-	ImageS3URL         string `form:"imageS3URL"`
+	Issue              string `form:"issue" json:"issue" binding:"required"`
+	Description        string `form:"description" json:"description" binding:"required"`
+	UserEmail          string `form:"userEmail" json:"userEmail"`
+	LeadID             string `form:"leadId" json:"leadId"`
+	Product            string `form:"product" json:"product"`
+	Severity           string `form:"severity" json:"severity" validate:"omitempty,oneof=critical high medium low"`
+	FailedNetworkCalls string `form:"failedNetworkCalls" json:"failedNetworkCalls"`
+	PageURL            string `form:"pageUrl" json:"pageUrl"`
+	ImageS3URL         string `form:"imageS3URL" json:"imageS3URL"`
+	ImageS3Key         string `form:"imageS3Key" json:"imageS3Key"`
+	UploadID           string `form:"uploadId" json:"uploadId"`
+}
+
+// UnmarshalJSON accepts failedNetworkCalls either as a JSON string, as sent
+// in multipart forms, or as a JSON array, which is kept as its raw text
+func (r *ReportIssueRequest) UnmarshalJSON(data []byte) error {
+	type plain ReportIssueRequest
+	aux := struct {
+		*plain
+		FailedNetworkCalls json.RawMessage `json:"failedNetworkCalls"`
+	}{plain: (*plain)(r)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	raw := bytes.TrimSpace(aux.FailedNetworkCalls)
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+		r.FailedNetworkCalls = ""
+	case raw[0] == '"':
+		return json.Unmarshal(raw, &r.FailedNetworkCalls)
+	default:
+		r.FailedNetworkCalls = string(raw)
+	}
+	return nil
 }
 
 // GetNetworkCalls parses the FailedNetworkCalls string into []NetworkCall
@@ -62,10 +91,6 @@ func (r *ReportIssueRequest) GetNetworkCalls() ([]NetworkCall, error) {
 		}
 	}
 
-	// As a fallback for debugging, log the input pattern
-	fmt.Printf("Failed to parse network calls. Input sample (first 100 chars): %s\n",
-		input[:min(len(input), 100)])
-
 	// If all parsing attempts fail, return an empty array instead of failing
 	// We'll handle the raw string separately in the handler
 	return calls, fmt.Errorf("could not parse network calls after multiple attempts")
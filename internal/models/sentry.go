@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SentryEvent is the subset of a Sentry SDK event used to file a ticket.
+// Fields the SDKs send in more than one shape are kept raw and read through
+// the accessor methods.
+type SentryEvent struct {
+	EventID     string          `json:"event_id"`
+	Level       string          `json:"level"`
+	Platform    string          `json:"platform"`
+	Environment string          `json:"environment"`
+	Release     string          `json:"release"`
+	ServerName  string          `json:"server_name"`
+	Message     json.RawMessage `json:"message"`
+	LogEntry    *struct {
+		Message   string `json:"message"`
+		Formatted string `json:"formatted"`
+	} `json:"logentry"`
+	Exception *struct {
+		Values []SentryException `json:"values"`
+	} `json:"exception"`
+	Breadcrumbs json.RawMessage `json:"breadcrumbs"`
+	User        *struct {
+		ID        string `json:"id"`
+		Email     string `json:"email"`
+		Username  string `json:"username"`
+		IPAddress string `json:"ip_address"`
+	} `json:"user"`
+	Request *struct {
+		URL     string          `json:"url"`
+		Method  string          `json:"method"`
+		Headers json.RawMessage `json:"headers"`
+	} `json:"request"`
+	Tags json.RawMessage `json:"tags"`
+}
+
+// SentryException is one exception of a Sentry event's exception chain
+type SentryException struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Module     string `json:"module"`
+	Stacktrace *struct {
+		Frames []SentryFrame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// SentryFrame is a stack frame, ordered oldest call first as sent by the SDKs
+type SentryFrame struct {
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Function string `json:"function"`
+	Module   string `json:"module"`
+	Lineno   int    `json:"lineno"`
+	Colno    int    `json:"colno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// SentryBreadcrumb is an event recorded by the SDK before the error
+type SentryBreadcrumb struct {
+	Timestamp json.RawMessage        `json:"timestamp,omitempty"`
+	Type      string                 `json:"type,omitempty"`
+	Category  string                 `json:"category,omitempty"`
+	Level     string                 `json:"level,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// MessageText returns the event message, sent either as a string or as a
+// log entry object
+func (e *SentryEvent) MessageText() string {
+	if e.LogEntry != nil {
+		if e.LogEntry.Formatted != "" {
+			return e.LogEntry.Formatted
+		}
+		if e.LogEntry.Message != "" {
+			return e.LogEntry.Message
+		}
+	}
+
+	var text string
+	if json.Unmarshal(e.Message, &text) == nil {
+		return text
+	}
+	var entry struct {
+		Message   string `json:"message"`
+		Formatted string `json:"formatted"`
+	}
+	if json.Unmarshal(e.Message, &entry) == nil {
+		if entry.Formatted != "" {
+			return entry.Formatted
+		}
+		return entry.Message
+	}
+	return ""
+}
+
+// PrimaryException returns the exception that was raised last, which the
+// SDKs send at the end of the chain
+func (e *SentryEvent) PrimaryException() *SentryException {
+	if e.Exception == nil || len(e.Exception.Values) == 0 {
+		return nil
+	}
+	return &e.Exception.Values[len(e.Exception.Values)-1]
+}
+
+// BreadcrumbList returns the breadcrumbs, sent either as a list or wrapped
+// in a values object
+func (e *SentryEvent) BreadcrumbList() []SentryBreadcrumb {
+	var crumbs []SentryBreadcrumb
+	if json.Unmarshal(e.Breadcrumbs, &crumbs) == nil {
+		return crumbs
+	}
+	var wrapped struct {
+		Values []SentryBreadcrumb `json:"values"`
+	}
+	if json.Unmarshal(e.Breadcrumbs, &wrapped) == nil {
+		return wrapped.Values
+	}
+	return nil
+}
+
+// TagMap returns the event tags, sent either as an object or as a list of
+// key/value pairs
+func (e *SentryEvent) TagMap() map[string]string {
+	return stringPairs(e.Tags)
+}
+
+// RequestHeaders returns the headers of the request the event occurred in
+func (e *SentryEvent) RequestHeaders() map[string]string {
+	if e.Request == nil {
+		return nil
+	}
+	return stringPairs(e.Request.Headers)
+}
+
+// stringPairs decodes an object or a list of [key, value] pairs
+func stringPairs(raw json.RawMessage) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var obj map[string]interface{}
+	if json.Unmarshal(raw, &obj) == nil {
+		out := make(map[string]string, len(obj))
+		for k, v := range obj {
+			out[k] = fmt.Sprint(v)
+		}
+		return out
+	}
+
+	var pairs [][]interface{}
+	if json.Unmarshal(raw, &pairs) == nil {
+		out := make(map[string]string, len(pairs))
+		for _, pair := range pairs {
+			if len(pair) == 2 {
+				out[fmt.Sprint(pair[0])] = fmt.Sprint(pair[1])
+			}
+		}
+		return out
+	}
+
+	return nil
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // TicketRequest represents the request body for creating a ticket
 type TicketRequest struct {
 	URL            string                 `json:"url" binding:"required" example:"https://example.com/api/endpoint"`
@@ -7,6 +9,71 @@ type TicketRequest struct {
 	Response       map[string]interface{} `json:"response" binding:"required"`
 	RequestHeaders map[string]string      `json:"requestHeaders" binding:"required"`
 	ImageS3URL     string                 `json:"imageS3URL" example:"https://bucket.s3.amazonaws.com/screenshot.png"`
+	ImageS3Key     string                 `json:"imageS3Key,omitempty" example:"uploads/ronnin/3f1c2d9e.png"`
+
+	// ImageURLExpiresAt is set server-side when the screenshot is uploaded
+	ImageURLExpiresAt time.Time `json:"-"`
+
+	// QuarantineKey is set server-side when the screenshot was quarantined by
+	// the malware scanner; ImageS3Key then holds the key it is released to
+	QuarantineKey string `json:"-"`
+
+	// ImageContentType and Video are set server-side for screen recordings,
+	// which are linked rather than embedded in the Jira description
+	ImageContentType string         `json:"-"`
+	Video            *VideoMetadata `json:"-"`
+
+	// Runbooks are set server-side to the triage pages of the product and
+	// failed endpoints of the ticket
+	Runbooks []RunbookLink `json:"-"`
+
+	// Deploys are set server-side to the recent deploys of the product of
+	// the ticket
+	Deploys []Deploy `json:"-"`
+
+	// Summary is set server-side to the generated title and summary of the
+	// report when summaries are enabled
+	Summary *ReportSummary `json:"-"`
+
+	// Classification is set server-side to the category and severity of
+	// the report when classification is enabled
+	Classification *Classification `json:"-"`
+
+	// Title is set server-side to the title rendered from
+	// TICKET_TITLE_TEMPLATE when one is configured
+	Title string `json:"-"`
+}
+
+// Classification is the category and severity assigned to a report, and
+// what assigned them: rules, model or default
+type Classification struct {
+	Category     string `json:"category"`
+	Severity     string `json:"severity"`
+	ClassifiedBy string `json:"classifiedBy"`
+}
+
+// ReportSummary is a generated title and three-bullet summary of a report
+type ReportSummary struct {
+	Title   string   `json:"title"`
+	Bullets []string `json:"bullets"`
+}
+
+// RunbookLink is a triage page linked in a ticket description
+type RunbookLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Deploy is a release of a service, listed in ticket descriptions
+type Deploy struct {
+	Service     string    `json:"service"`
+	Version     string    `json:"version"`
+	Environment string    `json:"environment"`
+	Commit      string    `json:"commit"`
+	Author      string    `json:"author"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	DeployedAt  time.Time `json:"deployedAt"`
 }
 
 // TicketResponse represents the response after creating a ticket
@@ -15,6 +82,116 @@ type TicketResponse struct {
 	Status     string `json:"status" example:"created"`
 	AssignedTo string `json:"assignedTo" example:"john.doe@company.com"`
 	JiraLink   string `json:"jiraLink" example:"https://your-jira.atlassian.net/browse/PROJECT-123"`
+
+	// StatusURL is the reporter status page, set for reports when status
+	// tokens are enabled
+	StatusURL string `json:"statusUrl,omitempty" example:"https://ronnin.example.com/api/v1/my-reports/eyJ0Ijo..."`
+
+	// SimilarTickets are recent open tickets resembling the new one, most
+	// similar first, set when similar ticket suggestions are enabled
+	SimilarTickets []SimilarTicket `json:"similarTickets,omitempty"`
+}
+
+// SimilarTicket is a recent open ticket whose report resembles a new one
+type SimilarTicket struct {
+	TicketID  string    `json:"ticketId" example:"PROJECT-118"`
+	Issue     string    `json:"issue" example:"Checkout button does nothing"`
+	Status    string    `json:"status" example:"In Progress"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Score is the text similarity of the reports, from 0 to 1
+	Score float64 `json:"score" example:"0.72"`
+}
+
+// ReportStatus represents the processing state of an asynchronously submitted report
+type ReportStatus struct {
+	ID        string    `json:"reportId" example:"5f0c8a1e-8d3b-4c55-9a57-2f1d1c0e7b42"`
+	Status    string    `json:"status" example:"completed" enums:"queued,processing,completed,failed"`
+	TicketID  string    `json:"ticketId,omitempty" example:"PROJECT-123"`
+	JiraLink  string    `json:"jiraLink,omitempty" example:"https://your-jira.atlassian.net/browse/PROJECT-123"`
+	StatusURL string    `json:"statusUrl,omitempty" example:"https://ronnin.example.com/api/v1/my-reports/eyJ0Ijo..."`
+	Error     string    `json:"error,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// SimilarTickets are those of the ticket's response once it is created
+	SimilarTickets []SimilarTicket `json:"similarTickets,omitempty"`
+}
+
+// ReportQueueStats represents the number of asynchronously submitted reports in each state
+type ReportQueueStats struct {
+	Queued     int `json:"queued" example:"3"`
+	Processing int `json:"processing" example:"4"`
+	Completed  int `json:"completed" example:"120"`
+	Failed     int `json:"failed" example:"1"`
+	Capacity   int `json:"capacity" example:"100"`
+	// Paused is set while reports are held in maintenance mode
+	Paused bool `json:"paused,omitempty" example:"false"`
+}
+
+// AdminStatusResponse represents the backlog of background work
+type AdminStatusResponse struct {
+	ReportQueue            *ReportQueueStats `json:"reportQueue,omitempty"`
+	QuarantinedAttachments int64             `json:"quarantinedAttachments" example:"2"`
+	ExpiringURLs           int64             `json:"expiringUrls" example:"15"`
+	// Instance and Leader identify this instance and the one running
+	// scheduled jobs when leader election is enabled
+	Instance string `json:"instance,omitempty" example:"api-7d9f-3b1c2a4e"`
+	Leader   string `json:"leader,omitempty" example:"api-5c2e-9f0d1b7a"`
+	// Maintenance is set while report submission is in maintenance mode
+	Maintenance *MaintenanceState `json:"maintenance,omitempty"`
+}
+
+// ReassignTicketRequest represents the request body for reassigning a ticket
+type ReassignTicketRequest struct {
+	Assignee string `json:"assignee" binding:"required" example:"5b10a2844c20165700ede21g"`
+	Reason   string `json:"reason" validate:"max=500" example:"Owns the payments integration"`
+}
+
+// CommentRequest represents the request body for commenting on a ticket
+type CommentRequest struct {
+	Body string `json:"body" binding:"required" validate:"max=10000" example:"Reproduced on Android 14; a fix is in review"`
+}
+
+// HelpdeskWebhookRequest represents a change to a helpdesk ticket, as sent
+// by a Zendesk or Freshdesk webhook
+type HelpdeskWebhookRequest struct {
+	TicketID string `json:"ticketId" binding:"required" validate:"max=100" example:"4812"`
+	Status   string `json:"status" validate:"max=50" example:"Open"`
+	Comment  string `json:"comment" validate:"max=10000" example:"It still happens after updating the app"`
+	Author   string `json:"author" validate:"max=200" example:"Priya Raman"`
+}
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required" validate:"max=100" example:"mobile-app"`
+	Scopes []string `json:"scopes" binding:"required" validate:"min=1,dive,oneof=report read write admin" example:"report"`
+	// Products limits the key to the tickets of these products
+	Products []string `json:"products,omitempty" validate:"dive,required,max=100" example:"checkout"`
+	// Tenant limits the key to the tickets of a tenant, which its reports
+	// are filed for
+	Tenant string `json:"tenant,omitempty" validate:"max=40" example:"lending"`
+}
+
+// RetryResponse represents the result of retrying failed reports
+type RetryResponse struct {
+	Retried int `json:"retried" example:"3"`
+}
+
+// ReporterTicket is the status of a submission as shown to its reporter
+type ReporterTicket struct {
+	TicketID   string     `json:"ticketId" example:"PROJECT-123"`
+	Issue      string     `json:"issue" example:"Checkout button does nothing"`
+	Product    string     `json:"product,omitempty" example:"checkout"`
+	Status     string     `json:"status" example:"In Progress"`
+	Resolution string     `json:"resolution,omitempty" example:"Fixed"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
+
+// MyReportsResponse lists the submissions a status page token grants access to
+type MyReportsResponse struct {
+	Reports []ReporterTicket `json:"reports"`
 }
 
 // HealthResponse represents the health check response
@@ -23,3 +200,21 @@ type HealthResponse struct {
 	Services  map[string]string `json:"services"`
 	Timestamp int64             `json:"timestamp" example:"1647123456"`
 }
+
+// ImageURLResponse represents a freshly presigned screenshot URL for a ticket
+type ImageURLResponse struct {
+	TicketID  string    `json:"ticketId" example:"PROJECT-123"`
+	ImageURL  string    `json:"imageUrl" example:"https://bucket.s3.amazonaws.com/uploads/ronnin/3f1c2d9e.png?X-Amz-Signature=..."`
+	ExpiresAt time.Time `json:"expiresAt" example:"2025-01-08T15:04:05Z"`
+}
+
+// ListResponse is a page of a list endpoint; Data holds the items. Page is
+// set when pages are selected by number; NextCursor is set while more items
+// follow.
+type ListResponse struct {
+	Data       interface{} `json:"data"`
+	Page       int         `json:"page,omitempty" example:"1"`
+	PageSize   int         `json:"pageSize" example:"50"`
+	Total      int64       `json:"total" example:"120"`
+	NextCursor string      `json:"nextCursor,omitempty" example:"NjZhMWYwYzJlNGIwYTFiMmMzZDRlNWY2"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// PresignUploadRequest represents a request for a direct-to-storage upload URL
+type PresignUploadRequest struct {
+	Filename    string `json:"filename" binding:"required" example:"recording.webm"`
+	ContentType string `json:"contentType" binding:"required" example:"video/webm"`
+	Product     string `json:"product,omitempty" example:"lending"`
+	Size        int64  `json:"size,omitempty" validate:"min=0" example:"52428800"`
+
+	// ChecksumSHA256 is the hex-encoded SHA-256 of the file. When set, content
+	// that is already stored is not uploaded again, and S3 rejects uploads
+	// that do not match it.
+	ChecksumSHA256 string `json:"checksumSha256,omitempty" validate:"omitempty,len=64,hexadecimal" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+}
+
+// PresignUploadResponse contains the URL the client must upload the file to,
+// and the object key to reference in the subsequent report submission. When
+// Duplicate is set the content is already stored under ObjectKey and no
+// upload is needed.
+type PresignUploadResponse struct {
+	UploadURL string            `json:"uploadUrl,omitempty" example:"https://bucket.s3.amazonaws.com/uploads/ronnin/3f1c2d9e.webm?X-Amz-Signature=..."`
+	Method    string            `json:"method,omitempty" example:"PUT"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	ObjectKey string            `json:"objectKey" example:"uploads/ronnin/3f1c2d9e.webm"`
+	ExpiresAt time.Time         `json:"expiresAt" example:"2025-01-01T15:04:05Z"`
+	Duplicate bool              `json:"duplicate,omitempty" example:"false"`
+}
+
+// AttachmentResponse describes a file attached to a ticket. URL is a freshly
+// signed download URL and is omitted for files pending malware review.
+type AttachmentResponse struct {
+	ID             string     `json:"id" example:"65f1c2d9e4b0a1b2c3d4e5f6"`
+	ObjectKey      string     `json:"objectKey" example:"uploads/ronnin/3f1c2d9e.png"`
+	Filename       string     `json:"filename,omitempty" example:"screenshot.png"`
+	Size           int64      `json:"size" example:"204800"`
+	ContentType    string     `json:"contentType,omitempty" example:"image/png"`
+	ChecksumSHA256 string     `json:"checksumSha256,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	Uploader       string     `json:"uploader,omitempty" example:"user@example.com"`
+	Status         string     `json:"status,omitempty" example:"quarantined"`
+	CreatedAt      time.Time  `json:"createdAt" example:"2025-01-01T15:04:05Z"`
+	URL            string     `json:"url,omitempty" example:"https://bucket.s3.amazonaws.com/uploads/ronnin/3f1c2d9e.png?X-Amz-Signature=..."`
+	URLExpiresAt   *time.Time `json:"urlExpiresAt,omitempty" example:"2025-01-08T15:04:05Z"`
+}
+
+// VideoMetadata describes a screen recording attached to a report
+type VideoMetadata struct {
+	Container       string  `json:"container" bson:"container" example:"webm"`
+	Codec           string  `json:"codec,omitempty" bson:"codec,omitempty" example:"V_VP9"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty" bson:"duration_seconds,omitempty" example:"42.5"`
+}
+
+// CreateUploadSessionRequest starts a resumable upload
+type CreateUploadSessionRequest struct {
+	Filename    string `json:"filename" binding:"required" example:"recording.webm"`
+	ContentType string `json:"contentType" binding:"required" example:"video/webm"`
+	Product     string `json:"product,omitempty" example:"lending"`
+	Size        int64  `json:"size" binding:"required" validate:"min=1" example:"52428800"`
+
+	// ChecksumSHA256 is the hex-encoded SHA-256 of the whole file. When set,
+	// the assembled upload is verified against it before it is stored.
+	ChecksumSHA256 string `json:"checksumSha256,omitempty" validate:"omitempty,len=64,hexadecimal" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+}
+
+// UploadSessionResponse describes the state of a resumable upload. Chunks are
+// sent with PATCH starting at Offset; once Offset equals Size the session is
+// completed and ID is referenced as uploadId in the report submission.
+type UploadSessionResponse struct {
+	ID        string    `json:"id" example:"8b0f6a52-3c1e-4f0a-9d4b-2f6f1d7c9e11"`
+	Status    string    `json:"status" example:"pending"`
+	Size      int64     `json:"size" example:"52428800"`
+	Offset    int64     `json:"offset" example:"8388608"`
+	ObjectKey string    `json:"objectKey,omitempty" example:"uploads/ronnin/3f1c2d9e.webm"`
+	ExpiresAt time.Time `json:"expiresAt" example:"2025-01-02T15:04:05Z"`
+	Duplicate bool      `json:"duplicate,omitempty" example:"false"`
+}
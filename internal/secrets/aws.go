@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// awsProvider reads a secret from AWS Secrets Manager, authenticating with
+// the default AWS credential chain
+type awsProvider struct {
+	client   *secretsmanager.Client
+	secretID string
+}
+
+func newAWSProvider(ctx context.Context, opts Options) (*awsProvider, error) {
+	var loadOpts []func(*config.LoadOptions) error
+	if opts.AWSRegion != "" {
+		loadOpts = append(loadOpts, config.WithRegion(opts.AWSRegion))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &awsProvider{
+		client:   secretsmanager.NewFromConfig(cfg),
+		secretID: opts.Name,
+	}, nil
+}
+
+// Fetch reads the current version of the secret
+func (p *awsProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(p.secretID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s from AWS Secrets Manager: %w", p.secretID, err)
+	}
+
+	if out.SecretString != nil {
+		return parseSecret([]byte(*out.SecretString))
+	}
+	return parseSecret(out.SecretBinary)
+}
@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// gcpMetadataTokenURL issues access tokens for the service account of the
+// GCE instance, GKE workload or Cloud Run service
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcpProvider reads the latest version of a secret from GCP Secret Manager
+// through its REST API, authenticating as the attached service account
+type gcpProvider struct {
+	client *http.Client
+	url    string
+}
+
+func newGCPProvider(opts Options) (*gcpProvider, error) {
+	if opts.GCPProject == "" {
+		return nil, fmt.Errorf("GCP_PROJECT is required for the gcp secrets provider")
+	}
+
+	return &gcpProvider{
+		client: &http.Client{Timeout: 30 * time.Second},
+		url:    fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s/versions/latest:access", opts.GCPProject, opts.Name),
+	}, nil
+}
+
+// Fetch reads the latest version of the secret
+func (p *gcpProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := p.getJSON(ctx, p.url, map[string]string{"Authorization": "Bearer " + token}, &secret); err != nil {
+		return nil, fmt.Errorf("failed to access secret in GCP Secret Manager: %w", err)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(secret.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GCP secret payload: %w", err)
+	}
+	return parseSecret(value)
+}
+
+// accessToken gets an access token from the metadata server
+func (p *gcpProvider) accessToken(ctx context.Context) (string, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := p.getJSON(ctx, gcpMetadataTokenURL, map[string]string{"Metadata-Flavor": "Google"}, &token); err != nil {
+		return "", fmt.Errorf("failed to get GCP access token from the metadata server: %w", err)
+	}
+	return token.AccessToken, nil
+}
+
+func (p *gcpProvider) getJSON(ctx context.Context, url string, headers map[string]string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
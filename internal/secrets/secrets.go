@@ -0,0 +1,85 @@
+// Package secrets loads credentials from a secrets manager instead of
+// plaintext environment variables.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Secrets manager backends, selected by SECRETS_PROVIDER
+const (
+	ProviderNone  = "none"
+	ProviderAWS   = "aws"
+	ProviderVault = "vault"
+	ProviderGCP   = "gcp"
+)
+
+// Provider fetches a secret holding credentials as a JSON object of
+// configuration keys to values, e.g. {"JIRA_API_TOKEN": "..."}
+type Provider interface {
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// Options configures the secrets manager backends
+type Options struct {
+	// Name of the secret: the secret ID in AWS, the KV path in Vault and
+	// the secret ID in GCP
+	Name string
+
+	// AWS region; the default AWS configuration is used when empty
+	AWSRegion string
+
+	// Vault server address, token and KV version 2 mount
+	VaultAddress string
+	VaultToken   string
+	VaultMount   string
+
+	// GCP project of the secret
+	GCPProject string
+}
+
+// New creates the provider of the given backend
+func New(ctx context.Context, backend string, opts Options) (Provider, error) {
+	if opts.Name == "" {
+		return nil, fmt.Errorf("a secret name is required for the %s secrets provider", backend)
+	}
+
+	switch backend {
+	case ProviderAWS:
+		return newAWSProvider(ctx, opts)
+	case ProviderVault:
+		return newVaultProvider(opts)
+	case ProviderGCP:
+		return newGCPProvider(opts)
+	default:
+		return nil, fmt.Errorf("unknown secrets provider %q", backend)
+	}
+}
+
+// Refresh fetches the secret every interval until ctx is done, passing the
+// result to fn
+func Refresh(ctx context.Context, p Provider, interval time.Duration, fn func(map[string]string, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(p.Fetch(ctx))
+		}
+	}
+}
+
+// parseSecret decodes a secret value holding a JSON object of strings
+func parseSecret(value []byte) (map[string]string, error) {
+	var values map[string]string
+	if err := json.Unmarshal(value, &values); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object of strings: %w", err)
+	}
+	return values, nil
+}
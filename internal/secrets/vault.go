@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// vaultProvider reads a secret from a HashiCorp Vault KV version 2 engine
+type vaultProvider struct {
+	client *http.Client
+	url    string
+	token  string
+}
+
+func newVaultProvider(opts Options) (*vaultProvider, error) {
+	if opts.VaultAddress == "" || opts.VaultToken == "" {
+		return nil, fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required for the vault secrets provider")
+	}
+	if _, err := url.Parse(opts.VaultAddress); err != nil {
+		return nil, fmt.Errorf("invalid Vault address: %w", err)
+	}
+
+	mount := opts.VaultMount
+	if mount == "" {
+		mount = "secret"
+	}
+
+	return &vaultProvider{
+		client: &http.Client{Timeout: 30 * time.Second},
+		url:    fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(opts.VaultAddress, "/"), strings.Trim(mount, "/"), strings.Trim(opts.Name, "/")),
+		token:  opts.VaultToken,
+	}, nil
+}
+
+// Fetch reads the latest version of the secret
+func (p *vaultProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret from Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to read secret from Vault: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	return parseSecret(secret.Data.Data)
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// alertsCollection maps Alertmanager alert fingerprints to their tickets
+const alertsCollection = "alerts"
+
+// alertCommentAuthor is the author of comments on alert tickets
+const alertCommentAuthor = "Alertmanager"
+
+// Results of an alert of an Alertmanager notification
+const (
+	AlertCreated   = "created"
+	AlertDuplicate = "duplicate"
+	AlertAgain     = "again"
+	AlertResolved  = "resolved"
+	AlertIgnored   = "ignored"
+)
+
+// AlertRecord is the ticket of an Alertmanager alert, by fingerprint
+type AlertRecord struct {
+	Fingerprint string    `bson:"_id"`
+	TicketID    string    `bson:"ticket_id"`
+	AlertName   string    `bson:"alert_name"`
+	Status      string    `bson:"status"`
+	StartsAt    time.Time `bson:"starts_at"`
+	ResolvedAt  time.Time `bson:"resolved_at,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+// AlertIntake files firing Alertmanager alerts as tickets. An alert that
+// fires again while its ticket is open is not filed twice: its ticket gets
+// a comment when the alert resolves, and another when it fires again.
+// Notifications are handled one at a time so repeated deliveries of an
+// alert cannot race each other.
+type AlertIntake struct {
+	tickets      *JiraRegistry
+	mongoService *MongoDBService
+	logger       *zap.Logger
+
+	mu sync.Mutex
+}
+
+// NewAlertIntake creates the intake of Alertmanager alerts, which are
+// deduplicated through mongoService
+func NewAlertIntake(tickets *JiraRegistry, mongoService *MongoDBService, log *zap.Logger) *AlertIntake {
+	return &AlertIntake{
+		tickets:      tickets,
+		mongoService: mongoService,
+		logger:       log,
+	}
+}
+
+// Notify handles the alerts of a notification, returning what was done with
+// each. It carries on past alerts that fail, returning the first error so
+// that Alertmanager sends the notification again; alerts handled before are
+// then recognized.
+func (a *AlertIntake) Notify(ctx context.Context, webhook *models.AlertmanagerWebhook) ([]models.AlertResult, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	log := logger.FromContext(ctx, a.logger)
+	results := make([]models.AlertResult, 0, len(webhook.Alerts))
+	var firstErr error
+	for i := range webhook.Alerts {
+		alert := &webhook.Alerts[i]
+		result, err := a.handle(ctx, alert, webhook.ExternalURL)
+		if err != nil {
+			log.Error("Failed to handle alert", zap.String("fingerprint", alert.Fingerprint), zap.Error(err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, firstErr
+}
+
+func (a *AlertIntake) handle(ctx context.Context, alert *models.Alert, externalURL string) (models.AlertResult, error) {
+	result := models.AlertResult{Fingerprint: alert.Fingerprint, Result: AlertIgnored}
+	record, err := a.mongoService.GetAlert(ctx, alert.Fingerprint)
+	if err != nil {
+		return result, err
+	}
+	if record != nil {
+		result.TicketID = record.TicketID
+	}
+
+	if alert.Status == models.AlertResolved {
+		if record == nil || record.Status == models.AlertResolved {
+			return result, nil
+		}
+		resolvedAt := alert.EndsAt
+		if resolvedAt.IsZero() {
+			resolvedAt = time.Now()
+		}
+		body := fmt.Sprintf("Alert %s resolved at %s.", alertName(alert), resolvedAt.UTC().Format(time.RFC3339))
+		if err := a.tickets.AddComment(ctx, record.TicketID, alertCommentAuthor, body); err != nil {
+			return result, err
+		}
+		record.Status = models.AlertResolved
+		record.ResolvedAt = resolvedAt
+		result.Result = AlertResolved
+		return result, a.mongoService.SaveAlert(ctx, record)
+	}
+
+	if record != nil && a.ticketOpen(ctx, record.TicketID) {
+		if record.Status == models.AlertFiring {
+			result.Result = AlertDuplicate
+			return result, nil
+		}
+		body := fmt.Sprintf("Alert %s is firing again since %s.", alertName(alert), alert.StartsAt.UTC().Format(time.RFC3339))
+		if err := a.tickets.AddComment(ctx, record.TicketID, alertCommentAuthor, body); err != nil {
+			return result, err
+		}
+		record.Status = models.AlertFiring
+		record.StartsAt = alert.StartsAt
+		record.ResolvedAt = time.Time{}
+		result.Result = AlertAgain
+		return result, a.mongoService.SaveAlert(ctx, record)
+	}
+
+	response, err := a.tickets.CreateTicket(ctx, AlertTicketRequest(alert, externalURL))
+	if err != nil {
+		return result, err
+	}
+	result.Result = AlertCreated
+	result.TicketID = response.TicketID
+	err = a.mongoService.SaveAlert(ctx, &AlertRecord{
+		Fingerprint: alert.Fingerprint,
+		TicketID:    response.TicketID,
+		AlertName:   alertName(alert),
+		Status:      models.AlertFiring,
+		StartsAt:    alert.StartsAt,
+	})
+	if err != nil {
+		// The ticket exists; failing would file it again on the next delivery
+		logger.FromContext(ctx, a.logger).Warn("Failed to record alert ticket, the alert will not be deduplicated",
+			zap.String("fingerprint", alert.Fingerprint), zap.String("ticket_id", response.TicketID), zap.Error(err))
+	}
+	return result, nil
+}
+
+// ticketOpen reports whether a ticket is open. Tickets whose state cannot be
+// read are taken as open, preferring a missed ticket to a duplicate one.
+func (a *AlertIntake) ticketOpen(ctx context.Context, ticketID string) bool {
+	open, err := a.tickets.IsTicketOpen(ctx, ticketID)
+	if err != nil {
+		logger.FromContext(ctx, a.logger).Warn("Failed to read alert ticket state", zap.String("ticket_id", ticketID), zap.Error(err))
+		return true
+	}
+	return open
+}
+
+// AlertTicketRequest builds the ticket request for a firing alert. The
+// summary annotation, else the alert name, is the issue title; the product
+// and severity labels set the product and severity.
+func AlertTicketRequest(alert *models.Alert, externalURL string) *models.TicketRequest {
+	name := alertName(alert)
+	issue := name
+	if summary := alert.Annotations["summary"]; summary != "" {
+		issue = fmt.Sprintf("%s: %s", name, summary)
+	}
+
+	var description strings.Builder
+	for _, key := range []string{"description", "message"} {
+		if text := alert.Annotations[key]; text != "" {
+			description.WriteString(text)
+			description.WriteString("\n\n")
+			break
+		}
+	}
+	fmt.Fprintf(&description, "Firing since %s.\n", alert.StartsAt.UTC().Format(time.RFC3339))
+	if runbook := alert.Annotations["runbook_url"]; runbook != "" {
+		fmt.Fprintf(&description, "Runbook: %s\n", runbook)
+	}
+	if len(alert.Labels) > 0 {
+		description.WriteString("\nLabels:\n")
+		keys := make([]string, 0, len(alert.Labels))
+		for key := range alert.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&description, "* %s=%s\n", key, alert.Labels[key])
+		}
+	}
+
+	return &models.TicketRequest{
+		URL: alert.GeneratorURL,
+		Payload: map[string]interface{}{
+			"issue":       issue,
+			"description": strings.TrimSpace(description.String()),
+			"product":     alert.Labels["product"],
+			"severity":    alert.Labels["severity"],
+			"labels":      alert.Labels,
+			"annotations": alert.Annotations,
+		},
+		Response: map[string]interface{}{
+			"status":       "reported",
+			"source":       "alertmanager",
+			"fingerprint":  alert.Fingerprint,
+			"startsAt":     alert.StartsAt.UTC().Format(time.RFC3339),
+			"alertmanager": externalURL,
+		},
+		RequestHeaders: map[string]string{},
+	}
+}
+
+func alertName(alert *models.Alert) string {
+	if name := alert.Labels["alertname"]; name != "" {
+		return name
+	}
+	return "Alert " + alert.Fingerprint
+}
+
+// GetAlert retrieves the ticket of an alert, or nil when the alert has none
+func (s *MongoDBService) GetAlert(ctx context.Context, fingerprint string) (*AlertRecord, error) {
+	var record AlertRecord
+	err := s.database.Collection(alertsCollection).FindOne(ctx, bson.M{"_id": fingerprint}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert: %w", err)
+	}
+	return &record, nil
+}
+
+// SaveAlert records the ticket and status of an alert
+func (s *MongoDBService) SaveAlert(ctx context.Context, record *AlertRecord) error {
+	record.UpdatedAt = time.Now()
+	_, err := s.database.Collection(alertsCollection).ReplaceOne(ctx, bson.M{"_id": record.Fingerprint}, record, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save alert: %w", err)
+	}
+	return nil
+}
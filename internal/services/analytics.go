@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// reportFailuresCollection is the collection reports that could not be
+// turned into tickets are recorded in
+const reportFailuresCollection = "report_failures"
+
+// ReportFailure records a report that could not be turned into a ticket
+type ReportFailure struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Product   string             `bson:"product"`
+	Tenant    string             `bson:"tenant,omitempty"`
+	Status    int                `bson:"status"`
+	Code      string             `bson:"code,omitempty"`
+	RequestID string             `bson:"request_id,omitempty"`
+	At        time.Time          `bson:"at"`
+}
+
+// SaveReportFailure records a failed report
+func (s *MongoDBService) SaveReportFailure(ctx context.Context, failure *ReportFailure) error {
+	if _, err := s.reportFailures.InsertOne(ctx, failure); err != nil {
+		return fmt.Errorf("failed to insert report failure: %w", err)
+	}
+	return nil
+}
+
+// productUsage is a product's tickets as aggregated by UsageByProduct
+type productUsage struct {
+	Product            string  `bson:"_id"`
+	Reports            int64   `bson:"reports"`
+	JiraLatencies      []int64 `bson:"jira_latencies"`
+	Attachments        int64   `bson:"attachments"`
+	AttachmentBytes    int64   `bson:"attachment_bytes"`
+	MaxAttachmentBytes int64   `bson:"max_attachment_bytes"`
+}
+
+// UsageByProduct summarizes the tickets created and reports failed from
+// since until until per product, ordered by product, limited to the tickets
+// and failures in scope
+func (s *MongoDBService) UsageByProduct(ctx context.Context, since, until time.Time, scope TicketScope) ([]models.ProductUsage, error) {
+	window := bson.M{"$gte": since, "$lt": until}
+
+	ticketsMatch := scope.filter()
+	ticketsMatch["created_at"] = window
+	cursor, err := s.collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": ticketsMatch},
+		bson.M{"$lookup": bson.M{
+			"from":         attachmentsCollection,
+			"localField":   "ticket_id",
+			"foreignField": "ticket_id",
+			"as":           "attachments",
+		}},
+		bson.M{"$group": bson.M{
+			"_id":                  "$product",
+			"reports":              bson.M{"$sum": 1},
+			"jira_latencies":       bson.M{"$push": bson.M{"$ifNull": bson.A{"$jira_latency_ms", 0}}},
+			"attachments":          bson.M{"$sum": bson.M{"$size": "$attachments"}},
+			"attachment_bytes":     bson.M{"$sum": bson.M{"$sum": "$attachments.size"}},
+			"max_attachment_bytes": bson.M{"$max": bson.M{"$ifNull": bson.A{bson.M{"$max": "$attachments.size"}, 0}}},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate ticket usage: %w", err)
+	}
+	var tickets []productUsage
+	if err := cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode ticket usage: %w", err)
+	}
+
+	failuresMatch := scope.filter()
+	failuresMatch["at"] = window
+	cursor, err = s.reportFailures.Aggregate(ctx, bson.A{
+		bson.M{"$match": failuresMatch},
+		bson.M{"$group": bson.M{"_id": "$product", "failures": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate report failures: %w", err)
+	}
+	var failures []struct {
+		Product  string `bson:"_id"`
+		Failures int64  `bson:"failures"`
+	}
+	if err := cursor.All(ctx, &failures); err != nil {
+		return nil, fmt.Errorf("failed to decode report failures: %w", err)
+	}
+
+	usage := make(map[string]*models.ProductUsage)
+	entry := func(product string) *models.ProductUsage {
+		if usage[product] == nil {
+			usage[product] = &models.ProductUsage{Product: product}
+		}
+		return usage[product]
+	}
+	for _, t := range tickets {
+		u := entry(t.Product)
+		u.Reports = t.Reports
+		u.MedianJiraLatencyMs = median(t.JiraLatencies)
+		u.Attachments = t.Attachments
+		u.AttachmentBytes = t.AttachmentBytes
+		u.MaxAttachmentBytes = t.MaxAttachmentBytes
+		if t.Attachments > 0 {
+			u.AvgAttachmentBytes = t.AttachmentBytes / t.Attachments
+		}
+	}
+	for _, f := range failures {
+		entry(f.Product).Failures = f.Failures
+	}
+
+	result := make([]models.ProductUsage, 0, len(usage))
+	for _, u := range usage {
+		if processed := u.Reports + u.Failures; processed > 0 {
+			u.FailureRate = float64(u.Failures) / float64(processed)
+		}
+		result = append(result, *u)
+	}
+	slices.SortFunc(result, func(a, b models.ProductUsage) int {
+		return strings.Compare(a.Product, b.Product)
+	})
+	return result, nil
+}
+
+// median returns the median of the positive values, or 0 when there are
+// none; tickets created before latencies were recorded have 0
+func median(values []int64) int64 {
+	values = slices.DeleteFunc(values, func(v int64) bool { return v <= 0 })
+	if len(values) == 0 {
+		return 0
+	}
+	slices.Sort(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scopes an API key or OIDC role is granted. Write includes read, and admin
+// includes everything.
+const (
+	ScopeReport = "report"
+	ScopeRead   = "read"
+	ScopeWrite  = "write"
+	ScopeAdmin  = "admin"
+)
+
+// apiKeyPrefix starts every generated key, so leaked keys are recognizable
+const apiKeyPrefix = "rk_"
+
+// Errors returned by the API key store
+var (
+	ErrInvalidAPIKey      = errors.New("invalid API key")
+	ErrAPIKeyConfigured   = errors.New("API key is configured in API_KEYS and cannot be revoked through the API")
+	ErrAPIKeysNotStored   = errors.New("API keys can only be created when MongoDB is configured")
+	ErrUnknownAPIKeyScope = errors.New("unknown API key scope")
+)
+
+// APIKey is a key clients authenticate with. Only the SHA-256 hash of the
+// key is kept; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID        string     `bson:"_id" json:"id" example:"65f1c2a9e4b0a1b2c3d4e5f6"`
+	Name      string     `bson:"name" json:"name" example:"mobile-app"`
+	Hash      string     `bson:"hash" json:"-"`
+	Prefix    string     `bson:"prefix,omitempty" json:"prefix,omitempty" example:"rk_Xq3v"`
+	Scopes    []string   `bson:"scopes" json:"scopes" example:"report"`
+	Products  []string   `bson:"products,omitempty" json:"products,omitempty" example:"checkout"`
+	Tenant    string     `bson:"tenant,omitempty" json:"tenant,omitempty" example:"lending"`
+	Source    string     `bson:"-" json:"source" example:"database"`
+	CreatedAt time.Time  `bson:"created_at" json:"createdAt"`
+	RevokedAt *time.Time `bson:"revoked_at,omitempty" json:"revokedAt,omitempty"`
+}
+
+// Sources of API keys
+const (
+	APIKeySourceConfig   = "config"
+	APIKeySourceDatabase = "database"
+)
+
+// Allows reports whether the key grants a scope
+func (k *APIKey) Allows(scope string) bool {
+	return scopesAllow(k.Scopes, scope)
+}
+
+// scopesAllow reports whether granted scopes include a scope
+func scopesAllow(granted []string, scope string) bool {
+	for _, g := range granted {
+		if g == scope || g == ScopeAdmin || (g == ScopeWrite && scope == ScopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// IssuedAPIKey is a newly created API key together with the key itself
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key" example:"rk_Xq3vN8pL2mK5rT7wY9zA1bC4dE6fG8hJ0kM2nP4qS6u"`
+}
+
+// APIKeyStore authenticates API keys configured in API_KEYS and those
+// created through the admin API, which are stored in MongoDB
+type APIKeyStore struct {
+	configured map[string]*APIKey // by hash
+	mongo      *MongoDBService
+}
+
+// NewAPIKeyStore creates a store of the configured keys, storing new keys in
+// MongoDB when ms is not nil
+func NewAPIKeyStore(configured []APIKey, ms *MongoDBService) (*APIKeyStore, error) {
+	s := &APIKeyStore{
+		configured: make(map[string]*APIKey, len(configured)),
+		mongo:      ms,
+	}
+	for i := range configured {
+		key := configured[i]
+		key.Hash = strings.ToLower(key.Hash)
+		if err := validateScopes(key.Scopes); err != nil {
+			return nil, fmt.Errorf("API key %s: %w", key.Name, err)
+		}
+		if _, ok := s.configured[key.Hash]; ok {
+			return nil, fmt.Errorf("API key %s has the same hash as another key", key.Name)
+		}
+		if key.ID == "" {
+			key.ID = key.Name
+		}
+		key.Source = APIKeySourceConfig
+		s.configured[key.Hash] = &key
+	}
+	return s, nil
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash keys are stored as
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate returns the unrevoked key matching key, or ErrInvalidAPIKey
+func (s *APIKeyStore) Authenticate(ctx context.Context, key string) (*APIKey, error) {
+	if key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+	hash := HashAPIKey(key)
+	if found, ok := s.configured[hash]; ok {
+		return found, nil
+	}
+	if s.mongo == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	found, err := s.mongo.GetAPIKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrInvalidAPIKey
+	}
+	found.Source = APIKeySourceDatabase
+	return found, nil
+}
+
+// Create generates a key with the given scopes, limited to the tickets of
+// products when any are given, and stores its hash. Keys of a tenant only
+// see the tickets of the tenant.
+func (s *APIKeyStore) Create(ctx context.Context, name string, scopes, products []string, tenant string) (*IssuedAPIKey, error) {
+	if s.mongo == nil {
+		return nil, ErrAPIKeysNotStored
+	}
+	if err := validateScopes(scopes); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	issued := &IssuedAPIKey{
+		APIKey: APIKey{
+			ID:        primitive.NewObjectID().Hex(),
+			Name:      name,
+			Hash:      HashAPIKey(key),
+			Prefix:    key[:len(apiKeyPrefix)+4],
+			Scopes:    scopes,
+			Products:  products,
+			Tenant:    tenant,
+			Source:    APIKeySourceDatabase,
+			CreatedAt: time.Now(),
+		},
+		Key: key,
+	}
+	if err := s.mongo.SaveAPIKey(ctx, &issued.APIKey); err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// List returns the configured keys followed by the stored ones
+func (s *APIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	keys := make([]APIKey, 0, len(s.configured))
+	for _, key := range s.configured {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	if s.mongo == nil {
+		return keys, nil
+	}
+
+	stored, err := s.mongo.GetAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stored {
+		stored[i].Source = APIKeySourceDatabase
+	}
+	return append(keys, stored...), nil
+}
+
+// Revoke revokes a stored key by ID
+func (s *APIKeyStore) Revoke(ctx context.Context, id string) error {
+	for _, key := range s.configured {
+		if key.ID == id {
+			return ErrAPIKeyConfigured
+		}
+	}
+	if s.mongo == nil {
+		return fmt.Errorf("API key %s not found", id)
+	}
+	return s.mongo.RevokeAPIKey(ctx, id, time.Now())
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrUnknownAPIKeyScope)
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeReport, ScopeRead, ScopeWrite, ScopeAdmin:
+		default:
+			return fmt.Errorf("%w %q, expected report, read, write or admin", ErrUnknownAPIKeyScope, scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditActionCreate     = "create"
+	AuditActionPatch      = "patch"
+	AuditActionDelete     = "delete"
+	AuditActionTransition = "transition"
+	AuditActionDownload   = "download"
+)
+
+// Kinds of callers recorded in the audit log
+const (
+	AuditActorAPIKey    = "api_key"
+	AuditActorUser      = "user"
+	AuditActorToken     = "token"
+	AuditActorAnonymous = "anonymous"
+)
+
+// AuditEntry records a mutating API request or a download: who made it, what
+// it did to which resource, when and from where. Entries are only ever
+// inserted.
+type AuditEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	At         time.Time          `bson:"at" json:"at"`
+	Actor      string             `bson:"actor" json:"actor" example:"support-dashboard"`
+	ActorType  string             `bson:"actor_type" json:"actorType" example:"api_key"`
+	Action     string             `bson:"action" json:"action" example:"transition"`
+	Method     string             `bson:"method" json:"method" example:"POST"`
+	Route      string             `bson:"route" json:"route" example:"/api/v1/admin/tickets/:id/resync"`
+	ResourceID string             `bson:"resource_id,omitempty" json:"resourceId,omitempty" example:"PROJ-123"`
+	Status     int                `bson:"status" json:"status" example:"200"`
+	ClientIP   string             `bson:"client_ip" json:"clientIp" example:"203.0.113.7"`
+	RequestID  string             `bson:"request_id,omitempty" json:"requestId,omitempty" example:"4f7c2b1e-9a0d-4c36-8e15-2b7d9f3a6c10"`
+}
+
+// AuditFilter selects audit entries; empty fields match every entry
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	ResourceID string
+	Since      time.Time
+	Until      time.Time
+}
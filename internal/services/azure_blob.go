@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+)
+
+// AzureBlobService handles uploading files to an Azure Blob Storage container
+type AzureBlobService struct {
+	client        *azblob.Client
+	containerName string
+	presignExpiry time.Duration
+}
+
+// NewAzureBlobService creates a new Azure Blob storage service. The endpoint
+// defaults to the public blob endpoint of the account and can be overridden
+// for Azurite or sovereign clouds.
+func NewAzureBlobService(accountName, accountKey, containerName, endpoint string, presignExpiry time.Duration) (*AzureBlobService, error) {
+	cred, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure credentials: %w", err)
+	}
+
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", accountName)
+	}
+
+	client, err := azblob.NewClientWithSharedKeyCredential(endpoint, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure Blob client: %w", err)
+	}
+
+	return &AzureBlobService{
+		client:        client,
+		containerName: containerName,
+		presignExpiry: normalizePresignExpiry(presignExpiry),
+	}, nil
+}
+
+// PresignExpiry returns how long generated SAS URLs stay valid
+func (s *AzureBlobService) PresignExpiry() time.Duration {
+	return s.presignExpiry
+}
+
+// UploadFile uploads a file to the container under objectKey and returns a SAS
+// URL. The file is streamed in blocks, so large recordings are not buffered.
+func (s *AzureBlobService) UploadFile(ctx context.Context, file *multipart.FileHeader, objectKey string, tags map[string]string) (_ string, err error) {
+	defer observeUpload(ctx, StorageBackendAzure, file.Size, time.Now(), &err)
+
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	_, err = s.client.UploadStream(ctx, s.containerName, objectKey, src, &azblob.UploadStreamOptions{
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: to.Ptr(file.Header.Get("Content-Type")),
+		},
+		Tags: tags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload to Azure Blob Storage: %w", err)
+	}
+
+	return s.PresignGetURL(ctx, objectKey)
+}
+
+// UploadStream uploads content read from r to the container in blocks
+func (s *AzureBlobService) UploadStream(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string, tags map[string]string) (err error) {
+	defer observeUpload(ctx, StorageBackendAzure, size, time.Now(), &err)
+
+	_, err = s.client.UploadStream(ctx, s.containerName, objectKey, r, &azblob.UploadStreamOptions{
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: to.Ptr(contentType),
+		},
+		Tags: tags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to Azure Blob Storage: %w", err)
+	}
+
+	return nil
+}
+
+// PresignGetURL generates a read-only SAS URL for an existing blob
+func (s *AzureBlobService) PresignGetURL(ctx context.Context, objectKey string) (string, error) {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.containerName).NewBlobClient(objectKey)
+
+	sasURL, err := blobClient.GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(s.presignExpiry), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate SAS URL for %s: %w", objectKey, err)
+	}
+
+	return sasURL, nil
+}
+
+// PresignPutURL generates a write-only SAS URL a client can upload a blob to.
+// Azure requires the blob type header on uploads; tags are sent as x-ms-tags.
+// Azure has no SHA-256 upload validation, so checksumSHA256 is ignored.
+func (s *AzureBlobService) PresignPutURL(ctx context.Context, objectKey, contentType, checksumSHA256 string, tags map[string]string, expires time.Duration) (string, map[string]string, error) {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.containerName).NewBlobClient(objectKey)
+
+	permissions := sas.BlobPermissions{Create: true, Write: true, Tag: len(tags) > 0}
+	sasURL, err := blobClient.GetSASURL(permissions, time.Now().Add(expires), nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate upload SAS URL for %s: %w", objectKey, err)
+	}
+
+	headers := map[string]string{
+		"Content-Type":   contentType,
+		"x-ms-blob-type": "BlockBlob",
+	}
+	if len(tags) > 0 {
+		values := url.Values{}
+		for k, v := range tags {
+			values.Set(k, v)
+		}
+		headers["x-ms-tags"] = values.Encode()
+	}
+
+	return sasURL, headers, nil
+}
+
+// TagObject merges tags into the existing index tags of a blob
+func (s *AzureBlobService) TagObject(ctx context.Context, objectKey string, tags map[string]string) error {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.containerName).NewBlobClient(objectKey)
+
+	existing, err := blobClient.GetTags(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get tags of blob %s: %w", objectKey, err)
+	}
+
+	merged := make(map[string]string, len(tags))
+	if existing.BlobTagSet != nil {
+		for _, tag := range existing.BlobTagSet {
+			if tag.Key != nil && tag.Value != nil {
+				merged[*tag.Key] = *tag.Value
+			}
+		}
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+
+	if _, err := blobClient.SetTags(ctx, merged, nil); err != nil {
+		return fmt.Errorf("failed to tag blob %s: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// StatObject returns the size and content type of an existing blob
+func (s *AzureBlobService) StatObject(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.containerName).NewBlobClient(objectKey)
+
+	props, err := blobClient.GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to get properties of blob %s: %w", objectKey, err)
+	}
+
+	info := &ObjectInfo{Key: objectKey}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.ContentType != nil {
+		info.ContentType = *props.ContentType
+	}
+	if props.LastModified != nil {
+		info.LastModified = *props.LastModified
+	}
+
+	return info, nil
+}
+
+// OpenObject streams the content of an existing blob
+func (s *AzureBlobService) OpenObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	resp, err := s.client.DownloadStream(ctx, s.containerName, objectKey, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to download blob %s: %w", objectKey, err)
+	}
+
+	return resp.Body, nil
+}
+
+// Ping checks that the container exists and is accessible
+func (s *AzureBlobService) Ping(ctx context.Context) error {
+	containerClient := s.client.ServiceClient().NewContainerClient(s.containerName)
+	if _, err := containerClient.GetProperties(ctx, nil); err != nil {
+		return fmt.Errorf("failed to reach container %s: %w", s.containerName, err)
+	}
+	return nil
+}
+
+// DeleteObject removes a blob from the container
+func (s *AzureBlobService) DeleteObject(ctx context.Context, objectKey string) error {
+	if _, err := s.client.DeleteBlob(ctx, s.containerName, objectKey, nil); err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete blob %s: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// CopyObject copies a blob within the container. The source is read through a
+// short-lived SAS URL so the copy also works for private containers.
+func (s *AzureBlobService) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	containerClient := s.client.ServiceClient().NewContainerClient(s.containerName)
+
+	srcURL, err := containerClient.NewBlobClient(srcKey).GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(15*time.Minute), nil)
+	if err != nil {
+		return fmt.Errorf("failed to generate SAS URL for %s: %w", srcKey, err)
+	}
+
+	if _, err := containerClient.NewBlobClient(dstKey).CopyFromURL(ctx, srcURL, nil); err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.CannotVerifyCopySource) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, srcKey)
+		}
+		return fmt.Errorf("failed to copy blob %s to %s: %w", srcKey, dstKey, err)
+	}
+
+	return nil
+}
+
+// ListObjects calls fn for every blob whose name starts with prefix
+func (s *AzureBlobService) ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	pager := s.client.NewListBlobsFlatPager(s.containerName, &azblob.ListBlobsFlatOptions{
+		Prefix: to.Ptr(prefix),
+	})
+
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list blobs under %s: %w", prefix, err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+			info := ObjectInfo{Key: *item.Name}
+			if props := item.Properties; props != nil {
+				if props.ContentLength != nil {
+					info.Size = *props.ContentLength
+				}
+				if props.ContentType != nil {
+					info.ContentType = *props.ContentType
+				}
+				if props.LastModified != nil {
+					info.LastModified = *props.LastModified
+				}
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ArchiveObject moves a blob to the archive access tier
+func (s *AzureBlobService) ArchiveObject(ctx context.Context, objectKey string) error {
+	blobClient := s.client.ServiceClient().NewContainerClient(s.containerName).NewBlobClient(objectKey)
+
+	if _, err := blobClient.SetTier(ctx, blob.AccessTierArchive, nil); err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return fmt.Errorf("failed to archive blob %s: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// ObjectKeyFromURL extracts the blob name from a URL previously returned by UploadFile
+func (s *AzureBlobService) ObjectKeyFromURL(rawURL string) (string, error) {
+	return objectKeyFromURL(rawURL)
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.uber.org/zap"
+)
+
+// Categories of reports
+const (
+	CategoryUIBug       = "ui-bug"
+	CategoryAPIFailure  = "api-failure"
+	CategoryAuth        = "auth"
+	CategoryPerformance = "performance"
+)
+
+// Categories lists the categories of reports
+var Categories = []string{CategoryUIBug, CategoryAPIFailure, CategoryAuth, CategoryPerformance}
+
+// Severities lists the severities of reports, highest first
+var Severities = []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow}
+
+// What classified a report
+const (
+	ClassifiedByRules   = "rules"
+	ClassifiedByModel   = "model"
+	ClassifiedByDefault = "default"
+)
+
+// Models consulted for reports the rules cannot classify
+const (
+	ClassifierModelNone = "none"
+	ClassifierModelLLM  = "llm"
+	ClassifierModelAPI  = "api"
+)
+
+// classifierTimeout bounds the model lookup of a report
+const classifierTimeout = 10 * time.Second
+
+// defaultSeverities are the severities of the categories of reports whose
+// rules or model gave none
+var defaultSeverities = map[string]string{
+	CategoryUIBug:       SeverityLow,
+	CategoryAPIFailure:  SeverityHigh,
+	CategoryAuth:        SeverityHigh,
+	CategoryPerformance: SeverityMedium,
+}
+
+// ClassificationRule assigns its category and severity, either of which may
+// be empty, to reports whose issue or description contains one of its
+// keywords as words, or with a failed network call answered with one of its
+// statuses. Statuses are codes like 401 or classes like 5xx; 0 matches calls
+// that got no answer.
+type ClassificationRule struct {
+	Name     string
+	Category string
+	Severity string
+	Keywords []string
+	Statuses []string
+}
+
+// defaultClassificationRules are checked after the configured rules. Failed
+// calls are stronger evidence than words, so status rules come first.
+var defaultClassificationRules = []ClassificationRule{
+	{
+		Name:     "outage",
+		Severity: SeverityCritical,
+		Keywords: []string{"outage", "down for everyone", "data loss", "lost my data", "charged twice", "double charged", "security"},
+	},
+	{Name: "auth-status", Category: CategoryAuth, Severity: SeverityHigh, Statuses: []string{"401", "403"}},
+	{Name: "timeout-status", Category: CategoryPerformance, Severity: SeverityMedium, Statuses: []string{"408", "504", "0"}},
+	{Name: "server-error", Category: CategoryAPIFailure, Severity: SeverityHigh, Statuses: []string{"5xx"}},
+	{Name: "client-error", Category: CategoryAPIFailure, Severity: SeverityMedium, Statuses: []string{"4xx"}},
+	{
+		Name:     "auth-words",
+		Category: CategoryAuth,
+		Severity: SeverityHigh,
+		Keywords: []string{"log in", "login", "logged out", "sign in", "signin", "password", "otp", "session expired", "unauthorized", "access denied"},
+	},
+	{
+		Name:     "performance-words",
+		Category: CategoryPerformance,
+		Severity: SeverityMedium,
+		Keywords: []string{"slow", "slowly", "takes forever", "timeout", "timed out", "freeze", "freezes", "frozen", "hangs", "lag", "laggy", "spinner", "unresponsive"},
+	},
+	{
+		Name:     "ui-words",
+		Category: CategoryUIBug,
+		Severity: SeverityLow,
+		Keywords: []string{"button", "layout", "alignment", "misaligned", "overlap", "overlaps", "typo", "font", "color", "colour", "dark mode", "scroll"},
+	},
+}
+
+// ClassificationModel classifies the reports no rule matched, returning one
+// of Categories and one of Severities
+type ClassificationModel interface {
+	Classify(ctx context.Context, req *models.TicketRequest) (category, severity string, err error)
+}
+
+// Classifier assigns new reports a category and a severity, stored on their
+// ticket and used for routing, labels and priorities. Rules come first;
+// reports no rule gives a category are classified by the model when there is
+// one, and are UI bugs otherwise. Severities given by reporters are kept.
+type Classifier struct {
+	rules    []classificationRule
+	products *Products
+	model    ClassificationModel
+	logger   *zap.Logger
+}
+
+// classificationRule is a ClassificationRule with its keywords compiled
+type classificationRule struct {
+	ClassificationRule
+	keywords *regexp.Regexp
+}
+
+// NewClassifier creates a classifier checking rules before the default
+// rules, and consulting model, which may be nil, for reports they leave
+// without a category
+func NewClassifier(rules []ClassificationRule, model ClassificationModel, log *zap.Logger) (*Classifier, error) {
+	c := &Classifier{model: model, logger: log}
+	for _, rule := range append(append([]ClassificationRule(nil), rules...), defaultClassificationRules...) {
+		compiled, err := compileClassificationRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		c.rules = append(c.rules, compiled)
+	}
+	return c, nil
+}
+
+// compileClassificationRule checks a rule and compiles its keywords
+func compileClassificationRule(rule ClassificationRule) (classificationRule, error) {
+	if rule.Category != "" && !slices.Contains(Categories, rule.Category) {
+		return classificationRule{}, fmt.Errorf("classification rule %s has unknown category %q", rule.Name, rule.Category)
+	}
+	if rule.Severity != "" && !slices.Contains(Severities, rule.Severity) {
+		return classificationRule{}, fmt.Errorf("classification rule %s has unknown severity %q", rule.Name, rule.Severity)
+	}
+	for _, status := range rule.Statuses {
+		if !validStatusPattern(status) {
+			return classificationRule{}, fmt.Errorf("classification rule %s has invalid status %q", rule.Name, status)
+		}
+	}
+	compiled := classificationRule{ClassificationRule: rule}
+	if len(rule.Keywords) > 0 {
+		quoted := make([]string, len(rule.Keywords))
+		for i, keyword := range rule.Keywords {
+			quoted[i] = regexp.QuoteMeta(strings.TrimSpace(keyword))
+		}
+		compiled.keywords = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return compiled, nil
+}
+
+// SetProducts sets the registered products whose severity rules are checked
+// before the other rules for their reports
+func (c *Classifier) SetProducts(products *Products) {
+	c.products = products
+}
+
+// Classify returns the classification of a report
+func (c *Classifier) Classify(ctx context.Context, req *models.TicketRequest) *models.Classification {
+	issue, _ := req.Payload["issue"].(string)
+	description, _ := req.Payload["description"].(string)
+	text := issue + "\n" + description
+	var statuses []int
+	for _, call := range failedCalls(req.Payload["failedNetworkCalls"]) {
+		statuses = append(statuses, call.ResponseStatus)
+	}
+
+	rules := c.rules
+	if c.products != nil {
+		product, _ := req.Payload["product"].(string)
+		rules = slices.Concat(c.products.severityRules(product), rules)
+	}
+
+	classification := &models.Classification{ClassifiedBy: ClassifiedByRules}
+	for _, rule := range rules {
+		if classification.Category != "" && classification.Severity != "" {
+			break
+		}
+		if !rule.matches(text, statuses) {
+			continue
+		}
+		if classification.Category == "" {
+			classification.Category = rule.Category
+		}
+		if classification.Severity == "" {
+			classification.Severity = rule.Severity
+		}
+	}
+
+	if classification.Category == "" && c.model != nil {
+		category, severity, err := c.classifyWithModel(ctx, req)
+		if err != nil {
+			c.logger.Warn("Failed to classify report with model", zap.Error(err))
+		} else {
+			classification.Category = category
+			classification.ClassifiedBy = ClassifiedByModel
+			if classification.Severity == "" {
+				classification.Severity = severity
+			}
+		}
+	}
+	if classification.Category == "" {
+		classification.Category = CategoryUIBug
+		classification.ClassifiedBy = ClassifiedByDefault
+	}
+	if classification.Severity == "" {
+		classification.Severity = defaultSeverities[classification.Category]
+	}
+	return classification
+}
+
+func (c *Classifier) classifyWithModel(ctx context.Context, req *models.TicketRequest) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, classifierTimeout)
+	defer cancel()
+	category, severity, err := c.model.Classify(ctx, req)
+	if err != nil {
+		return "", "", err
+	}
+	if !slices.Contains(Categories, category) {
+		return "", "", fmt.Errorf("model returned unknown category %q", category)
+	}
+	if !slices.Contains(Severities, severity) {
+		severity = ""
+	}
+	return category, severity, nil
+}
+
+// matches reports whether the text or a failed call's status of a report
+// matches the rule
+func (r classificationRule) matches(text string, statuses []int) bool {
+	if r.keywords != nil && r.keywords.MatchString(text) {
+		return true
+	}
+	for _, pattern := range r.Statuses {
+		for _, status := range statuses {
+			if statusMatches(pattern, status) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// statusMatches reports whether an HTTP status matches a code like 404 or a
+// class like 4xx
+func statusMatches(pattern string, status int) bool {
+	if class, ok := strings.CutSuffix(strings.ToLower(pattern), "xx"); ok {
+		return status >= 100 && strconv.Itoa(status/100) == class
+	}
+	return pattern == strconv.Itoa(status)
+}
+
+func validStatusPattern(pattern string) bool {
+	if class, ok := strings.CutSuffix(strings.ToLower(pattern), "xx"); ok {
+		return len(class) == 1 && class[0] >= '1' && class[0] <= '5'
+	}
+	status, err := strconv.Atoi(pattern)
+	return err == nil && (status == 0 || status >= 100 && status <= 599)
+}
+
+// TicketSeverity returns the severity of a ticket: the one given by its
+// reporter, or the classified one
+func TicketSeverity(req *models.TicketRequest) string {
+	if severity, ok := req.Payload["severity"].(string); ok && severity != "" {
+		return severity
+	}
+	if req.Classification != nil {
+		return req.Classification.Severity
+	}
+	return ""
+}
+
+// classifySystemPrompt instructs the model on classifying reports
+var classifySystemPrompt = fmt.Sprintf(`You classify bug reports for support engineers triaging them in an issue tracker.
+Reply with a JSON object {"category": string, "severity": string}.
+The category is one of %s: a visual or interaction defect, failed requests to a backend API, trouble signing in or staying signed in, or slowness.
+The severity is one of %s: critical for outages, data loss, payments or security, high when users cannot complete a task, medium when there is a workaround, low for cosmetic issues.`,
+	strings.Join(Categories, ", "), strings.Join(Severities, ", "))
+
+// Classify asks the summary model for the category and severity of a
+// report, sending it with the guardrails of summaries
+func (s *Summarizer) Classify(ctx context.Context, req *models.TicketRequest) (string, string, error) {
+	content, err := s.complete(ctx, classifySystemPrompt, s.reportText(req))
+	if err != nil {
+		return "", "", err
+	}
+	var answer struct {
+		Category string `json:"category"`
+		Severity string `json:"severity"`
+	}
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return "", "", fmt.Errorf("classification is not a JSON object: %w", err)
+	}
+	return strings.ToLower(strings.TrimSpace(answer.Category)), strings.ToLower(strings.TrimSpace(answer.Severity)), nil
+}
+
+// ClassifierAPI classifies reports with a model served over HTTP, which
+// answers POST <url> with a report like
+// {"product", "issue", "description", "page", "failedCalls": [{"method", "path", "status"}]}
+// with {"category", "severity"}
+type ClassifierAPI struct {
+	url      string
+	token    string
+	redactor *Redactor
+	client   *http.Client
+}
+
+// NewClassifierAPI creates a model client of the classification API at
+// apiURL, authenticated with token as Bearer token when it is not empty.
+// Reports are redacted before they are sent.
+func NewClassifierAPI(apiURL, token string, redactor *Redactor) *ClassifierAPI {
+	return &ClassifierAPI{url: apiURL, token: token, redactor: redactor, client: &http.Client{Timeout: classifierTimeout}}
+}
+
+type classifierCall struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+}
+
+// Classify sends a report to the classification API
+func (a *ClassifierAPI) Classify(ctx context.Context, req *models.TicketRequest) (string, string, error) {
+	req = a.redactor.Ticket(req)
+	report := map[string]interface{}{
+		"page":        urlPath(req.URL),
+		"failedCalls": []classifierCall{},
+	}
+	for _, key := range []string{"product", "issue", "description"} {
+		report[key], _ = req.Payload[key].(string)
+	}
+	var calls []classifierCall
+	for _, call := range failedCalls(req.Payload["failedNetworkCalls"]) {
+		calls = append(calls, classifierCall{
+			Method: strings.ToUpper(call.RequestData.Method),
+			Path:   urlPath(call.RequestData.URL),
+			Status: call.ResponseStatus,
+		})
+	}
+	if calls != nil {
+		report["failedCalls"] = calls
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode classification request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create classification request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to call classification API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", "", fmt.Errorf("classification API answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var answer struct {
+		Category string `json:"category"`
+		Severity string `json:"severity"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return "", "", fmt.Errorf("failed to decode classification: %w", err)
+	}
+	return strings.ToLower(answer.Category), strings.ToLower(answer.Severity), nil
+}
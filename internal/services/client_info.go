@@ -0,0 +1,220 @@
+package services
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// Headers the SDK describes the reporter's screen and settings with
+const (
+	ClientScreenHeader   = "X-Client-Screen"
+	ClientViewportHeader = "X-Client-Viewport"
+	ClientLocaleHeader   = "X-Client-Locale"
+	ClientTimezoneHeader = "X-Client-Timezone"
+)
+
+// maxUserAgentLength bounds the User-Agent kept with a report
+const maxUserAgentLength = 512
+
+var (
+	screenSizePattern = regexp.MustCompile(`^\d{2,5}x\d{2,5}(@\d{1,2}(\.\d{1,4})?)?$`)
+	localePattern     = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8}){0,3}$`)
+	timezonePattern   = regexp.MustCompile(`^[A-Za-z_]{1,32}(/[A-Za-z0-9_+-]{1,32}){0,2}$`)
+	clientHintBrand   = regexp.MustCompile(`"([^"]+)";\s*v="([^"]*)"`)
+)
+
+// DescribeClient describes the client of a request from its User-Agent,
+// its Sec-CH-UA client hints and the X-Client-* headers. Values that are
+// malformed are left out. It returns nil when nothing is known.
+func DescribeClient(header http.Header) *models.ClientEnvironment {
+	ua := header.Get("User-Agent")
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	env := parseUserAgent(ua)
+	env.UserAgent = ua
+	applyClientHints(&env, header)
+
+	env.Screen = matchOrEmpty(screenSizePattern, header.Get(ClientScreenHeader))
+	env.Viewport = matchOrEmpty(screenSizePattern, header.Get(ClientViewportHeader))
+	env.Timezone = matchOrEmpty(timezonePattern, header.Get(ClientTimezoneHeader))
+	env.Locale = matchOrEmpty(localePattern, header.Get(ClientLocaleHeader))
+	if env.Locale == "" {
+		// The browser's preferred language stands in for the SDK's locale
+		preferred, _, _ := strings.Cut(header.Get("Accept-Language"), ",")
+		preferred, _, _ = strings.Cut(preferred, ";")
+		env.Locale = matchOrEmpty(localePattern, strings.TrimSpace(preferred))
+	}
+
+	if env.IsZero() {
+		return nil
+	}
+	return &env
+}
+
+func matchOrEmpty(pattern *regexp.Regexp, value string) string {
+	if pattern.MatchString(value) {
+		return value
+	}
+	return ""
+}
+
+// userAgentBrowsers are the tokens browsers identify with, most specific
+// first since most browsers also claim to be Chrome or Safari
+var userAgentBrowsers = []struct {
+	token string
+	name  string
+}{
+	{"EdgiOS/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Chrome/", "Chrome"},
+}
+
+// parseUserAgent recognizes the common browsers, operating systems and
+// device classes in a User-Agent
+func parseUserAgent(ua string) models.ClientEnvironment {
+	var env models.ClientEnvironment
+	if ua == "" {
+		return env
+	}
+
+	for _, b := range userAgentBrowsers {
+		if i := strings.Index(ua, b.token); i >= 0 {
+			env.Browser = b.name
+			env.BrowserVersion = versionAt(ua[i+len(b.token):])
+			break
+		}
+	}
+	if env.Browser == "" {
+		switch {
+		case strings.Contains(ua, "Safari/") && strings.Contains(ua, "Version/"):
+			env.Browser = "Safari"
+			env.BrowserVersion = versionAt(ua[strings.Index(ua, "Version/")+len("Version/"):])
+		case strings.Contains(ua, "Trident/") || strings.Contains(ua, "MSIE "):
+			env.Browser = "Internet Explorer"
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "Windows NT "):
+		env.OS = "Windows"
+		env.OSVersion = windowsVersions[versionAt(ua[strings.Index(ua, "Windows NT ")+len("Windows NT "):])]
+	case strings.Contains(ua, "iPad"):
+		env.OS = "iPadOS"
+		env.OSVersion = appleVersion(ua, "CPU OS ")
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		env.OS = "iOS"
+		env.OSVersion = appleVersion(ua, "iPhone OS ")
+	case strings.Contains(ua, "Android"):
+		env.OS = "Android"
+		if i := strings.Index(ua, "Android "); i >= 0 {
+			env.OSVersion = versionAt(ua[i+len("Android "):])
+		}
+	case strings.Contains(ua, "CrOS"):
+		env.OS = "ChromeOS"
+	case strings.Contains(ua, "Mac OS X"):
+		env.OS = "macOS"
+		env.OSVersion = appleVersion(ua, "Mac OS X ")
+	case strings.Contains(ua, "Linux"):
+		env.OS = "Linux"
+	}
+
+	lower := strings.ToLower(ua)
+	switch {
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "crawler") ||
+		strings.Contains(lower, "spider") || strings.Contains(ua, "HeadlessChrome"):
+		env.Device = "bot"
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		(env.OS == "Android" && !strings.Contains(ua, "Mobile")):
+		env.Device = "tablet"
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		env.Device = "mobile"
+	default:
+		env.Device = "desktop"
+	}
+	return env
+}
+
+// windowsVersions names the Windows NT kernel versions in User-Agents.
+// Windows 11 still reports 10.0; only client hints tell it apart.
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+}
+
+// versionAt returns the dotted version at the start of s
+func versionAt(s string) string {
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.Trim(s[:end], ".")
+}
+
+// appleVersion returns the version after prefix, which Apple writes with
+// underscores
+func appleVersion(ua, prefix string) string {
+	i := strings.Index(ua, prefix)
+	if i < 0 {
+		return ""
+	}
+	rest := strings.ReplaceAll(ua[i+len(prefix):], "_", ".")
+	return versionAt(rest)
+}
+
+// applyClientHints refines the parsed User-Agent with the low entropy
+// client hints Chromium browsers send, and Sec-CH-UA-Platform-Version when
+// the browser was asked for it with Accept-CH
+func applyClientHints(env *models.ClientEnvironment, header http.Header) {
+	switch platform := strings.Trim(header.Get("Sec-CH-UA-Platform"), `"`); platform {
+	case "macOS", "Windows", "Android", "iOS", "Linux", "Chrome OS":
+		platform = strings.ReplaceAll(platform, " ", "")
+		if env.OS != platform {
+			env.OSVersion = ""
+		}
+		env.OS = platform
+	}
+	if version := strings.Trim(header.Get("Sec-CH-UA-Platform-Version"), `"`); version != "" {
+		if env.OS == "Windows" {
+			// Windows 11 reports platform versions from 13 on
+			if major, err := strconv.Atoi(strings.Split(version, ".")[0]); err == nil {
+				env.OSVersion = "10"
+				if major >= 13 {
+					env.OSVersion = "11"
+				}
+			}
+		} else {
+			env.OSVersion = versionAt(version)
+		}
+	}
+	if header.Get("Sec-CH-UA-Mobile") == "?1" && env.Device != "tablet" {
+		env.Device = "mobile"
+	}
+
+	// Brands fill in browsers whose User-Agent was not recognized
+	if env.Browser == "" {
+		for _, m := range clientHintBrand.FindAllStringSubmatch(header.Get("Sec-CH-UA"), -1) {
+			if strings.Contains(m[1], "Brand") || m[1] == "Chromium" {
+				continue
+			}
+			env.Browser = strings.TrimPrefix(m[1], "Google ")
+			env.BrowserVersion = m[2]
+			break
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// TicketStatusCoalesced is the status of the ticket response of a report
+// added to the open ticket of the same failure in high-volume mode
+const TicketStatusCoalesced = "coalesced"
+
+// occurrencesCollection holds the reports coalesced into existing tickets
+const occurrencesCollection = "report_occurrences"
+
+// coalesceBatchSize is the number of buffered occurrences that triggers a
+// flush before the flush interval ends
+const coalesceBatchSize = 500
+
+// coalesceFlushTimeout bounds the writes and comments of a flush
+const coalesceFlushTimeout = 30 * time.Second
+
+// ReportOccurrence is a report counted towards an existing ticket instead of
+// getting its own
+type ReportOccurrence struct {
+	TicketID    string    `bson:"ticket_id"`
+	Fingerprint string    `bson:"fingerprint"`
+	RequestID   string    `bson:"request_id,omitempty"`
+	UserEmail   string    `bson:"user_email,omitempty"`
+	PageURL     string    `bson:"page_url,omitempty"`
+	At          time.Time `bson:"at"`
+}
+
+// InsertReportOccurrences stores occurrences with a single unordered bulk
+// insert and counts them on their tickets with a single bulk update
+func (s *MongoDBService) InsertReportOccurrences(ctx context.Context, occurrences []ReportOccurrence) error {
+	if len(occurrences) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(occurrences))
+	counts := make(map[string]int)
+	for i, occurrence := range occurrences {
+		docs[i] = occurrence
+		counts[occurrence.TicketID]++
+	}
+	if _, err := s.database.Collection(occurrencesCollection).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to insert report occurrences: %w", err)
+	}
+
+	updates := make([]mongo.WriteModel, 0, len(counts))
+	for ticketID, count := range counts {
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"ticket_id": ticketID}).
+			SetUpdate(bson.M{"$inc": bson.M{"occurrences": count}, "$currentDate": ticketUpdatedAt}))
+	}
+	if _, err := s.collection.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to count report occurrences: %w", err)
+	}
+	return nil
+}
+
+// ReportCoalescer keeps incident storms from opening a ticket per report:
+// reports with the fingerprint of a ticket opened within the window are
+// added to that ticket instead. Their occurrences are buffered and, every
+// flush interval, written to MongoDB in bulk and summed up in one comment
+// per ticket, e.g. "42 more occurrences in the last 5 minutes".
+type ReportCoalescer struct {
+	trackers      *JiraRegistry
+	mongoService  *MongoDBService
+	window        time.Duration
+	flushInterval time.Duration
+	logger        *zap.Logger
+
+	mu      sync.Mutex
+	tickets map[string]*coalescedTicket
+	pending []ReportOccurrence
+	full    chan struct{}
+}
+
+// coalescedTicket is the ticket reports with a fingerprint are added to,
+// and the number of reports added since the last flush
+type coalescedTicket struct {
+	response  models.TicketResponse
+	createdAt time.Time
+	added     int
+}
+
+// NewReportCoalescer creates a coalescer adding reports to tickets opened
+// within window, flushed every flushInterval. MongoDB may be nil, in which
+// case occurrences are only commented.
+func NewReportCoalescer(trackers *JiraRegistry, mongoService *MongoDBService, window, flushInterval time.Duration, log *zap.Logger) *ReportCoalescer {
+	return &ReportCoalescer{
+		trackers:      trackers,
+		mongoService:  mongoService,
+		window:        window,
+		flushInterval: flushInterval,
+		logger:        log,
+		tickets:       make(map[string]*coalescedTicket),
+		full:          make(chan struct{}, 1),
+	}
+}
+
+// Coalesce adds a report to the ticket of its fingerprint and returns that
+// ticket with TicketStatusCoalesced, or nil when the report needs a ticket
+// of its own
+func (c *ReportCoalescer) Coalesce(ctx context.Context, req *models.TicketRequest) *models.TicketResponse {
+	fingerprint := ReportFingerprint(req)
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ticket := c.tickets[fingerprint]
+	if ticket == nil || now.Sub(ticket.createdAt) > c.window {
+		return nil
+	}
+	ticket.added++
+	userEmail, _ := req.Payload["userEmail"].(string)
+	c.pending = append(c.pending, ReportOccurrence{
+		TicketID:    ticket.response.TicketID,
+		Fingerprint: fingerprint,
+		RequestID:   logger.RequestID(ctx),
+		UserEmail:   userEmail,
+		PageURL:     req.URL,
+		At:          now,
+	})
+	if len(c.pending) >= coalesceBatchSize {
+		select {
+		case c.full <- struct{}{}:
+		default:
+		}
+	}
+	reportsCoalescedTotal.Inc()
+
+	response := ticket.response
+	response.Status = TicketStatusCoalesced
+	return &response
+}
+
+// Track makes a new ticket the one later reports with its fingerprint are
+// added to
+func (c *ReportCoalescer) Track(req *models.TicketRequest, ticket *models.TicketResponse) {
+	tracked := &coalescedTicket{response: *ticket, createdAt: time.Now()}
+	tracked.response.SimilarTickets = nil
+	tracked.response.StatusURL = ""
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tickets[ReportFingerprint(req)] = tracked
+}
+
+// Run flushes occurrences every flush interval, or sooner when many are
+// buffered, until stopping is closed. What is buffered then is left to
+// Flush, which runs once reports are no longer processed.
+func (c *ReportCoalescer) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		case <-c.full:
+		}
+		if err := c.Flush(ctx); err != nil {
+			c.logger.Error("Failed to store coalesced reports", zap.Error(err))
+		}
+	}
+}
+
+// Flush writes the buffered occurrences and comments the number added to
+// each ticket since the last flush. Comments that fail are logged, as the
+// occurrences are stored either way.
+func (c *ReportCoalescer) Flush(ctx context.Context) error {
+	now := time.Now()
+	c.mu.Lock()
+	occurrences := c.pending
+	c.pending = nil
+	added := make(map[string]int)
+	for fingerprint, ticket := range c.tickets {
+		if ticket.added > 0 {
+			added[ticket.response.TicketID] += ticket.added
+			ticket.added = 0
+		}
+		if now.Sub(ticket.createdAt) > c.window {
+			delete(c.tickets, fingerprint)
+		}
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, coalesceFlushTimeout)
+	defer cancel()
+
+	var err error
+	if c.mongoService != nil {
+		err = c.mongoService.InsertReportOccurrences(ctx, occurrences)
+	}
+	for ticketID, count := range added {
+		body := fmt.Sprintf("%d more %s in the last %s", count, pluralize(count, "occurrence", "occurrences"), humanDuration(c.flushInterval))
+		commentErr := c.trackers.AddComment(ctx, ticketID, "ronnin", body)
+		if commentErr != nil && !errors.Is(commentErr, errCollectorUnsupported) {
+			c.logger.Warn("Failed to comment coalesced reports", zap.String("ticket_id", ticketID), zap.Int("reports", count), zap.Error(commentErr))
+		}
+	}
+	if len(added) > 0 {
+		c.logger.Info("Flushed coalesced reports", zap.Int("reports", len(occurrences)), zap.Int("tickets", len(added)))
+	}
+	return err
+}
+
+// ReportFingerprint identifies the failure a report is about: its product
+// and the endpoints of its failed network calls, with IDs in their paths
+// replaced, or its issue with digits replaced when it has none
+func ReportFingerprint(req *models.TicketRequest) string {
+	product, _ := req.Payload["product"].(string)
+	var parts []string
+	for _, endpoint := range failedEndpoints(req.Payload["failedNetworkCalls"]) {
+		parts = append(parts, strings.ToUpper(endpoint.method)+" "+endpointPattern(endpoint.path))
+	}
+	if len(parts) == 0 {
+		issue, _ := req.Payload["issue"].(string)
+		parts = append(parts, strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return '#'
+			}
+			return unicode.ToLower(r)
+		}, issue)), " "))
+	}
+	sort.Strings(parts)
+
+	sum := sha256.Sum256([]byte(strings.ToLower(product) + "\x00" + strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func pluralize(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// humanDuration spells out whole hours, minutes and seconds, e.g.
+// "5 minutes"; other durations are formatted by Go
+func humanDuration(d time.Duration) string {
+	for _, unit := range []struct {
+		size      time.Duration
+		one, many string
+	}{
+		{time.Hour, "hour", "hours"},
+		{time.Minute, "minute", "minutes"},
+		{time.Second, "second", "seconds"},
+	} {
+		if d >= unit.size && d%unit.size == 0 {
+			n := int(d / unit.size)
+			if n == 1 {
+				return unit.one
+			}
+			return fmt.Sprintf("%d %s", n, unit.many)
+		}
+	}
+	return d.String()
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// TrackerCollector is the kind of the tracker keeping reports in MongoDB
+// when no issue tracker is configured
+const TrackerCollector = "collector"
+
+// CollectorInstance is the name the collector is registered under once an
+// issue tracker is the default, so collected tickets can still be looked up
+// and exported
+const CollectorInstance = "collector"
+
+// countersCollection holds the sequences ticket numbers are drawn from
+const countersCollection = "counters"
+
+// Status and resolution of collected tickets exported to an issue tracker
+const collectorExported = "exported"
+
+// errCollectorUnsupported is returned for changes only an issue tracker can
+// make
+var errCollectorUnsupported = errors.New("not supported for collected reports, which have no issue tracker")
+
+// CollectorTracker is an issue tracker without a tracker: tickets are only
+// stored in MongoDB, numbered per project key, e.g. RPT-42. It lets ronnin
+// run as a report collector, and its tickets can be exported once an issue
+// tracker is configured.
+type CollectorTracker struct {
+	projectKey   string
+	mongoService *MongoDBService
+	roster       atomic.Pointer[Roster] // replaced when the configuration is reloaded
+	redactor     *Redactor
+	logger       *zap.Logger
+}
+
+// NewCollectorTracker creates the collector of tickets numbered under
+// projectKey, which needs MongoDB
+func NewCollectorTracker(projectKey string, roster *Roster, mongoService *MongoDBService) *CollectorTracker {
+	t := &CollectorTracker{
+		projectKey:   projectKey,
+		mongoService: mongoService,
+		logger:       zap.NewNop(),
+	}
+	t.SetRoster(roster)
+	return t
+}
+
+// NextTicketNumber returns the next number of the sequence of name,
+// starting at 1
+func (s *MongoDBService) NextTicketNumber(ctx context.Context, name string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := s.database.Collection(countersCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to number ticket: %w", err)
+	}
+	return counter.Seq, nil
+}
+
+// GetTicketsByJiraIDs returns the stored tickets with the given IDs by ID;
+// IDs without a ticket are left out
+func (s *MongoDBService) GetTicketsByJiraIDs(ctx context.Context, jiraIDs []string) (map[string]*FlattenedTicket, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"ticket_id": bson.M{"$in": jiraIDs}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tickets: %w", err)
+	}
+	var tickets []*FlattenedTicket
+	if err := cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+	byID := make(map[string]*FlattenedTicket, len(tickets))
+	for _, ticket := range tickets {
+		byID[ticket.TicketID] = ticket
+	}
+	return byID, nil
+}
+
+// GetUnexportedTickets returns up to limit collected tickets of projectKey
+// not exported yet, oldest first
+func (s *MongoDBService) GetUnexportedTickets(ctx context.Context, projectKey string, limit int64) ([]FlattenedTicket, error) {
+	filter := bson.M{
+		"ticket_id":   bson.M{"$regex": "^" + regexp.QuoteMeta(projectKey) + "-"},
+		"exported_to": bson.M{"$exists": false},
+		"archived_at": bson.M{"$exists": false},
+	}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unexported tickets: %w", err)
+	}
+	var tickets []FlattenedTicket
+	if err := cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode unexported tickets: %w", err)
+	}
+	return tickets, nil
+}
+
+// MarkTicketExported records that a collected ticket was exported as the
+// ticket exportedTo of an issue tracker, which resolves it
+func (s *MongoDBService) MarkTicketExported(ctx context.Context, jiraID, exportedTo, link string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"ticket_id": jiraID},
+		bson.M{
+			"$set": bson.M{
+				"exported_to": exportedTo,
+				"jira_link":   link,
+				"status":      collectorExported,
+				"resolution":  collectorExported,
+			},
+			"$currentDate": ticketUpdatedAt,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark ticket exported: %w", err)
+	}
+	return nil
+}
+
+// CreateTicket numbers a ticket for a report, assigned to the support team
+// member on shift, and stores it. Unlike other trackers, the ticket fails
+// when it cannot be stored, since MongoDB is its only copy.
+func (t *CollectorTracker) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
+	// Nothing sensitive is stored
+	req = t.redactor.Ticket(req)
+	log := logger.FromContext(ctx, t.logger).With(zap.String("project", t.projectKey))
+
+	start := time.Now()
+	number, err := t.mongoService.NextTicketNumber(ctx, "ticket:"+t.projectKey)
+	if err != nil {
+		return nil, err
+	}
+	product, _ := req.Payload["product"].(string)
+	ticket := &models.TicketResponse{
+		TicketID:   fmt.Sprintf("%s-%d", t.projectKey, number),
+		Status:     "created",
+		AssignedTo: t.roster.Load().Assignee(ctx, product, time.Now()),
+	}
+	if _, err := t.mongoService.SaveTicket(ctx, flattenTicket(ctx, req, ticket, time.Since(start))); err != nil {
+		return nil, err
+	}
+
+	ticketsCreatedTotal.WithLabelValues(t.projectKey).Inc()
+	log.Info("Collected report", zap.String("ticket_id", ticket.TicketID), zap.String("assigned_to", ticket.AssignedTo))
+	return ticket, nil
+}
+
+// IsTicketOpen reports whether a ticket is unresolved, i.e. not exported
+func (t *CollectorTracker) IsTicketOpen(ctx context.Context, ticketID string) (bool, error) {
+	ticket, err := t.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		return false, err
+	}
+	return ticket.Resolution == "", nil
+}
+
+// GetTicketState returns the stored state of a ticket
+func (t *CollectorTracker) GetTicketState(ctx context.Context, ticketID string) (*TicketState, error) {
+	ticket, err := t.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	return collectedState(ticket), nil
+}
+
+// GetTicketStates returns the stored states of several tickets
+func (t *CollectorTracker) GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error) {
+	tickets, err := t.mongoService.GetTicketsByJiraIDs(ctx, ticketIDs)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]*TicketState, len(tickets))
+	for id, ticket := range tickets {
+		states[id] = collectedState(ticket)
+	}
+	return states, nil
+}
+
+func collectedState(ticket *FlattenedTicket) *TicketState {
+	return &TicketState{Status: ticket.Status, AssignedTo: ticket.AssignedTo, Resolution: ticket.Resolution}
+}
+
+// AssignTicket stores the new assignee of a ticket
+func (t *CollectorTracker) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	ticket, err := t.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	state := collectedState(ticket)
+	state.AssignedTo = accountID
+	return t.mongoService.UpdateTicketState(ctx, ticketID, state, time.Now())
+}
+
+// AddComment is not supported, as collected tickets have no discussion
+func (t *CollectorTracker) AddComment(ctx context.Context, ticketID, author, body string) error {
+	return fmt.Errorf("failed to comment on %s: %w", ticketID, errCollectorUnsupported)
+}
+
+// ReplaceDescriptionText is a no-op, as collected tickets have no rendered
+// description
+func (t *CollectorTracker) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	return nil
+}
+
+// ReleaseScreenshot is a no-op; the stored ticket links the released
+// screenshot once the quarantine updates it
+func (t *CollectorTracker) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return nil
+}
+
+// RemoveScreenshot is a no-op, like ReleaseScreenshot
+func (t *CollectorTracker) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return nil
+}
+
+// Ping checks MongoDB, where tickets are kept
+func (t *CollectorTracker) Ping(ctx context.Context) error {
+	return t.mongoService.Ping(ctx)
+}
+
+// Kind returns TrackerCollector
+func (t *CollectorTracker) Kind() string {
+	return TrackerCollector
+}
+
+// ProjectKey returns the key tickets are numbered under
+func (t *CollectorTracker) ProjectKey() string {
+	return t.projectKey
+}
+
+// SetRoster replaces the support roster tickets are assigned from
+func (t *CollectorTracker) SetRoster(roster *Roster) {
+	t.roster.Store(roster)
+}
+
+// SetRedactor sets the redactor applied to new tickets
+func (t *CollectorTracker) SetRedactor(redactor *Redactor) {
+	t.redactor = redactor
+}
+
+// SetLogger sets the logger collected reports are logged to
+func (t *CollectorTracker) SetLogger(log *zap.Logger) {
+	t.logger = log
+}
+
+// Cleanup does nothing, as the collector holds no connections of its own
+func (t *CollectorTracker) Cleanup() error {
+	return nil
+}
+
+// collectorExportBatch is the number of collected tickets exported per run
+const collectorExportBatch = 100
+
+// CollectorExporter files the tickets collected while no issue tracker was
+// configured in the trackers their products are routed to now, on the
+// leader only. Each collected ticket links the ticket it was exported as.
+type CollectorExporter struct {
+	projectKey   string
+	jiraService  *JiraRegistry
+	mongoService *MongoDBService
+	coordinator  *Coordinator
+	logger       *zap.Logger
+	interval     time.Duration
+}
+
+// NewCollectorExporter creates the export of the tickets collected under
+// projectKey, run every interval
+func NewCollectorExporter(projectKey string, js *JiraRegistry, ms *MongoDBService, log *zap.Logger, interval time.Duration) *CollectorExporter {
+	return &CollectorExporter{
+		projectKey:   projectKey,
+		jiraService:  js,
+		mongoService: ms,
+		logger:       log,
+		interval:     interval,
+	}
+}
+
+// SetCoordinator runs the export only while this instance is the leader
+func (e *CollectorExporter) SetCoordinator(coordinator *Coordinator) {
+	e.coordinator = coordinator
+}
+
+// Run exports collected tickets on start and then periodically until
+// stopping is closed, letting a run in progress finish with ctx
+func (e *CollectorExporter) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	if e.coordinator.IsLeader() {
+		e.RunOnce(ctx)
+	}
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+			if e.coordinator.IsLeader() {
+				e.RunOnce(ctx)
+			}
+		}
+	}
+}
+
+// RunOnce exports a batch of collected tickets, stopping at the first
+// failure so that a tracker outage is retried on the next run
+func (e *CollectorExporter) RunOnce(ctx context.Context) {
+	tickets, err := e.mongoService.GetUnexportedTickets(ctx, e.projectKey, collectorExportBatch)
+	if err != nil {
+		e.logger.Error("Failed to list collected tickets", zap.Error(err))
+		return
+	}
+
+	exported := 0
+	for i := range tickets {
+		collected := &tickets[i]
+		if e.jiraService.ForProduct(collected.Product).Kind() == TrackerCollector {
+			// The product is still collected rather than tracked
+			continue
+		}
+		ticket, err := e.jiraService.CreateTicket(ctx, collectedRequest(collected))
+		if err != nil {
+			e.logger.Warn("Failed to export collected ticket, retrying on the next run",
+				zap.String("ticket_id", collected.TicketID), zap.Error(err))
+			break
+		}
+		if err := e.mongoService.MarkTicketExported(ctx, collected.TicketID, ticket.TicketID, ticket.JiraLink); err != nil {
+			e.logger.Error("Failed to mark collected ticket exported",
+				zap.String("ticket_id", collected.TicketID), zap.String("exported_to", ticket.TicketID), zap.Error(err))
+			break
+		}
+		exported++
+	}
+	if exported > 0 {
+		e.logger.Info("Exported collected tickets", zap.Int("exported", exported), zap.Int("batch", len(tickets)))
+	}
+}
+
+// collectedRequest rebuilds the ticket request of a collected ticket
+func collectedRequest(ticket *FlattenedTicket) *models.TicketRequest {
+	req := &models.TicketRequest{
+		URL:               ticket.PageURL,
+		ImageS3URL:        ticket.ImageURL,
+		ImageS3Key:        ticket.ImageKey,
+		ImageURLExpiresAt: ticket.ImageURLExpiresAt,
+		ImageContentType:  ticket.ImageContentType,
+		QuarantineKey:     ticket.QuarantineKey,
+		Video:             ticket.Video,
+	}
+	json.Unmarshal([]byte(ticket.PayloadJSON), &req.Payload)
+	json.Unmarshal([]byte(ticket.ResponseJSON), &req.Response)
+	json.Unmarshal([]byte(ticket.RequestHeadersJSON), &req.RequestHeaders)
+	if req.Payload == nil {
+		req.Payload = map[string]interface{}{
+			"issue":       ticket.Issue,
+			"description": ticket.Description,
+			"product":     ticket.Product,
+		}
+	}
+	// The description links the collected ticket, whose ID the reporter got
+	if description, _ := req.Payload["description"].(string); !strings.Contains(description, ticket.TicketID) {
+		req.Payload["description"] = strings.TrimSpace(description + "\n\nCollected as " + ticket.TicketID + " on " + ticket.CreatedAt.UTC().Format(time.RFC1123))
+	}
+	return req
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// confluencePageTTL is how long the title and link of a page are cached
+const confluencePageTTL = time.Hour
+
+// ConfluencePage is a Confluence page with its title and browser link
+type ConfluencePage struct {
+	Title string
+	URL   string
+}
+
+// ConfluenceClient looks up Confluence pages through the REST API of a
+// Confluence Cloud or Data Center site, authenticating with an API token or
+// personal access token as basic auth password. Pages are cached for an
+// hour.
+type ConfluenceClient struct {
+	baseURL  string
+	username string
+	apiToken string
+	client   *http.Client
+
+	mu    sync.Mutex
+	pages map[string]cachedConfluencePage
+}
+
+type cachedConfluencePage struct {
+	page      ConfluencePage
+	fetchedAt time.Time
+}
+
+// NewConfluenceClient creates a client of the site at baseURL, e.g.
+// https://your-domain.atlassian.net/wiki
+func NewConfluenceClient(baseURL, username, apiToken string) *ConfluenceClient {
+	return &ConfluenceClient{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		apiToken: apiToken,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		pages:    make(map[string]cachedConfluencePage),
+	}
+}
+
+// PageURL returns the link of a page that does not depend on its title
+func (c *ConfluenceClient) PageURL(pageID string) string {
+	return c.baseURL + "/pages/viewpage.action?pageId=" + url.QueryEscape(pageID)
+}
+
+// Page returns the title and browser link of a page
+func (c *ConfluenceClient) Page(ctx context.Context, pageID string) (ConfluencePage, error) {
+	c.mu.Lock()
+	cached, ok := c.pages[pageID]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < confluencePageTTL {
+		return cached.page, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/rest/api/content/"+url.PathEscape(pageID), nil)
+	if err != nil {
+		return ConfluencePage{}, fmt.Errorf("failed to create Confluence request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiToken != "" {
+		req.SetBasicAuth(c.username, c.apiToken)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return ConfluencePage{}, fmt.Errorf("failed to get Confluence page %s: %w", pageID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ConfluencePage{}, fmt.Errorf("failed to get Confluence page %s: %s", pageID, resp.Status)
+	}
+
+	var content struct {
+		Title string `json:"title"`
+		Links struct {
+			Base  string `json:"base"`
+			WebUI string `json:"webui"`
+		} `json:"_links"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&content); err != nil {
+		return ConfluencePage{}, fmt.Errorf("failed to decode Confluence page %s: %w", pageID, err)
+	}
+
+	page := ConfluencePage{Title: content.Title, URL: c.PageURL(pageID)}
+	if content.Links.Base != "" && content.Links.WebUI != "" {
+		page.URL = content.Links.Base + content.Links.WebUI
+	}
+	c.mu.Lock()
+	c.pages[pageID] = cachedConfluencePage{page: page, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return page, nil
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// leasesCollection is the collection the leases of the leader and of
+// distributed locks are stored in
+const leasesCollection = "leases"
+
+// leaderLease is the name of the lease held by the leader
+const leaderLease = "leader"
+
+// leaseReleaseTimeout bounds releasing a lease, which may happen on shutdown
+const leaseReleaseTimeout = 5 * time.Second
+
+// Lease is a claim of an instance on a name that expires unless renewed
+type Lease struct {
+	Name      string    `bson:"_id"`
+	Holder    string    `bson:"holder"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// AcquireLease claims the lease of name for holder until ttl from now,
+// renewing it when holder already has it. It returns false when another
+// holder has a lease that has not expired.
+func (s *MongoDBService) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"holder": holder},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"holder": holder, "expires_at": now.Add(ttl)}}
+	_, err := s.database.Collection(leasesCollection).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// The lease exists and is held by another instance
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// ReleaseLease gives up the lease of name if holder has it
+func (s *MongoDBService) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.database.Collection(leasesCollection).DeleteOne(ctx, bson.M{"_id": name, "holder": holder})
+	if err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", name, err)
+	}
+	return nil
+}
+
+// GetLease returns the lease of name, or nil when nobody holds it
+func (s *MongoDBService) GetLease(ctx context.Context, name string) (*Lease, error) {
+	var lease Lease
+	err := s.database.Collection(leasesCollection).FindOne(ctx, bson.M{"_id": name, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&lease)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lease %s: %w", name, err)
+	}
+	return &lease, nil
+}
+
+// Coordinator lets the replicas sharing a MongoDB database elect a leader,
+// which alone runs scheduled jobs, and take distributed locks. Both are
+// leases that expire after ttl unless renewed, every third of ttl, so the
+// leadership or a lock passes on within ttl of an instance dying. A nil
+// Coordinator stands for a single instance: it is always the leader and
+// gets every lock.
+type Coordinator struct {
+	mongoService *MongoDBService
+	instanceID   string
+	ttl          time.Duration
+	logger       *zap.Logger
+
+	// leaderUntil is when the leadership of this instance ends unless
+	// renewed, in Unix nanoseconds
+	leaderUntil atomic.Int64
+}
+
+// NewCoordinator creates the coordinator of an instance identified by
+// instanceID, or by its host name and a random suffix when it is empty
+func NewCoordinator(mongoService *MongoDBService, instanceID string, ttl time.Duration, log *zap.Logger) *Coordinator {
+	if instanceID == "" {
+		host, _ := os.Hostname()
+		instanceID = fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+	}
+	return &Coordinator{
+		mongoService: mongoService,
+		instanceID:   instanceID,
+		ttl:          ttl,
+		logger:       log.With(zap.String("instance", instanceID)),
+	}
+}
+
+// InstanceID identifies this instance in leases
+func (c *Coordinator) InstanceID() string {
+	return c.instanceID
+}
+
+// IsLeader reports whether this instance is the leader. The leadership is
+// given up locally once its lease may have expired, even when it could not
+// be renewed.
+func (c *Coordinator) IsLeader() bool {
+	if c == nil {
+		return true
+	}
+	return time.Now().UnixNano() < c.leaderUntil.Load()
+}
+
+// Leader returns the instance ID of the leader, empty when there is none
+func (c *Coordinator) Leader(ctx context.Context) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+	lease, err := c.mongoService.GetLease(ctx, leaderLease)
+	if err != nil || lease == nil {
+		return "", err
+	}
+	return lease.Holder, nil
+}
+
+// Campaign acquires or renews the leadership of this instance
+func (c *Coordinator) Campaign(ctx context.Context) {
+	wasLeader := c.IsLeader()
+	start := time.Now()
+	ok, err := c.mongoService.AcquireLease(ctx, leaderLease, c.instanceID, c.ttl)
+	if err != nil {
+		c.logger.Warn("Failed to campaign for leadership", zap.Error(err))
+	} else if ok {
+		c.leaderUntil.Store(start.Add(c.ttl).UnixNano())
+	} else {
+		c.leaderUntil.Store(0)
+	}
+
+	switch isLeader := c.IsLeader(); {
+	case isLeader && !wasLeader:
+		c.logger.Info("Elected leader, scheduled jobs run on this instance")
+		leaderGauge.Set(1)
+	case !isLeader && wasLeader:
+		c.logger.Warn("Lost leadership, scheduled jobs stop on this instance")
+		leaderGauge.Set(0)
+	}
+}
+
+// Run campaigns for the leadership until stopping is closed, then gives it
+// up so another instance takes over without waiting for the lease to expire
+func (c *Coordinator) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(c.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopping:
+			c.resign()
+			return
+		case <-ticker.C:
+			c.Campaign(ctx)
+		}
+	}
+}
+
+func (c *Coordinator) resign() {
+	if !c.IsLeader() {
+		return
+	}
+	c.leaderUntil.Store(0)
+	leaderGauge.Set(0)
+	ctx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+	defer cancel()
+	if err := c.mongoService.ReleaseLease(ctx, leaderLease, c.instanceID); err != nil {
+		c.logger.Warn("Failed to give up leadership", zap.Error(err))
+		return
+	}
+	c.logger.Info("Gave up leadership")
+}
+
+// TryLock takes the distributed lock of name, renewing it until unlock is
+// called. It returns false when another instance holds the lock.
+func (c *Coordinator) TryLock(ctx context.Context, name string) (unlock func(), ok bool, err error) {
+	if c == nil {
+		return func() {}, true, nil
+	}
+	lease := "lock:" + name
+	ok, err = c.mongoService.AcquireLease(ctx, lease, c.instanceID, c.ttl)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(c.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				renewCtx, cancel := context.WithTimeout(context.Background(), c.ttl/3)
+				if _, err := c.mongoService.AcquireLease(renewCtx, lease, c.instanceID, c.ttl); err != nil {
+					c.logger.Warn("Failed to renew lock", zap.String("lock", name), zap.Error(err))
+				}
+				cancel()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		releaseCtx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+		defer cancel()
+		if err := c.mongoService.ReleaseLease(releaseCtx, lease, c.instanceID); err != nil {
+			c.logger.Warn("Failed to release lock", zap.String("lock", name), zap.Error(err))
+		}
+	}, true, nil
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.uber.org/zap"
+)
+
+// Sources of the deploys listed in new tickets
+const (
+	DeploySourceNone   = "none"
+	DeploySourceAPI    = "api"
+	DeploySourceGitHub = "github"
+)
+
+// Limits of the deploy lookup of a ticket
+const (
+	deploysTimeout = 5 * time.Second
+	maxDeploys     = 10
+)
+
+// DeploySource lists the deploys of a product since a time
+type DeploySource interface {
+	RecentDeploys(ctx context.Context, product string, since time.Time) ([]models.Deploy, error)
+}
+
+// Deploys lists the recent deploys of the product of new tickets, so that
+// triagers can correlate reports with releases
+type Deploys struct {
+	source DeploySource
+	window time.Duration
+	logger *zap.Logger
+}
+
+// NewDeploys creates the lookup of the deploys of the window before a
+// ticket is created
+func NewDeploys(source DeploySource, window time.Duration, log *zap.Logger) *Deploys {
+	return &Deploys{source: source, window: window, logger: log}
+}
+
+// Recent returns up to 10 deploys of the product of a ticket, newest first.
+// A failed lookup is logged and lists none, rather than holding up the
+// ticket.
+func (d *Deploys) Recent(ctx context.Context, req *models.TicketRequest) []models.Deploy {
+	product, _ := req.Payload["product"].(string)
+	ctx, cancel := context.WithTimeout(ctx, deploysTimeout)
+	defer cancel()
+
+	deploys, err := d.source.RecentDeploys(ctx, product, time.Now().Add(-d.window))
+	if err != nil {
+		d.logger.Warn("Failed to look up recent deploys", zap.String("product", product), zap.Error(err))
+		return nil
+	}
+	sort.SliceStable(deploys, func(i, j int) bool { return deploys[i].DeployedAt.After(deploys[j].DeployedAt) })
+	if len(deploys) > maxDeploys {
+		deploys = deploys[:maxDeploys]
+	}
+	return deploys
+}
+
+// DeployAPI reads deploys from a deploy metadata API, which answers
+// GET <url>?product=<product>&since=<RFC 3339 time> with a JSON array of
+// deploys
+type DeployAPI struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewDeployAPI creates a source of the deploy metadata API at apiURL,
+// authenticated with token as Bearer token when it is not empty
+func NewDeployAPI(apiURL, token string) *DeployAPI {
+	return &DeployAPI{url: apiURL, token: token, client: &http.Client{Timeout: deploysTimeout}}
+}
+
+// RecentDeploys lists the deploys the API returns for a product
+func (a *DeployAPI) RecentDeploys(ctx context.Context, product string, since time.Time) ([]models.Deploy, error) {
+	u, err := url.Parse(a.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deploy API URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("product", product)
+	query.Set("since", since.UTC().Format(time.RFC3339))
+	u.RawQuery = query.Encode()
+
+	var deploys []models.Deploy
+	if err := getDeployJSON(ctx, a.client, u.String(), a.token, &deploys); err != nil {
+		return nil, err
+	}
+	recent := deploys[:0]
+	for _, deploy := range deploys {
+		if !deploy.DeployedAt.Before(since) {
+			recent = append(recent, deploy)
+		}
+	}
+	return recent, nil
+}
+
+// GitHubDeployments reads deploys from the deployments of the GitHub
+// repository of each product to an environment
+type GitHubDeployments struct {
+	apiURL       string
+	token        string
+	repositories map[string]string // owner/name by product
+	environment  string
+	client       *http.Client
+}
+
+// NewGitHubDeployments creates a source of the deployments to environment of
+// the repositories of products. An empty apiURL is github.com.
+func NewGitHubDeployments(apiURL, token string, repositories map[string]string, environment string) *GitHubDeployments {
+	if apiURL == "" {
+		apiURL = DefaultGitHubAPIURL
+	}
+	return &GitHubDeployments{
+		apiURL:       strings.TrimSuffix(apiURL, "/"),
+		token:        token,
+		repositories: repositories,
+		environment:  environment,
+		client:       &http.Client{Timeout: deploysTimeout},
+	}
+}
+
+// RecentDeploys lists the deployments of the repository of a product;
+// products without a repository have none
+func (g *GitHubDeployments) RecentDeploys(ctx context.Context, product string, since time.Time) ([]models.Deploy, error) {
+	repository := g.repositories[product]
+	if repository == "" {
+		return nil, nil
+	}
+
+	query := url.Values{"per_page": {"30"}}
+	if g.environment != "" {
+		query.Set("environment", g.environment)
+	}
+	var deployments []struct {
+		SHA         string    `json:"sha"`
+		Ref         string    `json:"ref"`
+		Environment string    `json:"environment"`
+		Description string    `json:"description"`
+		CreatedAt   time.Time `json:"created_at"`
+		Creator     *struct {
+			Login string `json:"login"`
+		} `json:"creator"`
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/deployments?%s", g.apiURL, repository, query.Encode())
+	if err := getDeployJSON(ctx, g.client, endpoint, g.token, &deployments); err != nil {
+		return nil, err
+	}
+
+	var deploys []models.Deploy
+	for _, deployment := range deployments {
+		// Deployments are listed newest first
+		if deployment.CreatedAt.Before(since) {
+			break
+		}
+		deploy := models.Deploy{
+			Service:     repository,
+			Version:     deployment.Ref,
+			Environment: deployment.Environment,
+			Commit:      deployment.SHA,
+			Description: deployment.Description,
+			URL:         fmt.Sprintf("%s/%s/commit/%s", g.webURL(), repository, deployment.SHA),
+			DeployedAt:  deployment.CreatedAt,
+		}
+		if deployment.Creator != nil {
+			deploy.Author = deployment.Creator.Login
+		}
+		deploys = append(deploys, deploy)
+	}
+	return deploys, nil
+}
+
+// webURL returns the address of the GitHub web interface
+func (g *GitHubDeployments) webURL() string {
+	if g.apiURL == DefaultGitHubAPIURL {
+		return "https://github.com"
+	}
+	return strings.TrimSuffix(g.apiURL, "/api/v3")
+}
+
+// getDeployJSON decodes the JSON answer of a deploy lookup into out,
+// authenticating with token as Bearer token when it is not empty
+func getDeployJSON(ctx context.Context, client *http.Client, endpoint, token string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create deploy request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get deploys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("deploy lookup answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode deploys: %w", err)
+	}
+	return nil
+}
+
+// deploySummary describes a deploy on one line, without its link
+func deploySummary(deploy models.Deploy) string {
+	var b strings.Builder
+	b.WriteString(deploy.DeployedAt.UTC().Format("2006-01-02 15:04 MST"))
+	if deploy.Service != "" {
+		b.WriteString(" ")
+		b.WriteString(deploy.Service)
+	}
+	if deploy.Version != "" {
+		b.WriteString(" ")
+		b.WriteString(deploy.Version)
+	}
+	if deploy.Commit != "" {
+		fmt.Fprintf(&b, " (%s)", shortCommit(deploy.Commit))
+	}
+	if deploy.Environment != "" {
+		fmt.Fprintf(&b, " to %s", deploy.Environment)
+	}
+	if deploy.Author != "" {
+		fmt.Fprintf(&b, " by %s", deploy.Author)
+	}
+	if deploy.Description != "" {
+		fmt.Fprintf(&b, ": %s", deploy.Description)
+	}
+	return b.String()
+}
+
+func shortCommit(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+)
+
+// descriptionRenderer writes the parts of a report's description in the
+// markup of a tracker other than Jira, whose descriptions are rendered by
+// ticketDescription: the Markdown dialect of GitHub, GitLab or Linear, or
+// plain text for trackers without markup. Each tracker passes its own to
+// renderDescription, which lays out the sections the same for all.
+type descriptionRenderer interface {
+	// heading renders a heading of level 2 or 3
+	heading(level int, title string) string
+	// item renders an item of a list, and field one with a label
+	item(text string) string
+	field(label, value string) string
+	link(title, url string) string
+	// codeBlock renders lines verbatim in a block, and inlineCode text
+	// verbatim within a line
+	codeBlock(lines []string) string
+	inlineCode(text string) string
+	// codeEnd closes a code block cut short
+	codeEnd() string
+	// note renders an aside, such as the expiry of a screenshot URL
+	note(text string) string
+	// details renders a technical detail as JSON, collapsed where the
+	// markup allows it
+	details(title, content string) string
+	// screenshot renders an inline screenshot, or a link to a screen
+	// recording
+	screenshot(imageURL, contentType string) string
+	// quarantined is shown in place of a quarantined screenshot
+	quarantined() string
+	// maxLength is the maximum length of a description or comment
+	maxLength() int
+}
+
+// renderDescription renders the description of a new ticket, with the
+// screenshot section rendered by renderScreenshot. The technical details
+// that do not fit the description are returned to be added as comments.
+func renderDescription(ctx context.Context, r descriptionRenderer, req *models.TicketRequest, screenshot string) (string, []string) {
+	var b strings.Builder
+	if req.Summary != nil {
+		b.WriteString(r.heading(3, "Generated Summary"))
+		for _, bullet := range req.Summary.Bullets {
+			b.WriteString(r.item(bullet))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%s%s\n\n", r.heading(2, "Issue Summary"), req.Payload["issue"])
+	if desc, ok := req.Payload["description"].(string); ok && desc != "" {
+		fmt.Fprintf(&b, "%s%s\n\n", r.heading(3, "Description"), desc)
+	}
+
+	var metadata strings.Builder
+	for _, field := range [][2]string{
+		{"User Email", "userEmail"},
+		{"Lead ID", "leadId"},
+		{"Product", "product"},
+		{"Severity", "severity"},
+	} {
+		if value, ok := req.Payload[field[1]].(string); ok && value != "" {
+			metadata.WriteString(r.field(field[0], value))
+		}
+	}
+	if req.Classification != nil {
+		if severity, _ := req.Payload["severity"].(string); severity == "" {
+			metadata.WriteString(r.field("Severity", req.Classification.Severity+" (predicted)"))
+		}
+		metadata.WriteString(r.field("Category", req.Classification.Category))
+	}
+	if pageURL, ok := req.Payload["url"].(string); ok && pageURL != "" {
+		metadata.WriteString(r.field("Page URL", pageURL))
+	} else if req.URL != "" {
+		metadata.WriteString(r.field("Page URL", req.URL))
+	}
+	if sdk, ok := req.Payload["sdk"].(string); ok && sdk != "" {
+		metadata.WriteString(r.field("SDK", sdk))
+	}
+	if requestID := logger.RequestID(ctx); requestID != "" {
+		metadata.WriteString(r.field("Request ID", requestID))
+	}
+	if metadata.Len() > 0 {
+		fmt.Fprintf(&b, "%s%s\n", r.heading(3, "User Information"), metadata.String())
+	}
+	if env := clientEnvironment(req.Payload["client"]); env != nil {
+		fmt.Fprintf(&b, "%s%s\n", r.heading(3, "Environment"), renderEnvironment(r, env))
+	}
+	if console := recentEntries(payloadList[models.ConsoleEntry](req.Payload["console"])); len(console) > 0 {
+		lines := make([]string, len(console))
+		for i, entry := range console {
+			lines[i] = consoleLine(entry)
+		}
+		fmt.Fprintf(&b, "%s%s\n", r.heading(3, "Console"), r.codeBlock(lines))
+	}
+	if crumbs := recentEntries(payloadList[models.Breadcrumb](req.Payload["breadcrumbs"])); len(crumbs) > 0 {
+		b.WriteString(r.heading(3, "Breadcrumbs"))
+		for _, crumb := range crumbs {
+			b.WriteString(r.item(breadcrumbLine(crumb)))
+		}
+		b.WriteString("\n")
+	}
+	if len(req.Runbooks) > 0 {
+		b.WriteString(r.heading(3, "Runbooks"))
+		for _, runbook := range req.Runbooks {
+			b.WriteString(r.item(r.link(runbook.Title, runbook.URL)))
+		}
+		b.WriteString("\n")
+	}
+	if len(req.Deploys) > 0 {
+		b.WriteString(r.heading(3, "Recent Deploys"))
+		for _, deploy := range req.Deploys {
+			line := deploySummary(deploy)
+			if deploy.URL != "" {
+				line = r.link(line, deploy.URL)
+			}
+			b.WriteString(r.item(line))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(screenshot)
+	fmt.Fprintf(&b, "Ticket created on: %s\n\n", time.Now().Format(time.RFC1123))
+
+	var sections []string
+	if networkCalls, ok := req.Payload["failedNetworkCalls"]; ok && networkCalls != nil {
+		sections = append(sections, r.details("Failed Network Calls", descriptionJSON(networkCalls)))
+	}
+	if len(req.RequestHeaders) > 0 {
+		sections = append(sections, r.details("Request Headers", descriptionJSON(req.RequestHeaders)))
+	}
+	if len(req.Response) > 0 {
+		sections = append(sections, r.details("Response", descriptionJSON(req.Response)))
+	}
+	sections = append(sections, r.details("Full Payload Data", descriptionJSON(req.Payload)))
+
+	limit := r.maxLength()
+	var overflow []string
+	for _, section := range sections {
+		if len(overflow) == 0 && b.Len()+len(section) <= limit {
+			b.WriteString(section)
+			continue
+		}
+		if len(section) > limit {
+			section = section[:limit-100] + "\n" + r.codeEnd() + "\n[Comment truncated due to the character limit]"
+		}
+		overflow = append(overflow, section)
+	}
+	return b.String(), overflow
+}
+
+// renderScreenshot renders the screenshot of a new ticket shown from
+// imageURL. Presigned URLs are noted to be re-signed while the ticket is open.
+func renderScreenshot(r descriptionRenderer, req *models.TicketRequest, imageURL string, presigned bool) string {
+	heading := r.heading(3, "Screenshot")
+	if IsVideoContentType(req.ImageContentType) {
+		heading = r.heading(3, "Screen Recording")
+	}
+	if req.QuarantineKey != "" {
+		return heading + r.quarantined() + "\n\n"
+	}
+	if !hasScreenshotURL(req) {
+		return ""
+	}
+	if !strings.HasPrefix(imageURL, "http") {
+		return heading + imageURL + "\n\n"
+	}
+
+	section := heading + r.screenshot(imageURL, req.ImageContentType) + "\n"
+	if req.Video != nil {
+		section += renderVideo(r, req.Video)
+	}
+	if presigned {
+		section += "\n" + r.note("This screenshot URL expires periodically and is re-signed automatically while the ticket is open.") + "\n"
+	}
+	return section + "\n"
+}
+
+// descriptionJSON renders a value as indented JSON; strings are taken as
+// JSON already
+func descriptionJSON(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// renderEnvironment renders the browser, device and locale of a reporter
+func renderEnvironment(r descriptionRenderer, env *models.ClientEnvironment) string {
+	var details strings.Builder
+	for _, field := range [][2]string{
+		{"Browser", strings.TrimSpace(env.Browser + " " + env.BrowserVersion)},
+		{"OS", strings.TrimSpace(env.OS + " " + env.OSVersion)},
+		{"Device", env.Device},
+		{"Screen", env.Screen},
+		{"Viewport", env.Viewport},
+		{"Locale", env.Locale},
+		{"Time Zone", env.Timezone},
+	} {
+		if field[1] != "" {
+			details.WriteString(r.field(field[0], field[1]))
+		}
+	}
+	if env.UserAgent != "" {
+		details.WriteString(r.field("User Agent", r.inlineCode(env.UserAgent)))
+	}
+	return details.String()
+}
+
+// renderVideo renders the duration and codec of a screen recording
+func renderVideo(r descriptionRenderer, video *models.VideoMetadata) string {
+	details := r.field("Format", video.Container)
+	if video.Codec != "" {
+		details += r.field("Codec", video.Codec)
+	}
+	if video.DurationSeconds > 0 {
+		duration := time.Duration(video.DurationSeconds * float64(time.Second)).Round(time.Second)
+		details += r.field("Duration", duration.String())
+	}
+	return details
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+)
+
+// describedTicketRequest is a report with every section a description can
+// have
+func describedTicketRequest() *models.TicketRequest {
+	req := benchmarkTicketRequest()
+	req.Summary = &models.ReportSummary{Title: "Payments fail", Bullets: []string{"Payments fail with 500"}}
+	req.Classification = &models.Classification{Severity: "high", Category: "api-failure"}
+	req.Runbooks = []models.RunbookLink{{Title: "Payments [runbook]", URL: "https://wiki.example.com/payments"}}
+	req.Deploys = []models.Deploy{{Service: "payments-api", Version: "1.42.0", URL: "https://ci.example.com/deploys/812"}}
+	req.ImageS3URL = "https://bucket.s3.amazonaws.com/screenshot.png?X-Amz-Signature=abc"
+	return req
+}
+
+var (
+	markdownHeading = regexp.MustCompile(`(?m)^#{2,3} (.+)$`)
+	markdownDetails = regexp.MustCompile(`<summary>(.+)</summary>`)
+	plainHeading    = regexp.MustCompile(`(?m)^(.+)\n[=-]+$`)
+)
+
+// sectionTitles returns the titles of the sections of a description, in
+// order
+func sectionTitles(pattern *regexp.Regexp, description string) []string {
+	var titles []string
+	for _, match := range pattern.FindAllStringSubmatch(description, -1) {
+		titles = append(titles, match[1])
+	}
+	return titles
+}
+
+func TestRenderersShareSections(t *testing.T) {
+	ctx := logger.WithRequestID(context.Background(), "5f0c6a9e-7d1b-4f7e-9c1a-2b3d4e5f6a7b")
+	req := describedTicketRequest()
+
+	markdown, overflow := renderDescription(ctx, githubMarkdown, req, renderScreenshot(githubMarkdown, req, req.ImageS3URL, true))
+	if len(overflow) > 0 {
+		t.Fatalf("Markdown overflowed into %d comments", len(overflow))
+	}
+	text, overflow := renderDescription(ctx, plaintext, req, renderScreenshot(plaintext, req, req.ImageS3URL, true))
+	if len(overflow) > 0 {
+		t.Fatalf("plain text overflowed into %d comments", len(overflow))
+	}
+
+	want := []string{
+		"Generated Summary", "Issue Summary", "Description", "User Information", "Environment",
+		"Console", "Breadcrumbs", "Runbooks", "Recent Deploys", "Screenshot",
+		"Failed Network Calls", "Request Headers", "Response", "Full Payload Data",
+	}
+	markdownTitles := append(sectionTitles(markdownHeading, markdown), sectionTitles(markdownDetails, markdown)...)
+	if !slices.Equal(markdownTitles, want) {
+		t.Errorf("Markdown sections = %q, want %q", markdownTitles, want)
+	}
+	if plainTitles := sectionTitles(plainHeading, text); !slices.Equal(plainTitles, want) {
+		t.Errorf("plain text sections = %q, want %q", plainTitles, want)
+	}
+
+	// The same facts are written in both, with and without markup
+	for _, pair := range [][2]string{
+		{"- **User Email:** jane.doe@example.com\n", "- User Email: jane.doe@example.com\n"},
+		{"- **Severity:** high\n", "- Severity: high\n"},
+		{"- **Request ID:** 5f0c6a9e-7d1b-4f7e-9c1a-2b3d4e5f6a7b\n", "- Request ID: 5f0c6a9e-7d1b-4f7e-9c1a-2b3d4e5f6a7b\n"},
+		{"- [Payments \\[runbook\\]](https://wiki.example.com/payments)\n", "- Payments [runbook] <https://wiki.example.com/payments>\n"},
+		{"```\n15:04:05.123 ERROR", "\n    15:04:05.123 ERROR"},
+		{"_This screenshot URL expires", "Note: This screenshot URL expires"},
+	} {
+		if !strings.Contains(markdown, pair[0]) {
+			t.Errorf("Markdown lacks %q", pair[0])
+		}
+		if !strings.Contains(text, pair[1]) {
+			t.Errorf("plain text lacks %q", pair[1])
+		}
+	}
+	for _, markup := range []string{"**", "```", "<details>", "](", "### "} {
+		if strings.Contains(text, markup) {
+			t.Errorf("plain text contains the markup %q", markup)
+		}
+	}
+}
+
+func TestRenderersOverflowTechnicalDetails(t *testing.T) {
+	req := describedTicketRequest()
+	req.Payload["failedNetworkCalls"] = strings.Repeat(`{"url":"https://api.example.com/v1/loans"}`, 2000)
+
+	for name, renderer := range map[string]descriptionRenderer{"Markdown": githubMarkdown, "plain text": plaintext} {
+		description, overflow := renderDescription(context.Background(), renderer, req, "")
+		if len(description) > renderer.maxLength() {
+			t.Errorf("%s description is %d characters, over the limit of %d", name, len(description), renderer.maxLength())
+		}
+		if len(overflow) == 0 {
+			t.Errorf("%s did not overflow the network calls", name)
+			continue
+		}
+		for _, comment := range overflow {
+			if len(comment) > renderer.maxLength() {
+				t.Errorf("%s comment is %d characters, over the limit of %d", name, len(comment), renderer.maxLength())
+			}
+		}
+		if !strings.HasSuffix(overflow[0], "[Comment truncated due to the character limit]") {
+			t.Errorf("%s network calls were not cut short", name)
+		}
+	}
+}
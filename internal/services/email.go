@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Email providers
+const (
+	EmailProviderNone = "none"
+	EmailProviderSMTP = "smtp"
+	EmailProviderSES  = "ses"
+)
+
+// emailQueueSize bounds the emails waiting to be sent; further emails are
+// dropped rather than holding up reports
+const emailQueueSize = 100
+
+// emailTimeout bounds sending one email
+const emailTimeout = 30 * time.Second
+
+// Email templates, which EMAIL_TEMPLATES_DIR can replace by file name
+const (
+	confirmationTemplate = "confirmation.html"
+	assignmentTemplate   = "assignment.html"
+)
+
+//go:embed email_templates/*.html
+var defaultEmailTemplates embed.FS
+
+// EmailMessage is an email with HTML and plain text bodies
+type EmailMessage struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg EmailMessage) error
+}
+
+// TicketEmail describes a new ticket to the templates of its emails
+type TicketEmail struct {
+	TicketID  string
+	JiraLink  string
+	StatusURL string
+	Summary   string
+	Product   string
+	Severity  string
+	Reporter  string
+	Assignee  string
+}
+
+// queuedEmail is an email waiting to be rendered and sent
+type queuedEmail struct {
+	template string
+	ticket   TicketEmail
+}
+
+// EmailNotifications emails reporters a confirmation of their report and
+// support team members the tickets assigned to them. Emails are sent in the
+// background by Run.
+type EmailNotifications struct {
+	mailer    Mailer
+	templates *template.Template
+	// memberEmail finds the email address of a support team member
+	memberEmail func(accountID string) string
+	logger      *zap.Logger
+
+	queue chan queuedEmail
+}
+
+// NewEmailNotifications creates a dispatcher sending through mailer. The
+// templates in templatesDir, when given, replace the built-in ones of the
+// same name.
+func NewEmailNotifications(mailer Mailer, templatesDir string, memberEmail func(string) string, log *zap.Logger) (*EmailNotifications, error) {
+	templates, err := template.ParseFS(defaultEmailTemplates, "email_templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email templates: %w", err)
+	}
+	if templatesDir != "" {
+		for _, name := range []string{confirmationTemplate, assignmentTemplate} {
+			path := filepath.Join(templatesDir, name)
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			}
+			if templates, err = templates.ParseFiles(path); err != nil {
+				return nil, fmt.Errorf("failed to parse email template %s: %w", path, err)
+			}
+		}
+	}
+
+	return &EmailNotifications{
+		mailer:      mailer,
+		templates:   templates,
+		memberEmail: memberEmail,
+		logger:      log,
+		queue:       make(chan queuedEmail, emailQueueSize),
+	}, nil
+}
+
+// TicketCreated queues the confirmation to the reporter and the assignment
+// to the assignee of a new ticket. It never blocks; emails are dropped when
+// the queue is full.
+func (e *EmailNotifications) TicketCreated(ticket TicketEmail) {
+	if ticket.Reporter != "" {
+		e.enqueue(queuedEmail{template: confirmationTemplate, ticket: ticket})
+	}
+	if ticket.Assignee != "" {
+		e.enqueue(queuedEmail{template: assignmentTemplate, ticket: ticket})
+	}
+}
+
+func (e *EmailNotifications) enqueue(email queuedEmail) {
+	select {
+	case e.queue <- email:
+	default:
+		e.logger.Warn("Email queue is full, dropping email",
+			zap.String("template", email.template),
+			zap.String("ticket_id", email.ticket.TicketID),
+		)
+	}
+}
+
+// Run sends queued emails until stopping is closed, then sends the ones
+// still queued until none are left or ctx is done
+func (e *EmailNotifications) Run(ctx context.Context, stopping <-chan struct{}) {
+	for {
+		select {
+		case email := <-e.queue:
+			e.send(ctx, email)
+		case <-stopping:
+			for ctx.Err() == nil {
+				select {
+				case email := <-e.queue:
+					e.send(ctx, email)
+				default:
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+// send renders and sends a queued email
+func (e *EmailNotifications) send(ctx context.Context, email queuedEmail) {
+	log := e.logger.With(zap.String("template", email.template), zap.String("ticket_id", email.ticket.TicketID))
+
+	msg, ok := e.render(email)
+	if !ok {
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+	if err := e.mailer.Send(sendCtx, msg); err != nil {
+		log.Warn("Failed to send email", zap.Error(err))
+	}
+}
+
+// render builds the message of a queued email. It returns false when the
+// email has no recipient or cannot be rendered.
+func (e *EmailNotifications) render(email queuedEmail) (EmailMessage, bool) {
+	t := email.ticket
+	var msg EmailMessage
+	switch email.template {
+	case confirmationTemplate:
+		msg = EmailMessage{
+			To:      t.Reporter,
+			Subject: fmt.Sprintf("We received your report (%s)", t.TicketID),
+			Text:    fmt.Sprintf("Thanks for your report %q. It is tracked as %s.\n", t.Summary, t.TicketID),
+		}
+		if t.StatusURL != "" {
+			msg.Text += "Follow its progress at " + t.StatusURL + "\n"
+		}
+	case assignmentTemplate:
+		// The roster may have been reloaded since the ticket was assigned,
+		// so the address is looked up when sending
+		msg = EmailMessage{
+			To:      e.memberEmail(t.Assignee),
+			Subject: fmt.Sprintf("%s was assigned to you: %s", t.TicketID, t.Summary),
+			Text:    fmt.Sprintf("%s was assigned to you.\n\n%s\n\n%s\n", t.TicketID, t.Summary, t.JiraLink),
+		}
+		if msg.To == "" {
+			e.logger.Debug("Assignee has no email address, not emailing the assignment", zap.String("ticket_id", t.TicketID))
+			return msg, false
+		}
+	}
+
+	var html strings.Builder
+	if err := e.templates.ExecuteTemplate(&html, email.template, t); err != nil {
+		e.logger.Error("Failed to render email", zap.String("template", email.template), zap.Error(err))
+		return msg, false
+	}
+	msg.HTML = html.String()
+	return msg, true
+}
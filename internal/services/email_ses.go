@@ -0,0 +1,102 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// SESMailer sends emails through the Amazon SES v2 API
+type SESMailer struct {
+	endpoint    string
+	region      string
+	from        string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+// NewSESMailer creates a mailer sending from a verified SES identity. The
+// default AWS credential chain is used, and its region unless one is given.
+func NewSESMailer(region, from string) (*SESMailer, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("AWS region is not configured")
+	}
+
+	return &SESMailer{
+		endpoint:    fmt.Sprintf("https://email.%s.amazonaws.com/v2/email/outbound-emails", cfg.Region),
+		region:      cfg.Region,
+		from:        from,
+		credentials: cfg.Credentials,
+		signer:      v4.NewSigner(),
+		client:      &http.Client{Timeout: emailTimeout},
+	}, nil
+}
+
+// Send delivers a message with the SendEmail action
+func (m *SESMailer) Send(ctx context.Context, msg EmailMessage) error {
+	content := func(data string) map[string]string {
+		return map[string]string{"Data": data, "Charset": "UTF-8"}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"FromEmailAddress": m.from,
+		"Destination":      map[string][]string{"ToAddresses": {msg.To}},
+		"Content": map[string]interface{}{
+			"Simple": map[string]interface{}{
+				"Subject": content(msg.Subject),
+				"Body": map[string]interface{}{
+					"Text": content(msg.Text),
+					"Html": content(msg.HTML),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create SES request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	creds, err := m.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := m.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "ses", m.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign SES request: %w", err)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call SES: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SES answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smtpsPort is the port of SMTP over implicit TLS; other ports use STARTTLS
+// when the server offers it
+const smtpsPort = 465
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPMailer creates a mailer sending from an address through an SMTP
+// server. Without a username the server is used without authentication.
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// Send delivers a message. The connection is bounded by ctx's deadline.
+func (m *SMTPMailer) Send(ctx context.Context, msg EmailMessage) error {
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	var conn net.Conn
+	var err error
+	if m.port == smtpsPort {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: m.host}}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && m.port != smtpsPort {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("failed to authenticate to SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from); err != nil {
+		return fmt.Errorf("SMTP server refused sender: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP server refused recipient: %w", err)
+	}
+	body, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := body.Write(buildMIMEMessage(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := body.Close(); err != nil {
+		return fmt.Errorf("SMTP server refused email: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildMIMEMessage encodes a message as multipart/alternative, with the
+// plain text body first so clients prefer the HTML one
+func buildMIMEMessage(from string, msg EmailMessage) []byte {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.body))
+		qp.Close()
+	}
+	parts.Close()
+	return buf.Bytes()
+}
+
+// messageID generates a unique Message-ID in the sender's domain
+func messageID(from string) string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimSuffix(from[at+1:], ">")
+	}
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">"
+}
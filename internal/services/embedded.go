@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// TrackerEmbedded is the kind of the tracker keeping tickets in a file on
+// disk, for self-contained local runs
+const TrackerEmbedded = "embedded"
+
+// embeddedTicketsFile is the file tickets are kept in, under the data
+// directory
+const embeddedTicketsFile = "tickets.json"
+
+// EmbeddedTicket is a ticket of the embedded tracker
+type EmbeddedTicket struct {
+	ID          string            `json:"id"`
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Product     string            `json:"product,omitempty"`
+	Reporter    string            `json:"reporter,omitempty"`
+	PageURL     string            `json:"page_url,omitempty"`
+	ImageURL    string            `json:"image_url,omitempty"`
+	RequestID   string            `json:"request_id,omitempty"`
+	AssignedTo  string            `json:"assigned_to,omitempty"`
+	Status      string            `json:"status"`
+	Resolution  string            `json:"resolution,omitempty"`
+	Comments    []EmbeddedComment `json:"comments,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// EmbeddedComment is a comment on a ticket of the embedded tracker
+type EmbeddedComment struct {
+	Author string    `json:"author"`
+	Body   string    `json:"body"`
+	At     time.Time `json:"at"`
+}
+
+// embeddedStore is the content of the tickets file
+type embeddedStore struct {
+	Seq     int64             `json:"seq"`
+	Tickets []*EmbeddedTicket `json:"tickets"`
+}
+
+// EmbeddedTracker is a mock issue tracker for running ronnin with no
+// external dependencies: tickets are numbered per project key, e.g. RPT-42,
+// and kept in a JSON file under the data directory, which is rewritten
+// atomically on every change. It is meant for a single developer's reports,
+// not for production volumes.
+type EmbeddedTracker struct {
+	projectKey string
+	path       string
+	roster     atomic.Pointer[Roster] // replaced when the configuration is reloaded
+	redactor   *Redactor
+	logger     *zap.Logger
+
+	mu    sync.Mutex
+	store embeddedStore
+}
+
+// NewEmbeddedTracker creates the tracker of tickets numbered under
+// projectKey and kept in dataDir, loading the tickets kept there by earlier
+// runs
+func NewEmbeddedTracker(projectKey, dataDir string, roster *Roster) (*EmbeddedTracker, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	t := &EmbeddedTracker{
+		projectKey: projectKey,
+		path:       filepath.Join(dataDir, embeddedTicketsFile),
+		logger:     zap.NewNop(),
+	}
+	t.SetRoster(roster)
+
+	data, err := os.ReadFile(t.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read tickets: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &t.store); err != nil {
+			return nil, fmt.Errorf("failed to read tickets from %s: %w", t.path, err)
+		}
+	}
+	return t, nil
+}
+
+// save writes the tickets to a temporary file and renames it over the
+// tickets file, so that a crash never leaves it half written. The caller
+// holds the lock.
+func (t *EmbeddedTracker) save() error {
+	data, err := json.MarshalIndent(&t.store, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode tickets: %w", err)
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write tickets: %w", err)
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return fmt.Errorf("failed to write tickets: %w", err)
+	}
+	return nil
+}
+
+// ticket returns a ticket by ID. The caller holds the lock.
+func (t *EmbeddedTracker) ticket(ticketID string) (*EmbeddedTicket, error) {
+	for _, ticket := range t.store.Tickets {
+		if ticket.ID == ticketID {
+			return ticket, nil
+		}
+	}
+	return nil, fmt.Errorf("ticket %s not found", ticketID)
+}
+
+// update applies change to a ticket and saves it
+func (t *EmbeddedTracker) update(ticketID string, change func(ticket *EmbeddedTicket)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ticket, err := t.ticket(ticketID)
+	if err != nil {
+		return err
+	}
+	change(ticket)
+	ticket.UpdatedAt = time.Now().UTC()
+	return t.save()
+}
+
+// CreateTicket numbers a ticket for a report, assigned to the support team
+// member on shift, with the description a Jira ticket would have
+func (t *EmbeddedTracker) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
+	// Nothing sensitive is stored
+	req = t.redactor.Ticket(req)
+	log := logger.FromContext(ctx, t.logger).With(zap.String("project", t.projectKey))
+
+	now := time.Now().UTC()
+	description, overflow := ticketDescription(req, logger.RequestID(ctx), now)
+	product, _ := req.Payload["product"].(string)
+	reporter, _ := req.Payload["userEmail"].(string)
+	ticket := &EmbeddedTicket{
+		Title:       ticketTitle(req),
+		Description: description,
+		Product:     product,
+		Reporter:    reporter,
+		PageURL:     req.URL,
+		RequestID:   logger.RequestID(ctx),
+		AssignedTo:  t.roster.Load().Assignee(ctx, product, now),
+		Status:      "Open",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if hasScreenshotURL(req) {
+		ticket.ImageURL = req.ImageS3URL
+	}
+	if overflow != "" {
+		ticket.Comments = append(ticket.Comments, EmbeddedComment{Author: "ronnin", Body: overflow, At: now})
+	}
+
+	t.mu.Lock()
+	t.store.Seq++
+	ticket.ID = fmt.Sprintf("%s-%d", t.projectKey, t.store.Seq)
+	t.store.Tickets = append(t.store.Tickets, ticket)
+	err := t.save()
+	if err != nil {
+		// Give the number back, as the ticket was not kept
+		t.store.Tickets = t.store.Tickets[:len(t.store.Tickets)-1]
+		t.store.Seq--
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ticketsCreatedTotal.WithLabelValues(t.projectKey).Inc()
+	log.Info("Filed report in the embedded tracker", zap.String("ticket_id", ticket.ID), zap.String("assigned_to", ticket.AssignedTo))
+	return &models.TicketResponse{
+		TicketID:   ticket.ID,
+		Status:     "created",
+		AssignedTo: ticket.AssignedTo,
+	}, nil
+}
+
+// IsTicketOpen reports whether a ticket is unresolved
+func (t *EmbeddedTracker) IsTicketOpen(ctx context.Context, ticketID string) (bool, error) {
+	state, err := t.GetTicketState(ctx, ticketID)
+	if err != nil {
+		return false, err
+	}
+	return state.Resolution == "", nil
+}
+
+// GetTicketState returns the state of a ticket
+func (t *EmbeddedTracker) GetTicketState(ctx context.Context, ticketID string) (*TicketState, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ticket, err := t.ticket(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	return embeddedState(ticket), nil
+}
+
+// GetTicketStates returns the states of several tickets
+func (t *EmbeddedTracker) GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	states := make(map[string]*TicketState, len(ticketIDs))
+	for _, id := range ticketIDs {
+		if ticket, err := t.ticket(id); err == nil {
+			states[id] = embeddedState(ticket)
+		}
+	}
+	return states, nil
+}
+
+func embeddedState(ticket *EmbeddedTicket) *TicketState {
+	return &TicketState{Status: ticket.Status, AssignedTo: ticket.AssignedTo, Resolution: ticket.Resolution}
+}
+
+// AssignTicket stores the new assignee of a ticket
+func (t *EmbeddedTracker) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	return t.update(ticketID, func(ticket *EmbeddedTicket) {
+		ticket.AssignedTo = accountID
+	})
+}
+
+// AddComment appends a comment to a ticket
+func (t *EmbeddedTracker) AddComment(ctx context.Context, ticketID, author, body string) error {
+	return t.update(ticketID, func(ticket *EmbeddedTicket) {
+		ticket.Comments = append(ticket.Comments, EmbeddedComment{Author: author, Body: body, At: time.Now().UTC()})
+	})
+}
+
+// ReplaceDescriptionText replaces text in the description of a ticket
+func (t *EmbeddedTracker) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	return t.update(ticketID, func(ticket *EmbeddedTicket) {
+		ticket.Description = strings.ReplaceAll(ticket.Description, oldText, newText)
+	})
+}
+
+// ReleaseScreenshot links a released screenshot from its ticket
+func (t *EmbeddedTracker) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return t.update(ticketID, func(ticket *EmbeddedTicket) {
+		ticket.ImageURL = imageURL
+		ticket.Description = strings.ReplaceAll(ticket.Description, QuarantineNote, ScreenshotMarkup(imageURL, contentType))
+	})
+}
+
+// RemoveScreenshot notes the removal of a ticket's quarantined screenshot
+func (t *EmbeddedTracker) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return t.update(ticketID, func(ticket *EmbeddedTicket) {
+		ticket.ImageURL = ""
+		ticket.Description = strings.ReplaceAll(ticket.Description, QuarantineNote, purgedNote)
+	})
+}
+
+// Ping checks that the data directory can be written to
+func (t *EmbeddedTracker) Ping(ctx context.Context) error {
+	f, err := os.CreateTemp(filepath.Dir(t.path), ".ping-*")
+	if err != nil {
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Tickets returns the tickets of the embedded tracker, newest first
+func (t *EmbeddedTracker) Tickets() []EmbeddedTicket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tickets := make([]EmbeddedTicket, len(t.store.Tickets))
+	for i, ticket := range t.store.Tickets {
+		tickets[len(tickets)-1-i] = *ticket
+	}
+	return tickets
+}
+
+// Kind returns TrackerEmbedded
+func (t *EmbeddedTracker) Kind() string {
+	return TrackerEmbedded
+}
+
+// ProjectKey returns the key tickets are numbered under
+func (t *EmbeddedTracker) ProjectKey() string {
+	return t.projectKey
+}
+
+// SetRoster replaces the support roster tickets are assigned from
+func (t *EmbeddedTracker) SetRoster(roster *Roster) {
+	t.roster.Store(roster)
+}
+
+// SetRedactor sets the redactor applied to new tickets
+func (t *EmbeddedTracker) SetRedactor(redactor *Redactor) {
+	t.redactor = redactor
+}
+
+// SetLogger sets the logger tickets are logged to
+func (t *EmbeddedTracker) SetLogger(log *zap.Logger) {
+	t.logger = log
+}
+
+// Cleanup does nothing, as tickets are saved on every change
+func (t *EmbeddedTracker) Cleanup() error {
+	return nil
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// errorReporterQueueSize bounds the events waiting to be sent; further
+// events are dropped rather than holding up requests
+const errorReporterQueueSize = 100
+
+// errorReporterTimeout bounds sending one event
+const errorReporterTimeout = 10 * time.Second
+
+// ErrorEvent is a failure of ronnin itself: a panic or a request it
+// answered with a 5xx status
+type ErrorEvent struct {
+	// Message describes the error, e.g. the error text of the response
+	Message string
+	// Type classifies it, e.g. "panic" or "http_500"
+	Type string
+	// Fatal marks panics
+	Fatal bool
+	// Stack is the stack of the goroutine that panicked, as returned by
+	// runtime.Callers; it is empty for error responses
+	Stack []uintptr
+
+	Method    string
+	URL       string
+	Route     string
+	Status    int
+	Headers   map[string]string
+	RequestID string
+	ClientIP  string
+}
+
+// ErrorReporter sends ronnin's own errors to Sentry, or any service that
+// accepts Sentry envelopes, so failures of the reporting service itself are
+// noticed. Events are sent in the background by Run.
+type ErrorReporter struct {
+	endpoint    string
+	dsn         string
+	publicKey   string
+	environment string
+	release     string
+	serverName  string
+	redactor    *Redactor
+	client      *http.Client
+	logger      *zap.Logger
+
+	events chan ErrorEvent
+}
+
+// NewErrorReporter creates a reporter sending to the project of a Sentry
+// DSN, https://<public key>@<host>/<project id>. Headers of the failed
+// requests are redacted with redactor.
+func NewErrorReporter(dsn, environment, release string, redactor *Redactor, log *zap.Logger) (*ErrorReporter, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil || parsed.User == nil || parsed.User.Username() == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid DSN, expected https://<key>@<host>/<project>")
+	}
+	path := strings.Trim(parsed.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	projectID := path[slash+1:]
+	if projectID == "" {
+		return nil, fmt.Errorf("invalid DSN, the project ID is missing")
+	}
+	prefix := ""
+	if slash >= 0 {
+		prefix = "/" + path[:slash]
+	}
+
+	hostname, _ := os.Hostname()
+	return &ErrorReporter{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", parsed.Scheme, parsed.Host, prefix, projectID),
+		dsn:         dsn,
+		publicKey:   parsed.User.Username(),
+		environment: environment,
+		release:     release,
+		serverName:  hostname,
+		redactor:    redactor,
+		client:      &http.Client{Timeout: errorReporterTimeout},
+		logger:      log,
+		events:      make(chan ErrorEvent, errorReporterQueueSize),
+	}, nil
+}
+
+// Capture queues an event to be sent. It never blocks; events are dropped
+// when the queue is full.
+func (r *ErrorReporter) Capture(event ErrorEvent) {
+	select {
+	case r.events <- event:
+	default:
+		r.logger.Warn("Error reporter queue is full, dropping event", zap.String("type", event.Type))
+	}
+}
+
+// Run sends queued events until stopping is closed, then sends the events
+// still queued until none are left or ctx is done
+func (r *ErrorReporter) Run(ctx context.Context, stopping <-chan struct{}) {
+	for {
+		select {
+		case event := <-r.events:
+			r.send(ctx, event)
+		case <-stopping:
+			for ctx.Err() == nil {
+				select {
+				case event := <-r.events:
+					r.send(ctx, event)
+				default:
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+func (r *ErrorReporter) send(ctx context.Context, event ErrorEvent) {
+	payload := r.sentryEvent(event)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		r.logger.Error("Failed to encode error event", zap.Error(err))
+		return
+	}
+
+	var envelope bytes.Buffer
+	header, _ := json.Marshal(map[string]string{
+		"event_id": payload.EventID,
+		"dsn":      r.dsn,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+	})
+	envelope.Write(header)
+	fmt.Fprintf(&envelope, "\n{\"type\":\"event\",\"length\":%d}\n", len(body))
+	envelope.Write(body)
+	envelope.WriteByte('\n')
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, &envelope)
+	if err != nil {
+		r.logger.Error("Failed to send error event", zap.Error(err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=ronnin/1.0, sentry_key=%s", r.publicKey))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		r.logger.Warn("Failed to send error event", zap.Error(err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		r.logger.Warn("Error tracker rejected event", zap.Int("status", resp.StatusCode), zap.String("event_id", payload.EventID))
+	}
+}
+
+// outboundSentryEvent is the Sentry event sent for an ErrorEvent
+type outboundSentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Transaction string            `json:"transaction,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   struct {
+		Values []outboundSentryException `json:"values"`
+	} `json:"exception"`
+	Request *outboundSentryRequest `json:"request,omitempty"`
+	User    *struct {
+		IPAddress string `json:"ip_address"`
+	} `json:"user,omitempty"`
+}
+
+type outboundSentryException struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Stacktrace *struct {
+		Frames []outboundSentryFrame `json:"frames"`
+	} `json:"stacktrace,omitempty"`
+}
+
+type outboundSentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type outboundSentryRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// sentryEvent converts an event to the Sentry event format
+func (r *ErrorReporter) sentryEvent(event ErrorEvent) *outboundSentryEvent {
+	out := &outboundSentryEvent{
+		EventID:     strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       "error",
+		Platform:    "go",
+		Logger:      "ronnin",
+		Environment: r.environment,
+		Release:     r.release,
+		ServerName:  r.serverName,
+		Transaction: strings.TrimSpace(event.Method + " " + event.Route),
+		Tags:        map[string]string{},
+	}
+	if event.Fatal {
+		out.Level = "fatal"
+	}
+	if event.Status != 0 {
+		out.Tags["status"] = fmt.Sprint(event.Status)
+	}
+	if event.RequestID != "" {
+		out.Tags["request_id"] = event.RequestID
+	}
+
+	exception := outboundSentryException{Type: event.Type, Value: r.redactor.String(event.Message)}
+	if frames := sentryFrames(event.Stack); len(frames) > 0 {
+		exception.Stacktrace = &struct {
+			Frames []outboundSentryFrame `json:"frames"`
+		}{Frames: frames}
+	}
+	out.Exception.Values = []outboundSentryException{exception}
+
+	if event.URL != "" {
+		out.Request = &outboundSentryRequest{
+			URL:     r.redactor.String(event.URL),
+			Method:  event.Method,
+			Headers: r.redactor.StringMap(event.Headers),
+		}
+	}
+	if event.ClientIP != "" {
+		out.User = &struct {
+			IPAddress string `json:"ip_address"`
+		}{IPAddress: event.ClientIP}
+	}
+	return out
+}
+
+// sentryFrames resolves a stack, ordered oldest call first as Sentry
+// expects. Frames of ronnin's own packages are marked in-app.
+func sentryFrames(stack []uintptr) []outboundSentryFrame {
+	if len(stack) == 0 {
+		return nil
+	}
+	var frames []outboundSentryFrame
+	callers := runtime.CallersFrames(stack)
+	for {
+		frame, more := callers.Next()
+		module, function := splitFunctionName(frame.Function)
+		frames = append(frames, outboundSentryFrame{
+			Function: function,
+			Module:   module,
+			Filename: frame.File[strings.LastIndex(frame.File, "/")+1:],
+			AbsPath:  frame.File,
+			Lineno:   frame.Line,
+			InApp:    strings.HasPrefix(module, "github.com/parvez-capri/ronnin"),
+		})
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// splitFunctionName splits a qualified Go function name such as
+// github.com/org/repo/pkg.(*T).Method into its package and function
+func splitFunctionName(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Events of the ticket lifecycle, sent to outbound webhooks and Kafka
+const (
+	EventTicketCreated = "ticket.created"
+	EventTicketUpdated = "ticket.updated"
+	EventReportFailed  = "report.failed"
+)
+
+// Event is the JSON envelope of a ticket lifecycle event
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// NewEvent creates an event of a type with a new ID
+func NewEvent(eventType string, data interface{}) Event {
+	return Event{ID: uuid.NewString(), Type: eventType, CreatedAt: time.Now().UTC(), Data: data}
+}
+
+// TicketEventData is the data of ticket events. Previous fields are set on
+// ticket.updated events.
+type TicketEventData struct {
+	TicketID           string `json:"ticketId"`
+	JiraLink           string `json:"jiraLink,omitempty"`
+	Summary            string `json:"summary,omitempty"`
+	Product            string `json:"product,omitempty"`
+	Severity           string `json:"severity,omitempty"`
+	Category           string `json:"category,omitempty"`
+	Reporter           string `json:"reporter,omitempty"`
+	Status             string `json:"status"`
+	AssignedTo         string `json:"assignedTo,omitempty"`
+	Resolution         string `json:"resolution,omitempty"`
+	PreviousStatus     string `json:"previousStatus,omitempty"`
+	PreviousAssignedTo string `json:"previousAssignedTo,omitempty"`
+	Tenant             string `json:"tenant,omitempty"`
+}
+
+// ReportFailedEventData is the data of report.failed events
+type ReportFailedEventData struct {
+	Product   string `json:"product,omitempty"`
+	Status    int    `json:"status"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// TicketUpdate returns the data of the ticket.updated event of a change to
+// the state of a stored ticket, and false when the status, assignee and
+// resolution did not change
+func TicketUpdate(ticket *FlattenedTicket, state *TicketState) (TicketEventData, bool) {
+	if state.Status == ticket.Status && state.AssignedTo == ticket.AssignedTo && state.Resolution == ticket.Resolution {
+		return TicketEventData{}, false
+	}
+	return TicketEventData{
+		TicketID:           ticket.TicketID,
+		JiraLink:           ticket.JiraLink,
+		Summary:            ticket.Issue,
+		Product:            ticket.Product,
+		Severity:           ticket.Severity,
+		Category:           ticket.Category,
+		Status:             state.Status,
+		AssignedTo:         state.AssignedTo,
+		Resolution:         state.Resolution,
+		PreviousStatus:     ticket.Status,
+		PreviousAssignedTo: ticket.AssignedTo,
+	}, true
+}
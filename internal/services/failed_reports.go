@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// failedReportsCollection is the collection reports that failed for good are
+// kept in until they are retried
+const failedReportsCollection = "failed_reports"
+
+// failedReportsDir is the directory under os.TempDir the files of failed
+// reports are kept in when no checkpoint directory is set
+const failedReportsDir = "ronnin-failed-reports"
+
+// maxFailedReports caps the kept failed reports listed and retried at once
+const maxFailedReports = 1000
+
+// ErrUnknownReportKind is returned when retrying a report no resumer is
+// registered for
+var ErrUnknownReportKind = errors.New("unknown report kind")
+
+// FailedReport is an asynchronous report that failed for good: a report
+// queued in memory whose failure expired without a successful retry, or a
+// brokered report sent to the dead-letter queue. It is kept with its job,
+// whose files are in the checkpoint directory or object storage, until it
+// is retried.
+type FailedReport struct {
+	ID       string `bson:"_id" json:"id"`
+	Kind     string `bson:"kind" json:"kind"`
+	Payload  string `bson:"payload" json:"payload"`
+	Attempts int    `bson:"attempts,omitempty" json:"attempts,omitempty"`
+	Error    string `bson:"error" json:"error"`
+	Code     string `bson:"code,omitempty" json:"code,omitempty"`
+	// RequestID is the ID of the request that submitted the report, when
+	// the job records it
+	RequestID string    `bson:"request_id,omitempty" json:"requestId,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"createdAt"`
+	FailedAt  time.Time `bson:"failed_at" json:"failedAt"`
+}
+
+// StoreFailures makes the queue keep reports that failed for good in
+// MongoDB, to be retried with RetryStored, instead of dropping them. Their
+// payloads are redacted with redactor before they are saved. The files of
+// reports queued in memory are copied to the checkpoint directory, or a
+// temporary directory when it is not set.
+func (q *ReportQueue) StoreFailures(mongoService *MongoDBService, redactor *Redactor) {
+	q.failures = mongoService
+	q.failuresRedactor = redactor
+}
+
+// StoresFailures reports whether reports that failed for good are kept
+func (q *ReportQueue) StoresFailures() bool {
+	return q.failures != nil
+}
+
+// keep saves a report queued in memory whose failure expired, and reports
+// whether it was kept. Like on shutdown, its checkpoint copies the files it
+// needs, so the report is not released once kept.
+func (q *ReportQueue) keep(report queuedReport, status models.ReportStatus) bool {
+	log := q.logger.With(zap.String("report_id", report.id))
+	if q.failures == nil || report.checkpoint == nil {
+		log.Warn("Dropped failed report whose status expired", zap.String("error", status.Error))
+		return false
+	}
+
+	dir := q.checkpointDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), failedReportsDir)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Error("Failed to keep failed report", zap.Error(err))
+		return false
+	}
+	kind, payload, err := report.checkpoint(dir)
+	if err != nil {
+		log.Error("Failed to keep failed report", zap.Error(err))
+		return false
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("Failed to keep failed report", zap.Error(err))
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reportStatusWriteTimeout)
+	defer cancel()
+	failed := newFailedReport(ReportJob{ID: report.id, Kind: kind, Payload: raw, CreatedAt: status.CreatedAt}, &status, q.failuresRedactor)
+	if err := q.failures.SaveFailedReport(ctx, failed); err != nil {
+		log.Error("Failed to keep failed report", zap.Error(err))
+		return false
+	}
+	log.Info("Kept failed report whose status expired")
+	return true
+}
+
+// keepJob saves a brokered report sent to the dead-letter queue
+func (q *ReportQueue) keepJob(ctx context.Context, job ReportJob, status *models.ReportStatus) {
+	if q.failures == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportStatusWriteTimeout)
+	defer cancel()
+	if err := q.failures.SaveFailedReport(ctx, newFailedReport(job, status, q.failuresRedactor)); err != nil {
+		q.logger.Error("Failed to keep dead-lettered report", zap.String("report_id", job.ID), zap.Error(err))
+	}
+}
+
+// newFailedReport creates the record of a job that failed for good, with
+// its payload redacted so credentials and personal data are not stored
+func newFailedReport(job ReportJob, status *models.ReportStatus, redactor *Redactor) *FailedReport {
+	var saved struct {
+		RequestID string `json:"requestId"`
+	}
+	json.Unmarshal(job.Payload, &saved)
+	return &FailedReport{
+		ID:        job.ID,
+		Kind:      job.Kind,
+		Payload:   redactor.String(string(job.Payload)),
+		Attempts:  job.Attempts,
+		Error:     status.Error,
+		Code:      status.Code,
+		RequestID: saved.RequestID,
+		CreatedAt: job.CreatedAt,
+		FailedAt:  time.Now().UTC(),
+	}
+}
+
+// StoredFailures lists the kept failed reports, most recent failure first
+func (q *ReportQueue) StoredFailures(ctx context.Context) ([]FailedReport, error) {
+	if q.failures == nil {
+		return nil, nil
+	}
+	return q.failures.GetFailedReports(ctx, maxFailedReports)
+}
+
+// RetryStored queues a kept failed report for processing again, with its
+// original ID, and removes its record
+func (q *ReportQueue) RetryStored(ctx context.Context, id string) (*models.ReportStatus, error) {
+	if q.failures == nil {
+		return nil, ErrReportNotFound
+	}
+	failed, err := q.failures.GetFailedReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return q.retryStored(ctx, failed)
+}
+
+// RetryAllStored queues every kept failed report again, oldest first,
+// stopping when the queue is full or the broker is unavailable, and returns
+// the number queued
+func (q *ReportQueue) RetryAllStored(ctx context.Context) (int, error) {
+	failures, err := q.StoredFailures(ctx)
+	if err != nil {
+		return 0, err
+	}
+	retried := 0
+	for i := len(failures) - 1; i >= 0; i-- {
+		if _, err := q.retryStored(ctx, &failures[i]); err != nil {
+			if errors.Is(err, ErrReportQueueFull) || errors.Is(err, ErrReportBrokerUnavailable) {
+				return retried, err
+			}
+			q.logger.Warn("Failed to retry kept report", zap.String("report_id", failures[i].ID), zap.Error(err))
+			continue
+		}
+		retried++
+	}
+	return retried, nil
+}
+
+func (q *ReportQueue) retryStored(ctx context.Context, failed *FailedReport) (*models.ReportStatus, error) {
+	job := ReportJob{ID: failed.ID, Kind: failed.Kind, Payload: json.RawMessage(failed.Payload), CreatedAt: failed.CreatedAt}
+
+	var status *models.ReportStatus
+	if q.broker != nil {
+		// A fresh job, with all its attempts
+		body, err := json.Marshal(job)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode report: %w", err)
+		}
+		status = jobStatus(job, ReportStatusQueued)
+		q.record(ctx, status)
+		if err := q.broker.Send(ctx, body, 0); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrReportBrokerUnavailable, err)
+		}
+	} else {
+		q.mu.Lock()
+		resume := q.resumers[job.Kind]
+		q.mu.Unlock()
+		if resume == nil {
+			return nil, fmt.Errorf("%w %q", ErrUnknownReportKind, job.Kind)
+		}
+		// Checked first, as releasing a resumed report removes the files
+		// its record points to
+		if len(q.tasks) == cap(q.tasks) {
+			return nil, ErrReportQueueFull
+		}
+		task, release, err := resume(job.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resume report: %w", err)
+		}
+		// Kept again as is when it fails for good again
+		checkpoint := func(string) (string, interface{}, error) { return job.Kind, job.Payload, nil }
+		if status, err = q.submit(job.ID, job.CreatedAt, task, release, checkpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := q.failures.DeleteFailedReport(ctx, failed.ID); err != nil {
+		q.logger.Error("Failed to remove retried report, it may be retried twice", zap.String("report_id", failed.ID), zap.Error(err))
+	}
+	return status, nil
+}
+
+// SaveFailedReport keeps a report that failed for good, replacing the record
+// of an earlier failure of the same report
+func (s *MongoDBService) SaveFailedReport(ctx context.Context, failed *FailedReport) error {
+	_, err := s.failedReports.ReplaceOne(ctx, bson.M{"_id": failed.ID}, failed, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save failed report: %w", err)
+	}
+	return nil
+}
+
+// GetFailedReports retrieves up to limit kept failed reports, most recent
+// failure first
+func (s *MongoDBService) GetFailedReports(ctx context.Context, limit int64) ([]FailedReport, error) {
+	cursor, err := s.failedReports.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "failed_at", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find failed reports: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var failures []FailedReport
+	if err := cursor.All(ctx, &failures); err != nil {
+		return nil, fmt.Errorf("failed to decode failed reports: %w", err)
+	}
+	return failures, nil
+}
+
+// GetFailedReport retrieves a kept failed report by ID
+func (s *MongoDBService) GetFailedReport(ctx context.Context, id string) (*FailedReport, error) {
+	var failed FailedReport
+	if err := s.failedReports.FindOne(ctx, bson.M{"_id": id}).Decode(&failed); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReportNotFound
+		}
+		return nil, fmt.Errorf("failed to get failed report: %w", err)
+	}
+	return &failed, nil
+}
+
+// DeleteFailedReport removes a kept failed report
+func (s *MongoDBService) DeleteFailedReport(ctx context.Context, id string) error {
+	if _, err := s.failedReports.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return fmt.Errorf("failed to delete failed report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+func TestNewFailedReportRedactsPayload(t *testing.T) {
+	redactor, err := NewRedactor([]string{"Authorization"}, allDetectors, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := ReportJob{
+		ID:   "r-1",
+		Kind: "report",
+		Payload: json.RawMessage(`{"requestId":"req-1","request":{"payload":{"issue":"Payment failed",` +
+			`"card":"4111 1111 1111 1111"},"requestHeaders":{"Authorization":"Token abc"}}}`),
+	}
+
+	failed := newFailedReport(job, &models.ReportStatus{Error: "Jira unavailable"}, redactor)
+	for _, secret := range []string{"4111 1111 1111 1111", "Token abc"} {
+		if strings.Contains(failed.Payload, secret) {
+			t.Errorf("payload %s keeps %q", failed.Payload, secret)
+		}
+	}
+
+	// The redacted job can still be retried
+	var payload struct {
+		RequestID string `json:"requestId"`
+		Request   struct {
+			Payload map[string]interface{} `json:"payload"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal([]byte(failed.Payload), &payload); err != nil {
+		t.Fatalf("redacted payload is not JSON: %v", err)
+	}
+	if payload.RequestID != "req-1" || payload.Request.Payload["issue"] != "Payment failed" {
+		t.Errorf("payload %s lost fields that are not sensitive", failed.Payload)
+	}
+	if failed.RequestID != "req-1" || failed.Error != "Jira unavailable" {
+		t.Errorf("failed report = %+v", failed)
+	}
+
+	// Without a redactor the payload is kept as is
+	if kept := newFailedReport(job, &models.ReportStatus{}, nil); kept.Payload != string(job.Payload) {
+		t.Errorf("payload = %s, want it unchanged", kept.Payload)
+	}
+}
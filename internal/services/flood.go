@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// floodWindow is the period reports of a failure are counted over
+const floodWindow = time.Hour
+
+// floodCommentTimeout bounds the storm comment
+const floodCommentTimeout = 30 * time.Second
+
+// FloodControl keeps outages from flooding the tracker: once a failure is
+// reported more than its threshold times within an hour, further reports
+// are counted as occurrences of its latest ticket instead of getting tickets
+// of their own, and the ticket gets a single comment saying a storm was
+// detected. Reports get tickets again once the failure is reported no more
+// than the threshold times within an hour.
+type FloodControl struct {
+	trackers     *JiraRegistry
+	mongoService *MongoDBService
+	threshold    int
+	logger       *zap.Logger
+
+	mu       sync.Mutex
+	failures map[string]*floodReports
+}
+
+// floodReports are the latest reports of a failure, at most one more than
+// the threshold, and its latest ticket
+type floodReports struct {
+	reports []time.Time
+	ticket  *models.TicketResponse
+	storm   bool
+}
+
+// NewFloodControl creates the flood control of failures reported more than
+// threshold times within an hour. MongoDB may be nil, in which case reports
+// in a storm are not counted on their ticket.
+func NewFloodControl(trackers *JiraRegistry, mongoService *MongoDBService, threshold int, log *zap.Logger) *FloodControl {
+	return &FloodControl{
+		trackers:     trackers,
+		mongoService: mongoService,
+		threshold:    threshold,
+		logger:       log,
+		failures:     make(map[string]*floodReports),
+	}
+}
+
+// Check counts a report towards its failure. When the failure is in a storm
+// the report is added to its latest ticket, which is returned with
+// TicketStatusCoalesced; otherwise it returns nil and the report needs a
+// ticket of its own.
+func (f *FloodControl) Check(ctx context.Context, req *models.TicketRequest) *models.TicketResponse {
+	fingerprint := ReportFingerprint(req)
+	key := TenantID(ctx) + "\x00" + fingerprint
+	now := time.Now()
+
+	f.mu.Lock()
+	f.expire(now)
+	failure := f.failures[key]
+	if failure == nil {
+		failure = &floodReports{}
+		f.failures[key] = failure
+	}
+	failure.reports = append(failure.reports, now)
+	if len(failure.reports) > f.threshold+1 {
+		failure.reports = failure.reports[1:]
+	}
+	if len(failure.reports) <= f.threshold || failure.ticket == nil {
+		failure.storm = false
+		f.mu.Unlock()
+		return nil
+	}
+	started := !failure.storm
+	failure.storm = true
+	response := *failure.ticket
+	f.mu.Unlock()
+
+	reportsFloodControlledTotal.Inc()
+	log := logger.FromContext(ctx, f.logger).With(zap.String("ticket_id", response.TicketID), zap.String("fingerprint", fingerprint))
+	if f.mongoService != nil {
+		userEmail, _ := req.Payload["userEmail"].(string)
+		err := f.mongoService.InsertReportOccurrences(ctx, []ReportOccurrence{{
+			TicketID:    response.TicketID,
+			Fingerprint: fingerprint,
+			RequestID:   logger.RequestID(ctx),
+			UserEmail:   userEmail,
+			PageURL:     req.URL,
+			At:          now,
+		}})
+		if err != nil {
+			log.Warn("Failed to count report towards its ticket", zap.Error(err))
+		}
+	}
+	if started {
+		reportStormsTotal.Inc()
+		log.Warn("Report storm detected", zap.Int("threshold", f.threshold))
+		f.comment(context.WithoutCancel(ctx), response.TicketID, log)
+	}
+
+	response.Status = TicketStatusCoalesced
+	return &response
+}
+
+// Track makes a new ticket the one reports of its failure are added to
+// during a storm
+func (f *FloodControl) Track(ctx context.Context, req *models.TicketRequest, ticket *models.TicketResponse) {
+	tracked := *ticket
+	tracked.SimilarTickets = nil
+	tracked.StatusURL = ""
+	key := TenantID(ctx) + "\x00" + ReportFingerprint(req)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if failure := f.failures[key]; failure != nil {
+		failure.ticket = &tracked
+	}
+}
+
+// comment tells the watchers of a ticket that reports of its failure are
+// added to it until the storm is over
+func (f *FloodControl) comment(ctx context.Context, ticketID string, log *zap.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, floodCommentTimeout)
+	defer cancel()
+	body := fmt.Sprintf("Storm detected: this failure was reported more than %d times within the last %s. "+
+		"Further reports are counted as occurrences of this ticket instead of opening new tickets, until they slow down.",
+		f.threshold, humanDuration(floodWindow))
+	err := f.trackers.AddComment(ctx, ticketID, "ronnin", body)
+	if err != nil && !errors.Is(err, errCollectorUnsupported) {
+		log.Warn("Failed to comment report storm", zap.Error(err))
+	}
+}
+
+// expire drops reports older than the window, and failures without any. It
+// must be called with mu held.
+func (f *FloodControl) expire(now time.Time) {
+	cutoff := now.Add(-floodWindow)
+	for key, failure := range f.failures {
+		kept := failure.reports[:0]
+		for _, at := range failure.reports {
+			if at.After(cutoff) {
+				kept = append(kept, at)
+			}
+		}
+		failure.reports = kept
+		if len(kept) == 0 {
+			delete(f.failures, key)
+		}
+	}
+}
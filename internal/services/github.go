@@ -0,0 +1,451 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultGitHubAPIURL is the API of github.com; GitHub Enterprise Server
+// serves it under /api/v3 of its host
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// githubAttachmentMaxSize caps the screenshots committed to a repository;
+// larger ones are linked instead
+const githubAttachmentMaxSize = 25 << 20
+
+// githubMarkdown is GitHub Flavored Markdown. Issue and comment bodies are
+// limited to 65,536 characters.
+var githubMarkdown = markdownDialect{
+	limit: 65536,
+	collapse: func(title, content string) string {
+		return fmt.Sprintf("<details>\n<summary>%s</summary>\n\n```json\n%s\n```\n\n</details>\n\n", title, content)
+	},
+	image: func(url string) string {
+		return fmt.Sprintf("<img src=\"%s\" width=\"800\" alt=\"Screenshot\">", url)
+	},
+	quarantineNote: "> [!WARNING]\n> The attachment of this report was flagged by the malware scanner and is pending review.",
+	purgedNote:     "> [!NOTE]\n> The attachment of this report was removed after malware review.",
+}
+
+// GitHubTracker creates tickets as issues of a GitHub repository. Ticket IDs
+// are the tracker's project key and the issue number, e.g. WEB-42.
+type GitHubTracker struct {
+	apiURL     string
+	repository string // owner/name
+	token      string
+	projectKey string
+	labels     []string
+	client     *http.Client
+
+	// attachmentsBranch is the branch screenshots are committed to, since
+	// the API cannot attach files to issues; empty links them from storage
+	attachmentsBranch string
+
+	roster       atomic.Pointer[Roster] // replaced when the configuration is reloaded
+	mongoService *MongoDBService
+	redactor     *Redactor
+	logger       *zap.Logger
+}
+
+// NewGitHubTracker creates a tracker of the issues of repository, given as
+// owner/name, labelling new issues with labels. An empty apiURL uses
+// github.com.
+func NewGitHubTracker(apiURL, repository, token, projectKey string, labels []string, attachmentsBranch string, roster *Roster, mongoService *MongoDBService) (*GitHubTracker, error) {
+	if owner, name, ok := strings.Cut(repository, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid GitHub repository %q, expected owner/name", repository)
+	}
+	if apiURL == "" {
+		apiURL = DefaultGitHubAPIURL
+	}
+
+	t := &GitHubTracker{
+		apiURL:            strings.TrimSuffix(apiURL, "/"),
+		repository:        repository,
+		token:             token,
+		projectKey:        projectKey,
+		labels:            labels,
+		client:            &http.Client{Timeout: 30 * time.Second},
+		attachmentsBranch: attachmentsBranch,
+		mongoService:      mongoService,
+		logger:            zap.NewNop(),
+	}
+	t.SetRoster(roster)
+	return t, nil
+}
+
+// githubIssue is the part of the GitHub issue resource ronnin uses
+type githubIssue struct {
+	Number      int    `json:"number"`
+	HTMLURL     string `json:"html_url"`
+	State       string `json:"state"`
+	StateReason string `json:"state_reason"`
+	Body        string `json:"body"`
+	Assignee    *struct {
+		Login string `json:"login"`
+	} `json:"assignee"`
+}
+
+// githubError is an error response of the GitHub API
+type githubError struct {
+	Status  int
+	Message string
+}
+
+func (e *githubError) Error() string {
+	return fmt.Sprintf("GitHub answered %d: %s", e.Status, e.Message)
+}
+
+// CreateTicket creates an issue for a report, assigned to the GitHub login
+// of the support team member on shift, and saves the ticket to MongoDB
+func (t *GitHubTracker) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
+	// Nothing sensitive is sent to GitHub or stored
+	req = t.redactor.Ticket(req)
+	log := logger.FromContext(ctx, t.logger).With(zap.String("repository", t.repository))
+
+	product, _ := req.Payload["product"].(string)
+	assignee := t.Roster().Assignee(ctx, product, time.Now())
+	var assignees []string
+	if login := t.login(assignee); login != "" {
+		assignees = []string{login}
+	}
+
+	labels := append([]string(nil), t.labels...)
+	if severity := TicketSeverity(req); severity != "" {
+		labels = append(labels, "severity:"+severity)
+	}
+	if req.Classification != nil {
+		labels = append(labels, "category:"+req.Classification.Category)
+	}
+
+	body, overflow := renderDescription(ctx, githubMarkdown, req, t.screenshotSection(ctx, req, log))
+
+	var issue githubIssue
+	start := time.Now()
+	err := t.do(ctx, http.MethodPost, t.repoPath("issues"), map[string]interface{}{
+		"title":     ticketTitle(req),
+		"body":      body,
+		"labels":    labels,
+		"assignees": assignees,
+	}, &issue)
+	latency := time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub issue: %w", err)
+	}
+
+	ticketsCreatedTotal.WithLabelValues(t.projectKey).Inc()
+	ticketID := t.ticketID(issue.Number)
+
+	// Sections that did not fit the issue follow as comments
+	for _, section := range overflow {
+		if err := t.do(ctx, http.MethodPost, t.repoPath("issues", strconv.Itoa(issue.Number), "comments"), map[string]string{"body": section}, nil); err != nil {
+			log.Warn("Failed to add comment with truncated content", zap.String("ticket_id", ticketID), zap.Error(err))
+		}
+	}
+
+	ticketResponse := &models.TicketResponse{
+		TicketID:   ticketID,
+		Status:     "created",
+		AssignedTo: assignee,
+		JiraLink:   issue.HTMLURL,
+	}
+	saveTicket(ctx, t.mongoService, req, ticketResponse, latency, log)
+	return ticketResponse, nil
+}
+
+// IsTicketOpen reports whether an issue is still open
+func (t *GitHubTracker) IsTicketOpen(ctx context.Context, ticketID string) (bool, error) {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return false, err
+	}
+	return issue.State == "open", nil
+}
+
+// GetTicketState fetches the state, assignee and reason for closing of an
+// issue. Assignees are given by Jira account when they are on the roster.
+func (t *GitHubTracker) GetTicketState(ctx context.Context, ticketID string) (*TicketState, error) {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	return t.issueState(issue), nil
+}
+
+// GetTicketStates fetches the state of several issues, one request each.
+// Issues that do not exist are missing from the result.
+func (t *GitHubTracker) GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error) {
+	states := make(map[string]*TicketState, len(ticketIDs))
+	for _, id := range ticketIDs {
+		issue, err := t.issue(ctx, id)
+		var notFound *githubError
+		if errors.As(err, &notFound) && notFound.Status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		states[id] = t.issueState(issue)
+	}
+	return states, nil
+}
+
+func (t *GitHubTracker) issueState(issue *githubIssue) *TicketState {
+	state := &TicketState{Status: issue.State}
+	if issue.State == "closed" {
+		state.Resolution = issue.StateReason
+	}
+	if issue.Assignee != nil {
+		state.AssignedTo = issue.Assignee.Login
+		if member, ok := t.Roster().FindMember(func(m RosterMember) bool { return strings.EqualFold(m.GitHub, issue.Assignee.Login) }); ok {
+			state.AssignedTo = member.AccountID
+		}
+	}
+	return state
+}
+
+// AssignTicket makes the GitHub login of a support team member the only
+// assignee of an issue
+func (t *GitHubTracker) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	login := t.login(accountID)
+	if login == "" {
+		return fmt.Errorf("support team member %s has no GitHub login", accountID)
+	}
+	return t.updateIssue(ctx, ticketID, map[string]interface{}{"assignees": []string{login}})
+}
+
+// AddComment adds a comment to an issue on behalf of author, since comments
+// are posted as the token's user
+func (t *GitHubTracker) AddComment(ctx context.Context, ticketID, author, body string) error {
+	number, err := t.issueNumber(ticketID)
+	if err != nil {
+		return err
+	}
+	comment := fmt.Sprintf("**%s** via ronnin:\n\n%s", author, t.redactor.String(body))
+	if err := t.do(ctx, http.MethodPost, t.repoPath("issues", number, "comments"), map[string]string{"body": comment}, nil); err != nil {
+		return fmt.Errorf("failed to comment on GitHub issue %s: %w", ticketID, err)
+	}
+	return nil
+}
+
+// ReplaceDescriptionText replaces every occurrence of oldText in an issue's
+// body. It is a no-op when the body does not contain oldText.
+func (t *GitHubTracker) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(issue.Body, oldText) {
+		return nil
+	}
+	return t.updateIssue(ctx, ticketID, map[string]interface{}{"body": strings.ReplaceAll(issue.Body, oldText, newText)})
+}
+
+// ReleaseScreenshot shows a released screenshot in place of the quarantine
+// note of an issue
+func (t *GitHubTracker) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return t.ReplaceDescriptionText(ctx, ticketID, githubMarkdown.quarantineNote, githubMarkdown.screenshot(imageURL, contentType))
+}
+
+// RemoveScreenshot notes the removal of an issue's quarantined screenshot
+func (t *GitHubTracker) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return t.ReplaceDescriptionText(ctx, ticketID, githubMarkdown.quarantineNote, githubMarkdown.purgedNote)
+}
+
+// Ping checks that the repository can be read with the token
+func (t *GitHubTracker) Ping(ctx context.Context) error {
+	if err := t.do(ctx, http.MethodGet, t.repoPath(), nil, nil); err != nil {
+		return fmt.Errorf("failed to reach GitHub: %w", err)
+	}
+	return nil
+}
+
+// Kind returns TrackerGitHub
+func (t *GitHubTracker) Kind() string {
+	return TrackerGitHub
+}
+
+// ProjectKey returns the prefix of the tracker's ticket IDs
+func (t *GitHubTracker) ProjectKey() string {
+	return t.projectKey
+}
+
+// Roster returns the support roster issues are assigned from
+func (t *GitHubTracker) Roster() *Roster {
+	return t.roster.Load()
+}
+
+// SetRoster replaces the support roster issues are assigned from
+func (t *GitHubTracker) SetRoster(roster *Roster) {
+	t.roster.Store(roster)
+}
+
+// SetRedactor sets the redactor applied to new tickets
+func (t *GitHubTracker) SetRedactor(redactor *Redactor) {
+	t.redactor = redactor
+}
+
+// SetLogger sets the logger ticket creation is logged to
+func (t *GitHubTracker) SetLogger(log *zap.Logger) {
+	t.logger = log
+}
+
+// Cleanup releases the tracker's idle connections
+func (t *GitHubTracker) Cleanup() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// login returns the GitHub login of a support team member, or an empty
+// string when the member has none
+func (t *GitHubTracker) login(accountID string) string {
+	if accountID == "" {
+		return ""
+	}
+	member, _ := t.Roster().FindMember(func(m RosterMember) bool { return m.AccountID == accountID })
+	return member.GitHub
+}
+
+// ticketID is the ticket ID of an issue number
+func (t *GitHubTracker) ticketID(number int) string {
+	return fmt.Sprintf("%s-%d", t.projectKey, number)
+}
+
+// issueNumber extracts the issue number of a ticket ID
+func (t *GitHubTracker) issueNumber(ticketID string) (string, error) {
+	number, ok := strings.CutPrefix(ticketID, t.projectKey+"-")
+	if _, err := strconv.Atoi(number); !ok || err != nil {
+		return "", fmt.Errorf("%s is not a ticket of GitHub repository %s", ticketID, t.repository)
+	}
+	return number, nil
+}
+
+func (t *GitHubTracker) issue(ctx context.Context, ticketID string) (*githubIssue, error) {
+	number, err := t.issueNumber(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	var issue githubIssue
+	if err := t.do(ctx, http.MethodGet, t.repoPath("issues", number), nil, &issue); err != nil {
+		return nil, fmt.Errorf("failed to get GitHub issue %s: %w", ticketID, err)
+	}
+	return &issue, nil
+}
+
+func (t *GitHubTracker) updateIssue(ctx context.Context, ticketID string, fields map[string]interface{}) error {
+	number, err := t.issueNumber(ticketID)
+	if err != nil {
+		return err
+	}
+	if err := t.do(ctx, http.MethodPatch, t.repoPath("issues", number), fields, nil); err != nil {
+		return fmt.Errorf("failed to update GitHub issue %s: %w", ticketID, err)
+	}
+	return nil
+}
+
+// repoPath is the API path of a resource of the repository
+func (t *GitHubTracker) repoPath(elem ...string) string {
+	return path.Join(append([]string{"/repos", t.repository}, elem...)...)
+}
+
+// do calls the GitHub API with a JSON body, decoding the response into out
+// when it is not nil. Its time counts towards the github stage of the
+// request it is made for.
+func (t *GitHubTracker) do(ctx context.Context, method, apiPath string, in, out interface{}) error {
+	defer logger.StartStage(ctx, "github")()
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, t.apiURL+apiPath, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		var detail struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&detail)
+		return &githubError{Status: resp.StatusCode, Message: detail.Message}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode GitHub response: %w", err)
+		}
+	}
+	return nil
+}
+
+// screenshotSection renders the screenshot of a new issue. With an
+// attachments branch the screenshot is committed to the repository, so it
+// outlives the presigned URL; otherwise, or if that fails, it is linked from
+// storage and re-signed while the issue is open.
+func (t *GitHubTracker) screenshotSection(ctx context.Context, req *models.TicketRequest, log *zap.Logger) string {
+	if t.attachmentsBranch != "" && req.QuarantineKey == "" && hasScreenshotURL(req) &&
+		strings.HasPrefix(req.ImageS3URL, "http") && !IsVideoContentType(req.ImageContentType) {
+		committed, err := t.commitAttachment(ctx, req)
+		if err == nil {
+			return renderScreenshot(githubMarkdown, req, committed, false)
+		}
+		log.Warn("Failed to commit screenshot to the attachments branch, linking it instead", zap.Error(err))
+	}
+	return renderScreenshot(githubMarkdown, req, req.ImageS3URL, true)
+}
+
+// commitAttachment downloads the screenshot of a report and commits it to
+// the attachments branch, returning the URL it is shown from
+func (t *GitHubTracker) commitAttachment(ctx context.Context, req *models.TicketRequest) (string, error) {
+	data, err := downloadScreenshot(ctx, t.client, req.ImageS3URL, githubAttachmentMaxSize)
+	if err != nil {
+		return "", err
+	}
+
+	name := screenshotName(req)
+	filePath := path.Join("attachments", time.Now().UTC().Format("2006/01/02"), name)
+
+	var result struct {
+		Content struct {
+			HTMLURL string `json:"html_url"`
+		} `json:"content"`
+	}
+	err = t.do(ctx, http.MethodPut, t.repoPath("contents", filePath), map[string]string{
+		"message": "Add report attachment " + name,
+		"content": base64.StdEncoding.EncodeToString(data),
+		"branch":  t.attachmentsBranch,
+	}, &result)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit screenshot: %w", err)
+	}
+	return result.Content.HTMLURL + "?raw=true", nil
+}
@@ -0,0 +1,478 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// gitlabUploadMaxSize caps the screenshots uploaded to a project; larger ones
+// are linked instead
+const gitlabUploadMaxSize = 25 << 20
+
+// gitlabMarkdown is GitLab Flavored Markdown. Descriptions and comments are
+// limited to 1,000,000 characters.
+var gitlabMarkdown = markdownDialect{
+	limit: 1000000,
+	collapse: func(title, content string) string {
+		return fmt.Sprintf("<details>\n<summary>%s</summary>\n\n```json\n%s\n```\n\n</details>\n\n", title, content)
+	},
+	image: func(url string) string {
+		return fmt.Sprintf("![Screenshot](%s){width=800}", url)
+	},
+	quarantineNote: "> [!warning]\n> The attachment of this report was flagged by the malware scanner and is pending review.",
+	purgedNote:     "> [!note]\n> The attachment of this report was removed after malware review.",
+}
+
+// GitLabTracker creates tickets as issues of a GitLab project. Ticket IDs are
+// the tracker's project key and the issue's IID, e.g. WEB-42.
+type GitLabTracker struct {
+	apiURL       string
+	project      string // ID or full path
+	token        string
+	projectKey   string
+	labels       []string
+	confidential bool
+	client       *http.Client
+
+	// users caches the IDs of GitLab users by username
+	users sync.Map
+
+	roster       atomic.Pointer[Roster] // replaced when the configuration is reloaded
+	mongoService *MongoDBService
+	redactor     *Redactor
+	logger       *zap.Logger
+}
+
+// NewGitLabTracker creates a tracker of the issues of a project, given by ID
+// or full path, on the GitLab instance at baseURL. New issues are labelled
+// with labels, and made confidential when confidential is set.
+func NewGitLabTracker(baseURL, project, token, projectKey string, labels []string, confidential bool, roster *Roster, mongoService *MongoDBService) *GitLabTracker {
+	t := &GitLabTracker{
+		apiURL:       strings.TrimSuffix(baseURL, "/") + "/api/v4",
+		project:      project,
+		token:        token,
+		projectKey:   projectKey,
+		labels:       labels,
+		confidential: confidential,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		mongoService: mongoService,
+		logger:       zap.NewNop(),
+	}
+	t.SetRoster(roster)
+	return t
+}
+
+// gitlabIssue is the part of the GitLab issue resource ronnin uses
+type gitlabIssue struct {
+	IID         int    `json:"iid"`
+	WebURL      string `json:"web_url"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+	Assignee    *struct {
+		Username string `json:"username"`
+	} `json:"assignee"`
+}
+
+// gitlabError is an error response of the GitLab API
+type gitlabError struct {
+	Status  int
+	Message string
+}
+
+func (e *gitlabError) Error() string {
+	return fmt.Sprintf("GitLab answered %d: %s", e.Status, e.Message)
+}
+
+// CreateTicket creates an issue for a report, assigned to the GitLab user of
+// the support team member on shift, and saves the ticket to MongoDB
+func (t *GitLabTracker) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
+	// Nothing sensitive is sent to GitLab or stored
+	req = t.redactor.Ticket(req)
+	log := logger.FromContext(ctx, t.logger).With(zap.String("project", t.project))
+
+	product, _ := req.Payload["product"].(string)
+	assignee := t.Roster().Assignee(ctx, product, time.Now())
+	assigneeIDs := []int{}
+	if userID := t.userID(ctx, assignee, log); userID != 0 {
+		assigneeIDs = append(assigneeIDs, userID)
+	}
+
+	// Severities and categories are scoped labels, so an issue has only one
+	labels := append([]string(nil), t.labels...)
+	if severity := TicketSeverity(req); severity != "" {
+		labels = append(labels, "severity::"+severity)
+	}
+	if req.Classification != nil {
+		labels = append(labels, "category::"+req.Classification.Category)
+	}
+
+	body, overflow := renderDescription(ctx, gitlabMarkdown, req, t.screenshotSection(ctx, req, log))
+
+	var issue gitlabIssue
+	start := time.Now()
+	err := t.do(ctx, http.MethodPost, t.projectPath("issues"), map[string]interface{}{
+		"title":        ticketTitle(req),
+		"description":  body,
+		"labels":       strings.Join(labels, ","),
+		"assignee_ids": assigneeIDs,
+		"confidential": t.confidential,
+	}, &issue)
+	latency := time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitLab issue: %w", err)
+	}
+
+	ticketsCreatedTotal.WithLabelValues(t.projectKey).Inc()
+	ticketID := t.ticketID(issue.IID)
+
+	// Sections that did not fit the description follow as comments
+	for _, section := range overflow {
+		if err := t.do(ctx, http.MethodPost, t.projectPath("issues", strconv.Itoa(issue.IID), "notes"), map[string]string{"body": section}, nil); err != nil {
+			log.Warn("Failed to add comment with truncated content", zap.String("ticket_id", ticketID), zap.Error(err))
+		}
+	}
+
+	ticketResponse := &models.TicketResponse{
+		TicketID:   ticketID,
+		Status:     "created",
+		AssignedTo: assignee,
+		JiraLink:   issue.WebURL,
+	}
+	saveTicket(ctx, t.mongoService, req, ticketResponse, latency, log)
+	return ticketResponse, nil
+}
+
+// IsTicketOpen reports whether an issue is still open
+func (t *GitLabTracker) IsTicketOpen(ctx context.Context, ticketID string) (bool, error) {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return false, err
+	}
+	return issue.State == "opened", nil
+}
+
+// GetTicketState fetches the state and assignee of an issue; closed issues
+// are resolved as "closed". Assignees are given by Jira account when they
+// are on the roster.
+func (t *GitLabTracker) GetTicketState(ctx context.Context, ticketID string) (*TicketState, error) {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	return t.issueState(issue), nil
+}
+
+// GetTicketStates fetches the state of several issues, one request each.
+// Issues that do not exist are missing from the result.
+func (t *GitLabTracker) GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error) {
+	states := make(map[string]*TicketState, len(ticketIDs))
+	for _, id := range ticketIDs {
+		issue, err := t.issue(ctx, id)
+		var notFound *gitlabError
+		if errors.As(err, &notFound) && notFound.Status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		states[id] = t.issueState(issue)
+	}
+	return states, nil
+}
+
+func (t *GitLabTracker) issueState(issue *gitlabIssue) *TicketState {
+	state := &TicketState{Status: issue.State}
+	if issue.State == "closed" {
+		state.Resolution = issue.State
+	}
+	if issue.Assignee != nil {
+		state.AssignedTo = issue.Assignee.Username
+		if member, ok := t.Roster().FindMember(func(m RosterMember) bool { return strings.EqualFold(m.GitLab, issue.Assignee.Username) }); ok {
+			state.AssignedTo = member.AccountID
+		}
+	}
+	return state
+}
+
+// AssignTicket makes the GitLab user of a support team member the only
+// assignee of an issue
+func (t *GitLabTracker) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	userID := t.userID(ctx, accountID, logger.FromContext(ctx, t.logger))
+	if userID == 0 {
+		return fmt.Errorf("support team member %s has no GitLab user", accountID)
+	}
+	return t.updateIssue(ctx, ticketID, map[string]interface{}{"assignee_ids": []int{userID}})
+}
+
+// AddComment adds a comment to an issue on behalf of author, since comments
+// are posted as the token's user
+func (t *GitLabTracker) AddComment(ctx context.Context, ticketID, author, body string) error {
+	iid, err := t.issueIID(ticketID)
+	if err != nil {
+		return err
+	}
+	comment := fmt.Sprintf("**%s** via ronnin:\n\n%s", author, t.redactor.String(body))
+	if err := t.do(ctx, http.MethodPost, t.projectPath("issues", iid, "notes"), map[string]string{"body": comment}, nil); err != nil {
+		return fmt.Errorf("failed to comment on GitLab issue %s: %w", ticketID, err)
+	}
+	return nil
+}
+
+// ReplaceDescriptionText replaces every occurrence of oldText in an issue's
+// description. It is a no-op when the description does not contain oldText.
+func (t *GitLabTracker) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(issue.Description, oldText) {
+		return nil
+	}
+	return t.updateIssue(ctx, ticketID, map[string]interface{}{"description": strings.ReplaceAll(issue.Description, oldText, newText)})
+}
+
+// ReleaseScreenshot shows a released screenshot in place of the quarantine
+// note of an issue
+func (t *GitLabTracker) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return t.ReplaceDescriptionText(ctx, ticketID, gitlabMarkdown.quarantineNote, gitlabMarkdown.screenshot(imageURL, contentType))
+}
+
+// RemoveScreenshot notes the removal of an issue's quarantined screenshot
+func (t *GitLabTracker) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return t.ReplaceDescriptionText(ctx, ticketID, gitlabMarkdown.quarantineNote, gitlabMarkdown.purgedNote)
+}
+
+// Ping checks that the project can be read with the token
+func (t *GitLabTracker) Ping(ctx context.Context) error {
+	if err := t.do(ctx, http.MethodGet, t.projectPath(), nil, nil); err != nil {
+		return fmt.Errorf("failed to reach GitLab: %w", err)
+	}
+	return nil
+}
+
+// Kind returns TrackerGitLab
+func (t *GitLabTracker) Kind() string {
+	return TrackerGitLab
+}
+
+// ProjectKey returns the prefix of the tracker's ticket IDs
+func (t *GitLabTracker) ProjectKey() string {
+	return t.projectKey
+}
+
+// Roster returns the support roster issues are assigned from
+func (t *GitLabTracker) Roster() *Roster {
+	return t.roster.Load()
+}
+
+// SetRoster replaces the support roster issues are assigned from
+func (t *GitLabTracker) SetRoster(roster *Roster) {
+	t.roster.Store(roster)
+}
+
+// SetRedactor sets the redactor applied to new tickets
+func (t *GitLabTracker) SetRedactor(redactor *Redactor) {
+	t.redactor = redactor
+}
+
+// SetLogger sets the logger ticket creation is logged to
+func (t *GitLabTracker) SetLogger(log *zap.Logger) {
+	t.logger = log
+}
+
+// Cleanup releases the tracker's idle connections
+func (t *GitLabTracker) Cleanup() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// userID returns the ID of the GitLab user of a support team member, or 0
+// when the member has none
+func (t *GitLabTracker) userID(ctx context.Context, accountID string, log *zap.Logger) int {
+	if accountID == "" {
+		return 0
+	}
+	member, _ := t.Roster().FindMember(func(m RosterMember) bool { return m.AccountID == accountID })
+	if member.GitLab == "" {
+		return 0
+	}
+	if id, ok := t.users.Load(member.GitLab); ok {
+		return id.(int)
+	}
+
+	var users []struct {
+		ID int `json:"id"`
+	}
+	if err := t.do(ctx, http.MethodGet, "/users?username="+url.QueryEscape(member.GitLab), nil, &users); err != nil {
+		log.Warn("Failed to look up GitLab user", zap.String("account_id", accountID), zap.Error(err))
+		return 0
+	}
+	if len(users) == 0 {
+		log.Warn("GitLab user does not exist", zap.String("account_id", accountID), zap.String("username", member.GitLab))
+		return 0
+	}
+	t.users.Store(member.GitLab, users[0].ID)
+	return users[0].ID
+}
+
+// ticketID is the ticket ID of an issue IID
+func (t *GitLabTracker) ticketID(iid int) string {
+	return fmt.Sprintf("%s-%d", t.projectKey, iid)
+}
+
+// issueIID extracts the issue IID of a ticket ID
+func (t *GitLabTracker) issueIID(ticketID string) (string, error) {
+	iid, ok := strings.CutPrefix(ticketID, t.projectKey+"-")
+	if _, err := strconv.Atoi(iid); !ok || err != nil {
+		return "", fmt.Errorf("%s is not a ticket of GitLab project %s", ticketID, t.project)
+	}
+	return iid, nil
+}
+
+func (t *GitLabTracker) issue(ctx context.Context, ticketID string) (*gitlabIssue, error) {
+	iid, err := t.issueIID(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	var issue gitlabIssue
+	if err := t.do(ctx, http.MethodGet, t.projectPath("issues", iid), nil, &issue); err != nil {
+		return nil, fmt.Errorf("failed to get GitLab issue %s: %w", ticketID, err)
+	}
+	return &issue, nil
+}
+
+func (t *GitLabTracker) updateIssue(ctx context.Context, ticketID string, fields map[string]interface{}) error {
+	iid, err := t.issueIID(ticketID)
+	if err != nil {
+		return err
+	}
+	if err := t.do(ctx, http.MethodPut, t.projectPath("issues", iid), fields, nil); err != nil {
+		return fmt.Errorf("failed to update GitLab issue %s: %w", ticketID, err)
+	}
+	return nil
+}
+
+// projectPath is the API path of a resource of the project. Project paths
+// are URL-encoded as a single segment.
+func (t *GitLabTracker) projectPath(elem ...string) string {
+	return "/projects/" + url.PathEscape(t.project) + strings.TrimSuffix("/"+strings.Join(elem, "/"), "/")
+}
+
+// do calls the GitLab API with a JSON body, decoding the response into out
+// when it is not nil. Its time counts towards the gitlab stage of the
+// request it is made for.
+func (t *GitLabTracker) do(ctx context.Context, method, apiPath string, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	return t.send(ctx, method, apiPath, body, contentType, out)
+}
+
+func (t *GitLabTracker) send(ctx context.Context, method, apiPath string, body io.Reader, contentType string, out interface{}) error {
+	defer logger.StartStage(ctx, "gitlab")()
+
+	req, err := http.NewRequestWithContext(ctx, method, t.apiURL+apiPath, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", t.token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		// The message is a string, or an object of messages by field
+		var detail struct {
+			Message json.RawMessage `json:"message"`
+			Error   string          `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&detail)
+		message := detail.Error
+		if len(detail.Message) > 0 {
+			message = strings.Trim(string(detail.Message), `"`)
+		}
+		return &gitlabError{Status: resp.StatusCode, Message: message}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode GitLab response: %w", err)
+		}
+	}
+	return nil
+}
+
+// screenshotSection renders the screenshot of a new issue. The screenshot is
+// uploaded to the project, so it outlives the presigned URL; if that fails,
+// it is linked from storage and re-signed while the issue is open.
+func (t *GitLabTracker) screenshotSection(ctx context.Context, req *models.TicketRequest, log *zap.Logger) string {
+	if req.QuarantineKey == "" && hasScreenshotURL(req) && strings.HasPrefix(req.ImageS3URL, "http") {
+		uploaded, err := t.upload(ctx, req)
+		if err == nil {
+			return renderScreenshot(gitlabMarkdown, req, uploaded, false)
+		}
+		log.Warn("Failed to upload screenshot to GitLab, linking it instead", zap.Error(err))
+	}
+	return renderScreenshot(gitlabMarkdown, req, req.ImageS3URL, true)
+}
+
+// upload downloads the screenshot of a report and uploads it to the project,
+// returning the URL it is shown from
+func (t *GitLabTracker) upload(ctx context.Context, req *models.TicketRequest) (string, error) {
+	data, err := downloadScreenshot(ctx, t.client, req.ImageS3URL, gitlabUploadMaxSize)
+	if err != nil {
+		return "", err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", screenshotName(req))
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	var result struct {
+		URL      string `json:"url"`
+		FullPath string `json:"full_path"`
+	}
+	if err := t.send(ctx, http.MethodPost, t.projectPath("uploads"), &body, form.FormDataContentType(), &result); err != nil {
+		return "", fmt.Errorf("failed to upload screenshot: %w", err)
+	}
+	// The URL is relative to the project, which is how GitLab links uploads
+	// in descriptions; the full path is relative to the instance
+	if result.FullPath != "" {
+		return strings.TrimSuffix(t.apiURL, "/api/v4") + result.FullPath, nil
+	}
+	return result.URL, nil
+}
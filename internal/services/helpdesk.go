@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Helpdesk providers
+const (
+	HelpdeskProviderNone      = "none"
+	HelpdeskProviderZendesk   = "zendesk"
+	HelpdeskProviderFreshdesk = "freshdesk"
+)
+
+// Helpdesk ticket statuses, which each provider maps to its own
+const (
+	HelpdeskStatusOpen    = "open"
+	HelpdeskStatusPending = "pending"
+	HelpdeskStatusSolved  = "solved"
+)
+
+// helpdeskQueueSize bounds the helpdesk updates waiting to be made; further
+// ones are dropped rather than holding up reports and webhooks
+const helpdeskQueueSize = 100
+
+// helpdeskTimeout bounds one helpdesk update
+const helpdeskTimeout = 30 * time.Second
+
+// Replies posted to reporters when their issue is resolved or reopened
+const (
+	helpdeskSolvedReply   = "Good news: the issue you reported has been fixed. Reply to this ticket if you still run into it."
+	helpdeskReopenedReply = "We are looking into the issue you reported again and will update you here."
+)
+
+// HelpdeskTicket is a customer-visible ticket opened for a report
+type HelpdeskTicket struct {
+	// Requester is the email of the reporter, who can see the ticket
+	Requester   string
+	Subject     string
+	Description string
+	Product     string
+	Severity    string
+	// TicketID and TrackerLink are the internal ticket of the report,
+	// linked in a private note
+	TicketID    string
+	TrackerLink string
+}
+
+// HelpdeskRef identifies a helpdesk ticket
+type HelpdeskRef struct {
+	ID  string
+	URL string
+}
+
+// Helpdesk opens and updates customer support tickets
+type Helpdesk interface {
+	// Name is the provider's display name, e.g. Zendesk
+	Name() string
+	// CreateTicket opens a ticket for the requester, noting the internal
+	// ticket privately
+	CreateTicket(ctx context.Context, ticket HelpdeskTicket) (*HelpdeskRef, error)
+	// UpdateTicket sets the status of a ticket, replying to the requester
+	// when reply is not empty
+	UpdateTicket(ctx context.Context, id, status, reply string) error
+}
+
+// HelpdeskEvent is a change to a helpdesk ticket, sent by a helpdesk webhook
+type HelpdeskEvent struct {
+	HelpdeskTicketID string
+	Status           string
+	// Comment is a reply of the requester, if the change added one
+	Comment string
+	Author  string
+}
+
+// helpdeskJob is a helpdesk update waiting to be made: the creation of a
+// ticket, or a status change of the helpdesk ticket of ticketID
+type helpdeskJob struct {
+	create   *HelpdeskTicket
+	ticketID string
+	id       string
+	status   string
+	reply    string
+}
+
+// HelpdeskSync opens helpdesk tickets for reports with a reporter email and
+// keeps their status in sync with the internal tickets: resolving an
+// internal ticket solves its helpdesk ticket, and the requester's replies
+// and status changes are added to the internal ticket as comments. Helpdesk
+// updates are made in the background by Run.
+type HelpdeskSync struct {
+	helpdesk     Helpdesk
+	trackers     *JiraRegistry
+	mongoService *MongoDBService
+	// products limits helpdesk tickets to the reports of these products
+	products map[string]bool
+	logger   *zap.Logger
+
+	queue chan helpdeskJob
+}
+
+// NewHelpdeskSync creates a sync between helpdesk and the internal tickets
+// of trackers. Without mongoService, helpdesk tickets are opened but not
+// synced. Empty products open helpdesk tickets for every product.
+func NewHelpdeskSync(helpdesk Helpdesk, trackers *JiraRegistry, mongoService *MongoDBService, products []string, log *zap.Logger) *HelpdeskSync {
+	h := &HelpdeskSync{
+		helpdesk:     helpdesk,
+		trackers:     trackers,
+		mongoService: mongoService,
+		logger:       log,
+		queue:        make(chan helpdeskJob, helpdeskQueueSize),
+	}
+	if len(products) > 0 {
+		h.products = make(map[string]bool, len(products))
+		for _, product := range products {
+			h.products[product] = true
+		}
+	}
+	return h
+}
+
+// TicketCreated queues opening a helpdesk ticket for a new internal ticket
+// whose report has a reporter email. It never blocks.
+func (h *HelpdeskSync) TicketCreated(ticket HelpdeskTicket) {
+	if ticket.Requester == "" || (h.products != nil && !h.products[ticket.Product]) {
+		return
+	}
+	h.enqueue(helpdeskJob{create: &ticket, ticketID: ticket.TicketID})
+}
+
+// TicketStateChanged queues solving the helpdesk ticket of an internal
+// ticket that was resolved, or reopening it when the internal ticket was
+// reopened. ticket is the stored ticket before the change.
+func (h *HelpdeskSync) TicketStateChanged(ticket *FlattenedTicket, state *TicketState) {
+	if ticket.HelpdeskTicketID == "" {
+		return
+	}
+	wasResolved, resolved := ticket.Resolution != "", state.Resolution != ""
+	switch {
+	case resolved && !wasResolved && ticket.HelpdeskStatus != HelpdeskStatusSolved:
+		h.enqueue(helpdeskJob{ticketID: ticket.TicketID, id: ticket.HelpdeskTicketID, status: HelpdeskStatusSolved, reply: helpdeskSolvedReply})
+	case !resolved && wasResolved && ticket.HelpdeskStatus == HelpdeskStatusSolved:
+		h.enqueue(helpdeskJob{ticketID: ticket.TicketID, id: ticket.HelpdeskTicketID, status: HelpdeskStatusOpen, reply: helpdeskReopenedReply})
+	}
+}
+
+// HelpdeskUpdated applies a change to a helpdesk ticket: the requester's
+// comment, or else a change of status, is added to the internal ticket, and
+// the status is stored. Changes ronnin made itself are recognized by their
+// stored status and not commented on.
+func (h *HelpdeskSync) HelpdeskUpdated(ctx context.Context, event HelpdeskEvent) (*FlattenedTicket, error) {
+	if h.mongoService == nil {
+		return nil, fmt.Errorf("MongoDB is not configured")
+	}
+	ticket, err := h.mongoService.GetTicketByHelpdeskID(ctx, event.HelpdeskTicketID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := NormalizeHelpdeskStatus(event.Status)
+	author := event.Author
+	if author == "" {
+		author = "Reporter"
+	}
+	ref := fmt.Sprintf("%s ticket %s", h.helpdesk.Name(), event.HelpdeskTicketID)
+
+	var comment string
+	switch {
+	case event.Comment != "":
+		comment = fmt.Sprintf("Replied on %s:\n\n%s", ref, event.Comment)
+	case status != "" && status != ticket.HelpdeskStatus:
+		comment = fmt.Sprintf("%s is now %s", ref, status)
+	}
+	if comment != "" {
+		if err := h.trackers.AddComment(ctx, ticket.TicketID, author, comment); err != nil {
+			return nil, err
+		}
+	}
+
+	if status != "" && status != ticket.HelpdeskStatus {
+		if err := h.mongoService.UpdateTicketHelpdesk(ctx, ticket.TicketID, "", "", status); err != nil {
+			return nil, err
+		}
+		ticket.HelpdeskStatus = status
+	}
+	return ticket, nil
+}
+
+// NormalizeHelpdeskStatus maps the status names of the providers to the
+// HelpdeskStatus values, keeping others lowercase as given
+func NormalizeHelpdeskStatus(status string) string {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch status {
+	case "new", "open", "hold", "on-hold":
+		return HelpdeskStatusOpen
+	case "resolved", "solved", "closed":
+		return HelpdeskStatusSolved
+	}
+	return status
+}
+
+func (h *HelpdeskSync) enqueue(job helpdeskJob) {
+	select {
+	case h.queue <- job:
+	default:
+		h.logger.Warn("Helpdesk queue is full, dropping update", zap.String("ticket_id", job.ticketID))
+	}
+}
+
+// Run makes queued helpdesk updates until stopping is closed, then makes the
+// ones still queued until none are left or ctx is done
+func (h *HelpdeskSync) Run(ctx context.Context, stopping <-chan struct{}) {
+	for {
+		select {
+		case job := <-h.queue:
+			h.process(ctx, job)
+		case <-stopping:
+			for ctx.Err() == nil {
+				select {
+				case job := <-h.queue:
+					h.process(ctx, job)
+				default:
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+// process makes a queued helpdesk update
+func (h *HelpdeskSync) process(ctx context.Context, job helpdeskJob) {
+	log := h.logger.With(zap.String("ticket_id", job.ticketID))
+	ctx, cancel := context.WithTimeout(ctx, helpdeskTimeout)
+	defer cancel()
+
+	if job.create != nil {
+		ref, err := h.helpdesk.CreateTicket(ctx, *job.create)
+		if err != nil {
+			log.Warn("Failed to open helpdesk ticket", zap.Error(err))
+			return
+		}
+		log.Info("Opened helpdesk ticket", zap.String("helpdesk_ticket_id", ref.ID))
+		if err := h.trackers.AddComment(ctx, job.ticketID, "ronnin", fmt.Sprintf("The reporter can follow this issue on %s ticket %s: %s", h.helpdesk.Name(), ref.ID, ref.URL)); err != nil {
+			log.Warn("Failed to link helpdesk ticket", zap.Error(err))
+		}
+		h.store(ctx, job.ticketID, ref.ID, ref.URL, HelpdeskStatusOpen, log)
+		return
+	}
+
+	if err := h.helpdesk.UpdateTicket(ctx, job.id, job.status, job.reply); err != nil {
+		log.Warn("Failed to update helpdesk ticket", zap.String("helpdesk_ticket_id", job.id), zap.Error(err))
+		return
+	}
+	h.store(ctx, job.ticketID, "", "", job.status, log)
+}
+
+// store saves the helpdesk ticket of a ticket when MongoDB is configured
+func (h *HelpdeskSync) store(ctx context.Context, ticketID, helpdeskID, link, status string, log *zap.Logger) {
+	if h.mongoService == nil {
+		return
+	}
+	if err := h.mongoService.UpdateTicketHelpdesk(ctx, ticketID, helpdeskID, link, status); err != nil {
+		log.Warn("Failed to store helpdesk ticket", zap.Error(err))
+	}
+}
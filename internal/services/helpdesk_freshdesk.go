@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Freshdesk ticket statuses and sources
+const (
+	freshdeskStatusOpen     = 2
+	freshdeskStatusPending  = 3
+	freshdeskStatusResolved = 4
+	freshdeskSourcePortal   = 2
+)
+
+// freshdeskStatuses are the Freshdesk statuses of HelpdeskStatus values
+var freshdeskStatuses = map[string]int{
+	HelpdeskStatusOpen:    freshdeskStatusOpen,
+	HelpdeskStatusPending: freshdeskStatusPending,
+	HelpdeskStatusSolved:  freshdeskStatusResolved,
+}
+
+// freshdeskPriorities are the Freshdesk priorities of report severities,
+// from 1 (low) to 4 (urgent)
+var freshdeskPriorities = map[string]int{
+	SeverityCritical: 4,
+	SeverityHigh:     3,
+	SeverityMedium:   2,
+	SeverityLow:      1,
+}
+
+// FreshdeskHelpdesk opens tickets in Freshdesk through its REST API,
+// authenticated with an agent's API key
+type FreshdeskHelpdesk struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewFreshdeskHelpdesk creates a helpdesk for the Freshdesk account at
+// baseURL, e.g. https://acme.freshdesk.com
+func NewFreshdeskHelpdesk(baseURL, apiKey string) *FreshdeskHelpdesk {
+	return &FreshdeskHelpdesk{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: helpdeskTimeout},
+	}
+}
+
+// Name returns Freshdesk
+func (f *FreshdeskHelpdesk) Name() string {
+	return "Freshdesk"
+}
+
+// CreateTicket opens a ticket on behalf of the requester and notes the
+// internal ticket in a private note
+func (f *FreshdeskHelpdesk) CreateTicket(ctx context.Context, ticket HelpdeskTicket) (*HelpdeskRef, error) {
+	priority := freshdeskPriorities[ticket.Severity]
+	if priority == 0 {
+		priority = freshdeskPriorities[SeverityLow]
+	}
+
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	err := f.do(ctx, http.MethodPost, "/api/v2/tickets", map[string]interface{}{
+		"email":       ticket.Requester,
+		"subject":     ticket.Subject,
+		"description": freshdeskHTML(ticket.Description),
+		"status":      freshdeskStatusOpen,
+		"priority":    priority,
+		"source":      freshdeskSourcePortal,
+		"tags":        helpdeskTags(ticket),
+	}, &created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Freshdesk ticket: %w", err)
+	}
+	id := strconv.FormatInt(created.ID, 10)
+
+	err = f.do(ctx, http.MethodPost, "/api/v2/tickets/"+id+"/notes", map[string]interface{}{
+		"body":    freshdeskHTML(fmt.Sprintf("Tracked internally as %s: %s", ticket.TicketID, ticket.TrackerLink)),
+		"private": true,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to note internal ticket on Freshdesk ticket %s: %w", id, err)
+	}
+
+	return &HelpdeskRef{ID: id, URL: f.baseURL + "/a/tickets/" + id}, nil
+}
+
+// UpdateTicket replies to the requester when reply is not empty, then sets
+// the status of a ticket, since replying reopens resolved tickets
+func (f *FreshdeskHelpdesk) UpdateTicket(ctx context.Context, id, status, reply string) error {
+	code, ok := freshdeskStatuses[status]
+	if !ok {
+		return fmt.Errorf("unknown helpdesk status %q", status)
+	}
+	if reply != "" {
+		if err := f.do(ctx, http.MethodPost, "/api/v2/tickets/"+id+"/reply", map[string]string{"body": freshdeskHTML(reply)}, nil); err != nil {
+			return fmt.Errorf("failed to reply on Freshdesk ticket %s: %w", id, err)
+		}
+	}
+	if err := f.do(ctx, http.MethodPut, "/api/v2/tickets/"+id, map[string]int{"status": code}, nil); err != nil {
+		return fmt.Errorf("failed to update Freshdesk ticket %s: %w", id, err)
+	}
+	return nil
+}
+
+// do calls the Freshdesk API with a JSON body, decoding the response into
+// out when it is not nil
+func (f *FreshdeskHelpdesk) do(ctx context.Context, method, apiPath string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, f.baseURL+apiPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// The API key is the user name; the password is ignored
+	req.SetBasicAuth(f.apiKey, "X")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Freshdesk answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode Freshdesk response: %w", err)
+		}
+	}
+	return nil
+}
+
+// freshdeskHTML renders plain text as the HTML Freshdesk expects
+func freshdeskHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
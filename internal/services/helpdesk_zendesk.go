@@ -0,0 +1,134 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// zendeskPriorities are the Zendesk priorities of report severities
+var zendeskPriorities = map[string]string{
+	SeverityCritical: "urgent",
+	SeverityHigh:     "high",
+	SeverityMedium:   "normal",
+	SeverityLow:      "low",
+}
+
+// ZendeskHelpdesk opens tickets in Zendesk Support through its REST API,
+// authenticated with an agent's API token
+type ZendeskHelpdesk struct {
+	baseURL  string
+	email    string
+	apiToken string
+	client   *http.Client
+}
+
+// NewZendeskHelpdesk creates a helpdesk for the Zendesk account at baseURL,
+// e.g. https://acme.zendesk.com, acting as the agent with email
+func NewZendeskHelpdesk(baseURL, email, apiToken string) *ZendeskHelpdesk {
+	return &ZendeskHelpdesk{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		email:    email,
+		apiToken: apiToken,
+		client:   &http.Client{Timeout: helpdeskTimeout},
+	}
+}
+
+// Name returns Zendesk
+func (z *ZendeskHelpdesk) Name() string {
+	return "Zendesk"
+}
+
+// CreateTicket opens a ticket on behalf of the requester, whose description
+// is its first public comment, and notes the internal ticket in a private
+// comment. The internal ticket ID is also the ticket's external ID.
+func (z *ZendeskHelpdesk) CreateTicket(ctx context.Context, ticket HelpdeskTicket) (*HelpdeskRef, error) {
+	fields := map[string]interface{}{
+		"subject":     ticket.Subject,
+		"comment":     map[string]interface{}{"body": ticket.Description, "public": true},
+		"requester":   map[string]string{"email": ticket.Requester},
+		"external_id": ticket.TicketID,
+		"tags":        helpdeskTags(ticket),
+	}
+	if priority := zendeskPriorities[ticket.Severity]; priority != "" {
+		fields["priority"] = priority
+	}
+
+	var created struct {
+		Ticket struct {
+			ID int64 `json:"id"`
+		} `json:"ticket"`
+	}
+	if err := z.do(ctx, http.MethodPost, "/api/v2/tickets.json", map[string]interface{}{"ticket": fields}, &created); err != nil {
+		return nil, fmt.Errorf("failed to create Zendesk ticket: %w", err)
+	}
+	id := strconv.FormatInt(created.Ticket.ID, 10)
+
+	note := map[string]interface{}{"comment": map[string]interface{}{
+		"body":   fmt.Sprintf("Tracked internally as %s: %s", ticket.TicketID, ticket.TrackerLink),
+		"public": false,
+	}}
+	if err := z.do(ctx, http.MethodPut, "/api/v2/tickets/"+id+".json", map[string]interface{}{"ticket": note}, nil); err != nil {
+		return nil, fmt.Errorf("failed to note internal ticket on Zendesk ticket %s: %w", id, err)
+	}
+
+	return &HelpdeskRef{ID: id, URL: z.baseURL + "/agent/tickets/" + id}, nil
+}
+
+// UpdateTicket sets the status of a ticket, with a public reply when reply
+// is not empty
+func (z *ZendeskHelpdesk) UpdateTicket(ctx context.Context, id, status, reply string) error {
+	fields := map[string]interface{}{"status": status}
+	if reply != "" {
+		fields["comment"] = map[string]interface{}{"body": reply, "public": true}
+	}
+	if err := z.do(ctx, http.MethodPut, "/api/v2/tickets/"+id+".json", map[string]interface{}{"ticket": fields}, nil); err != nil {
+		return fmt.Errorf("failed to update Zendesk ticket %s: %w", id, err)
+	}
+	return nil
+}
+
+// do calls the Zendesk API with a JSON body, decoding the response into out
+// when it is not nil
+func (z *ZendeskHelpdesk) do(ctx context.Context, method, apiPath string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, z.baseURL+apiPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(z.email+"/token", z.apiToken)
+
+	resp, err := z.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Zendesk answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode Zendesk response: %w", err)
+		}
+	}
+	return nil
+}
+
+// helpdeskTags are the tags of a helpdesk ticket: ronnin and the product
+func helpdeskTags(ticket HelpdeskTicket) []string {
+	tags := []string{"ronnin"}
+	if ticket.Product != "" {
+		tags = append(tags, ticket.Product)
+	}
+	return tags
+}
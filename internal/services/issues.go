@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxIssueTickets caps the tickets listed per issue
+const maxIssueTickets = 100
+
+// fingerprintBatchSize is the number of tickets fingerprinted per write
+const fingerprintBatchSize = 500
+
+// IssueFilter selects the tickets grouped into issues
+type IssueFilter struct {
+	// Scope limits the issues to those of the tickets in scope
+	Scope TicketScope
+	// Product limits the issues to those of a product
+	Product string
+	// Since leaves out tickets created before it, when set
+	Since time.Time
+}
+
+// issueGroup is a fingerprint's tickets as aggregated by IssueGroups
+type issueGroup struct {
+	Fingerprint string               `bson:"_id"`
+	Issue       string               `bson:"issue"`
+	Product     string               `bson:"product"`
+	FailedCalls string               `bson:"failed_calls"`
+	Tickets     []models.IssueTicket `bson:"tickets"`
+	TicketCount int64                `bson:"ticket_count"`
+	Occurrences int64                `bson:"occurrences"`
+	Users       []string             `bson:"users"`
+	FirstSeen   time.Time            `bson:"first_seen"`
+	LastSeen    time.Time            `bson:"last_seen"`
+}
+
+// IssueGroups groups tickets by fingerprint into issues, most recently seen
+// first, and returns those from skip up to limit with the number of issues.
+// Reports coalesced into the tickets count towards their issue.
+func (s *MongoDBService) IssueGroups(ctx context.Context, filter IssueFilter, skip, limit int64) ([]models.IssueGroup, int64, error) {
+	match := filter.Scope.filter()
+	match["fingerprint"] = bson.M{"$exists": true, "$ne": ""}
+	if filter.Product != "" {
+		if len(filter.Scope.Products) > 0 {
+			match["product"] = bson.M{"$in": filter.Scope.Products, "$eq": filter.Product}
+		} else {
+			match["product"] = filter.Product
+		}
+	}
+	if !filter.Since.IsZero() {
+		match["created_at"] = bson.M{"$gte": filter.Since}
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$sort": bson.D{{Key: "created_at", Value: -1}}},
+		bson.M{"$group": bson.M{
+			"_id":          "$fingerprint",
+			"issue":        bson.M{"$first": "$issue"},
+			"product":      bson.M{"$first": "$product"},
+			"failed_calls": bson.M{"$first": "$failed_network_calls_json"},
+			"tickets": bson.M{"$push": bson.M{
+				"ticket_id":  "$ticket_id",
+				"jira_link":  "$jira_link",
+				"status":     "$status",
+				"created_at": "$created_at",
+			}},
+			"ticket_count": bson.M{"$sum": 1},
+			"occurrences":  bson.M{"$sum": bson.M{"$ifNull": bson.A{"$occurrences", 0}}},
+			"users":        bson.M{"$addToSet": "$user_email"},
+			"first_seen":   bson.M{"$min": "$created_at"},
+			"last_seen":    bson.M{"$max": "$created_at"},
+		}},
+		bson.M{"$sort": bson.D{{Key: "last_seen", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{"$facet": bson.M{
+			"groups": bson.A{
+				bson.M{"$skip": skip},
+				bson.M{"$limit": limit},
+				bson.M{"$set": bson.M{"tickets": bson.M{"$slice": bson.A{"$tickets", maxIssueTickets}}}},
+			},
+			"total": bson.A{bson.M{"$count": "count"}},
+		}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to group tickets into issues: %w", err)
+	}
+	var result []struct {
+		Groups []issueGroup `bson:"groups"`
+		Total  []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode issues: %w", err)
+	}
+	if len(result) == 0 || len(result[0].Total) == 0 {
+		return nil, 0, nil
+	}
+	groups := result[0].Groups
+
+	// Coalesced reports were not given tickets, but their reporters are
+	// affected too and they may be more recent
+	fingerprints := make([]string, len(groups))
+	for i, group := range groups {
+		fingerprints[i] = group.Fingerprint
+	}
+	occurrences, err := s.occurrencesByFingerprint(ctx, fingerprints, filter.Since)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	issues := make([]models.IssueGroup, len(groups))
+	for i, group := range groups {
+		users := make(map[string]struct{})
+		for _, user := range group.Users {
+			users[strings.ToLower(user)] = struct{}{}
+		}
+		lastSeen := group.LastSeen
+		if extra, ok := occurrences[group.Fingerprint]; ok {
+			for _, user := range extra.Users {
+				users[strings.ToLower(user)] = struct{}{}
+			}
+			if extra.LastSeen.After(lastSeen) {
+				lastSeen = extra.LastSeen
+			}
+		}
+		delete(users, "")
+
+		var endpoints []string
+		for _, endpoint := range failedEndpoints(group.FailedCalls) {
+			endpoints = append(endpoints, strings.ToUpper(endpoint.method)+" "+endpointPattern(endpoint.path))
+		}
+		issues[i] = models.IssueGroup{
+			Fingerprint:   group.Fingerprint,
+			Title:         group.Issue,
+			Product:       group.Product,
+			Endpoints:     endpoints,
+			Reports:       group.TicketCount + group.Occurrences,
+			AffectedUsers: int64(len(users)),
+			FirstSeen:     group.FirstSeen,
+			LastSeen:      lastSeen,
+			Tickets:       group.Tickets,
+			TicketCount:   group.TicketCount,
+		}
+	}
+	return issues, result[0].Total[0].Count, nil
+}
+
+// fingerprintOccurrences are the reporters and latest time of the reports
+// of a fingerprint coalesced into its tickets
+type fingerprintOccurrences struct {
+	Fingerprint string    `bson:"_id"`
+	Users       []string  `bson:"users"`
+	LastSeen    time.Time `bson:"last_seen"`
+}
+
+func (s *MongoDBService) occurrencesByFingerprint(ctx context.Context, fingerprints []string, since time.Time) (map[string]fingerprintOccurrences, error) {
+	if len(fingerprints) == 0 {
+		return nil, nil
+	}
+	match := bson.M{"fingerprint": bson.M{"$in": fingerprints}}
+	if !since.IsZero() {
+		match["at"] = bson.M{"$gte": since}
+	}
+	cursor, err := s.database.Collection(occurrencesCollection).Aggregate(ctx, bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{
+			"_id":       "$fingerprint",
+			"users":     bson.M{"$addToSet": "$user_email"},
+			"last_seen": bson.M{"$max": "$at"},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to group report occurrences: %w", err)
+	}
+	var groups []fingerprintOccurrences
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode report occurrences: %w", err)
+	}
+	byFingerprint := make(map[string]fingerprintOccurrences, len(groups))
+	for _, group := range groups {
+		byFingerprint[group.Fingerprint] = group
+	}
+	return byFingerprint, nil
+}
+
+// FingerprintTickets sets the fingerprint of tickets stored before tickets
+// were fingerprinted, from their stored report. It can be stopped and run
+// again, as fingerprinted tickets are skipped.
+func (s *MongoDBService) FingerprintTickets(ctx context.Context) error {
+	cursor, err := s.collection.Find(ctx, bson.M{"fingerprint": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"issue": 1, "product": 1, "failed_network_calls_json": 1, "payload_json": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to find tickets without fingerprint: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	updates := make([]mongo.WriteModel, 0, fingerprintBatchSize)
+	flush := func() error {
+		if len(updates) == 0 {
+			return nil
+		}
+		if _, err := s.collection.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("failed to fingerprint tickets: %w", err)
+		}
+		updates = updates[:0]
+		return nil
+	}
+	for cursor.Next(ctx) {
+		var ticket FlattenedTicket
+		if err := cursor.Decode(&ticket); err != nil {
+			return fmt.Errorf("failed to decode ticket: %w", err)
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": ticket.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"fingerprint": StoredTicketFingerprint(&ticket)}}))
+		if len(updates) == fingerprintBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read tickets without fingerprint: %w", err)
+	}
+	return flush()
+}
+
+// StoredTicketFingerprint is the ReportFingerprint of the report a stored
+// ticket was created from
+func StoredTicketFingerprint(ticket *FlattenedTicket) string {
+	payload := make(map[string]interface{})
+	if ticket.PayloadJSON != "" {
+		json.Unmarshal([]byte(ticket.PayloadJSON), &payload)
+	}
+	for key, value := range map[string]string{
+		"issue":              ticket.Issue,
+		"product":            ticket.Product,
+		"failedNetworkCalls": ticket.FailedNetworkCallsJSON,
+	} {
+		if _, ok := payload[key]; !ok && value != "" {
+			payload[key] = value
+		}
+	}
+	return ReportFingerprint(&models.TicketRequest{Payload: payload})
+}
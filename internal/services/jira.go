@@ -1,34 +1,46 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	jira "github.com/andygrunwald/go-jira"
 	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
 )
 
 type JiraService struct {
 	client          *jira.Client
+	auth            *basicAuth
 	projectKey      string
-	supportTeam     []string
+	roster          atomic.Pointer[Roster] // replaced when the configuration is reloaded
 	defaultPriority string
 	mongoService    *MongoDBService
+	redactor        *Redactor
+	logger          *zap.Logger
+
+	// serviceDesk is set when tickets are raised as customer requests
+	serviceDesk *ServiceDesk
+	// jsonAttachments attaches the technical details of reports as JSON
+	// files rather than writing them in the description
+	jsonAttachments bool
 }
 
-func NewJiraService(jiraURL, username, apiToken, projectKey string, supportTeam []string, defaultPriority string, mongoService *MongoDBService) (*JiraService, error) {
-	tp := jira.BasicAuthTransport{
-		Username: username,
-		Password: apiToken,
-	}
+func NewJiraService(jiraURL, username, apiToken, projectKey string, roster *Roster, defaultPriority string, mongoService *MongoDBService) (*JiraService, error) {
+	auth := &basicAuth{username: username}
+	auth.setPassword(apiToken)
 
 	// Try to create a client and test the connection
-	client, err := jira.NewClient(tp.Client(), jiraURL)
+	client, err := jira.NewClient(&http.Client{Transport: auth}, jiraURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Jira client: %w", err)
 	}
@@ -38,296 +50,592 @@ func NewJiraService(jiraURL, username, apiToken, projectKey string, supportTeam
 		defaultPriority = "Medium"
 	}
 
-	return &JiraService{
+	s := &JiraService{
 		client:          client,
+		auth:            auth,
 		projectKey:      projectKey,
-		supportTeam:     supportTeam,
 		defaultPriority: defaultPriority,
 		mongoService:    mongoService,
-	}, nil
+		logger:          zap.NewNop(),
+	}
+	s.SetRoster(roster)
+	return s, nil
 }
 
-func (s *JiraService) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
-	// Maximum Jira description length is 32,767 characters
-	const maxJiraDescLength = 32000 // Leave some buffer
+// jiraLinkTitle replaces the characters that end the title of a Jira link
+var jiraLinkTitle = strings.NewReplacer("|", "-", "[", "(", "]", ")")
 
-	// Track if any content is truncated
-	wasTruncated := false
-	var truncatedContent strings.Builder
-	truncatedContent.WriteString("Additional details that couldn't fit in the description:\n\n")
+func (s *JiraService) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
+	// Nothing sensitive is sent to Jira or stored
+	req = s.redactor.Ticket(req)
+
+	// Technical details are attached as files when enabled; customer
+	// requests keep them in their description
+	var attachments []jsonAttachment
+	var description, overflow string
+	if s.jsonAttachments && s.serviceDesk == nil {
+		attachments = reportAttachments(req)
+		description, overflow = attachedTicketDescription(req, logger.RequestID(ctx), time.Now(), attachments)
+	} else {
+		description, overflow = ticketDescription(req, logger.RequestID(ctx), time.Now())
+	}
 
-	// Create a better formatted ticket description with clear sections
-	description := fmt.Sprintf("h2. Issue Summary\n%s\n\n", req.Payload["issue"])
+	// Assign to a support team member on shift for the product
+	product, _ := req.Payload["product"].(string)
+	assignee := s.Roster().Assignee(ctx, product, time.Now())
 
-	// Add a cleaner description section
-	if desc, ok := req.Payload["description"].(string); ok && desc != "" {
-		description += fmt.Sprintf("h3. Description\n%s\n\n", desc)
+	// Customer requests get the issue type of their request type
+	issueTypeID := ""
+	if s.serviceDesk == nil {
+		issueTypeID = s.bugIssueTypeID()
 	}
 
-	// Add user email and lead ID in a more compact format if available
-	var metadataSection string
-	if userEmail, ok := req.Payload["userEmail"].(string); ok && userEmail != "" {
-		metadataSection += fmt.Sprintf("* *User Email:* %s\n", userEmail)
-	}
-	if leadID, ok := req.Payload["leadId"].(string); ok && leadID != "" {
-		metadataSection += fmt.Sprintf("* *Lead ID:* %s\n", leadID)
+	// Create Jira issue
+	issueFields := &jira.IssueFields{
+		Project: jira.Project{
+			Key: s.projectKey,
+		},
+		Summary:     ticketTitle(req),
+		Description: description,
+		Type: jira.IssueType{
+			ID: issueTypeID,
+		},
+		Assignee: &jira.User{
+			AccountID: assignee,
+		},
+		// Removing Priority field as it's not available on the issue creation screen
+		// Priority: &jira.Priority{
+		//     Name: s.defaultPriority,
+		// },
 	}
-	if product, ok := req.Payload["product"].(string); ok && product != "" {
-		metadataSection += fmt.Sprintf("* *Product:* %s\n", product)
+
+	issue := &jira.Issue{
+		Fields: issueFields,
 	}
-	if pageURL, ok := req.Payload["url"].(string); ok && pageURL != "" {
-		metadataSection += fmt.Sprintf("* *Page URL:* %s\n", pageURL)
-	} else if req.URL != "" {
-		metadataSection += fmt.Sprintf("* *Page URL:* %s\n", req.URL)
+
+	// Log the data being sent to Jira API; the request was redacted above
+	// and log lines are redacted again by the logger
+	log := logger.FromContext(ctx, s.logger).With(zap.String("project", s.projectKey))
+	if ce := log.Check(zap.DebugLevel, "Creating Jira ticket"); ce != nil {
+		payload := make(map[string]string, len(req.Payload))
+		for k, v := range req.Payload {
+			// Long values such as the network calls are cut short
+			payload[k] = truncateForLog(fmt.Sprintf("%v", v), 100)
+		}
+		ce.Write(
+			zap.String("issue_type", issueTypeID),
+			zap.String("summary", issueFields.Summary),
+			zap.String("assignee", assignee),
+			zap.Bool("has_image", hasScreenshotURL(req)),
+			zap.Int("description_length", len(description)),
+			zap.String("description", truncateForLog(description, 500)),
+			zap.Any("payload", payload),
+			zap.Any("request_headers", req.RequestHeaders),
+		)
 	}
 
-	if metadataSection != "" {
-		description += fmt.Sprintf("h3. User Information\n%s\n\n", metadataSection)
+	jiraStart := time.Now()
+	var ticketKey string
+	var resp *jira.Response
+	var err error
+	if s.serviceDesk != nil {
+		reporterEmail, _ := req.Payload["userEmail"].(string)
+		ticketKey, resp, err = s.createRequest(ctx, issueFields.Summary, description, reporterEmail)
+	} else {
+		var newIssue *jira.Issue
+		if newIssue, resp, err = s.client.Issue.CreateWithContext(ctx, issue); err == nil {
+			ticketKey = newIssue.Key
+		}
 	}
+	jiraLatency := time.Since(jiraStart)
+	if err != nil {
+		// Log detailed error information
+		statusCode := 0
+		var responseBody string
 
-	// Add screenshot if available - put it near the top for better visibility
-	if req.ImageS3URL != "" && req.ImageS3URL != "None" && req.ImageS3URL != "null" {
-		if strings.HasPrefix(req.ImageS3URL, "http") {
-			// Add as an image in Jira markdown with expiry note
-			description += fmt.Sprintf("h3. Screenshot\n!%s|width=800!\n\n", req.ImageS3URL)
-			description += "{panel:title=Note|borderStyle=dashed|borderColor=#ccc|titleBGColor=#f0f0f0|bgColor=#fafafa}\n" +
-				"This screenshot URL will expire in 7 days.\n{panel}\n\n"
-		} else {
-			// Just add as text
-			description += fmt.Sprintf("h3. Screenshot\n%s\n\n", req.ImageS3URL)
+		if resp != nil {
+			statusCode = resp.StatusCode
+			if resp.Body != nil {
+				// Try to read response body for better error details
+				bodyBytes := make([]byte, 1024)
+				n, _ := resp.Body.Read(bodyBytes)
+				if n > 0 {
+					responseBody = string(bodyBytes[:n])
+				}
+				resp.Body.Close()
+			}
 		}
+
+		// Return error with more details
+		return nil, fmt.Errorf("failed to create Jira ticket: status=%d, error=%v, response=%s",
+			statusCode, err, responseBody)
 	}
 
-	// Track remaining characters and length of essential content so far
-	essentialLength := len(description)
+	ticketsCreatedTotal.WithLabelValues(s.projectKey).Inc()
 
-	// Add creation timestamp
-	timestamp := fmt.Sprintf("Ticket created on: %s\n", time.Now().Format(time.RFC1123))
-	description += timestamp
-	essentialLength += len(timestamp)
+	// Customer requests cannot be assigned when they are raised
+	if s.serviceDesk != nil && assignee != "" {
+		if err := s.AssignTicket(ctx, ticketKey, assignee); err != nil {
+			log.Warn("Failed to assign customer request", zap.String("ticket_id", ticketKey), zap.Error(err))
+		}
+	}
 
-	// Calculate remaining characters for dynamic content
-	remainingChars := maxJiraDescLength - essentialLength
+	// Fix the URL string conversion
+	baseURL := &url.URL{
+		Scheme: "https",
+		Host:   s.client.GetBaseURL().Host,
+	}
 
-	// Allocate space for different sections (priorities)
-	// Network calls get highest priority - 50% of remaining space
-	networkCallsLimit := remainingChars / 2
-	// Headers and response get 20% each
-	headersLimit := remainingChars / 5
-	responseLimit := remainingChars / 5
-	// Payload gets the remaining 10%
-	payloadLimit := remainingChars - networkCallsLimit - headersLimit - responseLimit
+	ticketResponse := &models.TicketResponse{
+		TicketID:   ticketKey,
+		Status:     "created",
+		AssignedTo: assignee,
+		JiraLink:   fmt.Sprintf("%s/browse/%s", baseURL.String(), ticketKey),
+	}
 
-	// Add network calls in a collapsible section if available
-	networkCallsSection := ""
-	if networkCalls, exists := req.Payload["failedNetworkCalls"]; exists && networkCalls != nil {
-		sectionStart := "{panel:title=Failed Network Calls|collapsed=true|borderStyle=solid|borderColor=#ddd|titleBGColor=#f7f7f7|bgColor=#fff}\n"
-		sectionEnd := "{panel}\n\n"
+	if len(attachments) > 0 {
+		s.attachDetails(ctx, ticketKey, attachments, log)
+	}
 
-		content := ""
-		fullContent := ""
+	// If content was truncated, add it as a comment
+	if overflow != "" {
+		commentBody := overflow
 
-		// Try to format as JSON if possible
-		if nc, ok := networkCalls.(string); ok {
-			// For string representation
-			fullContent = "{code:json}\n" + nc + "\n{code}\n"
+		// Check if the comment itself is too long (32,767 characters max)
+		if len(commentBody) > maxJiraDescLength {
+			commentBody = commentBody[:maxJiraDescLength-100] + "\n\n[Comment truncated due to Jira character limit]"
+		}
 
-			if len(nc) > networkCallsLimit-len(sectionStart)-len(sectionEnd)-20 {
-				wasTruncated = true
-				truncatedContent.WriteString("h3. Complete Network Calls\n")
-				truncatedContent.WriteString(fullContent)
-				truncatedContent.WriteString("\n\n")
+		comment := &jira.Comment{
+			Body: commentBody,
+		}
 
-				content += "Network calls data truncated to fit Jira limit:\n"
-				content += "{code:json}\n" + nc[:networkCallsLimit-len(sectionStart)-len(sectionEnd)-50] + "\n...[truncated]...\n{code}\n"
-			} else {
-				content += fullContent
-			}
+		_, _, err := s.client.Issue.AddCommentWithContext(ctx, ticketKey, comment)
+		if err != nil {
+			// Log error but don't fail the ticket creation
+			log.Warn("Failed to add comment with truncated content", zap.String("ticket_id", ticketKey), zap.Error(err))
 		} else {
-			// For structured data, use JSON format
-			ncJSON, err := json.Marshal(networkCalls)
-			if err == nil {
-				fullContent = "{code:json}\n" + string(ncJSON) + "\n{code}\n"
-
-				if len(ncJSON) > networkCallsLimit-len(sectionStart)-len(sectionEnd)-20 {
-					wasTruncated = true
-					truncatedContent.WriteString("h3. Complete Network Calls\n")
-					truncatedContent.WriteString(fullContent)
-					truncatedContent.WriteString("\n\n")
-
-					content += "Network calls data truncated to fit Jira limit:\n"
-					content += "{code:json}\n" + string(ncJSON[:networkCallsLimit-len(sectionStart)-len(sectionEnd)-50]) + "\n...[truncated]...\n{code}\n"
-				} else {
-					content += fullContent
-				}
-			} else {
-				content += "Failed to format network calls data as JSON.\n"
-			}
+			log.Debug("Added comment with truncated content", zap.String("ticket_id", ticketKey))
 		}
-
-		networkCallsSection = sectionStart + content + sectionEnd
 	}
-	description += networkCallsSection
 
-	// Add technical details in separate collapsible panels
-	description += "h3. Technical Details\n\n"
+	saveTicket(ctx, s.mongoService, req, ticketResponse, jiraLatency, log)
 
-	// Request Headers
-	headerSection := ""
-	sectionStart := "{panel:title=Request Headers|collapsed=true|borderStyle=solid|borderColor=#ddd|titleBGColor=#f7f7f7|bgColor=#fff}\n"
-	sectionEnd := "{panel}\n\n"
+	return ticketResponse, nil
+}
 
-	if len(req.RequestHeaders) > 0 {
-		content := "{code:json}\n"
-		fullContent := "{code:json}\n"
+// maxJiraDescLength keeps descriptions and comments under the 32,767
+// characters Jira allows, with some buffer
+const maxJiraDescLength = 32000
+
+// Collapsible panels of the technical details in descriptions
+const (
+	networkCallsPanel = "{panel:title=Failed Network Calls|collapsed=true|borderStyle=solid|borderColor=#ddd|titleBGColor=#f7f7f7|bgColor=#fff}\n"
+	headersPanel      = "{panel:title=Request Headers|collapsed=true|borderStyle=solid|borderColor=#ddd|titleBGColor=#f7f7f7|bgColor=#fff}\n"
+	responsePanel     = "{panel:title=Response|collapsed=true|borderStyle=solid|borderColor=#ddd|titleBGColor=#f7f7f7|bgColor=#fff}\n"
+	payloadPanel      = "{panel:title=Full Payload Data|collapsed=true|borderStyle=solid|borderColor=#ddd|titleBGColor=#f7f7f7|bgColor=#fff}\n"
+	panelEnd          = "{panel}\n\n"
+)
 
-		headersJSON, err := json.MarshalIndent(req.RequestHeaders, "", "  ")
-		if err == nil {
-			fullContent += string(headersJSON) + "\n{code}\n"
+// descriptionWriter renders a description, and the complete sections that
+// had to be cut short to fit it
+type descriptionWriter struct {
+	strings.Builder
+	overflow strings.Builder
+}
 
-			if len(headersJSON) > headersLimit-len(sectionStart)-len(sectionEnd)-20 {
-				wasTruncated = true
-				truncatedContent.WriteString("h3. Complete Request Headers\n")
-				truncatedContent.WriteString(fullContent)
-				truncatedContent.WriteString("\n\n")
+// overflowSection starts a complete section in the overflow
+func (d *descriptionWriter) overflowSection(heading string) {
+	if d.overflow.Len() == 0 {
+		d.overflow.WriteString("Additional details that couldn't fit in the description:\n\n")
+	}
+	d.overflow.WriteString(heading)
+}
 
-				content += string(headersJSON[:headersLimit-len(sectionStart)-len(sectionEnd)-30]) + "\n...[truncated]...\n"
-			} else {
-				content += string(headersJSON)
-			}
+// codePanel writes data in a code block of a collapsible panel, cut short
+// when it takes more than limit with the panel and margin to spare
+func (d *descriptionWriter) codePanel(panel, heading, data string, limit, margin int) {
+	d.WriteString(panel)
+	d.WriteString("{code:json}\n")
+	room := limit - len(panel) - len(panelEnd)
+	if len(data) > room-margin {
+		d.overflowSection(heading)
+		d.overflow.WriteString("{code:json}\n")
+		d.overflow.WriteString(data)
+		d.overflow.WriteString("\n{code}\n\n\n")
+
+		d.WriteString(data[:room-30])
+		d.WriteString("\n...[truncated]...\n")
+	} else {
+		d.WriteString(data)
+	}
+	d.WriteString("\n{code}\n")
+	d.WriteString(panelEnd)
+}
+
+// ticketDescription renders the Jira description of a report. The network
+// calls, request headers, response and payload share what room is left by
+// the rest, and are cut short when they do not fit; the complete sections
+// are returned as overflow, to be added as a comment, which is empty when
+// nothing was cut.
+func ticketDescription(req *models.TicketRequest, requestID string, now time.Time) (description, overflow string) {
+	// Each technical detail is marshaled once, up front, so the description
+	// can be allocated at its final size
+	networkCalls, hasNetworkCalls := req.Payload["failedNetworkCalls"]
+	hasNetworkCalls = hasNetworkCalls && networkCalls != nil
+	var networkCallsData string
+	var networkCallsErr error
+	if hasNetworkCalls {
+		if nc, ok := networkCalls.(string); ok {
+			networkCallsData = nc
 		} else {
-			// Fallback to simple key-value format with truncation if needed
-			headersStr := ""
-			fullHeadersStr := ""
-			for k, v := range req.RequestHeaders {
-				line := fmt.Sprintf("%s: %s\n", k, v)
-				fullHeadersStr += line
-
-				if len(headersStr)+len(line) > headersLimit-len(sectionStart)-len(sectionEnd)-30 {
-					if headersStr == "" {
-						// Ensure at least the first header is included
-						headersStr = line
-					}
-					wasTruncated = true
-					truncatedContent.WriteString("h3. Complete Request Headers\n")
-					truncatedContent.WriteString("{code}\n" + fullHeadersStr + "{code}\n\n")
+			var ncJSON []byte
+			ncJSON, networkCallsErr = json.Marshal(networkCalls)
+			networkCallsData = string(ncJSON)
+		}
+	}
+	var headersData string
+	if len(req.RequestHeaders) > 0 {
+		// A map of strings always marshals
+		headersJSON, _ := json.MarshalIndent(req.RequestHeaders, "", "  ")
+		headersData = string(headersJSON)
+	}
+	var responseData string
+	var responseMargin int
+	if len(req.Response) > 0 {
+		responseData, responseMargin = detailData(req.Response)
+	}
+	payloadData, payloadMargin := detailData(req.Payload)
 
-					headersStr += "...[truncated]...\n"
-					break
-				}
-				headersStr += line
-			}
-			content += headersStr
+	issue, _ := req.Payload["issue"].(string)
+	desc, _ := req.Payload["description"].(string)
+	d := &descriptionWriter{}
+	d.Grow(min(2048+len(issue)+len(desc)+len(networkCallsData)+len(headersData)+len(responseData)+len(payloadData), maxJiraDescLength))
+
+	d.report(req, requestID, now)
+
+	// The technical details share the room left by the essential content:
+	// half for the network calls, a fifth each for the headers and the
+	// response, and the rest for the payload
+	remainingChars := maxJiraDescLength - d.Len()
+	networkCallsLimit := remainingChars / 2
+	headersLimit := remainingChars / 5
+	responseLimit := remainingChars / 5
+	payloadLimit := remainingChars - networkCallsLimit - headersLimit - responseLimit
+
+	if hasNetworkCalls {
+		d.WriteString(networkCallsPanel)
+		room := networkCallsLimit - len(networkCallsPanel) - len(panelEnd)
+		switch {
+		case networkCallsErr != nil:
+			d.WriteString("Failed to format network calls data as JSON.\n")
+		case len(networkCallsData) > room-20:
+			d.overflowSection("h3. Complete Network Calls\n")
+			d.overflow.WriteString("{code:json}\n")
+			d.overflow.WriteString(networkCallsData)
+			d.overflow.WriteString("\n{code}\n\n\n")
+
+			d.WriteString("Network calls data truncated to fit Jira limit:\n{code:json}\n")
+			d.WriteString(networkCallsData[:room-50])
+			d.WriteString("\n...[truncated]...\n{code}\n")
+		default:
+			d.WriteString("{code:json}\n")
+			d.WriteString(networkCallsData)
+			d.WriteString("\n{code}\n")
 		}
-		content += "\n{code}\n"
-		headerSection = sectionStart + content + sectionEnd
-	} else {
-		headerSection = sectionStart + "No request headers available.\n" + sectionEnd
+		d.WriteString(panelEnd)
 	}
-	description += headerSection
 
-	// Response data
-	responseSection := ""
-	sectionStart = "{panel:title=Response|collapsed=true|borderStyle=solid|borderColor=#ddd|titleBGColor=#f7f7f7|bgColor=#fff}\n"
-	sectionEnd = "{panel}\n\n"
+	d.WriteString("h3. Technical Details\n\n")
+
+	if headersData != "" {
+		d.codePanel(headersPanel, "h3. Complete Request Headers\n", headersData, headersLimit, 20)
+	} else {
+		d.WriteString(headersPanel)
+		d.WriteString("No request headers available.\n")
+		d.WriteString(panelEnd)
+	}
 
 	if len(req.Response) > 0 {
-		content := "{code:json}\n"
-		fullContent := "{code:json}\n"
+		d.codePanel(responsePanel, "h3. Complete Response\n", responseData, responseLimit, responseMargin)
+	} else {
+		d.WriteString(responsePanel)
+		d.WriteString("No response data available.\n")
+		d.WriteString(panelEnd)
+	}
 
-		responseJSON, err := json.MarshalIndent(req.Response, "", "  ")
-		if err == nil {
-			fullContent += string(responseJSON) + "\n{code}\n"
+	d.codePanel(payloadPanel, "h3. Complete Payload\n", payloadData, payloadLimit, payloadMargin)
+	return d.finish()
+}
 
-			if len(responseJSON) > responseLimit-len(sectionStart)-len(sectionEnd)-20 {
-				wasTruncated = true
-				truncatedContent.WriteString("h3. Complete Response\n")
-				truncatedContent.WriteString(fullContent)
-				truncatedContent.WriteString("\n\n")
+// attachedTicketDescription renders the Jira description of a report whose
+// technical details are attached to the ticket as files, which it lists
+// instead of their content
+func attachedTicketDescription(req *models.TicketRequest, requestID string, now time.Time, files []jsonAttachment) (description, overflow string) {
+	d := &descriptionWriter{}
+	d.report(req, requestID, now)
+	if len(files) > 0 {
+		d.WriteString("h3. Technical Details\n")
+		for _, file := range files {
+			d.WriteString("* ")
+			d.WriteString(file.title)
+			d.WriteString(": [^")
+			d.WriteString(file.name)
+			d.WriteString("]\n")
+		}
+		d.WriteString("\n")
+	}
+	return d.finish()
+}
 
-				content += string(responseJSON[:responseLimit-len(sectionStart)-len(sectionEnd)-30]) + "\n...[truncated]...\n"
-			} else {
-				content += string(responseJSON)
-			}
-		} else {
-			// Fallback to simple string representation with truncation
-			respStr := fmt.Sprintf("%v", req.Response)
-			fullContent += respStr + "\n{code}\n"
+// report writes the essential content of a report's description: what the
+// reporter said, who they are and what the server added to the report
+func (d *descriptionWriter) report(req *models.TicketRequest, requestID string, now time.Time) {
+	issue, _ := req.Payload["issue"].(string)
+	desc, _ := req.Payload["description"].(string)
+	if req.Summary != nil {
+		d.WriteString("h3. Generated Summary\n")
+		for _, bullet := range req.Summary.Bullets {
+			d.WriteString("* ")
+			d.WriteString(bullet)
+			d.WriteString("\n")
+		}
+		d.WriteString("\n")
+	}
+	d.WriteString("h2. Issue Summary\n")
+	if _, ok := req.Payload["issue"].(string); ok {
+		d.WriteString(issue)
+	} else {
+		fmt.Fprintf(d, "%s", req.Payload["issue"])
+	}
+	d.WriteString("\n\n")
 
-			if len(respStr) > responseLimit-len(sectionStart)-len(sectionEnd)-30 {
-				wasTruncated = true
-				truncatedContent.WriteString("h3. Complete Response\n")
-				truncatedContent.WriteString(fullContent)
-				truncatedContent.WriteString("\n\n")
+	if desc != "" {
+		d.WriteString("h3. Description\n")
+		d.WriteString(desc)
+		d.WriteString("\n\n")
+	}
 
-				content += respStr[:responseLimit-len(sectionStart)-len(sectionEnd)-30] + "\n...[truncated]...\n"
-			} else {
-				content += respStr
-			}
+	// User email, lead ID and the like in a compact list
+	var fields [9]struct{ label, value string }
+	n := 0
+	field := func(label, value string) {
+		if value != "" {
+			fields[n].label, fields[n].value = label, value
+			n++
 		}
-		content += "\n{code}\n"
-		responseSection = sectionStart + content + sectionEnd
+	}
+	userEmail, _ := req.Payload["userEmail"].(string)
+	field("User Email", userEmail)
+	leadID, _ := req.Payload["leadId"].(string)
+	field("Lead ID", leadID)
+	product, _ := req.Payload["product"].(string)
+	field("Product", product)
+	if severity, _ := req.Payload["severity"].(string); severity != "" {
+		field("Severity", severity)
+	} else if req.Classification != nil {
+		field("Severity", req.Classification.Severity+" (predicted)")
+	}
+	if req.Classification != nil {
+		// Listed even when empty, like the predicted severity
+		fields[n].label, fields[n].value = "Category", req.Classification.Category
+		n++
+	}
+	if pageURL, _ := req.Payload["url"].(string); pageURL != "" {
+		field("Page URL", pageURL)
 	} else {
-		responseSection = sectionStart + "No response data available.\n" + sectionEnd
+		field("Page URL", req.URL)
+	}
+	sdk, _ := req.Payload["sdk"].(string)
+	field("SDK", sdk)
+	field("Request ID", requestID)
+	if n > 0 {
+		d.WriteString("h3. User Information\n")
+		for _, f := range fields[:n] {
+			d.WriteString("* *")
+			d.WriteString(f.label)
+			d.WriteString(":* ")
+			d.WriteString(f.value)
+			d.WriteString("\n")
+		}
+		d.WriteString("\n\n")
 	}
-	description += responseSection
-
-	// Raw payload data (limited to remaining space)
-	payloadSection := ""
-	sectionStart = "{panel:title=Full Payload Data|collapsed=true|borderStyle=solid|borderColor=#ddd|titleBGColor=#f7f7f7|bgColor=#fff}\n"
-	sectionEnd = "{panel}\n\n"
 
-	content := "{code:json}\n"
-	fullContent := "{code:json}\n"
+	if env := clientEnvironment(req.Payload["client"]); env != nil {
+		d.WriteString("h3. Environment\n")
+		d.WriteString(environmentDetails(env))
+		d.WriteString("\n")
+	}
 
-	payloadJSON, err := json.MarshalIndent(req.Payload, "", "  ")
-	if err == nil {
-		fullContent += string(payloadJSON) + "\n{code}\n"
+	if console := recentEntries(payloadList[models.ConsoleEntry](req.Payload["console"])); len(console) > 0 {
+		d.WriteString("h3. Console\n{noformat}\n")
+		for _, entry := range console {
+			d.WriteString(consoleLine(entry))
+			d.WriteString("\n")
+		}
+		d.WriteString("{noformat}\n\n")
+	}
 
-		if len(payloadJSON) > payloadLimit-len(sectionStart)-len(sectionEnd)-20 {
-			wasTruncated = true
-			truncatedContent.WriteString("h3. Complete Payload\n")
-			truncatedContent.WriteString(fullContent)
-			truncatedContent.WriteString("\n\n")
+	if crumbs := recentEntries(payloadList[models.Breadcrumb](req.Payload["breadcrumbs"])); len(crumbs) > 0 {
+		d.WriteString("h3. Breadcrumbs\n")
+		for _, crumb := range crumbs {
+			d.WriteString("* ")
+			d.WriteString(breadcrumbLine(crumb))
+			d.WriteString("\n")
+		}
+		d.WriteString("\n")
+	}
 
-			content += string(payloadJSON[:payloadLimit-len(sectionStart)-len(sectionEnd)-30]) + "\n...[truncated]...\n"
-		} else {
-			content += string(payloadJSON)
+	if len(req.Runbooks) > 0 {
+		d.WriteString("h3. Runbooks\n")
+		for _, runbook := range req.Runbooks {
+			d.WriteString("* [")
+			d.WriteString(jiraLinkTitle.Replace(runbook.Title))
+			d.WriteString("|")
+			d.WriteString(runbook.URL)
+			d.WriteString("]\n")
 		}
-	} else {
-		// Fallback to simple string representation with truncation
-		payloadStr := fmt.Sprintf("%v", req.Payload)
-		fullContent += payloadStr + "\n{code}\n"
+		d.WriteString("\n")
+	}
 
-		if len(payloadStr) > payloadLimit-len(sectionStart)-len(sectionEnd)-30 {
-			wasTruncated = true
-			truncatedContent.WriteString("h3. Complete Payload\n")
-			truncatedContent.WriteString(fullContent)
-			truncatedContent.WriteString("\n\n")
+	if len(req.Deploys) > 0 {
+		d.WriteString("h3. Recent Deploys\n")
+		for _, deploy := range req.Deploys {
+			d.WriteString("* ")
+			if deploy.URL != "" {
+				d.WriteString("[")
+				d.WriteString(jiraLinkTitle.Replace(deploySummary(deploy)))
+				d.WriteString("|")
+				d.WriteString(deploy.URL)
+				d.WriteString("]")
+			} else {
+				d.WriteString(deploySummary(deploy))
+			}
+			d.WriteString("\n")
+		}
+		d.WriteString("\n")
+	}
 
-			content += payloadStr[:payloadLimit-len(sectionStart)-len(sectionEnd)-30] + "\n...[truncated]...\n"
+	// Add screenshot if available - put it near the top for better visibility
+	attachmentHeading := "h3. Screenshot\n"
+	if IsVideoContentType(req.ImageContentType) {
+		attachmentHeading = "h3. Screen Recording\n"
+	}
+	if req.QuarantineKey != "" {
+		// The screenshot is swapped in when an admin releases it
+		d.WriteString(attachmentHeading)
+		d.WriteString(QuarantineNote)
+		d.WriteString("\n\n")
+	} else if hasScreenshotURL(req) {
+		d.WriteString(attachmentHeading)
+		if strings.HasPrefix(req.ImageS3URL, "http") {
+			// Add as an image in Jira markdown with expiry note; recordings are linked
+			d.WriteString(ScreenshotMarkup(req.ImageS3URL, req.ImageContentType))
+			d.WriteString("\n")
+			if req.Video != nil {
+				d.WriteString(videoDetails(req.Video))
+			}
+			d.WriteString("\n")
+			d.WriteString("{panel:title=Note|borderStyle=dashed|borderColor=#ccc|titleBGColor=#f0f0f0|bgColor=#fafafa}\n" +
+				"This screenshot URL expires periodically and is re-signed automatically while the ticket is open.\n{panel}\n\n")
 		} else {
-			content += payloadStr
+			// Just add as text
+			d.WriteString(req.ImageS3URL)
+			d.WriteString("\n\n")
 		}
 	}
-	content += "\n{code}\n"
-	payloadSection = sectionStart + content + sectionEnd
-	description += payloadSection
 
-	// Final check to ensure we're under limit
+	d.WriteString("Ticket created on: ")
+	d.WriteString(now.Format(time.RFC1123))
+	d.WriteString("\n")
+}
+
+// finish returns the description, cut short with the whole of it added to
+// the overflow when it is still too long for Jira, and the overflow
+func (d *descriptionWriter) finish() (description, overflow string) {
+	description = d.String()
 	if len(description) > maxJiraDescLength {
 		// If still too long, truncate the whole thing
-		wasTruncated = true
-		truncatedContent.WriteString("h3. Full Original Description\n")
-		truncatedContent.WriteString(description)
-		truncatedContent.WriteString("\n\n")
+		d.overflowSection("h3. Full Original Description\n")
+		d.overflow.WriteString(description)
+		d.overflow.WriteString("\n\n")
 
 		description = description[:maxJiraDescLength-100] + "\n\n[Content truncated due to Jira character limit. See comments for complete information.]"
 	}
+	return description, d.overflow.String()
+}
+
+// detailData returns a technical detail as indented JSON, or as formatted
+// by fmt when it cannot be marshaled, which leaves it a larger margin
+func detailData(detail map[string]interface{}) (data string, margin int) {
+	if detailJSON, err := json.MarshalIndent(detail, "", "  "); err == nil {
+		return string(detailJSON), 20
+	}
+	return fmt.Sprintf("%v", detail), 30
+}
+
+// jsonAttachment is a technical detail of a report attached to its ticket
+// as a JSON file
+type jsonAttachment struct {
+	name  string
+	title string
+	data  []byte
+}
+
+// reportAttachments returns the technical details of a report as indented
+// JSON files: its failed network calls, request headers and response when
+// it has them, and its full payload
+func reportAttachments(req *models.TicketRequest) []jsonAttachment {
+	var files []jsonAttachment
+	add := func(name, title string, detail interface{}) {
+		data, err := json.MarshalIndent(detail, "", "  ")
+		if err != nil {
+			// Kept as formatted by fmt, as a JSON string
+			data, _ = json.Marshal(fmt.Sprintf("%v", detail))
+		}
+		files = append(files, jsonAttachment{name: name, title: title, data: data})
+	}
+	if networkCalls := req.Payload["failedNetworkCalls"]; networkCalls != nil {
+		// The SDK may send them as a JSON string
+		if text, ok := networkCalls.(string); ok && json.Valid([]byte(text)) {
+			networkCalls = json.RawMessage(text)
+		}
+		add("network-calls.json", "Failed Network Calls", networkCalls)
+	}
+	if len(req.RequestHeaders) > 0 {
+		add("headers.json", "Request Headers", req.RequestHeaders)
+	}
+	if len(req.Response) > 0 {
+		add("response.json", "Response", req.Response)
+	}
+	add("payload.json", "Full Payload Data", req.Payload)
+	return files
+}
 
-	// Get random team member for assignment
-	assignee := s.getRandomTeamMember()
+// attachDetails attaches the technical details of a report to its ticket.
+// A detail that cannot be attached is added as a comment instead, cut short
+// when it is too long for one.
+func (s *JiraService) attachDetails(ctx context.Context, ticketKey string, files []jsonAttachment, log *zap.Logger) {
+	for _, file := range files {
+		_, _, err := s.client.Issue.PostAttachmentWithContext(ctx, ticketKey, bytes.NewReader(file.data), file.name)
+		if err == nil {
+			continue
+		}
+		log.Warn("Failed to attach technical details, adding them as a comment", zap.String("ticket_id", ticketKey), zap.String("file", file.name), zap.Error(err))
+
+		data := string(file.data)
+		if len(data) > maxJiraDescLength-200 {
+			data = data[:maxJiraDescLength-200] + "\n...[truncated]..."
+		}
+		body := "h3. " + file.title + "\n{code:json}\n" + data + "\n{code}\n"
+		if _, _, err := s.client.Issue.AddCommentWithContext(ctx, ticketKey, &jira.Comment{Body: body}); err != nil {
+			log.Warn("Failed to add comment with technical details", zap.String("ticket_id", ticketKey), zap.String("file", file.name), zap.Error(err))
+		}
+	}
+}
 
+// bugIssueTypeID returns the ID of the Bug issue type of the project
+func (s *JiraService) bugIssueTypeID() string {
 	// Get available issue types for the project to find the Bug type
 	issueTypeID := ""
 	metaProject, _, err := s.client.Issue.GetCreateMeta(s.projectKey)
@@ -350,233 +658,374 @@ func (s *JiraService) CreateTicket(ctx context.Context, req *models.TicketReques
 	if issueTypeID == "" {
 		issueTypeID = "10001" // Common default for Bug in Jira Cloud
 	}
+	return issueTypeID
+}
 
-	// Create Jira issue
-	issueFields := &jira.IssueFields{
-		Project: jira.Project{
-			Key: s.projectKey,
-		},
-		Summary:     fmt.Sprintf("Issue Report: %s", req.Payload["issue"]),
-		Description: description,
-		Type: jira.IssueType{
-			ID: issueTypeID,
-		},
-		Assignee: &jira.User{
-			AccountID: assignee,
-		},
-		// Removing Priority field as it's not available on the issue creation screen
-		// Priority: &jira.Priority{
-		//     Name: s.defaultPriority,
-		// },
+// IsTicketOpen reports whether a Jira ticket is still unresolved
+func (s *JiraService) IsTicketOpen(ctx context.Context, ticketID string) (bool, error) {
+	issue, _, err := s.client.Issue.GetWithContext(ctx, ticketID, &jira.GetQueryOptions{
+		Fields: "status,resolution",
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get Jira ticket %s: %w", ticketID, err)
 	}
 
-	issue := &jira.Issue{
-		Fields: issueFields,
+	if issue.Fields == nil {
+		return true, nil
+	}
+	if issue.Fields.Resolution != nil {
+		return false, nil
+	}
+	if issue.Fields.Status != nil && issue.Fields.Status.StatusCategory.Key == jira.StatusCategoryComplete {
+		return false, nil
 	}
 
-	// Log the data being sent to Jira API
-	fmt.Printf("\n=== JIRA TICKET DATA ===\n")
-	fmt.Printf("Project Key: %s\n", s.projectKey)
-	fmt.Printf("Issue Type ID: %s\n", issueTypeID)
-	fmt.Printf("Summary: %s\n", issueFields.Summary)
-	fmt.Printf("Assignee Account ID: %s\n", assignee)
+	return true, nil
+}
 
-	// Log S3 image URL if present
-	if req.ImageS3URL != "" && req.ImageS3URL != "None" && req.ImageS3URL != "null" {
-		fmt.Printf("Image URL (presigned, expires in 7 days): %s\n", req.ImageS3URL)
-	} else {
-		fmt.Printf("Image URL: No valid image URL provided\n")
-	}
+// TicketState is the current workflow state of a Jira ticket
+type TicketState struct {
+	Status     string
+	AssignedTo string
+	Resolution string
+}
 
-	// Log first 500 chars of description (as it might be very long)
-	descLen := len(description)
-	if descLen > 500 {
-		fmt.Printf("Description (first 500 chars): %s...\n", description[:500])
-	} else {
-		fmt.Printf("Description: %s\n", description)
+// GetTicketState fetches the status, assignee account ID and resolution of a
+// Jira ticket
+func (s *JiraService) GetTicketState(ctx context.Context, ticketID string) (*TicketState, error) {
+	issue, _, err := s.client.Issue.GetWithContext(ctx, ticketID, &jira.GetQueryOptions{
+		Fields: "status,assignee,resolution",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Jira ticket %s: %w", ticketID, err)
 	}
 
-	// Log payload details
-	fmt.Printf("=== Payload Details ===\n")
-	for k, v := range req.Payload {
-		// For values that might be long (like description), truncate them
-		strVal := fmt.Sprintf("%v", v)
-		if len(strVal) > 100 {
-			strVal = strVal[:100] + "..."
-		}
-		fmt.Printf("  %s: %s\n", k, strVal)
-	}
+	return issueState(issue), nil
+}
 
-	// Log headers
-	fmt.Printf("=== Request Headers ===\n")
-	for k, v := range req.RequestHeaders {
-		fmt.Printf("  %s: %s\n", k, v)
+// GetTicketStates fetches the state of several Jira tickets with a single
+// search. Tickets that do not exist in Jira are missing from the result.
+func (s *JiraService) GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error) {
+	states := make(map[string]*TicketState, len(ticketIDs))
+	if len(ticketIDs) == 0 {
+		return states, nil
 	}
 
-	fmt.Printf("=== END JIRA TICKET DATA ===\n\n")
-
-	// Update to use context in the Create call if the client supports it
-	newIssue, resp, err := s.client.Issue.Create(issue)
+	quoted := make([]string, len(ticketIDs))
+	for i, id := range ticketIDs {
+		quoted[i] = fmt.Sprintf("%q", id)
+	}
+	jql := fmt.Sprintf("key in (%s)", strings.Join(quoted, ","))
+
+	// Unknown keys only produce warnings instead of failing the search
+	issues, _, err := s.client.Issue.SearchWithContext(ctx, jql, &jira.SearchOptions{
+		MaxResults:    len(ticketIDs),
+		Fields:        []string{"status", "assignee", "resolution"},
+		ValidateQuery: "warn",
+	})
 	if err != nil {
-		// Log detailed error information
-		statusCode := 0
-		var responseBody string
+		return nil, fmt.Errorf("failed to search Jira tickets: %w", err)
+	}
 
-		if resp != nil {
-			statusCode = resp.StatusCode
-			if resp.Body != nil {
-				// Try to read response body for better error details
-				bodyBytes := make([]byte, 1024)
-				n, _ := resp.Body.Read(bodyBytes)
-				if n > 0 {
-					responseBody = string(bodyBytes[:n])
-				}
-				resp.Body.Close()
-			}
-		}
+	for i := range issues {
+		states[issues[i].Key] = issueState(&issues[i])
+	}
+	return states, nil
+}
 
-		// Return error with more details
-		return nil, fmt.Errorf("failed to create Jira ticket: status=%d, error=%v, response=%s",
-			statusCode, err, responseBody)
+// issueState extracts the workflow state of an issue
+func issueState(issue *jira.Issue) *TicketState {
+	state := &TicketState{}
+	if issue.Fields == nil {
+		return state
+	}
+	if issue.Fields.Status != nil {
+		state.Status = issue.Fields.Status.Name
+	}
+	if issue.Fields.Assignee != nil {
+		state.AssignedTo = issue.Fields.Assignee.AccountID
+	}
+	if issue.Fields.Resolution != nil {
+		state.Resolution = issue.Fields.Resolution.Name
 	}
+	return state
+}
 
-	// Fix the URL string conversion
-	baseURL := &url.URL{
-		Scheme: "https",
-		Host:   s.client.GetBaseURL().Host,
+// Ping checks that Jira can be reached with the configured credentials
+func (s *JiraService) Ping(ctx context.Context) error {
+	if _, _, err := s.client.User.GetSelfWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach Jira: %w", err)
 	}
+	return nil
+}
 
-	ticketResponse := &models.TicketResponse{
-		TicketID:   newIssue.Key,
-		Status:     "created",
-		AssignedTo: assignee,
-		JiraLink:   fmt.Sprintf("%s/browse/%s", baseURL.String(), newIssue.Key),
+// SetAPIToken replaces the API token Jira requests are authenticated with
+func (s *JiraService) SetAPIToken(token string) {
+	s.auth.setPassword(token)
+}
+
+// basicAuth authenticates requests with HTTP basic auth. Unlike
+// jira.BasicAuthTransport its password can be rotated while in use.
+type basicAuth struct {
+	username string
+	password atomic.Pointer[string]
+}
+
+func (t *basicAuth) setPassword(password string) {
+	t.password.Store(&password)
+}
+
+// RoundTrip sends the request with the current credentials, counting
+// failed requests and recording when one last succeeded. Its time counts
+// towards the jira stage of the request it is made for.
+func (t *basicAuth) RoundTrip(req *http.Request) (*http.Response, error) {
+	defer logger.StartStage(req.Context(), "jira")()
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, *t.password.Load())
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	switch {
+	case err != nil:
+		jiraFailure(req.Method, 0)
+	case resp.StatusCode >= http.StatusBadRequest:
+		jiraFailure(req.Method, resp.StatusCode)
+	default:
+		jiraLastSuccess.WithLabelValues(req.URL.Host).SetToCurrentTime()
 	}
+	return resp, err
+}
 
-	// If content was truncated, add it as a comment
-	if wasTruncated {
-		commentBody := truncatedContent.String()
+// SetLogger sets the logger ticket creation is logged to
+func (s *JiraService) SetLogger(log *zap.Logger) {
+	s.logger = log
+}
 
-		// Check if the comment itself is too long (32,767 characters max)
-		if len(commentBody) > maxJiraDescLength {
-			commentBody = commentBody[:maxJiraDescLength-100] + "\n\n[Comment truncated due to Jira character limit]"
-		}
+// SetJSONAttachments makes the service attach the network calls, request
+// headers, response and payload of reports to their tickets as JSON files,
+// keeping descriptions short. Customer requests keep them in their
+// description.
+func (s *JiraService) SetJSONAttachments(enabled bool) {
+	s.jsonAttachments = enabled
+}
 
-		comment := &jira.Comment{
-			Body: commentBody,
-		}
+// SetRedactor sets the redactor applied to new tickets
+func (s *JiraService) SetRedactor(redactor *Redactor) {
+	s.redactor = redactor
+}
 
-		fmt.Printf("Adding a comment with truncated content to ticket %s\n", newIssue.Key)
+// IsSupportTeamMember reports whether accountID is on the support roster
+func (s *JiraService) IsSupportTeamMember(accountID string) bool {
+	return s.Roster().IsMember(accountID)
+}
 
-		_, _, err := s.client.Issue.AddComment(newIssue.Key, comment)
-		if err != nil {
-			// Log error but don't fail the ticket creation
-			fmt.Printf("Failed to add comment with truncated content: %v\n", err)
-		} else {
-			fmt.Printf("Successfully added comment with truncated content\n")
-		}
+// Roster returns the support roster tickets are assigned from
+func (s *JiraService) Roster() *Roster {
+	return s.roster.Load()
+}
+
+// SetRoster replaces the support roster tickets are assigned from
+func (s *JiraService) SetRoster(roster *Roster) {
+	s.roster.Store(roster)
+}
+
+// AssignTicket sets the assignee of a Jira ticket
+func (s *JiraService) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	if _, err := s.client.Issue.UpdateAssigneeWithContext(ctx, ticketID, &jira.User{AccountID: accountID}); err != nil {
+		return fmt.Errorf("failed to assign Jira ticket %s: %w", ticketID, err)
 	}
+	return nil
+}
 
-	// Save the ticket to MongoDB if available
-	if s.mongoService != nil {
-		// Create flattened ticket object
-		flattenedTicket := &FlattenedTicket{
-			TicketID:   newIssue.Key,
-			Status:     "created",
-			AssignedTo: assignee,
-			JiraLink:   fmt.Sprintf("%s/browse/%s", baseURL.String(), newIssue.Key),
-			CreatedAt:  time.Now(),
-		}
+// AddComment adds a comment to a ticket on behalf of author, since comments
+// are posted as the service account
+func (s *JiraService) AddComment(ctx context.Context, ticketID, author, body string) error {
+	comment := &jira.Comment{
+		Body: fmt.Sprintf("*%s* via ronnin:\n\n%s", author, s.redactor.String(body)),
+	}
+	if _, _, err := s.client.Issue.AddCommentWithContext(ctx, ticketID, comment); err != nil {
+		return fmt.Errorf("failed to comment on Jira ticket %s: %w", ticketID, err)
+	}
+	return nil
+}
 
-		// Extract basic fields
-		if issueValue, ok := req.Payload["issue"].(string); ok {
-			flattenedTicket.Issue = issueValue
-		}
-		if descValue, ok := req.Payload["description"].(string); ok {
-			flattenedTicket.Description = descValue
-		}
-		if emailValue, ok := req.Payload["userEmail"].(string); ok {
-			flattenedTicket.UserEmail = emailValue
-		}
-		if leadValue, ok := req.Payload["leadId"].(string); ok {
-			flattenedTicket.LeadID = leadValue
-		}
-		if productValue, ok := req.Payload["product"].(string); ok {
-			flattenedTicket.Product = productValue
-		}
+// ReplaceDescriptionText replaces every occurrence of oldText in a ticket's
+// description. It is a no-op when the description does not contain oldText.
+func (s *JiraService) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	issue, _, err := s.client.Issue.GetWithContext(ctx, ticketID, &jira.GetQueryOptions{
+		Fields: "description",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get Jira ticket %s: %w", ticketID, err)
+	}
 
-		// Set page URL
-		if pageURL, ok := req.Payload["url"].(string); ok {
-			flattenedTicket.PageURL = pageURL
-		} else {
-			flattenedTicket.PageURL = req.URL
-		}
+	if issue.Fields == nil || !strings.Contains(issue.Fields.Description, oldText) {
+		return nil
+	}
 
-		// Set image URL
-		if req.ImageS3URL != "" && req.ImageS3URL != "None" && req.ImageS3URL != "null" {
-			flattenedTicket.ImageURL = req.ImageS3URL
-		}
+	update := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"description": strings.ReplaceAll(issue.Fields.Description, oldText, newText),
+		},
+	}
+	if _, err := s.client.Issue.UpdateIssueWithContext(ctx, ticketID, update); err != nil {
+		return fmt.Errorf("failed to update Jira ticket %s description: %w", ticketID, err)
+	}
 
-		// Serialize complex data to JSON strings
-		if networkCalls, exists := req.Payload["failedNetworkCalls"]; exists {
-			networkCallsJSON, err := json.Marshal(networkCalls)
-			if err == nil {
-				flattenedTicket.FailedNetworkCallsJSON = string(networkCallsJSON)
-			} else {
-				// Try as string
-				if ncStr, ok := networkCalls.(string); ok {
-					flattenedTicket.FailedNetworkCallsJSON = ncStr
-				}
-			}
-		}
+	return nil
+}
 
-		// Convert payload to JSON string
-		payloadJSON, err := json.Marshal(req.Payload)
-		if err == nil {
-			flattenedTicket.PayloadJSON = string(payloadJSON)
-		}
+// ReleaseScreenshot shows a released screenshot in place of the quarantine
+// note of a ticket
+func (s *JiraService) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return s.ReplaceDescriptionText(ctx, ticketID, QuarantineNote, ScreenshotMarkup(imageURL, contentType))
+}
 
-		// Convert response to JSON string
-		responseJSON, err := json.Marshal(req.Response)
-		if err == nil {
-			flattenedTicket.ResponseJSON = string(responseJSON)
-		}
+// RemoveScreenshot notes the removal of a ticket's quarantined screenshot
+func (s *JiraService) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return s.ReplaceDescriptionText(ctx, ticketID, QuarantineNote, purgedNote)
+}
 
-		// Convert headers to JSON string
-		headersJSON, err := json.Marshal(req.RequestHeaders)
-		if err == nil {
-			flattenedTicket.RequestHeadersJSON = string(headersJSON)
-		}
+// ScreenshotMarkup renders an inline Jira image for a screenshot URL, or a
+// link for screen recordings, which Jira cannot embed from external URLs
+func ScreenshotMarkup(imageURL, contentType string) string {
+	if IsVideoContentType(contentType) {
+		return fmt.Sprintf("[Watch screen recording|%s]", imageURL)
+	}
+	return fmt.Sprintf("!%s|width=800!", imageURL)
+}
 
-		// Save to MongoDB
-		fmt.Printf("Saving ticket %s to MongoDB\n", newIssue.Key)
-		mongoID, err := s.mongoService.SaveTicket(ctx, flattenedTicket)
-		if err != nil {
-			// Log error but don't fail the ticket creation
-			fmt.Printf("Failed to save ticket to MongoDB: %v\n", err)
-		} else {
-			fmt.Printf("Successfully saved ticket to MongoDB with ID: %s\n", mongoID)
-		}
+// clientEnvironment reads the client environment of a ticket payload,
+// which is a map once the payload has been redacted or stored
+func clientEnvironment(v interface{}) *models.ClientEnvironment {
+	if v == nil {
+		return nil
 	}
+	if env, ok := v.(*models.ClientEnvironment); ok {
+		return env
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var env models.ClientEnvironment
+	if err := json.Unmarshal(data, &env); err != nil || env.IsZero() {
+		return nil
+	}
+	return &env
+}
 
-	return ticketResponse, nil
+// recentCapturedEntries is how many of the last console entries and
+// breadcrumbs captured by the browser SDK are shown in descriptions; all of
+// them are kept in the payload
+const recentCapturedEntries = 20
+
+// payloadList reads a list of a ticket payload, which is a list of maps once
+// the payload has been redacted or stored
+func payloadList[T any](v interface{}) []T {
+	if v == nil {
+		return nil
+	}
+	if list, ok := v.([]T); ok {
+		return list
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var list []T
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil
+	}
+	return list
+}
+
+// recentEntries returns the last recentCapturedEntries entries of a list
+func recentEntries[T any](list []T) []T {
+	if len(list) > recentCapturedEntries {
+		return list[len(list)-recentCapturedEntries:]
+	}
+	return list
+}
+
+// consoleLine renders a console entry as a line of a log
+func consoleLine(entry models.ConsoleEntry) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %-5s %s", capturedTime(entry.Timestamp), strings.ToUpper(entry.Level), entry.Message))
 }
 
-func (s *JiraService) getRandomTeamMember() string {
-	// If there are no team members, return empty string
-	if len(s.supportTeam) == 0 {
+// breadcrumbLine renders a breadcrumb with its data, ordered by key
+func breadcrumbLine(crumb models.Breadcrumb) string {
+	line := strings.TrimSpace(capturedTime(crumb.Timestamp) + " " + crumb.Type)
+	if crumb.Message != "" {
+		line += ": " + crumb.Message
+	}
+	keys := getStringMapKeys(crumb.Data)
+	sort.Strings(keys)
+	for _, key := range keys {
+		line += fmt.Sprintf(" %s=%s", key, crumb.Data[key])
+	}
+	return line
+}
+
+// capturedTime renders a timestamp of the browser SDK in milliseconds as a
+// UTC time of day
+func capturedTime(ms int64) string {
+	if ms <= 0 {
 		return ""
 	}
+	return time.UnixMilli(ms).UTC().Format("15:04:05.000")
+}
 
-	// Get random index using math/rand
-	// Note: In Go 1.20+, we don't need to call rand.Seed
-	randIndex := rand.Intn(len(s.supportTeam))
-	selectedMember := s.supportTeam[randIndex]
+// environmentDetails renders the browser, device and locale of a reporter
+func environmentDetails(env *models.ClientEnvironment) string {
+	var details string
+	if env.Browser != "" {
+		details += fmt.Sprintf("* *Browser:* %s\n", strings.TrimSpace(env.Browser+" "+env.BrowserVersion))
+	}
+	if env.OS != "" {
+		details += fmt.Sprintf("* *OS:* %s\n", strings.TrimSpace(env.OS+" "+env.OSVersion))
+	}
+	if env.Device != "" {
+		details += fmt.Sprintf("* *Device:* %s\n", env.Device)
+	}
+	if env.Screen != "" {
+		screen := env.Screen
+		if env.Viewport != "" {
+			screen += fmt.Sprintf(" (viewport %s)", env.Viewport)
+		}
+		details += fmt.Sprintf("* *Screen:* %s\n", screen)
+	} else if env.Viewport != "" {
+		details += fmt.Sprintf("* *Viewport:* %s\n", env.Viewport)
+	}
+	if env.Locale != "" {
+		details += fmt.Sprintf("* *Locale:* %s\n", env.Locale)
+	}
+	if env.Timezone != "" {
+		details += fmt.Sprintf("* *Time Zone:* %s\n", env.Timezone)
+	}
+	if env.UserAgent != "" {
+		details += fmt.Sprintf("* *User Agent:* {{%s}}\n", env.UserAgent)
+	}
+	return details
+}
 
-	fmt.Printf("Randomly selected team member %d of %d: %s\n",
-		randIndex+1, len(s.supportTeam), selectedMember)
+// truncateForLog cuts s to at most n bytes for a log line
+func truncateForLog(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
 
-	return selectedMember
+// videoDetails renders the duration and codec of a screen recording
+func videoDetails(video *models.VideoMetadata) string {
+	details := fmt.Sprintf("* *Format:* %s\n", video.Container)
+	if video.Codec != "" {
+		details += fmt.Sprintf("* *Codec:* %s\n", video.Codec)
+	}
+	if video.DurationSeconds > 0 {
+		duration := time.Duration(video.DurationSeconds * float64(time.Second)).Round(time.Second)
+		details += fmt.Sprintf("* *Duration:* %s\n", duration)
+	}
+	return details
 }
 
 // Add a method for cleanup if needed
@@ -602,6 +1051,16 @@ func getStringMapKeys(m map[string]string) []string {
 	return keys
 }
 
+// Kind returns TrackerJira
+func (s *JiraService) Kind() string {
+	return TrackerJira
+}
+
+// ProjectKey returns the key of the project tickets are created in
+func (s *JiraService) ProjectKey() string {
+	return s.projectKey
+}
+
 // GetMongoService returns the MongoDB service
 func (s *JiraService) GetMongoService() *MongoDBService {
 	return s.mongoService
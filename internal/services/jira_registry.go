@@ -0,0 +1,447 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.uber.org/zap"
+)
+
+// DefaultJiraInstance is the name of the Jira instance configured by the
+// JIRA_* settings, which gets every product without a route
+const DefaultJiraInstance = "default"
+
+// JiraRegistry holds the configured issue trackers by name: Jira instances
+// and trackers of other kinds. New tickets are routed to a tracker by product
+// and existing tickets by the project key in their ID, so project keys must
+// be unique across trackers.
+type JiraRegistry struct {
+	instances map[string]IssueTracker
+	names     []string
+
+	// roster is shared by all trackers
+	roster       atomic.Pointer[Roster]
+	mongoService *MongoDBService
+	runbooks     *Runbooks
+	deploys      *Deploys
+	incidents    *IncidentSuggester
+	summarizer   *Summarizer
+	classifier   *Classifier
+	similar      *SimilarTickets
+	coalescer    *ReportCoalescer
+	flood        *FloodControl
+	titles       *TitleTemplate
+	// tenants file the tickets of their reports in their own trackers
+	tenants *Tenants
+	// registered are the products routed through the admin API, whose
+	// routes take precedence over products
+	registered *Products
+
+	// products maps lowercase product names to instance names; it is
+	// replaced as a whole when the routing is reloaded
+	products atomic.Pointer[map[string]string]
+
+	// categories maps report categories to the instance names of products
+	// without a route
+	categories map[string]string
+
+	// projects maps project keys to instance names
+	projects map[string]string
+}
+
+// NewJiraRegistry creates a registry of issue trackers, which must include
+// the DefaultJiraInstance, routing products to trackers by name. Tickets are
+// assigned from roster and saved to mongoService, which may be nil.
+func NewJiraRegistry(instances map[string]IssueTracker, products map[string]string, roster *Roster, mongoService *MongoDBService) (*JiraRegistry, error) {
+	if instances[DefaultJiraInstance] == nil {
+		return nil, fmt.Errorf("the %s Jira instance is not configured", DefaultJiraInstance)
+	}
+
+	r := &JiraRegistry{
+		instances:    instances,
+		mongoService: mongoService,
+		projects:     make(map[string]string, len(instances)),
+	}
+	r.roster.Store(roster)
+	for name, instance := range instances {
+		r.names = append(r.names, name)
+		if other, ok := r.projects[instance.ProjectKey()]; ok {
+			return nil, fmt.Errorf("issue trackers %s and %s both use project %s", other, name, instance.ProjectKey())
+		}
+		r.projects[instance.ProjectKey()] = name
+	}
+	sort.Strings(r.names)
+
+	if err := r.SetRoutes(products); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetRoutes replaces the routes of products to trackers by name. Routes to
+// unknown trackers fail and keep the current routes.
+func (r *JiraRegistry) SetRoutes(products map[string]string) error {
+	routes := make(map[string]string, len(products))
+	for product, name := range products {
+		if r.instances[name] == nil {
+			return fmt.Errorf("product %s is routed to unknown issue tracker %s", product, name)
+		}
+		routes[strings.ToLower(product)] = name
+	}
+	r.products.Store(&routes)
+	return nil
+}
+
+// ParseJiraRouting parses routes of products to issue trackers, given as
+// "lending=lending-jira;insurance=insurance-github"
+func ParseJiraRouting(spec string) (map[string]string, error) {
+	routes := make(map[string]string)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		product, name, ok := strings.Cut(entry, "=")
+		product, name = strings.TrimSpace(product), strings.TrimSpace(name)
+		if !ok || product == "" || name == "" {
+			return nil, fmt.Errorf("invalid route %q, expected product=tracker", entry)
+		}
+		routes[product] = name
+	}
+	return routes, nil
+}
+
+// Default returns the default Jira instance
+func (r *JiraRegistry) Default() IssueTracker {
+	return r.instances[DefaultJiraInstance]
+}
+
+// Names returns the names of all trackers in order
+func (r *JiraRegistry) Names() []string {
+	return r.names
+}
+
+// Instance returns the tracker with a name, or nil if there is none
+func (r *JiraRegistry) Instance(name string) IssueTracker {
+	return r.instances[name]
+}
+
+// ForProduct returns the tracker new tickets of a product are created in
+func (r *JiraRegistry) ForProduct(product string) IssueTracker {
+	if name, ok := r.productRoute(product); ok {
+		return r.instances[name]
+	}
+	return r.Default()
+}
+
+// forReport returns the tracker a new ticket is created in: the route of its
+// product, then the route of its category, then the default instance
+func (r *JiraRegistry) forReport(product string, classification *models.Classification) IssueTracker {
+	if name, ok := r.productRoute(product); ok {
+		return r.instances[name]
+	}
+	if classification != nil {
+		if name, ok := r.categories[classification.Category]; ok {
+			return r.instances[name]
+		}
+	}
+	return r.Default()
+}
+
+// productRoute returns the name of the tracker of the Jira project of a
+// registered product, or else of the route of the product
+func (r *JiraRegistry) productRoute(product string) (string, bool) {
+	if r.registered != nil {
+		if name, ok := r.projects[r.registered.ProjectKey(product)]; ok {
+			return name, true
+		}
+	}
+	name, ok := (*r.products.Load())[strings.ToLower(product)]
+	return name, ok
+}
+
+// ForTicket returns the tracker holding a ticket, by the project key of its
+// ID, which may be the tracker of a tenant. Tickets of unknown projects are
+// looked up in the default instance.
+func (r *JiraRegistry) ForTicket(ticketID string) IssueTracker {
+	if key, _, ok := strings.Cut(ticketID, "-"); ok {
+		if name, ok := r.projects[key]; ok {
+			return r.instances[name]
+		}
+		if r.tenants != nil {
+			if tracker := r.tenants.TrackerForProject(key); tracker != nil {
+				return tracker
+			}
+		}
+	}
+	return r.Default()
+}
+
+// TicketContext returns ctx carrying the tenant a ticket is looked up in,
+// see Tenants.TicketContext
+func (r *JiraRegistry) TicketContext(ctx context.Context, ticketID string) context.Context {
+	return r.tenants.TicketContext(ctx, ticketID)
+}
+
+// HasProject reports whether a tracker of the deployment uses a project key
+func (r *JiraRegistry) HasProject(projectKey string) bool {
+	_, ok := r.projects[projectKey]
+	return ok
+}
+
+// CreateTicket creates a ticket in the tracker of the tenant carried by ctx,
+// when it has one, and otherwise in the tracker of the product in its
+// payload, or of its category when the product has no route
+func (r *JiraRegistry) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
+	if r.coalescer != nil {
+		if ticket := r.coalescer.Coalesce(ctx, req); ticket != nil {
+			return ticket, nil
+		}
+	}
+	if r.flood != nil {
+		if ticket := r.flood.Check(ctx, req); ticket != nil {
+			return ticket, nil
+		}
+	}
+	product, _ := req.Payload["product"].(string)
+	if r.classifier != nil {
+		req.Classification = r.classifier.Classify(ctx, req)
+	}
+	if r.runbooks != nil {
+		req.Runbooks = r.runbooks.Match(ctx, req)
+	}
+	if r.deploys != nil {
+		req.Deploys = r.deploys.Recent(ctx, req)
+	}
+	if r.summarizer != nil {
+		req.Summary = r.summarizer.Summarize(ctx, req)
+	}
+	if r.titles != nil {
+		req.Title = r.titles.Render(req)
+	}
+	tracker := r.forReport(product, req.Classification)
+	if tenant := TenantID(ctx); tenant != "" && r.tenants != nil {
+		tenantTracker, err := r.tenants.Tracker(tenant)
+		if err != nil {
+			return nil, err
+		}
+		if tenantTracker != nil {
+			tracker = tenantTracker
+		}
+	}
+	ticket, err := tracker.CreateTicket(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if r.incidents != nil {
+		r.incidents.Observe(ctx, tracker, req, ticket)
+	}
+	if r.coalescer != nil {
+		r.coalescer.Track(req, ticket)
+	}
+	if r.flood != nil {
+		r.flood.Track(ctx, req, ticket)
+	}
+	if r.similar != nil {
+		ticket.SimilarTickets = r.similar.Find(ctx, req, ticket.TicketID)
+	}
+	return ticket, nil
+}
+
+// IsTicketOpen reports whether a ticket is still unresolved
+func (r *JiraRegistry) IsTicketOpen(ctx context.Context, ticketID string) (bool, error) {
+	return r.ForTicket(ticketID).IsTicketOpen(ctx, ticketID)
+}
+
+// GetTicketState fetches the state of a ticket
+func (r *JiraRegistry) GetTicketState(ctx context.Context, ticketID string) (*TicketState, error) {
+	return r.ForTicket(ticketID).GetTicketState(ctx, ticketID)
+}
+
+// GetTicketStates fetches the state of several tickets with one search per
+// tracker holding them
+func (r *JiraRegistry) GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error) {
+	byInstance := make(map[IssueTracker][]string)
+	for _, id := range ticketIDs {
+		instance := r.ForTicket(id)
+		byInstance[instance] = append(byInstance[instance], id)
+	}
+
+	states := make(map[string]*TicketState, len(ticketIDs))
+	for instance, ids := range byInstance {
+		found, err := instance.GetTicketStates(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for id, state := range found {
+			states[id] = state
+		}
+	}
+	return states, nil
+}
+
+// AssignTicket assigns a ticket to a Jira account
+func (r *JiraRegistry) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	return r.ForTicket(ticketID).AssignTicket(ctx, ticketID, accountID)
+}
+
+// AddComment adds a comment to a ticket on behalf of author
+func (r *JiraRegistry) AddComment(ctx context.Context, ticketID, author, body string) error {
+	return r.ForTicket(ticketID).AddComment(ctx, ticketID, author, body)
+}
+
+// ReplaceDescriptionText replaces text in the description of a ticket
+func (r *JiraRegistry) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	return r.ForTicket(ticketID).ReplaceDescriptionText(ctx, ticketID, oldText, newText)
+}
+
+// ReleaseScreenshot shows a released screenshot on a ticket
+func (r *JiraRegistry) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return r.ForTicket(ticketID).ReleaseScreenshot(ctx, ticketID, imageURL, contentType)
+}
+
+// RemoveScreenshot notes the removal of a ticket's quarantined screenshot
+func (r *JiraRegistry) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return r.ForTicket(ticketID).RemoveScreenshot(ctx, ticketID)
+}
+
+// IsSupportTeamMember reports whether an account is on the support roster,
+// which is shared by all trackers
+func (r *JiraRegistry) IsSupportTeamMember(accountID string) bool {
+	return r.roster.Load().IsMember(accountID)
+}
+
+// SupportMemberEmail returns the email address of a support team member
+// on the roster, or an empty string when it has none
+func (r *JiraRegistry) SupportMemberEmail(accountID string) string {
+	return r.roster.Load().MemberEmail(accountID)
+}
+
+// SetRoster replaces the support roster of every tracker
+func (r *JiraRegistry) SetRoster(roster *Roster) {
+	r.roster.Store(roster)
+	for _, instance := range r.instances {
+		instance.SetRoster(roster)
+	}
+	if r.tenants != nil {
+		r.tenants.SetRoster(roster)
+	}
+}
+
+// SetRedactor sets the redactor applied to new tickets of every tracker
+func (r *JiraRegistry) SetRedactor(redactor *Redactor) {
+	for _, instance := range r.instances {
+		instance.SetRedactor(redactor)
+	}
+}
+
+// SetRunbooks sets the runbooks linked in new tickets
+func (r *JiraRegistry) SetRunbooks(runbooks *Runbooks) {
+	r.runbooks = runbooks
+}
+
+// SetSummarizer sets the summarizer titling and summarizing new tickets
+func (r *JiraRegistry) SetSummarizer(summarizer *Summarizer) {
+	r.summarizer = summarizer
+}
+
+// SetClassifier sets the classifier of new tickets, and the routes of
+// report categories to trackers, which apply to products without a route
+func (r *JiraRegistry) SetClassifier(classifier *Classifier, categories map[string]string) error {
+	for category, name := range categories {
+		if r.instances[name] == nil {
+			return fmt.Errorf("category %s is routed to unknown issue tracker %s", category, name)
+		}
+	}
+	r.classifier = classifier
+	r.categories = categories
+	return nil
+}
+
+// SetSimilarTickets sets the lookup of the tickets similar to new ones
+func (r *JiraRegistry) SetSimilarTickets(similar *SimilarTickets) {
+	r.similar = similar
+}
+
+// SetIncidents sets the suggester of Statuspage incidents for new tickets
+func (r *JiraRegistry) SetIncidents(incidents *IncidentSuggester) {
+	r.incidents = incidents
+}
+
+// SetCoalescer adds reports of a failure that has an open ticket to it
+// rather than creating another
+func (r *JiraRegistry) SetCoalescer(coalescer *ReportCoalescer) {
+	r.coalescer = coalescer
+}
+
+// SetTitleTemplate sets the template new tickets are titled with
+func (r *JiraRegistry) SetTitleTemplate(titles *TitleTemplate) {
+	r.titles = titles
+}
+
+// SetFloodControl adds reports of a failure reported in a storm to its
+// latest ticket rather than creating another
+func (r *JiraRegistry) SetFloodControl(flood *FloodControl) {
+	r.flood = flood
+}
+
+// SetTenants sets the tenants whose reports are filed in their own trackers
+func (r *JiraRegistry) SetTenants(tenants *Tenants) {
+	r.tenants = tenants
+}
+
+// SetProducts sets the products registered through the admin API, routed to
+// the trackers of their Jira projects
+func (r *JiraRegistry) SetProducts(products *Products) {
+	r.registered = products
+}
+
+// SetDeploys sets the lookup of the recent deploys listed in new tickets
+func (r *JiraRegistry) SetDeploys(deploys *Deploys) {
+	r.deploys = deploys
+}
+
+// SetWorkerPool runs the API calls of every tracker in pool, bounding the
+// requests in flight to them
+func (r *JiraRegistry) SetWorkerPool(pool *WorkerPool) {
+	for name, instance := range r.instances {
+		r.instances[name] = PoolTracker(instance, pool)
+	}
+}
+
+// SetTimeout bounds every API call of every tracker to timeout, including
+// the wait for a worker; 0 leaves them unbounded. It is set after the worker
+// pool.
+func (r *JiraRegistry) SetTimeout(timeout time.Duration) {
+	for name, instance := range r.instances {
+		r.instances[name] = TimeoutTracker(instance, timeout)
+	}
+}
+
+// SetLogger sets the logger of every tracker, naming the tracker on its
+// lines
+func (r *JiraRegistry) SetLogger(log *zap.Logger) {
+	for name, instance := range r.instances {
+		instance.SetLogger(log.With(zap.String("jira_instance", name)))
+	}
+}
+
+// GetMongoService returns the MongoDB service shared by all trackers
+func (r *JiraRegistry) GetMongoService() *MongoDBService {
+	return r.mongoService
+}
+
+// Cleanup releases the resources of every tracker
+func (r *JiraRegistry) Cleanup() error {
+	for _, name := range r.names {
+		if err := r.instances[name].Cleanup(); err != nil {
+			return fmt.Errorf("failed to clean up issue tracker %s: %w", name, err)
+		}
+	}
+	return nil
+}
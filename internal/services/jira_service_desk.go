@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ServiceDesk is the Jira Service Management desk and request type tickets
+// are raised as customer requests of. Participants are the account IDs of
+// users added to every request, besides the reporter.
+type ServiceDesk struct {
+	ID            string
+	RequestTypeID string
+	Participants  []string
+}
+
+// SetServiceDesk makes the service raise tickets as customer requests of a
+// Jira Service Management desk through the Service Desk API, instead of
+// creating issues of its project
+func (s *JiraService) SetServiceDesk(desk *ServiceDesk) {
+	s.serviceDesk = desk
+}
+
+// createRequest raises a customer request with the summary and description
+// of a ticket and returns its issue key. The reporter with reporterEmail is
+// added as a request participant, as a new customer if Jira does not know
+// them yet, so that they follow the request on the customer portal.
+func (s *JiraService) createRequest(ctx context.Context, summary, description, reporterEmail string) (string, *jira.Response, error) {
+	participants := append([]string(nil), s.serviceDesk.Participants...)
+	if reporterEmail != "" {
+		accountID, err := s.customerAccountID(ctx, reporterEmail)
+		if err != nil {
+			// The request is still worth raising without the reporter
+			logger.FromContext(ctx, s.logger).Warn("Failed to add reporter as request participant", zap.Error(err))
+		} else if accountID != "" {
+			participants = append(participants, accountID)
+		}
+	}
+
+	request := &jira.Request{
+		ServiceDeskID: s.serviceDesk.ID,
+		TypeID:        s.serviceDesk.RequestTypeID,
+		FieldValues: []jira.RequestFieldValue{
+			{FieldID: "summary", Value: summary},
+			{FieldID: "description", Value: description},
+		},
+	}
+	created, resp, err := s.client.Request.CreateWithContext(ctx, "", participants, request)
+	if err != nil {
+		return "", resp, err
+	}
+	return created.IssueKey, resp, nil
+}
+
+// customerAccountID returns the account ID of the user with an email,
+// creating a service desk customer for it when there is none
+func (s *JiraService) customerAccountID(ctx context.Context, email string) (string, error) {
+	users, _, err := s.client.User.FindWithContext(ctx, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to find Jira user: %w", err)
+	}
+	for _, user := range users {
+		if strings.EqualFold(user.EmailAddress, email) || len(users) == 1 {
+			return user.AccountID, nil
+		}
+	}
+
+	customer, _, err := s.client.Customer.CreateWithContext(ctx, email, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to create service desk customer: %w", err)
+	}
+	return customer.AccountID, nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// benchmarkTicketRequest is a report as the browser SDK sends it, with a
+// few failed calls, console lines and breadcrumbs
+func benchmarkTicketRequest() *models.TicketRequest {
+	calls := make([]interface{}, 5)
+	for i := range calls {
+		calls[i] = map[string]interface{}{
+			"requestData": map[string]interface{}{
+				"url":    "https://api.example.com/v1/loans/12345/documents?page=2",
+				"method": "GET",
+				"headers": map[string]interface{}{
+					"Accept":       "application/json",
+					"Content-Type": "application/json",
+				},
+			},
+			"responseData": map[string]interface{}{
+				"status": 500,
+				"body":   strings.Repeat(`{"error":"internal"}`, 20),
+			},
+		}
+	}
+	console := make([]interface{}, 20)
+	for i := range console {
+		console[i] = map[string]interface{}{
+			"level":   "error",
+			"message": "TypeError: Cannot read properties of undefined (reading 'total')",
+			"ts":      1736348645123,
+		}
+	}
+	crumbs := make([]interface{}, 20)
+	for i := range crumbs {
+		crumbs[i] = map[string]interface{}{
+			"type":    "click",
+			"message": "button#pay",
+			"ts":      1736348644012,
+		}
+	}
+
+	return &models.TicketRequest{
+		URL: "https://app.example.com/loans/12345",
+		Payload: map[string]interface{}{
+			"issue":              "Payment page shows an error",
+			"description":        strings.Repeat("The payment fails after entering the card details. ", 10),
+			"userEmail":          "jane.doe@example.com",
+			"leadId":             "LEAD-42",
+			"product":            "lending",
+			"severity":           "high",
+			"failedNetworkCalls": calls,
+			"console":            console,
+			"breadcrumbs":        crumbs,
+			"client": map[string]interface{}{
+				"browser":        "Chrome",
+				"browserVersion": "124.0.0.0",
+				"os":             "Android",
+				"device":         "mobile",
+			},
+		},
+		Response: map[string]interface{}{"status": "reported"},
+		RequestHeaders: map[string]string{
+			"Content-Type": "application/json",
+			"User-Agent":   "Mozilla/5.0 (Linux; Android 14) Chrome/124.0.0.0 Mobile",
+		},
+		ImageS3URL:       "https://bucket.s3.amazonaws.com/uploads/ronnin/3f1c2d9e.png?X-Amz-Signature=abc",
+		ImageContentType: "image/png",
+		Runbooks: []models.RunbookLink{
+			{Title: "Payments [triage]", URL: "https://wiki.example.com/payments"},
+		},
+		Deploys: []models.Deploy{
+			{Service: "payments", Version: "1.4.2", URL: "https://deploys.example.com/1"},
+		},
+		Summary: &models.ReportSummary{
+			Title:   "Card payments fail on the loan page",
+			Bullets: []string{"Payments fail with 500", "Started after the last deploy", "Mobile only"},
+		},
+	}
+}
+
+func BenchmarkCreateTicketDescription(b *testing.B) {
+	req := benchmarkTicketRequest()
+	now := time.Now()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ticketDescription(req, "5f0c6a9e-7d1b-4f7e-9c1a-2b3d4e5f6a7b", now)
+	}
+}
+
+func BenchmarkCreateTicketDescriptionTruncated(b *testing.B) {
+	req := benchmarkTicketRequest()
+	req.Payload["failedNetworkCalls"] = strings.Repeat(`{"url":"https://api.example.com/v1/loans"}`, 1000)
+	now := time.Now()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ticketDescription(req, "5f0c6a9e-7d1b-4f7e-9c1a-2b3d4e5f6a7b", now)
+	}
+}
+
+// TestDescriptionFixtures replays the reports in testdata/replay through the
+// description builder; run `go run ./cmd/replay` for a diff of the changes,
+// and with -update to accept them
+func TestDescriptionFixtures(t *testing.T) {
+	fixtures, err := LoadReplayFixtures("testdata/replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures in testdata/replay")
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.Name, func(t *testing.T) {
+			if fixture.Replay(nil) != fixture.Rendered {
+				t.Error("ticket rendered differently than recorded, run `go run ./cmd/replay` for the differences")
+			}
+		})
+	}
+}
+
+func TestAttachedTicketDescription(t *testing.T) {
+	req := benchmarkTicketRequest()
+	req.Payload["failedNetworkCalls"] = `[{"url":"https://api.example.com/v1/loans","status":500}]`
+	files := reportAttachments(req)
+
+	var names []string
+	for _, file := range files {
+		names = append(names, file.name)
+	}
+	if got, want := strings.Join(names, ","), "network-calls.json,headers.json,response.json,payload.json"; got != want {
+		t.Errorf("attached %s, want %s", got, want)
+	}
+	if !strings.Contains(string(files[0].data), "\n  {\n    \"url\"") {
+		t.Errorf("network calls sent as a JSON string are not indented:\n%s", files[0].data)
+	}
+
+	description, overflow := attachedTicketDescription(req, "5f0c6a9e-7d1b-4f7e-9c1a-2b3d4e5f6a7b", time.Now(), files)
+	if overflow != "" {
+		t.Errorf("overflow = %q, want none", overflow)
+	}
+	for _, name := range names {
+		if !strings.Contains(description, "[^"+name+"]") {
+			t.Errorf("description does not link %s", name)
+		}
+	}
+	if strings.Contains(description, "{code:json}") {
+		t.Error("description still contains the technical details")
+	}
+}
@@ -0,0 +1,694 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Kafka SASL mechanisms
+const (
+	KafkaSASLNone        = "none"
+	KafkaSASLPlain       = "plain"
+	KafkaSASLScramSHA256 = "scram-sha-256"
+	KafkaSASLScramSHA512 = "scram-sha-512"
+)
+
+// Keys of the Kafka APIs the producer uses
+const (
+	kafkaProduce          = 0
+	kafkaMetadata         = 3
+	kafkaSaslHandshake    = 17
+	kafkaSaslAuthenticate = 36
+)
+
+// kafkaTimeout bounds one request to a broker, and the time brokers wait
+// for the replicas of produced messages
+const kafkaTimeout = 10 * time.Second
+
+// kafkaMaxResponse bounds the size of broker responses read
+const kafkaMaxResponse = 16 << 20
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// KafkaSASL is the SASL authentication of a Kafka producer
+type KafkaSASL struct {
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// KafkaMessage is a message produced to a topic. Messages with the same key
+// go to the same partition, which keeps them in order.
+type KafkaMessage struct {
+	Key     string
+	Value   []byte
+	Headers map[string]string
+	Time    time.Time
+}
+
+// KafkaProducer produces messages to the partitions of a topic. It speaks
+// the Kafka protocol itself, using Metadata v1, Produce v3 with record
+// batches and SASL authentication, which needs Kafka 1.0 or later. Messages
+// are acknowledged by all in-sync replicas.
+type KafkaProducer struct {
+	brokers  []string
+	topic    string
+	clientID string
+	tls      *tls.Config
+	sasl     KafkaSASL
+
+	mu sync.Mutex
+	// conns are the open connections by broker address
+	conns map[string]*kafkaConn
+	// leaders are the addresses of the leaders of the topic's partitions,
+	// looked up on first use and after failures
+	leaders []string
+	// next is the partition of the next message without a key
+	next int
+}
+
+// NewKafkaProducer creates a producer of messages to topic, bootstrapped
+// from brokers given as host:port. tlsConfig is nil for plaintext
+// connections.
+func NewKafkaProducer(brokers []string, topic, clientID string, tlsConfig *tls.Config, sasl KafkaSASL) *KafkaProducer {
+	return &KafkaProducer{
+		brokers:  brokers,
+		topic:    topic,
+		clientID: clientID,
+		tls:      tlsConfig,
+		sasl:     sasl,
+		conns:    make(map[string]*kafkaConn),
+	}
+}
+
+// Produce writes messages to the topic. Failures are retried once with
+// fresh metadata, since partition leaders move and connections drop.
+func (p *KafkaProducer) Produce(ctx context.Context, messages []KafkaMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := p.produce(ctx, messages)
+	if err != nil && ctx.Err() == nil {
+		p.reset()
+		err = p.produce(ctx, messages)
+	}
+	return err
+}
+
+// Ping checks that the topic's partitions can be looked up
+func (p *KafkaProducer) Ping(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.refresh(ctx)
+}
+
+// Close closes the connections to the brokers
+func (p *KafkaProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reset()
+	return nil
+}
+
+func (p *KafkaProducer) produce(ctx context.Context, messages []KafkaMessage) error {
+	if p.leaders == nil {
+		if err := p.refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	partitions := make(map[int32][]KafkaMessage)
+	for _, message := range messages {
+		partition := p.partition(message.Key)
+		partitions[partition] = append(partitions[partition], message)
+	}
+
+	for partition, batch := range partitions {
+		conn, err := p.conn(ctx, p.leaders[partition])
+		if err != nil {
+			return err
+		}
+
+		var req kafkaEncoder
+		req.int16(-1) // no transactional ID
+		req.int16(-1) // acks from all in-sync replicas
+		req.int32(int32(kafkaTimeout / time.Millisecond))
+		req.int32(1)
+		req.string(p.topic)
+		req.int32(1)
+		req.int32(partition)
+		req.bytes(encodeRecordBatch(batch))
+
+		resp, err := conn.roundTrip(ctx, kafkaProduce, 3, req.buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to produce to partition %d: %w", partition, err)
+		}
+		d := kafkaDecoder{b: resp}
+		for topics := d.int32(); topics > 0; topics-- {
+			d.string()
+			for parts := d.int32(); parts > 0; parts-- {
+				d.int32()
+				code := d.int16()
+				d.int64()
+				d.int64()
+				if code != 0 && d.err == nil {
+					return fmt.Errorf("failed to produce to partition %d: %w", partition, kafkaError(code))
+				}
+			}
+		}
+		if d.err != nil {
+			return fmt.Errorf("failed to read produce response: %w", d.err)
+		}
+	}
+	return nil
+}
+
+// partition returns the partition of a message key: a hash of the key, or
+// the next partition in turn for messages without one
+func (p *KafkaProducer) partition(key string) int32 {
+	if key == "" {
+		p.next = (p.next + 1) % len(p.leaders)
+		return int32(p.next)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int32(h.Sum32() % uint32(len(p.leaders)))
+}
+
+// refresh looks up the leaders of the topic's partitions from the first
+// broker that answers
+func (p *KafkaProducer) refresh(ctx context.Context) error {
+	var errs []error
+	for _, broker := range p.brokers {
+		leaders, err := p.metadata(ctx, broker)
+		if err == nil {
+			p.leaders = leaders
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return fmt.Errorf("failed to look up Kafka topic %s: %w", p.topic, errors.Join(errs...))
+}
+
+func (p *KafkaProducer) metadata(ctx context.Context, broker string) ([]string, error) {
+	conn, err := p.conn(ctx, broker)
+	if err != nil {
+		return nil, err
+	}
+	var req kafkaEncoder
+	req.int32(1)
+	req.string(p.topic)
+	resp, err := conn.roundTrip(ctx, kafkaMetadata, 1, req.buf.Bytes())
+	if err != nil {
+		p.drop(broker)
+		return nil, err
+	}
+
+	d := kafkaDecoder{b: resp}
+	addresses := make(map[int32]string)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.nullableString() // rack
+		addresses[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller
+
+	var leaders []string
+	for topics := d.int32(); topics > 0 && d.err == nil; topics-- {
+		if code := d.int16(); code != 0 && d.err == nil {
+			return nil, kafkaError(code)
+		}
+		d.string()
+		d.bool()
+		parts := d.int32()
+		if parts <= 0 || d.err != nil {
+			break
+		}
+		leaders = make([]string, parts)
+		for ; parts > 0 && d.err == nil; parts-- {
+			code := d.int16()
+			index := d.int32()
+			leader := d.int32()
+			d.int32Array() // replicas
+			d.int32Array() // in-sync replicas
+			if d.err != nil {
+				break
+			}
+			if index < 0 || int(index) >= len(leaders) {
+				return nil, fmt.Errorf("partition %d is out of range", index)
+			}
+			if code != 0 {
+				return nil, fmt.Errorf("partition %d: %w", index, kafkaError(code))
+			}
+			address, ok := addresses[leader]
+			if !ok {
+				return nil, fmt.Errorf("partition %d has no leader", index)
+			}
+			leaders[index] = address
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", d.err)
+	}
+	if len(leaders) == 0 {
+		return nil, errors.New("topic has no partitions")
+	}
+	return leaders, nil
+}
+
+// conn returns the open connection to a broker, connecting and
+// authenticating first when there is none
+func (p *KafkaProducer) conn(ctx context.Context, address string) (*kafkaConn, error) {
+	if conn, ok := p.conns[address]; ok {
+		return conn, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, kafkaTimeout)
+	defer cancel()
+	var netConn net.Conn
+	var err error
+	if p.tls != nil {
+		dialer := &tls.Dialer{Config: p.tls}
+		netConn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		var dialer net.Dialer
+		netConn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kafka broker %s: %w", address, err)
+	}
+
+	conn := &kafkaConn{conn: netConn, clientID: p.clientID}
+	if p.sasl.Mechanism != "" && p.sasl.Mechanism != KafkaSASLNone {
+		if err := conn.authenticate(ctx, p.sasl); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("failed to authenticate to Kafka broker %s: %w", address, err)
+		}
+	}
+	p.conns[address] = conn
+	return conn, nil
+}
+
+// drop closes the connection to a broker after a failure
+func (p *KafkaProducer) drop(address string) {
+	if conn, ok := p.conns[address]; ok {
+		conn.conn.Close()
+		delete(p.conns, address)
+	}
+}
+
+// reset closes all connections and forgets the partition leaders
+func (p *KafkaProducer) reset() {
+	for address := range p.conns {
+		p.drop(address)
+	}
+	p.leaders = nil
+}
+
+// kafkaConn is a connection to a broker, used by one request at a time
+type kafkaConn struct {
+	conn        net.Conn
+	clientID    string
+	correlation int32
+}
+
+// roundTrip sends a request and returns the body of its response
+func (c *kafkaConn) roundTrip(ctx context.Context, apiKey, version int16, body []byte) ([]byte, error) {
+	deadline := time.Now().Add(kafkaTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+	c.correlation++
+
+	var req kafkaEncoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(c.correlation)
+	req.string(c.clientID)
+	req.buf.Write(body)
+	frame := req.buf.Bytes()
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > kafkaMaxResponse {
+		return nil, fmt.Errorf("invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+	if correlation := int32(binary.BigEndian.Uint32(resp)); correlation != c.correlation {
+		return nil, fmt.Errorf("response %d does not match request %d", correlation, c.correlation)
+	}
+	return resp[4:], nil
+}
+
+// authenticate authenticates the connection with SASL
+func (c *kafkaConn) authenticate(ctx context.Context, sasl KafkaSASL) error {
+	mechanism := strings.ToUpper(sasl.Mechanism)
+	var req kafkaEncoder
+	req.string(mechanism)
+	resp, err := c.roundTrip(ctx, kafkaSaslHandshake, 1, req.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	d := kafkaDecoder{b: resp}
+	if code := d.int16(); code != 0 {
+		return fmt.Errorf("broker does not accept SASL %s: %w", mechanism, kafkaError(code))
+	}
+
+	switch sasl.Mechanism {
+	case KafkaSASLPlain:
+		_, err := c.saslAuthenticate(ctx, []byte("\x00"+sasl.Username+"\x00"+sasl.Password))
+		return err
+	case KafkaSASLScramSHA256:
+		return c.scram(ctx, sha256.New, sasl.Username, sasl.Password)
+	case KafkaSASLScramSHA512:
+		return c.scram(ctx, sha512.New, sasl.Username, sasl.Password)
+	}
+	return fmt.Errorf("unsupported SASL mechanism %s", sasl.Mechanism)
+}
+
+func (c *kafkaConn) saslAuthenticate(ctx context.Context, auth []byte) ([]byte, error) {
+	var req kafkaEncoder
+	req.bytes(auth)
+	resp, err := c.roundTrip(ctx, kafkaSaslAuthenticate, 0, req.buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	d := kafkaDecoder{b: resp}
+	code := d.int16()
+	message := d.nullableString()
+	reply := d.bytesValue()
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to read SASL response: %w", d.err)
+	}
+	if code != 0 {
+		if message != "" {
+			return nil, fmt.Errorf("%w: %s", kafkaError(code), message)
+		}
+		return nil, kafkaError(code)
+	}
+	return reply, nil
+}
+
+// scram authenticates with SCRAM (RFC 5802) using the hash h
+func (c *kafkaConn) scram(ctx context.Context, h func() hash.Hash, username, password string) error {
+	nonce := make([]byte, 24)
+	rand.Read(nonce)
+	clientNonce := base64.RawStdEncoding.EncodeToString(nonce)
+	username = strings.NewReplacer("=", "=3D", ",", "=2C").Replace(username)
+	clientFirst := "n=" + username + ",r=" + clientNonce
+
+	serverFirst, err := c.saslAuthenticate(ctx, []byte("n,,"+clientFirst))
+	if err != nil {
+		return err
+	}
+	fields := scramFields(string(serverFirst))
+	salt, err := base64.StdEncoding.DecodeString(fields["s"])
+	if err != nil {
+		return fmt.Errorf("invalid SCRAM salt: %w", err)
+	}
+	iterations, err := strconv.Atoi(fields["i"])
+	if err != nil || iterations <= 0 {
+		return fmt.Errorf("invalid SCRAM iteration count %q", fields["i"])
+	}
+	if !strings.HasPrefix(fields["r"], clientNonce) {
+		return errors.New("SCRAM server nonce does not extend the client nonce")
+	}
+
+	mac := func(key []byte, data string) []byte {
+		m := hmac.New(h, key)
+		m.Write([]byte(data))
+		return m.Sum(nil)
+	}
+	salted := pbkdf2.Key([]byte(password), salt, iterations, h().Size(), h)
+	clientKey := mac(salted, "Client Key")
+	storedKey := h()
+	storedKey.Write(clientKey)
+	clientFinal := "c=biws,r=" + fields["r"]
+	authMessage := clientFirst + "," + string(serverFirst) + "," + clientFinal
+	proof := mac(storedKey.Sum(nil), authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+
+	serverFinal, err := c.saslAuthenticate(ctx, []byte(clientFinal+",p="+base64.StdEncoding.EncodeToString(proof)))
+	if err != nil {
+		return err
+	}
+	fields = scramFields(string(serverFinal))
+	if fields["e"] != "" {
+		return fmt.Errorf("SCRAM authentication failed: %s", fields["e"])
+	}
+	signature := base64.StdEncoding.EncodeToString(mac(mac(salted, "Server Key"), authMessage))
+	if !hmac.Equal([]byte(fields["v"]), []byte(signature)) {
+		return errors.New("SCRAM server signature does not match")
+	}
+	return nil
+}
+
+// scramFields parses the comma-separated key=value attributes of a SCRAM
+// message
+func scramFields(message string) map[string]string {
+	fields := make(map[string]string)
+	for _, attribute := range strings.Split(message, ",") {
+		if key, value, ok := strings.Cut(attribute, "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// encodeRecordBatch encodes messages as a record batch (magic 2) without
+// compression
+func encodeRecordBatch(messages []KafkaMessage) []byte {
+	first := messages[0].Time.UnixMilli()
+	last := first
+	var records kafkaEncoder
+	for i, message := range messages {
+		timestamp := message.Time.UnixMilli()
+		last = max(last, timestamp)
+
+		var record kafkaEncoder
+		record.int8(0) // attributes
+		record.varint(timestamp - first)
+		record.varint(int64(i))
+		if message.Key == "" {
+			record.varint(-1)
+		} else {
+			record.varbytes([]byte(message.Key))
+		}
+		record.varbytes(message.Value)
+		keys := make([]string, 0, len(message.Headers))
+		for key := range message.Headers {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		record.varint(int64(len(keys)))
+		for _, key := range keys {
+			record.varbytes([]byte(key))
+			record.varbytes([]byte(message.Headers[key]))
+		}
+
+		records.varint(int64(record.buf.Len()))
+		records.buf.Write(record.buf.Bytes())
+	}
+
+	// The CRC covers everything from the attributes on
+	var body kafkaEncoder
+	body.int16(0) // attributes: no compression, create time
+	body.int32(int32(len(messages) - 1))
+	body.int64(first)
+	body.int64(last)
+	body.int64(-1) // producer ID
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(messages)))
+	body.buf.Write(records.buf.Bytes())
+
+	var batch kafkaEncoder
+	batch.int64(0) // base offset, assigned by the broker
+	batch.int32(int32(4 + 1 + 4 + body.buf.Len()))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(body.buf.Bytes(), crc32c)))
+	batch.buf.Write(body.buf.Bytes())
+	return batch.buf.Bytes()
+}
+
+// kafkaErrorNames are the names of the Kafka error codes a producer is
+// likely to see
+var kafkaErrorNames = map[int16]string{
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_FOR_PARTITION",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	33: "UNSUPPORTED_SASL_MECHANISM",
+	34: "ILLEGAL_SASL_STATE",
+	35: "UNSUPPORTED_VERSION",
+	58: "SASL_AUTHENTICATION_FAILED",
+}
+
+// kafkaError describes a Kafka error code
+func kafkaError(code int16) error {
+	if name, ok := kafkaErrorNames[code]; ok {
+		return fmt.Errorf("Kafka error %d %s", code, name)
+	}
+	return fmt.Errorf("Kafka error %d", code)
+}
+
+// kafkaEncoder writes the big-endian and varint encodings of the Kafka
+// protocol
+type kafkaEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.buf.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	e.buf.Write(binary.BigEndian.AppendUint16(nil, uint16(v)))
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	e.buf.Write(binary.BigEndian.AppendUint32(nil, uint32(v)))
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	e.buf.Write(binary.BigEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (e *kafkaEncoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.buf.WriteString(v)
+}
+
+func (e *kafkaEncoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.buf.Write(v)
+}
+
+func (e *kafkaEncoder) varint(v int64) {
+	e.buf.Write(binary.AppendVarint(nil, v))
+}
+
+func (e *kafkaEncoder) varbytes(v []byte) {
+	e.varint(int64(len(v)))
+	e.buf.Write(v)
+}
+
+// kafkaDecoder reads the big-endian encodings of the Kafka protocol. Reads
+// past the end set err and return zero values.
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *kafkaDecoder) bool() bool {
+	v := d.take(1)
+	return v != nil && v[0] != 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if v := d.take(2); v != nil {
+		return int16(binary.BigEndian.Uint16(v))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if v := d.take(4); v != nil {
+		return int32(binary.BigEndian.Uint32(v))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if v := d.take(8); v != nil {
+		return int64(binary.BigEndian.Uint64(v))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) string() string {
+	return string(d.take(int(d.int16())))
+}
+
+func (d *kafkaDecoder) nullableString() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *kafkaDecoder) bytesValue() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+func (d *kafkaDecoder) int32Array() {
+	if n := d.int32(); n > 0 {
+		d.take(int(n) * 4)
+	}
+}
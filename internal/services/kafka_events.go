@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// kafkaQueueSize bounds the events waiting to be published; further ones are
+// dropped rather than holding up reports and webhooks
+const kafkaQueueSize = 100
+
+// KafkaEvents publishes ticket.created and ticket.updated events to a Kafka
+// topic in the background, for consumers that would otherwise poll the API.
+// Events are keyed by ticket ID, so the events of a ticket stay in order.
+type KafkaEvents struct {
+	producer *KafkaProducer
+	logger   *zap.Logger
+
+	queue chan KafkaMessage
+}
+
+// NewKafkaEvents creates a publisher of ticket events through producer
+func NewKafkaEvents(producer *KafkaProducer, log *zap.Logger) *KafkaEvents {
+	return &KafkaEvents{
+		producer: producer,
+		logger:   log,
+		queue:    make(chan KafkaMessage, kafkaQueueSize),
+	}
+}
+
+// TicketCreated queues the ticket.created event of a new ticket. It never
+// blocks.
+func (k *KafkaEvents) TicketCreated(data TicketEventData) {
+	k.publish(data.TicketID, NewEvent(EventTicketCreated, data))
+}
+
+// TicketStateChanged queues the ticket.updated event of a change to the
+// status, assignee or resolution of a ticket. It never blocks.
+func (k *KafkaEvents) TicketStateChanged(ticket *FlattenedTicket, state *TicketState) {
+	if data, ok := TicketUpdate(ticket, state); ok {
+		k.publish(ticket.TicketID, NewEvent(EventTicketUpdated, data))
+	}
+}
+
+func (k *KafkaEvents) publish(ticketID string, event Event) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		k.logger.Error("Failed to encode Kafka event", zap.String("event", event.Type), zap.Error(err))
+		return
+	}
+	message := KafkaMessage{
+		Key:     ticketID,
+		Value:   value,
+		Headers: map[string]string{"event": event.Type, "content-type": "application/json"},
+		Time:    event.CreatedAt,
+	}
+	select {
+	case k.queue <- message:
+	default:
+		k.logger.Warn("Kafka queue is full, dropping event", zap.String("ticket_id", ticketID), zap.String("event", event.Type))
+	}
+}
+
+// Run publishes queued events until stopping is closed, then publishes the
+// ones still queued until ctx is done. Events queued together are produced
+// in one request.
+func (k *KafkaEvents) Run(ctx context.Context, stopping <-chan struct{}) {
+	defer k.producer.Close()
+	for {
+		select {
+		case message := <-k.queue:
+			k.produce(ctx, append([]KafkaMessage{message}, k.drain()...))
+		case <-stopping:
+			if messages := k.drain(); len(messages) > 0 && ctx.Err() == nil {
+				k.produce(ctx, messages)
+			}
+			return
+		}
+	}
+}
+
+// drain returns the queued events without waiting for more
+func (k *KafkaEvents) drain() []KafkaMessage {
+	var messages []KafkaMessage
+	for {
+		select {
+		case message := <-k.queue:
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+}
+
+func (k *KafkaEvents) produce(ctx context.Context, messages []KafkaMessage) {
+	ctx, cancel := context.WithTimeout(ctx, 3*kafkaTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := k.producer.Produce(ctx, messages); err != nil {
+		k.logger.Warn("Failed to publish events to Kafka", zap.Int("events", len(messages)), zap.Error(err))
+		return
+	}
+	k.logger.Debug("Published events to Kafka", zap.Int("events", len(messages)), zap.Duration("latency", time.Since(start)))
+}
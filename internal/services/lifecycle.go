@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// checkpointReserve is the part of the shutdown deadline kept for
+	// checkpoints after draining
+	checkpointReserve = 5 * time.Second
+	// cancelGrace is how long cancelled workers get to return before the
+	// checkpoints run anyway
+	cancelGrace = time.Second
+)
+
+// Worker runs background work until stopping is closed, then returns once
+// its in-flight work is done. In-flight work uses ctx, which is cancelled
+// when the shutdown deadline leaves only time for checkpoints.
+type Worker func(ctx context.Context, stopping <-chan struct{})
+
+// Lifecycle tracks background workers so shutdown can drain them, and saves
+// what they could not finish with checkpoints
+type Lifecycle struct {
+	stopping   chan struct{}
+	work       context.Context
+	cancelWork context.CancelFunc
+	logger     *zap.Logger
+
+	wg          sync.WaitGroup
+	mu          sync.Mutex
+	running     map[string]int
+	checkpoints []namedCheckpoint
+}
+
+type namedCheckpoint struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewLifecycle creates a lifecycle without workers
+func NewLifecycle(log *zap.Logger) *Lifecycle {
+	work, cancel := context.WithCancel(context.Background())
+	return &Lifecycle{
+		stopping:   make(chan struct{}),
+		work:       work,
+		cancelWork: cancel,
+		logger:     log,
+		running:    make(map[string]int),
+	}
+}
+
+// Go runs a worker in the background until shutdown
+func (l *Lifecycle) Go(name string, worker Worker) {
+	l.mu.Lock()
+	l.running[name]++
+	l.mu.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer func() {
+			l.mu.Lock()
+			l.running[name]--
+			l.mu.Unlock()
+		}()
+		worker(l.work, l.stopping)
+	}()
+}
+
+// OnCheckpoint registers a function saving unfinished work on shutdown,
+// called once all workers returned or the drain deadline passed
+func (l *Lifecycle) OnCheckpoint(name string, fn func(ctx context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.checkpoints = append(l.checkpoints, namedCheckpoint{name: name, fn: fn})
+}
+
+// Shutdown stops the workers and waits for their in-flight work until ctx
+// leaves only time for checkpoints, then cancels what is left and runs the
+// checkpoints with a timeout of their own
+func (l *Lifecycle) Shutdown(ctx context.Context) {
+	close(l.stopping)
+
+	drainCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		reserve := min(checkpointReserve, time.Until(deadline)/4)
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithDeadline(ctx, deadline.Add(-reserve))
+		defer cancel()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		l.logger.Info("Background work drained")
+	case <-drainCtx.Done():
+		l.logger.Warn("Background work did not drain in time, cancelling it", zap.Strings("workers", l.runningWorkers()))
+		l.cancelWork()
+		select {
+		case <-drained:
+		case <-time.After(cancelGrace):
+		}
+	}
+	l.cancelWork()
+
+	// Checkpoints get their reserve even when stopping the server already
+	// used up the deadline, since unfinished work is lost otherwise
+	checkpointCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), checkpointReserve)
+	defer cancel()
+
+	l.mu.Lock()
+	checkpoints := l.checkpoints
+	l.mu.Unlock()
+	for _, checkpoint := range checkpoints {
+		if err := checkpoint.fn(checkpointCtx); err != nil {
+			l.logger.Error("Failed to checkpoint unfinished work", zap.String("checkpoint", checkpoint.name), zap.Error(err))
+		}
+	}
+}
+
+// runningWorkers returns the names of the workers that have not returned
+func (l *Lifecycle) runningWorkers() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var names []string
+	for name, count := range l.running {
+		if count > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
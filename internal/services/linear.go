@@ -0,0 +1,530 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultLinearAPIURL is Linear's GraphQL endpoint
+const DefaultLinearAPIURL = "https://api.linear.app/graphql"
+
+// linearMarkdown is Linear's Markdown, which collapses sections between +++
+// lines
+var linearMarkdown = markdownDialect{
+	limit: 65536,
+	collapse: func(title, content string) string {
+		return fmt.Sprintf("+++ %s\n\n```json\n%s\n```\n\n+++\n\n", title, content)
+	},
+	image: func(url string) string {
+		return fmt.Sprintf("![Screenshot](%s)", url)
+	},
+	quarantineNote: "> **Attachment quarantined:** the attachment of this report was flagged by the malware scanner and is pending review.",
+	purgedNote:     "> **Attachment removed:** the attachment of this report was removed after malware review.",
+}
+
+// linearPriorities are the Linear priorities of report severities, and of
+// the Jira priority names of DEFAULT_PRIORITY for reports without one.
+// Linear numbers priorities from 1 (urgent) to 4 (low).
+var linearPriorities = map[string]int{
+	SeverityCritical: 1,
+	SeverityHigh:     2,
+	SeverityMedium:   3,
+	SeverityLow:      4,
+	"Highest":        1,
+	"High":           2,
+	"Medium":         3,
+	"Low":            4,
+	"Lowest":         4,
+}
+
+// errLinearNotFound is returned for issues that do not exist
+var errLinearNotFound = errors.New("Linear issue not found")
+
+// LinearTracker creates tickets as issues of a Linear team. Ticket IDs are
+// Linear's issue identifiers, which start with the team key, e.g. ENG-42.
+type LinearTracker struct {
+	apiURL          string
+	apiKey          string
+	teamKey         string
+	labels          []string
+	defaultPriority int
+	client          *http.Client
+
+	// team is the ID of the team and labels the IDs of its labels by name,
+	// looked up on first use
+	teamMu sync.Mutex
+	team   *linearTeam
+	// users caches the IDs of Linear users by email
+	users sync.Map
+
+	roster       atomic.Pointer[Roster] // replaced when the configuration is reloaded
+	mongoService *MongoDBService
+	redactor     *Redactor
+	logger       *zap.Logger
+}
+
+// linearTeam is a team's ID and the IDs of its labels by lowercase name
+type linearTeam struct {
+	id     string
+	labels map[string]string
+}
+
+// NewLinearTracker creates a tracker of the issues of the team with teamKey,
+// labelling new issues with labels, which must exist in the team or the
+// workspace. Reports without a severity get defaultPriority, a Jira priority
+// name. An empty apiURL uses Linear's API.
+func NewLinearTracker(apiURL, apiKey, teamKey string, labels []string, defaultPriority string, roster *Roster, mongoService *MongoDBService) *LinearTracker {
+	if apiURL == "" {
+		apiURL = DefaultLinearAPIURL
+	}
+	t := &LinearTracker{
+		apiURL:          apiURL,
+		apiKey:          apiKey,
+		teamKey:         teamKey,
+		labels:          labels,
+		defaultPriority: linearPriorities[defaultPriority],
+		client:          &http.Client{Timeout: 30 * time.Second},
+		mongoService:    mongoService,
+		logger:          zap.NewNop(),
+	}
+	t.SetRoster(roster)
+	return t
+}
+
+// linearIssue is the part of the Linear issue type ronnin uses
+type linearIssue struct {
+	ID          string `json:"id"`
+	Identifier  string `json:"identifier"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	State       struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"state"`
+	Assignee *struct {
+		Email string `json:"email"`
+	} `json:"assignee"`
+}
+
+const linearIssueFields = "id identifier url description state { name type } assignee { email }"
+
+// CreateTicket creates an issue for a report, assigned to the Linear user
+// with the email of the support team member on shift, attaches the page and
+// screenshot as links, and saves the ticket to MongoDB
+func (t *LinearTracker) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
+	// Nothing sensitive is sent to Linear or stored
+	req = t.redactor.Ticket(req)
+	log := logger.FromContext(ctx, t.logger).With(zap.String("team", t.teamKey))
+
+	team, err := t.lookupTeam(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	input := map[string]interface{}{
+		"teamId": team.id,
+		"title":  ticketTitle(req),
+	}
+	priority := t.defaultPriority
+	if severity := TicketSeverity(req); linearPriorities[severity] != 0 {
+		priority = linearPriorities[severity]
+	}
+	if priority != 0 {
+		input["priority"] = priority
+	}
+	var labelIDs []string
+	for _, label := range t.labels {
+		if id, ok := team.labels[strings.ToLower(label)]; ok {
+			labelIDs = append(labelIDs, id)
+		} else {
+			log.Warn("Linear label does not exist, leaving it out", zap.String("label", label))
+		}
+	}
+	if len(labelIDs) > 0 {
+		input["labelIds"] = labelIDs
+	}
+
+	product, _ := req.Payload["product"].(string)
+	assignee := t.Roster().Assignee(ctx, product, time.Now())
+	if userID := t.userID(ctx, assignee, log); userID != "" {
+		input["assigneeId"] = userID
+	}
+
+	body, overflow := renderDescription(ctx, linearMarkdown, req, renderScreenshot(linearMarkdown, req, req.ImageS3URL, true))
+	input["description"] = body
+
+	var created struct {
+		IssueCreate struct {
+			Success bool        `json:"success"`
+			Issue   linearIssue `json:"issue"`
+		} `json:"issueCreate"`
+	}
+	start := time.Now()
+	err = t.query(ctx, `mutation($input: IssueCreateInput!) { issueCreate(input: $input) { success issue { `+linearIssueFields+` } } }`,
+		map[string]interface{}{"input": input}, &created)
+	latency := time.Since(start)
+	if err == nil && !created.IssueCreate.Success {
+		err = errors.New("issueCreate was not successful")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Linear issue: %w", err)
+	}
+	issue := created.IssueCreate.Issue
+
+	ticketsCreatedTotal.WithLabelValues(t.teamKey).Inc()
+
+	// Sections that did not fit the description follow as comments
+	for _, section := range overflow {
+		if err := t.comment(ctx, issue.ID, section); err != nil {
+			log.Warn("Failed to add comment with truncated content", zap.String("ticket_id", issue.Identifier), zap.Error(err))
+		}
+	}
+	t.attachLinks(ctx, issue, req, log)
+
+	ticketResponse := &models.TicketResponse{
+		TicketID:   issue.Identifier,
+		Status:     "created",
+		AssignedTo: assignee,
+		JiraLink:   issue.URL,
+	}
+	saveTicket(ctx, t.mongoService, req, ticketResponse, latency, log)
+	return ticketResponse, nil
+}
+
+// attachLinks attaches the reported page and the screenshot to an issue,
+// where Linear shows them next to the description
+func (t *LinearTracker) attachLinks(ctx context.Context, issue linearIssue, req *models.TicketRequest, log *zap.Logger) {
+	pageURL, _ := req.Payload["url"].(string)
+	if pageURL == "" {
+		pageURL = req.URL
+	}
+	links := [][2]string{{"Reported page", pageURL}}
+	if req.QuarantineKey == "" && hasScreenshotURL(req) && strings.HasPrefix(req.ImageS3URL, "http") {
+		title := "Screenshot"
+		if IsVideoContentType(req.ImageContentType) {
+			title = "Screen recording"
+		}
+		links = append(links, [2]string{title, req.ImageS3URL})
+	}
+
+	for _, link := range links {
+		if !strings.HasPrefix(link[1], "http") {
+			continue
+		}
+		err := t.query(ctx, `mutation($issueId: String!, $url: String!, $title: String) { attachmentLinkURL(issueId: $issueId, url: $url, title: $title) { success } }`,
+			map[string]interface{}{"issueId": issue.ID, "url": link[1], "title": link[0]}, nil)
+		if err != nil {
+			log.Warn("Failed to attach link to Linear issue", zap.String("ticket_id", issue.Identifier), zap.String("title", link[0]), zap.Error(err))
+		}
+	}
+}
+
+// IsTicketOpen reports whether an issue is neither completed nor canceled
+func (t *LinearTracker) IsTicketOpen(ctx context.Context, ticketID string) (bool, error) {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return false, err
+	}
+	return !linearClosed(issue.State.Type), nil
+}
+
+// GetTicketState fetches the workflow state and assignee of an issue. The
+// state type is the resolution of completed and canceled issues. Assignees
+// are given by Jira account when they are on the roster.
+func (t *LinearTracker) GetTicketState(ctx context.Context, ticketID string) (*TicketState, error) {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	return t.issueState(issue), nil
+}
+
+// GetTicketStates fetches the state of several issues, one request each.
+// Issues that do not exist are missing from the result.
+func (t *LinearTracker) GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error) {
+	states := make(map[string]*TicketState, len(ticketIDs))
+	for _, id := range ticketIDs {
+		issue, err := t.issue(ctx, id)
+		if errors.Is(err, errLinearNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		states[id] = t.issueState(issue)
+	}
+	return states, nil
+}
+
+func (t *LinearTracker) issueState(issue *linearIssue) *TicketState {
+	state := &TicketState{Status: issue.State.Name}
+	if linearClosed(issue.State.Type) {
+		state.Resolution = issue.State.Type
+	}
+	if issue.Assignee != nil {
+		state.AssignedTo = issue.Assignee.Email
+		if member, ok := t.Roster().FindMember(func(m RosterMember) bool { return strings.EqualFold(m.Email, issue.Assignee.Email) }); ok {
+			state.AssignedTo = member.AccountID
+		}
+	}
+	return state
+}
+
+// linearClosed reports whether a workflow state type ends an issue
+func linearClosed(stateType string) bool {
+	return stateType == "completed" || stateType == "canceled"
+}
+
+// AssignTicket assigns an issue to the Linear user with the email of a
+// support team member
+func (t *LinearTracker) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	userID := t.userID(ctx, accountID, t.logger)
+	if userID == "" {
+		return fmt.Errorf("support team member %s has no Linear user", accountID)
+	}
+	return t.updateIssue(ctx, ticketID, map[string]interface{}{"assigneeId": userID})
+}
+
+// AddComment adds a comment to an issue on behalf of author, since comments
+// are posted as the API key's user
+func (t *LinearTracker) AddComment(ctx context.Context, ticketID, author, body string) error {
+	comment := fmt.Sprintf("**%s** via ronnin:\n\n%s", author, t.redactor.String(body))
+	if err := t.comment(ctx, ticketID, comment); err != nil {
+		return fmt.Errorf("failed to comment on Linear issue %s: %w", ticketID, err)
+	}
+	return nil
+}
+
+func (t *LinearTracker) comment(ctx context.Context, issueID, body string) error {
+	return t.query(ctx, `mutation($input: CommentCreateInput!) { commentCreate(input: $input) { success } }`,
+		map[string]interface{}{"input": map[string]string{"issueId": issueID, "body": body}}, nil)
+}
+
+// ReplaceDescriptionText replaces every occurrence of oldText in an issue's
+// description. It is a no-op when the description does not contain oldText.
+func (t *LinearTracker) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	issue, err := t.issue(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(issue.Description, oldText) {
+		return nil
+	}
+	return t.updateIssue(ctx, ticketID, map[string]interface{}{"description": strings.ReplaceAll(issue.Description, oldText, newText)})
+}
+
+// ReleaseScreenshot shows a released screenshot in place of the quarantine
+// note of an issue
+func (t *LinearTracker) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return t.ReplaceDescriptionText(ctx, ticketID, linearMarkdown.quarantineNote, linearMarkdown.screenshot(imageURL, contentType))
+}
+
+// RemoveScreenshot notes the removal of an issue's quarantined screenshot
+func (t *LinearTracker) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return t.ReplaceDescriptionText(ctx, ticketID, linearMarkdown.quarantineNote, linearMarkdown.purgedNote)
+}
+
+// Ping checks that the team can be read with the API key
+func (t *LinearTracker) Ping(ctx context.Context) error {
+	if _, err := t.lookupTeam(ctx); err != nil {
+		return fmt.Errorf("failed to reach Linear: %w", err)
+	}
+	return nil
+}
+
+// Kind returns TrackerLinear
+func (t *LinearTracker) Kind() string {
+	return TrackerLinear
+}
+
+// ProjectKey returns the team key, which starts the team's issue identifiers
+func (t *LinearTracker) ProjectKey() string {
+	return t.teamKey
+}
+
+// Roster returns the support roster issues are assigned from
+func (t *LinearTracker) Roster() *Roster {
+	return t.roster.Load()
+}
+
+// SetRoster replaces the support roster issues are assigned from
+func (t *LinearTracker) SetRoster(roster *Roster) {
+	t.roster.Store(roster)
+}
+
+// SetRedactor sets the redactor applied to new tickets
+func (t *LinearTracker) SetRedactor(redactor *Redactor) {
+	t.redactor = redactor
+}
+
+// SetLogger sets the logger ticket creation is logged to
+func (t *LinearTracker) SetLogger(log *zap.Logger) {
+	t.logger = log
+}
+
+// Cleanup releases the tracker's idle connections
+func (t *LinearTracker) Cleanup() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// lookupTeam returns the team and its labels, querying them on first use.
+// Failed lookups are retried on the next call.
+func (t *LinearTracker) lookupTeam(ctx context.Context) (*linearTeam, error) {
+	t.teamMu.Lock()
+	defer t.teamMu.Unlock()
+	if t.team != nil {
+		return t.team, nil
+	}
+
+	var result struct {
+		Teams struct {
+			Nodes []struct {
+				ID     string `json:"id"`
+				Labels struct {
+					Nodes []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"nodes"`
+				} `json:"labels"`
+			} `json:"nodes"`
+		} `json:"teams"`
+	}
+	err := t.query(ctx, `query($key: String!) { teams(filter: { key: { eq: $key } }) { nodes { id labels(first: 250) { nodes { id name } } } } }`,
+		map[string]interface{}{"key": t.teamKey}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up Linear team %s: %w", t.teamKey, err)
+	}
+	if len(result.Teams.Nodes) == 0 {
+		return nil, fmt.Errorf("Linear team %s does not exist", t.teamKey)
+	}
+
+	node := result.Teams.Nodes[0]
+	team := &linearTeam{id: node.ID, labels: make(map[string]string, len(node.Labels.Nodes))}
+	for _, label := range node.Labels.Nodes {
+		team.labels[strings.ToLower(label.Name)] = label.ID
+	}
+	t.team = team
+	return team, nil
+}
+
+// userID returns the ID of the Linear user with the email of a support team
+// member, or an empty string when there is none
+func (t *LinearTracker) userID(ctx context.Context, accountID string, log *zap.Logger) string {
+	if accountID == "" {
+		return ""
+	}
+	email := t.Roster().MemberEmail(accountID)
+	if email == "" {
+		return ""
+	}
+	if id, ok := t.users.Load(email); ok {
+		return id.(string)
+	}
+
+	var result struct {
+		Users struct {
+			Nodes []struct {
+				ID string `json:"id"`
+			} `json:"nodes"`
+		} `json:"users"`
+	}
+	err := t.query(ctx, `query($email: String!) { users(filter: { email: { eq: $email } }) { nodes { id } } }`,
+		map[string]interface{}{"email": email}, &result)
+	if err != nil {
+		log.Warn("Failed to look up Linear user", zap.String("account_id", accountID), zap.Error(err))
+		return ""
+	}
+	if len(result.Users.Nodes) == 0 {
+		return ""
+	}
+	id := result.Users.Nodes[0].ID
+	t.users.Store(email, id)
+	return id
+}
+
+func (t *LinearTracker) issue(ctx context.Context, ticketID string) (*linearIssue, error) {
+	var result struct {
+		Issue *linearIssue `json:"issue"`
+	}
+	err := t.query(ctx, `query($id: String!) { issue(id: $id) { `+linearIssueFields+` } }`,
+		map[string]interface{}{"id": ticketID}, &result)
+	if err == nil && result.Issue == nil {
+		err = errLinearNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Linear issue %s: %w", ticketID, err)
+	}
+	return result.Issue, nil
+}
+
+func (t *LinearTracker) updateIssue(ctx context.Context, ticketID string, input map[string]interface{}) error {
+	err := t.query(ctx, `mutation($id: String!, $input: IssueUpdateInput!) { issueUpdate(id: $id, input: $input) { success } }`,
+		map[string]interface{}{"id": ticketID, "input": input}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update Linear issue %s: %w", ticketID, err)
+	}
+	return nil
+}
+
+// query runs a GraphQL query, decoding its data into out when it is not
+// nil. Its time counts towards the linear stage of the request it is made
+// for.
+func (t *LinearTracker) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	defer logger.StartStage(ctx, "linear")()
+
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return fmt.Errorf("failed to encode query: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.apiURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", t.apiKey)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&result); err != nil {
+		return fmt.Errorf("Linear answered %s with an unreadable body: %w", resp.Status, err)
+	}
+	if len(result.Errors) > 0 {
+		if strings.Contains(strings.ToLower(result.Errors[0].Message), "not found") {
+			return errLinearNotFound
+		}
+		return fmt.Errorf("Linear answered %s: %s", resp.Status, result.Errors[0].Message)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Linear answered %s", resp.Status)
+	}
+	if out != nil {
+		if err := json.Unmarshal(result.Data, out); err != nil {
+			return fmt.Errorf("failed to decode Linear response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStorageService stores uploads on the local filesystem. It is intended
+// for development only: files are served unauthenticated under baseURL.
+type LocalStorageService struct {
+	dir           string
+	baseURL       string
+	presignExpiry time.Duration
+}
+
+// NewLocalStorageService creates a local-disk storage service rooted at dir
+func NewLocalStorageService(dir, baseURL string, presignExpiry time.Duration) (*LocalStorageService, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+	}
+
+	return &LocalStorageService{
+		dir:           dir,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		presignExpiry: normalizePresignExpiry(presignExpiry),
+	}, nil
+}
+
+// Dir returns the root directory files are stored in
+func (s *LocalStorageService) Dir() string {
+	return s.dir
+}
+
+// PresignExpiry returns the nominal URL lifetime. Local URLs never expire.
+func (s *LocalStorageService) PresignExpiry() time.Duration {
+	return s.presignExpiry
+}
+
+// UploadFile writes a file to disk under objectKey and returns its URL. Tags
+// are not supported and are ignored.
+func (s *LocalStorageService) UploadFile(ctx context.Context, file *multipart.FileHeader, objectKey string, tags map[string]string) (_ string, err error) {
+	defer observeUpload(ctx, StorageBackendLocal, file.Size, time.Now(), &err)
+
+	buffer, err := readUpload(file)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.dir, filepath.FromSlash(objectKey))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	if err := os.WriteFile(path, buffer, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write file to local storage: %w", err)
+	}
+
+	return s.PresignGetURL(ctx, objectKey)
+}
+
+// UploadStream writes content read from r to disk under objectKey. Tags are
+// not supported and are ignored.
+func (s *LocalStorageService) UploadStream(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string, tags map[string]string) (err error) {
+	defer observeUpload(ctx, StorageBackendLocal, size, time.Now(), &err)
+
+	path := filepath.Join(s.dir, filepath.FromSlash(objectKey))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create local object %s: %w", objectKey, err)
+	}
+	defer f.Close()
+
+	if _, err := io.CopyN(f, r, size); err != nil {
+		return fmt.Errorf("failed to write file to local storage: %w", err)
+	}
+
+	return nil
+}
+
+// PresignGetURL returns the URL a stored file is served from
+func (s *LocalStorageService) PresignGetURL(ctx context.Context, objectKey string) (string, error) {
+	if _, err := os.Stat(filepath.Join(s.dir, filepath.FromSlash(objectKey))); err != nil {
+		return "", fmt.Errorf("object not found in local storage: %s", objectKey)
+	}
+
+	return fmt.Sprintf("%s/%s", s.baseURL, objectKey), nil
+}
+
+// PresignPutURL is not supported by local storage
+func (s *LocalStorageService) PresignPutURL(ctx context.Context, objectKey, contentType, checksumSHA256 string, tags map[string]string, expires time.Duration) (string, map[string]string, error) {
+	return "", nil, ErrPresignedUploadNotSupported
+}
+
+// TagObject is a no-op for local storage
+func (s *LocalStorageService) TagObject(ctx context.Context, objectKey string, tags map[string]string) error {
+	return nil
+}
+
+// StatObject returns the size and detected content type of a stored file
+func (s *LocalStorageService) StatObject(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(objectKey))
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to stat local object %s: %w", objectKey, err)
+	}
+
+	return &ObjectInfo{
+		Key:          objectKey,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(objectKey)),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// OpenObject opens a stored file for reading
+func (s *LocalStorageService) OpenObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(objectKey)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to open local object %s: %w", objectKey, err)
+	}
+
+	return f, nil
+}
+
+// Ping checks that the storage directory exists
+func (s *LocalStorageService) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to reach local storage: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("local storage path %s is not a directory", s.dir)
+	}
+	return nil
+}
+
+// DeleteObject removes a stored file
+func (s *LocalStorageService) DeleteObject(ctx context.Context, objectKey string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(objectKey)))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete local object %s: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// CopyObject copies a stored file to a new key
+func (s *LocalStorageService) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	content, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(srcKey)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, srcKey)
+		}
+		return fmt.Errorf("failed to read local object %s: %w", srcKey, err)
+	}
+
+	path := filepath.Join(s.dir, filepath.FromSlash(dstKey))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("failed to write local object %s: %w", dstKey, err)
+	}
+
+	return nil
+}
+
+// ListObjects calls fn for every stored file whose key starts with prefix
+func (s *LocalStorageService) ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{
+			Key:          key,
+			Size:         stat.Size(),
+			ContentType:  mime.TypeByExtension(filepath.Ext(key)),
+			LastModified: stat.ModTime(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list local objects under %s: %w", prefix, err)
+	}
+
+	return nil
+}
+
+// ArchiveObject is not supported by local storage
+func (s *LocalStorageService) ArchiveObject(ctx context.Context, objectKey string) error {
+	return ErrArchiveNotSupported
+}
+
+// ObjectKeyFromURL extracts the object key from a URL previously returned by UploadFile
+func (s *LocalStorageService) ObjectKeyFromURL(rawURL string) (string, error) {
+	return objectKeyFromURL(rawURL)
+}
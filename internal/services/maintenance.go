@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Maintenance modes
+const (
+	MaintenanceReject = "reject"
+	MaintenanceQueue  = "queue"
+)
+
+// DefaultMaintenanceMessage is shown to reporters turned away in reject mode
+// when no message was set
+const DefaultMaintenanceMessage = "Reporting is briefly unavailable for maintenance, please try again later."
+
+// maintenanceCollection holds the maintenance state shared by instances
+const maintenanceCollection = "maintenance"
+
+// maintenanceID is the ID of the maintenance state document
+const maintenanceID = "reports"
+
+// maintenanceRefreshInterval is how often instances pick up the state set
+// on another instance, and end maintenance that reached its end
+const maintenanceRefreshInterval = 10 * time.Second
+
+// ErrMaintenanceQueueUnavailable is returned when turning on queue mode
+// without a report queue
+var ErrMaintenanceQueueUnavailable = errors.New("queue mode needs asynchronous report submission to be enabled")
+
+// Maintenance holds whether report submission is in maintenance mode. The
+// state is shared with the other instances through MongoDB when it is
+// configured, and otherwise only applies to this instance. In queue mode the
+// report queue is paused.
+type Maintenance struct {
+	mongoService *MongoDBService
+	queue        *ReportQueue
+	logger       *zap.Logger
+
+	state atomic.Pointer[models.MaintenanceState]
+}
+
+// NewMaintenance creates the maintenance mode of this instance, off until
+// Run loads the shared state. mongoService and queue may be nil.
+func NewMaintenance(mongoService *MongoDBService, queue *ReportQueue, log *zap.Logger) *Maintenance {
+	m := &Maintenance{mongoService: mongoService, queue: queue, logger: log}
+	m.state.Store(&models.MaintenanceState{})
+	return m
+}
+
+// State returns the current maintenance state, off once its end passed
+func (m *Maintenance) State() models.MaintenanceState {
+	state := *m.state.Load()
+	if state.Enabled && state.Until != nil && !time.Now().Before(*state.Until) {
+		return models.MaintenanceState{UpdatedAt: *state.Until}
+	}
+	if state.Enabled && state.Mode == MaintenanceReject && state.Message == "" {
+		state.Message = DefaultMaintenanceMessage
+	}
+	return state
+}
+
+// Set turns maintenance on or off, for all instances when the state is
+// shared. Mode defaults to reject.
+func (m *Maintenance) Set(ctx context.Context, req models.MaintenanceRequest) (models.MaintenanceState, error) {
+	// Truncated like MongoDB stores it, so refreshes see the same state
+	state := models.MaintenanceState{UpdatedAt: time.Now().UTC().Truncate(time.Millisecond)}
+	if *req.Enabled {
+		state.Enabled = true
+		state.Mode = req.Mode
+		if state.Mode == "" {
+			state.Mode = MaintenanceReject
+		}
+		if state.Mode == MaintenanceQueue && m.queue == nil {
+			return models.MaintenanceState{}, ErrMaintenanceQueueUnavailable
+		}
+		state.Message = req.Message
+		state.Until = req.Until
+	}
+
+	if m.mongoService != nil {
+		if err := m.mongoService.SaveMaintenance(ctx, &state); err != nil {
+			return models.MaintenanceState{}, err
+		}
+	}
+	m.apply(&state)
+	return m.State(), nil
+}
+
+// apply makes a state current and pauses the report queue while it is in
+// queue mode
+func (m *Maintenance) apply(state *models.MaintenanceState) {
+	previous := m.state.Swap(state)
+	if previous.Enabled != state.Enabled || previous.Mode != state.Mode || !previous.UpdatedAt.Equal(state.UpdatedAt) {
+		m.logger.Info("Maintenance mode changed", zap.Bool("enabled", state.Enabled), zap.String("mode", state.Mode))
+	}
+	m.pauseQueue()
+}
+
+func (m *Maintenance) pauseQueue() {
+	if m.queue == nil {
+		return
+	}
+	state := m.State()
+	if state.Enabled && state.Mode == MaintenanceQueue {
+		m.queue.Pause()
+	} else {
+		m.queue.Unpause()
+	}
+}
+
+// Run loads the shared state and refreshes it until stopping is closed
+func (m *Maintenance) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(maintenanceRefreshInterval)
+	defer ticker.Stop()
+	for {
+		m.refresh(ctx)
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Maintenance) refresh(ctx context.Context) {
+	if m.mongoService == nil {
+		m.pauseQueue()
+		return
+	}
+	state, err := m.mongoService.GetMaintenance(ctx)
+	if err != nil {
+		// The last known state is kept
+		m.logger.Warn("Failed to load maintenance mode", zap.Error(err))
+		m.pauseQueue()
+		return
+	}
+	m.apply(state)
+}
+
+// SaveMaintenance stores the maintenance state shared by instances
+func (s *MongoDBService) SaveMaintenance(ctx context.Context, state *models.MaintenanceState) error {
+	_, err := s.database.Collection(maintenanceCollection).ReplaceOne(ctx, bson.M{"_id": maintenanceID}, state, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save maintenance mode: %w", err)
+	}
+	return nil
+}
+
+// GetMaintenance retrieves the maintenance state shared by instances, off
+// when it was never set
+func (s *MongoDBService) GetMaintenance(ctx context.Context) (*models.MaintenanceState, error) {
+	var state models.MaintenanceState
+	err := s.database.Collection(maintenanceCollection).FindOne(ctx, bson.M{"_id": maintenanceID}).Decode(&state)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &models.MaintenanceState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maintenance mode: %w", err)
+	}
+	return &state, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// markdownDialect is how a tracker's Markdown differs from others'
+type markdownDialect struct {
+	// limit is the maximum length of a description or comment
+	limit int
+	// collapse renders a collapsed section of JSON
+	collapse func(title, content string) string
+	// image renders an inline screenshot
+	image func(url string) string
+	// quarantineNote is shown in place of a quarantined screenshot and
+	// purgedNote replaces it once the screenshot is purged
+	quarantineNote string
+	purgedNote     string
+}
+
+// markdownLinkTitle escapes the brackets of link titles
+var markdownLinkTitle = strings.NewReplacer("[", `\[`, "]", `\]`)
+
+func (d markdownDialect) heading(level int, title string) string {
+	return strings.Repeat("#", level) + " " + title + "\n"
+}
+
+func (d markdownDialect) item(text string) string {
+	return "- " + text + "\n"
+}
+
+func (d markdownDialect) field(label, value string) string {
+	return fmt.Sprintf("- **%s:** %s\n", label, value)
+}
+
+func (d markdownDialect) link(title, url string) string {
+	return fmt.Sprintf("[%s](%s)", markdownLinkTitle.Replace(title), url)
+}
+
+func (d markdownDialect) codeBlock(lines []string) string {
+	var b strings.Builder
+	b.WriteString("```\n")
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString(d.codeEnd())
+	return b.String()
+}
+
+func (d markdownDialect) inlineCode(text string) string {
+	return "`" + text + "`"
+}
+
+func (d markdownDialect) codeEnd() string {
+	return "```\n"
+}
+
+func (d markdownDialect) note(text string) string {
+	return "_" + text + "_"
+}
+
+func (d markdownDialect) details(title, content string) string {
+	return d.collapse(title, content)
+}
+
+// screenshot renders an inline image for a screenshot URL, or a link for
+// screen recordings
+func (d markdownDialect) screenshot(imageURL, contentType string) string {
+	if IsVideoContentType(contentType) {
+		return fmt.Sprintf("[Watch screen recording](%s)", imageURL)
+	}
+	return d.image(imageURL)
+}
+
+func (d markdownDialect) quarantined() string {
+	return d.quarantineNote
+}
+
+func (d markdownDialect) maxLength() int {
+	return d.limit
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	ticketsCreatedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tickets_created_total",
+			Help: "Total number of Jira tickets created",
+		},
+		[]string{"project"},
+	)
+
+	jiraRequestFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jira_request_failures_total",
+			Help: "Total number of Jira API requests that failed, by HTTP status or error",
+		},
+		[]string{"method", "status"},
+	)
+
+	storageUploadDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "storage_upload_duration_seconds",
+			Help:    "Duration of uploads to object storage",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{"backend", "result"},
+	)
+
+	storageUploadSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "storage_upload_size_bytes",
+			Help:    "Size of objects uploaded to object storage",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 10), // 1KiB to 256MiB
+		},
+		[]string{"backend"},
+	)
+
+	mongoOperationDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mongo_operation_duration_seconds",
+			Help:    "Duration of MongoDB commands",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+		},
+		[]string{"command", "result"},
+	)
+
+	uploadDedupHitsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "upload_dedup_hits_total",
+			Help: "Total number of uploads that reused a stored object with the same content",
+		},
+	)
+
+	reportQueueDepth = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "report_queue_depth",
+			Help: "Number of asynchronously submitted reports waiting for a worker",
+		},
+	)
+
+	reportQueueFailed = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "report_queue_failed",
+			Help: "Number of asynchronously submitted reports that failed and can be retried",
+		},
+	)
+
+	dependencyUp = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dependency_up",
+			Help: "Whether a dependency passed its last readiness check (1) or failed it (0)",
+		},
+		[]string{"dependency"},
+	)
+
+	dependencyCheckDuration = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dependency_check_duration_seconds",
+			Help: "Duration of the last readiness check of a dependency",
+		},
+		[]string{"dependency"},
+	)
+
+	workerPoolSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_pool_size",
+			Help: "Number of workers of the worker pool of a dependency",
+		},
+		[]string{"pool"},
+	)
+
+	workerPoolActive = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_pool_active",
+			Help: "Number of calls to a dependency running in its worker pool",
+		},
+		[]string{"pool"},
+	)
+
+	workerPoolQueued = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_pool_queued",
+			Help: "Number of calls to a dependency waiting for a worker of its pool",
+		},
+		[]string{"pool"},
+	)
+
+	workerPoolWait = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "worker_pool_wait_seconds",
+			Help:    "Time calls to a dependency waited for a worker of its pool",
+			Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"pool"},
+	)
+
+	workerPoolShedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_pool_shed_total",
+			Help: "Total number of calls to a dependency shed because its worker pool was saturated",
+		},
+		[]string{"pool"},
+	)
+
+	leaderGauge = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "leader",
+			Help: "Whether this instance is the leader running scheduled jobs (1) or not (0)",
+		},
+	)
+
+	reportsCoalescedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "reports_coalesced_total",
+			Help: "Total number of reports added to the open ticket of the same failure in high-volume mode",
+		},
+	)
+
+	reportsFloodControlledTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "reports_flood_controlled_total",
+			Help: "Total number of reports added to the latest ticket of a failure reported in a storm",
+		},
+	)
+
+	reportStormsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "report_storms_total",
+			Help: "Total number of report storms detected by flood control",
+		},
+	)
+
+	jiraLastSuccess = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "jira_last_success_timestamp_seconds",
+			Help: "Unix time of the last Jira API request that succeeded, by Jira host",
+		},
+		[]string{"host"},
+	)
+)
+
+// observeUpload records an upload to object storage that started at start
+// once it returned the error *errp; its size is only recorded when it
+// succeeded, and its time counts towards the storage stage of the request ctx
+// serves. It is deferred by the backends' upload methods.
+func observeUpload(ctx context.Context, backend string, size int64, start time.Time, errp *error) {
+	logger.AddStage(ctx, "storage", time.Since(start))
+	result := "ok"
+	if *errp != nil {
+		result = "error"
+	} else if size >= 0 {
+		storageUploadSize.WithLabelValues(backend).Observe(float64(size))
+	}
+	storageUploadDuration.WithLabelValues(backend, result).Observe(time.Since(start).Seconds())
+}
+
+// mongoMonitor records the duration of every MongoDB command, which also
+// counts towards the mongo stage of the request it is run for
+func mongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			logger.AddStage(ctx, "mongo", e.Duration)
+			mongoOperationDuration.WithLabelValues(e.CommandName, "ok").Observe(e.Duration.Seconds())
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			logger.AddStage(ctx, "mongo", e.Duration)
+			mongoOperationDuration.WithLabelValues(e.CommandName, "error").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+// jiraFailure records a failed Jira API request: one that got no response
+// or an error status
+func jiraFailure(method string, statusCode int) {
+	status := "error"
+	if statusCode != 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	jiraRequestFailuresTotal.WithLabelValues(method, status).Inc()
+}
+
+// RecordDependencyCheck records the outcome of a readiness check of a
+// dependency
+func RecordDependencyCheck(dependency string, up bool, latency time.Duration) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	dependencyUp.WithLabelValues(dependency).Set(value)
+	dependencyCheckDuration.WithLabelValues(dependency).Set(latency.Seconds())
+}
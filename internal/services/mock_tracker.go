@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// TrackerMock is the kind of the sandbox tracker keeping tickets in MongoDB,
+// for integration tests
+const TrackerMock = "mock"
+
+// mockTicketsCollection is the collection the tickets of the mock tracker
+// are kept in
+const mockTicketsCollection = "mock_tickets"
+
+// MockTicket is a ticket of the mock tracker, as a Jira ticket would have
+// been filed
+type MockTicket struct {
+	ID          string        `bson:"_id" json:"id"`
+	Title       string        `bson:"title" json:"title"`
+	Description string        `bson:"description" json:"description"`
+	Product     string        `bson:"product,omitempty" json:"product,omitempty"`
+	Reporter    string        `bson:"reporter,omitempty" json:"reporter,omitempty"`
+	PageURL     string        `bson:"page_url,omitempty" json:"pageUrl,omitempty"`
+	ImageURL    string        `bson:"image_url,omitempty" json:"imageUrl,omitempty"`
+	RequestID   string        `bson:"request_id,omitempty" json:"requestId,omitempty"`
+	AssignedTo  string        `bson:"assigned_to,omitempty" json:"assignedTo,omitempty"`
+	Status      string        `bson:"status" json:"status"`
+	Resolution  string        `bson:"resolution,omitempty" json:"resolution,omitempty"`
+	Comments    []MockComment `bson:"comments,omitempty" json:"comments,omitempty"`
+	CreatedAt   time.Time     `bson:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time     `bson:"updated_at" json:"updatedAt"`
+}
+
+// MockComment is a comment on a ticket of the mock tracker
+type MockComment struct {
+	Author string    `bson:"author" json:"author"`
+	Body   string    `bson:"body" json:"body"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// MockTicketFilter selects the tickets of the mock tracker listed
+type MockTicketFilter struct {
+	Product   string
+	Reporter  string
+	RequestID string
+}
+
+// MockTracker is a sandbox issue tracker for integration tests, e.g. of a
+// frontend in CI: tickets are numbered per project key, e.g. MOCK-42, and
+// kept in MongoDB with the description, assignee and comments a Jira ticket
+// would have, so the whole report flow runs without Jira credentials. Like
+// Jira tickets, they are stored in the tickets collection too.
+type MockTracker struct {
+	projectKey   string
+	mongoService *MongoDBService
+	roster       atomic.Pointer[Roster] // replaced when the configuration is reloaded
+	redactor     *Redactor
+	logger       *zap.Logger
+}
+
+// NewMockTracker creates the tracker of tickets numbered under projectKey
+// and kept in MongoDB
+func NewMockTracker(projectKey string, roster *Roster, ms *MongoDBService) *MockTracker {
+	t := &MockTracker{
+		projectKey:   projectKey,
+		mongoService: ms,
+		logger:       zap.NewNop(),
+	}
+	t.SetRoster(roster)
+	return t
+}
+
+// CreateTicket fabricates a ticket for a report, assigned to the support
+// team member on shift, with the description a Jira ticket would have
+func (t *MockTracker) CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error) {
+	// Nothing sensitive is stored
+	req = t.redactor.Ticket(req)
+	log := logger.FromContext(ctx, t.logger).With(zap.String("project", t.projectKey))
+
+	start := time.Now()
+	number, err := t.mongoService.NextTicketNumber(ctx, "ticket:"+t.projectKey)
+	if err != nil {
+		return nil, err
+	}
+	now := start.UTC()
+	description, overflow := ticketDescription(req, logger.RequestID(ctx), now)
+	product, _ := req.Payload["product"].(string)
+	reporter, _ := req.Payload["userEmail"].(string)
+	ticket := &MockTicket{
+		ID:          fmt.Sprintf("%s-%d", t.projectKey, number),
+		Title:       ticketTitle(req),
+		Description: description,
+		Product:     product,
+		Reporter:    reporter,
+		PageURL:     req.URL,
+		RequestID:   logger.RequestID(ctx),
+		AssignedTo:  t.roster.Load().Assignee(ctx, product, now),
+		Status:      "Open",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if hasScreenshotURL(req) {
+		ticket.ImageURL = req.ImageS3URL
+	}
+	if overflow != "" {
+		ticket.Comments = append(ticket.Comments, MockComment{Author: "ronnin", Body: overflow, At: now})
+	}
+	if err := t.mongoService.SaveMockTicket(ctx, ticket); err != nil {
+		return nil, err
+	}
+
+	response := &models.TicketResponse{
+		TicketID:   ticket.ID,
+		Status:     "created",
+		AssignedTo: ticket.AssignedTo,
+	}
+	ticketsCreatedTotal.WithLabelValues(t.projectKey).Inc()
+	log.Info("Filed report in the mock tracker", zap.String("ticket_id", ticket.ID), zap.String("assigned_to", ticket.AssignedTo))
+	saveTicket(ctx, t.mongoService, req, response, time.Since(start), log)
+	return response, nil
+}
+
+// IsTicketOpen reports whether a ticket is unresolved
+func (t *MockTracker) IsTicketOpen(ctx context.Context, ticketID string) (bool, error) {
+	state, err := t.GetTicketState(ctx, ticketID)
+	if err != nil {
+		return false, err
+	}
+	return state.Resolution == "", nil
+}
+
+// GetTicketState returns the state of a ticket
+func (t *MockTracker) GetTicketState(ctx context.Context, ticketID string) (*TicketState, error) {
+	ticket, err := t.mongoService.GetMockTicket(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	return mockState(ticket), nil
+}
+
+// GetTicketStates returns the states of several tickets
+func (t *MockTracker) GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error) {
+	tickets, err := t.mongoService.GetMockTicketsByIDs(ctx, ticketIDs)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]*TicketState, len(tickets))
+	for _, ticket := range tickets {
+		states[ticket.ID] = mockState(&ticket)
+	}
+	return states, nil
+}
+
+func mockState(ticket *MockTicket) *TicketState {
+	return &TicketState{Status: ticket.Status, AssignedTo: ticket.AssignedTo, Resolution: ticket.Resolution}
+}
+
+// AssignTicket stores the new assignee of a ticket
+func (t *MockTracker) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	return t.mongoService.UpdateMockTicket(ctx, ticketID, bson.M{"$set": bson.M{"assigned_to": accountID}})
+}
+
+// AddComment appends a comment to a ticket
+func (t *MockTracker) AddComment(ctx context.Context, ticketID, author, body string) error {
+	comment := MockComment{Author: author, Body: body, At: time.Now().UTC()}
+	return t.mongoService.UpdateMockTicket(ctx, ticketID, bson.M{"$push": bson.M{"comments": comment}})
+}
+
+// ReplaceDescriptionText replaces text in the description of a ticket
+func (t *MockTracker) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	ticket, err := t.mongoService.GetMockTicket(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(ticket.Description, oldText) {
+		return nil
+	}
+	description := strings.ReplaceAll(ticket.Description, oldText, newText)
+	return t.mongoService.UpdateMockTicket(ctx, ticketID, bson.M{"$set": bson.M{"description": description}})
+}
+
+// ReleaseScreenshot links a released screenshot from its ticket
+func (t *MockTracker) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	ticket, err := t.mongoService.GetMockTicket(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	description := strings.ReplaceAll(ticket.Description, QuarantineNote, ScreenshotMarkup(imageURL, contentType))
+	return t.mongoService.UpdateMockTicket(ctx, ticketID, bson.M{"$set": bson.M{"image_url": imageURL, "description": description}})
+}
+
+// RemoveScreenshot notes the removal of a ticket's quarantined screenshot
+func (t *MockTracker) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	ticket, err := t.mongoService.GetMockTicket(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	description := strings.ReplaceAll(ticket.Description, QuarantineNote, purgedNote)
+	return t.mongoService.UpdateMockTicket(ctx, ticketID, bson.M{"$set": bson.M{"description": description}, "$unset": bson.M{"image_url": ""}})
+}
+
+// Ping checks MongoDB, where tickets are kept
+func (t *MockTracker) Ping(ctx context.Context) error {
+	return t.mongoService.Ping(ctx)
+}
+
+// Tickets returns the tickets selected by filter, newest first, from skip
+// up to limit, with the number of tickets selected
+func (t *MockTracker) Tickets(ctx context.Context, filter MockTicketFilter, skip, limit int64) ([]MockTicket, int64, error) {
+	return t.mongoService.GetMockTickets(ctx, filter, skip, limit)
+}
+
+// Kind returns TrackerMock
+func (t *MockTracker) Kind() string {
+	return TrackerMock
+}
+
+// ProjectKey returns the key tickets are numbered under
+func (t *MockTracker) ProjectKey() string {
+	return t.projectKey
+}
+
+// SetRoster replaces the support roster tickets are assigned from
+func (t *MockTracker) SetRoster(roster *Roster) {
+	t.roster.Store(roster)
+}
+
+// SetRedactor sets the redactor applied to new tickets
+func (t *MockTracker) SetRedactor(redactor *Redactor) {
+	t.redactor = redactor
+}
+
+// SetLogger sets the logger tickets are logged to
+func (t *MockTracker) SetLogger(log *zap.Logger) {
+	t.logger = log
+}
+
+// Cleanup does nothing, as the mock tracker holds no connections of its own
+func (t *MockTracker) Cleanup() error {
+	return nil
+}
+
+// SaveMockTicket stores a new ticket of the mock tracker
+func (s *MongoDBService) SaveMockTicket(ctx context.Context, ticket *MockTicket) error {
+	if _, err := s.database.Collection(mockTicketsCollection).InsertOne(ctx, ticket); err != nil {
+		return fmt.Errorf("failed to save mock ticket: %w", err)
+	}
+	return nil
+}
+
+// GetMockTicket retrieves a ticket of the mock tracker by ID
+func (s *MongoDBService) GetMockTicket(ctx context.Context, id string) (*MockTicket, error) {
+	var ticket MockTicket
+	err := s.database.Collection(mockTicketsCollection).FindOne(ctx, bson.M{"_id": id}).Decode(&ticket)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("ticket %s not found", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mock ticket: %w", err)
+	}
+	return &ticket, nil
+}
+
+// GetMockTicketsByIDs retrieves the tickets of the mock tracker with the
+// given IDs; IDs without a ticket are left out
+func (s *MongoDBService) GetMockTicketsByIDs(ctx context.Context, ids []string) ([]MockTicket, error) {
+	cursor, err := s.database.Collection(mockTicketsCollection).Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mock tickets: %w", err)
+	}
+	var tickets []MockTicket
+	if err := cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode mock tickets: %w", err)
+	}
+	return tickets, nil
+}
+
+// GetMockTickets retrieves the tickets of the mock tracker selected by
+// filter, newest first, from skip up to limit, with the number of tickets
+// selected
+func (s *MongoDBService) GetMockTickets(ctx context.Context, filter MockTicketFilter, skip, limit int64) ([]MockTicket, int64, error) {
+	match := bson.M{}
+	if filter.Product != "" {
+		match["product"] = filter.Product
+	}
+	if filter.Reporter != "" {
+		match["reporter"] = filter.Reporter
+	}
+	if filter.RequestID != "" {
+		match["request_id"] = filter.RequestID
+	}
+
+	collection := s.database.Collection(mockTicketsCollection)
+	total, err := collection.CountDocuments(ctx, match)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count mock tickets: %w", err)
+	}
+	cursor, err := collection.Find(ctx, match, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to find mock tickets: %w", err)
+	}
+	var tickets []MockTicket
+	if err := cursor.All(ctx, &tickets); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode mock tickets: %w", err)
+	}
+	return tickets, total, nil
+}
+
+// UpdateMockTicket applies an update to a ticket of the mock tracker
+func (s *MongoDBService) UpdateMockTicket(ctx context.Context, id string, update bson.M) error {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["updated_at"] = time.Now().UTC()
+
+	result, err := s.database.Collection(mockTicketsCollection).UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update mock ticket: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ticket %s not found", id)
+	}
+	return nil
+}
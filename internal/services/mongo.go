@@ -2,9 +2,13 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"sync/atomic"
 	"time"
 
+	"github.com/parvez-capri/ronnin/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -20,6 +24,15 @@ type FlattenedTicket struct {
 	JiraLink   string             `bson:"jira_link"`
 	CreatedAt  time.Time          `bson:"created_at"`
 
+	// ID of the request that reported the issue, for finding its log lines
+	RequestID string `bson:"request_id,omitempty"`
+
+	// Tenant the ticket was reported for; empty for the deployment itself
+	Tenant string `bson:"tenant,omitempty"`
+
+	// Time of the last change to the stored ticket, maintained by every update
+	UpdatedAt time.Time `bson:"updated_at,omitempty"`
+
 	// Issue details
 	Issue       string `bson:"issue"`
 	Description string `bson:"description"`
@@ -29,6 +42,60 @@ type FlattenedTicket struct {
 	PageURL     string `bson:"page_url"`
 	ImageURL    string `bson:"image_url"`
 
+	// Category and severity, given by the reporter or classified, and what
+	// classified them
+	Category     string `bson:"category,omitempty"`
+	Severity     string `bson:"severity,omitempty"`
+	ClassifiedBy string `bson:"classified_by,omitempty"`
+
+	// Browser, operating system and device class of the reporter, parsed
+	// from the User-Agent and client hints
+	Browser        string `bson:"browser,omitempty"`
+	BrowserVersion string `bson:"browser_version,omitempty"`
+	OS             string `bson:"os,omitempty"`
+	OSVersion      string `bson:"os_version,omitempty"`
+	Device         string `bson:"device,omitempty"`
+
+	// Screenshot object details used to re-sign expiring URLs
+	ImageKey          string    `bson:"image_key,omitempty"`
+	ImageURLExpiresAt time.Time `bson:"image_url_expires_at,omitempty"`
+	ImageContentType  string    `bson:"image_content_type,omitempty"`
+
+	// Time Jira took to create the issue, for usage analytics
+	JiraLatencyMS int64 `bson:"jira_latency_ms,omitempty"`
+
+	// Duration and codec of screen recordings
+	Video *models.VideoMetadata `bson:"video,omitempty"`
+
+	// Attachment review state for uploads flagged by the malware scanner
+	AttachmentStatus string `bson:"attachment_status,omitempty"`
+	QuarantineKey    string `bson:"quarantine_key,omitempty"`
+
+	// Set when the retention job archived the ticket
+	ArchivedAt time.Time `bson:"archived_at,omitempty"`
+
+	// Resolution as of the last sync of status and assignee from Jira
+	Resolution string    `bson:"resolution,omitempty"`
+	SyncedAt   time.Time `bson:"synced_at,omitempty"`
+
+	// Manual reassignments, oldest first
+	Reassignments []Reassignment `bson:"reassignments,omitempty"`
+
+	// Customer-facing helpdesk ticket opened for the reporter, and its
+	// status as last synced
+	HelpdeskTicketID string `bson:"helpdesk_ticket_id,omitempty"`
+	HelpdeskLink     string `bson:"helpdesk_link,omitempty"`
+	HelpdeskStatus   string `bson:"helpdesk_status,omitempty"`
+
+	// Ticket of an issue tracker a collected ticket was exported as
+	ExportedTo string `bson:"exported_to,omitempty"`
+
+	// Reports added to the ticket in high-volume mode
+	Occurrences int `bson:"occurrences,omitempty"`
+
+	// Fingerprint of the failure reported, grouping tickets into issues
+	Fingerprint string `bson:"fingerprint,omitempty"`
+
 	// Store JSON strings for complex data
 	FailedNetworkCallsJSON string `bson:"failed_network_calls_json"`
 	PayloadJSON            string `bson:"payload_json"`
@@ -36,40 +103,235 @@ type FlattenedTicket struct {
 	RequestHeadersJSON     string `bson:"request_headers_json"`
 }
 
+// Attachment describes an uploaded file linked to a ticket. Unlike the
+// presigned URLs stored on tickets, attachment records never expire.
+type Attachment struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TicketID       string             `bson:"ticket_id" json:"ticketId"`
+	ObjectKey      string             `bson:"object_key" json:"objectKey"`
+	Filename       string             `bson:"filename,omitempty" json:"filename,omitempty"`
+	Size           int64              `bson:"size" json:"size"`
+	ContentType    string             `bson:"content_type,omitempty" json:"contentType,omitempty"`
+	ChecksumSHA256 string             `bson:"checksum_sha256,omitempty" json:"checksumSha256,omitempty"`
+	Uploader       string             `bson:"uploader,omitempty" json:"uploader,omitempty"`
+	Status         string             `bson:"status,omitempty" json:"status,omitempty"`
+	Tenant         string             `bson:"tenant,omitempty" json:"tenant,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"createdAt"`
+}
+
+// Reassignment records a manual change of a ticket's assignee
+type Reassignment struct {
+	From     string    `bson:"from"`
+	To       string    `bson:"to"`
+	Reason   string    `bson:"reason,omitempty"`
+	ClientIP string    `bson:"client_ip,omitempty"`
+	At       time.Time `bson:"at"`
+}
+
+// ticketUpdatedAt sets updated_at to the server time in ticket updates
+var ticketUpdatedAt = bson.M{"updated_at": true}
+
+// attachmentsCollection is the collection attachment metadata is stored in
+const attachmentsCollection = "attachments"
+
+// ErrTicketNotFound is returned for tickets not stored for the tenant
+// looked up
+var ErrTicketNotFound = errors.New("ticket not found")
+
+// ErrAttachmentNotFound is returned for unknown attachments
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// apiKeysCollection is the collection API keys created through the admin
+// API are stored in
+const apiKeysCollection = "api_keys"
+
+// auditCollection is the collection the audit log of mutating API requests
+// is stored in
+const auditCollection = "audit_log"
+
 // MongoDBService handles database operations
 type MongoDBService struct {
-	client     *mongo.Client
-	database   *mongo.Database
-	collection *mongo.Collection
+	client      *mongo.Client
+	database    *mongo.Database
+	collection  *mongo.Collection
+	attachments *mongo.Collection
+	apiKeys     *mongo.Collection
+	audit       *mongo.Collection
+
+	reportFailures  *mongo.Collection
+	webhookFailures *mongo.Collection
+	reportStatuses  *mongo.Collection
+	failedReports   *mongo.Collection
+
+	// prepared is set once the indexes are created; prepareErr is why the
+	// last attempt failed
+	prepared   atomic.Bool
+	prepareErr atomic.Pointer[error]
 }
 
-// NewMongoDBService creates a new MongoDB service
+// NewMongoDBService connects to MongoDB and prepares the database, failing
+// when the server cannot be reached
 func NewMongoDBService(uri, dbName, collectionName string) (*MongoDBService, error) {
+	s, err := ConnectMongoDB(uri, dbName, collectionName, 0)
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	if err := s.Prepare(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
 
+// ConnectMongoDB creates the MongoDB service without reaching the server,
+// which the driver connects to in the background; it only fails on an
+// invalid URI. The database is usable once Prepare succeeds. Operations
+// whose context has no deadline are bounded to timeout, unless it is 0.
+func ConnectMongoDB(uri, dbName, collectionName string, timeout time.Duration) (*MongoDBService, error) {
 	// Connect to MongoDB
-	clientOptions := options.Client().ApplyURI(uri)
-	client, err := mongo.Connect(ctx, clientOptions)
+	clientOptions := options.Client().ApplyURI(uri).SetMonitor(mongoMonitor())
+	if timeout > 0 {
+		clientOptions.SetTimeout(timeout)
+	}
+	client, err := mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
 
+	database := client.Database(dbName)
+	return &MongoDBService{
+		client:      client,
+		database:    database,
+		collection:  database.Collection(collectionName),
+		attachments: database.Collection(attachmentsCollection),
+		apiKeys:     database.Collection(apiKeysCollection),
+		audit:       database.Collection(auditCollection),
+
+		reportFailures:  database.Collection(reportFailuresCollection),
+		webhookFailures: database.Collection(webhookFailuresCollection),
+		reportStatuses:  database.Collection(reportStatusesCollection),
+		failedReports:   database.Collection(failedReportsCollection),
+	}, nil
+}
+
+// Prepare pings MongoDB and creates the indexes of the service. Until it
+// succeeds, Ping reports the service as not ready.
+func (s *MongoDBService) Prepare(ctx context.Context) error {
 	// Ping the MongoDB server to verify connection
-	err = client.Ping(ctx, nil)
+	if err := s.client.Ping(ctx, nil); err != nil {
+		s.prepareErr.Store(&err)
+		return fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+	if err := s.createIndexes(ctx); err != nil {
+		s.prepareErr.Store(&err)
+		return err
+	}
+	s.prepared.Store(true)
+	return nil
+}
+
+// Prepared reports whether Prepare succeeded
+func (s *MongoDBService) Prepared() bool {
+	return s.prepared.Load()
+}
+
+func (s *MongoDBService) createIndexes(ctx context.Context) error {
+	// Helpdesk webhooks find tickets by their helpdesk ticket, which only
+	// some tickets have
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "helpdesk_ticket_id", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+		return fmt.Errorf("failed to create helpdesk ticket index: %w", err)
 	}
 
-	// Get database and collection
-	database := client.Database(dbName)
-	collection := database.Collection(collectionName)
+	// Attachments are always listed per ticket
+	_, err = s.attachments.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "ticket_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create attachments index: %w", err)
+	}
+	_, err = s.attachments.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "checksum_sha256", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create attachments checksum index: %w", err)
+	}
 
-	return &MongoDBService{
-		client:     client,
-		database:   database,
-		collection: collection,
-	}, nil
+	// API keys are looked up by the hash of the key on every request
+	_, err = s.apiKeys.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create API keys index: %w", err)
+	}
+
+	// The audit log is searched by actor and resource, newest first
+	_, err = s.audit.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "resource_id", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create audit log indexes: %w", err)
+	}
+
+	// Report failures are counted per time window for usage analytics
+	_, err = s.reportFailures.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "at", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create report failures index: %w", err)
+	}
+
+	// Failed webhook deliveries are listed newest first
+	_, err = s.webhookFailures.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "failed_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook failures index: %w", err)
+	}
+
+	// Failed reports are listed newest first
+	_, err = s.failedReports.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "failed_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create failed reports index: %w", err)
+	}
+
+	// Shared report statuses are removed once they expire
+	_, err = s.reportStatuses.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create report statuses index: %w", err)
+	}
+
+	// Coalesced reports are listed per ticket and grouped into issues by
+	// fingerprint
+	_, err = s.database.Collection(occurrencesCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "ticket_id", Value: 1}, {Key: "at", Value: 1}}},
+		{Keys: bson.D{{Key: "fingerprint", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create report occurrences indexes: %w", err)
+	}
+
+	// Tickets are grouped into issues by fingerprint
+	_, err = s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "fingerprint", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetSparse(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create ticket fingerprint index: %w", err)
+	}
+
+	return nil
 }
 
 // SaveTicket saves a ticket to MongoDB
@@ -78,6 +340,9 @@ func (s *MongoDBService) SaveTicket(ctx context.Context, ticket *FlattenedTicket
 	if ticket.CreatedAt.IsZero() {
 		ticket.CreatedAt = time.Now()
 	}
+	if ticket.UpdatedAt.IsZero() {
+		ticket.UpdatedAt = ticket.CreatedAt
+	}
 
 	// Insert the ticket
 	result, err := s.collection.InsertOne(ctx, ticket)
@@ -93,15 +358,16 @@ func (s *MongoDBService) SaveTicket(ctx context.Context, ticket *FlattenedTicket
 	return "", fmt.Errorf("failed to get inserted ID")
 }
 
-// GetTicketByJiraID retrieves a ticket by its Jira ID
+// GetTicketByJiraID retrieves a ticket of the tenant carried by ctx by its
+// Jira ID
 func (s *MongoDBService) GetTicketByJiraID(ctx context.Context, jiraID string) (*FlattenedTicket, error) {
 	var ticket FlattenedTicket
 
-	filter := bson.M{"ticket_id": jiraID}
+	filter := bson.M{"ticket_id": jiraID, "tenant": tenantFilter(TenantID(ctx))}
 	err := s.collection.FindOne(ctx, filter).Decode(&ticket)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("ticket not found: %s", jiraID)
+			return nil, fmt.Errorf("%w: %s", ErrTicketNotFound, jiraID)
 		}
 		return nil, fmt.Errorf("failed to get ticket: %w", err)
 	}
@@ -109,11 +375,53 @@ func (s *MongoDBService) GetTicketByJiraID(ctx context.Context, jiraID string) (
 	return &ticket, nil
 }
 
-// GetAllTickets retrieves all tickets
-func (s *MongoDBService) GetAllTickets(ctx context.Context) ([]FlattenedTicket, error) {
+// GetTicketByHelpdeskID retrieves the ticket a helpdesk ticket was opened for
+func (s *MongoDBService) GetTicketByHelpdeskID(ctx context.Context, helpdeskID string) (*FlattenedTicket, error) {
+	var ticket FlattenedTicket
+	err := s.collection.FindOne(ctx, bson.M{"helpdesk_ticket_id": helpdeskID}).Decode(&ticket)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("ticket not found for helpdesk ticket %s", helpdeskID)
+		}
+		return nil, fmt.Errorf("failed to get ticket: %w", err)
+	}
+
+	return &ticket, nil
+}
+
+// TicketFilter selects the tickets in a scope, narrowed down by the
+// environment of their reporter. Browser, OS and device match regardless of
+// case, and versions match their prefix up to a dot, so 17 matches 17.4.1.
+type TicketFilter struct {
+	Scope          TicketScope
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	Device         string
+}
+
+// filter returns the MongoDB filter of the selected tickets
+func (f TicketFilter) filter() bson.M {
+	filter := f.Scope.filter()
+	for field, value := range map[string]string{"browser": f.Browser, "os": f.OS, "device": f.Device} {
+		if value != "" {
+			filter[field] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(value) + "$", Options: "i"}
+		}
+	}
+	for field, version := range map[string]string{"browser_version": f.BrowserVersion, "os_version": f.OSVersion} {
+		if version != "" {
+			filter[field] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(version) + `(\.|$)`}
+		}
+	}
+	return filter
+}
+
+// GetAllTickets retrieves the tickets the filter selects
+func (s *MongoDBService) GetAllTickets(ctx context.Context, filter TicketFilter) ([]FlattenedTicket, error) {
 	var tickets []FlattenedTicket
 
-	cursor, err := s.collection.Find(ctx, bson.M{})
+	cursor, err := s.collection.Find(ctx, filter.filter())
 	if err != nil {
 		return nil, fmt.Errorf("failed to find tickets: %w", err)
 	}
@@ -126,6 +434,714 @@ func (s *MongoDBService) GetAllTickets(ctx context.Context) ([]FlattenedTicket,
 	return tickets, nil
 }
 
+// StreamTickets calls fn for every ticket the filter selects without
+// loading all of them into memory
+func (s *MongoDBService) StreamTickets(ctx context.Context, filter TicketFilter, fn func(*FlattenedTicket) error) error {
+	cursor, err := s.collection.Find(ctx, filter.filter())
+	if err != nil {
+		return fmt.Errorf("failed to find tickets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var ticket FlattenedTicket
+		if err := cursor.Decode(&ticket); err != nil {
+			return fmt.Errorf("failed to decode ticket: %w", err)
+		}
+		if err := fn(&ticket); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// GetTicketsPage retrieves up to limit unarchived tickets in insertion order,
+// starting after the ticket with the given document ID
+func (s *MongoDBService) GetTicketsPage(ctx context.Context, after primitive.ObjectID, limit int64) ([]FlattenedTicket, error) {
+	var tickets []FlattenedTicket
+
+	filter := bson.M{"archived_at": bson.M{"$exists": false}}
+	if !after.IsZero() {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit)
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tickets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// GetTicketsNewestFirst retrieves up to limit tickets the filter selects, most
+// recently created first. A non-zero before continues after the ticket with
+// that document ID; otherwise the first skip tickets are skipped.
+func (s *MongoDBService) GetTicketsNewestFirst(ctx context.Context, selected TicketFilter, before primitive.ObjectID, skip, limit int64) ([]FlattenedTicket, error) {
+	var tickets []FlattenedTicket
+
+	filter := selected.filter()
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	} else if skip > 0 {
+		opts.SetSkip(skip)
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tickets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// CountTickets returns the number of stored tickets the filter selects
+func (s *MongoDBService) CountTickets(ctx context.Context, filter TicketFilter) (int64, error) {
+	count, err := s.collection.CountDocuments(ctx, filter.filter())
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tickets: %w", err)
+	}
+	return count, nil
+}
+
+// GetTicketsWithExpiringImages retrieves tickets whose screenshot URL expires before the given time
+func (s *MongoDBService) GetTicketsWithExpiringImages(ctx context.Context, before time.Time) ([]FlattenedTicket, error) {
+	var tickets []FlattenedTicket
+
+	cursor, err := s.collection.Find(ctx, expiringImagesFilter(before))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tickets with expiring images: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// CountTicketsWithExpiringImages counts tickets whose screenshot URL expires before the given time
+func (s *MongoDBService) CountTicketsWithExpiringImages(ctx context.Context, before time.Time) (int64, error) {
+	count, err := s.collection.CountDocuments(ctx, expiringImagesFilter(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tickets with expiring images: %w", err)
+	}
+	return count, nil
+}
+
+// expiringImagesFilter matches tickets whose screenshot URL expires before
+// the given time. Tickets stored before expiry tracking have no expiry and
+// are always due.
+func expiringImagesFilter(before time.Time) bson.M {
+	return bson.M{
+		"image_url": bson.M{"$ne": ""},
+		"$or": bson.A{
+			bson.M{"image_url_expires_at": bson.M{"$lt": before}},
+			bson.M{"image_url_expires_at": bson.M{"$exists": false}},
+		},
+	}
+}
+
+// UpdateTicketImageURL stores a freshly signed screenshot URL for a ticket
+func (s *MongoDBService) UpdateTicketImageURL(ctx context.Context, jiraID, imageKey, imageURL string, expiresAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"image_key":            imageKey,
+			"image_url":            imageURL,
+			"image_url_expires_at": expiresAt,
+		},
+		"$currentDate": ticketUpdatedAt,
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"ticket_id": jiraID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update ticket image URL: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ticket not found: %s", jiraID)
+	}
+
+	return nil
+}
+
+// GetTicketsByAttachmentStatus retrieves tickets whose attachment is in the given review state
+func (s *MongoDBService) GetTicketsByAttachmentStatus(ctx context.Context, status string) ([]FlattenedTicket, error) {
+	var tickets []FlattenedTicket
+
+	cursor, err := s.collection.Find(ctx, bson.M{"attachment_status": status})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tickets by attachment status: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// CountTicketsByAttachmentStatus counts tickets whose attachment is in the given review state
+func (s *MongoDBService) CountTicketsByAttachmentStatus(ctx context.Context, status string) (int64, error) {
+	count, err := s.collection.CountDocuments(ctx, bson.M{"attachment_status": status})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tickets by attachment status: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateTicketAttachmentStatus stores the review state of a ticket's attachment
+func (s *MongoDBService) UpdateTicketAttachmentStatus(ctx context.Context, jiraID, status, quarantineKey string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"attachment_status": status,
+			"quarantine_key":    quarantineKey,
+		},
+		"$currentDate": ticketUpdatedAt,
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"ticket_id": jiraID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update ticket attachment status: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ticket not found: %s", jiraID)
+	}
+
+	return nil
+}
+
+// SaveAttachment stores the metadata of an uploaded file
+func (s *MongoDBService) SaveAttachment(ctx context.Context, attachment *Attachment) (string, error) {
+	if attachment.CreatedAt.IsZero() {
+		attachment.CreatedAt = time.Now()
+	}
+	if attachment.Tenant == "" {
+		attachment.Tenant = TenantID(ctx)
+	}
+
+	result, err := s.attachments.InsertOne(ctx, attachment)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert attachment: %w", err)
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		attachment.ID = id
+		return id.Hex(), nil
+	}
+
+	return "", fmt.Errorf("failed to get inserted ID")
+}
+
+// GetAttachmentsByTicketID retrieves the attachments of a ticket of the
+// tenant carried by ctx, oldest first
+func (s *MongoDBService) GetAttachmentsByTicketID(ctx context.Context, jiraID string) ([]Attachment, error) {
+	attachments := []Attachment{}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	filter := bson.M{"ticket_id": jiraID, "tenant": tenantFilter(TenantID(ctx))}
+	cursor, err := s.attachments.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find attachments: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &attachments); err != nil {
+		return nil, fmt.Errorf("failed to decode attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// GetAttachment retrieves an attachment by ID. Callers acting for a tenant
+// only find the attachments of their tenant; IDs are unique, so callers
+// acting for the deployment find those of every tenant.
+func (s *MongoDBService) GetAttachment(ctx context.Context, id string) (*Attachment, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrAttachmentNotFound
+	}
+	filter := bson.M{"_id": objectID}
+	if tenant := TenantID(ctx); tenant != "" {
+		filter["tenant"] = tenant
+	}
+	var attachment Attachment
+	if err := s.attachments.FindOne(ctx, filter).Decode(&attachment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return &attachment, nil
+}
+
+// FindAttachmentByChecksum returns the most recent attachment of the tenant
+// carried by ctx with the given content checksum that is not pending review
+// or purged, or nil if none exists
+func (s *MongoDBService) FindAttachmentByChecksum(ctx context.Context, checksum string) (*Attachment, error) {
+	var attachment Attachment
+
+	filter := bson.M{
+		"checksum_sha256": checksum,
+		"status":          bson.M{"$nin": bson.A{AttachmentStatusQuarantined, AttachmentStatusPurged, AttachmentStatusArchived}},
+		// Objects are only shared within a tenant, whose bucket they are in
+		"tenant": tenantFilter(TenantID(ctx)),
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	err := s.attachments.FindOne(ctx, filter, opts).Decode(&attachment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find attachment by checksum: %w", err)
+	}
+
+	return &attachment, nil
+}
+
+// UpdateAttachmentObject records that an attachment moved to a new object key
+// or review state
+func (s *MongoDBService) UpdateAttachmentObject(ctx context.Context, jiraID, oldKey, newKey, status string) error {
+	update := bson.M{"$set": bson.M{
+		"object_key": newKey,
+		"status":     status,
+	}}
+
+	_, err := s.attachments.UpdateOne(ctx, bson.M{"ticket_id": jiraID, "object_key": oldKey}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update attachment: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateAttachmentsStatus sets the state of all attachments of a ticket
+func (s *MongoDBService) UpdateAttachmentsStatus(ctx context.Context, jiraID, status string) error {
+	_, err := s.attachments.UpdateMany(ctx, bson.M{"ticket_id": jiraID}, bson.M{"$set": bson.M{"status": status}})
+	if err != nil {
+		return fmt.Errorf("failed to update attachments status: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAttachmentsByTicketID removes the attachment metadata of a ticket
+func (s *MongoDBService) DeleteAttachmentsByTicketID(ctx context.Context, jiraID string) error {
+	if _, err := s.attachments.DeleteMany(ctx, bson.M{"ticket_id": jiraID}); err != nil {
+		return fmt.Errorf("failed to delete attachments: %w", err)
+	}
+
+	return nil
+}
+
+// GetTicketsCreatedBefore retrieves the tickets created before the given time
+// that have not been archived
+func (s *MongoDBService) GetTicketsCreatedBefore(ctx context.Context, before time.Time) ([]FlattenedTicket, error) {
+	var tickets []FlattenedTicket
+
+	filter := bson.M{
+		"created_at":  bson.M{"$lt": before},
+		"archived_at": bson.M{"$exists": false},
+	}
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tickets created before %s: %w", before.Format(time.RFC3339), err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// GetRecentOpenTickets retrieves the most recent unresolved, unarchived
+// tickets of a product created since a time, all products' when product is
+// empty, with only their ID, issue, description, status and creation time
+func (s *MongoDBService) GetRecentOpenTickets(ctx context.Context, product string, since time.Time, limit int64) ([]FlattenedTicket, error) {
+	var tickets []FlattenedTicket
+
+	filter := bson.M{
+		"created_at":  bson.M{"$gte": since},
+		"archived_at": bson.M{"$exists": false},
+		"resolution":  bson.M{"$in": bson.A{nil, ""}},
+	}
+	if product != "" {
+		filter["product"] = product
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"ticket_id": 1, "issue": 1, "description": 1, "status": 1, "created_at": 1})
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find recent tickets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// GetTicketsByReporter retrieves the most recent tickets reported with the
+// given email address, matched case-insensitively
+func (s *MongoDBService) GetTicketsByReporter(ctx context.Context, email string, limit int64) ([]FlattenedTicket, error) {
+	var tickets []FlattenedTicket
+
+	filter := bson.M{
+		"user_email": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(email) + "$", Options: "i"},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tickets of reporter: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &tickets); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// ArchiveTicket marks a ticket as archived and clears its screenshot URL
+func (s *MongoDBService) ArchiveTicket(ctx context.Context, jiraID string, archivedAt time.Time) error {
+	update := bson.M{
+		"$set":         bson.M{"archived_at": archivedAt, "image_url": ""},
+		"$unset":       bson.M{"image_url_expires_at": ""},
+		"$currentDate": ticketUpdatedAt,
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"ticket_id": jiraID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to archive ticket: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ticket not found: %s", jiraID)
+	}
+
+	return nil
+}
+
+// UpdateTicketState stores the workflow state of a ticket as synced from Jira
+func (s *MongoDBService) UpdateTicketState(ctx context.Context, jiraID string, state *TicketState, syncedAt time.Time) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"ticket_id": jiraID},
+		bson.M{
+			"$set": bson.M{
+				"status":      state.Status,
+				"assigned_to": state.AssignedTo,
+				"resolution":  state.Resolution,
+				"synced_at":   syncedAt,
+			},
+			"$currentDate": ticketUpdatedAt,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update ticket state: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ticket not found: %s", jiraID)
+	}
+
+	return nil
+}
+
+// UpdateTicketHelpdesk stores the helpdesk ticket of a ticket and its
+// status. An empty helpdeskID or link leaves the stored one unchanged.
+func (s *MongoDBService) UpdateTicketHelpdesk(ctx context.Context, jiraID, helpdeskID, link, status string) error {
+	set := bson.M{"helpdesk_status": status}
+	if helpdeskID != "" {
+		set["helpdesk_ticket_id"] = helpdeskID
+	}
+	if link != "" {
+		set["helpdesk_link"] = link
+	}
+
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"ticket_id": jiraID},
+		bson.M{"$set": set, "$currentDate": ticketUpdatedAt},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update ticket helpdesk: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ticket not found: %s", jiraID)
+	}
+
+	return nil
+}
+
+// ReassignTicket stores the new assignee of a ticket and appends the change
+// to its reassignment history
+func (s *MongoDBService) ReassignTicket(ctx context.Context, jiraID string, change Reassignment) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"ticket_id": jiraID},
+		bson.M{
+			"$set":         bson.M{"assigned_to": change.To},
+			"$push":        bson.M{"reassignments": change},
+			"$currentDate": ticketUpdatedAt,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reassign ticket: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ticket not found: %s", jiraID)
+	}
+
+	return nil
+}
+
+// DeleteTicket removes a ticket
+func (s *MongoDBService) DeleteTicket(ctx context.Context, jiraID string) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"ticket_id": jiraID})
+	if err != nil {
+		return fmt.Errorf("failed to delete ticket: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("ticket not found: %s", jiraID)
+	}
+
+	return nil
+}
+
+// IsObjectReferenced reports whether an object is used by a ticket other than
+// excludeTicketID that has not been archived. Deduplicated uploads share one
+// object between tickets.
+func (s *MongoDBService) IsObjectReferenced(ctx context.Context, objectKey, excludeTicketID string) (bool, error) {
+	ticketFilter := bson.M{
+		"ticket_id":   bson.M{"$ne": excludeTicketID},
+		"archived_at": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"image_key": objectKey},
+			bson.M{"quarantine_key": objectKey},
+		},
+	}
+	count, err := s.collection.CountDocuments(ctx, ticketFilter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to count tickets referencing %s: %w", objectKey, err)
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	attachmentFilter := bson.M{
+		"ticket_id":  bson.M{"$ne": excludeTicketID},
+		"object_key": objectKey,
+		"status":     bson.M{"$ne": AttachmentStatusArchived},
+	}
+	count, err = s.attachments.CountDocuments(ctx, attachmentFilter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to count attachments referencing %s: %w", objectKey, err)
+	}
+
+	return count > 0, nil
+}
+
+// ReferencedObjectKeys returns every object key referenced by a ticket or
+// attachment, including archived ones, along with the screenshot URLs of
+// tickets stored before object keys were persisted
+func (s *MongoDBService) ReferencedObjectKeys(ctx context.Context) (keys map[string]struct{}, legacyURLs []string, err error) {
+	keys = make(map[string]struct{})
+	add := func(values []interface{}) {
+		for _, v := range values {
+			if key, ok := v.(string); ok && key != "" {
+				keys[key] = struct{}{}
+			}
+		}
+	}
+
+	for _, field := range []string{"image_key", "quarantine_key"} {
+		values, err := s.collection.Distinct(ctx, field, bson.M{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list ticket %s values: %w", field, err)
+		}
+		add(values)
+	}
+
+	values, err := s.attachments.Distinct(ctx, "object_key", bson.M{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list attachment object keys: %w", err)
+	}
+	add(values)
+
+	legacy, err := s.collection.Distinct(ctx, "image_url", bson.M{
+		"image_url": bson.M{"$ne": ""},
+		"image_key": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list legacy screenshot URLs: %w", err)
+	}
+	for _, v := range legacy {
+		if u, ok := v.(string); ok {
+			legacyURLs = append(legacyURLs, u)
+		}
+	}
+
+	return keys, legacyURLs, nil
+}
+
+// SaveAPIKey stores a new API key
+func (s *MongoDBService) SaveAPIKey(ctx context.Context, key *APIKey) error {
+	if _, err := s.apiKeys.InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeyByHash returns the unrevoked API key with the given hash, or nil
+// if none exists
+func (s *MongoDBService) GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	var key APIKey
+
+	filter := bson.M{"hash": hash, "revoked_at": bson.M{"$exists": false}}
+	err := s.apiKeys.FindOne(ctx, filter).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// GetAPIKeys retrieves all stored API keys, revoked ones included, newest
+// first
+func (s *MongoDBService) GetAPIKeys(ctx context.Context) ([]APIKey, error) {
+	keys := []APIKey{}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := s.apiKeys.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find API keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks an API key as revoked; revoked keys are kept so their
+// use can still be traced
+func (s *MongoDBService) RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error {
+	filter := bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}}
+	result, err := s.apiKeys.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": revokedAt}})
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("API key %s not found", id)
+	}
+
+	return nil
+}
+
+// SaveAuditEntry appends an entry to the audit log
+func (s *MongoDBService) SaveAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	if _, err := s.audit.InsertOne(ctx, entry); err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEntries retrieves up to limit audit entries matching filter,
+// newest first. A non-zero before continues after the entry with that ID;
+// otherwise the first skip entries are skipped.
+func (s *MongoDBService) GetAuditEntries(ctx context.Context, filter AuditFilter, before primitive.ObjectID, skip, limit int64) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+
+	query := auditQuery(filter)
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+	if !before.IsZero() {
+		query["_id"] = bson.M{"$lt": before}
+	} else if skip > 0 {
+		opts.SetSkip(skip)
+	}
+
+	cursor, err := s.audit.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find audit entries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// CountAuditEntries returns the number of audit entries matching filter
+func (s *MongoDBService) CountAuditEntries(ctx context.Context, filter AuditFilter) (int64, error) {
+	count, err := s.audit.CountDocuments(ctx, auditQuery(filter))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+	return count, nil
+}
+
+// auditQuery matches the audit entries selected by filter
+func auditQuery(filter AuditFilter) bson.M {
+	query := bson.M{}
+	if filter.Actor != "" {
+		query["actor"] = filter.Actor
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.ResourceID != "" {
+		query["resource_id"] = filter.ResourceID
+	}
+	at := bson.M{}
+	if !filter.Since.IsZero() {
+		at["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		at["$lt"] = filter.Until
+	}
+	if len(at) > 0 {
+		query["at"] = at
+	}
+	return query
+}
+
+// Ping checks that the MongoDB server can be reached
+func (s *MongoDBService) Ping(ctx context.Context) error {
+	if !s.prepared.Load() {
+		if err := s.prepareErr.Load(); err != nil {
+			return fmt.Errorf("MongoDB is not initialized: %w", *err)
+		}
+		return fmt.Errorf("MongoDB is not initialized")
+	}
+	if err := s.client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+	return nil
+}
+
 // Disconnect closes the MongoDB connection
 func (s *MongoDBService) Disconnect(ctx context.Context) error {
 	return s.client.Disconnect(ctx)
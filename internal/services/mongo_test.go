@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestTicketLookupsAreScopedToTenant(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	// Both tenants file SUP-1 in trackers of their own
+	tenants := []struct {
+		name   string
+		tenant string
+		want   interface{}
+	}{
+		{"lending", "lending", "lending"},
+		{"payments", "payments", "payments"},
+		{"deployment", "", bson.M{"$exists": false}},
+	}
+	for _, tt := range tenants {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := &MongoDBService{collection: mt.Coll, attachments: mt.Coll}
+			ctx := WithTenant(context.Background(), tt.tenant)
+			ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				bson.D{{Key: "ticket_id", Value: "SUP-1"}, {Key: "tenant", Value: tt.tenant}}))
+			ticket, err := s.GetTicketByJiraID(ctx, "SUP-1")
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if ticket.Tenant != tt.tenant {
+				mt.Errorf("ticket of tenant %q, want %q", ticket.Tenant, tt.tenant)
+			}
+			checkTenantFilter(mt, tt.want)
+
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+			if _, err := s.GetAttachmentsByTicketID(ctx, "SUP-1"); err != nil {
+				mt.Fatal(err)
+			}
+			checkTenantFilter(mt, tt.want)
+
+			// Tickets of other tenants are not found
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch))
+			if _, err := s.GetTicketByJiraID(ctx, "SUP-1"); !errors.Is(err, ErrTicketNotFound) {
+				mt.Errorf("missing ticket = %v, want ErrTicketNotFound", err)
+			}
+		})
+	}
+}
+
+// checkTenantFilter checks the tenant the last find command filtered by
+func checkTenantFilter(mt *mtest.T, want interface{}) {
+	mt.Helper()
+	event := mt.GetStartedEvent()
+	if event == nil || event.CommandName != "find" {
+		mt.Fatalf("started event = %v, want a find", event)
+	}
+	var command struct {
+		Filter bson.M `bson:"filter"`
+	}
+	if err := bson.Unmarshal(event.Command, &command); err != nil {
+		mt.Fatal(err)
+	}
+	got, err := bson.Marshal(bson.M{"tenant": command.Filter["tenant"]})
+	if err != nil {
+		mt.Fatal(err)
+	}
+	expected, _ := bson.Marshal(bson.M{"tenant": want})
+	if !bytes.Equal(got, expected) {
+		mt.Errorf("filter %v, want tenant %v", command.Filter, want)
+	}
+}
+
+func TestGetAttachmentIsScopedToTenant(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("tenant", func(mt *mtest.T) {
+		s := &MongoDBService{attachments: mt.Coll}
+		ctx := WithTenant(context.Background(), "lending")
+		id := primitive.NewObjectID()
+
+		// Attachments of other tenants are not found
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.Coll.Database().Name()+"."+mt.Coll.Name(), mtest.FirstBatch))
+		if _, err := s.GetAttachment(ctx, id.Hex()); !errors.Is(err, ErrAttachmentNotFound) {
+			mt.Errorf("attachment of another tenant = %v, want ErrAttachmentNotFound", err)
+		}
+		checkTenantFilter(mt, "lending")
+	})
+
+	mt.Run("deployment", func(mt *mtest.T) {
+		s := &MongoDBService{attachments: mt.Coll}
+		id := primitive.NewObjectID()
+
+		// Callers acting for the deployment find the attachments of every tenant
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.Coll.Database().Name()+"."+mt.Coll.Name(), mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: id}, {Key: "tenant", Value: "payments"}}))
+		attachment, err := s.GetAttachment(context.Background(), id.Hex())
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if attachment.Tenant != "payments" {
+			mt.Errorf("attachment of tenant %q, want payments", attachment.Tenant)
+		}
+		checkTenantFilter(mt, nil)
+	})
+}
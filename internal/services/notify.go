@@ -0,0 +1,238 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.uber.org/zap"
+)
+
+// Notification providers
+const (
+	NotifierTeams      = "teams"
+	NotifierGoogleChat = "googlechat"
+)
+
+// Severities reporters can give their reports
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+)
+
+// notificationQueueSize bounds the notifications waiting to be sent; further
+// notifications are dropped rather than holding up reports
+const notificationQueueSize = 100
+
+// notificationTimeout bounds sending one notification to one route
+const notificationTimeout = 10 * time.Second
+
+// Notification announces a ticket created from a report. Tickets of a tenant
+// are only announced in the chats of the tenant.
+type Notification struct {
+	Tenant   string
+	TicketID string
+	JiraLink string
+	Summary  string
+	Product  string
+	Severity string
+	Assignee string
+	Reporter string
+}
+
+// Notifier sends notifications to a chat or messaging service
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NotificationRoute sends the notifications of some products and severities
+// to a notifier. Empty products or severities match every report.
+type NotificationRoute struct {
+	Name       string
+	Notifier   Notifier
+	Products   []string
+	Severities []string
+}
+
+// matches reports whether the route wants a notification. Products are
+// matched case-insensitively.
+func (r NotificationRoute) matches(n Notification) bool {
+	if len(r.Products) > 0 && !slices.ContainsFunc(r.Products, func(p string) bool { return strings.EqualFold(p, n.Product) }) {
+		return false
+	}
+	return len(r.Severities) == 0 || slices.Contains(r.Severities, n.Severity)
+}
+
+// Notifications sends notifications of new tickets to the routes that match
+// them. Notifications are sent in the background by Run.
+type Notifications struct {
+	routes   []NotificationRoute
+	tenants  *Tenants
+	products *Products
+	logger   *zap.Logger
+
+	queue chan Notification
+}
+
+// NewNotifications creates a dispatcher sending to routes
+func NewNotifications(routes []NotificationRoute, log *zap.Logger) *Notifications {
+	return &Notifications{
+		routes: routes,
+		logger: log,
+		queue:  make(chan Notification, notificationQueueSize),
+	}
+}
+
+// SetTenants sets the tenants whose tickets are announced in their own
+// chats
+func (n *Notifications) SetTenants(tenants *Tenants) {
+	n.tenants = tenants
+}
+
+// SetProducts sets the registered products whose tickets are also announced
+// in their own chats
+func (n *Notifications) SetProducts(products *Products) {
+	n.products = products
+}
+
+// TicketCreated queues the notifications of a new ticket. It never blocks;
+// notifications are dropped when the queue is full.
+func (n *Notifications) TicketCreated(notification Notification) {
+	select {
+	case n.queue <- notification:
+	default:
+		n.logger.Warn("Notification queue is full, dropping notification", zap.String("ticket_id", notification.TicketID))
+	}
+}
+
+// Run sends queued notifications until stopping is closed, then sends the
+// ones still queued until none are left or ctx is done
+func (n *Notifications) Run(ctx context.Context, stopping <-chan struct{}) {
+	for {
+		select {
+		case notification := <-n.queue:
+			n.send(ctx, notification)
+		case <-stopping:
+			for ctx.Err() == nil {
+				select {
+				case notification := <-n.queue:
+					n.send(ctx, notification)
+				default:
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+// send delivers a notification to every route that matches it
+func (n *Notifications) send(ctx context.Context, notification Notification) {
+	routes := n.routes
+	switch {
+	case notification.Tenant != "":
+		routes = nil
+		if n.tenants != nil {
+			routes = n.tenants.NotificationRoutes(notification.Tenant)
+		}
+	case n.products != nil:
+		routes = slices.Concat(routes, n.products.NotificationRoutes(notification.Product))
+	}
+	for _, route := range routes {
+		if !route.matches(notification) {
+			continue
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, notificationTimeout)
+		err := route.Notifier.Notify(sendCtx, notification)
+		cancel()
+		if err != nil {
+			n.logger.Warn("Failed to send notification",
+				zap.String("route", route.Name),
+				zap.String("ticket_id", notification.TicketID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// channelRoutes returns the routes of the chats of a tenant or product,
+// named after it
+func channelRoutes(name string, channels []models.NotificationChannel) []NotificationRoute {
+	var routes []NotificationRoute
+	for i, channel := range channels {
+		var notifier Notifier
+		switch channel.Provider {
+		case NotifierTeams:
+			notifier = NewTeamsNotifier(channel.WebhookURL)
+		case NotifierGoogleChat:
+			notifier = NewGoogleChatNotifier(channel.WebhookURL)
+		default:
+			continue
+		}
+		routes = append(routes, NotificationRoute{
+			Name:       fmt.Sprintf("%s-%d", name, i),
+			Notifier:   notifier,
+			Severities: channel.Severities,
+		})
+	}
+	return routes
+}
+
+// postWebhook posts a JSON payload to an incoming webhook
+func postWebhook(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// notificationTitle is the headline of a notification
+func notificationTitle(n Notification) string {
+	title := "New ticket " + n.TicketID
+	if n.Severity != "" {
+		title = fmt.Sprintf("New %s ticket %s", n.Severity, n.TicketID)
+	}
+	return title
+}
+
+// notificationFacts are the labelled details of a notification, leaving out
+// the empty ones
+func notificationFacts(n Notification) [][2]string {
+	var facts [][2]string
+	for _, fact := range [][2]string{
+		{"Product", n.Product},
+		{"Severity", n.Severity},
+		{"Assignee", n.Assignee},
+		{"Reporter", n.Reporter},
+	} {
+		if fact[1] != "" {
+			facts = append(facts, fact)
+		}
+	}
+	return facts
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"net/http"
+)
+
+// GoogleChatNotifier posts cards to a Google Chat space's incoming webhook
+type GoogleChatNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// NewGoogleChatNotifier creates a notifier posting to a Google Chat webhook
+func NewGoogleChatNotifier(webhookURL string) *GoogleChatNotifier {
+	return &GoogleChatNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: notificationTimeout},
+	}
+}
+
+// Notify posts a card with the ticket's summary, details and a link to it.
+// The text is shown in notifications and by clients without cards.
+func (g *GoogleChatNotifier) Notify(ctx context.Context, n Notification) error {
+	widgets := []interface{}{
+		map[string]interface{}{
+			"textParagraph": map[string]string{"text": n.Summary},
+		},
+	}
+	for _, fact := range notificationFacts(n) {
+		widgets = append(widgets, map[string]interface{}{
+			"decoratedText": map[string]string{"topLabel": fact[0], "text": fact[1]},
+		})
+	}
+	// Collected tickets have no tracker to link
+	if n.JiraLink != "" {
+		widgets = append(widgets, map[string]interface{}{
+			"buttonList": map[string]interface{}{
+				"buttons": []interface{}{
+					map[string]interface{}{
+						"text":    "Open in Jira",
+						"onClick": map[string]interface{}{"openLink": map[string]string{"url": n.JiraLink}},
+					},
+				},
+			},
+		})
+	}
+
+	return postWebhook(ctx, g.client, g.webhookURL, map[string]interface{}{
+		"text": notificationTitle(n) + ": " + n.Summary,
+		"cardsV2": []interface{}{
+			map[string]interface{}{
+				"cardId": n.TicketID,
+				"card": map[string]interface{}{
+					"header":   map[string]string{"title": notificationTitle(n), "subtitle": n.Product},
+					"sections": []interface{}{map[string]interface{}{"widgets": widgets}},
+				},
+			},
+		},
+	})
+}
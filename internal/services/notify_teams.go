@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"net/http"
+)
+
+// TeamsNotifier posts Adaptive Cards to a Microsoft Teams incoming webhook
+// or a Workflows webhook
+type TeamsNotifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// NewTeamsNotifier creates a notifier posting to a Teams webhook
+func NewTeamsNotifier(webhookURL string) *TeamsNotifier {
+	return &TeamsNotifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: notificationTimeout},
+	}
+}
+
+// Notify posts a card with the ticket's summary, details and a link to it
+func (t *TeamsNotifier) Notify(ctx context.Context, n Notification) error {
+	facts := []map[string]string{}
+	for _, fact := range notificationFacts(n) {
+		facts = append(facts, map[string]string{"title": fact[0], "value": fact[1]})
+	}
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{
+				"type":   "TextBlock",
+				"text":   notificationTitle(n),
+				"weight": "Bolder",
+				"size":   "Medium",
+				"color":  teamsColor(n.Severity),
+			},
+			map[string]interface{}{
+				"type": "TextBlock",
+				"text": n.Summary,
+				"wrap": true,
+			},
+			map[string]interface{}{
+				"type":  "FactSet",
+				"facts": facts,
+			},
+		},
+	}
+	// Collected tickets have no tracker to link
+	if n.JiraLink != "" {
+		card["actions"] = []interface{}{
+			map[string]interface{}{
+				"type":  "Action.OpenUrl",
+				"title": "Open in Jira",
+				"url":   n.JiraLink,
+			},
+		}
+	}
+
+	return postWebhook(ctx, t.client, t.webhookURL, map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     card,
+			},
+		},
+	})
+}
+
+// teamsColor is the Adaptive Card color of a severity's title
+func teamsColor(severity string) string {
+	switch severity {
+	case SeverityCritical, SeverityHigh:
+		return "Attention"
+	case SeverityMedium:
+		return "Warning"
+	}
+	return "Default"
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Object tag keys applied to uploads
+const (
+	TagProduct     = "product"
+	TagEnvironment = "environment"
+	TagTicketID    = "ticket_id"
+)
+
+var unsafeKeyChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// UploadMetadata describes the context an object is uploaded in
+type UploadMetadata struct {
+	Product     string
+	Environment string
+}
+
+// Tags returns the object tags for the upload
+func (m UploadMetadata) Tags() map[string]string {
+	tags := map[string]string{}
+	if m.Product != "" {
+		tags[TagProduct] = m.Product
+	}
+	if m.Environment != "" {
+		tags[TagEnvironment] = m.Environment
+	}
+	return tags
+}
+
+// KeyTemplate renders object keys for uploads from a prefix template such as
+// "uploads/ronnin/{{.Environment}}/{{.Product}}/{{.Date}}/". The literal text
+// before the first action is the root prefix all upload keys live under.
+type KeyTemplate struct {
+	tmpl *template.Template
+	root string
+}
+
+// keyTemplateData is the data available to key prefix templates
+type keyTemplateData struct {
+	Product     string
+	Environment string
+	Date        string
+	Year        string
+	Month       string
+	Day         string
+}
+
+// NewKeyTemplate parses a key prefix template. An empty template uses the
+// default upload prefix.
+func NewKeyTemplate(text string) (*KeyTemplate, error) {
+	if text == "" {
+		text = uploadKeyPrefix
+	}
+
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key prefix template: %w", err)
+	}
+
+	root := text
+	if idx := strings.Index(text, "{{"); idx >= 0 {
+		root = text[:idx]
+	}
+	if root == "" || strings.HasPrefix(root, "/") {
+		return nil, fmt.Errorf("key prefix template must start with a static prefix without a leading slash: %q", text)
+	}
+
+	return &KeyTemplate{tmpl: tmpl, root: root}, nil
+}
+
+// NewKey builds a unique object key for a file
+func (t *KeyTemplate) NewKey(filename string, meta UploadMetadata) (string, error) {
+	now := time.Now().UTC()
+	data := keyTemplateData{
+		Product:     sanitizeKeySegment(meta.Product),
+		Environment: sanitizeKeySegment(meta.Environment),
+		Date:        now.Format("2006/01/02"),
+		Year:        now.Format("2006"),
+		Month:       now.Format("01"),
+		Day:         now.Format("02"),
+	}
+
+	var prefix bytes.Buffer
+	if err := t.tmpl.Execute(&prefix, data); err != nil {
+		return "", fmt.Errorf("failed to render key prefix: %w", err)
+	}
+
+	dir := prefix.String()
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+
+	return fmt.Sprintf("%s%s%s", dir, uuid.New().String(), strings.ToLower(filepath.Ext(filename))), nil
+}
+
+// Root returns the static prefix all upload keys live under
+func (t *KeyTemplate) Root() string {
+	return t.root
+}
+
+// Owns reports whether objectKey was generated under this template's root
+// prefix. Clients may only reference such objects.
+func (t *KeyTemplate) Owns(objectKey string) bool {
+	return strings.HasPrefix(objectKey, t.root) &&
+		!strings.Contains(objectKey, "..") &&
+		len(objectKey) > len(t.root)
+}
+
+// sanitizeKeySegment makes a value safe to use as an object key path segment
+func sanitizeKeySegment(value string) string {
+	value = unsafeKeyChars.ReplaceAllString(strings.ToLower(strings.TrimSpace(value)), "-")
+	value = strings.Trim(value, "-.")
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
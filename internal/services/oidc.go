@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksMaxAge is how long signing keys are used before they are fetched
+	// again
+	jwksMaxAge = time.Hour
+	// jwksMinRefresh limits refetching when tokens are signed with an
+	// unknown key, so forged tokens cannot hammer the identity provider
+	jwksMinRefresh = time.Minute
+	// oidcLeeway is the clock skew tolerated on token expiry
+	oidcLeeway = 30 * time.Second
+)
+
+// Errors returned when verifying OIDC tokens
+var (
+	ErrInvalidIDToken  = errors.New("invalid bearer token")
+	ErrJWKSUnavailable = errors.New("signing keys of the identity provider are unavailable")
+)
+
+// OIDCIdentity is the caller a verified token was issued to
+type OIDCIdentity struct {
+	Subject string
+	Email   string
+	Roles   []string
+	Scopes  []string
+
+	// Products the caller's tickets are limited to, from the products claim
+	Products []string
+}
+
+// Allows reports whether the identity's roles grant a scope
+func (i *OIDCIdentity) Allows(scope string) bool {
+	return scopesAllow(i.Scopes, scope)
+}
+
+// OIDCVerifier verifies bearer tokens issued by an OpenID Connect provider
+// and maps their role claims to scopes
+type OIDCVerifier struct {
+	client     *http.Client
+	issuer     string
+	audience   string
+	jwksURL    string
+	rolesClaim []string
+	roleScopes map[string][]string
+	// productsClaim limits callers to the tickets of the products it lists
+	productsClaim []string
+
+	mu          sync.Mutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// NewOIDCVerifier creates a verifier of tokens from issuer for audience.
+// Signing keys are fetched from jwksURL, or the issuer's discovery document
+// when empty. rolesClaim is the claim holding the caller's roles, a dotted
+// path for nested claims such as realm_access.roles; roles grant the scopes
+// they are mapped to in roleScopes. productsClaim, a path of the same kind,
+// lists the products a caller's tickets are limited to.
+func NewOIDCVerifier(issuer, audience, jwksURL, rolesClaim, productsClaim string, roleScopes map[string][]string) (*OIDCVerifier, error) {
+	for role, scopes := range roleScopes {
+		if err := validateScopes(scopes); err != nil {
+			return nil, fmt.Errorf("role %s: %w", role, err)
+		}
+	}
+	return &OIDCVerifier{
+		client:        &http.Client{Timeout: 10 * time.Second},
+		issuer:        strings.TrimSuffix(issuer, "/"),
+		audience:      audience,
+		jwksURL:       jwksURL,
+		rolesClaim:    strings.Split(rolesClaim, "."),
+		roleScopes:    roleScopes,
+		productsClaim: strings.Split(productsClaim, "."),
+	}, nil
+}
+
+// LooksLikeJWT reports whether a bearer token is a JWT rather than an API key
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && strings.HasPrefix(token, "eyJ")
+}
+
+// Verify checks the signature, issuer, audience and expiry of a token and
+// returns who it was issued to
+func (v *OIDCVerifier) Verify(ctx context.Context, token string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(oidcLeeway),
+	)
+	if err != nil {
+		if errors.Is(err, ErrJWKSUnavailable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	identity := &OIDCIdentity{
+		Roles:    claimStrings(claims, v.rolesClaim),
+		Products: claimStrings(claims, v.productsClaim),
+	}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	for _, role := range identity.Roles {
+		identity.Scopes = append(identity.Scopes, v.roleScopes[role]...)
+	}
+	return identity, nil
+}
+
+// claimStrings returns the values of the claim at a path, which may be a
+// list or a space-separated string
+func claimStrings(claims jwt.MapClaims, path []string) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, name := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+
+	switch values := value.(type) {
+	case string:
+		return strings.Fields(values)
+	case []interface{}:
+		names := make([]string, 0, len(values))
+		for _, v := range values {
+			if name, ok := v.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// key returns the signing key with an ID, fetching the key set when it is
+// stale or does not have the key
+func (v *OIDCVerifier) key(ctx context.Context, kid string) (interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, ok := v.keys[kid]
+	if ok && time.Since(v.fetchedAt) < jwksMaxAge {
+		return key, nil
+	}
+	if time.Since(v.attemptedAt) < jwksMinRefresh {
+		if ok {
+			return key, nil
+		}
+		if v.keys == nil {
+			return nil, ErrJWKSUnavailable
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	v.attemptedAt = time.Now()
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		if ok {
+			// Keep using a known key while the provider is unreachable
+			return key, nil
+		}
+		return nil, fmt.Errorf("%w: %w", ErrJWKSUnavailable, err)
+	}
+	v.keys = keys
+	v.fetchedAt = v.attemptedAt
+
+	if key, ok = v.keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetchKeys downloads the provider's signing keys by key ID
+func (v *OIDCVerifier) fetchKeys(ctx context.Context) (map[string]interface{}, error) {
+	if v.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.fetchJSON(ctx, v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("discovery document of %s has no jwks_uri", v.issuer)
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := v.fetchJSON(ctx, v.jwksURL, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Keys of unsupported types are skipped rather than failing the set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable signing keys at %s", v.jwksURL)
+	}
+	return keys, nil
+}
+
+func (v *OIDCVerifier) fetchJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to fetch %s: status %d: %s", url, resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
+
+// jsonWebKey is a public key of a JWKS, RFC 7517
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeKeyInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeKeyInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeKeyInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeKeyInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeKeyInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key parameter: %w", err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// On-call schedule providers
+const (
+	OnCallPagerDuty = "pagerduty"
+	OnCallOpsgenie  = "opsgenie"
+)
+
+// OnCallLookup finds the emails of whoever is currently on call in a schedule
+type OnCallLookup interface {
+	OnCall(ctx context.Context, scheduleID string) ([]string, error)
+}
+
+// PagerDutySchedules looks up on-call users with the PagerDuty REST API
+type PagerDutySchedules struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+// NewPagerDutySchedules creates a PagerDuty lookup authenticated with an API token
+func NewPagerDutySchedules(token string) *PagerDutySchedules {
+	return &PagerDutySchedules{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		baseURL: "https://api.pagerduty.com",
+		token:   token,
+	}
+}
+
+// OnCall returns the emails of the users on call in a schedule
+func (p *PagerDutySchedules) OnCall(ctx context.Context, scheduleID string) ([]string, error) {
+	query := url.Values{
+		"schedule_ids[]": {scheduleID},
+		"include[]":      {"users"},
+		"earliest":       {"true"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/oncalls?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token token="+p.token)
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+
+	var body struct {
+		OnCalls []struct {
+			User struct {
+				Email string `json:"email"`
+			} `json:"user"`
+		} `json:"oncalls"`
+	}
+	if err := fetchOnCall(p.client, req, "PagerDuty", &body); err != nil {
+		return nil, err
+	}
+
+	emails := make([]string, 0, len(body.OnCalls))
+	for _, oncall := range body.OnCalls {
+		if oncall.User.Email != "" {
+			emails = append(emails, oncall.User.Email)
+		}
+	}
+	return emails, nil
+}
+
+// OpsgenieSchedules looks up on-call participants with the Opsgenie API
+type OpsgenieSchedules struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+}
+
+// NewOpsgenieSchedules creates an Opsgenie lookup authenticated with an API key
+func NewOpsgenieSchedules(apiKey string) *OpsgenieSchedules {
+	return &OpsgenieSchedules{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		baseURL: "https://api.opsgenie.com",
+		apiKey:  apiKey,
+	}
+}
+
+// OnCall returns the emails of the users on call in a schedule
+func (o *OpsgenieSchedules) OnCall(ctx context.Context, scheduleID string) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/v2/schedules/%s/on-calls?scheduleIdentifierType=id&flat=true", o.baseURL, url.PathEscape(scheduleID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "GenieKey "+o.apiKey)
+
+	var body struct {
+		Data struct {
+			OnCallRecipients []string `json:"onCallRecipients"`
+		} `json:"data"`
+	}
+	if err := fetchOnCall(o.client, req, "Opsgenie", &body); err != nil {
+		return nil, err
+	}
+	return body.Data.OnCallRecipients, nil
+}
+
+// fetchOnCall sends a schedule request and decodes the JSON response
+func fetchOnCall(client *http.Client, req *http.Request, provider string, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to look up %s schedule: status %d: %s", provider, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", provider, err)
+	}
+	return nil
+}
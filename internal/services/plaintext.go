@@ -0,0 +1,77 @@
+package services
+
+import (
+	"strings"
+)
+
+// plaintextLimit is the maximum length of a plain text description or
+// comment
+const plaintextLimit = 65536
+
+// plaintext renders descriptions for trackers without markup: headings are
+// underlined, code is indented and technical details are written out in
+// full rather than collapsed
+var plaintext = plaintextRenderer{}
+
+type plaintextRenderer struct{}
+
+func (plaintextRenderer) heading(level int, title string) string {
+	underline := "-"
+	if level <= 2 {
+		underline = "="
+	}
+	return title + "\n" + strings.Repeat(underline, len(title)) + "\n"
+}
+
+func (plaintextRenderer) item(text string) string {
+	return "- " + text + "\n"
+}
+
+func (plaintextRenderer) field(label, value string) string {
+	return "- " + label + ": " + value + "\n"
+}
+
+func (plaintextRenderer) link(title, url string) string {
+	return title + " <" + url + ">"
+}
+
+func (plaintextRenderer) codeBlock(lines []string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString("    ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (plaintextRenderer) inlineCode(text string) string {
+	return text
+}
+
+func (plaintextRenderer) codeEnd() string {
+	return ""
+}
+
+func (plaintextRenderer) note(text string) string {
+	return "Note: " + text
+}
+
+func (r plaintextRenderer) details(title, content string) string {
+	return r.heading(3, title) + r.codeBlock(strings.Split(content, "\n")) + "\n"
+}
+
+func (plaintextRenderer) screenshot(imageURL, contentType string) string {
+	if IsVideoContentType(contentType) {
+		return "Screen recording: " + imageURL
+	}
+	return imageURL
+}
+
+func (plaintextRenderer) quarantined() string {
+	return "The attachment of this report was flagged by the malware scanner and is pending review."
+}
+
+func (plaintextRenderer) maxLength() int {
+	return plaintextLimit
+}
@@ -0,0 +1,135 @@
+package services
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Roles of callers of the ticket API, derived from the scopes of their API
+// key or OIDC roles: read makes a viewer, write an agent and admin an admin
+const (
+	RoleViewer = "viewer"
+	RoleAgent  = "agent"
+	RoleAdmin  = "admin"
+)
+
+// Actions on ticket data checked by the policy
+const (
+	ActionReadTicket = "ticket:read"
+	ActionComment    = "ticket:comment"
+	ActionReassign   = "ticket:reassign"
+	ActionDelete     = "ticket:delete"
+	ActionExport     = "ticket:export"
+)
+
+// roleActions are the actions each role may take
+var roleActions = map[string][]string{
+	RoleViewer: {ActionReadTicket},
+	RoleAgent:  {ActionReadTicket, ActionComment, ActionReassign},
+	RoleAdmin:  {ActionReadTicket, ActionComment, ActionReassign, ActionDelete, ActionExport},
+}
+
+// Principal is the authenticated caller of a request. Viewers and agents
+// with products only see tickets of those products; admins and callers
+// without products see all tickets. Callers of a tenant, whatever their
+// role, only see the tickets of their tenant.
+type Principal struct {
+	Name     string
+	Role     string
+	Products []string
+	Tenant   string
+}
+
+// NewPrincipal returns the principal of a caller granted scopes, limited to
+// products when any are given
+func NewPrincipal(name string, scopes, products []string) *Principal {
+	p := &Principal{Name: name, Products: products}
+	switch {
+	case scopesAllow(scopes, ScopeAdmin):
+		p.Role = RoleAdmin
+	case scopesAllow(scopes, ScopeWrite):
+		p.Role = RoleAgent
+	case scopesAllow(scopes, ScopeRead):
+		p.Role = RoleViewer
+	}
+	return p
+}
+
+// Can reports whether the principal's role allows an action. A nil
+// principal is an unauthenticated caller of a route that requires no
+// credentials and may do anything the route offers.
+func (p *Principal) Can(action string) bool {
+	if p == nil {
+		return true
+	}
+	for _, allowed := range roleActions[p.Role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ProductFilter returns the products whose tickets the principal may see, or
+// nil when it may see all tickets
+func (p *Principal) ProductFilter() []string {
+	if p == nil || p.Role == RoleAdmin || len(p.Products) == 0 {
+		return nil
+	}
+	return p.Products
+}
+
+// TenantFilter returns the tenant whose tickets the principal may see, or
+// "" when it may see the tickets of every tenant
+func (p *Principal) TenantFilter() string {
+	if p == nil {
+		return ""
+	}
+	return p.Tenant
+}
+
+// Scope returns the tickets the principal may see
+func (p *Principal) Scope() TicketScope {
+	return TicketScope{Tenant: p.TenantFilter(), Products: p.ProductFilter()}
+}
+
+// CanAccess reports whether the principal may take an action on a ticket
+func (p *Principal) CanAccess(action string, ticket *FlattenedTicket) bool {
+	if !p.Can(action) {
+		return false
+	}
+	if tenant := p.TenantFilter(); tenant != "" && tenant != ticket.Tenant {
+		return false
+	}
+	products := p.ProductFilter()
+	if products == nil {
+		return true
+	}
+	for _, product := range products {
+		if product == ticket.Product {
+			return true
+		}
+	}
+	return false
+}
+
+// TicketScope selects stored tickets: those of a tenant when Tenant is set,
+// and of products when any are given. The zero scope selects all tickets.
+type TicketScope struct {
+	Tenant   string
+	Products []string
+}
+
+// All reports whether the scope selects all tickets
+func (s TicketScope) All() bool {
+	return s.Tenant == "" && len(s.Products) == 0
+}
+
+// filter returns the MongoDB filter of the tickets in the scope
+func (s TicketScope) filter() bson.M {
+	filter := bson.M{}
+	if len(s.Products) > 0 {
+		filter["product"] = bson.M{"$in": s.Products}
+	}
+	if s.Tenant != "" {
+		filter["tenant"] = s.Tenant
+	}
+	return filter
+}
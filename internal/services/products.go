@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// productsCollection holds the products registered through the admin API
+const productsCollection = "products"
+
+// productRefreshInterval is how often instances pick up the products
+// changed on another instance
+const productRefreshInterval = 30 * time.Second
+
+// Errors returned by the product store
+var (
+	ErrProductNotFound      = errors.New("product not found")
+	ErrProductExists        = errors.New("a product with this ID is already registered")
+	ErrInvalidProduct       = errors.New("invalid product settings")
+	ErrProductsNotAvailable = errors.New("products can only be registered when MongoDB is configured")
+)
+
+// product is a registered product with its settings compiled
+type product struct {
+	models.Product
+	team          *RosterTeam
+	rules         []classificationRule
+	notifications []NotificationRoute
+}
+
+// Products holds the products registered in MongoDB and applies their
+// routing: their Jira project to the registry, their support team to the
+// roster, their severity rules to the classifier and their chats to the
+// notifications. Changes made on another instance are picked up by Run.
+type Products struct {
+	mongoService *MongoDBService
+	registry     *JiraRegistry
+	logger       *zap.Logger
+
+	mu       sync.RWMutex
+	roster   *Roster // the roster of the configuration, without product teams
+	products map[string]*product
+}
+
+// NewProducts creates the product store, empty until Run loads the
+// products. The teams of the products are added to roster and set on
+// registry.
+func NewProducts(ms *MongoDBService, registry *JiraRegistry, roster *Roster, log *zap.Logger) *Products {
+	return &Products{
+		mongoService: ms,
+		registry:     registry,
+		logger:       log,
+		roster:       roster,
+		products:     make(map[string]*product),
+	}
+}
+
+// Get returns a registered product
+func (p *Products) Get(id string) (*models.Product, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	found, ok := p.products[strings.ToLower(id)]
+	if !ok {
+		return nil, false
+	}
+	registered := found.Product
+	return &registered, true
+}
+
+// List returns the registered products by ID
+func (p *Products) List() []models.Product {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	products := make([]models.Product, 0, len(p.products))
+	for _, found := range p.products {
+		products = append(products, found.Product)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	return products
+}
+
+// ProjectKey returns the Jira project new tickets of a product are filed
+// in, or "" when it has none
+func (p *Products) ProjectKey(id string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if found, ok := p.products[strings.ToLower(id)]; ok {
+		return found.ProjectKey
+	}
+	return ""
+}
+
+// NotificationRoutes returns the chats the new tickets of a product are
+// announced in
+func (p *Products) NotificationRoutes(id string) []NotificationRoute {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if found, ok := p.products[strings.ToLower(id)]; ok {
+		return found.notifications
+	}
+	return nil
+}
+
+// severityRules returns the rules classifying the reports of a product
+func (p *Products) severityRules(id string) []classificationRule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if found, ok := p.products[strings.ToLower(id)]; ok {
+		return found.rules
+	}
+	return nil
+}
+
+// Create registers a product. It returns ErrInvalidProduct when its team or
+// rules cannot be applied.
+func (p *Products) Create(ctx context.Context, registered *models.Product) error {
+	if _, err := newProduct(*registered, p.baseRoster()); err != nil {
+		return err
+	}
+	registered.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	registered.UpdatedAt = registered.CreatedAt
+	if err := p.mongoService.SaveProduct(ctx, registered); err != nil {
+		return err
+	}
+	p.apply([]models.Product{*registered}, false)
+	return nil
+}
+
+// Update replaces the settings of a registered product
+func (p *Products) Update(ctx context.Context, registered *models.Product) error {
+	current, ok := p.Get(registered.ID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProductNotFound, registered.ID)
+	}
+	if _, err := newProduct(*registered, p.baseRoster()); err != nil {
+		return err
+	}
+	registered.CreatedAt = current.CreatedAt
+	registered.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	if err := p.mongoService.ReplaceProduct(ctx, registered); err != nil {
+		return err
+	}
+	p.apply([]models.Product{*registered}, false)
+	return nil
+}
+
+// Delete unregisters a product, which is routed by the configuration again
+func (p *Products) Delete(ctx context.Context, id string) error {
+	if err := p.mongoService.DeleteProduct(ctx, id); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	found, ok := p.products[id]
+	delete(p.products, id)
+	p.mu.Unlock()
+	if ok && found.team != nil {
+		p.applyRoster()
+	}
+	return nil
+}
+
+// SetRoster replaces the roster of the configuration, to which the teams of
+// the products are added
+func (p *Products) SetRoster(roster *Roster) {
+	p.mu.Lock()
+	p.roster = roster
+	p.mu.Unlock()
+	p.applyRoster()
+}
+
+// Run loads the products and refreshes them until stopping is closed
+func (p *Products) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(productRefreshInterval)
+	defer ticker.Stop()
+	for {
+		p.refresh(ctx)
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Products) refresh(ctx context.Context) {
+	products, err := p.mongoService.GetProducts(ctx)
+	if err != nil {
+		// The last known products are kept
+		p.logger.Warn("Failed to load products", zap.Error(err))
+		return
+	}
+	p.apply(products, true)
+}
+
+// apply makes products current, compiling the settings of those that are
+// new or changed, and sets the roster when a team changed. With all,
+// products are the complete list and the others are removed.
+func (p *Products) apply(products []models.Product, all bool) {
+	p.mu.Lock()
+	teamsChanged := false
+	seen := make(map[string]bool, len(products))
+	for _, loaded := range products {
+		seen[loaded.ID] = true
+		current, ok := p.products[loaded.ID]
+		if ok && current.UpdatedAt.Equal(loaded.UpdatedAt) {
+			continue
+		}
+
+		created, err := newProduct(loaded, p.roster)
+		if err != nil {
+			// A product whose settings no longer apply, e.g. after the
+			// on-call provider of its team was removed, keeps its route
+			p.logger.Error("Failed to apply product settings", zap.String("product", loaded.ID), zap.Error(err))
+			created = &product{Product: loaded}
+		} else {
+			p.logger.Info("Product loaded", zap.String("product", loaded.ID))
+		}
+		p.products[loaded.ID] = created
+		teamsChanged = teamsChanged || created.team != nil || ok && current.team != nil
+	}
+
+	if all {
+		for id, current := range p.products {
+			if !seen[id] {
+				delete(p.products, id)
+				teamsChanged = teamsChanged || current.team != nil
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if teamsChanged {
+		p.applyRoster()
+	}
+}
+
+func (p *Products) baseRoster() *Roster {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.roster
+}
+
+// applyRoster sets the roster of the configuration with the teams of the
+// products on the registry
+func (p *Products) applyRoster() {
+	p.mu.RLock()
+	base := p.roster
+	var teams []RosterTeam
+	for _, found := range p.products {
+		if found.team != nil {
+			teams = append(teams, *found.team)
+		}
+	}
+	p.mu.RUnlock()
+
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Name < teams[j].Name })
+	roster, err := base.WithTeams(teams)
+	if err != nil {
+		p.logger.Error("Failed to add the teams of products to the support roster", zap.Error(err))
+		roster = base
+	}
+	p.registry.SetRoster(roster)
+}
+
+// newProduct compiles the settings of a product, returning
+// ErrInvalidProduct when its rules are invalid or its team cannot be added
+// to roster
+func newProduct(loaded models.Product, roster *Roster) (*product, error) {
+	created := &product{Product: loaded}
+	if loaded.Team != nil {
+		team, err := productTeam(loaded)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := roster.WithTeams([]RosterTeam{team}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProduct, err)
+		}
+		created.team = &team
+	}
+	for i, rule := range loaded.SeverityRules {
+		compiled, err := compileClassificationRule(ClassificationRule{
+			Name:     fmt.Sprintf("%s-%d", loaded.ID, i),
+			Category: rule.Category,
+			Severity: rule.Severity,
+			Keywords: rule.Keywords,
+			Statuses: rule.Statuses,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProduct, err)
+		}
+		created.rules = append(created.rules, compiled)
+	}
+	created.notifications = channelRoutes(loaded.ID, loaded.Notifications)
+	return created, nil
+}
+
+// productTeam returns the roster team of the support team of a product
+func productTeam(registered models.Product) (RosterTeam, error) {
+	team := RosterTeam{
+		Name:     "product:" + registered.ID,
+		Products: []string{registered.ID},
+		Schedule: registered.Team.Schedule,
+		Members:  make([]RosterMember, len(registered.Team.Members)),
+	}
+	for i, member := range registered.Team.Members {
+		team.Members[i] = RosterMember{AccountID: member.AccountID, Email: member.Email, GitHub: member.GitHub, GitLab: member.GitLab}
+		if member.Hours == "" {
+			continue
+		}
+		shift, err := ParseShift(member.Timezone, member.Hours, member.Days)
+		if err != nil {
+			return RosterTeam{}, fmt.Errorf("%w: invalid shift of %s: %v", ErrInvalidProduct, member.AccountID, err)
+		}
+		team.Members[i].Shift = shift
+	}
+	return team, nil
+}
+
+// SaveProduct stores a newly registered product
+func (s *MongoDBService) SaveProduct(ctx context.Context, registered *models.Product) error {
+	_, err := s.database.Collection(productsCollection).InsertOne(ctx, registered)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrProductExists, registered.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert product: %w", err)
+	}
+	return nil
+}
+
+// ReplaceProduct replaces the settings of a registered product
+func (s *MongoDBService) ReplaceProduct(ctx context.Context, registered *models.Product) error {
+	result, err := s.database.Collection(productsCollection).ReplaceOne(ctx, bson.M{"_id": registered.ID}, registered)
+	if err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrProductNotFound, registered.ID)
+	}
+	return nil
+}
+
+// DeleteProduct removes a registered product
+func (s *MongoDBService) DeleteProduct(ctx context.Context, id string) error {
+	result, err := s.database.Collection(productsCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete product: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrProductNotFound, id)
+	}
+	return nil
+}
+
+// GetProducts retrieves all registered products
+func (s *MongoDBService) GetProducts(ctx context.Context) ([]models.Product, error) {
+	products := []models.Product{}
+	cursor, err := s.database.Collection(productsCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find products: %w", err)
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("failed to decode products: %w", err)
+	}
+	return products, nil
+}
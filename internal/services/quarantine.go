@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Review states of an attachment flagged by the malware scanner
+const (
+	AttachmentStatusQuarantined = "quarantined"
+	AttachmentStatusReleased    = "released"
+	AttachmentStatusPurged      = "purged"
+)
+
+// QuarantineNote is shown in the Jira description in place of a quarantined screenshot
+const QuarantineNote = "{panel:title=Attachment quarantined|borderStyle=dashed|borderColor=#d04437|titleBGColor=#fce4e4|bgColor=#fafafa}\n" +
+	"The attachment of this report was flagged by the malware scanner and is pending review.\n{panel}"
+
+// purgedNote replaces QuarantineNote once a quarantined attachment is purged
+const purgedNote = "{panel:title=Attachment removed|borderStyle=dashed|borderColor=#ccc|titleBGColor=#f0f0f0|bgColor=#fafafa}\n" +
+	"The attachment of this report was removed after malware review.\n{panel}"
+
+// TagQuarantined marks objects stored under the quarantine prefix
+const TagQuarantined = "quarantined"
+
+// ErrNotQuarantined is returned when a ticket has no attachment pending review
+var ErrNotQuarantined = errors.New("ticket has no quarantined attachment")
+
+// QuarantineService keeps suspicious uploads under a separate prefix until an
+// admin releases or purges them
+type QuarantineService struct {
+	storage      ObjectStorage
+	jiraService  *JiraRegistry
+	mongoService *MongoDBService
+	prefix       string
+	audit        *zap.Logger
+}
+
+// NewQuarantineService creates a quarantine service storing objects under prefix
+func NewQuarantineService(storage ObjectStorage, js *JiraRegistry, ms *MongoDBService, prefix string, log *zap.Logger) (*QuarantineService, error) {
+	prefix = strings.TrimLeft(prefix, "/")
+	if prefix == "" {
+		return nil, errors.New("quarantine key prefix must not be empty")
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &QuarantineService{
+		storage:      storage,
+		jiraService:  js,
+		mongoService: ms,
+		prefix:       prefix,
+		audit:        log.Named("audit"),
+	}, nil
+}
+
+// KeyFor returns the quarantine key of an upload object key
+func (s *QuarantineService) KeyFor(objectKey string) string {
+	return s.prefix + objectKey
+}
+
+// QuarantineUpload stores a suspicious upload under the quarantine prefix and
+// returns its quarantine key
+func (s *QuarantineService) QuarantineUpload(ctx context.Context, file *multipart.FileHeader, objectKey string, tags map[string]string) (string, error) {
+	quarantineKey := s.KeyFor(objectKey)
+	if _, err := s.storage.UploadFile(ctx, file, quarantineKey, withQuarantineTag(tags)); err != nil {
+		return "", fmt.Errorf("failed to store quarantined upload: %w", err)
+	}
+
+	return quarantineKey, nil
+}
+
+// QuarantineObject moves an object that was uploaded directly to storage
+// under the quarantine prefix and returns its quarantine key
+func (s *QuarantineService) QuarantineObject(ctx context.Context, objectKey string) (string, error) {
+	quarantineKey := s.KeyFor(objectKey)
+	if err := s.storage.CopyObject(ctx, objectKey, quarantineKey); err != nil {
+		return "", fmt.Errorf("failed to quarantine object: %w", err)
+	}
+	if err := s.storage.TagObject(ctx, quarantineKey, map[string]string{TagQuarantined: "true"}); err != nil {
+		s.audit.Warn("Failed to tag quarantined object", zap.Error(err), zap.String("key", quarantineKey))
+	}
+	if err := s.storage.DeleteObject(ctx, objectKey); err != nil {
+		return "", fmt.Errorf("failed to remove object after quarantine: %w", err)
+	}
+
+	return quarantineKey, nil
+}
+
+// ListQuarantined returns the tickets with an attachment pending review
+func (s *QuarantineService) ListQuarantined(ctx context.Context) ([]FlattenedTicket, error) {
+	if s.mongoService == nil {
+		return nil, errors.New("MongoDB is not configured")
+	}
+
+	return s.mongoService.GetTicketsByAttachmentStatus(ctx, AttachmentStatusQuarantined)
+}
+
+// Approve releases a quarantined attachment: the object is moved back to its
+// upload key and the screenshot is embedded in the Jira ticket
+func (s *QuarantineService) Approve(ctx context.Context, ticketID, reviewer string) (*FlattenedTicket, error) {
+	ticket, err := s.quarantinedTicket(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	ctx = WithTenant(ctx, ticket.Tenant)
+
+	if err := s.storage.CopyObject(ctx, ticket.QuarantineKey, ticket.ImageKey); err != nil {
+		return nil, fmt.Errorf("failed to release quarantined object: %w", err)
+	}
+	if err := s.storage.TagObject(ctx, ticket.ImageKey, map[string]string{TagQuarantined: "false"}); err != nil {
+		s.audit.Warn("Failed to tag released object", zap.Error(err), zap.String("key", ticket.ImageKey))
+	}
+	if err := s.storage.DeleteObject(ctx, ticket.QuarantineKey); err != nil {
+		s.audit.Warn("Failed to remove released object from quarantine", zap.Error(err), zap.String("key", ticket.QuarantineKey))
+	}
+
+	imageURL, err := s.storage.PresignGetURL(ctx, ticket.ImageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign released object: %w", err)
+	}
+	expiresAt := time.Now().Add(s.storage.PresignExpiry())
+
+	if err := s.jiraService.ReleaseScreenshot(ctx, ticketID, imageURL, ticket.ImageContentType); err != nil {
+		return nil, err
+	}
+	if err := s.mongoService.UpdateTicketImageURL(ctx, ticketID, ticket.ImageKey, imageURL, expiresAt); err != nil {
+		return nil, err
+	}
+	if err := s.mongoService.UpdateTicketAttachmentStatus(ctx, ticketID, AttachmentStatusReleased, ""); err != nil {
+		return nil, err
+	}
+	if err := s.mongoService.UpdateAttachmentObject(ctx, ticketID, ticket.QuarantineKey, ticket.ImageKey, AttachmentStatusReleased); err != nil {
+		s.audit.Warn("Failed to update released attachment", zap.Error(err), zap.String("ticket_id", ticketID))
+	}
+
+	s.audit.Info("Quarantined attachment released",
+		zap.String("event", "quarantine_released"),
+		zap.String("ticket_id", ticketID),
+		zap.String("key", ticket.ImageKey),
+		zap.String("reviewer", reviewer),
+	)
+
+	ticket.ImageURL = imageURL
+	ticket.ImageURLExpiresAt = expiresAt
+	ticket.AttachmentStatus = AttachmentStatusReleased
+	ticket.QuarantineKey = ""
+	return ticket, nil
+}
+
+// Purge deletes a quarantined attachment and notes the removal on the ticket
+func (s *QuarantineService) Purge(ctx context.Context, ticketID, reviewer string) error {
+	ticket, err := s.quarantinedTicket(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	ctx = WithTenant(ctx, ticket.Tenant)
+
+	if err := s.storage.DeleteObject(ctx, ticket.QuarantineKey); err != nil {
+		return fmt.Errorf("failed to purge quarantined object: %w", err)
+	}
+	if err := s.jiraService.RemoveScreenshot(ctx, ticketID); err != nil {
+		return err
+	}
+	if err := s.mongoService.UpdateTicketAttachmentStatus(ctx, ticketID, AttachmentStatusPurged, ""); err != nil {
+		return err
+	}
+	if err := s.mongoService.UpdateAttachmentObject(ctx, ticketID, ticket.QuarantineKey, ticket.QuarantineKey, AttachmentStatusPurged); err != nil {
+		s.audit.Warn("Failed to update purged attachment", zap.Error(err), zap.String("ticket_id", ticketID))
+	}
+
+	s.audit.Info("Quarantined attachment purged",
+		zap.String("event", "quarantine_purged"),
+		zap.String("ticket_id", ticketID),
+		zap.String("key", ticket.QuarantineKey),
+		zap.String("reviewer", reviewer),
+	)
+
+	return nil
+}
+
+// quarantinedTicket loads a ticket and checks that its attachment is pending review
+func (s *QuarantineService) quarantinedTicket(ctx context.Context, ticketID string) (*FlattenedTicket, error) {
+	if s.mongoService == nil {
+		return nil, errors.New("MongoDB is not configured")
+	}
+
+	ticket, err := s.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.AttachmentStatus != AttachmentStatusQuarantined || ticket.QuarantineKey == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotQuarantined, ticketID)
+	}
+
+	return ticket, nil
+}
+
+// withQuarantineTag returns a copy of tags marked as quarantined
+func withQuarantineTag(tags map[string]string) map[string]string {
+	tagged := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		tagged[k] = v
+	}
+	tagged[TagQuarantined] = "true"
+	return tagged
+}
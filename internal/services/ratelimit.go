@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Rate limiter backends
+const (
+	RateLimitBackendMemory = "memory"
+	RateLimitBackendRedis  = "redis"
+)
+
+// RateLimitResult is the outcome of taking a token from a client's bucket
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token when not allowed
+	RetryAfter time.Duration
+}
+
+// RateLimiter limits requests per client with token buckets that hold up to
+// burst tokens and refill at a steady rate
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (RateLimitResult, error)
+	// Limit returns the number of requests a client can make at once
+	Limit() int
+	// SetLimits changes the requests allowed per period and the burst size;
+	// buckets keep their tokens, up to the new burst
+	SetLimits(requests int, period time.Duration, burst int)
+}
+
+// tokenBucket is a client's bucket in MemoryRateLimiter
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryRateLimiter keeps the buckets in memory, so each instance limits
+// clients separately
+type MemoryRateLimiter struct {
+	rate  float64 // tokens per second
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimiter allows requests per period in bursts of up to burst
+func NewMemoryRateLimiter(requests int, period time.Duration, burst int) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		rate:      float64(requests) / period.Seconds(),
+		burst:     burst,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of key
+func (l *MemoryRateLimiter) Allow(_ context.Context, key string) (RateLimitResult, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(l.burst), bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	return takeToken(&bucket.tokens, l.rate), nil
+}
+
+// Limit returns the burst size
+func (l *MemoryRateLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.burst
+}
+
+// SetLimits changes the requests allowed per period and the burst size
+func (l *MemoryRateLimiter) SetLimits(requests int, period time.Duration, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(requests) / period.Seconds()
+	l.burst = burst
+}
+
+// sweep drops the buckets that have refilled completely, at most once per
+// refill time
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	refill := time.Duration(float64(l.burst) / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// takeToken takes a token from a bucket if one is left
+func takeToken(tokens *float64, rate float64) RateLimitResult {
+	if *tokens >= 1 {
+		*tokens--
+		return RateLimitResult{Allowed: true, Remaining: int(*tokens)}
+	}
+	return RateLimitResult{RetryAfter: time.Duration((1 - *tokens) / rate * float64(time.Second))}
+}
+
+// tokenBucketScript refills and takes from a bucket atomically, using the
+// Redis clock so instances with skewed clocks share buckets correctly
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimiter keeps the buckets in Redis, so clients are limited across
+// all instances
+type RedisRateLimiter struct {
+	client *redis.Client
+	prefix string
+	limits atomic.Pointer[redisRateLimits]
+}
+
+// redisRateLimits are the limits of RedisRateLimiter, replaced as a whole
+type redisRateLimits struct {
+	rate  float64 // tokens per second
+	burst int
+}
+
+// NewRedisRateLimiter allows requests per period in bursts of up to burst,
+// storing buckets under keys starting with prefix
+func NewRedisRateLimiter(client *redis.Client, prefix string, requests int, period time.Duration, burst int) *RedisRateLimiter {
+	l := &RedisRateLimiter{client: client, prefix: prefix}
+	l.SetLimits(requests, period, burst)
+	return l
+}
+
+// Allow takes a token from the bucket of key
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	limits := l.limits.Load()
+	reply, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key}, limits.rate, limits.burst).Slice()
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if len(reply) != 2 {
+		return RateLimitResult{}, fmt.Errorf("failed to check rate limit: unexpected reply %v", reply)
+	}
+
+	tokens, err := strconv.ParseFloat(fmt.Sprint(reply[1]), 64)
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if allowed, _ := reply[0].(int64); allowed == 1 {
+		return RateLimitResult{Allowed: true, Remaining: int(tokens)}, nil
+	}
+	return RateLimitResult{RetryAfter: time.Duration((1 - tokens) / limits.rate * float64(time.Second))}, nil
+}
+
+// Limit returns the burst size
+func (l *RedisRateLimiter) Limit() int {
+	return l.limits.Load().burst
+}
+
+// SetLimits changes the requests allowed per period and the burst size
+func (l *RedisRateLimiter) SetLimits(requests int, period time.Duration, burst int) {
+	l.limits.Store(&redisRateLimits{rate: float64(requests) / period.Seconds(), burst: burst})
+}
@@ -0,0 +1,516 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RedactedText replaces redacted values
+const RedactedText = "[REDACTED]"
+
+// Built-in detectors of sensitive values in free text
+const (
+	DetectorCard    = "card"    // payment card numbers passing the Luhn check
+	DetectorAadhaar = "aadhaar" // Aadhaar numbers passing the Verhoeff check
+	DetectorPAN     = "pan"     // Indian permanent account numbers
+	DetectorBearer  = "bearer"  // Bearer and Basic credentials
+	DetectorJWT     = "jwt"     // JSON web tokens
+)
+
+// DetectorNone disables the built-in detectors
+const DetectorNone = "none"
+
+// RedactionRule replaces sensitive values in reports. Pattern rules replace
+// the matches of a regular expression in any text. Path rules replace the
+// values a JSONPath selects, such as $..password or
+// $..requestData.body.cardNumber; paths are matched against the report
+// payload and every JSON document embedded in it as a string, such as the
+// failed network calls.
+type RedactionRule struct {
+	Name        string
+	Pattern     string
+	Path        string
+	Replacement string
+}
+
+// textRule replaces the matches of a pattern, optionally only those passing
+// a checksum
+type textRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+	valid       func(match string) bool
+}
+
+// pathRule replaces the values a JSONPath selects
+type pathRule struct {
+	steps       []pathStep
+	replacement string
+}
+
+// Redactor removes credentials and personal data from reports before they
+// are written to Jira, MongoDB, object storage or logs. Values of denied
+// headers, and of keys with the same names anywhere in a payload, are
+// replaced entirely; text is scanned by detectors and pattern rules. A nil
+// Redactor leaves everything unchanged.
+type Redactor struct {
+	headers map[string]bool // lowercase names
+	text    []textRule
+	paths   []pathRule
+}
+
+// builtinDetectors are the text rules of the built-in detectors
+var builtinDetectors = map[string]textRule{
+	DetectorCard:    {pattern: regexp.MustCompile(`\b[2-6](?:[ -]?\d){12,18}\b`), replacement: RedactedText, valid: luhnValid},
+	DetectorAadhaar: {pattern: regexp.MustCompile(`\b[2-9]\d{3}[ -]?\d{4}[ -]?\d{4}\b`), replacement: RedactedText, valid: verhoeffValid},
+	DetectorPAN:     {pattern: regexp.MustCompile(`\b[A-Z]{3}[ABCFGHJLPT][A-Z]\d{4}[A-Z]\b`), replacement: RedactedText},
+	DetectorBearer:  {pattern: regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]{8,}=*`), replacement: "$1 " + RedactedText},
+	DetectorJWT:     {pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]*`), replacement: RedactedText},
+}
+
+// detectorOrder applies credentials before numbers, so digits inside tokens
+// are not mistaken for card numbers
+var detectorOrder = []string{DetectorBearer, DetectorJWT, DetectorCard, DetectorAadhaar, DetectorPAN}
+
+// NewRedactor creates a redactor that denies the named headers and applies
+// the built-in detectors and rules
+func NewRedactor(headers, detectors []string, rules []RedactionRule) (*Redactor, error) {
+	r := &Redactor{headers: make(map[string]bool, len(headers))}
+
+	var names []string
+	for _, header := range headers {
+		if header = strings.TrimSpace(header); header != "" {
+			r.headers[strings.ToLower(header)] = true
+			names = append(names, regexp.QuoteMeta(header))
+		}
+	}
+	if len(names) > 0 {
+		// Headers in raw text, as "Name: value" lines and as JSON that was
+		// truncated and no longer parses
+		alternatives := strings.Join(names, "|")
+		r.text = append(r.text,
+			textRule{pattern: regexp.MustCompile(`(?im)^([ \t]*(?:` + alternatives + `)[ \t]*:[ \t]*)[^\r\n]*`), replacement: "${1}" + RedactedText},
+			textRule{pattern: regexp.MustCompile(`(?i)("(?:` + alternatives + `)"\s*:\s*")(?:[^"\\]|\\.)*"?`), replacement: "${1}" + RedactedText + `"`},
+		)
+	}
+
+	enabled := make(map[string]bool, len(detectors))
+	for _, name := range detectors {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := builtinDetectors[name]; !ok && name != DetectorNone && name != "" {
+			return nil, fmt.Errorf("unknown redaction detector %q", name)
+		}
+		enabled[name] = true
+	}
+	for _, name := range detectorOrder {
+		if enabled[name] && !enabled[DetectorNone] {
+			r.text = append(r.text, builtinDetectors[name])
+		}
+	}
+
+	for _, rule := range rules {
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = RedactedText
+		}
+		if (rule.Pattern == "") == (rule.Path == "") {
+			return nil, fmt.Errorf("redaction rule %s needs either a pattern or a path", rule.Name)
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern of redaction rule %s: %w", rule.Name, err)
+			}
+			r.text = append(r.text, textRule{pattern: pattern, replacement: replacement})
+			continue
+		}
+		steps, err := parseJSONPath(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of redaction rule %s: %w", rule.Name, err)
+		}
+		r.paths = append(r.paths, pathRule{steps: steps, replacement: replacement})
+	}
+	return r, nil
+}
+
+// String redacts text, which may be a JSON document
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	if !looksLikeJSON(s) {
+		return r.redactText(s)
+	}
+	redacted, _ := r.Value(s).(string)
+	return redacted
+}
+
+// StringMap returns a redacted copy of headers or other string pairs
+func (r *Redactor) StringMap(values map[string]string) map[string]string {
+	if r == nil || values == nil {
+		return values
+	}
+	redacted := make(map[string]string, len(values))
+	for key, value := range values {
+		if r.headers[strings.ToLower(key)] {
+			redacted[key] = RedactedText
+		} else {
+			redacted[key] = r.String(value)
+		}
+	}
+	return redacted
+}
+
+// Value returns a redacted copy of a value that marshals to JSON. Structs
+// come back as generic maps and slices.
+func (r *Redactor) Value(v interface{}) interface{} {
+	if r == nil || v == nil {
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return v
+	}
+
+	doc := r.applyPaths(r.decode(generic))
+	return r.redact(doc)
+}
+
+// Ticket returns a copy of a ticket request with its payload, response,
+// headers and URL redacted
+func (r *Redactor) Ticket(req *models.TicketRequest) *models.TicketRequest {
+	if r == nil {
+		return req
+	}
+	redacted := *req
+	redacted.URL = r.String(req.URL)
+	redacted.Payload, _ = r.Value(req.Payload).(map[string]interface{})
+	redacted.Response, _ = r.Value(req.Response).(map[string]interface{})
+	redacted.RequestHeaders = r.StringMap(req.RequestHeaders)
+	return &redacted
+}
+
+// WrapCore redacts the messages and fields of the log entries written to
+// core; use it with zap.WrapCore
+func (r *Redactor) WrapCore(core zapcore.Core) zapcore.Core {
+	if r == nil {
+		return core
+	}
+	return &redactingCore{Core: core, redactor: r}
+}
+
+func (r *Redactor) redactText(s string) string {
+	for _, rule := range r.text {
+		if rule.valid == nil {
+			s = rule.pattern.ReplaceAllString(s, rule.replacement)
+			continue
+		}
+		s = rule.pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if !rule.valid(match) {
+				return match
+			}
+			return rule.pattern.ReplaceAllString(match, rule.replacement)
+		})
+	}
+	return s
+}
+
+// embeddedJSON is a JSON document found in a string, decoded so it can be
+// redacted like the rest of the payload and encoded back afterwards
+type embeddedJSON struct {
+	value interface{}
+}
+
+func looksLikeJSON(s string) bool {
+	s = strings.TrimSpace(s)
+	return len(s) >= 2 && (s[0] == '{' || s[0] == '[')
+}
+
+// decode replaces strings holding JSON documents with their content, with
+// the path rules applied to each document
+func (r *Redactor) decode(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			node[key] = r.decode(child)
+		}
+	case []interface{}:
+		for i, child := range node {
+			node[i] = r.decode(child)
+		}
+	case string:
+		if !looksLikeJSON(node) {
+			return node
+		}
+		decoder := json.NewDecoder(strings.NewReader(node))
+		decoder.UseNumber()
+		var doc interface{}
+		if err := decoder.Decode(&doc); err != nil || decoder.More() {
+			return node
+		}
+		return embeddedJSON{value: r.applyPaths(r.decode(doc))}
+	}
+	return v
+}
+
+func (r *Redactor) applyPaths(doc interface{}) interface{} {
+	for _, rule := range r.paths {
+		doc = replacePath(doc, rule.steps, rule.replacement)
+	}
+	return doc
+}
+
+// redact applies the header and text rules, and encodes embedded documents
+// back to strings
+func (r *Redactor) redact(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			if r.headers[strings.ToLower(key)] {
+				node[key] = RedactedText
+			} else {
+				node[key] = r.redact(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range node {
+			node[i] = r.redact(child)
+		}
+	case string:
+		return r.redactText(node)
+	case json.Number:
+		// Card and Aadhaar numbers sent as JSON numbers
+		if text := r.redactText(node.String()); text != node.String() {
+			return text
+		}
+	case embeddedJSON:
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(r.redact(node.value)); err != nil {
+			return RedactedText
+		}
+		return strings.TrimSuffix(buf.String(), "\n")
+	}
+	return v
+}
+
+// pathStep is a step of a JSONPath
+type pathStep struct {
+	descend bool   // ..name, matched at any depth
+	key     string // object key; "*" matches every key and index
+	index   int    // array index, or -1
+}
+
+// parseJSONPath parses the JSONPath subset of child (.name, ['name']),
+// wildcard (.*, [*]), index ([0]) and recursive descent (..name) steps
+func parseJSONPath(path string) ([]pathStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("%q must start with $", path)
+	}
+
+	var steps []pathStep
+	for rest != "" {
+		step := pathStep{index: -1}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.descend = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "["):
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", rest, path)
+		}
+
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", path)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case selector == "*":
+				step.key = "*"
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				step.key = selector[1 : len(selector)-1]
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid selector [%s] in %q", selector, path)
+				}
+				step.index = index
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			step.key, rest = rest[:end], rest[end:]
+			if step.key == "" {
+				return nil, fmt.Errorf("empty name in %q", path)
+			}
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("%q selects the whole document", path)
+	}
+	return steps, nil
+}
+
+// replacePath replaces the values steps select in node
+func replacePath(node interface{}, steps []pathStep, replacement string) interface{} {
+	if len(steps) == 0 {
+		return replacement
+	}
+	if embedded, ok := node.(embeddedJSON); ok {
+		embedded.value = replacePath(embedded.value, steps, replacement)
+		return embedded
+	}
+
+	step := steps[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, child := range n {
+			if step.key == "*" || (step.index < 0 && step.key == key) {
+				child = replacePath(child, steps[1:], replacement)
+			}
+			if step.descend {
+				child = replacePath(child, steps, replacement)
+			}
+			n[key] = child
+		}
+	case []interface{}:
+		for i, child := range n {
+			if step.key == "*" || step.index == i {
+				child = replacePath(child, steps[1:], replacement)
+			}
+			if step.descend {
+				child = replacePath(child, steps, replacement)
+			}
+			n[i] = child
+		}
+	}
+	return node
+}
+
+// luhnValid reports whether the digits of a match pass the Luhn check of
+// payment card numbers
+func luhnValid(match string) bool {
+	digits := onlyDigits(match)
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// Verhoeff tables of the dihedral group D5
+var (
+	verhoeffMultiply = [10][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffPermute = [8][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// verhoeffValid reports whether the digits of a match pass the Verhoeff
+// check of Aadhaar numbers
+func verhoeffValid(match string) bool {
+	digits := onlyDigits(match)
+	check := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		check = verhoeffMultiply[check][verhoeffPermute[i%8][d]]
+	}
+	return check == 0
+}
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// redactingCore redacts log entries before they reach the wrapped core
+type redactingCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.fields(fields)), redactor: c.redactor}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.redactor.String(entry.Message)
+	return c.Core.Write(entry, c.fields(fields))
+}
+
+// fields returns redacted copies of string, error and reflected fields
+func (c *redactingCore) fields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = c.redactor.String(field.String)
+		case zapcore.ErrorType:
+			if err, ok := field.Interface.(error); ok {
+				field = zap.String(field.Key, c.redactor.String(err.Error()))
+			}
+		case zapcore.ReflectType:
+			field = zap.Any(field.Key, c.redactor.Value(field.Interface))
+		}
+		redacted[i] = field
+	}
+	return redacted
+}
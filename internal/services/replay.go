@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// ReplayFixture is a report as it was submitted, with what the server added
+// to it, and the Jira title and description it was rendered as. Replaying
+// it through the current description builder shows what a change to the
+// builder does to real reports, without filing anything.
+type ReplayFixture struct {
+	// Name is the file name the fixture is kept under, without extension
+	Name      string        `json:"-"`
+	RequestID string        `json:"requestId,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Report    ReplayReport  `json:"report"`
+	Rendered  ReplayOutput  `json:"rendered"`
+	Source    *ReplaySource `json:"source,omitempty"`
+}
+
+// ReplayReport is a ticket request with the fields the server sets, which
+// are not part of the request body
+type ReplayReport struct {
+	URL              string                 `json:"url"`
+	Payload          map[string]interface{} `json:"payload"`
+	Response         map[string]interface{} `json:"response,omitempty"`
+	RequestHeaders   map[string]string      `json:"requestHeaders,omitempty"`
+	ImageS3URL       string                 `json:"imageS3URL,omitempty"`
+	ImageS3Key       string                 `json:"imageS3Key,omitempty"`
+	ImageContentType string                 `json:"imageContentType,omitempty"`
+	QuarantineKey    string                 `json:"quarantineKey,omitempty"`
+	Video            *models.VideoMetadata  `json:"video,omitempty"`
+	Runbooks         []models.RunbookLink   `json:"runbooks,omitempty"`
+	Deploys          []models.Deploy        `json:"deploys,omitempty"`
+	Summary          *models.ReportSummary  `json:"summary,omitempty"`
+	Classification   *models.Classification `json:"classification,omitempty"`
+}
+
+// ReplayOutput is what the description builder rendered for a report
+type ReplayOutput struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Overflow is the comment with the details cut from the description
+	Overflow string `json:"overflow,omitempty"`
+}
+
+// ReplaySource is the stored ticket a fixture was recorded from
+type ReplaySource struct {
+	TicketID string `json:"ticketId"`
+	// Partial is set when the stored ticket lacked parts of the report,
+	// such as the response and request headers, which are not stored
+	Partial bool `json:"partial,omitempty"`
+}
+
+// request returns the ticket request of the report
+func (r *ReplayReport) request() *models.TicketRequest {
+	return &models.TicketRequest{
+		URL:              r.URL,
+		Payload:          r.Payload,
+		Response:         r.Response,
+		RequestHeaders:   r.RequestHeaders,
+		ImageS3URL:       r.ImageS3URL,
+		ImageS3Key:       r.ImageS3Key,
+		QuarantineKey:    r.QuarantineKey,
+		ImageContentType: r.ImageContentType,
+		Video:            r.Video,
+		Runbooks:         r.Runbooks,
+		Deploys:          r.Deploys,
+		Summary:          r.Summary,
+		Classification:   r.Classification,
+	}
+}
+
+// Replay renders the report of a fixture through the current description
+// builder, as it would be filed in Jira now, titled with titles when it is
+// not nil
+func (f *ReplayFixture) Replay(titles *TitleTemplate) ReplayOutput {
+	req := f.Report.request()
+	if titles != nil {
+		req.Title = titles.Render(req)
+	}
+	description, overflow := ticketDescription(req, f.RequestID, f.CreatedAt)
+	return ReplayOutput{Title: ticketTitle(req), Description: description, Overflow: overflow}
+}
+
+// StoredTicketFixture records a fixture from a stored ticket, rendered by
+// the current description builder. Only the payload, screenshot and
+// classification of a report are stored with its ticket, so the fixture is
+// partial: the response, request headers, summary, runbooks and deploys of
+// the report are missing. Its title is rendered with titles when not nil.
+func StoredTicketFixture(ticket *FlattenedTicket, titles *TitleTemplate) (*ReplayFixture, error) {
+	payload := make(map[string]interface{})
+	if ticket.PayloadJSON != "" {
+		if err := json.Unmarshal([]byte(ticket.PayloadJSON), &payload); err != nil {
+			return nil, fmt.Errorf("failed to decode payload of %s: %w", ticket.TicketID, err)
+		}
+	}
+	report := ReplayReport{
+		URL:              ticket.PageURL,
+		Payload:          payload,
+		ImageS3URL:       ticket.ImageURL,
+		ImageS3Key:       ticket.ImageKey,
+		ImageContentType: ticket.ImageContentType,
+		QuarantineKey:    ticket.QuarantineKey,
+		Video:            ticket.Video,
+	}
+	if ticket.ClassifiedBy != "" {
+		report.Classification = &models.Classification{
+			Category:     ticket.Category,
+			Severity:     ticket.Severity,
+			ClassifiedBy: ticket.ClassifiedBy,
+		}
+	}
+	fixture := &ReplayFixture{
+		Name:      ticket.TicketID,
+		RequestID: ticket.RequestID,
+		CreatedAt: ticket.CreatedAt.UTC(),
+		Report:    report,
+		Source:    &ReplaySource{TicketID: ticket.TicketID, Partial: true},
+	}
+	fixture.Rendered = fixture.Replay(titles)
+	return fixture, nil
+}
+
+// LoadReplayFixtures reads the fixtures kept in dir as JSON files, by name
+func LoadReplayFixtures(dir string) ([]*ReplayFixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	fixtures := make([]*ReplayFixture, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+		var fixture ReplayFixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			return nil, fmt.Errorf("failed to decode fixture %s: %w", path, err)
+		}
+		fixture.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		fixtures = append(fixtures, &fixture)
+	}
+	return fixtures, nil
+}
+
+// SaveReplayFixture writes a fixture to dir, under its name
+func SaveReplayFixture(dir string, fixture *ReplayFixture) error {
+	// Descriptions are kept readable, with their markup unescaped
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(fixture); err != nil {
+		return fmt.Errorf("failed to encode fixture %s: %w", fixture.Name, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create fixtures directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fixture.Name+".json"), data.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Supported values for the REPORT_QUEUE_BACKEND setting
+const (
+	ReportQueueBackendMemory   = "memory"
+	ReportQueueBackendSQS      = "sqs"
+	ReportQueueBackendRabbitMQ = "rabbitmq"
+)
+
+// reportStatusesCollection is the collection the statuses of brokered
+// reports are shared in
+const reportStatusesCollection = "report_statuses"
+
+// unfinishedStatusTTL is how long the status of a brokered report is kept
+// while it is queued or processing
+const unfinishedStatusTTL = 24 * time.Hour
+
+// brokerRetryInterval is how long consumers wait after failing to receive
+const brokerRetryInterval = 5 * time.Second
+
+// reportStatusWriteTimeout bounds sharing a report status, which outlives
+// the request or job that changed it
+const reportStatusWriteTimeout = 5 * time.Second
+
+// BrokerMessage is a job received from a ReportBroker, to be acknowledged
+// once it is done with
+type BrokerMessage struct {
+	Body []byte
+	// receipt identifies the delivery to the broker
+	receipt string
+}
+
+// ReportBroker is a message queue report jobs are sent through, so any
+// instance can process them and they survive restarts. Jobs that are
+// received and not acknowledged are delivered again.
+type ReportBroker interface {
+	// Name is the broker's display name, e.g. SQS
+	Name() string
+	// Send queues a job, to be delivered after delay
+	Send(ctx context.Context, body []byte, delay time.Duration) error
+	// Receive waits briefly for jobs, returning none when there are none
+	Receive(ctx context.Context) ([]BrokerMessage, error)
+	// Ack removes a received job from the queue
+	Ack(ctx context.Context, message BrokerMessage) error
+	// DeadLetter sends a job that exhausted its attempts to the dead-letter
+	// queue
+	DeadLetter(ctx context.Context, body []byte) error
+	Close() error
+}
+
+// UseBroker makes the queue send reports submitted with SubmitJob through
+// broker, to be processed by the workers of any instance with the resumer of
+// their kind. A failed report is sent again after backoff, doubling with
+// every attempt, and to the dead-letter queue after maxAttempts; unlike
+// local reports it is redriven with the broker's own tools rather than
+// Retry, or with RetryStored when failures are stored. Statuses are shared through mongoService when it is not nil, and
+// otherwise only known to the instance that submitted or processed the
+// report. UseBroker must be called before Run.
+func (q *ReportQueue) UseBroker(broker ReportBroker, maxAttempts int, backoff time.Duration, mongoService *MongoDBService) {
+	q.broker = broker
+	q.maxAttempts = maxAttempts
+	q.retryBackoff = backoff
+	q.mongoService = mongoService
+}
+
+// Brokered reports whether reports are sent through a broker
+func (q *ReportQueue) Brokered() bool {
+	return q.broker != nil
+}
+
+// SubmitJob sends a report to the broker as a job of a kind with a JSON
+// payload, and returns its initial status
+func (q *ReportQueue) SubmitJob(ctx context.Context, kind string, payload interface{}) (*models.ReportStatus, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report: %w", err)
+	}
+	job := ReportJob{ID: uuid.NewString(), Kind: kind, Payload: raw, CreatedAt: time.Now().UTC()}
+	body, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	// Recorded first, so it cannot overwrite the status of a worker that
+	// already received the job
+	status := jobStatus(job, ReportStatusQueued)
+	q.record(ctx, status)
+	if err := q.broker.Send(ctx, body, 0); err != nil {
+		q.mu.Lock()
+		delete(q.statuses, job.ID)
+		q.mu.Unlock()
+		return nil, fmt.Errorf("%w: %w", ErrReportBrokerUnavailable, err)
+	}
+	return status, nil
+}
+
+// consume processes jobs received from the broker until stopping is closed.
+// The job being processed is finished first; jobs received but not started
+// are left for the broker to deliver again.
+func (q *ReportQueue) consume(ctx context.Context, stopping <-chan struct{}) {
+	receiveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stopping:
+			cancel()
+		case <-receiveCtx.Done():
+		}
+	}()
+
+	for receiveCtx.Err() == nil {
+		// Jobs are left in the broker while paused
+		if !q.waitUnpaused(stopping) {
+			return
+		}
+		messages, err := q.broker.Receive(receiveCtx)
+		if err != nil {
+			if receiveCtx.Err() != nil {
+				return
+			}
+			q.logger.Warn("Failed to receive reports", zap.String("broker", q.broker.Name()), zap.Error(err))
+			select {
+			case <-receiveCtx.Done():
+			case <-time.After(brokerRetryInterval):
+			}
+			continue
+		}
+		for _, message := range messages {
+			if receiveCtx.Err() != nil {
+				return
+			}
+			q.handle(ctx, message)
+		}
+	}
+}
+
+// handle processes a job received from the broker
+func (q *ReportQueue) handle(ctx context.Context, message BrokerMessage) {
+	var job ReportJob
+	if err := json.Unmarshal(message.Body, &job); err != nil {
+		q.logger.Error("Received a malformed report job", zap.String("broker", q.broker.Name()), zap.Error(err))
+		if err := q.broker.DeadLetter(ctx, message.Body); err == nil {
+			q.ack(ctx, message)
+		}
+		return
+	}
+
+	q.mu.Lock()
+	resume := q.resumers[job.Kind]
+	q.mu.Unlock()
+	if resume == nil {
+		q.fail(ctx, message, job, fmt.Errorf("unknown report kind %q", job.Kind), false)
+		return
+	}
+
+	q.record(ctx, jobStatus(job, ReportStatusProcessing))
+	task, release, err := resume(job.Payload)
+	if err != nil {
+		q.fail(ctx, message, job, err, true)
+		return
+	}
+	response, err := task(ctx)
+	// Resources of brokered reports are local copies, released after every
+	// attempt
+	if release != nil {
+		release()
+	}
+	if err != nil {
+		var retryable interface{ Retryable() bool }
+		q.fail(ctx, message, job, err, !errors.As(err, &retryable) || retryable.Retryable())
+		return
+	}
+
+	status := jobStatus(job, ReportStatusCompleted)
+	status.TicketID = response.TicketID
+	status.JiraLink = response.JiraLink
+	status.StatusURL = response.StatusURL
+	status.SimilarTickets = response.SimilarTickets
+	q.record(ctx, status)
+	q.ack(ctx, message)
+}
+
+// fail sends a failed job back to the broker to be retried after a backoff,
+// or to the dead-letter queue once it ran out of attempts or cannot succeed.
+// The job is left unacknowledged, to be delivered again, when neither works.
+func (q *ReportQueue) fail(ctx context.Context, message BrokerMessage, job ReportJob, err error, retry bool) {
+	job.Attempts++
+	job.Error = err.Error()
+	body, encodeErr := json.Marshal(job)
+	if encodeErr != nil {
+		q.logger.Error("Failed to encode report job", zap.String("report_id", job.ID), zap.Error(encodeErr))
+		return
+	}
+
+	status := jobStatus(job, ReportStatusFailed)
+	status.Error = err.Error()
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) {
+		status.Code = coded.ErrorCode()
+	}
+
+	log := q.logger.With(zap.String("report_id", job.ID), zap.Int("attempts", job.Attempts), zap.Error(err))
+	if retry && job.Attempts < q.maxAttempts {
+		delay := q.retryBackoff << min(job.Attempts-1, 16)
+		if err := q.broker.Send(ctx, body, delay); err != nil {
+			log.Error("Failed to queue report for retry", zap.NamedError("send_error", err))
+			return
+		}
+		status.Status = ReportStatusQueued
+		log.Warn("Failed to process report, retrying", zap.Duration("delay", delay))
+	} else {
+		if err := q.broker.DeadLetter(ctx, body); err != nil {
+			log.Error("Failed to dead-letter report", zap.NamedError("send_error", err))
+			return
+		}
+		log.Error("Failed to process report, sent to the dead-letter queue")
+		q.keepJob(ctx, job, status)
+	}
+
+	q.record(ctx, status)
+	q.ack(ctx, message)
+}
+
+func (q *ReportQueue) ack(ctx context.Context, message BrokerMessage) {
+	if err := q.broker.Ack(ctx, message); err != nil {
+		q.logger.Warn("Failed to acknowledge report job, it will be delivered again",
+			zap.String("broker", q.broker.Name()), zap.Error(err))
+	}
+}
+
+// record keeps the status of a brokered report, and shares it in MongoDB
+func (q *ReportQueue) record(ctx context.Context, status *models.ReportStatus) {
+	q.mu.Lock()
+	copied := *status
+	q.statuses[status.ID] = &copied
+	q.mu.Unlock()
+
+	if q.mongoService == nil {
+		return
+	}
+	expiresAt := status.UpdatedAt.Add(unfinishedStatusTTL)
+	if status.Status == ReportStatusCompleted || status.Status == ReportStatusFailed {
+		expiresAt = status.UpdatedAt.Add(q.statusTTL)
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportStatusWriteTimeout)
+	defer cancel()
+	if err := q.mongoService.SaveReportStatus(ctx, status, expiresAt); err != nil {
+		q.logger.Warn("Failed to share report status", zap.String("report_id", status.ID), zap.Error(err))
+	}
+}
+
+func jobStatus(job ReportJob, state string) *models.ReportStatus {
+	return &models.ReportStatus{
+		ID:        job.ID,
+		Status:    state,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: time.Now().UTC(),
+	}
+}
+
+// reportStatusRecord is the shared status of a brokered report
+type reportStatusRecord struct {
+	ID        string              `bson:"_id"`
+	Status    models.ReportStatus `bson:"status"`
+	ExpiresAt time.Time           `bson:"expires_at"`
+}
+
+// SaveReportStatus shares the status of a report until expiresAt
+func (s *MongoDBService) SaveReportStatus(ctx context.Context, status *models.ReportStatus, expiresAt time.Time) error {
+	record := reportStatusRecord{ID: status.ID, Status: *status, ExpiresAt: expiresAt}
+	_, err := s.reportStatuses.ReplaceOne(ctx, bson.M{"_id": status.ID}, record, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save report status: %w", err)
+	}
+	return nil
+}
+
+// GetReportStatus retrieves the shared status of a report
+func (s *MongoDBService) GetReportStatus(ctx context.Context, id string) (*models.ReportStatus, error) {
+	var record reportStatusRecord
+	if err := s.reportStatuses.FindOne(ctx, bson.M{"_id": id}).Decode(&record); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrReportNotFound
+		}
+		return nil, fmt.Errorf("failed to get report status: %w", err)
+	}
+	// Expired records linger until MongoDB's next TTL pass
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrReportNotFound
+	}
+	return &record.Status, nil
+}
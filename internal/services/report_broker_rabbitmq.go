@@ -0,0 +1,597 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AMQP 0-9-1 classes and methods the broker uses, as class<<16 | method
+const (
+	amqpConnectionStart   = 10<<16 | 10
+	amqpConnectionStartOk = 10<<16 | 11
+	amqpConnectionTune    = 10<<16 | 30
+	amqpConnectionTuneOk  = 10<<16 | 31
+	amqpConnectionOpen    = 10<<16 | 40
+	amqpConnectionOpenOk  = 10<<16 | 41
+	amqpConnectionClose   = 10<<16 | 50
+	amqpConnectionCloseOk = 10<<16 | 51
+	amqpChannelOpen       = 20<<16 | 10
+	amqpChannelOpenOk     = 20<<16 | 11
+	amqpChannelClose      = 20<<16 | 40
+	amqpQueueDeclare      = 50<<16 | 10
+	amqpQueueDeclareOk    = 50<<16 | 11
+	amqpBasicPublish      = 60<<16 | 40
+	amqpBasicGet          = 60<<16 | 70
+	amqpBasicGetOk        = 60<<16 | 71
+	amqpBasicGetEmpty     = 60<<16 | 72
+	amqpBasicAck          = 60<<16 | 80
+	amqpBasicNack         = 60<<16 | 120
+	amqpConfirmSelect     = 85<<16 | 10
+	amqpConfirmSelectOk   = 85<<16 | 11
+)
+
+// AMQP frame types
+const (
+	amqpFrameMethod    = 1
+	amqpFrameHeader    = 2
+	amqpFrameBody      = 3
+	amqpFrameHeartbeat = 8
+	amqpFrameEnd       = 0xCE
+)
+
+// amqpTimeout bounds one exchange with the broker, and amqpPollInterval is
+// how long Receive waits when the queue is empty
+const (
+	amqpTimeout      = 10 * time.Second
+	amqpPollInterval = time.Second
+	amqpMaxFrame     = 128 << 10
+)
+
+// errRequeuedDelivery is returned when acknowledging a job received on a
+// connection that was lost since, which the broker requeued
+var errRequeuedDelivery = errors.New("the job was requeued when the connection was lost")
+
+// RabbitMQBroker sends report jobs through a RabbitMQ queue. It speaks AMQP
+// 0-9-1 itself over a single channel, publishing persistent messages with
+// publisher confirms and polling the queue with basic.get. Jobs are delayed
+// through a retry queue whose expired messages are dead-lettered back to the
+// queue; RabbitMQ only expires messages at the head of a queue, so a job
+// never comes back before the jobs delayed ahead of it.
+type RabbitMQBroker struct {
+	address    string
+	tls        *tls.Config
+	username   string
+	password   string
+	vhost      string
+	queue      string
+	retryQueue string
+	deadLetter string
+
+	mu   sync.Mutex
+	conn *amqpConn
+	// generation counts connections, so deliveries of a lost connection,
+	// which the broker requeued, are not acknowledged on a new one
+	generation int
+}
+
+// NewRabbitMQBroker creates a broker of queue on the server at rawURL, an
+// amqp:// or amqps:// URL with credentials and an optional virtual host.
+// Jobs are dead-lettered to deadLetter. The queues are declared durable on
+// first use.
+func NewRabbitMQBroker(rawURL, queue, deadLetter string) (*RabbitMQBroker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RabbitMQ URL: %w", err)
+	}
+	b := &RabbitMQBroker{
+		username:   u.User.Username(),
+		vhost:      "/",
+		queue:      queue,
+		retryQueue: queue + ".retry",
+		deadLetter: deadLetter,
+	}
+	b.password, _ = u.User.Password()
+	if b.username == "" {
+		b.username, b.password = "guest", "guest"
+	}
+	if vhost := strings.TrimPrefix(u.Path, "/"); vhost != "" {
+		b.vhost = vhost
+	}
+
+	port := "5672"
+	switch u.Scheme {
+	case "amqp":
+	case "amqps":
+		port = "5671"
+		b.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return nil, fmt.Errorf("invalid RabbitMQ URL scheme %q", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	b.address = net.JoinHostPort(u.Hostname(), port)
+	return b, nil
+}
+
+// Name returns RabbitMQ
+func (b *RabbitMQBroker) Name() string {
+	return "RabbitMQ"
+}
+
+// Send publishes a job to the queue, or to the retry queue with the delay as
+// its expiration
+func (b *RabbitMQBroker) Send(ctx context.Context, body []byte, delay time.Duration) error {
+	if delay > 0 {
+		return b.publish(ctx, b.retryQueue, body, strconv.FormatInt(delay.Milliseconds(), 10))
+	}
+	return b.publish(ctx, b.queue, body, "")
+}
+
+// DeadLetter publishes a job to the dead-letter queue
+func (b *RabbitMQBroker) DeadLetter(ctx context.Context, body []byte) error {
+	return b.publish(ctx, b.deadLetter, body, "")
+}
+
+func (b *RabbitMQBroker) publish(ctx context.Context, queue string, body []byte, expiration string) error {
+	return b.do(ctx, func(c *amqpConn) error {
+		return c.publish(queue, body, expiration)
+	})
+}
+
+// Receive gets a job from the queue, waiting a second when there is none.
+// Received jobs are requeued by RabbitMQ when the connection is lost before
+// they are acknowledged.
+func (b *RabbitMQBroker) Receive(ctx context.Context) ([]BrokerMessage, error) {
+	var message *BrokerMessage
+	err := b.do(ctx, func(c *amqpConn) error {
+		tag, body, err := c.get(b.queue)
+		if err == nil && body != nil {
+			message = &BrokerMessage{Body: body, receipt: fmt.Sprintf("%d:%d", b.generation, tag)}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		select {
+		case <-ctx.Done():
+		case <-time.After(amqpPollInterval):
+		}
+		return nil, nil
+	}
+	return []BrokerMessage{*message}, nil
+}
+
+// Ack acknowledges a received job
+func (b *RabbitMQBroker) Ack(ctx context.Context, message BrokerMessage) error {
+	generation, tag, ok := strings.Cut(message.receipt, ":")
+	deliveryTag, err := strconv.ParseUint(tag, 10, 64)
+	if !ok || err != nil {
+		return fmt.Errorf("invalid RabbitMQ delivery %q", message.receipt)
+	}
+	return b.do(ctx, func(c *amqpConn) error {
+		if generation != strconv.Itoa(b.generation) {
+			return errRequeuedDelivery
+		}
+		return c.ack(deliveryTag)
+	})
+}
+
+// Close closes the connection, requeueing jobs that were not acknowledged
+func (b *RabbitMQBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.close()
+	b.conn = nil
+	return err
+}
+
+// do runs fn on the connection, connecting first when there is none. The
+// connection is dropped after a failure, and made again on the next call.
+func (b *RabbitMQBroker) do(ctx context.Context, fn func(*amqpConn) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		conn, err := b.connect(ctx)
+		if err != nil {
+			return err
+		}
+		b.conn = conn
+		b.generation++
+	}
+
+	deadline := time.Now().Add(amqpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	b.conn.conn.SetDeadline(deadline)
+	if err := fn(b.conn); err != nil {
+		if !errors.Is(err, errRequeuedDelivery) {
+			b.conn.conn.Close()
+			b.conn = nil
+		}
+		return fmt.Errorf("RabbitMQ: %w", err)
+	}
+	return nil
+}
+
+// connect opens a connection and a channel in confirm mode, and declares the
+// queues
+func (b *RabbitMQBroker) connect(ctx context.Context) (*amqpConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, amqpTimeout)
+	defer cancel()
+	var netConn net.Conn
+	var err error
+	if b.tls != nil {
+		dialer := &tls.Dialer{Config: b.tls}
+		netConn, err = dialer.DialContext(ctx, "tcp", b.address)
+	} else {
+		var dialer net.Dialer
+		netConn, err = dialer.DialContext(ctx, "tcp", b.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ at %s: %w", b.address, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+
+	c := &amqpConn{conn: netConn, r: bufio.NewReader(netConn), frameMax: amqpMaxFrame}
+	if err := c.open(b.username, b.password, b.vhost); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to open RabbitMQ connection: %w", err)
+	}
+	queues := []struct {
+		name string
+		args map[string]string
+	}{
+		{name: b.queue},
+		{name: b.deadLetter},
+		{name: b.retryQueue, args: map[string]string{"x-dead-letter-exchange": "", "x-dead-letter-routing-key": b.queue}},
+	}
+	for _, q := range queues {
+		if err := c.declare(q.name, q.args); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("failed to declare RabbitMQ queue %s: %w", q.name, err)
+		}
+	}
+	return c, nil
+}
+
+// amqpConn is an AMQP connection with one channel, used by one exchange at a
+// time
+type amqpConn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	frameMax int
+	// published counts published messages, whose confirms carry their number
+	published uint64
+}
+
+// open performs the connection handshake with PLAIN authentication and opens
+// channel 1 in confirm mode
+func (c *amqpConn) open(username, password, vhost string) error {
+	if _, err := c.conn.Write([]byte("AMQP\x00\x00\x09\x01")); err != nil {
+		return err
+	}
+	if _, err := c.expect(0, amqpConnectionStart); err != nil {
+		return err
+	}
+
+	var startOk kafkaEncoder
+	amqpTable(&startOk, map[string]string{"product": "ronnin"})
+	amqpShortString(&startOk, "PLAIN")
+	amqpLongString(&startOk, "\x00"+username+"\x00"+password)
+	amqpShortString(&startOk, "en_US")
+	if err := c.method(0, amqpConnectionStartOk, startOk.buf.Bytes()); err != nil {
+		return err
+	}
+
+	tune, err := c.expect(0, amqpConnectionTune)
+	if err != nil {
+		return err
+	}
+	channelMax := tune.int16()
+	if frameMax := int(tune.int32()); frameMax > 0 && frameMax < c.frameMax {
+		c.frameMax = frameMax
+	}
+	// Heartbeats are disabled, as the connection is idle between exchanges
+	var tuneOk kafkaEncoder
+	tuneOk.int16(channelMax)
+	tuneOk.int32(int32(c.frameMax))
+	tuneOk.int16(0)
+	if err := c.method(0, amqpConnectionTuneOk, tuneOk.buf.Bytes()); err != nil {
+		return err
+	}
+
+	var open kafkaEncoder
+	amqpShortString(&open, vhost)
+	amqpShortString(&open, "")
+	open.int8(0)
+	if err := c.method(0, amqpConnectionOpen, open.buf.Bytes()); err != nil {
+		return err
+	}
+	if _, err := c.expect(0, amqpConnectionOpenOk); err != nil {
+		return err
+	}
+
+	if err := c.method(1, amqpChannelOpen, []byte{0}); err != nil {
+		return err
+	}
+	if _, err := c.expect(1, amqpChannelOpenOk); err != nil {
+		return err
+	}
+	if err := c.method(1, amqpConfirmSelect, []byte{0}); err != nil {
+		return err
+	}
+	_, err = c.expect(1, amqpConfirmSelectOk)
+	return err
+}
+
+// declare declares a durable queue with arguments
+func (c *amqpConn) declare(queue string, args map[string]string) error {
+	var declare kafkaEncoder
+	declare.int16(0)
+	amqpShortString(&declare, queue)
+	declare.int8(0x02) // durable
+	amqpTable(&declare, args)
+	if err := c.method(1, amqpQueueDeclare, declare.buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := c.expect(1, amqpQueueDeclareOk)
+	return err
+}
+
+// publish publishes a persistent message to a queue through the default
+// exchange and waits for the broker to confirm it
+func (c *amqpConn) publish(queue string, body []byte, expiration string) error {
+	var publish kafkaEncoder
+	publish.int16(0)
+	amqpShortString(&publish, "")
+	amqpShortString(&publish, queue)
+	publish.int8(0)
+	if err := c.method(1, amqpBasicPublish, publish.buf.Bytes()); err != nil {
+		return err
+	}
+
+	// Content type, delivery mode and expiration properties
+	flags := uint16(0x8000 | 0x1000)
+	if expiration != "" {
+		flags |= 0x0100
+	}
+	var header kafkaEncoder
+	header.int16(60)
+	header.int16(0)
+	header.int64(int64(len(body)))
+	header.int16(int16(flags))
+	amqpShortString(&header, "application/json")
+	header.int8(2) // persistent
+	if expiration != "" {
+		amqpShortString(&header, expiration)
+	}
+	if err := c.frame(amqpFrameHeader, 1, header.buf.Bytes()); err != nil {
+		return err
+	}
+	for limit := c.frameMax - 8; len(body) > 0; {
+		chunk := body[:min(len(body), limit)]
+		if err := c.frame(amqpFrameBody, 1, chunk); err != nil {
+			return err
+		}
+		body = body[len(chunk):]
+	}
+	c.published++
+
+	for {
+		id, args, err := c.next(1)
+		if err != nil {
+			return err
+		}
+		if id != amqpBasicAck && id != amqpBasicNack {
+			return fmt.Errorf("unexpected method %d.%d", id>>16, id&0xFFFF)
+		}
+		tag := uint64(args.int64())
+		multiple := args.bool()
+		if tag != c.published && !(multiple && tag > c.published) {
+			// The confirm of an earlier message
+			continue
+		}
+		if id == amqpBasicNack {
+			return errors.New("the broker rejected the message")
+		}
+		return nil
+	}
+}
+
+// get gets a message from a queue without acknowledging it. The body is nil
+// when the queue is empty.
+func (c *amqpConn) get(queue string) (uint64, []byte, error) {
+	var get kafkaEncoder
+	get.int16(0)
+	amqpShortString(&get, queue)
+	get.int8(0)
+	if err := c.method(1, amqpBasicGet, get.buf.Bytes()); err != nil {
+		return 0, nil, err
+	}
+
+	id, args, err := c.next(1)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch id {
+	case amqpBasicGetEmpty:
+		return 0, nil, nil
+	case amqpBasicGetOk:
+	default:
+		return 0, nil, fmt.Errorf("unexpected method %d.%d", id>>16, id&0xFFFF)
+	}
+	tag := uint64(args.int64())
+
+	typ, _, payload, err := c.read()
+	if err != nil {
+		return 0, nil, err
+	}
+	if typ != amqpFrameHeader || len(payload) < 12 {
+		return 0, nil, errors.New("missing content header")
+	}
+	size := binary.BigEndian.Uint64(payload[4:12])
+	body := make([]byte, 0, size)
+	for uint64(len(body)) < size {
+		typ, _, payload, err := c.read()
+		if err != nil {
+			return 0, nil, err
+		}
+		if typ != amqpFrameBody {
+			return 0, nil, errors.New("missing content body")
+		}
+		body = append(body, payload...)
+	}
+	return tag, body, nil
+}
+
+// ack acknowledges a delivery
+func (c *amqpConn) ack(tag uint64) error {
+	var ack kafkaEncoder
+	ack.int64(int64(tag))
+	ack.int8(0)
+	return c.method(1, amqpBasicAck, ack.buf.Bytes())
+}
+
+// close closes the connection gracefully
+func (c *amqpConn) close() error {
+	c.conn.SetDeadline(time.Now().Add(amqpTimeout))
+	var closing kafkaEncoder
+	closing.int16(200)
+	amqpShortString(&closing, "")
+	closing.int32(0)
+	if err := c.method(0, amqpConnectionClose, closing.buf.Bytes()); err == nil {
+		c.expect(0, amqpConnectionCloseOk)
+	}
+	return c.conn.Close()
+}
+
+// method writes a method frame
+func (c *amqpConn) method(channel uint16, id uint32, args []byte) error {
+	payload := binary.BigEndian.AppendUint32(nil, id)
+	return c.frame(amqpFrameMethod, channel, append(payload, args...))
+}
+
+func (c *amqpConn) frame(typ byte, channel uint16, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+8)
+	frame = append(frame, typ)
+	frame = binary.BigEndian.AppendUint16(frame, channel)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	frame = append(frame, amqpFrameEnd)
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// read reads a frame
+func (c *amqpConn) read() (byte, uint16, []byte, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if size > uint32(c.frameMax) {
+		return 0, 0, nil, fmt.Errorf("frame of %d bytes exceeds the maximum", size)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[size] != amqpFrameEnd {
+		return 0, 0, nil, errors.New("malformed frame")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:size], nil
+}
+
+// next reads the next method on a channel, skipping heartbeats and the
+// notifications of the connection. A closed connection or channel is
+// returned as an error with the broker's reason.
+func (c *amqpConn) next(channel uint16) (uint32, *kafkaDecoder, error) {
+	for {
+		typ, ch, payload, err := c.read()
+		if err != nil {
+			return 0, nil, err
+		}
+		if typ == amqpFrameHeartbeat {
+			continue
+		}
+		if typ != amqpFrameMethod || len(payload) < 4 {
+			return 0, nil, fmt.Errorf("unexpected frame type %d", typ)
+		}
+		id := binary.BigEndian.Uint32(payload)
+		args := &kafkaDecoder{b: payload[4:]}
+		if id == amqpConnectionClose || id == amqpChannelClose {
+			code := args.int16()
+			text := amqpReadShortString(args)
+			if id == amqpConnectionClose {
+				c.method(0, amqpConnectionCloseOk, nil)
+			}
+			return 0, nil, fmt.Errorf("closed by the broker: %d %s", code, text)
+		}
+		if ch != channel {
+			continue
+		}
+		return id, args, nil
+	}
+}
+
+// expect reads the next method on a channel, which must be id
+func (c *amqpConn) expect(channel uint16, id uint32) (*kafkaDecoder, error) {
+	got, args, err := c.next(channel)
+	if err != nil {
+		return nil, err
+	}
+	if got != id {
+		return nil, fmt.Errorf("expected method %d.%d, got %d.%d", id>>16, id&0xFFFF, got>>16, got&0xFFFF)
+	}
+	return args, nil
+}
+
+func amqpShortString(e *kafkaEncoder, v string) {
+	e.int8(int8(len(v)))
+	e.buf.WriteString(v)
+}
+
+func amqpLongString(e *kafkaEncoder, v string) {
+	e.int32(int32(len(v)))
+	e.buf.WriteString(v)
+}
+
+// amqpTable writes a field table of string values
+func amqpTable(e *kafkaEncoder, fields map[string]string) {
+	var table kafkaEncoder
+	for name, value := range fields {
+		amqpShortString(&table, name)
+		table.buf.WriteByte('S')
+		amqpLongString(&table, value)
+	}
+	e.int32(int32(table.buf.Len()))
+	e.buf.Write(table.buf.Bytes())
+}
+
+func amqpReadShortString(d *kafkaDecoder) string {
+	if n := d.take(1); n != nil {
+		return string(d.take(int(n[0])))
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Limits of SQS message delays and long polling
+const (
+	sqsMaxDelay       = 15 * time.Minute
+	sqsWaitTime       = 10 * time.Second
+	sqsMaxReceiveSize = 10
+)
+
+// SQSBroker sends report jobs through an Amazon SQS queue, using the SQS
+// JSON API. Received jobs stay invisible to other consumers for the
+// visibility timeout, after which they are delivered again unless
+// acknowledged.
+type SQSBroker struct {
+	endpoint          string
+	queueURL          string
+	deadLetterURL     string
+	visibilityTimeout time.Duration
+	region            string
+	credentials       aws.CredentialsProvider
+	signer            *v4.Signer
+	client            *http.Client
+}
+
+// NewSQSBroker creates a broker of the queue at queueURL, dead-lettering
+// jobs to the queue at deadLetterURL. The default AWS credential chain is
+// used, and its region unless one is given. Requests go to the host of
+// queueURL, which can point at SQS-compatible services.
+func NewSQSBroker(queueURL, deadLetterURL, region string, visibilityTimeout time.Duration) (*SQSBroker, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SQS queue URL %q", queueURL)
+	}
+
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("AWS region is not configured")
+	}
+
+	return &SQSBroker{
+		endpoint:          u.Scheme + "://" + u.Host + "/",
+		queueURL:          queueURL,
+		deadLetterURL:     deadLetterURL,
+		visibilityTimeout: visibilityTimeout,
+		region:            cfg.Region,
+		credentials:       cfg.Credentials,
+		signer:            v4.NewSigner(),
+		client:            &http.Client{Timeout: sqsWaitTime + 20*time.Second},
+	}, nil
+}
+
+// Name returns SQS
+func (b *SQSBroker) Name() string {
+	return "SQS"
+}
+
+// Send queues a job with the SendMessage action. SQS delays messages by at
+// most 15 minutes.
+func (b *SQSBroker) Send(ctx context.Context, body []byte, delay time.Duration) error {
+	return b.send(ctx, b.queueURL, body, delay)
+}
+
+// DeadLetter sends a job to the dead-letter queue
+func (b *SQSBroker) DeadLetter(ctx context.Context, body []byte) error {
+	return b.send(ctx, b.deadLetterURL, body, 0)
+}
+
+func (b *SQSBroker) send(ctx context.Context, queueURL string, body []byte, delay time.Duration) error {
+	input := map[string]interface{}{
+		"QueueUrl":    queueURL,
+		"MessageBody": string(body),
+	}
+	if delay > 0 {
+		input["DelaySeconds"] = int(min(delay, sqsMaxDelay) / time.Second)
+	}
+	return b.call(ctx, "SendMessage", input, nil)
+}
+
+// Receive long-polls the queue for up to 10 jobs
+func (b *SQSBroker) Receive(ctx context.Context) ([]BrokerMessage, error) {
+	var output struct {
+		Messages []struct {
+			ReceiptHandle string `json:"ReceiptHandle"`
+			Body          string `json:"Body"`
+		} `json:"Messages"`
+	}
+	err := b.call(ctx, "ReceiveMessage", map[string]interface{}{
+		"QueueUrl":            b.queueURL,
+		"MaxNumberOfMessages": sqsMaxReceiveSize,
+		"WaitTimeSeconds":     int(sqsWaitTime / time.Second),
+		"VisibilityTimeout":   int(b.visibilityTimeout / time.Second),
+	}, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]BrokerMessage, 0, len(output.Messages))
+	for _, m := range output.Messages {
+		messages = append(messages, BrokerMessage{Body: []byte(m.Body), receipt: m.ReceiptHandle})
+	}
+	return messages, nil
+}
+
+// Ack deletes a received job from the queue
+func (b *SQSBroker) Ack(ctx context.Context, message BrokerMessage) error {
+	return b.call(ctx, "DeleteMessage", map[string]interface{}{
+		"QueueUrl":      b.queueURL,
+		"ReceiptHandle": message.receipt,
+	}, nil)
+}
+
+// Close releases idle connections
+func (b *SQSBroker) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// call makes a signed request to an SQS action, decoding its output into out
+// when it is not nil
+func (b *SQSBroker) call(ctx context.Context, action string, input, out interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to encode SQS request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create SQS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+
+	creds, err := b.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := b.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "sqs", b.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign SQS request: %w", err)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call SQS %s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SQS %s answered %s: %s", action, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode SQS %s response: %w", action, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,616 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.uber.org/zap"
+)
+
+// Report processing states
+const (
+	ReportStatusQueued     = "queued"
+	ReportStatusProcessing = "processing"
+	ReportStatusCompleted  = "completed"
+	ReportStatusFailed     = "failed"
+)
+
+var (
+	// ErrReportQueueFull is returned when no more reports can be queued
+	ErrReportQueueFull = errors.New("report queue is full")
+	// ErrReportNotFound is returned for unknown or expired report IDs
+	ErrReportNotFound = errors.New("report not found")
+	// ErrReportNotFailed is returned when retrying a report that did not fail
+	ErrReportNotFailed = errors.New("report has not failed")
+	// ErrReportBrokerUnavailable is returned when a report cannot be sent to
+	// the broker
+	ErrReportBrokerUnavailable = errors.New("report broker is unavailable")
+)
+
+// ReportTask processes a queued report and returns the created ticket
+type ReportTask func(ctx context.Context) (*models.TicketResponse, error)
+
+// ReportCheckpoint saves a queued report on shutdown as a job of a kind with
+// a JSON payload, copying any files it needs into dir
+type ReportCheckpoint func(dir string) (kind string, payload interface{}, err error)
+
+// ReportResumer turns the payload of a saved job back into a task, and
+// returns the function releasing its resources
+type ReportResumer func(payload json.RawMessage) (ReportTask, func(), error)
+
+// ReportJob is a report saved on shutdown, to be resumed on startup, or sent
+// through a broker
+type ReportJob struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+	// Attempts counts the failed attempts of a brokered report, and Error
+	// is the failure of the last one
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type queuedReport struct {
+	id         string
+	task       ReportTask
+	release    func()
+	checkpoint ReportCheckpoint
+}
+
+// reportJobsFile holds the saved jobs in the checkpoint directory
+const reportJobsFile = "reports.json"
+
+// ReportQueue processes reports in background workers and keeps their status
+// in memory for statusTTL after they finish. Failed reports are kept until
+// then so they can be retried. Status is local to the instance the report was
+// submitted to. On shutdown, reports still queued or failed are saved to the
+// checkpoint directory and resumed on the next start. With a broker, reports
+// are sent through it instead, see UseBroker.
+type ReportQueue struct {
+	tasks         chan queuedReport
+	workers       int
+	statusTTL     time.Duration
+	checkpointDir string
+	logger        *zap.Logger
+
+	mu       sync.Mutex
+	statuses map[string]*models.ReportStatus
+	failed   map[string]queuedReport
+	resumers map[string]ReportResumer
+
+	broker       ReportBroker
+	maxAttempts  int
+	retryBackoff time.Duration
+	mongoService *MongoDBService
+
+	// failures keeps reports that failed for good, with their payloads
+	// redacted by failuresRedactor, see StoreFailures
+	failures         *MongoDBService
+	failuresRedactor *Redactor
+
+	// resumed is closed when the queue is unpaused, and nil while it is
+	// not paused; pausing is closed when it is paused
+	resumed chan struct{}
+	pausing chan struct{}
+}
+
+// NewReportQueue creates a queue holding up to size pending reports. An
+// empty checkpoint directory disables saving reports on shutdown.
+func NewReportQueue(workers, size int, statusTTL time.Duration, checkpointDir string, log *zap.Logger) *ReportQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ReportQueue{
+		tasks:         make(chan queuedReport, size),
+		workers:       workers,
+		statusTTL:     statusTTL,
+		checkpointDir: checkpointDir,
+		logger:        log,
+		statuses:      make(map[string]*models.ReportStatus),
+		failed:        make(map[string]queuedReport),
+		resumers:      make(map[string]ReportResumer),
+	}
+}
+
+// Run processes reports until stopping is closed, then keeps processing the
+// reports still queued until none are left or ctx is done. Reports are
+// processed with ctx. Run returns once every worker returned.
+func (q *ReportQueue) Run(ctx context.Context, stopping <-chan struct{}) {
+	var wg sync.WaitGroup
+	if q.broker != nil {
+		defer q.broker.Close()
+		for i := 0; i < q.workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q.consume(ctx, stopping)
+			}()
+		}
+	}
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				resumed, pausing := q.pauseChannels()
+				if resumed != nil {
+					// Reports queued while paused are left for the
+					// checkpoint
+					select {
+					case <-stopping:
+						return
+					case <-resumed:
+					}
+					continue
+				}
+				select {
+				case <-stopping:
+					q.drain(ctx)
+					return
+				case <-pausing:
+				case report := <-q.tasks:
+					q.process(ctx, report)
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopping:
+			wg.Wait()
+			return
+		case <-ticker.C:
+			q.evictExpired()
+		}
+	}
+}
+
+// Pause stops the workers from starting on further reports, which keep
+// being queued, until Unpause. Reports being processed are finished.
+func (q *ReportQueue) Pause() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.resumed == nil {
+		q.resumed = make(chan struct{})
+		q.notifyPaused()
+		q.logger.Info("Report processing paused")
+	}
+}
+
+// Unpause lets the workers process reports again
+func (q *ReportQueue) Unpause() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.resumed != nil {
+		close(q.resumed)
+		q.resumed = nil
+		q.logger.Info("Report processing resumed")
+	}
+}
+
+// Paused reports whether the queue is paused
+func (q *ReportQueue) Paused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.resumed != nil
+}
+
+// waitUnpaused waits until the queue is not paused, and returns false when
+// stopping is closed first
+func (q *ReportQueue) waitUnpaused(stopping <-chan struct{}) bool {
+	q.mu.Lock()
+	resumed := q.resumed
+	q.mu.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-stopping:
+		return false
+	}
+}
+
+// pauseChannels returns the channel closed once the queue is unpaused when
+// it is paused, and otherwise the channel closed once it is paused, so idle
+// workers stop waiting for reports
+func (q *ReportQueue) pauseChannels() (resumed, pausing <-chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.resumed != nil {
+		return q.resumed, nil
+	}
+	if q.pausing == nil {
+		q.pausing = make(chan struct{})
+	}
+	return nil, q.pausing
+}
+
+// notifyPaused wakes the idle workers; q.mu must be held
+func (q *ReportQueue) notifyPaused() {
+	if q.pausing != nil {
+		close(q.pausing)
+		q.pausing = nil
+	}
+}
+
+// drain processes queued reports until none are left or ctx is done
+func (q *ReportQueue) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		select {
+		case report := <-q.tasks:
+			q.process(ctx, report)
+		default:
+			return
+		}
+	}
+}
+
+// Submit queues a report for processing and returns its initial status.
+// release, if not nil, is called once the report no longer needs its
+// resources: after it was processed successfully or its failure expired.
+// checkpoint, if not nil, saves the report when it is unfinished on shutdown;
+// reports without one are lost then.
+func (q *ReportQueue) Submit(task ReportTask, release func(), checkpoint ReportCheckpoint) (*models.ReportStatus, error) {
+	return q.submit(uuid.NewString(), time.Now().UTC(), task, release, checkpoint)
+}
+
+func (q *ReportQueue) submit(id string, createdAt time.Time, task ReportTask, release func(), checkpoint ReportCheckpoint) (*models.ReportStatus, error) {
+	status := &models.ReportStatus{
+		ID:        id,
+		Status:    ReportStatusQueued,
+		CreatedAt: createdAt,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case q.tasks <- queuedReport{id: status.ID, task: task, release: release, checkpoint: checkpoint}:
+	default:
+		return nil, ErrReportQueueFull
+	}
+
+	reportQueueDepth.Set(float64(len(q.tasks)))
+	q.statuses[status.ID] = status
+	copied := *status
+	return &copied, nil
+}
+
+// Status returns the processing state of a report. Statuses of brokered
+// reports are looked up in MongoDB first, as any instance may process them.
+func (q *ReportQueue) Status(ctx context.Context, id string) (*models.ReportStatus, error) {
+	if q.broker != nil && q.mongoService != nil {
+		status, err := q.mongoService.GetReportStatus(ctx, id)
+		if err == nil {
+			return status, nil
+		}
+		if !errors.Is(err, ErrReportNotFound) {
+			q.logger.Warn("Failed to get shared report status", zap.String("report_id", id), zap.Error(err))
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status, ok := q.statuses[id]
+	if !ok {
+		return nil, ErrReportNotFound
+	}
+	copied := *status
+	return &copied, nil
+}
+
+// Failed returns the status of all failed reports that can be retried
+func (q *ReportQueue) Failed() []models.ReportStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	statuses := make([]models.ReportStatus, 0, len(q.failed))
+	for id := range q.failed {
+		statuses = append(statuses, *q.statuses[id])
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].CreatedAt.Before(statuses[j].CreatedAt)
+	})
+	return statuses
+}
+
+// Retry queues a failed report for processing again
+func (q *ReportQueue) Retry(id string) (*models.ReportStatus, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.statuses[id]; !ok {
+		return nil, ErrReportNotFound
+	}
+	return q.retryLocked(id)
+}
+
+// RetryFailed queues all failed reports for processing again and returns the
+// number of reports queued. It stops early when the queue is full.
+func (q *ReportQueue) RetryFailed() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	retried := 0
+	for id := range q.failed {
+		if _, err := q.retryLocked(id); err != nil {
+			return retried, err
+		}
+		retried++
+	}
+	return retried, nil
+}
+
+func (q *ReportQueue) retryLocked(id string) (*models.ReportStatus, error) {
+	report, ok := q.failed[id]
+	if !ok {
+		return nil, ErrReportNotFailed
+	}
+
+	select {
+	case q.tasks <- report:
+	default:
+		return nil, ErrReportQueueFull
+	}
+	reportQueueDepth.Set(float64(len(q.tasks)))
+	delete(q.failed, id)
+	reportQueueFailed.Set(float64(len(q.failed)))
+
+	status := q.statuses[id]
+	status.Status = ReportStatusQueued
+	status.Error = ""
+	status.Code = ""
+	status.UpdatedAt = time.Now().UTC()
+
+	copied := *status
+	return &copied, nil
+}
+
+// Stats returns the number of reports in each state
+func (q *ReportQueue) Stats() models.ReportQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := models.ReportQueueStats{Capacity: cap(q.tasks), Paused: q.resumed != nil}
+	for _, status := range q.statuses {
+		switch status.Status {
+		case ReportStatusQueued:
+			stats.Queued++
+		case ReportStatusProcessing:
+			stats.Processing++
+		case ReportStatusCompleted:
+			stats.Completed++
+		case ReportStatusFailed:
+			stats.Failed++
+		}
+	}
+	return stats
+}
+
+func (q *ReportQueue) process(ctx context.Context, report queuedReport) {
+	reportQueueDepth.Set(float64(len(q.tasks)))
+	q.update(report.id, func(s *models.ReportStatus) { s.Status = ReportStatusProcessing })
+
+	response, err := report.task(ctx)
+	if err != nil {
+		q.logger.Warn("Failed to process queued report", zap.String("report_id", report.id), zap.Error(err))
+
+		var coded interface{ ErrorCode() string }
+		q.update(report.id, func(s *models.ReportStatus) {
+			s.Status = ReportStatusFailed
+			s.Error = err.Error()
+			if errors.As(err, &coded) {
+				s.Code = coded.ErrorCode()
+			}
+			q.failed[report.id] = report
+			reportQueueFailed.Set(float64(len(q.failed)))
+		})
+		return
+	}
+
+	q.update(report.id, func(s *models.ReportStatus) {
+		s.Status = ReportStatusCompleted
+		s.TicketID = response.TicketID
+		s.JiraLink = response.JiraLink
+		s.StatusURL = response.StatusURL
+		s.SimilarTickets = response.SimilarTickets
+	})
+	if report.release != nil {
+		report.release()
+	}
+}
+
+func (q *ReportQueue) update(id string, fn func(*models.ReportStatus)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if status, ok := q.statuses[id]; ok {
+		fn(status)
+		status.UpdatedAt = time.Now().UTC()
+	}
+}
+
+// evictExpired drops the status of reports that finished more than
+// statusTTL ago. Failed reports are kept in MongoDB then, see StoreFailures.
+func (q *ReportQueue) evictExpired() {
+	cutoff := time.Now().UTC().Add(-q.statusTTL)
+
+	type expiredReport struct {
+		report queuedReport
+		status models.ReportStatus
+	}
+	var expired []expiredReport
+
+	q.mu.Lock()
+	for id, status := range q.statuses {
+		finished := status.Status == ReportStatusCompleted || status.Status == ReportStatusFailed
+		// Brokered reports may be finished by another instance
+		abandoned := q.broker != nil && status.UpdatedAt.Before(time.Now().Add(-unfinishedStatusTTL))
+		if finished && status.UpdatedAt.Before(cutoff) || abandoned {
+			delete(q.statuses, id)
+			if report, ok := q.failed[id]; ok {
+				delete(q.failed, id)
+				reportQueueFailed.Set(float64(len(q.failed)))
+				expired = append(expired, expiredReport{report: report, status: *status})
+			}
+		}
+	}
+	q.mu.Unlock()
+
+	for _, e := range expired {
+		if !q.keep(e.report, e.status) && e.report.release != nil {
+			e.report.release()
+		}
+	}
+}
+
+// RegisterResumer sets how saved jobs of a kind are resumed
+func (q *ReportQueue) RegisterResumer(kind string, resume ReportResumer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.resumers[kind] = resume
+}
+
+// Checkpoint saves the reports still queued or failed to the checkpoint
+// directory, to be resumed on the next start. It must only be called once
+// the workers have stopped.
+func (q *ReportQueue) Checkpoint(ctx context.Context) error {
+	var pending []queuedReport
+	for drained := false; !drained; {
+		select {
+		case report := <-q.tasks:
+			pending = append(pending, report)
+		default:
+			drained = true
+		}
+	}
+
+	q.mu.Lock()
+	for _, report := range q.failed {
+		pending = append(pending, report)
+	}
+	createdAt := make(map[string]time.Time, len(pending))
+	for _, report := range pending {
+		if status, ok := q.statuses[report.id]; ok {
+			createdAt[report.id] = status.CreatedAt
+		}
+	}
+	q.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if q.checkpointDir == "" {
+		q.logger.Warn("Unfinished reports are dropped, REPORT_CHECKPOINT_DIR is not set", zap.Int("reports", len(pending)))
+		return nil
+	}
+	if err := os.MkdirAll(q.checkpointDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	jobs := make([]ReportJob, 0, len(pending))
+	dropped := 0
+	for _, report := range pending {
+		if report.checkpoint == nil || ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		kind, payload, err := report.checkpoint(q.checkpointDir)
+		if err == nil {
+			var raw []byte
+			if raw, err = json.Marshal(payload); err == nil {
+				jobs = append(jobs, ReportJob{ID: report.id, Kind: kind, Payload: raw, CreatedAt: createdAt[report.id]})
+				continue
+			}
+		}
+		q.logger.Error("Failed to save unfinished report", zap.String("report_id", report.id), zap.Error(err))
+		dropped++
+	}
+
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		return err
+	}
+	// Write atomically, so a crash cannot leave a partial file to resume
+	path := filepath.Join(q.checkpointDir, reportJobsFile)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("failed to save unfinished reports: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save unfinished reports: %w", err)
+	}
+
+	q.logger.Info("Saved unfinished reports", zap.Int("saved", len(jobs)), zap.Int("dropped", dropped))
+	return nil
+}
+
+// Resume queues the reports saved by the last checkpoint. Resumers must be
+// registered first.
+func (q *ReportQueue) Resume() error {
+	if q.checkpointDir == "" {
+		return nil
+	}
+	path := filepath.Join(q.checkpointDir, reportJobsFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read saved reports: %w", err)
+	}
+
+	var jobs []ReportJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return fmt.Errorf("failed to read saved reports: %w", err)
+	}
+
+	resumed := 0
+	for _, job := range jobs {
+		q.mu.Lock()
+		resume := q.resumers[job.Kind]
+		q.mu.Unlock()
+		if resume == nil {
+			q.logger.Error("Cannot resume saved report of unknown kind", zap.String("report_id", job.ID), zap.String("kind", job.Kind))
+			continue
+		}
+
+		task, release, err := resume(job.Payload)
+		if err != nil {
+			q.logger.Error("Failed to resume saved report", zap.String("report_id", job.ID), zap.Error(err))
+			continue
+		}
+		// Saved again as is when unfinished at the next shutdown
+		checkpoint := func(string) (string, interface{}, error) { return job.Kind, job.Payload, nil }
+		if _, err := q.submit(job.ID, job.CreatedAt, task, release, checkpoint); err != nil {
+			if release != nil {
+				release()
+			}
+			q.logger.Error("Failed to resume saved report", zap.String("report_id", job.ID), zap.Error(err))
+			continue
+		}
+		resumed++
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove saved reports: %w", err)
+	}
+	q.logger.Info("Resumed saved reports", zap.Int("resumed", resumed), zap.Int("saved", len(jobs)))
+	return nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supported values for the TICKET_RETENTION_ACTION and
+// RETENTION_OBJECT_ACTION settings
+const (
+	RetentionActionDelete  = "delete"
+	RetentionActionArchive = "archive"
+)
+
+// AttachmentStatusArchived marks attachments of tickets archived by the retention job
+const AttachmentStatusArchived = "archived"
+
+// RetentionJob periodically removes tickets older than the retention period.
+// Tickets are deleted or archived, and their stored objects are deleted or
+// moved to the archive storage tier unless another ticket still uses them.
+type RetentionJob struct {
+	storage      ObjectStorage
+	mongoService *MongoDBService
+	coordinator  *Coordinator
+	logger       *zap.Logger
+	interval     time.Duration
+	period       time.Duration
+	ticketAction string
+	objectAction string
+}
+
+// NewRetentionJob creates a new retention job for tickets older than period
+func NewRetentionJob(storage ObjectStorage, ms *MongoDBService, log *zap.Logger, interval, period time.Duration, ticketAction, objectAction string) *RetentionJob {
+	return &RetentionJob{
+		storage:      storage,
+		mongoService: ms,
+		logger:       log,
+		interval:     interval,
+		period:       period,
+		ticketAction: ticketAction,
+		objectAction: objectAction,
+	}
+}
+
+// SetCoordinator runs the job only while this instance is the leader
+func (j *RetentionJob) SetCoordinator(coordinator *Coordinator) {
+	j.coordinator = coordinator
+}
+
+// Run runs the job periodically until stopping is closed, letting a run in
+// progress finish with ctx
+func (j *RetentionJob) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	if j.coordinator.IsLeader() {
+		j.RunOnce(ctx)
+	}
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+			if j.coordinator.IsLeader() {
+				j.RunOnce(ctx)
+			}
+		}
+	}
+}
+
+// RunOnce applies the retention policy to all expired tickets
+func (j *RetentionJob) RunOnce(ctx context.Context) {
+	cutoff := time.Now().Add(-j.period)
+	tickets, err := j.mongoService.GetTicketsCreatedBefore(ctx, cutoff)
+	if err != nil {
+		j.logger.Error("Failed to find tickets past retention", zap.Error(err))
+		return
+	}
+
+	expired := 0
+	for _, ticket := range tickets {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := j.expire(ctx, &ticket, j.ticketAction, j.objectAction); err != nil {
+			j.logger.Warn("Failed to apply retention to ticket", zap.String("ticket_id", ticket.TicketID), zap.Error(err))
+			continue
+		}
+		expired++
+	}
+
+	if expired > 0 {
+		j.logger.Info("Applied ticket retention",
+			zap.Int("tickets", expired),
+			zap.String("action", j.ticketAction),
+			zap.Time("cutoff", cutoff),
+		)
+	}
+}
+
+// Purge deletes a ticket, its attachment records and the stored objects no
+// other ticket uses, regardless of its age and the configured actions
+func (j *RetentionJob) Purge(ctx context.Context, ticketID string) error {
+	ticket, err := j.mongoService.GetTicketByJiraID(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+
+	return j.expire(ctx, ticket, RetentionActionDelete, RetentionActionDelete)
+}
+
+// expire cleans up the objects of a ticket, then deletes or archives it.
+// The ticket is kept when an object cannot be cleaned up so the next run
+// retries it.
+func (j *RetentionJob) expire(ctx context.Context, ticket *FlattenedTicket, ticketAction, objectAction string) error {
+	ctx = WithTenant(ctx, ticket.Tenant)
+	keys, err := j.ticketObjectKeys(ctx, ticket)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		referenced, err := j.mongoService.IsObjectReferenced(ctx, key, ticket.TicketID)
+		if err != nil {
+			return err
+		}
+		if referenced {
+			j.logger.Debug("Keeping object shared with another ticket", zap.String("key", key), zap.String("ticket_id", ticket.TicketID))
+			continue
+		}
+
+		if err := j.expireObject(ctx, key, objectAction); err != nil {
+			return err
+		}
+	}
+
+	if ticketAction == RetentionActionDelete {
+		if err := j.mongoService.DeleteAttachmentsByTicketID(ctx, ticket.TicketID); err != nil {
+			return err
+		}
+		return j.mongoService.DeleteTicket(ctx, ticket.TicketID)
+	}
+
+	if err := j.mongoService.UpdateAttachmentsStatus(ctx, ticket.TicketID, AttachmentStatusArchived); err != nil {
+		return err
+	}
+	return j.mongoService.ArchiveTicket(ctx, ticket.TicketID, time.Now())
+}
+
+// expireObject deletes an object or moves it to the archive tier
+func (j *RetentionJob) expireObject(ctx context.Context, key, action string) error {
+	var err error
+	if action == RetentionActionArchive {
+		err = j.storage.ArchiveObject(ctx, key)
+	} else {
+		err = j.storage.DeleteObject(ctx, key)
+	}
+
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s object %s: %w", action, key, err)
+	}
+
+	j.logger.Debug("Expired ticket object", zap.String("key", key), zap.String("action", action))
+	return nil
+}
+
+// ticketObjectKeys returns the keys of all objects stored for a ticket
+func (j *RetentionJob) ticketObjectKeys(ctx context.Context, ticket *FlattenedTicket) ([]string, error) {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	imageKey := ticket.ImageKey
+	if imageKey == "" && ticket.ImageURL != "" {
+		// Tickets stored before object keys were persisted
+		if key, err := j.storage.ObjectKeyFromURL(ticket.ImageURL); err == nil {
+			imageKey = key
+		}
+	}
+	add(imageKey)
+	add(ticket.QuarantineKey)
+
+	attachments, err := j.mongoService.GetAttachmentsByTicketID(ctx, ticket.TicketID)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		add(attachment.ObjectKey)
+	}
+
+	return keys, nil
+}
+
+// OrphanReport summarizes a reconciliation run
+type OrphanReport struct {
+	Scanned     int
+	Orphans     int
+	OrphanBytes int64
+	Deleted     int
+}
+
+// ReconcileOrphans finds objects under prefix that no ticket or attachment
+// references and calls fn for each of them. Objects modified within minAge are
+// skipped, since direct uploads are stored before the report referencing them
+// is submitted. When remove is set, orphans are deleted after fn is called.
+func ReconcileOrphans(ctx context.Context, storage ObjectStorage, ms *MongoDBService, prefix string, minAge time.Duration, remove bool, fn func(ObjectInfo)) (*OrphanReport, error) {
+	referenced, legacyURLs, err := ms.ReferencedObjectKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range legacyURLs {
+		if key, err := storage.ObjectKeyFromURL(u); err == nil {
+			referenced[key] = struct{}{}
+		}
+	}
+
+	report := &OrphanReport{}
+	cutoff := time.Now().Add(-minAge)
+	err = storage.ListObjects(ctx, prefix, func(obj ObjectInfo) error {
+		report.Scanned++
+		if _, ok := referenced[obj.Key]; ok {
+			return nil
+		}
+		if !obj.LastModified.IsZero() && obj.LastModified.After(cutoff) {
+			return nil
+		}
+
+		report.Orphans++
+		report.OrphanBytes += obj.Size
+		if fn != nil {
+			fn(obj)
+		}
+
+		if remove {
+			if err := storage.DeleteObject(ctx, obj.Key); err != nil {
+				return err
+			}
+			report.Deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
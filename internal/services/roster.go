@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RosterTeam is a support team and the products it handles. Teams without
+// products handle every product no other team does.
+type RosterTeam struct {
+	Name     string
+	Products []string
+	Members  []RosterMember
+
+	// Schedule is an on-call schedule as provider:id, e.g. pagerduty:PABC123.
+	// Whoever is on call gets the team's tickets, matched to members by email.
+	Schedule string
+}
+
+// RosterMember is a member of a support team
+type RosterMember struct {
+	// AccountID is the Jira account tickets are assigned to
+	AccountID string
+	// Email matches the member to on-call schedules, and is where tickets
+	// assigned to the member are emailed
+	Email string
+	// GitHub is the login GitHub issues assigned to the member go to
+	GitHub string
+	// GitLab is the username GitLab issues assigned to the member go to
+	GitLab string
+	// Shift is when the member works; nil means always
+	Shift *Shift
+}
+
+// Roster assigns tickets to support team members who are on shift
+type Roster struct {
+	teams    []RosterTeam
+	products map[string]int // lowercase product to team index
+	oncall   map[string]OnCallLookup
+	logger   *zap.Logger
+}
+
+// NewRoster creates a roster of teams, looking up on-call schedules with the
+// lookups by provider name
+func NewRoster(teams []RosterTeam, oncall map[string]OnCallLookup, log *zap.Logger) (*Roster, error) {
+	r := &Roster{
+		teams:    teams,
+		products: make(map[string]int),
+		oncall:   oncall,
+		logger:   log,
+	}
+	sort.Slice(r.teams, func(i, j int) bool { return r.teams[i].Name < r.teams[j].Name })
+
+	for i, team := range r.teams {
+		if err := r.checkTeam(team); err != nil {
+			return nil, err
+		}
+		for _, product := range team.Products {
+			product = strings.ToLower(product)
+			if other, ok := r.products[product]; ok {
+				return nil, fmt.Errorf("product %s is handled by both %s and %s", product, r.teams[other].Name, team.Name)
+			}
+			r.products[product] = i
+		}
+	}
+	return r, nil
+}
+
+// NewStaticRoster creates a roster of a single team whose members are always
+// on shift, as configured by SUPPORT_TEAM_MEMBERS. The on-call lookups are
+// used by the teams added with WithTeams.
+func NewStaticRoster(accountIDs []string, oncall map[string]OnCallLookup, log *zap.Logger) *Roster {
+	members := make([]RosterMember, len(accountIDs))
+	for i, id := range accountIDs {
+		members[i] = RosterMember{AccountID: id}
+	}
+	return &Roster{
+		teams:    []RosterTeam{{Name: "support", Members: members}},
+		products: map[string]int{},
+		oncall:   oncall,
+		logger:   log,
+	}
+}
+
+// WithTeams returns a copy of the roster with more teams, which take their
+// products over from the teams of the roster
+func (r *Roster) WithTeams(teams []RosterTeam) (*Roster, error) {
+	merged := &Roster{
+		teams:    append(slices.Clone(r.teams), teams...),
+		products: maps.Clone(r.products),
+		oncall:   r.oncall,
+		logger:   r.logger,
+	}
+	for i, team := range teams {
+		if err := r.checkTeam(team); err != nil {
+			return nil, err
+		}
+		for _, product := range team.Products {
+			merged.products[strings.ToLower(product)] = len(r.teams) + i
+		}
+	}
+	return merged, nil
+}
+
+// checkTeam returns an error when a team has no members or a schedule whose
+// provider is not configured
+func (r *Roster) checkTeam(team RosterTeam) error {
+	if len(team.Members) == 0 {
+		return fmt.Errorf("team %s has no members", team.Name)
+	}
+	if team.Schedule != "" {
+		provider, id, _ := strings.Cut(team.Schedule, ":")
+		if id == "" || r.oncall[provider] == nil {
+			return fmt.Errorf("team %s has schedule %q, expected pagerduty:<id> or opsgenie:<id> with the provider's API key configured", team.Name, team.Schedule)
+		}
+	}
+	return nil
+}
+
+// IsMember reports whether a Jira account is on any team
+func (r *Roster) IsMember(accountID string) bool {
+	for _, team := range r.teams {
+		for _, member := range team.Members {
+			if member.AccountID == accountID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MemberEmail returns the email address of a team member, or an empty
+// string when the account is not on the roster or has no address
+func (r *Roster) MemberEmail(accountID string) string {
+	member, _ := r.FindMember(func(m RosterMember) bool { return m.AccountID == accountID && m.Email != "" })
+	return member.Email
+}
+
+// FindMember returns the first team member that matches
+func (r *Roster) FindMember(match func(RosterMember) bool) (RosterMember, bool) {
+	for _, team := range r.teams {
+		for _, member := range team.Members {
+			if match(member) {
+				return member, true
+			}
+		}
+	}
+	return RosterMember{}, false
+}
+
+// Assignee picks who gets a new ticket of a product: whoever of the team is
+// on call, else a random member on shift. When nobody is on shift any member
+// is picked, so the ticket still has an owner. It returns an empty string
+// for an empty roster.
+func (r *Roster) Assignee(ctx context.Context, product string, now time.Time) string {
+	teams := r.teamsFor(product)
+	for _, team := range teams {
+		if member, ok := r.onCall(ctx, team); ok {
+			return member.AccountID
+		}
+	}
+
+	var members, onShift []RosterMember
+	for _, team := range teams {
+		for _, member := range team.Members {
+			members = append(members, member)
+			if member.Shift == nil || member.Shift.OnDuty(now) {
+				onShift = append(onShift, member)
+			}
+		}
+	}
+	if len(members) == 0 {
+		return ""
+	}
+	if len(onShift) == 0 {
+		r.logger.Warn("No support team member is on shift, assigning to anyone", zap.String("product", product))
+		onShift = members
+	}
+	return onShift[rand.Intn(len(onShift))].AccountID
+}
+
+// teamsFor returns the team handling a product, or the teams without
+// products, or every team when all have products
+func (r *Roster) teamsFor(product string) []RosterTeam {
+	if i, ok := r.products[strings.ToLower(product)]; ok {
+		return r.teams[i : i+1]
+	}
+
+	var teams []RosterTeam
+	for _, team := range r.teams {
+		if len(team.Products) == 0 {
+			teams = append(teams, team)
+		}
+	}
+	if len(teams) == 0 {
+		return r.teams
+	}
+	return teams
+}
+
+// onCall returns the member of a team on call in its schedule, if any
+func (r *Roster) onCall(ctx context.Context, team RosterTeam) (RosterMember, bool) {
+	if team.Schedule == "" {
+		return RosterMember{}, false
+	}
+	provider, id, _ := strings.Cut(team.Schedule, ":")
+
+	emails, err := r.oncall[provider].OnCall(ctx, id)
+	if err != nil {
+		r.logger.Warn("Failed to look up on-call schedule, assigning by shift", zap.String("team", team.Name), zap.String("schedule", team.Schedule), zap.Error(err))
+		return RosterMember{}, false
+	}
+	for _, email := range emails {
+		for _, member := range team.Members {
+			if member.Email != "" && strings.EqualFold(member.Email, email) {
+				return member, true
+			}
+		}
+	}
+	return RosterMember{}, false
+}
+
+// Shift is the working hours of a support team member
+type Shift struct {
+	location   *time.Location
+	days       [7]bool
+	start, end time.Duration // since midnight; shifts ending before they start run overnight
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseShift parses working hours such as "09:00-18:00" in a time zone such
+// as "Asia/Kolkata" (UTC when empty), on days such as "mon-fri" or "sat"
+// (every day when none are given)
+func ParseShift(timezone, hours string, days []string) (*Shift, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", timezone, err)
+	}
+
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid hours %q, expected HH:MM-HH:MM", hours)
+	}
+	shift := &Shift{location: location}
+	if shift.start, err = parseClock(from); err != nil {
+		return nil, err
+	}
+	if shift.end, err = parseClock(to); err != nil {
+		return nil, err
+	}
+	if shift.start == shift.end {
+		return nil, fmt.Errorf("invalid hours %q, the shift is empty", hours)
+	}
+
+	if len(days) == 0 {
+		days = []string{"sun-sat"}
+	}
+	for _, spec := range days {
+		first, last, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), "-")
+		if !isRange {
+			last = first
+		}
+		from, ok1 := weekdays[first]
+		to, ok2 := weekdays[last]
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid days %q, expected names such as mon or ranges such as mon-fri", spec)
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			shift.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return shift, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// OnDuty reports whether the shift covers a point in time
+func (s *Shift) OnDuty(t time.Time) bool {
+	t = t.In(s.location)
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	if s.start < s.end {
+		return s.days[t.Weekday()] && offset >= s.start && offset < s.end
+	}
+	// Overnight shifts belong to the day they start on
+	if offset >= s.start {
+		return s.days[t.Weekday()]
+	}
+	return offset < s.end && s.days[(t.Weekday()+6)%7]
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// runbooksCollection is the collection runbooks maintained outside the
+// configuration are read from
+const runbooksCollection = "runbooks"
+
+// runbooksRefresh is how often runbooks are read from MongoDB again
+const runbooksRefresh = time.Minute
+
+// Runbook is a triage page linked in the description of tickets of its
+// products that failed on one of its endpoints. An empty list matches
+// everything, but a runbook needs products or endpoints. Endpoints are
+// path.Match patterns of the path of failed requests, e.g.
+// /api/payments/*, optionally preceded by the method, e.g. POST /api/login.
+// The page is a URL, or a Confluence page ID whose title is looked up.
+type Runbook struct {
+	Name      string   `bson:"_id" json:"name"`
+	Title     string   `bson:"title,omitempty" json:"title,omitempty"`
+	URL       string   `bson:"url,omitempty" json:"url,omitempty"`
+	PageID    string   `bson:"page_id,omitempty" json:"pageId,omitempty"`
+	Products  []string `bson:"products,omitempty" json:"products,omitempty"`
+	Endpoints []string `bson:"endpoints,omitempty" json:"endpoints,omitempty"`
+}
+
+// Runbooks picks the runbooks of new tickets, from the configured ones and
+// those in MongoDB
+type Runbooks struct {
+	configured   []Runbook
+	confluence   *ConfluenceClient
+	mongoService *MongoDBService
+	logger       *zap.Logger
+
+	mu       sync.Mutex
+	stored   []Runbook
+	loadedAt time.Time
+}
+
+// NewRunbooks creates the runbook lookup of configured runbooks, and those
+// in MongoDB when mongoService is not nil. Confluence page IDs need
+// confluence.
+func NewRunbooks(configured []Runbook, confluence *ConfluenceClient, mongoService *MongoDBService, log *zap.Logger) *Runbooks {
+	return &Runbooks{
+		configured:   configured,
+		confluence:   confluence,
+		mongoService: mongoService,
+		logger:       log,
+	}
+}
+
+// Match returns the links of the runbooks of a ticket, configured ones
+// first
+func (r *Runbooks) Match(ctx context.Context, req *models.TicketRequest) []models.RunbookLink {
+	product, _ := req.Payload["product"].(string)
+	endpoints := failedEndpoints(req.Payload["failedNetworkCalls"])
+
+	var links []models.RunbookLink
+	seen := make(map[string]bool)
+	for _, runbook := range r.all(ctx) {
+		if !runbook.matches(product, endpoints) {
+			continue
+		}
+		link, err := r.link(ctx, runbook)
+		if err != nil {
+			r.logger.Warn("Failed to look up runbook page", zap.String("runbook", runbook.Name), zap.Error(err))
+		}
+		if link.URL != "" && !seen[link.URL] {
+			seen[link.URL] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// all returns the configured runbooks followed by the stored ones, which are
+// read again once a minute. The last ones read are kept when MongoDB fails.
+func (r *Runbooks) all(ctx context.Context) []Runbook {
+	if r.mongoService == nil {
+		return r.configured
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.loadedAt) >= runbooksRefresh {
+		r.loadedAt = time.Now()
+		stored, err := r.mongoService.GetRunbooks(ctx)
+		if err != nil {
+			r.logger.Warn("Failed to read runbooks", zap.Error(err))
+		} else {
+			r.stored = stored
+		}
+	}
+	return append(r.configured[:len(r.configured):len(r.configured)], r.stored...)
+}
+
+// link returns the link of a runbook. Confluence pages are linked by ID
+// when their title cannot be looked up.
+func (r *Runbooks) link(ctx context.Context, runbook Runbook) (models.RunbookLink, error) {
+	link := models.RunbookLink{Title: runbook.Title, URL: runbook.URL}
+	if link.Title == "" {
+		link.Title = runbook.Name
+	}
+	if runbook.PageID == "" || r.confluence == nil {
+		return link, nil
+	}
+
+	link.URL = r.confluence.PageURL(runbook.PageID)
+	page, err := r.confluence.Page(ctx, runbook.PageID)
+	if err != nil {
+		return link, err
+	}
+	link.URL = page.URL
+	if runbook.Title == "" && page.Title != "" {
+		link.Title = page.Title
+	}
+	return link, nil
+}
+
+func (runbook Runbook) matches(product string, endpoints []failedEndpoint) bool {
+	if len(runbook.Products) == 0 && len(runbook.Endpoints) == 0 {
+		return false
+	}
+	if len(runbook.Products) > 0 && !containsFold(runbook.Products, product) {
+		return false
+	}
+	if len(runbook.Endpoints) == 0 {
+		return true
+	}
+	for _, pattern := range runbook.Endpoints {
+		method, pathPattern, hasMethod := strings.Cut(strings.TrimSpace(pattern), " ")
+		if !hasMethod {
+			method, pathPattern = "", method
+		}
+		for _, endpoint := range endpoints {
+			if method != "" && !strings.EqualFold(method, endpoint.method) {
+				continue
+			}
+			if ok, _ := path.Match(strings.TrimSpace(pathPattern), endpoint.path); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// failedEndpoint is the method and path of a failed network call
+type failedEndpoint struct {
+	method string
+	path   string
+}
+
+// failedEndpoints returns the endpoints of failed network calls, given as
+// parsed calls, generic JSON or a JSON string
+func failedEndpoints(networkCalls interface{}) []failedEndpoint {
+	calls := failedCalls(networkCalls)
+	endpoints := make([]failedEndpoint, 0, len(calls))
+	for _, call := range calls {
+		u, err := url.Parse(call.RequestData.URL)
+		if err != nil || u.Path == "" {
+			continue
+		}
+		endpoints = append(endpoints, failedEndpoint{method: call.RequestData.Method, path: u.Path})
+	}
+	return endpoints
+}
+
+// failedCalls parses failed network calls given as generic JSON or a JSON
+// string
+func failedCalls(networkCalls interface{}) []models.NetworkCall {
+	var raw []byte
+	switch calls := networkCalls.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = []byte(calls)
+	default:
+		var err error
+		if raw, err = json.Marshal(calls); err != nil {
+			return nil
+		}
+	}
+	var parsed []models.NetworkCall
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil
+	}
+	return parsed
+}
+
+// GetRunbooks retrieves the runbooks maintained in MongoDB, by name
+func (s *MongoDBService) GetRunbooks(ctx context.Context) ([]Runbook, error) {
+	cursor, err := s.database.Collection(runbooksCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find runbooks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var runbooks []Runbook
+	if err := cursor.All(ctx, &runbooks); err != nil {
+		return nil, fmt.Errorf("failed to decode runbooks: %w", err)
+	}
+	sort.Slice(runbooks, func(i, j int) bool { return runbooks[i].Name < runbooks[j].Name })
+	return runbooks, nil
+}
@@ -3,133 +3,709 @@ package services
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
-	"path/filepath"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/google/uuid"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
 )
 
-// S3Service handles uploading files to AWS S3
+// Uploads larger than multipartUploadThreshold (e.g. screen recordings) are
+// streamed to S3 in parts of multipartPartSize instead of being buffered.
+// S3 requires parts of at least 5 MiB, except for the last one.
+const (
+	multipartUploadThreshold = 16 << 20
+	multipartPartSize        = 8 << 20
+)
+
+// gcsEndpoint is the Google Cloud Storage XML API endpoint, which is
+// interoperable with the S3 API when using HMAC keys
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// S3Service handles uploading files to AWS S3 or an S3-compatible store
 type S3Service struct {
-	client     *s3.Client
-	bucketName string
-	region     string
-	baseURL    string
-	presigner  *s3.PresignClient
+	client        *s3.Client
+	keys          *staticKeys // nil when using the default credential chain
+	bucketName    string
+	region        string
+	baseURL       string
+	presigner     *s3.PresignClient
+	presignExpiry time.Duration
+
+	// Server-side encryption applied to every upload
+	sseMode  types.ServerSideEncryption
+	kmsKeyID string
+
+	// checksums enables SHA-256 content checksums, which S3 verifies on upload
+	checksums bool
+
+	// archiveClass is the storage class objects are transitioned to on archive
+	archiveClass types.StorageClass
+
+	logger *zap.Logger
 }
 
-// NewS3Service creates a new S3 service instance
-func NewS3Service(accessKey, secretKey, region, bucketName, baseURL string) (*S3Service, error) {
-	// Create AWS credentials
-	creds := credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")
+// NewS3Service creates a new S3 service instance. Static credentials are
+// optional: when accessKey and secretKey are empty the default AWS credential
+// chain is used (environment, shared config, IRSA web identity, IMDS).
+// A non-empty endpoint targets an S3-compatible store instead of AWS, and
+// usePathStyle addresses buckets as endpoint/bucket/key rather than
+// bucket.endpoint/key.
+func NewS3Service(accessKey, secretKey, region, bucketName, baseURL, endpoint string, usePathStyle bool, presignExpiry time.Duration) (*S3Service, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+
+	// Only pin static credentials when both keys are provided
+	var keys *staticKeys
+	if accessKey != "" && secretKey != "" {
+		keys = newStaticKeys(accessKey, secretKey)
+		opts = append(opts, config.WithCredentialsProvider(keys.cache))
+	} else if accessKey != "" || secretKey != "" {
+		return nil, fmt.Errorf("both access key and secret key must be set to use static credentials")
+	}
 
 	// Configure AWS SDK
-	cfg, err := config.LoadDefaultConfig(context.Background(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(creds),
-	)
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("AWS region is not configured")
+	}
+	region = cfg.Region
+
 	// Create S3 client
-	client := s3.NewFromConfig(cfg)
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			// Third-party stores don't all understand the SDK's default checksum headers
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+		o.UsePathStyle = usePathStyle
+	})
 	// Create presigner client
 	presigner := s3.NewPresignClient(client)
 
 	return &S3Service{
-		client:     client,
-		presigner:  presigner,
-		bucketName: bucketName,
-		region:     region,
-		baseURL:    baseURL,
+		client:        client,
+		keys:          keys,
+		presigner:     presigner,
+		bucketName:    bucketName,
+		region:        region,
+		baseURL:       baseURL,
+		presignExpiry: normalizePresignExpiry(presignExpiry),
+		checksums:     true,
+		archiveClass:  types.StorageClassGlacier,
+		logger:        zap.NewNop(),
 	}, nil
 }
 
-// UploadFile uploads a file to S3 and returns a presigned URL with 7 days expiry
-func (s *S3Service) UploadFile(ctx context.Context, file *multipart.FileHeader) (string, error) {
-	fmt.Printf("\n=== S3 UPLOAD ATTEMPT ===\n")
-	fmt.Printf("Filename: %s\n", file.Filename)
-	fmt.Printf("File size: %d bytes\n", file.Size)
-	fmt.Printf("Content type: %s\n", file.Header.Get("Content-Type"))
+// staticKeys holds static access keys that can be rotated while in use
+type staticKeys struct {
+	current atomic.Pointer[aws.Credentials]
+	cache   *aws.CredentialsCache
+}
+
+func newStaticKeys(accessKey, secretKey string) *staticKeys {
+	k := &staticKeys{}
+	k.set(accessKey, secretKey)
+	k.cache = aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return *k.current.Load(), nil
+	}))
+	return k
+}
+
+func (k *staticKeys) set(accessKey, secretKey string) {
+	k.current.Store(&aws.Credentials{AccessKeyID: accessKey, SecretAccessKey: secretKey, Source: "StaticKeys"})
+	if k.cache != nil {
+		k.cache.Invalidate()
+	}
+}
+
+// SetLogger sets the logger uploads are logged to
+func (s *S3Service) SetLogger(log *zap.Logger) {
+	s.logger = log
+}
 
-	// Open uploaded file
-	src, err := file.Open()
+// SetStaticCredentials replaces the access keys requests are signed with.
+// It is a no-op when the service uses the default credential chain.
+func (s *S3Service) SetStaticCredentials(accessKey, secretKey string) {
+	if s.keys != nil {
+		s.keys.set(accessKey, secretKey)
+	}
+}
+
+// NewMinIOService creates an S3 service backed by a MinIO server, which
+// requires a custom endpoint and path-style addressing
+func NewMinIOService(endpoint, accessKey, secretKey, region, bucketName string, presignExpiry time.Duration) (*S3Service, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("MinIO endpoint is required")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	baseURL := fmt.Sprintf("%s/%s", strings.TrimRight(endpoint, "/"), bucketName)
+	return NewS3Service(accessKey, secretKey, region, bucketName, baseURL, endpoint, true, presignExpiry)
+}
+
+// NewGCSService creates a storage service backed by Google Cloud Storage
+// through its S3-interoperable XML API, authenticated with HMAC keys
+func NewGCSService(hmacAccessID, hmacSecret, bucketName string, presignExpiry time.Duration) (*S3Service, error) {
+	baseURL := fmt.Sprintf("%s/%s", gcsEndpoint, bucketName)
+	service, err := NewS3Service(hmacAccessID, hmacSecret, "auto", bucketName, baseURL, gcsEndpoint, true, presignExpiry)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to open uploaded file: %s\n", err)
-		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+		return nil, err
+	}
+
+	// The XML API does not support x-amz-checksum-* headers
+	service.checksums = false
+	service.archiveClass = "ARCHIVE"
+	return service, nil
+}
+
+// PresignExpiry returns how long generated presigned URLs stay valid
+func (s *S3Service) PresignExpiry() time.Duration {
+	return s.presignExpiry
+}
+
+// SetServerSideEncryption enables server-side encryption for uploads. mode is
+// "AES256" for SSE-S3 or "aws:kms" for SSE-KMS; kmsKeyID optionally selects a
+// customer managed key and is only valid with SSE-KMS.
+func (s *S3Service) SetServerSideEncryption(mode, kmsKeyID string) error {
+	switch types.ServerSideEncryption(mode) {
+	case "":
+		if kmsKeyID != "" {
+			return fmt.Errorf("a KMS key ID requires SSE mode %q", types.ServerSideEncryptionAwsKms)
+		}
+	case types.ServerSideEncryptionAes256:
+		if kmsKeyID != "" {
+			return fmt.Errorf("a KMS key ID requires SSE mode %q", types.ServerSideEncryptionAwsKms)
+		}
+	case types.ServerSideEncryptionAwsKms:
+	default:
+		return fmt.Errorf("unsupported server-side encryption mode: %s", mode)
+	}
+
+	s.sseMode = types.ServerSideEncryption(mode)
+	s.kmsKeyID = kmsKeyID
+	return nil
+}
+
+// UploadFile uploads a file to S3 under objectKey and returns a presigned URL
+func (s *S3Service) UploadFile(ctx context.Context, file *multipart.FileHeader, objectKey string, tags map[string]string) (_ string, err error) {
+	defer observeUpload(ctx, StorageBackendS3, file.Size, time.Now(), &err)
+
+	log := logger.FromContext(ctx, s.logger).With(zap.String("bucket", s.bucketName), zap.String("key", objectKey))
+	log.Debug("Uploading file to S3",
+		zap.String("filename", file.Filename),
+		zap.Int64("size", file.Size),
+		zap.String("content_type", file.Header.Get("Content-Type")),
+	)
+
+	if file.Size > multipartUploadThreshold {
+		src, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to open uploaded file: %w", err)
+		}
+		defer src.Close()
+
+		if err := s.uploadMultipart(ctx, src, file.Size, file.Header.Get("Content-Type"), objectKey, tags); err != nil {
+			return "", fmt.Errorf("failed to upload to S3: %w", err)
+		}
+		return s.uploadedObjectURL(ctx, objectKey), nil
 	}
-	defer src.Close()
 
 	// Read file content
-	buffer := make([]byte, file.Size)
-	bytesRead, err := src.Read(buffer)
+	buffer, err := readUpload(file)
 	if err != nil {
-		fmt.Printf("ERROR: Failed to read file content: %s\n", err)
-		return "", fmt.Errorf("failed to read file content: %w", err)
+		return "", err
 	}
-	fmt.Printf("Bytes read: %d\n", bytesRead)
-
-	// Create a unique key for the file
-	fileExt := filepath.Ext(file.Filename)
-	objectKey := fmt.Sprintf("uploads/ronnin/%s%s", uuid.New().String(), fileExt)
-	fmt.Printf("Generated S3 object key: %s\n", objectKey)
-	fmt.Printf("Target bucket: %s\n", s.bucketName)
-	fmt.Printf("Region: %s\n", s.region)
 
 	// Upload to S3
-	putObjectOutput, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucketName),
 		Key:         aws.String(objectKey),
 		Body:        bytes.NewReader(buffer),
 		ContentType: aws.String(file.Header.Get("Content-Type")),
 		ACL:         types.ObjectCannedACLPrivate,
-	})
+	}
+	s.applyUploadOptions(input, tags)
 
+	// S3 rejects the upload if the received content does not match
+	if s.checksums {
+		sum := sha256.Sum256(buffer)
+		input.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	putObjectOutput, err := s.client.PutObject(ctx, input)
 	if err != nil {
-		fmt.Printf("ERROR: S3 upload failed: %s\n", err)
-		fmt.Printf("=== END S3 UPLOAD (FAILED) ===\n\n")
 		return "", fmt.Errorf("failed to upload to S3: %w", err)
 	}
+	log.Debug("Uploaded file to S3", zap.Int("bytes", len(buffer)), zap.String("etag", aws.ToString(putObjectOutput.ETag)))
 
-	fmt.Printf("S3 PutObject successful\n")
-	fmt.Printf("Response ETag: %s\n", putObjectOutput.ETag)
+	return s.uploadedObjectURL(ctx, objectKey), nil
+}
+
+// UploadStream stores size bytes read from r under objectKey. Content larger
+// than the multipart threshold is streamed in parts.
+func (s *S3Service) UploadStream(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string, tags map[string]string) (err error) {
+	defer observeUpload(ctx, StorageBackendS3, size, time.Now(), &err)
+
+	if size > multipartUploadThreshold {
+		return s.uploadMultipart(ctx, r, size, contentType, objectKey, tags)
+	}
+
+	buffer := make([]byte, size)
+	if _, err := io.ReadFull(r, buffer); err != nil {
+		return fmt.Errorf("failed to read content: %w", err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(objectKey),
+		Body:        bytes.NewReader(buffer),
+		ContentType: aws.String(contentType),
+		ACL:         types.ObjectCannedACLPrivate,
+	}
+	s.applyUploadOptions(input, tags)
+	if s.checksums {
+		sum := sha256.Sum256(buffer)
+		input.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	if _, err := s.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+
+	return nil
+}
+
+// uploadMultipart streams a large upload to S3 in parts, logging progress
+// at debug level after each part. The upload is aborted if any part fails.
+func (s *S3Service) uploadMultipart(ctx context.Context, src io.Reader, size int64, contentType, objectKey string, tags map[string]string) (err error) {
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(objectKey),
+		ContentType: aws.String(contentType),
+		ACL:         types.ObjectCannedACLPrivate,
+	}
+	if s.sseMode != "" {
+		create.ServerSideEncryption = s.sseMode
+		if s.kmsKeyID != "" {
+			create.SSEKMSKeyId = aws.String(s.kmsKeyID)
+		}
+	}
+	if len(tags) > 0 {
+		create.Tagging = aws.String(encodeTags(tags))
+	}
+	if s.checksums {
+		create.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+	}
+
+	upload, err := s.client.CreateMultipartUpload(ctx, create)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	log := logger.FromContext(ctx, s.logger).With(zap.String("key", objectKey), zap.String("upload_id", aws.ToString(upload.UploadId)))
+	defer func() {
+		if err != nil {
+			// Don't leave incomplete parts behind, they are billed until aborted
+			_, abortErr := s.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(s.bucketName),
+				Key:      aws.String(objectKey),
+				UploadId: upload.UploadId,
+			})
+			if abortErr != nil {
+				log.Warn("Failed to abort multipart upload", zap.Error(abortErr))
+			}
+		}
+	}()
+
+	totalParts := (size + multipartPartSize - 1) / multipartPartSize
+	log.Debug("Starting multipart upload", zap.Int64("parts", totalParts), zap.Int64("size", size))
+
+	buf := make([]byte, multipartPartSize)
+	var parts []types.CompletedPart
+	var uploaded int64
+	for partNumber := int32(1); ; partNumber++ {
+		n, readErr := io.ReadFull(src, buf)
+		if n == 0 {
+			if readErr == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to read file content: %w", readErr)
+		}
+
+		input := &s3.UploadPartInput{
+			Bucket:        aws.String(s.bucketName),
+			Key:           aws.String(objectKey),
+			UploadId:      upload.UploadId,
+			PartNumber:    aws.Int32(partNumber),
+			Body:          bytes.NewReader(buf[:n]),
+			ContentLength: aws.Int64(int64(n)),
+		}
+		if s.checksums {
+			sum := sha256.Sum256(buf[:n])
+			input.ChecksumSHA256 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+		}
+
+		part, err := s.client.UploadPart(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+		}
+		parts = append(parts, types.CompletedPart{
+			ETag:           part.ETag,
+			PartNumber:     aws.Int32(partNumber),
+			ChecksumSHA256: part.ChecksumSHA256,
+		})
+
+		uploaded += int64(n)
+		log.Debug("Uploaded part",
+			zap.Int32("part", partNumber),
+			zap.Int64("parts", totalParts),
+			zap.Int64("uploaded", uploaded),
+			zap.Int64("size", size),
+		)
+
+		if readErr == io.ErrUnexpectedEOF || readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read file content: %w", readErr)
+		}
+	}
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucketName),
+		Key:             aws.String(objectKey),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	log.Info("Multipart upload complete", zap.Int64("bytes", uploaded), zap.Int("parts", len(parts)))
+	return nil
+}
+
+// uploadedObjectURL presigns a freshly uploaded object, falling back to its
+// unsigned URL if presigning fails
+func (s *S3Service) uploadedObjectURL(ctx context.Context, objectKey string) string {
+	presignedURL, err := s.PresignGetURL(ctx, objectKey)
+	if err != nil {
+		// Fall back to regular URL if presigning fails
+		logger.FromContext(ctx, s.logger).Warn("Failed to presign uploaded object, using its unsigned URL",
+			zap.String("key", objectKey), zap.Error(err))
+		return s.objectURL(objectKey)
+	}
+
+	// The URL itself is not logged, its signature grants access to the object
+	logger.FromContext(ctx, s.logger).Debug("Presigned uploaded object",
+		zap.String("key", objectKey), zap.Duration("expires_in", s.presignExpiry))
+	return presignedURL
+}
 
-	// Generate presigned URL with 7-day expiry
-	presignDuration := time.Hour * 24 * 7 // 7 days
+// PresignGetURL generates a fresh presigned GET URL for an existing object
+func (s *S3Service) PresignGetURL(ctx context.Context, objectKey string) (string, error) {
 	presignedReq, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucketName),
 		Key:    aws.String(objectKey),
 	}, func(opts *s3.PresignOptions) {
-		opts.Expires = presignDuration
+		opts.Expires = s.presignExpiry
 	})
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object %s: %w", objectKey, err)
+	}
+
+	return presignedReq.URL, nil
+}
+
+// PresignPutURL generates a presigned PUT URL a client can upload an object to.
+// Encryption and tagging headers are part of the signature, so the client must
+// send the returned headers unchanged.
+func (s *S3Service) PresignPutURL(ctx context.Context, objectKey, contentType, checksumSHA256 string, tags map[string]string, expires time.Duration) (string, map[string]string, error) {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(objectKey),
+		ContentType: aws.String(contentType),
+	}
+	s.applyUploadOptions(input, tags)
+
+	if s.checksums && checksumSHA256 != "" {
+		checksum, err := checksumHexToBase64(checksumSHA256)
+		if err != nil {
+			return "", nil, err
+		}
+		input.ChecksumSHA256 = aws.String(checksum)
+	}
+
+	presignedReq, err := s.presigner.PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
+		opts.Expires = expires
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to presign upload for %s: %w", objectKey, err)
+	}
+
+	headers := map[string]string{"Content-Type": contentType}
+	if input.Tagging != nil {
+		headers["x-amz-tagging"] = aws.ToString(input.Tagging)
+	}
+	if input.ServerSideEncryption != "" {
+		headers["x-amz-server-side-encryption"] = string(input.ServerSideEncryption)
+	}
+	if input.SSEKMSKeyId != nil {
+		headers["x-amz-server-side-encryption-aws-kms-key-id"] = aws.ToString(input.SSEKMSKeyId)
+	}
+	if input.ChecksumSHA256 != nil {
+		headers["x-amz-checksum-sha256"] = aws.ToString(input.ChecksumSHA256)
+	}
 
+	return presignedReq.URL, headers, nil
+}
+
+// TagObject merges tags into the existing tag set of an object
+func (s *S3Service) TagObject(ctx context.Context, objectKey string, tags map[string]string) error {
+	existing, err := s.client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
 	if err != nil {
-		fmt.Printf("ERROR: Failed to generate presigned URL: %s\n", err)
+		return fmt.Errorf("failed to get tags of object %s: %w", objectKey, err)
+	}
 
-		// Fall back to regular URL if presigning fails
-		var fileURL string
-		if s.baseURL != "" {
-			fileURL = fmt.Sprintf("%s/%s", s.baseURL, objectKey)
-		} else {
-			fileURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucketName, s.region, objectKey)
+	merged := make(map[string]string, len(existing.TagSet)+len(tags))
+	for _, tag := range existing.TagSet {
+		merged[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+
+	tagSet := make([]types.Tag, 0, len(merged))
+	for k, v := range merged {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+
+	_, err = s.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(s.bucketName),
+		Key:     aws.String(objectKey),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag object %s: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// applyUploadOptions sets encryption and tagging on an upload request
+func (s *S3Service) applyUploadOptions(input *s3.PutObjectInput, tags map[string]string) {
+	if s.sseMode != "" {
+		input.ServerSideEncryption = s.sseMode
+		if s.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(s.kmsKeyID)
 		}
+	}
 
-		fmt.Printf("WARNING: Using non-presigned URL as fallback: %s\n", fileURL)
-		fmt.Printf("=== END S3 UPLOAD (PARTIAL SUCCESS) ===\n\n")
-		return fileURL, nil
+	if len(tags) > 0 {
+		input.Tagging = aws.String(encodeTags(tags))
 	}
+}
 
-	// Log and return the presigned URL
-	fmt.Printf("Generated presigned URL (expires in 7 days): %s\n", presignedReq.URL)
-	fmt.Printf("=== END S3 UPLOAD (SUCCESS) ===\n\n")
+// encodeTags encodes object tags as a URL query string, the format of the
+// x-amz-tagging header
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
 
-	return presignedReq.URL, nil
+// StatObject returns the size and content type of an existing object
+func (s *S3Service) StatObject(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	}
+	if s.checksums {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+
+	head, err := s.client.HeadObject(ctx, input)
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to stat object %s: %w", objectKey, err)
+	}
+
+	info := &ObjectInfo{
+		Key:          objectKey,
+		Size:         aws.ToInt64(head.ContentLength),
+		ContentType:  aws.ToString(head.ContentType),
+		LastModified: aws.ToTime(head.LastModified),
+	}
+
+	// Multipart uploads have a composite checksum, which is not a content hash
+	if raw, err := base64.StdEncoding.DecodeString(aws.ToString(head.ChecksumSHA256)); err == nil && len(raw) == sha256.Size {
+		info.ChecksumSHA256 = hex.EncodeToString(raw)
+	}
+
+	return info, nil
+}
+
+// OpenObject streams the content of an existing object
+func (s *S3Service) OpenObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return nil, fmt.Errorf("failed to get object %s: %w", objectKey, err)
+	}
+
+	return out.Body, nil
+}
+
+// Ping checks that the bucket exists and is accessible
+func (s *S3Service) Ping(ctx context.Context) error {
+	if _, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucketName)}); err != nil {
+		return fmt.Errorf("failed to reach bucket %s: %w", s.bucketName, err)
+	}
+	return nil
+}
+
+// DeleteObject removes an object from the bucket
+func (s *S3Service) DeleteObject(ctx context.Context, objectKey string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// CopyObject copies an object within the bucket, keeping its tags and
+// applying the configured server-side encryption
+func (s *S3Service) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucketName),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(url.PathEscape(s.bucketName + "/" + srcKey)),
+		ACL:        types.ObjectCannedACLPrivate,
+	}
+	if s.sseMode != "" {
+		input.ServerSideEncryption = s.sseMode
+		if s.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+		}
+	}
+
+	if _, err := s.client.CopyObject(ctx, input); err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, srcKey)
+		}
+		return fmt.Errorf("failed to copy object %s to %s: %w", srcKey, dstKey, err)
+	}
+
+	return nil
+}
+
+// ListObjects calls fn for every object under prefix
+func (s *S3Service) ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects under %s: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			info := ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ArchiveObject transitions an object to the archive storage class by
+// copying it onto itself, keeping its metadata and tags
+func (s *S3Service) ArchiveObject(ctx context.Context, objectKey string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucketName),
+		Key:               aws.String(objectKey),
+		CopySource:        aws.String(url.PathEscape(s.bucketName + "/" + objectKey)),
+		StorageClass:      s.archiveClass,
+		MetadataDirective: types.MetadataDirectiveCopy,
+		TaggingDirective:  types.TaggingDirectiveCopy,
+	}
+	if s.sseMode != "" {
+		input.ServerSideEncryption = s.sseMode
+		if s.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+		}
+	}
+
+	if _, err := s.client.CopyObject(ctx, input); err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return fmt.Errorf("failed to archive object %s: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// ObjectKeyFromURL extracts the object key from a URL previously returned by
+// UploadFile. It is used for tickets stored before the key was persisted.
+func (s *S3Service) ObjectKeyFromURL(rawURL string) (string, error) {
+	return objectKeyFromURL(rawURL)
+}
+
+// objectURL builds the non-presigned URL of an object
+func (s *S3Service) objectURL(objectKey string) string {
+	if s.baseURL != "" {
+		return fmt.Sprintf("%s/%s", s.baseURL, objectKey)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucketName, s.region, objectKey)
 }
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supported values for the SCANNER_BACKEND setting
+const (
+	ScannerBackendNone   = "none"
+	ScannerBackendClamAV = "clamav"
+	ScannerBackendHTTP   = "http"
+)
+
+// ScanResult is the verdict of a malware scan. Suspicious files are not
+// rejected outright but quarantined for manual review.
+type ScanResult struct {
+	Infected   bool   `json:"infected"`
+	Suspicious bool   `json:"suspicious,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	Scanner    string `json:"-"`
+}
+
+// FileScanner scans file content for malware before it is stored
+type FileScanner interface {
+	Scan(ctx context.Context, r io.Reader) (*ScanResult, error)
+}
+
+// ErrMalwareDetected is returned when a scanned file is infected
+var ErrMalwareDetected = errors.New("malware detected")
+
+// ErrSuspiciousFile is returned when a scanned file should be quarantined
+var ErrSuspiciousFile = errors.New("suspicious file")
+
+// ErrScanFailed is returned when a file could not be scanned and the scanner
+// is configured to fail closed
+var ErrScanFailed = errors.New("malware scan failed")
+
+// ScanSubject identifies a scanned file in audit log entries
+type ScanSubject struct {
+	Filename  string
+	ObjectKey string
+	Product   string
+	UserEmail string
+	ClientIP  string
+}
+
+// UploadScanner applies the scanning policy to uploads and writes an audit
+// log entry for every rejected file. A nil UploadScanner accepts everything.
+type UploadScanner struct {
+	scanner  FileScanner
+	failOpen bool
+	audit    *zap.Logger
+}
+
+// NewUploadScanner creates an upload scanner. With failOpen, files are
+// accepted when the scanner is unreachable instead of being rejected.
+func NewUploadScanner(scanner FileScanner, failOpen bool, log *zap.Logger) *UploadScanner {
+	return &UploadScanner{
+		scanner:  scanner,
+		failOpen: failOpen,
+		audit:    log.Named("audit"),
+	}
+}
+
+// CheckUpload scans a multipart upload before it is stored
+func (s *UploadScanner) CheckUpload(ctx context.Context, file *multipart.FileHeader, subject ScanSubject) error {
+	if s == nil {
+		return nil
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	return s.Check(ctx, src, subject)
+}
+
+// Check scans r and returns ErrMalwareDetected if it is infected or
+// ErrSuspiciousFile if it must be quarantined. Scanner
+// errors are returned as ErrScanFailed unless the scanner fails open.
+func (s *UploadScanner) Check(ctx context.Context, r io.Reader, subject ScanSubject) error {
+	if s == nil {
+		return nil
+	}
+
+	result, err := s.scanner.Scan(ctx, r)
+	if err != nil {
+		if s.failOpen {
+			s.audit.Warn("Upload accepted without malware scan",
+				append(subject.fields(), zap.String("event", "upload_scan_skipped"), zap.Error(err))...,
+			)
+			return nil
+		}
+		s.audit.Warn("Upload rejected, malware scan failed",
+			append(subject.fields(), zap.String("event", "upload_scan_failed"), zap.Error(err))...,
+		)
+		return fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+
+	if result.Infected {
+		s.audit.Warn("Upload rejected, malware detected",
+			append(subject.fields(),
+				zap.String("event", "upload_rejected_malware"),
+				zap.String("scanner", result.Scanner),
+				zap.String("signature", result.Signature),
+			)...,
+		)
+		return fmt.Errorf("%w: %s", ErrMalwareDetected, result.Signature)
+	}
+
+	if result.Suspicious {
+		s.audit.Warn("Upload flagged as suspicious, quarantining",
+			append(subject.fields(),
+				zap.String("event", "upload_quarantined"),
+				zap.String("scanner", result.Scanner),
+				zap.String("signature", result.Signature),
+			)...,
+		)
+		return fmt.Errorf("%w: %s", ErrSuspiciousFile, result.Signature)
+	}
+
+	return nil
+}
+
+// fields returns the audit log fields identifying the subject
+func (s ScanSubject) fields() []zap.Field {
+	return []zap.Field{
+		zap.String("filename", s.Filename),
+		zap.String("key", s.ObjectKey),
+		zap.String("product", s.Product),
+		zap.String("user_email", s.UserEmail),
+		zap.String("client_ip", s.ClientIP),
+	}
+}
+
+// clamdChunkSize is the size of INSTREAM chunks sent to clamd
+const clamdChunkSize = 64 * 1024
+
+// clamdSuspiciousPrefixes are signature families reported by heuristic and
+// potentially-unwanted-application detection, which are prone to false
+// positives and are quarantined instead of rejected
+var clamdSuspiciousPrefixes = []string{"Heuristics.", "PUA."}
+
+// ClamAVScanner scans files with a clamd daemon using the INSTREAM command
+type ClamAVScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamAVScanner creates a clamd scanner. address is either
+// unix:///path/to/clamd.sock or tcp://host:port.
+func NewClamAVScanner(address string, timeout time.Duration) (*ClamAVScanner, error) {
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address: %w", err)
+	}
+
+	scanner := &ClamAVScanner{timeout: timeout}
+	switch parsed.Scheme {
+	case "unix":
+		scanner.network = "unix"
+		scanner.address = parsed.Path
+	case "tcp":
+		scanner.network = "tcp"
+		scanner.address = parsed.Host
+	default:
+		return nil, fmt.Errorf("unsupported clamd address scheme %q, use unix:// or tcp://", parsed.Scheme)
+	}
+
+	return scanner, nil
+}
+
+// Scan streams r to clamd and parses its verdict
+func (s *ClamAVScanner) Scan(ctx context.Context, r io.Reader) (*ScanResult, error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("failed to set clamd deadline: %w", err)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("failed to send INSTREAM to clamd: %w", err)
+	}
+
+	// Each chunk is prefixed with its length; a zero-length chunk ends the stream
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return nil, fmt.Errorf("failed to stream to clamd: %w", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return nil, fmt.Errorf("failed to stream to clamd: %w", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read file for scanning: %w", readErr)
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return nil, fmt.Errorf("failed to finish clamd stream: %w", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+
+	return parseClamdReply(string(reply))
+}
+
+// parseClamdReply parses replies such as "stream: OK" and
+// "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (*ScanResult, error) {
+	reply = strings.TrimRight(reply, "\x00\n")
+	verdict := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+
+	switch {
+	case verdict == "OK":
+		return &ScanResult{Scanner: ScannerBackendClamAV}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		signature := strings.TrimSuffix(verdict, " FOUND")
+		for _, prefix := range clamdSuspiciousPrefixes {
+			if strings.HasPrefix(signature, prefix) {
+				return &ScanResult{Suspicious: true, Signature: signature, Scanner: ScannerBackendClamAV}, nil
+			}
+		}
+		return &ScanResult{
+			Infected:  true,
+			Signature: signature,
+			Scanner:   ScannerBackendClamAV,
+		}, nil
+	default:
+		return nil, fmt.Errorf("clamd scan failed: %s", reply)
+	}
+}
+
+// HTTPScanner scans files with an external scanning API. The file is POSTed
+// as the request body and the API must answer with a JSON ScanResult, e.g.
+// {"infected": false, "suspicious": true, "signature": "..."}.
+type HTTPScanner struct {
+	client *http.Client
+	url    string
+	apiKey string
+}
+
+// NewHTTPScanner creates a scanner for an external scanning API
+func NewHTTPScanner(apiURL, apiKey string, timeout time.Duration) (*HTTPScanner, error) {
+	if apiURL == "" {
+		return nil, errors.New("scanner API URL is required")
+	}
+
+	return &HTTPScanner{
+		client: &http.Client{Timeout: timeout},
+		url:    apiURL,
+		apiKey: apiKey,
+	}, nil
+}
+
+// Scan submits r to the scanning API
+func (s *HTTPScanner) Scan(ctx context.Context, r io.Reader) (*ScanResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scan request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scan request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scan response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scan API returned status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var result ScanResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid scan response: %w", err)
+	}
+	result.Scanner = ScannerBackendHTTP
+
+	return &result, nil
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// ErrInvalidEnvelope is returned for request bodies that are not Sentry envelopes
+var ErrInvalidEnvelope = errors.New("invalid sentry envelope")
+
+// maxSentryBreadcrumbs caps the breadcrumbs copied into a ticket
+const maxSentryBreadcrumbs = 30
+
+// ParseSentryEnvelope returns the error events of a Sentry envelope. Other
+// items, such as sessions, transactions and client reports, are skipped.
+func ParseSentryEnvelope(r io.Reader) ([]models.SentryEvent, error) {
+	br := bufio.NewReader(r)
+
+	// The envelope header holds the event ID and DSN, which are not needed
+	if _, err := readEnvelopeLine(br); err != nil {
+		return nil, fmt.Errorf("%w: missing header: %w", ErrInvalidEnvelope, err)
+	}
+
+	var events []models.SentryEvent
+	for {
+		line, err := readEnvelopeLine(br)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEnvelope, err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var item struct {
+			Type   string `json:"type"`
+			Length *int   `json:"length"`
+		}
+		if err := json.Unmarshal(line, &item); err != nil {
+			return nil, fmt.Errorf("%w: item header: %w", ErrInvalidEnvelope, err)
+		}
+
+		var payload []byte
+		if item.Length != nil {
+			payload = make([]byte, *item.Length)
+			if _, err := io.ReadFull(br, payload); err != nil {
+				return nil, fmt.Errorf("%w: item payload: %w", ErrInvalidEnvelope, err)
+			}
+			// A newline may follow a payload of known length
+			if b, err := br.Peek(1); err == nil && b[0] == '\n' {
+				br.Discard(1)
+			}
+		} else if payload, err = readEnvelopeLine(br); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%w: item payload: %w", ErrInvalidEnvelope, err)
+		}
+
+		if item.Type != "event" {
+			continue
+		}
+
+		var event models.SentryEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("%w: event: %w", ErrInvalidEnvelope, err)
+		}
+		events = append(events, event)
+	}
+}
+
+// readEnvelopeLine reads a newline-terminated line without the newline. The
+// last line of an envelope may omit it.
+func readEnvelopeLine(br *bufio.Reader) ([]byte, error) {
+	line, err := br.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		return line, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return line[:len(line)-1], nil
+}
+
+// IsSentryErrorEvent reports whether an event describes an error worth a
+// ticket; events logged below error level are ignored
+func IsSentryErrorEvent(event *models.SentryEvent) bool {
+	switch event.Level {
+	case "", "error", "fatal":
+		return event.PrimaryException() != nil || event.MessageText() != ""
+	default:
+		return false
+	}
+}
+
+// SentryTicketRequest maps a Sentry event to a ticket request. The exception
+// becomes the issue and description, failed fetch/xhr breadcrumbs become the
+// failed network calls, and the event metadata is kept in the payload.
+func SentryTicketRequest(event *models.SentryEvent, product string) *models.TicketRequest {
+	issue := event.MessageText()
+	var description strings.Builder
+	if exc := event.PrimaryException(); exc != nil {
+		issue = exc.Type
+		if exc.Value != "" {
+			issue = fmt.Sprintf("%s: %s", exc.Type, exc.Value)
+		}
+		description.WriteString(issue)
+		if trace := sentryStackTrace(exc); trace != "" {
+			description.WriteString("\n\n{noformat}\n")
+			description.WriteString(trace)
+			description.WriteString("{noformat}")
+		}
+	} else {
+		description.WriteString(issue)
+	}
+	if issue == "" {
+		issue = "Error reported by Sentry SDK"
+	}
+
+	tags := event.TagMap()
+	if tagged := tags["product"]; tagged != "" {
+		product = tagged
+	}
+
+	var userEmail, userID, pageURL string
+	if event.User != nil {
+		userEmail = event.User.Email
+		userID = event.User.ID
+	}
+	if event.Request != nil {
+		pageURL = event.Request.URL
+	}
+
+	crumbs := event.BreadcrumbList()
+	if len(crumbs) > maxSentryBreadcrumbs {
+		crumbs = crumbs[len(crumbs)-maxSentryBreadcrumbs:]
+	}
+
+	headers := event.RequestHeaders()
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	return &models.TicketRequest{
+		URL: pageURL,
+		Payload: map[string]interface{}{
+			"issue":              issue,
+			"description":        description.String(),
+			"userEmail":          userEmail,
+			"leadId":             userID,
+			"product":            product,
+			"failedNetworkCalls": failedRequestBreadcrumbs(crumbs),
+			"breadcrumbs":        crumbs,
+			"tags":               tags,
+		},
+		Response: map[string]interface{}{
+			"status":      "reported",
+			"source":      "sentry",
+			"eventId":     event.EventID,
+			"level":       event.Level,
+			"platform":    event.Platform,
+			"environment": event.Environment,
+			"release":     event.Release,
+		},
+		RequestHeaders: headers,
+	}
+}
+
+// sentryStackTrace renders the frames of an exception, most recent call first
+func sentryStackTrace(exc *models.SentryException) string {
+	if exc.Stacktrace == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := exc.Stacktrace.Frames
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		function := f.Function
+		if function == "" {
+			function = "?"
+		}
+		file := f.Filename
+		if file == "" {
+			file = f.AbsPath
+		}
+		if file == "" {
+			file = f.Module
+		}
+		fmt.Fprintf(&b, "  at %s (%s:%d:%d)\n", function, file, f.Lineno, f.Colno)
+	}
+	return b.String()
+}
+
+// failedRequestBreadcrumbs returns the fetch and xhr breadcrumbs of requests
+// that failed, in the shape of the report-issue failedNetworkCalls
+func failedRequestBreadcrumbs(crumbs []models.SentryBreadcrumb) []map[string]interface{} {
+	calls := []map[string]interface{}{}
+	for _, crumb := range crumbs {
+		if crumb.Category != "fetch" && crumb.Category != "xhr" {
+			continue
+		}
+		status, _ := crumb.Data["status_code"].(float64)
+		if status < 400 && crumb.Level != "error" {
+			continue
+		}
+		calls = append(calls, map[string]interface{}{
+			"url":    crumb.Data["url"],
+			"method": crumb.Data["method"],
+			"status": int(status),
+		})
+	}
+	return calls
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.uber.org/zap"
+)
+
+// Limits of the similar ticket lookup of a new ticket
+const (
+	similarTicketsTimeout = 2 * time.Second
+	similarCandidates     = 500
+)
+
+// similarIssueWeight counts words of the issue more than words of the
+// description, which is longer and noisier
+const similarIssueWeight = 2
+
+// similarStopWords are common words that say nothing about a report
+var similarStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "not": true, "when": true, "with": true,
+	"this": true, "that": true, "was": true, "are": true, "but": true, "from": true,
+	"have": true, "has": true, "after": true, "can": true, "cannot": true, "does": true,
+	"doesn": true, "don": true, "won": true, "isn": true, "there": true, "then": true,
+	"into": true, "page": true, "app": true, "any": true, "all": true, "get": true,
+}
+
+// SimilarTickets finds recent open tickets of the same product whose issue
+// and description resemble those of a new ticket, so that reporters can see
+// it may already be reported. Reports are compared by the cosine similarity
+// of their words.
+type SimilarTickets struct {
+	mongoService *MongoDBService
+	window       time.Duration
+	threshold    float64
+	limit        int
+	redactor     *Redactor
+	logger       *zap.Logger
+}
+
+// NewSimilarTickets creates the lookup of up to limit tickets created within
+// window with a similarity of at least threshold. Their issues are redacted
+// with redactor, since they are shown to other reporters.
+func NewSimilarTickets(mongoService *MongoDBService, window time.Duration, threshold float64, limit int, redactor *Redactor, log *zap.Logger) *SimilarTickets {
+	return &SimilarTickets{
+		mongoService: mongoService,
+		window:       window,
+		threshold:    threshold,
+		limit:        limit,
+		redactor:     redactor,
+		logger:       log,
+	}
+}
+
+// Find returns the tickets similar to the new ticket with ticketID, most
+// similar first. A failed lookup is logged and finds none.
+func (s *SimilarTickets) Find(ctx context.Context, req *models.TicketRequest, ticketID string) []models.SimilarTicket {
+	product, _ := req.Payload["product"].(string)
+	ctx, cancel := context.WithTimeout(ctx, similarTicketsTimeout)
+	defer cancel()
+
+	candidates, err := s.mongoService.GetRecentOpenTickets(ctx, product, time.Now().Add(-s.window), similarCandidates)
+	if err != nil {
+		s.logger.Warn("Failed to look up similar tickets", zap.String("product", product), zap.Error(err))
+		return nil
+	}
+
+	issue, _ := req.Payload["issue"].(string)
+	description, _ := req.Payload["description"].(string)
+	terms := reportTerms(issue, description)
+	var similar []models.SimilarTicket
+	for _, candidate := range candidates {
+		if candidate.TicketID == ticketID {
+			continue
+		}
+		score := cosineSimilarity(terms, reportTerms(candidate.Issue, candidate.Description))
+		if score < s.threshold {
+			continue
+		}
+		similar = append(similar, models.SimilarTicket{
+			TicketID:  candidate.TicketID,
+			Issue:     scrubPII(s.redactor, candidate.Issue),
+			Status:    candidate.Status,
+			CreatedAt: candidate.CreatedAt,
+			Score:     math.Round(score*100) / 100,
+		})
+	}
+	sort.SliceStable(similar, func(i, j int) bool { return similar[i].Score > similar[j].Score })
+	if len(similar) > s.limit {
+		similar = similar[:s.limit]
+	}
+	return similar
+}
+
+// reportTerms counts the words of a report, lowercased, weighting those of
+// its issue
+func reportTerms(issue, description string) map[string]float64 {
+	terms := make(map[string]float64)
+	addTerms(terms, issue, similarIssueWeight)
+	addTerms(terms, description, 1)
+	return terms
+}
+
+func addTerms(terms map[string]float64, text string, weight float64) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if len(word) < 3 || similarStopWords[word] {
+			continue
+		}
+		terms[word] += weight
+	}
+}
+
+// cosineSimilarity returns the cosine of the angle between two term vectors,
+// 0 when either is empty
+func cosineSimilarity(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for term, weight := range a {
+		dot += weight * b[term]
+		normA += weight * weight
+	}
+	for _, weight := range b {
+		normB += weight * weight
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SpooledUpload is an uploaded file copied to disk, so it outlives the
+// request it was uploaded with
+type SpooledUpload struct {
+	Path        string `json:"path"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+}
+
+// SpoolUpload copies an uploaded file into dir
+func SpoolUpload(file *multipart.FileHeader, dir string) (*SpooledUpload, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer src.Close()
+
+	path := filepath.Join(dir, uuid.NewString()+filepath.Ext(file.Filename))
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to spool upload: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to spool upload: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to spool upload: %w", err)
+	}
+
+	return &SpooledUpload{Path: path, Filename: file.Filename, ContentType: file.Header.Get("Content-Type")}, nil
+}
+
+// SpoolObject copies a stored object into dir, to be opened as an upload
+func SpoolObject(ctx context.Context, storage ObjectStorage, objectKey, filename, contentType, dir string) (*SpooledUpload, error) {
+	src, err := storage.OpenObject(ctx, objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object: %w", err)
+	}
+	defer src.Close()
+
+	path := filepath.Join(dir, uuid.NewString()+filepath.Ext(filename))
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to spool object: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to spool object: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to spool object: %w", err)
+	}
+
+	return &SpooledUpload{Path: path, Filename: filename, ContentType: contentType}, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// Open turns the spooled file back into an upload. The returned function
+// removes the upload and the spooled file.
+func (u *SpooledUpload) Open() (*multipart.FileHeader, func(), error) {
+	src, err := os.Open(u.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open spooled upload: %w", err)
+	}
+	defer src.Close()
+
+	// Reading the file as a multipart form yields a regular upload, with
+	// large files kept in temporary files
+	body, w := io.Pipe()
+	mw := multipart.NewWriter(w)
+	go func() {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, quoteEscaper.Replace(u.Filename)))
+		if u.ContentType != "" {
+			header.Set("Content-Type", u.ContentType)
+		}
+		part, err := mw.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, src)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		w.CloseWithError(err)
+	}()
+
+	form, err := multipart.NewReader(body, mw.Boundary()).ReadForm(8 << 20)
+	body.CloseWithError(err)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read spooled upload: %w", err)
+	}
+	if len(form.File["file"]) == 0 {
+		form.RemoveAll()
+		return nil, nil, fmt.Errorf("failed to read spooled upload %s", u.Path)
+	}
+
+	release := func() {
+		form.RemoveAll()
+		os.Remove(u.Path)
+	}
+	return form.File["file"][0], release, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Backoff between attempts to initialize a dependency that was unreachable
+// at startup
+const (
+	initRetryMinBackoff = time.Second
+	initRetryMaxBackoff = time.Minute
+	initAttemptTimeout  = 10 * time.Second
+)
+
+// RetryInit returns a worker calling init until it succeeds, backing off
+// from one second to a minute between attempts, so a dependency that was
+// unreachable at startup is set up once it returns without delaying the
+// start of the API
+func RetryInit(name string, init func(ctx context.Context) error, log *zap.Logger) Worker {
+	return func(ctx context.Context, stopping <-chan struct{}) {
+		backoff := initRetryMinBackoff
+		for attempt := 1; ; attempt++ {
+			select {
+			case <-stopping:
+				return
+			case <-time.After(backoff):
+			}
+
+			attemptCtx, cancel := context.WithTimeout(ctx, initAttemptTimeout)
+			err := init(attemptCtx)
+			cancel()
+			if err != nil {
+				backoff = min(2*backoff, initRetryMaxBackoff)
+				log.Warn("Dependency still unavailable",
+					zap.String("dependency", name),
+					zap.Int("attempt", attempt),
+					zap.Duration("retry_in", backoff),
+					zap.Error(err),
+				)
+				continue
+			}
+			log.Info("Dependency initialized", zap.String("dependency", name), zap.Int("attempts", attempt))
+			return
+		}
+	}
+}
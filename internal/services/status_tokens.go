@@ -0,0 +1,106 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Errors returned when verifying status page tokens
+var (
+	ErrInvalidStatusToken = errors.New("invalid status token")
+	ErrStatusTokenExpired = errors.New("status token expired")
+)
+
+// StatusClaims identifies the submissions a status page token grants access
+// to: every ticket reported with Email, or only TicketID for anonymous reports
+type StatusClaims struct {
+	TicketID  string `json:"t"`
+	Email     string `json:"e,omitempty"`
+	ExpiresAt int64  `json:"x,omitempty"`
+}
+
+// StatusTokens issues and verifies the signed tokens of the reporter status
+// page. Tokens are HMAC-SHA256 signed claims, so no state is stored.
+type StatusTokens struct {
+	secret  []byte
+	ttl     time.Duration
+	baseURL string
+}
+
+// NewStatusTokens creates a token issuer; tokens expire after ttl (0 means
+// never) and their URLs are built on baseURL
+func NewStatusTokens(secret string, ttl time.Duration, baseURL string) *StatusTokens {
+	return &StatusTokens{
+		secret:  []byte(secret),
+		ttl:     ttl,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// Issue returns a token for the submissions of email, or for ticketID alone
+// when the report was anonymous
+func (t *StatusTokens) Issue(ticketID, email string) (string, error) {
+	claims := StatusClaims{
+		TicketID: ticketID,
+		Email:    strings.ToLower(strings.TrimSpace(email)),
+	}
+	if t.ttl > 0 {
+		claims.ExpiresAt = time.Now().Add(t.ttl).Unix()
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode status token: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(t.sign(encoded)), nil
+}
+
+// URL returns the status page URL of a newly issued token
+func (t *StatusTokens) URL(ticketID, email string) (string, error) {
+	token, err := t.Issue(ticketID, email)
+	if err != nil {
+		return "", err
+	}
+	return t.baseURL + "/" + token, nil
+}
+
+// Verify checks the signature and expiry of a token and returns its claims
+func (t *StatusTokens) Verify(token string) (*StatusClaims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidStatusToken
+	}
+
+	provided, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(provided, t.sign(encoded)) {
+		return nil, ErrInvalidStatusToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidStatusToken
+	}
+	var claims StatusClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.TicketID == "" {
+		return nil, ErrInvalidStatusToken
+	}
+
+	if claims.ExpiresAt > 0 && time.Now().Unix() > claims.ExpiresAt {
+		return nil, ErrStatusTokenExpired
+	}
+	return &claims, nil
+}
+
+func (t *StatusTokens) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Statuspage API and management addresses
+const (
+	statuspageAPIURL    = "https://api.statuspage.io/v1"
+	statuspageManageURL = "https://manage.statuspage.io"
+)
+
+// statuspageTimeout bounds the creation of an incident and the comments
+// linking it
+const statuspageTimeout = 10 * time.Second
+
+// StatuspageClient creates incidents on a Statuspage page
+type StatuspageClient struct {
+	apiKey string
+	pageID string
+	client *http.Client
+}
+
+// NewStatuspageClient creates a client of the page with pageID,
+// authenticated with an API key of its organization
+func NewStatuspageClient(apiKey, pageID string) *StatuspageClient {
+	return &StatuspageClient{
+		apiKey: apiKey,
+		pageID: pageID,
+		client: &http.Client{Timeout: statuspageTimeout},
+	}
+}
+
+// CreateIncident opens an investigating incident of components, without
+// notifying the page's subscribers, and returns the link managing it
+func (c *StatuspageClient) CreateIncident(ctx context.Context, name, body string, componentIDs []string) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"incident": map[string]interface{}{
+			"name":                  name,
+			"status":                "investigating",
+			"body":                  body,
+			"component_ids":         componentIDs,
+			"deliver_notifications": false,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode Statuspage incident: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/pages/%s/incidents", statuspageAPIURL, url.PathEscape(c.pageID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Statuspage request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "OAuth "+c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Statuspage incident: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("Statuspage answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var incident struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&incident); err != nil {
+		return "", fmt.Errorf("failed to decode Statuspage incident: %w", err)
+	}
+	return fmt.Sprintf("%s/pages/%s/incidents/%s", statuspageManageURL, url.PathEscape(c.pageID), url.PathEscape(incident.ID)), nil
+}
+
+// IncidentSuggester opens a Statuspage incident when a product gets
+// threshold reports of failed requests to the same endpoint within window,
+// and links it in their tickets. Later reports of the endpoint are linked to
+// the same incident until none came for a window. Reports are counted per
+// instance.
+type IncidentSuggester struct {
+	statuspage *StatuspageClient
+	components map[string]string // Statuspage component IDs by product
+	threshold  int
+	window     time.Duration
+	logger     *zap.Logger
+
+	mu        sync.Mutex
+	endpoints map[string]*endpointReports
+}
+
+// endpointReports are the recent reports of failed requests to an endpoint
+// of a product, and the incident suggested for them
+type endpointReports struct {
+	reports  []endpointReport
+	incident string
+	pending  bool
+}
+
+type endpointReport struct {
+	at       time.Time
+	ticketID string
+}
+
+// NewIncidentSuggester creates the suggester of incidents of the products
+// of components
+func NewIncidentSuggester(statuspage *StatuspageClient, components map[string]string, threshold int, window time.Duration, log *zap.Logger) *IncidentSuggester {
+	return &IncidentSuggester{
+		statuspage: statuspage,
+		components: components,
+		threshold:  threshold,
+		window:     window,
+		logger:     log,
+		endpoints:  make(map[string]*endpointReports),
+	}
+}
+
+// Observe counts a new ticket towards the endpoints of its failed network
+// calls, suggesting an incident for those that reached the threshold.
+// tracker is the tracker of the ticket and its product.
+func (s *IncidentSuggester) Observe(ctx context.Context, tracker IssueTracker, req *models.TicketRequest, ticket *models.TicketResponse) {
+	product, _ := req.Payload["product"].(string)
+	seen := make(map[string]bool)
+	for _, endpoint := range failedEndpoints(req.Payload["failedNetworkCalls"]) {
+		name := strings.TrimSpace(strings.ToUpper(endpoint.method) + " " + endpointPattern(endpoint.path))
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		s.observe(ctx, tracker, product, name, ticket.TicketID)
+	}
+}
+
+func (s *IncidentSuggester) observe(ctx context.Context, tracker IssueTracker, product, endpoint, ticketID string) {
+	now := time.Now()
+	key := product + "\x00" + endpoint
+
+	s.mu.Lock()
+	s.expire(now)
+	reports := s.endpoints[key]
+	if reports == nil {
+		reports = &endpointReports{}
+		s.endpoints[key] = reports
+	}
+	reports.reports = append(reports.reports, endpointReport{at: now, ticketID: ticketID})
+	incident := reports.incident
+	suggest := incident == "" && !reports.pending && len(reports.reports) >= s.threshold
+	if suggest {
+		reports.pending = true
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), statuspageTimeout)
+	defer cancel()
+	log := logger.FromContext(ctx, s.logger).With(zap.String("product", product), zap.String("endpoint", endpoint))
+
+	if incident != "" {
+		s.link(ctx, tracker, ticketID, incident, endpoint, log)
+		return
+	}
+	if !suggest {
+		return
+	}
+
+	name := "Investigating errors"
+	if product != "" {
+		name = "Investigating errors in " + product
+	}
+	componentIDs := []string{}
+	if id := s.components[product]; id != "" {
+		componentIDs = append(componentIDs, id)
+	}
+	incident, err := s.statuspage.CreateIncident(ctx, name, "We are investigating reports of errors and will post an update shortly.", componentIDs)
+
+	// Reports that came in meanwhile are linked too
+	s.mu.Lock()
+	reports.pending = false
+	var ticketIDs []string
+	if err == nil {
+		reports.incident = incident
+		for _, report := range reports.reports {
+			ticketIDs = append(ticketIDs, report.ticketID)
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		// The next report of the endpoint tries again
+		log.Error("Failed to create Statuspage incident", zap.Error(err))
+		return
+	}
+
+	log.Info("Suggested Statuspage incident", zap.String("incident", incident), zap.Strings("ticket_ids", ticketIDs))
+	for _, id := range ticketIDs {
+		s.link(ctx, tracker, id, incident, endpoint, log)
+	}
+}
+
+// link comments the suggested incident on a ticket
+func (s *IncidentSuggester) link(ctx context.Context, tracker IssueTracker, ticketID, incident, endpoint string, log *zap.Logger) {
+	body := fmt.Sprintf("A Statuspage incident was opened without notifying subscribers after %d or more reports of failed requests to %s within %s. Update or resolve it: %s",
+		s.threshold, endpoint, s.window, incident)
+	if err := tracker.AddComment(ctx, ticketID, "Statuspage", body); err != nil {
+		log.Warn("Failed to link Statuspage incident", zap.String("ticket_id", ticketID), zap.Error(err))
+	}
+}
+
+// expire drops reports older than the window, and endpoints without any,
+// ending their incident. It must be called with mu held.
+func (s *IncidentSuggester) expire(now time.Time) {
+	cutoff := now.Add(-s.window)
+	for key, reports := range s.endpoints {
+		kept := reports.reports[:0]
+		for _, report := range reports.reports {
+			if report.at.After(cutoff) {
+				kept = append(kept, report)
+			}
+		}
+		reports.reports = kept
+		if len(kept) == 0 && !reports.pending {
+			delete(s.endpoints, key)
+		}
+	}
+}
+
+// endpointPattern replaces the IDs in a request path, segments with digits
+// other than version prefixes like v1, with :id so that requests for
+// different records count as the same endpoint
+func endpointPattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isVersionSegment(segment) || !strings.ContainsFunc(segment, unicode.IsDigit) {
+			continue
+		}
+		segments[i] = ":id"
+	}
+	return strings.Join(segments, "/")
+}
+
+func isVersionSegment(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
+	}
+	for _, r := range segment[1:] {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported values for the STORAGE_BACKEND setting
+const (
+	StorageBackendS3    = "s3"
+	StorageBackendGCS   = "gcs"
+	StorageBackendAzure = "azure"
+	StorageBackendMinIO = "minio"
+	StorageBackendLocal = "local"
+)
+
+// DefaultPresignExpiry is the lifetime of presigned GET URLs. S3 caps SigV4
+// presigned URLs at 7 days.
+const DefaultPresignExpiry = time.Hour * 24 * 7
+
+// uploadKeyPrefix is the default prefix under which report uploads are stored
+const uploadKeyPrefix = "uploads/ronnin/"
+
+// ObjectStorage is the blob store used for report attachments. Every backend
+// returns time-limited URLs that can be embedded in Jira tickets.
+type ObjectStorage interface {
+	// UploadFile stores an uploaded file under objectKey with the given tags and returns a signed URL
+	UploadFile(ctx context.Context, file *multipart.FileHeader, objectKey string, tags map[string]string) (string, error)
+	// UploadStream stores size bytes read from r under objectKey with the given tags
+	UploadStream(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string, tags map[string]string) error
+	// PresignGetURL generates a fresh signed URL for an existing object
+	PresignGetURL(ctx context.Context, objectKey string) (string, error)
+	// ObjectKeyFromURL extracts the object key from a URL returned by UploadFile
+	ObjectKeyFromURL(rawURL string) (string, error)
+	// PresignExpiry returns how long generated URLs stay valid
+	PresignExpiry() time.Duration
+	// PresignPutURL generates a signed URL a client can upload an object to
+	// directly, along with the headers the client must send with the upload.
+	// A non-empty hex-encoded checksumSHA256 is enforced by backends that support it.
+	PresignPutURL(ctx context.Context, objectKey, contentType, checksumSHA256 string, tags map[string]string, expires time.Duration) (string, map[string]string, error)
+	// StatObject returns metadata of an existing object
+	StatObject(ctx context.Context, objectKey string) (*ObjectInfo, error)
+	// TagObject adds tags to an existing object, keeping its other tags
+	TagObject(ctx context.Context, objectKey string, tags map[string]string) error
+	// OpenObject streams the content of an existing object
+	OpenObject(ctx context.Context, objectKey string) (io.ReadCloser, error)
+	// DeleteObject removes an object
+	DeleteObject(ctx context.Context, objectKey string) error
+	// CopyObject copies an existing object to a new key
+	CopyObject(ctx context.Context, srcKey, dstKey string) error
+	// ListObjects calls fn for every object whose key starts with prefix
+	ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	// ArchiveObject moves an object to the backend's archive storage tier
+	ArchiveObject(ctx context.Context, objectKey string) error
+	// Ping checks that the bucket or container can be reached
+	Ping(ctx context.Context) error
+}
+
+// ObjectInfo describes a stored object. ChecksumSHA256 is hex-encoded and
+// only set by backends that store content checksums.
+type ObjectInfo struct {
+	Key            string
+	Size           int64
+	ContentType    string
+	ChecksumSHA256 string
+	LastModified   time.Time
+}
+
+// ErrPresignedUploadNotSupported is returned by backends that cannot accept
+// direct client uploads
+var ErrPresignedUploadNotSupported = errors.New("presigned uploads are not supported by this storage backend")
+
+// ErrArchiveNotSupported is returned by backends without an archive tier
+var ErrArchiveNotSupported = errors.New("archive storage is not supported by this storage backend")
+
+// ErrObjectNotFound is returned when a referenced object does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// readUpload reads the full content of a multipart upload
+func readUpload(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	buffer := make([]byte, file.Size)
+	if _, err := io.ReadFull(src, buffer); err != nil {
+		return nil, fmt.Errorf("failed to read file content: %w", err)
+	}
+
+	return buffer, nil
+}
+
+// ChecksumUpload returns the hex-encoded SHA-256 of a multipart upload
+func ChecksumUpload(file *multipart.FileHeader) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, src); err != nil {
+		return "", fmt.Errorf("failed to checksum uploaded file: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// FindDuplicateUpload returns a stored attachment with the same content, so
+// identical uploads can reuse its object. It returns nil when the content is
+// unknown, the object no longer exists, or MongoDB is not configured.
+func FindDuplicateUpload(ctx context.Context, storage ObjectStorage, ms *MongoDBService, checksum string) (*Attachment, error) {
+	if ms == nil || checksum == "" {
+		return nil, nil
+	}
+
+	existing, err := ms.FindAttachmentByChecksum(ctx, checksum)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+
+	if _, err := storage.StatObject(ctx, existing.ObjectKey); err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	uploadDedupHitsTotal.Inc()
+	return existing, nil
+}
+
+// checksumHexToBase64 converts a hex-encoded SHA-256 to the base64 form used
+// in x-amz-checksum-sha256 headers
+func checksumHexToBase64(checksum string) (string, error) {
+	raw, err := hex.DecodeString(checksum)
+	if err != nil || len(raw) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 checksum: %s", checksum)
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// objectKeyFromURL extracts an upload object key from any backend URL. Only
+// keys under the default prefix can be recovered; newer tickets store the key.
+func objectKeyFromURL(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid object URL: %w", err)
+	}
+
+	idx := strings.Index(parsed.Path, uploadKeyPrefix)
+	if idx < 0 {
+		return "", fmt.Errorf("URL does not reference an uploaded object: %s", parsed.Path)
+	}
+
+	return parsed.Path[idx:], nil
+}
+
+// normalizePresignExpiry clamps the configured expiry to the supported range
+func normalizePresignExpiry(expiry time.Duration) time.Duration {
+	if expiry <= 0 || expiry > DefaultPresignExpiry {
+		return DefaultPresignExpiry
+	}
+	return expiry
+}
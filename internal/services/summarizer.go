@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.uber.org/zap"
+)
+
+// Providers of report summaries
+const (
+	SummaryProviderNone   = "none"
+	SummaryProviderOpenAI = "openai"
+	SummaryProviderAzure  = "azure"
+	SummaryProviderCustom = "custom"
+)
+
+// openAIChatURL is the chat completions endpoint of the OpenAI API
+const openAIChatURL = "https://api.openai.com/v1/chat/completions"
+
+// Limits of summaries. Input is estimated at four bytes per token.
+const (
+	summaryMaxOutputTokens = 300
+	summaryMaxTitle        = 120
+	summaryMaxBullet       = 300
+	summaryBullets         = 3
+	summaryMaxCallBody     = 300
+	summaryBytesPerToken   = 4
+)
+
+// summarySystemPrompt instructs the model on the shape and content of
+// summaries
+const summarySystemPrompt = `You summarize bug reports for support engineers triaging them in an issue tracker.
+Reply with a JSON object {"title": string, "bullets": [string, string, string]}.
+The title names the problem in at most 80 characters. The three bullets say, in one sentence each, what the user saw, which requests failed and how, and what to check first.
+Use only facts from the report. Never include names, email addresses, phone numbers, account, card or ID numbers, URLs with query strings, or credentials.`
+
+// piiPatterns catch personal data the redactor's rules may not cover before
+// a report leaves for the model, and in what the model answers
+var piiPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`(?:\+\d{1,3}[ -]?)?(?:\(\d{2,4}\)[ -]?)?\b\d{3,5}[ -]\d{3,5}(?:[ -]\d{3,5})?\b|\b\d{10,13}\b`),
+	regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+}
+
+// Summarizer asks a language model for a concise title and a three-bullet
+// summary of new reports, through the chat completions API of OpenAI, Azure
+// OpenAI or a self-hosted compatible server. Reports are guarded on the way
+// out and back: only the issue, description, product, page path and failed
+// calls are sent, redacted and stripped of personal data, within a token
+// budget; answers that are not a short title and exactly three short bullets
+// are discarded, and accepted ones are redacted again.
+type Summarizer struct {
+	endpoint       string
+	authHeader     string
+	authValue      string
+	model          string
+	maxInputTokens int
+	redactor       *Redactor
+	client         *http.Client
+	logger         *zap.Logger
+}
+
+// NewSummarizer creates a summarizer of a provider. baseURL is the Azure
+// OpenAI resource endpoint, or the base URL of the OpenAI-compatible API of
+// the custom provider, e.g. http://llm.internal:8000/v1; model is the Azure
+// deployment name for Azure.
+func NewSummarizer(provider, baseURL, apiKey, model, azureAPIVersion string, maxInputTokens int, timeout time.Duration, redactor *Redactor, log *zap.Logger) (*Summarizer, error) {
+	s := &Summarizer{
+		model:          model,
+		maxInputTokens: maxInputTokens,
+		redactor:       redactor,
+		client:         &http.Client{Timeout: timeout},
+		logger:         log,
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	switch provider {
+	case SummaryProviderOpenAI:
+		s.endpoint = openAIChatURL
+		s.authHeader, s.authValue = "Authorization", "Bearer "+apiKey
+	case SummaryProviderAzure:
+		if baseURL == "" {
+			return nil, fmt.Errorf("the Azure OpenAI endpoint is required")
+		}
+		s.endpoint = fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+			baseURL, url.PathEscape(model), url.QueryEscape(azureAPIVersion))
+		s.authHeader, s.authValue = "api-key", apiKey
+	case SummaryProviderCustom:
+		if baseURL == "" {
+			return nil, fmt.Errorf("the URL of the summary API is required")
+		}
+		s.endpoint = baseURL + "/chat/completions"
+		if apiKey != "" {
+			s.authHeader, s.authValue = "Authorization", "Bearer "+apiKey
+		}
+	default:
+		return nil, fmt.Errorf("unknown summary provider %q", provider)
+	}
+	return s, nil
+}
+
+// Summarize returns the summary of a report, or nil when the model fails or
+// its answer is discarded, which is logged
+func (s *Summarizer) Summarize(ctx context.Context, req *models.TicketRequest) *models.ReportSummary {
+	summary, err := s.summarize(ctx, s.reportText(req))
+	if err != nil {
+		s.logger.Warn("Failed to summarize report", zap.Error(err))
+		return nil
+	}
+	return summary
+}
+
+func (s *Summarizer) summarize(ctx context.Context, report string) (*models.ReportSummary, error) {
+	content, err := s.complete(ctx, summarySystemPrompt, report)
+	if err != nil {
+		return nil, err
+	}
+	return s.checkSummary(content)
+}
+
+// complete sends a report to the model with instructions and returns its
+// JSON answer
+func (s *Summarizer) complete(ctx context.Context, instructions, report string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": s.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": instructions},
+			{"role": "user", "content": report},
+		},
+		"max_tokens":      summaryMaxOutputTokens,
+		"temperature":     0.2,
+		"response_format": map[string]string{"type": "json_object"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode summary request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create summary request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if s.authHeader != "" {
+		httpReq.Header.Set(s.authHeader, s.authValue)
+	}
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to call summary API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("summary API answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", fmt.Errorf("failed to decode summary response: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("summary API returned no choices")
+	}
+	if reason := completion.Choices[0].FinishReason; reason != "" && reason != "stop" {
+		return "", fmt.Errorf("summary was cut short: %s", reason)
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// checkSummary parses the model's answer, discarding it unless it is a title
+// and exactly three bullets within their limits, and redacts it
+func (s *Summarizer) checkSummary(content string) (*models.ReportSummary, error) {
+	var answer struct {
+		Title   string   `json:"title"`
+		Bullets []string `json:"bullets"`
+	}
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return nil, fmt.Errorf("summary is not a JSON object: %w", err)
+	}
+
+	title := strings.Join(strings.Fields(answer.Title), " ")
+	if title == "" || utf8.RuneCountInString(title) > summaryMaxTitle {
+		return nil, fmt.Errorf("summary title is empty or longer than %d characters", summaryMaxTitle)
+	}
+	if len(answer.Bullets) != summaryBullets {
+		return nil, fmt.Errorf("summary has %d bullets instead of %d", len(answer.Bullets), summaryBullets)
+	}
+	summary := &models.ReportSummary{Title: s.scrub(title)}
+	for _, bullet := range answer.Bullets {
+		bullet = strings.Join(strings.Fields(bullet), " ")
+		if bullet == "" || utf8.RuneCountInString(bullet) > summaryMaxBullet {
+			return nil, fmt.Errorf("summary bullet is empty or longer than %d characters", summaryMaxBullet)
+		}
+		summary.Bullets = append(summary.Bullets, s.scrub(bullet))
+	}
+	return summary, nil
+}
+
+// reportText renders the parts of a report the model sees, scrubbed and cut
+// to the input token budget
+func (s *Summarizer) reportText(req *models.TicketRequest) string {
+	var b strings.Builder
+	for _, field := range []struct{ label, key string }{
+		{"Product", "product"},
+		{"Issue", "issue"},
+		{"Description", "description"},
+	} {
+		if value, _ := req.Payload[field.key].(string); value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", field.label, value)
+		}
+	}
+	if page := urlPath(req.URL); page != "" {
+		fmt.Fprintf(&b, "Page: %s\n", page)
+	}
+
+	calls := failedCalls(req.Payload["failedNetworkCalls"])
+	if len(calls) > 0 {
+		b.WriteString("Failed network calls:\n")
+	}
+	for _, call := range calls {
+		body := call.ResponseBody
+		if len(body) > summaryMaxCallBody {
+			body = truncateUTF8(body, summaryMaxCallBody) + "..."
+		}
+		fmt.Fprintf(&b, "- %s %s answered %d: %s\n", call.RequestData.Method, urlPath(call.RequestData.URL), call.ResponseStatus, body)
+	}
+
+	text := s.scrub(b.String())
+	if limit := s.maxInputTokens * summaryBytesPerToken; len(text) > limit {
+		text = truncateUTF8(text, limit)
+	}
+	return text
+}
+
+// scrub redacts text and replaces the personal data of piiPatterns
+func (s *Summarizer) scrub(text string) string {
+	return scrubPII(s.redactor, text)
+}
+
+// scrubPII redacts text with redactor, which may be nil, and replaces the
+// personal data of piiPatterns
+func scrubPII(redactor *Redactor, text string) string {
+	text = redactor.String(text)
+	for _, pattern := range piiPatterns {
+		text = pattern.ReplaceAllString(text, RedactedText)
+	}
+	return text
+}
+
+// urlPath returns the path of a URL, leaving out its query and fragment
+func urlPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,491 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// tenantsCollection holds the tenants and their settings
+const tenantsCollection = "tenants"
+
+// tenantRefreshInterval is how often instances pick up the tenants changed
+// on another instance
+const tenantRefreshInterval = 30 * time.Second
+
+// Errors returned by the tenant store
+var (
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrTenantExists        = errors.New("a tenant with this ID already exists")
+	ErrTenantProjectTaken  = errors.New("the Jira project is already used by another tenant or issue tracker")
+	ErrTenantUnavailable   = errors.New("the issue tracker of the tenant could not be set up")
+	ErrTenantsNotAvailable = errors.New("tenants can only be managed when MongoDB is configured")
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant work is done for, so
+// its tickets are tagged with it and filed, stored and announced with its
+// settings. An empty tenant is the deployment itself.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	if tenant == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantID returns the tenant carried by ctx, or ""
+func TenantID(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// TenantClients creates the clients of the settings of a tenant. Either
+// may return nil when the tenant has no such settings.
+type TenantClients struct {
+	Tracker func(tenant *models.Tenant, roster *Roster) (IssueTracker, error)
+	Storage func(tenant *models.Tenant) (ObjectStorage, error)
+}
+
+// tenant is a tenant with the clients of its settings
+type tenant struct {
+	models.Tenant
+	tracker       IssueTracker
+	storage       ObjectStorage
+	notifications []NotificationRoute
+	// err is why the tracker or storage of the tenant could not be created
+	err error
+}
+
+// Tenants holds the tenants stored in MongoDB, with clients of their Jira,
+// storage and notification settings. Changes made on another instance are
+// picked up by Run.
+type Tenants struct {
+	mongoService *MongoDBService
+	clients      TenantClients
+	logger       *zap.Logger
+
+	mu       sync.RWMutex
+	roster   *Roster
+	tenants  map[string]*tenant
+	projects map[string]string // project keys to tenant IDs
+}
+
+// NewTenants creates the tenant store, empty until Run loads the tenants
+func NewTenants(ms *MongoDBService, clients TenantClients, roster *Roster, log *zap.Logger) *Tenants {
+	return &Tenants{
+		mongoService: ms,
+		clients:      clients,
+		logger:       log,
+		roster:       roster,
+		tenants:      make(map[string]*tenant),
+		projects:     make(map[string]string),
+	}
+}
+
+// Get returns a tenant, with its secrets
+func (t *Tenants) Get(id string) (*models.Tenant, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	found, ok := t.tenants[id]
+	if !ok {
+		return nil, false
+	}
+	tenant := found.Tenant
+	return &tenant, true
+}
+
+// List returns the tenants by ID, with their secrets
+func (t *Tenants) List() []models.Tenant {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	tenants := make([]models.Tenant, 0, len(t.tenants))
+	for _, found := range t.tenants {
+		tenants = append(tenants, found.Tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// Tracker returns the issue tracker new tickets of a tenant are created in,
+// or nil when the tenant uses the trackers of the deployment
+func (t *Tenants) Tracker(id string) (IssueTracker, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	found, ok := t.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, id)
+	}
+	if found.Jira != nil && found.tracker == nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrTenantUnavailable, id, found.err)
+	}
+	return found.tracker, nil
+}
+
+// TrackerForProject returns the tracker of the tenant using a Jira project,
+// or nil when no tenant uses it
+func (t *Tenants) TrackerForProject(projectKey string) IssueTracker {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if id, ok := t.projects[projectKey]; ok {
+		return t.tenants[id].tracker
+	}
+	return nil
+}
+
+// TicketContext returns ctx carrying the tenant a ticket is looked up in:
+// the tenant ctx already carries, or else the tenant using the Jira project
+// of the ticket ID, so callers acting for the deployment find the tickets
+// of every tenant
+func (t *Tenants) TicketContext(ctx context.Context, ticketID string) context.Context {
+	if t == nil || TenantID(ctx) != "" {
+		return ctx
+	}
+	projectKey, _, ok := strings.Cut(ticketID, "-")
+	if !ok {
+		return ctx
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return WithTenant(ctx, t.projects[projectKey])
+}
+
+// Storage returns the object storage of a tenant, or nil when it uses the
+// storage of the deployment
+func (t *Tenants) Storage(id string) ObjectStorage {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if found, ok := t.tenants[id]; ok {
+		return found.storage
+	}
+	return nil
+}
+
+// NotificationRoutes returns the chats the new tickets of a tenant are
+// announced in
+func (t *Tenants) NotificationRoutes(id string) []NotificationRoute {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if found, ok := t.tenants[id]; ok {
+		return found.notifications
+	}
+	return nil
+}
+
+// Create stores a new tenant
+func (t *Tenants) Create(ctx context.Context, tenant *models.Tenant) error {
+	if err := t.checkProject(tenant); err != nil {
+		return err
+	}
+	tenant.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	tenant.UpdatedAt = tenant.CreatedAt
+	if err := t.mongoService.SaveTenant(ctx, tenant); err != nil {
+		return err
+	}
+	t.apply([]models.Tenant{*tenant}, false)
+	return nil
+}
+
+// Update replaces the settings of a tenant. Secrets left empty keep their
+// current value.
+func (t *Tenants) Update(ctx context.Context, tenant *models.Tenant) error {
+	current, ok := t.Get(tenant.ID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenant.ID)
+	}
+	if err := t.checkProject(tenant); err != nil {
+		return err
+	}
+	if tenant.Jira != nil && tenant.Jira.APIToken == "" && current.Jira != nil {
+		tenant.Jira.APIToken = current.Jira.APIToken
+	}
+	if tenant.Storage != nil && tenant.Storage.SecretKey == "" && current.Storage != nil {
+		tenant.Storage.SecretKey = current.Storage.SecretKey
+	}
+	tenant.CreatedAt = current.CreatedAt
+	tenant.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	if err := t.mongoService.ReplaceTenant(ctx, tenant); err != nil {
+		return err
+	}
+	t.apply([]models.Tenant{*tenant}, false)
+	return nil
+}
+
+// Delete removes a tenant and revokes its API keys. Its tickets are kept.
+func (t *Tenants) Delete(ctx context.Context, id string) error {
+	if err := t.mongoService.DeleteTenant(ctx, id); err != nil {
+		return err
+	}
+	if err := t.mongoService.RevokeTenantAPIKeys(ctx, id, time.Now()); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if found, ok := t.tenants[id]; ok {
+		t.remove(found)
+	}
+	return nil
+}
+
+// checkProject returns ErrTenantProjectTaken when another tenant files its
+// tickets in the Jira project of tenant
+func (t *Tenants) checkProject(tenant *models.Tenant) error {
+	if tenant.Jira == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if id, ok := t.projects[tenant.Jira.ProjectKey]; ok && id != tenant.ID {
+		return fmt.Errorf("%w: %s is used by tenant %s", ErrTenantProjectTaken, tenant.Jira.ProjectKey, id)
+	}
+	return nil
+}
+
+// SetRoster replaces the support roster of the trackers of every tenant
+func (t *Tenants) SetRoster(roster *Roster) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.roster = roster
+	for _, found := range t.tenants {
+		if found.tracker != nil {
+			found.tracker.SetRoster(roster)
+		}
+	}
+}
+
+// Run loads the tenants and refreshes them until stopping is closed
+func (t *Tenants) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(tenantRefreshInterval)
+	defer ticker.Stop()
+	for {
+		t.refresh(ctx)
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tenants) refresh(ctx context.Context) {
+	tenants, err := t.mongoService.GetTenants(ctx)
+	if err != nil {
+		// The last known tenants are kept
+		t.logger.Warn("Failed to load tenants", zap.Error(err))
+		return
+	}
+	t.apply(tenants, true)
+}
+
+// apply makes tenants current, creating the clients of those that are new
+// or changed. With all, tenants are the complete list and the others are
+// removed.
+func (t *Tenants) apply(tenants []models.Tenant, all bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seen := make(map[string]bool, len(tenants))
+	for _, loaded := range tenants {
+		seen[loaded.ID] = true
+		if current, ok := t.tenants[loaded.ID]; ok {
+			if current.UpdatedAt.Equal(loaded.UpdatedAt) {
+				continue
+			}
+			t.remove(current)
+		}
+
+		created := t.newTenant(loaded)
+		t.tenants[loaded.ID] = created
+		if loaded.Jira != nil {
+			t.projects[loaded.Jira.ProjectKey] = loaded.ID
+		}
+		if created.err != nil {
+			t.logger.Error("Failed to set up tenant", zap.String("tenant", loaded.ID), zap.Error(created.err))
+		} else {
+			t.logger.Info("Tenant loaded", zap.String("tenant", loaded.ID))
+		}
+	}
+
+	if all {
+		for id, current := range t.tenants {
+			if !seen[id] {
+				t.remove(current)
+			}
+		}
+	}
+}
+
+// newTenant creates the clients of the settings of a tenant
+func (t *Tenants) newTenant(loaded models.Tenant) *tenant {
+	created := &tenant{Tenant: loaded}
+	if loaded.Jira != nil && t.clients.Tracker != nil {
+		created.tracker, created.err = t.clients.Tracker(&loaded, t.roster)
+	}
+	if loaded.Storage != nil && t.clients.Storage != nil && created.err == nil {
+		created.storage, created.err = t.clients.Storage(&loaded)
+	}
+	created.notifications = channelRoutes(loaded.ID, loaded.Notifications)
+	return created
+}
+
+// remove forgets a tenant and releases its tracker; t.mu must be held
+func (t *Tenants) remove(found *tenant) {
+	delete(t.tenants, found.ID)
+	if found.Jira != nil && t.projects[found.Jira.ProjectKey] == found.ID {
+		delete(t.projects, found.Jira.ProjectKey)
+	}
+	if found.tracker != nil {
+		if err := found.tracker.Cleanup(); err != nil {
+			t.logger.Warn("Failed to clean up tenant issue tracker", zap.String("tenant", found.ID), zap.Error(err))
+		}
+	}
+}
+
+// TenantStorage routes the requests made for a tenant with its own bucket to
+// that bucket, and the others to storage
+func TenantStorage(storage ObjectStorage, tenants *Tenants) ObjectStorage {
+	if tenants == nil || storage == nil {
+		return storage
+	}
+	return &tenantStorage{ObjectStorage: storage, tenants: tenants}
+}
+
+type tenantStorage struct {
+	ObjectStorage
+	tenants *Tenants
+}
+
+// backend returns the storage of the tenant carried by ctx
+func (s *tenantStorage) backend(ctx context.Context) ObjectStorage {
+	if id := TenantID(ctx); id != "" {
+		if storage := s.tenants.Storage(id); storage != nil {
+			return storage
+		}
+	}
+	return s.ObjectStorage
+}
+
+func (s *tenantStorage) UploadFile(ctx context.Context, file *multipart.FileHeader, objectKey string, tags map[string]string) (string, error) {
+	return s.backend(ctx).UploadFile(ctx, file, objectKey, tags)
+}
+
+func (s *tenantStorage) UploadStream(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string, tags map[string]string) error {
+	return s.backend(ctx).UploadStream(ctx, objectKey, r, size, contentType, tags)
+}
+
+func (s *tenantStorage) PresignGetURL(ctx context.Context, objectKey string) (string, error) {
+	return s.backend(ctx).PresignGetURL(ctx, objectKey)
+}
+
+func (s *tenantStorage) PresignPutURL(ctx context.Context, objectKey, contentType, checksumSHA256 string, tags map[string]string, expires time.Duration) (string, map[string]string, error) {
+	return s.backend(ctx).PresignPutURL(ctx, objectKey, contentType, checksumSHA256, tags, expires)
+}
+
+func (s *tenantStorage) StatObject(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	return s.backend(ctx).StatObject(ctx, objectKey)
+}
+
+func (s *tenantStorage) TagObject(ctx context.Context, objectKey string, tags map[string]string) error {
+	return s.backend(ctx).TagObject(ctx, objectKey, tags)
+}
+
+func (s *tenantStorage) OpenObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	return s.backend(ctx).OpenObject(ctx, objectKey)
+}
+
+func (s *tenantStorage) DeleteObject(ctx context.Context, objectKey string) error {
+	return s.backend(ctx).DeleteObject(ctx, objectKey)
+}
+
+func (s *tenantStorage) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	return s.backend(ctx).CopyObject(ctx, srcKey, dstKey)
+}
+
+func (s *tenantStorage) ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	return s.backend(ctx).ListObjects(ctx, prefix, fn)
+}
+
+func (s *tenantStorage) ArchiveObject(ctx context.Context, objectKey string) error {
+	return s.backend(ctx).ArchiveObject(ctx, objectKey)
+}
+
+// tenantFilter matches the documents of a tenant, or of no tenant when it
+// is empty
+func tenantFilter(id string) interface{} {
+	if id == "" {
+		return bson.M{"$exists": false}
+	}
+	return id
+}
+
+// SaveTenant stores a new tenant
+func (s *MongoDBService) SaveTenant(ctx context.Context, tenant *models.Tenant) error {
+	_, err := s.database.Collection(tenantsCollection).InsertOne(ctx, tenant)
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrTenantExists, tenant.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert tenant: %w", err)
+	}
+	return nil
+}
+
+// ReplaceTenant replaces the settings of a stored tenant
+func (s *MongoDBService) ReplaceTenant(ctx context.Context, tenant *models.Tenant) error {
+	result, err := s.database.Collection(tenantsCollection).ReplaceOne(ctx, bson.M{"_id": tenant.ID}, tenant)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenant.ID)
+	}
+	return nil
+}
+
+// DeleteTenant removes a stored tenant
+func (s *MongoDBService) DeleteTenant(ctx context.Context, id string) error {
+	result, err := s.database.Collection(tenantsCollection).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, id)
+	}
+	return nil
+}
+
+// GetTenants retrieves all stored tenants
+func (s *MongoDBService) GetTenants(ctx context.Context) ([]models.Tenant, error) {
+	tenants := []models.Tenant{}
+	cursor, err := s.database.Collection(tenantsCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find tenants: %w", err)
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to decode tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// RevokeTenantAPIKeys revokes the API keys of a tenant
+func (s *MongoDBService) RevokeTenantAPIKeys(ctx context.Context, tenant string, revokedAt time.Time) error {
+	filter := bson.M{"tenant": tenant, "revoked_at": bson.M{"$exists": false}}
+	if _, err := s.apiKeys.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": revokedAt}}); err != nil {
+		return fmt.Errorf("failed to revoke API keys of tenant: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// TicketSyncReport summarizes a sync of ticket states from Jira. Updated
+// counts tickets whose state changed.
+type TicketSyncReport struct {
+	Scanned int `json:"scanned"`
+	Updated int `json:"updated"`
+	Missing int `json:"missing"`
+	Failed  int `json:"failed"`
+}
+
+// TicketStateListener is told of a change to the state of a stored ticket,
+// given the ticket as stored before the change
+type TicketStateListener func(ticket *FlattenedTicket, state *TicketState)
+
+// SyncTicketStates pages through all unarchived tickets and refreshes their
+// status, assignee and resolution from Jira, querying batchSize tickets per
+// Jira search. It catches up on changes missed while webhooks were not
+// delivered. changed, when not nil, is told of each ticket whose state
+// changed.
+func SyncTicketStates(ctx context.Context, js *JiraRegistry, ms *MongoDBService, batchSize int, changed TicketStateListener, log *zap.Logger) (*TicketSyncReport, error) {
+	report := &TicketSyncReport{}
+	var after primitive.ObjectID
+
+	for {
+		tickets, err := ms.GetTicketsPage(ctx, after, int64(batchSize))
+		if err != nil {
+			return report, err
+		}
+		if len(tickets) == 0 {
+			return report, nil
+		}
+		after = tickets[len(tickets)-1].ID
+		report.Scanned += len(tickets)
+
+		ids := make([]string, len(tickets))
+		for i, ticket := range tickets {
+			ids[i] = ticket.TicketID
+		}
+
+		states, err := js.GetTicketStates(ctx, ids)
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			log.Warn("Failed to search Jira tickets, skipping batch", zap.Error(err), zap.Strings("ticket_ids", ids))
+			report.Failed += len(tickets)
+			continue
+		}
+
+		now := time.Now()
+		for i := range tickets {
+			ticket := &tickets[i]
+			state, ok := states[ticket.TicketID]
+			if !ok {
+				report.Missing++
+				continue
+			}
+			isChanged := state.Status != ticket.Status || state.AssignedTo != ticket.AssignedTo || state.Resolution != ticket.Resolution
+
+			if err := ms.UpdateTicketState(ctx, ticket.TicketID, state, now); err != nil {
+				log.Warn("Failed to update ticket state", zap.Error(err), zap.String("ticket_id", ticket.TicketID))
+				report.Failed++
+				continue
+			}
+			if isChanged {
+				report.Updated++
+				if changed != nil {
+					changed(ticket, state)
+				}
+			}
+		}
+	}
+}
+
+// TicketSyncLock is the distributed lock held while ticket states are
+// synced, so only one sync runs at a time across instances
+const TicketSyncLock = "ticket-sync"
+
+// ticketSyncBatchSize is the number of tickets the scheduled sync looks up
+// per Jira search
+const ticketSyncBatchSize = 50
+
+// TicketSyncJob periodically syncs the states of tickets from their
+// trackers, on the leader only
+type TicketSyncJob struct {
+	jiraService  *JiraRegistry
+	mongoService *MongoDBService
+	coordinator  *Coordinator
+	listeners    []TicketStateListener
+	logger       *zap.Logger
+	interval     time.Duration
+}
+
+// NewTicketSyncJob creates a sync of ticket states run every interval
+func NewTicketSyncJob(js *JiraRegistry, ms *MongoDBService, log *zap.Logger, interval time.Duration) *TicketSyncJob {
+	return &TicketSyncJob{
+		jiraService:  js,
+		mongoService: ms,
+		logger:       log,
+		interval:     interval,
+	}
+}
+
+// OnTicketStateChange adds a listener told of the ticket state changes made
+// by syncs
+func (j *TicketSyncJob) OnTicketStateChange(listener TicketStateListener) {
+	j.listeners = append(j.listeners, listener)
+}
+
+// SetCoordinator runs the job only while this instance is the leader
+func (j *TicketSyncJob) SetCoordinator(coordinator *Coordinator) {
+	j.coordinator = coordinator
+}
+
+// Run runs the job periodically until stopping is closed, letting a run in
+// progress finish with ctx
+func (j *TicketSyncJob) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+			if j.coordinator.IsLeader() {
+				j.RunOnce(ctx)
+			}
+		}
+	}
+}
+
+// RunOnce syncs all ticket states unless a sync is running already
+func (j *TicketSyncJob) RunOnce(ctx context.Context) {
+	unlock, ok, err := j.coordinator.TryLock(ctx, TicketSyncLock)
+	if err != nil {
+		j.logger.Error("Failed to lock ticket sync", zap.Error(err))
+		return
+	}
+	if !ok {
+		j.logger.Info("Skipping scheduled ticket sync, another sync is running")
+		return
+	}
+	defer unlock()
+
+	report, err := SyncTicketStates(ctx, j.jiraService, j.mongoService, ticketSyncBatchSize, j.stateChanged, j.logger)
+	if err != nil {
+		j.logger.Error("Failed to sync tickets", zap.Error(err))
+		return
+	}
+	j.logger.Info("Synced tickets",
+		zap.Int("scanned", report.Scanned),
+		zap.Int("updated", report.Updated),
+		zap.Int("missing", report.Missing),
+		zap.Int("failed", report.Failed),
+	)
+}
+
+func (j *TicketSyncJob) stateChanged(ticket *FlattenedTicket, state *TicketState) {
+	for _, listener := range j.listeners {
+		listener(ticket, state)
+	}
+}
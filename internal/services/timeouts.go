@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// ErrDependencyTimeout is returned when a call to a dependency did not
+// finish within the timeout configured for it
+var ErrDependencyTimeout = errors.New("the dependency did not answer in time")
+
+// withTimeout runs fn with a context that ends timeout from now, turning
+// its deadline into ErrDependencyTimeout. A deadline or cancellation of ctx
+// itself is returned as it is.
+func withTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return timeoutError(ctx, callCtx, timeout, fn(callCtx))
+}
+
+func timeoutError(ctx, callCtx context.Context, timeout time.Duration, err error) error {
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s: %v", ErrDependencyTimeout, timeout, err)
+	}
+	return err
+}
+
+// timeoutTracker bounds every API call of an issue tracker, including the
+// wait for its worker pool. Ping is left out, as readiness checks have a
+// timeout of their own.
+type timeoutTracker struct {
+	IssueTracker
+	timeout time.Duration
+}
+
+// TimeoutTracker bounds the API calls of tracker to timeout, or leaves them
+// unbounded when it is 0
+func TimeoutTracker(tracker IssueTracker, timeout time.Duration) IssueTracker {
+	if timeout <= 0 {
+		return tracker
+	}
+	return &timeoutTracker{IssueTracker: tracker, timeout: timeout}
+}
+
+func (t *timeoutTracker) CreateTicket(ctx context.Context, req *models.TicketRequest) (resp *models.TicketResponse, err error) {
+	err = withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		resp, err = t.IssueTracker.CreateTicket(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (t *timeoutTracker) IsTicketOpen(ctx context.Context, ticketID string) (open bool, err error) {
+	err = withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		open, err = t.IssueTracker.IsTicketOpen(ctx, ticketID)
+		return err
+	})
+	return open, err
+}
+
+func (t *timeoutTracker) GetTicketState(ctx context.Context, ticketID string) (state *TicketState, err error) {
+	err = withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		state, err = t.IssueTracker.GetTicketState(ctx, ticketID)
+		return err
+	})
+	return state, err
+}
+
+func (t *timeoutTracker) GetTicketStates(ctx context.Context, ticketIDs []string) (states map[string]*TicketState, err error) {
+	err = withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		states, err = t.IssueTracker.GetTicketStates(ctx, ticketIDs)
+		return err
+	})
+	return states, err
+}
+
+func (t *timeoutTracker) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		return t.IssueTracker.AssignTicket(ctx, ticketID, accountID)
+	})
+}
+
+func (t *timeoutTracker) AddComment(ctx context.Context, ticketID, author, body string) error {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		return t.IssueTracker.AddComment(ctx, ticketID, author, body)
+	})
+}
+
+func (t *timeoutTracker) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		return t.IssueTracker.ReplaceDescriptionText(ctx, ticketID, oldText, newText)
+	})
+}
+
+func (t *timeoutTracker) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		return t.IssueTracker.ReleaseScreenshot(ctx, ticketID, imageURL, contentType)
+	})
+}
+
+func (t *timeoutTracker) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return withTimeout(ctx, t.timeout, func(ctx context.Context) error {
+		return t.IssueTracker.RemoveScreenshot(ctx, ticketID)
+	})
+}
+
+// timeoutStorage bounds every request of an object storage backend,
+// including the wait for its worker pool. Presigning is local and left out,
+// as are Ping, which readiness checks bound themselves, and ListObjects,
+// whose scans by background jobs may take long.
+type timeoutStorage struct {
+	ObjectStorage
+	timeout time.Duration
+}
+
+// TimeoutStorage bounds the requests of storage to timeout, or leaves them
+// unbounded when it is 0
+func TimeoutStorage(storage ObjectStorage, timeout time.Duration) ObjectStorage {
+	if timeout <= 0 || storage == nil {
+		return storage
+	}
+	return &timeoutStorage{ObjectStorage: storage, timeout: timeout}
+}
+
+func (s *timeoutStorage) UploadFile(ctx context.Context, file *multipart.FileHeader, objectKey string, tags map[string]string) (url string, err error) {
+	err = withTimeout(ctx, s.timeout, func(ctx context.Context) error {
+		url, err = s.ObjectStorage.UploadFile(ctx, file, objectKey, tags)
+		return err
+	})
+	return url, err
+}
+
+func (s *timeoutStorage) UploadStream(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string, tags map[string]string) error {
+	return withTimeout(ctx, s.timeout, func(ctx context.Context) error {
+		return s.ObjectStorage.UploadStream(ctx, objectKey, r, size, contentType, tags)
+	})
+}
+
+func (s *timeoutStorage) StatObject(ctx context.Context, objectKey string) (info *ObjectInfo, err error) {
+	err = withTimeout(ctx, s.timeout, func(ctx context.Context) error {
+		info, err = s.ObjectStorage.StatObject(ctx, objectKey)
+		return err
+	})
+	return info, err
+}
+
+func (s *timeoutStorage) TagObject(ctx context.Context, objectKey string, tags map[string]string) error {
+	return withTimeout(ctx, s.timeout, func(ctx context.Context) error {
+		return s.ObjectStorage.TagObject(ctx, objectKey, tags)
+	})
+}
+
+// OpenObject bounds opening the object and reading it, which ends when the
+// body is closed
+func (s *timeoutStorage) OpenObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	callCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	body, err := s.ObjectStorage.OpenObject(callCtx, objectKey)
+	if err != nil {
+		cancel()
+		return nil, timeoutError(ctx, callCtx, s.timeout, err)
+	}
+	return &cancelOnClose{ReadCloser: body, cancel: cancel}, nil
+}
+
+func (s *timeoutStorage) DeleteObject(ctx context.Context, objectKey string) error {
+	return withTimeout(ctx, s.timeout, func(ctx context.Context) error {
+		return s.ObjectStorage.DeleteObject(ctx, objectKey)
+	})
+}
+
+func (s *timeoutStorage) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	return withTimeout(ctx, s.timeout, func(ctx context.Context) error {
+		return s.ObjectStorage.CopyObject(ctx, srcKey, dstKey)
+	})
+}
+
+func (s *timeoutStorage) ArchiveObject(ctx context.Context, objectKey string) error {
+	return withTimeout(ctx, s.timeout, func(ctx context.Context) error {
+		return s.ObjectStorage.ArchiveObject(ctx, objectKey)
+	})
+}
+
+// cancelOnClose releases the context of a body once it is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// maxTitleLength keeps ticket titles within the 255 characters of a Jira
+// summary
+const maxTitleLength = 255
+
+// titlePlaceholder matches the placeholders of title templates, e.g.
+// {{product}}
+var titlePlaceholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// titleFields are the values the placeholders of title templates are
+// replaced with
+var titleFields = map[string]func(req *models.TicketRequest) string{
+	// title is the generated title when the report was summarized, and its
+	// issue otherwise
+	"title": func(req *models.TicketRequest) string {
+		if req.Summary != nil {
+			return req.Summary.Title
+		}
+		return reportIssue(req)
+	},
+	"issue":     reportIssue,
+	"product":   payloadString("product"),
+	"userEmail": payloadString("userEmail"),
+	"leadId":    payloadString("leadId"),
+	"severity":  TicketSeverity,
+	"category": func(req *models.TicketRequest) string {
+		if req.Classification != nil {
+			return req.Classification.Category
+		}
+		return ""
+	},
+	"topFailedEndpoint": topFailedEndpoint,
+}
+
+// reportIssue is the issue of a report, or "" when it has none
+func reportIssue(req *models.TicketRequest) string {
+	if req.Payload["issue"] == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s", req.Payload["issue"])
+}
+
+// titleEmpty marks the placeholders without a value while a title is
+// rendered
+const titleEmpty = "\x00"
+
+// titleEmptyParts matches empty placeholders with the brackets around them
+// or the separator before them, e.g. " — {{topFailedEndpoint}}"
+var titleEmptyParts = regexp.MustCompile(`\[\s*\x00\s*\]|\(\s*\x00\s*\)|(\s*[-–—|:,])?\s*\x00`)
+
+// TitleTemplate renders the titles of new tickets from a template with
+// placeholders such as {{product}}, in place of the default
+// "Issue Report: {{title}}"
+type TitleTemplate struct {
+	template string
+}
+
+// ParseTitleTemplate parses a title template, failing for unknown
+// placeholders and templates without any
+func ParseTitleTemplate(template string) (*TitleTemplate, error) {
+	matches := titlePlaceholder.FindAllStringSubmatch(template, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("title template %q has no placeholder", template)
+	}
+	for _, match := range matches {
+		if titleFields[match[1]] == nil {
+			names := make([]string, 0, len(titleFields))
+			for name := range titleFields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown placeholder {{%s}} in title template, expected one of %s", match[1], strings.Join(names, ", "))
+		}
+	}
+	return &TitleTemplate{template: template}, nil
+}
+
+// Render returns the title of a report. Placeholders without a value are
+// left out with the brackets and separators around them; when nothing but
+// punctuation is left, the report gets the default title. Titles are cut
+// short to fit Jira.
+func (t *TitleTemplate) Render(req *models.TicketRequest) string {
+	title := titlePlaceholder.ReplaceAllStringFunc(t.template, func(placeholder string) string {
+		name := titlePlaceholder.FindStringSubmatch(placeholder)[1]
+		// Titles are a single line
+		value := strings.Join(strings.Fields(titleFields[name](req)), " ")
+		if value == "" {
+			return titleEmpty
+		}
+		return value
+	})
+	if strings.Contains(title, titleEmpty) {
+		title = titleEmptyParts.ReplaceAllString(title, "")
+		title = strings.TrimLeft(title, " -–—|:,")
+	}
+	title = strings.Join(strings.Fields(title), " ")
+	if !strings.ContainsFunc(title, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+		return defaultTicketTitle(req)
+	}
+	return capTitle(title)
+}
+
+// ticketTitle is the title of a new ticket: the one rendered from the title
+// template, or else "Issue Report: " and its generated title when the report
+// was summarized, its issue otherwise
+func ticketTitle(req *models.TicketRequest) string {
+	if req.Title != "" {
+		return req.Title
+	}
+	return defaultTicketTitle(req)
+}
+
+func defaultTicketTitle(req *models.TicketRequest) string {
+	if req.Summary != nil {
+		return capTitle("Issue Report: " + req.Summary.Title)
+	}
+	return capTitle(fmt.Sprintf("Issue Report: %s", req.Payload["issue"]))
+}
+
+// capTitle cuts a title longer than maxTitleLength characters short, ending
+// it with an ellipsis
+func capTitle(title string) string {
+	if utf8.RuneCountInString(title) <= maxTitleLength {
+		return title
+	}
+	runes := []rune(title)
+	return strings.TrimRightFunc(string(runes[:maxTitleLength-1]), unicode.IsSpace) + "…"
+}
+
+// topFailedEndpoint returns the endpoint most of the failed network calls of
+// a report went to, e.g. "GET /api/v1/loans/:id", the first one on ties
+func topFailedEndpoint(req *models.TicketRequest) string {
+	counts := make(map[string]int)
+	top := ""
+	for _, endpoint := range failedEndpoints(req.Payload["failedNetworkCalls"]) {
+		name := strings.TrimSpace(strings.ToUpper(endpoint.method) + " " + endpointPattern(endpoint.path))
+		counts[name]++
+		if counts[name] > counts[top] {
+			top = name
+		}
+	}
+	return top
+}
+
+// payloadString returns the string value of a payload field
+func payloadString(key string) func(req *models.TicketRequest) string {
+	return func(req *models.TicketRequest) string {
+		value, _ := req.Payload[key].(string)
+		return value
+	}
+}
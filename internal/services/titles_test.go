@@ -0,0 +1,121 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+func TestTitleTemplate(t *testing.T) {
+	failedCall := func(method, url string) map[string]interface{} {
+		return map[string]interface{}{
+			"requestData":  map[string]interface{}{"method": method, "url": url},
+			"responseData": map[string]interface{}{"status": 500},
+		}
+	}
+	report := func(payload map[string]interface{}) *models.TicketRequest {
+		return &models.TicketRequest{Payload: payload}
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		req      *models.TicketRequest
+		want     string
+	}{
+		{
+			name:     "all placeholders",
+			template: "[{{product}}] {{issue}} — {{topFailedEndpoint}}",
+			req: report(map[string]interface{}{
+				"product": "lending",
+				"issue":   "EMI schedule\nfails to load",
+				"failedNetworkCalls": []interface{}{
+					failedCall("get", "https://api.example.com/v1/loans/123/emi"),
+					failedCall("POST", "https://api.example.com/v1/events"),
+					failedCall("GET", "https://api.example.com/v1/loans/456/emi"),
+				},
+			}),
+			want: "[lending] EMI schedule fails to load — GET /v1/loans/:id/emi",
+		},
+		{
+			name:     "empty placeholders are left out",
+			template: "[{{product}}] {{issue}} — {{topFailedEndpoint}}",
+			req:      report(map[string]interface{}{"issue": "Blank page"}),
+			want:     "Blank page",
+		},
+		{
+			name:     "leading separator of an empty placeholder",
+			template: "{{severity}}: {{issue}} ({{category}})",
+			req:      report(map[string]interface{}{"issue": "Blank page"}),
+			want:     "Blank page",
+		},
+		{
+			name:     "classification",
+			template: "{{severity}}: {{issue}} ({{category}})",
+			req: &models.TicketRequest{
+				Payload:        map[string]interface{}{"issue": "Blank page"},
+				Classification: &models.Classification{Severity: "high", Category: "ui-bug"},
+			},
+			want: "high: Blank page (ui-bug)",
+		},
+		{
+			name:     "generated title",
+			template: "{{product}} | {{title}}",
+			req: &models.TicketRequest{
+				Payload: map[string]interface{}{"issue": "it broke", "product": "shop"},
+				Summary: &models.ReportSummary{Title: "Checkout fails for saved cards"},
+			},
+			want: "shop | Checkout fails for saved cards",
+		},
+		{
+			name:     "no issue and no generated title",
+			template: "{{product}} | {{title}}",
+			req:      report(map[string]interface{}{"product": "shop"}),
+			want:     "shop",
+		},
+		{
+			name:     "falls back to the default title",
+			template: "[{{product}}] {{topFailedEndpoint}}",
+			req:      report(map[string]interface{}{"issue": "Blank page"}),
+			want:     "Issue Report: Blank page",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			titles, err := ParseTitleTemplate(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := titles.Render(tt.req); got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTitleTemplateCapsLength(t *testing.T) {
+	titles, err := ParseTitleTemplate("[{{product}}] {{issue}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	title := titles.Render(&models.TicketRequest{Payload: map[string]interface{}{
+		"product": "lending",
+		"issue":   strings.Repeat("ऋण ", 200),
+	}})
+	if n := utf8.RuneCountInString(title); n > maxTitleLength {
+		t.Errorf("title has %d characters, want at most %d", n, maxTitleLength)
+	}
+	if !strings.HasPrefix(title, "[lending] ऋण") || !strings.HasSuffix(title, "…") {
+		t.Errorf("title = %q, want it cut short with an ellipsis", title)
+	}
+}
+
+func TestParseTitleTemplateRejectsUnknownPlaceholders(t *testing.T) {
+	for _, template := range []string{"{{issue}} {{reporter}}", "Bug report"} {
+		if _, err := ParseTitleTemplate(template); err == nil {
+			t.Errorf("ParseTitleTemplate(%q) succeeded, want an error", template)
+		}
+	}
+}
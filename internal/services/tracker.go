@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Issue tracker kinds
+const (
+	TrackerJira   = "jira"
+	TrackerGitHub = "github"
+	TrackerGitLab = "gitlab"
+	TrackerLinear = "linear"
+)
+
+// IssueTracker creates and updates the tickets of reports in an issue
+// tracker. Ticket IDs start with the tracker's ProjectKey and a dash, which
+// routes existing tickets back to their tracker.
+type IssueTracker interface {
+	// Kind names the tracker's product, e.g. TrackerJira
+	Kind() string
+	ProjectKey() string
+
+	CreateTicket(ctx context.Context, req *models.TicketRequest) (*models.TicketResponse, error)
+	IsTicketOpen(ctx context.Context, ticketID string) (bool, error)
+	GetTicketState(ctx context.Context, ticketID string) (*TicketState, error)
+	// GetTicketStates leaves tickets that do not exist out of the result
+	GetTicketStates(ctx context.Context, ticketIDs []string) (map[string]*TicketState, error)
+	// AssignTicket assigns a ticket to a support team member by Jira account
+	AssignTicket(ctx context.Context, ticketID, accountID string) error
+	AddComment(ctx context.Context, ticketID, author, body string) error
+	// ReplaceDescriptionText is a no-op when the description does not
+	// contain oldText
+	ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error
+	// ReleaseScreenshot shows a released screenshot in place of the
+	// quarantine note of a ticket
+	ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error
+	// RemoveScreenshot notes the removal of a ticket's quarantined screenshot
+	RemoveScreenshot(ctx context.Context, ticketID string) error
+	Ping(ctx context.Context) error
+
+	SetRoster(roster *Roster)
+	SetRedactor(redactor *Redactor)
+	SetLogger(log *zap.Logger)
+	Cleanup() error
+}
+
+// hasScreenshotURL reports whether a ticket request links a screenshot;
+// clients send "None" or "null" when they have none
+func hasScreenshotURL(req *models.TicketRequest) bool {
+	return req.ImageS3URL != "" && req.ImageS3URL != "None" && req.ImageS3URL != "null"
+}
+
+// downloadScreenshot downloads the screenshot of a report for trackers that
+// keep their own copy, failing for screenshots larger than maxSize bytes
+func downloadScreenshot(ctx context.Context, client *http.Client, imageURL string, maxSize int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download screenshot: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download screenshot: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download screenshot: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("screenshot is larger than %d bytes", maxSize)
+	}
+	return data, nil
+}
+
+// screenshotName is the file name of a report's screenshot: its storage key's
+// base name, or a random one
+func screenshotName(req *models.TicketRequest) string {
+	if req.ImageS3Key != "" {
+		return path.Base(req.ImageS3Key)
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// saveTicket saves a new ticket to MongoDB when it is configured. Failures
+// are only logged, since the ticket already exists in its tracker.
+func saveTicket(ctx context.Context, ms *MongoDBService, req *models.TicketRequest, ticket *models.TicketResponse, trackerLatency time.Duration, log *zap.Logger) {
+	if ms == nil {
+		return
+	}
+
+	// Save to MongoDB
+	mongoID, err := ms.SaveTicket(ctx, flattenTicket(ctx, req, ticket, trackerLatency))
+	if err != nil {
+		// Log error but don't fail the ticket creation
+		log.Error("Failed to save ticket to MongoDB", zap.String("ticket_id", ticket.TicketID), zap.Error(err))
+	} else {
+		log.Debug("Saved ticket to MongoDB", zap.String("ticket_id", ticket.TicketID), zap.String("mongo_id", mongoID))
+	}
+}
+
+// flattenTicket returns the stored form of a new ticket
+func flattenTicket(ctx context.Context, req *models.TicketRequest, ticket *models.TicketResponse, trackerLatency time.Duration) *FlattenedTicket {
+	// Create flattened ticket object
+	flattenedTicket := &FlattenedTicket{
+		TicketID:   ticket.TicketID,
+		Status:     "created",
+		AssignedTo: ticket.AssignedTo,
+		JiraLink:   ticket.JiraLink,
+		CreatedAt:  time.Now(),
+		RequestID:  logger.RequestID(ctx),
+		Tenant:     TenantID(ctx),
+
+		JiraLatencyMS: trackerLatency.Milliseconds(),
+	}
+
+	// Extract basic fields
+	if issueValue, ok := req.Payload["issue"].(string); ok {
+		flattenedTicket.Issue = issueValue
+	}
+	if descValue, ok := req.Payload["description"].(string); ok {
+		flattenedTicket.Description = descValue
+	}
+	if emailValue, ok := req.Payload["userEmail"].(string); ok {
+		flattenedTicket.UserEmail = emailValue
+	}
+	if leadValue, ok := req.Payload["leadId"].(string); ok {
+		flattenedTicket.LeadID = leadValue
+	}
+	if productValue, ok := req.Payload["product"].(string); ok {
+		flattenedTicket.Product = productValue
+	}
+	flattenedTicket.Severity = TicketSeverity(req)
+	flattenedTicket.Fingerprint = ReportFingerprint(req)
+	if req.Classification != nil {
+		flattenedTicket.Category = req.Classification.Category
+		flattenedTicket.ClassifiedBy = req.Classification.ClassifiedBy
+	}
+	if env := clientEnvironment(req.Payload["client"]); env != nil {
+		flattenedTicket.Browser = env.Browser
+		flattenedTicket.BrowserVersion = env.BrowserVersion
+		flattenedTicket.OS = env.OS
+		flattenedTicket.OSVersion = env.OSVersion
+		flattenedTicket.Device = env.Device
+	}
+
+	// Set page URL
+	if pageURL, ok := req.Payload["url"].(string); ok {
+		flattenedTicket.PageURL = pageURL
+	} else {
+		flattenedTicket.PageURL = req.URL
+	}
+
+	// Set image URL
+	if hasScreenshotURL(req) {
+		flattenedTicket.ImageURL = req.ImageS3URL
+		flattenedTicket.ImageKey = req.ImageS3Key
+		flattenedTicket.ImageURLExpiresAt = req.ImageURLExpiresAt
+	}
+	flattenedTicket.ImageContentType = req.ImageContentType
+	flattenedTicket.Video = req.Video
+	if req.QuarantineKey != "" {
+		flattenedTicket.ImageKey = req.ImageS3Key
+		flattenedTicket.QuarantineKey = req.QuarantineKey
+		flattenedTicket.AttachmentStatus = AttachmentStatusQuarantined
+	}
+
+	// Serialize complex data to JSON strings
+	if networkCalls, exists := req.Payload["failedNetworkCalls"]; exists {
+		networkCallsJSON, err := json.Marshal(networkCalls)
+		if err == nil {
+			flattenedTicket.FailedNetworkCallsJSON = string(networkCallsJSON)
+		} else {
+			// Try as string
+			if ncStr, ok := networkCalls.(string); ok {
+				flattenedTicket.FailedNetworkCallsJSON = ncStr
+			}
+		}
+	}
+
+	// Convert payload to JSON string
+	payloadJSON, err := json.Marshal(req.Payload)
+	if err == nil {
+		flattenedTicket.PayloadJSON = string(payloadJSON)
+	}
+
+	// Convert response to JSON string
+	responseJSON, err := json.Marshal(req.Response)
+	if err == nil {
+		flattenedTicket.ResponseJSON = string(responseJSON)
+	}
+
+	// Convert headers to JSON string
+	headersJSON, err := json.Marshal(req.RequestHeaders)
+	if err == nil {
+		flattenedTicket.RequestHeadersJSON = string(headersJSON)
+	}
+	return flattenedTicket
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Upload session states
+const (
+	UploadSessionPending   = "pending"
+	UploadSessionCompleted = "completed"
+)
+
+var (
+	// ErrUploadSessionNotFound is returned for unknown or expired upload sessions
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	// ErrUploadOffsetMismatch is returned when a chunk does not start at the
+	// current offset of the session
+	ErrUploadOffsetMismatch = errors.New("chunk does not start at the current upload offset")
+	// ErrUploadSessionCompleted is returned when writing to a completed session
+	ErrUploadSessionCompleted = errors.New("upload session is already completed")
+)
+
+// UploadSession tracks a resumable upload. Chunks are staged on local disk
+// until the session is completed and the content is moved to object storage.
+type UploadSession struct {
+	ID             string    `json:"id"`
+	Filename       string    `json:"filename"`
+	ContentType    string    `json:"contentType"`
+	Product        string    `json:"product,omitempty"`
+	Size           int64     `json:"size"`
+	Offset         int64     `json:"offset"`
+	ChecksumSHA256 string    `json:"checksumSha256,omitempty"`
+	ObjectKey      string    `json:"objectKey,omitempty"`
+	Status         string    `json:"status"`
+	CreatedAt      time.Time `json:"createdAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// UploadSessionStore keeps upload sessions and their staged data in a local
+// directory. Staging is per instance, so deployments with several replicas
+// need sticky routing or a shared volume.
+type UploadSessionStore struct {
+	dir   string
+	ttl   time.Duration
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewUploadSessionStore creates a session store staging data under dir.
+// Sessions expire ttl after they are created.
+func NewUploadSessionStore(dir string, ttl time.Duration) (*UploadSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload session directory: %w", err)
+	}
+
+	return &UploadSessionStore{
+		dir:   dir,
+		ttl:   ttl,
+		locks: make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// Create starts a new upload session
+func (s *UploadSessionStore) Create(filename, contentType, product string, size int64, checksum string) (*UploadSession, error) {
+	now := time.Now().UTC()
+	session := &UploadSession{
+		ID:             uuid.NewString(),
+		Filename:       filename,
+		ContentType:    contentType,
+		Product:        product,
+		Size:           size,
+		ChecksumSHA256: checksum,
+		Status:         UploadSessionPending,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(s.ttl),
+	}
+
+	f, err := os.Create(s.dataPath(session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload session data: %w", err)
+	}
+	f.Close()
+
+	if err := s.save(session); err != nil {
+		os.Remove(s.dataPath(session.ID))
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Get returns an upload session by ID
+func (s *UploadSessionStore) Get(id string) (*UploadSession, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	data, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload session: %w", err)
+	}
+
+	var session UploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode upload session: %w", err)
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	return &session, nil
+}
+
+// WriteChunk appends length bytes read from r to the session. The chunk must
+// start at the current offset; on a short read the bytes received so far are
+// kept so the client can resume from the new offset.
+func (s *UploadSessionStore) WriteChunk(id string, start int64, r io.Reader, length int64) (*UploadSession, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	session, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != UploadSessionPending {
+		return session, ErrUploadSessionCompleted
+	}
+	if start != session.Offset {
+		return session, ErrUploadOffsetMismatch
+	}
+	if start+length > session.Size {
+		return session, fmt.Errorf("chunk ends at byte %d, beyond the declared size of %d", start+length, session.Size)
+	}
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload session data: %w", err)
+	}
+	defer f.Close()
+
+	// Discard anything past the offset left over from an interrupted chunk
+	if err := f.Truncate(start); err != nil {
+		return nil, fmt.Errorf("failed to truncate upload session data: %w", err)
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek upload session data: %w", err)
+	}
+
+	written, copyErr := io.CopyN(f, r, length)
+	session.Offset += written
+	if err := s.save(session); err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return session, fmt.Errorf("chunk interrupted after %d bytes: %w", written, copyErr)
+	}
+
+	return session, nil
+}
+
+// Open returns a reader over the staged data of a session
+func (s *UploadSessionStore) Open(id string) (*os.File, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	f, err := os.Open(s.dataPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to open upload session data: %w", err)
+	}
+	return f, nil
+}
+
+// Lock serializes completion of a session with concurrent chunk writes. The
+// returned function releases the lock.
+func (s *UploadSessionStore) Lock(id string) func() {
+	return s.lock(id)
+}
+
+// MarkCompleted records the object key the session content was stored under
+// and removes the staged data. Completed sessions are kept until they expire
+// so the report submission can reference them.
+func (s *UploadSessionStore) MarkCompleted(session *UploadSession, objectKey string) error {
+	session.Status = UploadSessionCompleted
+	session.ObjectKey = objectKey
+	if err := s.save(session); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.dataPath(session.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload session data: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes a session and its staged data
+func (s *UploadSessionStore) Remove(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrUploadSessionNotFound
+	}
+
+	for _, path := range []string{s.dataPath(id), s.metaPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove upload session: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.locks, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// CleanupExpired removes expired sessions and returns how many were removed
+func (s *UploadSessionStore) CleanupExpired() (int, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	now := time.Now()
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var session UploadSession
+		if err := json.Unmarshal(data, &session); err != nil || now.Before(session.ExpiresAt) {
+			continue
+		}
+		if err := s.Remove(session.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// StartCleanup removes expired sessions in the background until ctx is cancelled
+func (s *UploadSessionStore) StartCleanup(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				removed, err := s.CleanupExpired()
+				if err != nil {
+					log.Error("Failed to clean up expired upload sessions", zap.Error(err))
+					continue
+				}
+				if removed > 0 {
+					log.Info("Removed expired upload sessions", zap.Int("count", removed))
+				}
+			}
+		}
+	}()
+}
+
+// lock acquires the per-session mutex
+func (s *UploadSessionStore) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[id] = l
+	}
+	s.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// save writes the session metadata atomically
+func (s *UploadSessionStore) save(session *UploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload session: %w", err)
+	}
+
+	tmp := s.metaPath(session.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write upload session: %w", err)
+	}
+	if err := os.Rename(tmp, s.metaPath(session.ID)); err != nil {
+		return fmt.Errorf("failed to write upload session: %w", err)
+	}
+	return nil
+}
+
+func (s *UploadSessionStore) metaPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *UploadSessionStore) dataPath(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
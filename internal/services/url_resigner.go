@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// URLResigner periodically refreshes presigned screenshot URLs for open
+// tickets before they expire, updating both MongoDB and the Jira description.
+type URLResigner struct {
+	storage      ObjectStorage
+	jiraService  *JiraRegistry
+	mongoService *MongoDBService
+	coordinator  *Coordinator
+	logger       *zap.Logger
+	interval     time.Duration
+	threshold    time.Duration
+}
+
+// NewURLResigner creates a new URL re-signing job. Tickets whose screenshot
+// URL expires within threshold are re-signed on every run.
+func NewURLResigner(storage ObjectStorage, js *JiraRegistry, ms *MongoDBService, log *zap.Logger, interval, threshold time.Duration) *URLResigner {
+	return &URLResigner{
+		storage:      storage,
+		jiraService:  js,
+		mongoService: ms,
+		logger:       log,
+		interval:     interval,
+		threshold:    threshold,
+	}
+}
+
+// SetCoordinator runs the job only while this instance is the leader
+func (r *URLResigner) SetCoordinator(coordinator *Coordinator) {
+	r.coordinator = coordinator
+}
+
+// Run runs the job periodically until stopping is closed, letting a run in
+// progress finish with ctx
+func (r *URLResigner) Run(ctx context.Context, stopping <-chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	if r.coordinator.IsLeader() {
+		r.RunOnce(ctx)
+	}
+	for {
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+			if r.coordinator.IsLeader() {
+				r.RunOnce(ctx)
+			}
+		}
+	}
+}
+
+// RunOnce re-signs all screenshot URLs that are about to expire
+func (r *URLResigner) RunOnce(ctx context.Context) {
+	if _, err := r.Rotate(ctx, r.threshold); err != nil {
+		r.logger.Error("Failed to find tickets with expiring screenshot URLs", zap.Error(err))
+	}
+}
+
+// ResignReport summarizes a re-signing run
+type ResignReport struct {
+	Candidates int `json:"candidates"`
+	Resigned   int `json:"resigned"`
+	Failed     int `json:"failed"`
+}
+
+// Rotate re-signs the screenshot URLs of open tickets that expire within the
+// given duration
+func (r *URLResigner) Rotate(ctx context.Context, within time.Duration) (*ResignReport, error) {
+	tickets, err := r.mongoService.GetTicketsWithExpiringImages(ctx, time.Now().Add(within))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ResignReport{Candidates: len(tickets)}
+	for _, ticket := range tickets {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		open, err := r.jiraService.IsTicketOpen(ctx, ticket.TicketID)
+		if err != nil {
+			r.logger.Warn("Failed to check Jira ticket status", zap.String("ticket_id", ticket.TicketID), zap.Error(err))
+			report.Failed++
+			continue
+		}
+		if !open {
+			continue
+		}
+
+		if _, err := r.Resign(ctx, &ticket); err != nil {
+			r.logger.Warn("Failed to re-sign screenshot URL", zap.String("ticket_id", ticket.TicketID), zap.Error(err))
+			report.Failed++
+			continue
+		}
+		report.Resigned++
+	}
+
+	r.logger.Info("Screenshot URL re-signing completed",
+		zap.Int("candidates", report.Candidates),
+		zap.Int("resigned", report.Resigned),
+	)
+	return report, nil
+}
+
+// Resign generates a fresh presigned URL for a ticket's screenshot and
+// persists it to MongoDB and the Jira description
+func (r *URLResigner) Resign(ctx context.Context, ticket *FlattenedTicket) (string, error) {
+	// The screenshot is in the bucket of the tenant of the ticket
+	ctx = WithTenant(ctx, ticket.Tenant)
+	objectKey := ticket.ImageKey
+	if objectKey == "" {
+		key, err := r.storage.ObjectKeyFromURL(ticket.ImageURL)
+		if err != nil {
+			return "", err
+		}
+		objectKey = key
+	}
+
+	newURL, err := r.storage.PresignGetURL(ctx, objectKey)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(r.storage.PresignExpiry())
+
+	if ticket.ImageURL != "" {
+		if err := r.jiraService.ReplaceDescriptionText(ctx, ticket.TicketID, ticket.ImageURL, newURL); err != nil {
+			return "", err
+		}
+	}
+
+	if err := r.mongoService.UpdateTicketImageURL(ctx, ticket.TicketID, objectKey, newURL, expiresAt); err != nil {
+		return "", err
+	}
+
+	ticket.ImageKey = objectKey
+	ticket.ImageURL = newURL
+	ticket.ImageURLExpiresAt = expiresAt
+
+	return newURL, nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backends verifying that reports come from a person
+const (
+	VerificationNone      = "none"
+	VerificationRecaptcha = "recaptcha"
+	VerificationHCaptcha  = "hcaptcha"
+	VerificationTurnstile = "turnstile"
+	VerificationPoW       = "pow"
+)
+
+// captchaVerifyURLs are the siteverify endpoints of the CAPTCHA providers,
+// which share the same API
+var captchaVerifyURLs = map[string]string{
+	VerificationRecaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	VerificationHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	VerificationTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// ErrVerificationFailed is returned for missing, invalid or reused proofs
+var ErrVerificationFailed = errors.New("verification failed")
+
+// HumanVerifier checks the proof sent with a report that a person, not a
+// script, submitted it
+type HumanVerifier interface {
+	Verify(ctx context.Context, proof, remoteIP string) error
+}
+
+// CaptchaVerifier verifies CAPTCHA tokens with the provider's siteverify API
+type CaptchaVerifier struct {
+	client    *http.Client
+	verifyURL string
+	secret    string
+	minScore  float64
+}
+
+// NewCaptchaVerifier creates a verifier for a CAPTCHA provider. Scores below
+// minScore are rejected by providers that score tokens, such as reCAPTCHA v3.
+func NewCaptchaVerifier(provider, secret string, minScore float64) (*CaptchaVerifier, error) {
+	verifyURL, ok := captchaVerifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown CAPTCHA provider %q", provider)
+	}
+	if secret == "" {
+		return nil, errors.New("CAPTCHA secret is required")
+	}
+	return &CaptchaVerifier{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		verifyURL: verifyURL,
+		secret:    secret,
+		minScore:  minScore,
+	}, nil
+}
+
+// Verify checks a CAPTCHA token solved by the reporter
+func (v *CaptchaVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return fmt.Errorf("%w: CAPTCHA token is missing", ErrVerificationFailed)
+	}
+
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify CAPTCHA: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to verify CAPTCHA: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		Score      *float64 `json:"score"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode CAPTCHA verification: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: CAPTCHA rejected: %s", ErrVerificationFailed, strings.Join(result.ErrorCodes, ", "))
+	}
+	if result.Score != nil && *result.Score < v.minScore {
+		return fmt.Errorf("%w: CAPTCHA score %.1f is below %.1f", ErrVerificationFailed, *result.Score, v.minScore)
+	}
+	return nil
+}
+
+// powWindow is how old a proof of work may be, and how long used proofs are
+// remembered to reject replays
+const powWindow = 5 * time.Minute
+
+// ProofOfWork verifies hashcash-style stamps: "<unix time>:<random>:<nonce>"
+// whose SHA-256 hash starts with a number of zero bits. Finding the nonce
+// costs the client CPU time that grows with the difficulty, which makes
+// scripted flooding expensive without bothering people with a CAPTCHA.
+type ProofOfWork struct {
+	difficulty int
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewProofOfWork creates a verifier requiring hashes with difficulty leading
+// zero bits
+func NewProofOfWork(difficulty int) *ProofOfWork {
+	return &ProofOfWork{
+		difficulty: difficulty,
+		used:       make(map[string]time.Time),
+	}
+}
+
+// Verify checks a stamp; each stamp is accepted once
+func (p *ProofOfWork) Verify(_ context.Context, stamp, _ string) error {
+	if stamp == "" {
+		return fmt.Errorf("%w: proof of work is missing", ErrVerificationFailed)
+	}
+	parts := strings.Split(stamp, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("%w: proof of work must be <unix time>:<random>:<nonce>", ErrVerificationFailed)
+	}
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid proof of work time", ErrVerificationFailed)
+	}
+	now := time.Now()
+	if age := now.Sub(time.Unix(issued, 0)); age > powWindow || age < -time.Minute {
+		return fmt.Errorf("%w: proof of work is expired", ErrVerificationFailed)
+	}
+
+	sum := sha256.Sum256([]byte(stamp))
+	if leadingZeroBits(sum[:]) < p.difficulty {
+		return fmt.Errorf("%w: proof of work needs %d leading zero bits", ErrVerificationFailed, p.difficulty)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for seen, at := range p.used {
+		if now.Sub(at) > powWindow+time.Minute {
+			delete(p.used, seen)
+		}
+	}
+	if _, ok := p.used[stamp]; ok {
+		return fmt.Errorf("%w: proof of work was already used", ErrVerificationFailed)
+	}
+	p.used[stamp] = now
+	return nil
+}
+
+// Difficulty returns the number of leading zero bits stamps need
+func (p *ProofOfWork) Difficulty() int {
+	return p.difficulty
+}
+
+func leadingZeroBits(hash []byte) int {
+	count := 0
+	for _, b := range hash {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
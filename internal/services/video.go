@@ -0,0 +1,368 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// Supported screen recording formats
+const (
+	ContentTypeMP4  = "video/mp4"
+	ContentTypeWebM = "video/webm"
+)
+
+// ErrUnsupportedVideo is returned for video formats other than MP4 and WebM
+var ErrUnsupportedVideo = errors.New("unsupported video format, use mp4 or webm")
+
+// UploadContentType returns the content type of an upload, falling back to
+// its file extension for clients that send application/octet-stream
+func UploadContentType(file *multipart.FileHeader) string {
+	contentType := strings.ToLower(strings.TrimSpace(file.Header.Get("Content-Type")))
+	if idx := strings.Index(contentType, ";"); idx >= 0 {
+		contentType = strings.TrimSpace(contentType[:idx])
+	}
+	if contentType != "" && contentType != "application/octet-stream" {
+		return contentType
+	}
+
+	switch strings.ToLower(filepath.Ext(file.Filename)) {
+	case ".mp4":
+		return ContentTypeMP4
+	case ".webm":
+		return ContentTypeWebM
+	}
+	return contentType
+}
+
+// IsVideoContentType reports whether a content type is a video
+func IsVideoContentType(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(contentType), "video/")
+}
+
+// ProbeVideo reads the duration and video codec from the container headers
+// of an MP4 or WebM upload
+func ProbeVideo(file *multipart.FileHeader, contentType string) (*models.VideoMetadata, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	switch contentType {
+	case ContentTypeMP4:
+		return probeMP4(src, file.Size)
+	case ContentTypeWebM:
+		return probeWebM(src, file.Size)
+	default:
+		return nil, ErrUnsupportedVideo
+	}
+}
+
+// probeMP4 walks the ISO BMFF box tree: the duration comes from moov/mvhd and
+// the codec from the sample description of the first video track
+func probeMP4(r io.ReaderAt, size int64) (*models.VideoMetadata, error) {
+	meta := &models.VideoMetadata{Container: "mp4"}
+
+	moov, ok, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("mp4: moov box not found")
+	}
+
+	if mvhd, ok, err := findBox(r, moov.body, moov.end, "mvhd"); err != nil {
+		return nil, err
+	} else if ok {
+		meta.DurationSeconds, err = readMVHDDuration(r, mvhd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Find the first track whose handler is "vide"
+	for offset := moov.body; offset < moov.end; {
+		trak, ok, err := findBox(r, offset, moov.end, "trak")
+		if err != nil || !ok {
+			break
+		}
+		offset = trak.end
+
+		mdia, ok, err := findBox(r, trak.body, trak.end, "mdia")
+		if err != nil || !ok {
+			continue
+		}
+		hdlr, ok, err := findBox(r, mdia.body, mdia.end, "hdlr")
+		if err != nil || !ok {
+			continue
+		}
+		// version/flags (4) + pre_defined (4) + handler_type (4)
+		handler := make([]byte, 4)
+		if _, err := r.ReadAt(handler, hdlr.body+8); err != nil || string(handler) != "vide" {
+			continue
+		}
+
+		stsd, ok, err := findBoxPath(r, mdia, "minf", "stbl", "stsd")
+		if err != nil || !ok {
+			continue
+		}
+		// version/flags (4) + entry_count (4) + first entry size (4) + format (4)
+		format := make([]byte, 4)
+		if _, err := r.ReadAt(format, stsd.body+12); err == nil {
+			meta.Codec = string(format)
+		}
+		break
+	}
+
+	return meta, nil
+}
+
+// mp4Box is the location of an ISO BMFF box
+type mp4Box struct {
+	body int64
+	end  int64
+}
+
+// findBox returns the first box of the given type between start and end
+func findBox(r io.ReaderAt, start, end int64, boxType string) (mp4Box, bool, error) {
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return mp4Box{}, false, fmt.Errorf("mp4: failed to read box header: %w", err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// Box extends to the end of the enclosing container
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return mp4Box{}, false, fmt.Errorf("mp4: failed to read box size: %w", err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return mp4Box{}, false, errors.New("mp4: malformed box")
+		}
+
+		if string(header[4:8]) == boxType {
+			return mp4Box{body: offset + headerSize, end: offset + size}, true, nil
+		}
+		offset += size
+	}
+
+	return mp4Box{}, false, nil
+}
+
+// findBoxPath descends through nested boxes
+func findBoxPath(r io.ReaderAt, parent mp4Box, path ...string) (mp4Box, bool, error) {
+	box := parent
+	for _, boxType := range path {
+		next, ok, err := findBox(r, box.body, box.end, boxType)
+		if err != nil || !ok {
+			return mp4Box{}, ok, err
+		}
+		box = next
+	}
+	return box, true, nil
+}
+
+// readMVHDDuration decodes the movie duration in seconds
+func readMVHDDuration(r io.ReaderAt, mvhd mp4Box) (float64, error) {
+	buf := make([]byte, 32)
+	n, err := r.ReadAt(buf, mvhd.body)
+	if err != nil && err != io.EOF {
+		return 0, fmt.Errorf("mp4: failed to read mvhd: %w", err)
+	}
+	buf = buf[:n]
+
+	var timescale, duration uint64
+	if len(buf) > 0 && buf[0] == 1 {
+		// version 1: 64-bit creation/modification times and duration
+		if len(buf) < 32 {
+			return 0, errors.New("mp4: truncated mvhd")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[20:24]))
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		if len(buf) < 20 {
+			return 0, errors.New("mp4: truncated mvhd")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(buf[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+
+	if timescale == 0 {
+		return 0, nil
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// EBML element IDs used to probe WebM files
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlTracks        = 0x1654AE6B
+	ebmlTrackEntry    = 0xAE
+	ebmlTrackType     = 0x83
+	ebmlCodecID       = 0x86
+	ebmlCluster       = 0x1F43B675
+)
+
+// webmHeaderLimit bounds how much of a WebM file is read looking for the
+// Info and Tracks elements, which precede the first cluster
+const webmHeaderLimit = 1 << 20
+
+// probeWebM reads Segment/Info for the duration and Segment/Tracks for the
+// codec of the first video track. Recordings made with MediaRecorder often
+// have no duration, in which case it is left at zero.
+func probeWebM(r io.ReaderAt, size int64) (*models.VideoMetadata, error) {
+	limit := size
+	if limit > webmHeaderLimit {
+		limit = webmHeaderLimit
+	}
+	buf := make([]byte, limit)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("webm: failed to read header: %w", err)
+	}
+	buf = buf[:n]
+
+	meta := &models.VideoMetadata{Container: "webm"}
+	timecodeScale := uint64(1000000)
+	var rawDuration float64
+
+	var walk func(data []byte) bool
+	walk = func(data []byte) bool {
+		for len(data) > 0 {
+			id, size, headerLen, ok := readEBMLHeader(data)
+			if !ok {
+				return false
+			}
+			data = data[headerLen:]
+			if size < 0 || size > int64(len(data)) {
+				// Unknown or truncated size: the element runs to the end of the buffer
+				size = int64(len(data))
+			}
+			body := data[:size]
+
+			switch id {
+			case ebmlCluster:
+				// Media data follows; all header elements have been seen
+				return false
+			case ebmlSegment, ebmlInfo, ebmlTracks:
+				if !walk(body) {
+					return false
+				}
+			case ebmlTrackEntry:
+				if codec, isVideo := parseTrackEntry(body); isVideo && meta.Codec == "" {
+					meta.Codec = codec
+				}
+			case ebmlTimecodeScale:
+				timecodeScale = readEBMLUint(body)
+			case ebmlDuration:
+				rawDuration = readEBMLFloat(body)
+			}
+
+			data = data[size:]
+		}
+		return true
+	}
+	walk(buf)
+
+	meta.DurationSeconds = rawDuration * float64(timecodeScale) / 1e9
+	return meta, nil
+}
+
+// parseTrackEntry returns the codec ID of a track and whether it is a video track
+func parseTrackEntry(data []byte) (string, bool) {
+	var codec string
+	var trackType uint64
+	for len(data) > 0 {
+		id, size, headerLen, ok := readEBMLHeader(data)
+		if !ok || size < 0 || size > int64(len(data)-headerLen) {
+			break
+		}
+		body := data[headerLen : int64(headerLen)+size]
+		switch id {
+		case ebmlTrackType:
+			trackType = readEBMLUint(body)
+		case ebmlCodecID:
+			codec = string(bytes.TrimRight(body, "\x00"))
+		}
+		data = data[int64(headerLen)+size:]
+	}
+	return codec, trackType == 1
+}
+
+// readEBMLHeader decodes an element ID and data size. A size of -1 means unknown.
+func readEBMLHeader(data []byte) (id uint32, size int64, headerLen int, ok bool) {
+	idLen := vintLength(data)
+	if idLen == 0 || idLen > 4 || len(data) < idLen {
+		return 0, 0, 0, false
+	}
+	for _, b := range data[:idLen] {
+		id = id<<8 | uint32(b)
+	}
+
+	rest := data[idLen:]
+	sizeLen := vintLength(rest)
+	if sizeLen == 0 || len(rest) < sizeLen {
+		return 0, 0, 0, false
+	}
+	value := uint64(rest[0] & (0xFF >> sizeLen))
+	allOnes := value == uint64(0xFF>>sizeLen)
+	for _, b := range rest[1:sizeLen] {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	if allOnes {
+		return id, -1, idLen + sizeLen, true
+	}
+
+	return id, int64(value), idLen + sizeLen, true
+}
+
+// vintLength returns the length of an EBML variable-size integer
+func vintLength(data []byte) int {
+	if len(data) == 0 || data[0] == 0 {
+		return 0
+	}
+	length := 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	return length
+}
+
+func readEBMLUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func readEBMLFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+// Errors of inbound webhook verification
+var (
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrStaleWebhook            = errors.New("webhook timestamp is missing or outside the accepted window")
+	ErrReplayedWebhook         = errors.New("webhook was already delivered")
+)
+
+// WebhookVerifier authenticates inbound webhooks signed with a shared secret.
+// Signatures are "sha256=<hex HMAC>" of "<timestamp>.<body>" when the sender
+// sends a timestamp header, or of the body alone for senders such as Jira
+// that put the timestamp in the body. Deliveries outside the tolerance are
+// rejected, and deliveries handled before are recognized by their signed
+// content for as long as they would be accepted.
+type WebhookVerifier struct {
+	secret    []byte
+	tolerance time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewWebhookVerifier creates a verifier for webhooks signed with secret and
+// sent at most tolerance before or after they are received
+func NewWebhookVerifier(secret string, tolerance time.Duration) *WebhookVerifier {
+	return &WebhookVerifier{
+		secret:    []byte(secret),
+		tolerance: tolerance,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// Sign returns the signature of a body sent with a timestamp header, or with
+// none when timestamp is ""
+func (v *WebhookVerifier) Sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, v.secret)
+	if timestamp != "" {
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature of a body and its timestamp header
+func (v *WebhookVerifier) VerifySignature(signature, timestamp string, body []byte) error {
+	if signature == "" {
+		return fmt.Errorf("%w: signature is missing", ErrInvalidWebhookSignature)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		signature = "sha256=" + signature
+	}
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(v.Sign(timestamp, body))) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// DeliveryKey returns the key a delivery is recognized by: the signature of
+// its timestamp header and body, which a replay cannot change without
+// invalidating it. Headers outside the signature, such as delivery IDs, are
+// not used.
+func (v *WebhookVerifier) DeliveryKey(timestamp string, body []byte) string {
+	return v.Sign(timestamp, body)
+}
+
+// ClaimDelivery rejects deliveries sent outside the tolerance and those
+// already claimed, and otherwise claims the delivery until it would be
+// stale. Checking and claiming is a single step, so of concurrent copies of
+// a delivery only one is handled.
+func (v *WebhookVerifier) ClaimDelivery(key string, sentAt time.Time) error {
+	now := time.Now()
+	if sentAt.IsZero() || sentAt.Before(now.Add(-v.tolerance)) || sentAt.After(now.Add(v.tolerance)) {
+		return ErrStaleWebhook
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for seen, at := range v.seen {
+		if now.Sub(at) > 2*v.tolerance {
+			delete(v.seen, seen)
+		}
+	}
+	if _, ok := v.seen[key]; ok {
+		return ErrReplayedWebhook
+	}
+	v.seen[key] = now
+	return nil
+}
+
+// ReleaseDelivery forgets a claimed delivery that failed, so that the
+// sender's retry is handled
+func (v *WebhookVerifier) ReleaseDelivery(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.seen, key)
+}
+
+// Jira webhook events that change the state of a ticket
+const (
+	JiraEventIssueCreated = "jira:issue_created"
+	JiraEventIssueUpdated = "jira:issue_updated"
+)
+
+// JiraWebhookEvent is the part of a Jira issue webhook needed to sync the
+// stored ticket
+type JiraWebhookEvent struct {
+	Event     string      `json:"webhookEvent"`
+	Timestamp int64       `json:"timestamp"` // milliseconds since the epoch
+	Issue     *jira.Issue `json:"issue"`
+}
+
+// ParseJiraWebhook decodes a Jira webhook
+func ParseJiraWebhook(body []byte) (*JiraWebhookEvent, error) {
+	var event JiraWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid Jira webhook: %w", err)
+	}
+	return &event, nil
+}
+
+// State returns the status, assignee and resolution of the event's issue
+func (e *JiraWebhookEvent) State() *TicketState {
+	if e.Issue == nil {
+		return &TicketState{}
+	}
+	return issueState(e.Issue)
+}
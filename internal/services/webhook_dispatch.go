@@ -0,0 +1,464 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// Headers of outbound webhooks; receivers verify them like ronnin verifies
+// inbound webhooks
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookEventHeader     = "X-Webhook-Event"
+)
+
+// webhookQueueSize bounds the deliveries waiting to be made; further ones
+// are recorded as failed rather than holding up requests
+const webhookQueueSize = 100
+
+// webhookTimeout bounds one delivery attempt
+const webhookTimeout = 10 * time.Second
+
+// webhookFailuresCollection is the collection deliveries that exhausted
+// their attempts are recorded in
+const webhookFailuresCollection = "webhook_failures"
+
+// webhookFailureWriteTimeout bounds recording a failed delivery
+const webhookFailureWriteTimeout = 5 * time.Second
+
+// maxWebhookFailures caps the failed deliveries listed and replayed at once
+const maxWebhookFailures = 1000
+
+var (
+	// ErrWebhookQueueFull is returned when no more deliveries can be queued
+	ErrWebhookQueueFull = errors.New("webhook queue is full")
+	// ErrWebhookFailureNotFound is returned for unknown failed deliveries
+	ErrWebhookFailureNotFound = errors.New("failed webhook delivery not found")
+	// ErrWebhookSubscriptionRemoved is returned when replaying a delivery to
+	// a subscription that is no longer configured
+	ErrWebhookSubscriptionRemoved = errors.New("webhook subscription is no longer configured")
+)
+
+// WebhookSubscription is a receiver of outbound webhooks. Empty Events and
+// Products receive every event.
+type WebhookSubscription struct {
+	Name     string
+	URL      string
+	Secret   string
+	Events   []string
+	Products []string
+}
+
+// WebhookFailure records a delivery that exhausted its attempts, kept until
+// it is replayed
+type WebhookFailure struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	EventID      string             `bson:"event_id" json:"eventId"`
+	Event        string             `bson:"event" json:"event"`
+	Subscription string             `bson:"subscription" json:"subscription"`
+	URL          string             `bson:"url" json:"url"`
+	Payload      string             `bson:"payload" json:"payload"`
+	Attempts     int                `bson:"attempts" json:"attempts"`
+	LastStatus   int                `bson:"last_status,omitempty" json:"lastStatus,omitempty"`
+	LastError    string             `bson:"last_error" json:"lastError"`
+	FailedAt     time.Time          `bson:"failed_at" json:"failedAt"`
+}
+
+// webhookDelivery is an event waiting to be delivered to a subscription
+type webhookDelivery struct {
+	subscription *WebhookSubscription
+	eventID      string
+	event        string
+	body         []byte
+	attempts     int
+}
+
+// WebhookDispatcher delivers signed events to the subscriptions of
+// WEBHOOK_SUBSCRIPTIONS in the background. Failed attempts are retried with
+// exponential backoff; deliveries that exhaust maxAttempts, or are still
+// waiting for a retry on shutdown, are recorded in MongoDB to be replayed.
+type WebhookDispatcher struct {
+	subscriptions []WebhookSubscription
+	maxAttempts   int
+	backoff       time.Duration
+	mongoService  *MongoDBService
+	client        *http.Client
+	logger        *zap.Logger
+
+	queue chan webhookDelivery
+
+	mu       sync.Mutex
+	stopping bool
+	// retries are the deliveries waiting for their next attempt
+	retries map[*time.Timer]webhookDelivery
+}
+
+// NewWebhookDispatcher creates a dispatcher attempting each delivery up to
+// maxAttempts times, waiting backoff before the first retry and twice as
+// long before each further one. Without mongoService failed deliveries are
+// only logged.
+func NewWebhookDispatcher(subscriptions []WebhookSubscription, maxAttempts int, backoff time.Duration, mongoService *MongoDBService, log *zap.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		subscriptions: subscriptions,
+		maxAttempts:   maxAttempts,
+		backoff:       backoff,
+		mongoService:  mongoService,
+		client:        &http.Client{Timeout: webhookTimeout},
+		logger:        log,
+		queue:         make(chan webhookDelivery, webhookQueueSize),
+		retries:       make(map[*time.Timer]webhookDelivery),
+	}
+}
+
+// Publish queues an event of a product for the subscriptions it matches. It
+// never blocks.
+func (d *WebhookDispatcher) Publish(event, product string, data interface{}) {
+	var matching []*WebhookSubscription
+	for i := range d.subscriptions {
+		sub := &d.subscriptions[i]
+		if (len(sub.Events) == 0 || slices.Contains(sub.Events, event)) &&
+			(len(sub.Products) == 0 || slices.Contains(sub.Products, product)) {
+			matching = append(matching, sub)
+		}
+	}
+	if len(matching) == 0 {
+		return
+	}
+
+	envelope := NewEvent(event, data)
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		d.logger.Error("Failed to encode webhook event", zap.String("event", event), zap.Error(err))
+		return
+	}
+	for _, sub := range matching {
+		d.enqueue(webhookDelivery{subscription: sub, eventID: envelope.ID, event: event, body: body})
+	}
+}
+
+// TicketCreated publishes the ticket.created event of a new ticket
+func (d *WebhookDispatcher) TicketCreated(data TicketEventData) {
+	d.Publish(EventTicketCreated, data.Product, data)
+}
+
+// TicketStateChanged publishes the ticket.updated event of a change to the
+// status, assignee or resolution of a ticket
+func (d *WebhookDispatcher) TicketStateChanged(ticket *FlattenedTicket, state *TicketState) {
+	if data, ok := TicketUpdate(ticket, state); ok {
+		d.Publish(EventTicketUpdated, ticket.Product, data)
+	}
+}
+
+// ReportFailed publishes the report.failed event of a report that could not
+// be turned into a ticket
+func (d *WebhookDispatcher) ReportFailed(data ReportFailedEventData) {
+	d.Publish(EventReportFailed, data.Product, data)
+}
+
+// enqueue queues a delivery, recording it as failed when the queue is full
+func (d *WebhookDispatcher) enqueue(delivery webhookDelivery) {
+	select {
+	case d.queue <- delivery:
+	default:
+		go d.fail(context.Background(), delivery, 0, ErrWebhookQueueFull)
+	}
+}
+
+// Run delivers queued events until stopping is closed, then attempts the
+// ones still queued once, until ctx is done. Deliveries that fail on that
+// attempt, are left in the queue or are waiting for a retry are recorded as
+// failed.
+func (d *WebhookDispatcher) Run(ctx context.Context, stopping <-chan struct{}) {
+	for {
+		select {
+		case delivery := <-d.queue:
+			d.deliver(ctx, delivery)
+		case <-stopping:
+			d.mu.Lock()
+			d.stopping = true
+			pending := make([]webhookDelivery, 0, len(d.retries))
+			for timer, delivery := range d.retries {
+				if timer.Stop() {
+					pending = append(pending, delivery)
+				}
+			}
+			clear(d.retries)
+			d.mu.Unlock()
+
+			for ctx.Err() == nil {
+				delivery, ok := d.next()
+				if !ok {
+					break
+				}
+				d.deliver(ctx, delivery)
+			}
+			for {
+				delivery, ok := d.next()
+				if !ok {
+					break
+				}
+				pending = append(pending, delivery)
+			}
+			for _, delivery := range pending {
+				d.fail(ctx, delivery, 0, errors.New("server shut down before the delivery was made"))
+			}
+			return
+		}
+	}
+}
+
+// next returns a queued delivery without waiting for one
+func (d *WebhookDispatcher) next() (webhookDelivery, bool) {
+	select {
+	case delivery := <-d.queue:
+		return delivery, true
+	default:
+		return webhookDelivery{}, false
+	}
+}
+
+// deliver makes an attempt of a delivery, scheduling a retry or recording
+// the delivery as failed when it does not succeed
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery webhookDelivery) {
+	delivery.attempts++
+	status, err := d.post(ctx, delivery)
+	if err == nil {
+		return
+	}
+
+	// Other client errors will not succeed on retry
+	retryable := status == 0 || status >= http.StatusInternalServerError ||
+		status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+	if !retryable || delivery.attempts >= d.maxAttempts || !d.retry(delivery) {
+		d.fail(ctx, delivery, status, err)
+		return
+	}
+	d.logger.Info("Webhook delivery failed, retrying",
+		zap.String("subscription", delivery.subscription.Name),
+		zap.String("event_id", delivery.eventID),
+		zap.Int("attempt", delivery.attempts),
+		zap.Error(err),
+	)
+}
+
+// retry schedules the next attempt of a delivery after its backoff, unless
+// the dispatcher is stopping
+func (d *WebhookDispatcher) retry(delivery webhookDelivery) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopping {
+		return false
+	}
+
+	delay := d.backoff << (delivery.attempts - 1)
+	// Jitter spreads the retries of deliveries that failed together
+	delay += time.Duration(rand.Int64N(int64(delay)/10 + 1))
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		_, scheduled := d.retries[timer]
+		delete(d.retries, timer)
+		d.mu.Unlock()
+		// Run took over the delivery if it is no longer scheduled
+		if scheduled {
+			d.enqueue(delivery)
+		}
+	})
+	d.retries[timer] = delivery
+	return true
+}
+
+// post sends a delivery, returning the response status when there is one
+func (d *WebhookDispatcher) post(ctx context.Context, delivery webhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.subscription.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ronnin-webhooks")
+	req.Header.Set(WebhookIDHeader, delivery.eventID)
+	req.Header.Set(WebhookEventHeader, delivery.event)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, NewWebhookVerifier(delivery.subscription.Secret, 0).Sign(timestamp, delivery.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("receiver answered %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return resp.StatusCode, nil
+}
+
+// fail records a delivery as failed when MongoDB is configured
+func (d *WebhookDispatcher) fail(ctx context.Context, delivery webhookDelivery, status int, err error) {
+	log := d.logger.With(
+		zap.String("subscription", delivery.subscription.Name),
+		zap.String("event", delivery.event),
+		zap.String("event_id", delivery.eventID),
+		zap.Int("attempts", delivery.attempts),
+	)
+	log.Warn("Webhook delivery failed", zap.Error(err))
+	if d.mongoService == nil {
+		return
+	}
+
+	// The delivery may have failed because ctx ended
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookFailureWriteTimeout)
+	defer cancel()
+	failure := &WebhookFailure{
+		EventID:      delivery.eventID,
+		Event:        delivery.event,
+		Subscription: delivery.subscription.Name,
+		URL:          delivery.subscription.URL,
+		Payload:      string(delivery.body),
+		Attempts:     delivery.attempts,
+		LastStatus:   status,
+		LastError:    err.Error(),
+		FailedAt:     time.Now().UTC(),
+	}
+	if err := d.mongoService.SaveWebhookFailure(ctx, failure); err != nil {
+		log.Error("Failed to record failed webhook delivery", zap.Error(err))
+	}
+}
+
+// Failures lists the recorded failed deliveries, most recent first
+func (d *WebhookDispatcher) Failures(ctx context.Context) ([]WebhookFailure, error) {
+	if d.mongoService == nil {
+		return nil, nil
+	}
+	return d.mongoService.GetWebhookFailures(ctx, maxWebhookFailures)
+}
+
+// Replay queues a failed delivery to its subscription again, with the same
+// event ID, and removes its record. Deliveries to subscriptions no longer
+// configured cannot be replayed.
+func (d *WebhookDispatcher) Replay(ctx context.Context, id string) (*WebhookFailure, error) {
+	if d.mongoService == nil {
+		return nil, ErrWebhookFailureNotFound
+	}
+	failure, err := d.mongoService.GetWebhookFailure(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.replay(ctx, failure); err != nil {
+		return nil, err
+	}
+	return failure, nil
+}
+
+// ReplayAll queues every failed delivery again, stopping when the queue is
+// full, and returns the number queued
+func (d *WebhookDispatcher) ReplayAll(ctx context.Context) (int, error) {
+	failures, err := d.Failures(ctx)
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	// Oldest first, so events arrive in their original order
+	for i := len(failures) - 1; i >= 0; i-- {
+		if err := d.replay(ctx, &failures[i]); err != nil {
+			if errors.Is(err, ErrWebhookQueueFull) {
+				return replayed, err
+			}
+			d.logger.Warn("Failed to replay webhook delivery", zap.String("id", failures[i].ID.Hex()), zap.Error(err))
+			continue
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (d *WebhookDispatcher) replay(ctx context.Context, failure *WebhookFailure) error {
+	var sub *WebhookSubscription
+	for i := range d.subscriptions {
+		if d.subscriptions[i].Name == failure.Subscription {
+			sub = &d.subscriptions[i]
+		}
+	}
+	if sub == nil {
+		return fmt.Errorf("%w: %s", ErrWebhookSubscriptionRemoved, failure.Subscription)
+	}
+
+	select {
+	case d.queue <- webhookDelivery{subscription: sub, eventID: failure.EventID, event: failure.Event, body: []byte(failure.Payload)}:
+	default:
+		return ErrWebhookQueueFull
+	}
+	return d.mongoService.DeleteWebhookFailure(ctx, failure.ID)
+}
+
+// SaveWebhookFailure records a failed webhook delivery
+func (s *MongoDBService) SaveWebhookFailure(ctx context.Context, failure *WebhookFailure) error {
+	if _, err := s.webhookFailures.InsertOne(ctx, failure); err != nil {
+		return fmt.Errorf("failed to insert webhook failure: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookFailures retrieves up to limit failed webhook deliveries, most
+// recent first
+func (s *MongoDBService) GetWebhookFailures(ctx context.Context, limit int64) ([]WebhookFailure, error) {
+	cursor, err := s.webhookFailures.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "failed_at", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook failures: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var failures []WebhookFailure
+	if err := cursor.All(ctx, &failures); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook failures: %w", err)
+	}
+	return failures, nil
+}
+
+// GetWebhookFailure retrieves a failed webhook delivery by ID
+func (s *MongoDBService) GetWebhookFailure(ctx context.Context, id string) (*WebhookFailure, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrWebhookFailureNotFound
+	}
+	var failure WebhookFailure
+	if err := s.webhookFailures.FindOne(ctx, bson.M{"_id": objectID}).Decode(&failure); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWebhookFailureNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook failure: %w", err)
+	}
+	return &failure, nil
+}
+
+// DeleteWebhookFailure removes the record of a failed webhook delivery
+func (s *MongoDBService) DeleteWebhookFailure(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := s.webhookFailures.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return fmt.Errorf("failed to delete webhook failure: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClaimDeliveryOnce(t *testing.T) {
+	verifier := NewWebhookVerifier("secret", 5*time.Minute)
+	body := []byte(`{"webhookEvent":"jira:issue_updated"}`)
+	key := verifier.DeliveryKey("", body)
+
+	// Of concurrent copies of a delivery only one is handled
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if verifier.ClaimDelivery(key, time.Now()) == nil {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := claimed.Load(); n != 1 {
+		t.Fatalf("%d copies of a delivery were claimed, want 1", n)
+	}
+
+	// A delivery that failed is handled again when retried
+	verifier.ReleaseDelivery(key)
+	if err := verifier.ClaimDelivery(key, time.Now()); err != nil {
+		t.Fatalf("retry of a released delivery: %v", err)
+	}
+	if err := verifier.ClaimDelivery(key, time.Now()); !errors.Is(err, ErrReplayedWebhook) {
+		t.Errorf("replay = %v, want ErrReplayedWebhook", err)
+	}
+	if err := verifier.ClaimDelivery(verifier.DeliveryKey("", []byte(`{}`)), time.Now().Add(-time.Hour)); !errors.Is(err, ErrStaleWebhook) {
+		t.Errorf("stale delivery = %v, want ErrStaleWebhook", err)
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"sync"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+)
+
+// Names of the worker pools of dependencies
+const (
+	WorkerPoolTracker = "tracker"
+	WorkerPoolStorage = "storage"
+)
+
+// ErrPoolSaturated is returned by WorkerPool.Do when every worker is busy
+// and the queue is full, or the call waited in the queue for too long
+var ErrPoolSaturated = errors.New("too many requests to the dependency are in flight")
+
+// WorkerPool bounds the concurrent calls to a dependency. Calls beyond size
+// wait in a queue of up to queue calls for at most maxWait; calls that find
+// the queue full or wait longer are shed with ErrPoolSaturated, so a report
+// storm is turned away rather than piling goroutines onto the dependency.
+type WorkerPool struct {
+	name    string
+	slots   chan struct{}
+	queue   int
+	maxWait time.Duration
+
+	mu     sync.Mutex
+	queued int
+}
+
+// NewWorkerPool creates the pool of a dependency with size workers. It
+// returns nil, which runs every call, when size is 0.
+func NewWorkerPool(name string, size, queue int, maxWait time.Duration) *WorkerPool {
+	if size <= 0 {
+		return nil
+	}
+	workerPoolSize.WithLabelValues(name).Set(float64(size))
+	return &WorkerPool{
+		name:    name,
+		slots:   make(chan struct{}, size),
+		queue:   queue,
+		maxWait: maxWait,
+	}
+}
+
+// Do runs fn once a worker is free. It returns ErrPoolSaturated without
+// running fn when the pool is saturated, and the error of ctx if it ends
+// while fn waits.
+func (p *WorkerPool) Do(ctx context.Context, fn func() error) error {
+	if p == nil {
+		return fn()
+	}
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	defer p.release()
+	return fn()
+}
+
+func (p *WorkerPool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		workerPoolActive.WithLabelValues(p.name).Inc()
+		workerPoolWait.WithLabelValues(p.name).Observe(0)
+		return nil
+	default:
+	}
+
+	p.mu.Lock()
+	if p.queued >= p.queue {
+		p.mu.Unlock()
+		workerPoolShedTotal.WithLabelValues(p.name).Inc()
+		return ErrPoolSaturated
+	}
+	p.queued++
+	workerPoolQueued.WithLabelValues(p.name).Set(float64(p.queued))
+	p.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		p.mu.Lock()
+		p.queued--
+		workerPoolQueued.WithLabelValues(p.name).Set(float64(p.queued))
+		p.mu.Unlock()
+		workerPoolWait.WithLabelValues(p.name).Observe(time.Since(start).Seconds())
+	}()
+
+	var timeout <-chan time.Time
+	if p.maxWait > 0 {
+		timer := time.NewTimer(p.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p.slots <- struct{}{}:
+		workerPoolActive.WithLabelValues(p.name).Inc()
+		return nil
+	case <-timeout:
+		workerPoolShedTotal.WithLabelValues(p.name).Inc()
+		return ErrPoolSaturated
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *WorkerPool) release() {
+	<-p.slots
+	workerPoolActive.WithLabelValues(p.name).Dec()
+}
+
+// pooledTracker runs the calls of an issue tracker to its API in a worker
+// pool. Ping is left out, so readiness checks see the tracker itself.
+type pooledTracker struct {
+	IssueTracker
+	pool *WorkerPool
+}
+
+// PoolTracker runs the API calls of tracker in pool, which may be nil
+func PoolTracker(tracker IssueTracker, pool *WorkerPool) IssueTracker {
+	if pool == nil {
+		return tracker
+	}
+	return &pooledTracker{IssueTracker: tracker, pool: pool}
+}
+
+func (t *pooledTracker) CreateTicket(ctx context.Context, req *models.TicketRequest) (resp *models.TicketResponse, err error) {
+	err = t.pool.Do(ctx, func() error {
+		resp, err = t.IssueTracker.CreateTicket(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (t *pooledTracker) IsTicketOpen(ctx context.Context, ticketID string) (open bool, err error) {
+	err = t.pool.Do(ctx, func() error {
+		open, err = t.IssueTracker.IsTicketOpen(ctx, ticketID)
+		return err
+	})
+	return open, err
+}
+
+func (t *pooledTracker) GetTicketState(ctx context.Context, ticketID string) (state *TicketState, err error) {
+	err = t.pool.Do(ctx, func() error {
+		state, err = t.IssueTracker.GetTicketState(ctx, ticketID)
+		return err
+	})
+	return state, err
+}
+
+func (t *pooledTracker) GetTicketStates(ctx context.Context, ticketIDs []string) (states map[string]*TicketState, err error) {
+	err = t.pool.Do(ctx, func() error {
+		states, err = t.IssueTracker.GetTicketStates(ctx, ticketIDs)
+		return err
+	})
+	return states, err
+}
+
+func (t *pooledTracker) AssignTicket(ctx context.Context, ticketID, accountID string) error {
+	return t.pool.Do(ctx, func() error {
+		return t.IssueTracker.AssignTicket(ctx, ticketID, accountID)
+	})
+}
+
+func (t *pooledTracker) AddComment(ctx context.Context, ticketID, author, body string) error {
+	return t.pool.Do(ctx, func() error {
+		return t.IssueTracker.AddComment(ctx, ticketID, author, body)
+	})
+}
+
+func (t *pooledTracker) ReplaceDescriptionText(ctx context.Context, ticketID, oldText, newText string) error {
+	return t.pool.Do(ctx, func() error {
+		return t.IssueTracker.ReplaceDescriptionText(ctx, ticketID, oldText, newText)
+	})
+}
+
+func (t *pooledTracker) ReleaseScreenshot(ctx context.Context, ticketID, imageURL, contentType string) error {
+	return t.pool.Do(ctx, func() error {
+		return t.IssueTracker.ReleaseScreenshot(ctx, ticketID, imageURL, contentType)
+	})
+}
+
+func (t *pooledTracker) RemoveScreenshot(ctx context.Context, ticketID string) error {
+	return t.pool.Do(ctx, func() error {
+		return t.IssueTracker.RemoveScreenshot(ctx, ticketID)
+	})
+}
+
+// pooledStorage runs the requests of an object storage backend in a worker
+// pool. Presigning is local and left out, as is Ping, so readiness checks
+// see the backend itself, and ListObjects, whose long scans by background
+// jobs would hold a worker throughout.
+type pooledStorage struct {
+	ObjectStorage
+	pool *WorkerPool
+}
+
+// PoolStorage runs the requests of storage in pool, which may be nil
+func PoolStorage(storage ObjectStorage, pool *WorkerPool) ObjectStorage {
+	if pool == nil || storage == nil {
+		return storage
+	}
+	return &pooledStorage{ObjectStorage: storage, pool: pool}
+}
+
+func (s *pooledStorage) UploadFile(ctx context.Context, file *multipart.FileHeader, objectKey string, tags map[string]string) (url string, err error) {
+	err = s.pool.Do(ctx, func() error {
+		url, err = s.ObjectStorage.UploadFile(ctx, file, objectKey, tags)
+		return err
+	})
+	return url, err
+}
+
+func (s *pooledStorage) UploadStream(ctx context.Context, objectKey string, r io.Reader, size int64, contentType string, tags map[string]string) error {
+	return s.pool.Do(ctx, func() error {
+		return s.ObjectStorage.UploadStream(ctx, objectKey, r, size, contentType, tags)
+	})
+}
+
+func (s *pooledStorage) StatObject(ctx context.Context, objectKey string) (info *ObjectInfo, err error) {
+	err = s.pool.Do(ctx, func() error {
+		info, err = s.ObjectStorage.StatObject(ctx, objectKey)
+		return err
+	})
+	return info, err
+}
+
+func (s *pooledStorage) TagObject(ctx context.Context, objectKey string, tags map[string]string) error {
+	return s.pool.Do(ctx, func() error {
+		return s.ObjectStorage.TagObject(ctx, objectKey, tags)
+	})
+}
+
+// OpenObject holds a worker until the object is opened; reading it is not
+// limited
+func (s *pooledStorage) OpenObject(ctx context.Context, objectKey string) (body io.ReadCloser, err error) {
+	err = s.pool.Do(ctx, func() error {
+		body, err = s.ObjectStorage.OpenObject(ctx, objectKey)
+		return err
+	})
+	return body, err
+}
+
+func (s *pooledStorage) DeleteObject(ctx context.Context, objectKey string) error {
+	return s.pool.Do(ctx, func() error {
+		return s.ObjectStorage.DeleteObject(ctx, objectKey)
+	})
+}
+
+func (s *pooledStorage) CopyObject(ctx context.Context, srcKey, dstKey string) error {
+	return s.pool.Do(ctx, func() error {
+		return s.ObjectStorage.CopyObject(ctx, srcKey, dstKey)
+	})
+}
+
+func (s *pooledStorage) ArchiveObject(ctx context.Context, objectKey string) error {
+	return s.pool.Do(ctx, func() error {
+		return s.ObjectStorage.ArchiveObject(ctx, objectKey)
+	})
+}
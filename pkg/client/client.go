@@ -0,0 +1,140 @@
+// Package client is the Go client of the ronnin API, so services can file
+// reports, read tickets and receive webhooks without hand-rolling HTTP.
+//
+//	c := client.New("https://ronnin.example.com", os.Getenv("RONNIN_API_KEY"))
+//	ticket, err := c.CreateReport(ctx, &client.Report{Issue: "Checkout fails", Description: "..."})
+//
+// Its types mirror the API of the server in this repository and are kept in
+// step with it by tests.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIPrefix is the route group of the API version the client speaks
+const APIPrefix = "/api/v1"
+
+// Client calls the versioned API of a ronnin server. It is safe for
+// concurrent use.
+type Client struct {
+	baseURL   string
+	apiKey    string
+	http      *http.Client
+	userAgent string
+}
+
+// New creates a client of the server at baseURL, authenticating with an API
+// key, or with none when apiKey is ""
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		apiKey:    apiKey,
+		http:      &http.Client{Timeout: 2 * time.Minute},
+		userAgent: "ronnin-go-client",
+	}
+}
+
+// SetHTTPClient replaces the HTTP client requests are sent with, e.g. to
+// change the timeout or add tracing
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.http = client
+}
+
+// SetUserAgent sets the User-Agent of requests, which shows up in the
+// server's access log
+func (c *Client) SetUserAgent(userAgent string) {
+	c.userAgent = userAgent
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string       `json:"error"`
+	Code       string       `json:"code,omitempty"`
+	Details    string       `json:"details,omitempty"`
+	Fields     []FieldError `json:"fields,omitempty"`
+	RequestID  string       `json:"requestId,omitempty"`
+	// RetryAfter is how long the server asked to wait before retrying, on
+	// 429 and 503 responses
+	RetryAfter time.Duration
+}
+
+// FieldError describes a request field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("ronnin: %d %s", e.StatusCode, e.Message)
+	if e.Details != "" {
+		msg += ": " + e.Details
+	}
+	return msg
+}
+
+// do sends a request to path and returns the response once it is
+// successful; error responses are returned as *Error
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// call sends a request and decodes its JSON response into v
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body io.Reader, header http.Header, v interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("ronnin: failed to decode response: %w", err)
+	}
+	return nil
+}
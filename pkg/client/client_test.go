@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parvez-capri/ronnin/internal/models"
+	"github.com/parvez-capri/ronnin/internal/services"
+)
+
+// jsonFields returns the types of the fields of a struct by JSON name
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// TestTypesMatchServer fails when the API changes without the client types:
+// every field the server sends must be decoded, and every field decoded must
+// be sent
+func TestTypesMatchServer(t *testing.T) {
+	for _, tc := range []struct {
+		client, server interface{}
+		// serverOnly are fields the client leaves out on purpose
+		serverOnly []string
+	}{
+		{TicketResponse{}, models.TicketResponse{}, nil},
+		{SimilarTicket{}, models.SimilarTicket{}, nil},
+		{ReportStatus{}, models.ReportStatus{}, nil},
+		{FieldError{}, models.FieldError{}, nil},
+		{Issue{}, models.IssueGroup{}, nil},
+		{IssueTicket{}, models.IssueTicket{}, nil},
+		{TicketEventData{}, services.TicketEventData{}, nil},
+		{ReportFailedEventData{}, services.ReportFailedEventData{}, nil},
+		{WebhookEvent{}, services.Event{}, nil},
+		{Ticket{}, services.FlattenedTicket{}, []string{"ImageKey", "JiraLatencyMS", "Video", "QuarantineKey", "Reassignments"}},
+	} {
+		clientType, serverType := reflect.TypeOf(tc.client), reflect.TypeOf(tc.server)
+		clientFields, serverFields := jsonFields(clientType), jsonFields(serverType)
+		for _, name := range tc.serverOnly {
+			delete(serverFields, name)
+		}
+		for name, serverField := range serverFields {
+			clientField, ok := clientFields[name]
+			if !ok {
+				t.Errorf("%s has no field %q of %s", clientType, name, serverType)
+				continue
+			}
+			// Nested types are compared on their own; IDs and raw data are
+			// decoded from their JSON form
+			if clientField.Kind() != reflect.Struct && clientField.Kind() != reflect.Slice && serverField.Kind() != reflect.Interface &&
+				clientField != serverField && name != "ID" {
+				t.Errorf("%s.%s is a %s, but the server sends a %s", clientType, name, clientField, serverField)
+			}
+		}
+		for name := range clientFields {
+			if _, ok := serverFields[name]; !ok {
+				t.Errorf("%s.%s is not sent by the server in %s", clientType, name, serverType)
+			}
+		}
+	}
+}
+
+func TestWebhookSignatureMatchesServer(t *testing.T) {
+	secret := "s3cret"
+	body := []byte(`{"id":"9b2f","type":"ticket.updated","createdAt":"2026-01-02T15:04:05Z","data":{"ticketId":"PROJ-123","status":"Done","previousStatus":"In Progress"}}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := services.NewWebhookVerifier(secret, 0).Sign(timestamp, body)
+
+	if got := SignWebhook(secret, timestamp, body); got != signature {
+		t.Fatalf("SignWebhook = %q, server signs %q", got, signature)
+	}
+
+	newRequest := func(signature, timestamp string, body []byte) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/hooks/ronnin", bytes.NewReader(body))
+		req.Header.Set(WebhookSignatureHeader, signature)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		return req
+	}
+
+	event, err := ParseWebhook(newRequest(signature, timestamp, body), secret, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	data, err := event.TicketData()
+	if err != nil {
+		t.Fatalf("TicketData: %v", err)
+	}
+	if event.ID != "9b2f" || data.TicketID != "PROJ-123" || data.PreviousStatus != "In Progress" {
+		t.Errorf("event = %+v, data = %+v", event, data)
+	}
+
+	tampered := bytes.Replace(body, []byte("Done"), []byte("Open"), 1)
+	if _, err := ParseWebhook(newRequest(signature, timestamp, tampered), secret, 5*time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: err = %v, want ErrInvalidSignature", err)
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	oldSignature := services.NewWebhookVerifier(secret, 0).Sign(old, body)
+	if _, err := ParseWebhook(newRequest(oldSignature, old, body), secret, 5*time.Minute); !errors.Is(err, ErrStaleWebhook) {
+		t.Errorf("old timestamp: err = %v, want ErrStaleWebhook", err)
+	}
+}
+
+func TestCreateReport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/report-issue" || r.Header.Get("Authorization") != "Bearer rk_test" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("image0")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		if r.FormValue("issue") != "Checkout broken" || r.FormValue("product") != "shop" ||
+			header.Filename != "screenshot.png" || header.Header.Get("Content-Type") != "image/png" || string(content) != "png" {
+			http.Error(w, "unexpected form", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.TicketResponse{TicketID: "PROJ-1", Status: "created"})
+	}))
+	defer srv.Close()
+
+	ticket, err := New(srv.URL, "rk_test").CreateReport(context.Background(), &Report{
+		Issue:                 "Checkout broken",
+		Description:           "Pay button does nothing",
+		Product:               "shop",
+		Attachment:            strings.NewReader("png"),
+		AttachmentName:        "screenshot.png",
+		AttachmentContentType: "image/png",
+	})
+	if err != nil {
+		t.Fatalf("CreateReport: %v", err)
+	}
+	if ticket.TicketID != "PROJ-1" {
+		t.Errorf("ticket ID = %q, want PROJ-1", ticket.TicketID)
+	}
+}
+
+func TestAllTicketsFollowsCursors(t *testing.T) {
+	pages := map[string]map[string]interface{}{
+		"":   {"data": []map[string]interface{}{{"TicketID": "PROJ-3"}, {"TicketID": "PROJ-2"}}, "total": 3, "nextCursor": "c2"},
+		"c2": {"data": []map[string]interface{}{{"TicketID": "PROJ-1"}}, "total": 3},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Query().Get("cursor")]
+		if !ok || r.URL.Query().Get("pageSize") != "2" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Invalid cursor"})
+			return
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	var ids []string
+	for ticket, err := range New(srv.URL, "").AllTickets(context.Background(), 2) {
+		if err != nil {
+			t.Fatalf("AllTickets: %v", err)
+		}
+		ids = append(ids, ticket.TicketID)
+	}
+	if strings.Join(ids, ",") != "PROJ-3,PROJ-2,PROJ-1" {
+		t.Errorf("tickets = %v, want PROJ-3, PROJ-2, PROJ-1", ids)
+	}
+
+	_, err := New(srv.URL, "").ListTickets(context.Background(), &ListOptions{PageSize: 2, Cursor: "bad"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "Invalid cursor" {
+		t.Errorf("err = %v, want the API error", err)
+	}
+}
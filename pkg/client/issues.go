@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Issue is the tickets of reports of the same failure
+type Issue struct {
+	Fingerprint string `json:"fingerprint"`
+	// Title is the issue of the latest report
+	Title   string `json:"title"`
+	Product string `json:"product,omitempty"`
+	// Endpoints are the failed calls of the latest report, with IDs in
+	// their paths replaced
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Reports counts the tickets and the reports added to them in
+	// high-volume mode
+	Reports       int64     `json:"reports"`
+	AffectedUsers int64     `json:"affectedUsers"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	LastSeen      time.Time `json:"lastSeen"`
+	// Tickets of the issue, most recent first, up to 100 of TicketCount
+	Tickets     []IssueTicket `json:"tickets"`
+	TicketCount int64         `json:"ticketCount"`
+}
+
+// IssueTicket is a ticket of an issue
+type IssueTicket struct {
+	TicketID  string    `json:"ticketId"`
+	JiraLink  string    `json:"jiraLink"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// IssueOptions select a page of issues
+type IssueOptions struct {
+	ListOptions
+	// Product limits the issues to those of a product
+	Product string
+	// Since leaves out reports before it
+	Since time.Time
+}
+
+// IssuePage is a page of issues, most recently seen first
+type IssuePage struct {
+	Issues     []Issue `json:"data"`
+	Page       int     `json:"page"`
+	PageSize   int     `json:"pageSize"`
+	Total      int64   `json:"total"`
+	NextCursor string  `json:"nextCursor"`
+}
+
+// ListIssues returns a page of the issues the tickets the API key may read
+// are grouped into
+func (c *Client) ListIssues(ctx context.Context, opts *IssueOptions) (*IssuePage, error) {
+	query := url.Values{}
+	if opts != nil {
+		if opts.Page > 0 {
+			query.Set("page", strconv.Itoa(opts.Page))
+		}
+		if opts.PageSize > 0 {
+			query.Set("pageSize", strconv.Itoa(opts.PageSize))
+		}
+		if opts.Cursor != "" {
+			query.Set("cursor", opts.Cursor)
+		}
+		if opts.Product != "" {
+			query.Set("product", opts.Product)
+		}
+		if !opts.Since.IsZero() {
+			query.Set("since", opts.Since.UTC().Format(time.RFC3339))
+		}
+	}
+	var page IssuePage
+	if err := c.call(ctx, http.MethodGet, APIPrefix+"/issues", query, nil, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"time"
+)
+
+// Report is an issue report, filed like the browser SDK files them
+type Report struct {
+	Issue       string
+	Description string
+	UserEmail   string
+	LeadID      string
+	Product     string
+	// Severity is critical, high, medium or low
+	Severity string
+	PageURL  string
+	// FailedNetworkCalls is a JSON array of the failed calls of the page
+	FailedNetworkCalls string
+
+	// Attachment is a screenshot or screen recording uploaded with the
+	// report, named AttachmentName with the type AttachmentContentType. It
+	// is streamed, not held in memory.
+	Attachment            io.Reader
+	AttachmentName        string
+	AttachmentContentType string
+	// ImageURL links a screenshot hosted elsewhere when there is no
+	// attachment
+	ImageURL string
+}
+
+// TicketResponse is the ticket created for a report
+type TicketResponse struct {
+	TicketID   string `json:"ticketId"`
+	Status     string `json:"status"`
+	AssignedTo string `json:"assignedTo"`
+	JiraLink   string `json:"jiraLink"`
+	// StatusURL is the reporter status page, when status tokens are enabled
+	StatusURL string `json:"statusUrl,omitempty"`
+	// SimilarTickets are recent open tickets resembling the new one, when
+	// similar ticket suggestions are enabled
+	SimilarTickets []SimilarTicket `json:"similarTickets,omitempty"`
+}
+
+// SimilarTicket is a recent open ticket whose report resembles a new one
+type SimilarTicket struct {
+	TicketID  string    `json:"ticketId"`
+	Issue     string    `json:"issue"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Score is the text similarity of the reports, from 0 to 1
+	Score float64 `json:"score"`
+}
+
+// Statuses of asynchronous reports
+const (
+	ReportQueued     = "queued"
+	ReportProcessing = "processing"
+	ReportCompleted  = "completed"
+	ReportFailed     = "failed"
+)
+
+// ReportStatus is the processing state of a report filed asynchronously
+type ReportStatus struct {
+	ID        string    `json:"reportId"`
+	Status    string    `json:"status"`
+	TicketID  string    `json:"ticketId,omitempty"`
+	JiraLink  string    `json:"jiraLink,omitempty"`
+	StatusURL string    `json:"statusUrl,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	SimilarTickets []SimilarTicket `json:"similarTickets,omitempty"`
+}
+
+// CreateReport files a report and returns its ticket
+func (c *Client) CreateReport(ctx context.Context, report *Report) (*TicketResponse, error) {
+	var ticket TicketResponse
+	if err := c.postReport(ctx, report, nil, &ticket); err != nil {
+		return nil, err
+	}
+	return &ticket, nil
+}
+
+// CreateReportAsync queues a report and returns its status, to be followed
+// with GetReportStatus until it is completed or failed
+func (c *Client) CreateReportAsync(ctx context.Context, report *Report) (*ReportStatus, error) {
+	var status ReportStatus
+	if err := c.postReport(ctx, report, url.Values{"async": {"true"}}, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetReportStatus returns the status of a report filed asynchronously
+func (c *Client) GetReportStatus(ctx context.Context, reportID string) (*ReportStatus, error) {
+	var status ReportStatus
+	if err := c.call(ctx, http.MethodGet, APIPrefix+"/reports/"+url.PathEscape(reportID)+"/status", nil, nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// postReport streams a report as a multipart form to /report-issue
+func (c *Client) postReport(ctx context.Context, report *Report, query url.Values, v interface{}) error {
+	if report.Issue == "" || report.Description == "" {
+		return fmt.Errorf("ronnin: a report needs an issue and a description")
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeReport(form, report))
+	}()
+	defer body.Close()
+
+	return c.call(ctx, http.MethodPost, APIPrefix+"/report-issue", query, body, http.Header{"Content-Type": {form.FormDataContentType()}}, v)
+}
+
+// writeReport writes the fields of a report that are set, and its
+// attachment as image0
+func writeReport(form *multipart.Writer, report *Report) error {
+	for _, field := range [][2]string{
+		{"issue", report.Issue},
+		{"description", report.Description},
+		{"userEmail", report.UserEmail},
+		{"leadId", report.LeadID},
+		{"product", report.Product},
+		{"severity", report.Severity},
+		{"pageUrl", report.PageURL},
+		{"failedNetworkCalls", report.FailedNetworkCalls},
+		{"imageS3URL", report.ImageURL},
+	} {
+		if field[1] == "" {
+			continue
+		}
+		if err := form.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+
+	if report.Attachment != nil {
+		name := report.AttachmentName
+		if name == "" {
+			name = "attachment"
+		}
+		contentType := report.AttachmentContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="image0"; filename=%q`, name))
+		header.Set("Content-Type", contentType)
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, report.Attachment); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Ticket is a stored ticket. The API sends tickets with their fields named
+// as here.
+type Ticket struct {
+	ID         string
+	TicketID   string
+	Status     string
+	AssignedTo string
+	JiraLink   string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	// RequestID is the ID of the request that reported the issue
+	RequestID string
+	// Tenant is the tenant the ticket was reported for, if any
+	Tenant string
+
+	Issue       string
+	Description string
+	UserEmail   string
+	LeadID      string
+	Product     string
+	PageURL     string
+	ImageURL    string
+
+	Category     string
+	Severity     string
+	ClassifiedBy string
+
+	// Browser, OS and Device describe where the reporter reported from
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	Device         string
+
+	ImageURLExpiresAt time.Time
+	ImageContentType  string
+	AttachmentStatus  string
+
+	ArchivedAt time.Time
+	Resolution string
+	SyncedAt   time.Time
+
+	HelpdeskTicketID string
+	HelpdeskLink     string
+	HelpdeskStatus   string
+
+	// ExportedTo is the tracker ticket a collected ticket was exported as
+	ExportedTo string
+	// Occurrences are the reports added to the ticket in high-volume mode
+	Occurrences int
+	// Fingerprint identifies the failure reported; tickets of the same
+	// failure form an issue
+	Fingerprint string
+
+	FailedNetworkCallsJSON string
+	PayloadJSON            string
+	ResponseJSON           string
+	RequestHeadersJSON     string
+}
+
+// ListOptions select a page of tickets
+type ListOptions struct {
+	// Page is the page number, starting at 1
+	Page int
+	// PageSize is the number of tickets per page, 50 by default and at most
+	// 200
+	PageSize int
+	// Cursor is the NextCursor of the previous page, which takes precedence
+	// over Page and keeps pages stable while tickets are created
+	Cursor string
+}
+
+// TicketPage is a page of tickets, most recent first
+type TicketPage struct {
+	Tickets  []Ticket `json:"data"`
+	Page     int      `json:"page"`
+	PageSize int      `json:"pageSize"`
+	Total    int64    `json:"total"`
+	// NextCursor selects the next page, and is empty on the last one
+	NextCursor string `json:"nextCursor"`
+}
+
+// ListTickets returns a page of the tickets the API key may read
+func (c *Client) ListTickets(ctx context.Context, opts *ListOptions) (*TicketPage, error) {
+	query := url.Values{}
+	if opts != nil {
+		if opts.Page > 0 {
+			query.Set("page", strconv.Itoa(opts.Page))
+		}
+		if opts.PageSize > 0 {
+			query.Set("pageSize", strconv.Itoa(opts.PageSize))
+		}
+		if opts.Cursor != "" {
+			query.Set("cursor", opts.Cursor)
+		}
+	}
+	var page TicketPage
+	if err := c.call(ctx, http.MethodGet, APIPrefix+"/tickets", query, nil, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllTickets iterates over every ticket the API key may read, most recent
+// first, fetching pageSize tickets at a time. Iteration stops at the first
+// error, which is yielded.
+//
+//	for ticket, err := range c.AllTickets(ctx, 200) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (c *Client) AllTickets(ctx context.Context, pageSize int) iter.Seq2[*Ticket, error] {
+	return func(yield func(*Ticket, error) bool) {
+		opts := &ListOptions{PageSize: pageSize}
+		for {
+			page, err := c.ListTickets(ctx, opts)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for i := range page.Tickets {
+				if !yield(&page.Tickets[i], nil) {
+					return
+				}
+			}
+			if page.NextCursor == "" {
+				return
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}
+}
+
+// GetTicket returns a ticket by ID, e.g. PROJ-123
+func (c *Client) GetTicket(ctx context.Context, ticketID string) (*Ticket, error) {
+	var ticket Ticket
+	if err := c.call(ctx, http.MethodGet, APIPrefix+"/tickets/"+url.PathEscape(ticketID), nil, nil, nil, &ticket); err != nil {
+		return nil, err
+	}
+	return &ticket, nil
+}
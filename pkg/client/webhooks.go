@@ -0,0 +1,157 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of the webhooks ronnin sends to subscribers
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookEventHeader     = "X-Webhook-Event"
+)
+
+// Events sent to webhook subscribers
+const (
+	EventTicketCreated = "ticket.created"
+	EventTicketUpdated = "ticket.updated"
+	EventReportFailed  = "report.failed"
+)
+
+// Errors of webhook verification
+var (
+	ErrInvalidSignature = errors.New("ronnin: invalid webhook signature")
+	ErrStaleWebhook     = errors.New("ronnin: webhook timestamp is missing or outside the accepted window")
+)
+
+// maxWebhookSize bounds the webhook bodies ParseWebhook reads
+const maxWebhookSize = 1 << 20
+
+// WebhookEvent is a ticket lifecycle event sent to a webhook subscriber.
+// Its ID stays the same across retries and replays, for deduplication.
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// TicketEventData is the data of ticket.created and ticket.updated events.
+// Previous fields are set on ticket.updated events.
+type TicketEventData struct {
+	TicketID           string `json:"ticketId"`
+	JiraLink           string `json:"jiraLink,omitempty"`
+	Summary            string `json:"summary,omitempty"`
+	Product            string `json:"product,omitempty"`
+	Severity           string `json:"severity,omitempty"`
+	Category           string `json:"category,omitempty"`
+	Reporter           string `json:"reporter,omitempty"`
+	Status             string `json:"status"`
+	AssignedTo         string `json:"assignedTo,omitempty"`
+	Resolution         string `json:"resolution,omitempty"`
+	PreviousStatus     string `json:"previousStatus,omitempty"`
+	PreviousAssignedTo string `json:"previousAssignedTo,omitempty"`
+	Tenant             string `json:"tenant,omitempty"`
+}
+
+// ReportFailedEventData is the data of report.failed events
+type ReportFailedEventData struct {
+	Product   string `json:"product,omitempty"`
+	Status    int    `json:"status"`
+	Code      string `json:"code,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// TicketData decodes the data of a ticket.created or ticket.updated event
+func (e *WebhookEvent) TicketData() (*TicketEventData, error) {
+	if e.Type != EventTicketCreated && e.Type != EventTicketUpdated {
+		return nil, fmt.Errorf("ronnin: %s is not a ticket event", e.Type)
+	}
+	var data TicketEventData
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return nil, fmt.Errorf("ronnin: failed to decode event data: %w", err)
+	}
+	return &data, nil
+}
+
+// ReportFailedData decodes the data of a report.failed event
+func (e *WebhookEvent) ReportFailedData() (*ReportFailedEventData, error) {
+	if e.Type != EventReportFailed {
+		return nil, fmt.Errorf("ronnin: %s is not a report.failed event", e.Type)
+	}
+	var data ReportFailedEventData
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return nil, fmt.Errorf("ronnin: failed to decode event data: %w", err)
+	}
+	return &data, nil
+}
+
+// SignWebhook returns the signature of a webhook body sent at timestamp, in
+// Unix seconds: "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<body>"
+// with the subscription's secret
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks the signature of a webhook body and its
+// timestamp header
+func VerifyWebhookSignature(secret, signature, timestamp string, body []byte) error {
+	if signature == "" {
+		return fmt.Errorf("%w: signature is missing", ErrInvalidSignature)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		signature = "sha256=" + signature
+	}
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(SignWebhook(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ParseWebhook reads a webhook request, checks its signature with the
+// subscription's secret and that it was sent within tolerance of now, and
+// returns its event. Receivers should still skip events whose ID they
+// handled before.
+//
+//	event, err := client.ParseWebhook(r, secret, 5*time.Minute)
+//	if err != nil {
+//		http.Error(w, err.Error(), http.StatusUnauthorized)
+//		return
+//	}
+func ParseWebhook(r *http.Request, secret string, tolerance time.Duration) (*WebhookEvent, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		return nil, fmt.Errorf("ronnin: failed to read webhook: %w", err)
+	}
+	timestamp := r.Header.Get(WebhookTimestampHeader)
+	if err := VerifyWebhookSignature(secret, r.Header.Get(WebhookSignatureHeader), timestamp, body); err != nil {
+		return nil, err
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrStaleWebhook
+	}
+	if sentAt := time.Unix(seconds, 0); time.Since(sentAt).Abs() > tolerance {
+		return nil, ErrStaleWebhook
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("ronnin: failed to decode webhook: %w", err)
+	}
+	return &event, nil
+}
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request it
+// serves, so work done for the request can be correlated with it
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext returns log with the request ID carried by ctx added to every
+// line, or log itself when ctx carries none
+func FromContext(ctx context.Context, log *zap.Logger) *zap.Logger {
+	if id := RequestID(ctx); id != "" {
+		return log.With(zap.String("request_id", id))
+	}
+	return log
+}
@@ -6,6 +6,12 @@ import (
 )
 
 func NewLogger(level, env string) (*zap.Logger, error) {
+	return NewLoggerWithLevel(zap.NewAtomicLevelAt(ParseLevel(level)), env)
+}
+
+// NewLoggerWithLevel creates a logger whose level can be changed at runtime
+// through level
+func NewLoggerWithLevel(level zap.AtomicLevel, env string) (*zap.Logger, error) {
 	var config zap.Config
 
 	if env == "production" {
@@ -16,21 +22,23 @@ func NewLogger(level, env string) (*zap.Logger, error) {
 		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	}
 
-	// Set log level
-	var logLevel zapcore.Level
+	config.Level = level
+
+	return config.Build()
+}
+
+// ParseLevel converts a configured log level name, defaulting to info
+func ParseLevel(level string) zapcore.Level {
 	switch level {
 	case "debug":
-		logLevel = zap.DebugLevel
+		return zap.DebugLevel
 	case "info":
-		logLevel = zap.InfoLevel
+		return zap.InfoLevel
 	case "warn":
-		logLevel = zap.WarnLevel
+		return zap.WarnLevel
 	case "error":
-		logLevel = zap.ErrorLevel
+		return zap.ErrorLevel
 	default:
-		logLevel = zap.InfoLevel
+		return zap.InfoLevel
 	}
-	config.Level = zap.NewAtomicLevelAt(logLevel)
-
-	return config.Build()
 }
\ No newline at end of file
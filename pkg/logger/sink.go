@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Sinks log lines can be written to
+const (
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+	SinkHTTP   = "http"
+)
+
+// httpSinkBatch and httpSinkInterval bound how many lines, and for how
+// long, lines are collected before they are posted
+const (
+	httpSinkBatch    = 100
+	httpSinkInterval = time.Second
+)
+
+// NewSinkLogger creates a logger writing JSON lines at info level and above
+// to a sink other than the standard output: the file at target, the syslog
+// daemon at target (e.g. udp://logs.internal:514, the local daemon when
+// empty) or the HTTP endpoint at target, which lines are posted to in
+// batches as NDJSON. The returned func flushes and closes the sink.
+func NewSinkLogger(sink, target string) (*zap.Logger, func() error, error) {
+	var ws zapcore.WriteSyncer
+	closeSink := func() error { return nil }
+
+	switch sink {
+	case SinkFile:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		ws, closeSink = zapcore.AddSync(f), f.Close
+	case SinkSyslog:
+		network, address := "", ""
+		if target != "" {
+			u, err := url.Parse(target)
+			if err != nil || u.Host == "" {
+				return nil, nil, fmt.Errorf("invalid syslog address %q, expected e.g. udp://host:514", target)
+			}
+			network, address = u.Scheme, u.Host
+		}
+		w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, "ronnin")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		ws, closeSink = zapcore.AddSync(w), w.Close
+	case SinkHTTP:
+		if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, nil, fmt.Errorf("invalid log endpoint %q", target)
+		}
+		h := newHTTPSink(target)
+		ws, closeSink = h, h.Close
+	default:
+		return nil, nil, fmt.Errorf("unknown log sink %q", sink)
+	}
+
+	encoder := zap.NewProductionEncoderConfig()
+	encoder.EncodeTime = zapcore.ISO8601TimeEncoder
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoder), ws, zap.InfoLevel)
+	return zap.New(core), closeSink, nil
+}
+
+// httpSink posts log lines to an HTTP endpoint in batches. Lines that
+// cannot be posted are dropped, so a slow endpoint never holds up requests.
+type httpSink struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	lines   int
+	flushes chan struct{}
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func newHTTPSink(target string) *httpSink {
+	s := &httpSink{
+		url:     target,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		flushes: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	s.stopped.Add(1)
+	go s.run()
+	return s
+}
+
+// Write buffers a line, asking for a flush once a batch is full
+func (s *httpSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.Write(p)
+	s.lines++
+	if s.lines >= httpSinkBatch {
+		select {
+		case s.flushes <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Sync posts the buffered lines
+func (s *httpSink) Sync() error {
+	s.mu.Lock()
+	if s.buf.Len() == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	batch := bytes.Clone(s.buf.Bytes())
+	s.buf.Reset()
+	s.lines = 0
+	s.mu.Unlock()
+
+	resp, err := s.client.Post(s.url, "application/x-ndjson", bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("log endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Close posts the remaining lines and stops posting
+func (s *httpSink) Close() error {
+	close(s.done)
+	s.stopped.Wait()
+	return s.Sync()
+}
+
+func (s *httpSink) run() {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(httpSinkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.flushes:
+		}
+		if err := s.Sync(); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to post log lines:", err)
+		}
+	}
+}
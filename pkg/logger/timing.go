@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type timingsKey struct{}
+
+// Timings adds up the time a request spends in each stage of its handling,
+// such as binding the body or calling Jira. It is safe for concurrent use.
+type Timings struct {
+	mu     sync.Mutex
+	stages map[string]time.Duration
+	calls  map[string]int
+}
+
+// WithTimings returns a copy of ctx collecting stage timings, and the
+// timings collected
+func WithTimings(ctx context.Context) (context.Context, *Timings) {
+	t := &Timings{stages: make(map[string]time.Duration), calls: make(map[string]int)}
+	return context.WithValue(ctx, timingsKey{}, t), t
+}
+
+// AddStage adds d to the time spent in stage by the request ctx serves. It
+// does nothing when ctx collects no timings.
+func AddStage(ctx context.Context, stage string, d time.Duration) {
+	t, _ := ctx.Value(timingsKey{}).(*Timings)
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stages[stage] += d
+	t.calls[stage]++
+}
+
+// StartStage starts timing a stage, returning the func that ends it:
+//
+//	defer logger.StartStage(ctx, "jira")()
+func StartStage(ctx context.Context, stage string) func() {
+	if ctx.Value(timingsKey{}) == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { AddStage(ctx, stage, time.Since(start)) }
+}
+
+// Field returns the stages field, holding the total duration and number of
+// calls of each stage. Stages may overlap, so they need not add up to the
+// request latency.
+func (t *Timings) Field() zap.Field {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.stages))
+	for stage := range t.stages {
+		names = append(names, stage)
+	}
+	sort.Strings(names)
+	stages := make([]zap.Field, 0, len(names))
+	for _, stage := range names {
+		stages = append(stages, zap.Dict(stage,
+			zap.Duration("duration", t.stages[stage]),
+			zap.Int("calls", t.calls[stage]),
+		))
+	}
+	return zap.Dict("stages", stages...)
+}